@@ -55,25 +55,40 @@ func BuildAndSubmit(c *gin.Context, in FinalizeInput) {
 
 	sameAsOrig := ac.ConvertedReqBody != "" && ac.ConvertedReqBody == origBody
 
-	// 检查四个 body 字段总大小是否超过 S3 阈值
 	convBody := ac.ConvertedReqBody
 	if sameAsOrig {
 		convBody = ""
 	}
+
+	// 零数据保留的令牌/分组不采集 body；其余请求在离开进程前做内容脱敏
+	droppedNote := ""
+	if isZeroRetention(c) {
+		origBody, convBody, ac.UpstreamResponse, in.ClientResponse = "", "", "", ""
+		droppedNote = "zero_data_retention"
+	} else if pkgConfig.bodyRedactor != nil {
+		hits := make(map[string]int)
+		origBody = pkgConfig.bodyRedactor.Redact(origBody, hits)
+		convBody = pkgConfig.bodyRedactor.Redact(convBody, hits)
+		ac.UpstreamResponse = pkgConfig.bodyRedactor.Redact(ac.UpstreamResponse, hits)
+		in.ClientResponse = pkgConfig.bodyRedactor.Redact(in.ClientResponse, hits)
+		reportRedactionHits(hits)
+	}
+
+	// 检查四个 body 字段总大小是否超过单独存放的阈值
 	totalBodySize := len(origBody) + len(convBody) + len(ac.UpstreamResponse) + len(in.ClientResponse)
 	threshold := pkgConfig.BodyS3ThresholdKB * 1024
 
 	var s3Key string
-	if pkgConfig.BodyS3Bucket != "" && threshold > 0 && totalBodySize > threshold {
+	if backend != nil && backend.BodyStoreEnabled() && threshold > 0 && totalBodySize > threshold {
 		xrid := c.GetString("X-Request-ID")
 		s3Key = bodyS3Key(pkgConfig, in.Start, xrid)
-		uploadBodyAsync(pkgConfig, awsClient.s3c, s3Key, bodyDoc{
+		uploadBodyAsync(backend, s3Key, bodyDoc{
 			OriginalReqBody:  origBody,
 			ConvertedReqBody: convBody,
 			UpstreamResponse: ac.UpstreamResponse,
 			ClientResponse:   in.ClientResponse,
 		})
-		// body 字段留空，Iceberg 只存 key
+		// body 字段留空，审计表只存 key
 		origBody = ""
 		convBody = ""
 		ac.UpstreamResponse = ""
@@ -100,10 +115,19 @@ func BuildAndSubmit(c *gin.Context, in FinalizeInput) {
 		UpstreamResponse:        ac.UpstreamResponse,
 		ClientResponse:          in.ClientResponse,
 		TruncatedFields:         truncFields,
+		DroppedNote:             droppedNote,
 	}
 	Submit(r)
 }
 
+func isZeroRetention(c *gin.Context) bool {
+	if _, ok := pkgConfig.zdrTokens[c.GetInt("token_id")]; ok {
+		return true
+	}
+	_, ok := pkgConfig.zdrGroups[c.GetString("group")]
+	return ok
+}
+
 func actualModelFromCtx(c *gin.Context) string {
 	if v := c.GetString("audit_actual_model"); v != "" {
 		return v
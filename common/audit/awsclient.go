@@ -41,6 +41,12 @@ func newAWSClient(cfg *auditConfig) *awsAuditClient {
 	}
 }
 
+func (c *awsAuditClient) Name() string { return "Firehose → Iceberg" }
+
+func (c *awsAuditClient) Ensure(ctx context.Context) error {
+	return c.ensureGlueResources(ctx)
+}
+
 func (c *awsAuditClient) Close() error {
 	return nil
 }
@@ -50,7 +56,7 @@ const (
 	maxBytesPerBatch   = 4 * 1024 * 1024
 )
 
-func (c *awsAuditClient) putRecordBatch(ctx context.Context, batch []*AuditRecord) (sent int, err error) {
+func (c *awsAuditClient) PutBatch(ctx context.Context, batch []*AuditRecord) (sent int, err error) {
 	records := make([]firehoseTypes.Record, 0, min(len(batch), maxRecordsPerBatch))
 	var totalBytes int
 
@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	BackendAWS  = "aws"  // Firehose → Iceberg，Athena 查询，大 body 存 S3
+	BackendFile = "file" // 按天分区的 NDJSON 文件，存本地磁盘或 S3 兼容存储（MinIO），内置扫描查询
+)
+
+// AuditSink 审计记录的写入端。PutBatch 返回已成功写入的前缀条数，其余由调用方落盘重试
+type AuditSink interface {
+	Name() string
+	// Ensure 启动时建库建表或检查存储可写，须幂等
+	Ensure(ctx context.Context) error
+	PutBatch(ctx context.Context, batch []*AuditRecord) (sent int, err error)
+	// BodyStoreEnabled 是否支持把超过阈值的大 body 单独存放
+	BodyStoreEnabled() bool
+	PutBody(ctx context.Context, key string, doc bodyDoc) error
+	Close() error
+}
+
+// AuditQuerier 审计记录的查询与维护端，QueryLogs / QueryDetail 收到的参数已通过校验
+type AuditQuerier interface {
+	QueryLogs(ctx context.Context, params QueryParams) ([]AuditSummary, int64, error)
+	QueryDetail(ctx context.Context, xRequestID string, startTS, endTS int64) (*AuditDetail, error)
+	FetchBody(ctx context.Context, key string) (*bodyDoc, error)
+	// Compact 合并某天分区的小文件；Retain 删除 cutoff 之前的数据
+	Compact(ctx context.Context, day time.Time) error
+	Retain(ctx context.Context, cutoff time.Time) error
+}
+
+type auditBackend interface {
+	AuditSink
+	AuditQuerier
+}
+
+func newBackend(cfg *auditConfig) (auditBackend, error) {
+	switch cfg.Backend {
+	case BackendAWS, "":
+		if cfg.AWSRegion == "" || cfg.AWSAccessKey == "" || cfg.AWSSecretKey == "" {
+			return nil, errors.New("缺少 AWS 凭证配置")
+		}
+		if cfg.FirehoseStream == "" {
+			return nil, errors.New("缺少 AUDIT_FIREHOSE_STREAM 配置")
+		}
+		return newAWSClient(cfg), nil
+	case BackendFile:
+		b, err := newFileBackend(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("未知的审计后端: %s", cfg.Backend)
+}
@@ -0,0 +1,398 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/metrics"
+	"github.com/tidwall/gjson"
+)
+
+// 请求/响应 body 的内容脱敏：记录离开进程前按规则把 PII 和密钥替换成掩码。
+//
+// 规则分两类：
+//   - 不带 paths 的规则直接扫描整段文本（JSON、SSE、纯文本都适用）；
+//   - 带 paths 的规则只作用于 JSON 中匹配路径下的字符串值（如 messages[*].content），
+//     body 不是合法 JSON（被截断、SSE 流）时退化为整段扫描，宁可多遮不可漏遮。
+//
+// 掩码默认保留格式（长度、分隔符、末 4 位），便于排障时辨认是哪一类数据。
+
+const (
+	MaskPartial = "partial" // 保留格式与少量特征字符，其余替换为 *
+	MaskFull    = "full"    // 每个字符替换为 *，只保留长度
+	MaskTag     = "tag"     // 整体替换为 [REDACTED:<rule>]
+)
+
+// BuiltinRedactRules 内置规则名，按此顺序执行：卡号、证件号先于手机号，避免长数字被手机号规则截走一段
+var BuiltinRedactRules = []string{"card", "national_id", "api_key", "email", "phone"}
+
+type builtinRule struct {
+	pattern  *regexp.Regexp
+	validate func(match string) bool
+	mask     func(match string) string
+}
+
+var builtinRules = map[string]builtinRule{
+	"card": {
+		pattern:  regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		validate: func(s string) bool { return luhnValid(digitsOf(s)) },
+		mask:     maskKeepLastDigits,
+	},
+	"national_id": {
+		// 中国居民身份证（校验码校验）与美国 SSN
+		pattern: regexp.MustCompile(`\b\d{17}[\dXx]\b|\b\d{3}-\d{2}-\d{4}\b`),
+		validate: func(s string) bool {
+			if len(s) == 18 {
+				return cnIDValid(s)
+			}
+			return true
+		},
+		mask: maskKeepLastDigits,
+	},
+	"api_key": {
+		pattern: regexp.MustCompile(`\b(?:sk|pk|rk|ak|ek)-[A-Za-z0-9_\-]{16,}|\bAKIA[0-9A-Z]{16}\b|\bgh[pousr]_[A-Za-z0-9]{36,}\b|\bxox[abprs]-[A-Za-z0-9\-]{10,}|\bAIza[0-9A-Za-z_\-]{35}\b`),
+		mask:    maskSecret,
+	},
+	"email": {
+		pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+		mask:    maskEmail,
+	},
+	"phone": {
+		// 国际格式、中国大陆手机号、北美 (xxx) xxx-xxxx
+		pattern: regexp.MustCompile(`\+\d{1,3}[ \-]?\(?\d{1,4}\)?(?:[ \-]?\d{2,4}){2,4}\b|\b1[3-9]\d{9}\b|\(?\b\d{3}\)?[ .\-]\d{3}[ .\-]\d{4}\b`),
+		validate: func(s string) bool {
+			n := len(digitsOf(s))
+			return n >= 7 && n <= 15
+		},
+		mask: maskKeepLastDigits,
+	},
+}
+
+type redactRule struct {
+	name     string
+	pattern  *regexp.Regexp
+	validate func(string) bool
+	mask     func(string) string
+	paths    [][]string
+}
+
+// redactRuleConfig auditConfig.bodyRedactionRules 的一项。builtin 非空时使用内置正则，pattern 被忽略
+type redactRuleConfig struct {
+	Name    string   `json:"name"`
+	Builtin string   `json:"builtin"`
+	Pattern string   `json:"pattern"`
+	Paths   []string `json:"paths"`
+	Mask    string   `json:"mask"`
+}
+
+type bodyRedactor struct {
+	rules []redactRule
+}
+
+// newBodyRedactor 编译规则，非法规则记日志后跳过，不影响其余规则
+func newBodyRedactor(configs []redactRuleConfig) *bodyRedactor {
+	r := &bodyRedactor{}
+	for _, rc := range configs {
+		rule, err := compileRedactRule(rc)
+		if err != nil {
+			logger.SysError("audit: 忽略脱敏规则 " + rc.Name + ": " + err.Error())
+			continue
+		}
+		r.rules = append(r.rules, rule)
+	}
+	return r
+}
+
+func compileRedactRule(rc redactRuleConfig) (redactRule, error) {
+	rule := redactRule{name: rc.Name}
+	if rc.Builtin != "" {
+		b, ok := builtinRules[rc.Builtin]
+		if !ok {
+			return rule, fmt.Errorf("未知的内置规则 %s", rc.Builtin)
+		}
+		if rule.name == "" {
+			rule.name = rc.Builtin
+		}
+		rule.pattern, rule.validate, rule.mask = b.pattern, b.validate, b.mask
+	} else {
+		if rc.Name == "" || rc.Pattern == "" {
+			return rule, fmt.Errorf("自定义规则需要 name 和 pattern")
+		}
+		re, err := regexp.Compile(rc.Pattern)
+		if err != nil {
+			return rule, err
+		}
+		rule.pattern, rule.mask = re, maskFull
+	}
+	switch rc.Mask {
+	case "":
+	case MaskPartial:
+		if rc.Builtin == "" {
+			rule.mask = maskPartial
+		}
+	case MaskFull:
+		rule.mask = maskFull
+	case MaskTag:
+		tag := "[REDACTED:" + rule.name + "]"
+		rule.mask = func(string) string { return tag }
+	default:
+		return rule, fmt.Errorf("未知的掩码类型 %s", rc.Mask)
+	}
+	for _, p := range rc.Paths {
+		segs, err := parseRedactPath(p)
+		if err != nil {
+			return rule, err
+		}
+		rule.paths = append(rule.paths, segs)
+	}
+	return rule, nil
+}
+
+// parseRedactPath 把 messages[*].content 拆成 ["messages","*","content"]，支持 [*] 与 [n]
+func parseRedactPath(p string) ([]string, error) {
+	var segs []string
+	for _, part := range strings.Split(p, ".") {
+		name := part
+		var idx []string
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			name = part[:i]
+			rest := part[i:]
+			for rest != "" {
+				end := strings.IndexByte(rest, ']')
+				if rest[0] != '[' || end < 0 {
+					return nil, fmt.Errorf("非法路径 %s", p)
+				}
+				v := rest[1:end]
+				if _, err := strconv.Atoi(v); v != "*" && err != nil {
+					return nil, fmt.Errorf("非法路径 %s", p)
+				}
+				idx = append(idx, v)
+				rest = rest[end+1:]
+			}
+		}
+		if name != "" {
+			segs = append(segs, name)
+		}
+		segs = append(segs, idx...)
+	}
+	if len(segs) == 0 {
+		return nil, fmt.Errorf("非法路径 %s", p)
+	}
+	return segs, nil
+}
+
+// Redact 依次应用全部规则返回脱敏后的文本，各规则命中次数累加到 hits
+func (r *bodyRedactor) Redact(s string, hits map[string]int) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, rule := range r.rules {
+		if len(rule.paths) > 0 && gjson.Valid(s) {
+			s = rule.applyPaths(s, hits)
+		} else {
+			s = rule.applyText(s, hits)
+		}
+	}
+	return s
+}
+
+func (rule redactRule) applyText(s string, hits map[string]int) string {
+	return rule.pattern.ReplaceAllStringFunc(s, func(m string) string {
+		if rule.validate != nil && !rule.validate(m) {
+			return m
+		}
+		hits[rule.name]++
+		return rule.mask(m)
+	})
+}
+
+type jsonStringLeaf struct {
+	index int
+	raw   string
+	value string
+}
+
+// applyPaths 只改写匹配路径下的字符串字面量，按原始偏移拼接，保留原 JSON 的键顺序和排版
+func (rule redactRule) applyPaths(s string, hits map[string]int) string {
+	seen := map[int]bool{}
+	var leaves []jsonStringLeaf
+	root := gjson.Parse(s)
+	for _, segs := range rule.paths {
+		collectPath(root, segs, func(v gjson.Result) {
+			collectStrings(v, func(leaf gjson.Result) {
+				if !seen[leaf.Index] {
+					seen[leaf.Index] = true
+					leaves = append(leaves, jsonStringLeaf{index: leaf.Index, raw: leaf.Raw, value: leaf.Str})
+				}
+			})
+		})
+	}
+	sort.Slice(leaves, func(i, j int) bool { return leaves[i].index > leaves[j].index })
+	for _, leaf := range leaves {
+		if leaf.index+len(leaf.raw) > len(s) || s[leaf.index:leaf.index+len(leaf.raw)] != leaf.raw {
+			continue
+		}
+		masked := rule.applyText(leaf.value, hits)
+		if masked == leaf.value {
+			continue
+		}
+		s = s[:leaf.index] + marshalJSONString(masked) + s[leaf.index+len(leaf.raw):]
+	}
+	return s
+}
+
+func collectPath(v gjson.Result, segs []string, fn func(gjson.Result)) {
+	if len(segs) == 0 {
+		fn(v)
+		return
+	}
+	seg := segs[0]
+	v.ForEach(func(key, value gjson.Result) bool {
+		switch {
+		case seg == "*":
+			collectPath(value, segs[1:], fn)
+		case v.IsArray():
+			if strconv.Itoa(int(key.Num)) == seg {
+				collectPath(value, segs[1:], fn)
+				return false
+			}
+		case key.Str == seg:
+			collectPath(value, segs[1:], fn)
+			return false
+		}
+		return true
+	})
+}
+
+// collectStrings 收集 v 及其所有子节点中的字符串值（content 可能是多段 parts 数组）
+func collectStrings(v gjson.Result, fn func(gjson.Result)) {
+	switch {
+	case v.Type == gjson.String:
+		fn(v)
+	case v.IsArray() || v.IsObject():
+		v.ForEach(func(_, value gjson.Result) bool {
+			collectStrings(value, fn)
+			return true
+		})
+	}
+}
+
+func marshalJSONString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// reportRedactionHits 把本次命中数累加到 Prometheus 计数器
+func reportRedactionHits(hits map[string]int) {
+	for rule, n := range hits {
+		metrics.AddAuditRedactionHits(rule, n)
+	}
+}
+
+func digitsOf(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+func luhnValid(digits string) bool {
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+func cnIDValid(id string) bool {
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i, w := range weights {
+		sum += int(id[i]-'0') * w
+	}
+	return "10X98765432"[sum%11] == byte(unicode.ToUpper(rune(id[17])))
+}
+
+// maskKeepLastDigits 保留分隔符和末 4 位数字：4111-1111-1111-1111 → ****-****-****-1111
+func maskKeepLastDigits(s string) string {
+	keep := 4
+	out := []byte(s)
+	for i := len(out) - 1; i >= 0; i-- {
+		c := out[i]
+		if (c >= '0' && c <= '9') || c == 'X' || c == 'x' {
+			if keep > 0 {
+				keep--
+				continue
+			}
+			out[i] = '*'
+		}
+	}
+	return string(out)
+}
+
+// maskEmail 保留用户名首字符和域名：john.doe@example.com → j*******@example.com，过短的用户名整体遮盖
+func maskEmail(s string) string {
+	at := strings.LastIndexByte(s, '@')
+	if at <= 0 {
+		return maskFull(s)
+	}
+	if at <= 2 {
+		return strings.Repeat("*", at) + s[at:]
+	}
+	return s[:1] + strings.Repeat("*", at-1) + s[at:]
+}
+
+// maskSecret 保留前缀和末 4 位：sk-abcdef...wxyz → sk-*******wxyz
+func maskSecret(s string) string {
+	prefix := 0
+	if i := strings.IndexAny(s, "-_"); i >= 0 && i <= 4 {
+		prefix = i + 1
+	} else if len(s) > 4 {
+		prefix = 4
+	}
+	if len(s)-prefix <= 4 {
+		return s[:prefix] + strings.Repeat("*", len(s)-prefix)
+	}
+	return s[:prefix] + strings.Repeat("*", len(s)-prefix-4) + s[len(s)-4:]
+}
+
+// maskPartial 自定义规则的保留格式掩码：字母数字替换为 *，保留标点，末 4 个字符可见
+func maskPartial(s string) string {
+	runes := []rune(s)
+	if len(runes) <= 4 {
+		return maskFull(s)
+	}
+	for i := 0; i < len(runes)-4; i++ {
+		if unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) {
+			runes[i] = '*'
+		}
+	}
+	return string(runes)
+}
+
+func maskFull(s string) string {
+	return strings.Repeat("*", len([]rune(s)))
+}
@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func builtinRedactor(names ...string) *bodyRedactor {
+	var rules []redactRuleConfig
+	for _, n := range names {
+		rules = append(rules, redactRuleConfig{Builtin: n})
+	}
+	return newBodyRedactor(rules)
+}
+
+func TestBodyRedactBuiltinRules(t *testing.T) {
+	r := builtinRedactor(BuiltinRedactRules...)
+	cases := []struct {
+		name, in, want string
+	}{
+		{"邮箱保留首字符和域名", "mail john.doe@example.com now", "mail j*******@example.com now"},
+		{"卡号保留分隔符和末 4 位", "card 4111-1111-1111-1111.", "card ****-****-****-1111."},
+		{"Luhn 校验不通过的长数字不处理", "order 1234567812345678", "order 1234567812345678"},
+		{"身份证", "id 11010519491231002X", "id **************002X"},
+		{"SSN", "ssn 123-45-6789", "ssn ***-**-6789"},
+		{"手机号", "call 13812345678", "call *******5678"},
+		{"国际号码", "tel +1 415-555-2671", "tel +* ***-***-2671"},
+		{"API key 保留前缀和末 4 位", "key sk-abcdefghijklmnopqrstuvwxyz", "key sk-**********************wxyz"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hits := map[string]int{}
+			if got := r.Redact(tc.in, hits); got != tc.want {
+				t.Errorf("Redact(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBodyRedactJSONPaths(t *testing.T) {
+	r := newBodyRedactor([]redactRuleConfig{
+		{Builtin: "email", Paths: []string{"messages[*].content"}},
+		{Name: "employee_id", Pattern: `EMP-\d{6}`, Mask: MaskTag},
+	})
+	body := `{"model":"gpt-4o","user":"a@b.com","messages":[{"role":"user","content":"我是 a@b.com，工号 EMP-123456"},` +
+		`{"role":"user","content":[{"type":"text","text":"抄送 c@d.org"}]}]}`
+	hits := map[string]int{}
+	got := r.Redact(body, hits)
+
+	if !json.Valid([]byte(got)) {
+		t.Fatalf("脱敏后应仍是合法 JSON: %s", got)
+	}
+	if !strings.HasPrefix(got, `{"model":"gpt-4o","user":"a@b.com",`) {
+		t.Errorf("路径外的字段不应改动，且保持原有键顺序: %s", got)
+	}
+	if strings.Contains(got, "我是 a@b.com") || strings.Contains(got, "c@d.org") {
+		t.Errorf("messages[*].content 下的邮箱（含多段 parts）应被遮盖: %s", got)
+	}
+	if !strings.Contains(got, "[REDACTED:employee_id]") {
+		t.Errorf("不带路径的自定义规则应作用于整段文本: %s", got)
+	}
+	if hits["email"] != 2 || hits["employee_id"] != 1 {
+		t.Errorf("命中计数不对: %v", hits)
+	}
+
+	// 被截断的 JSON 退化为整段扫描
+	truncated := body[:60]
+	if got := r.Redact(truncated, map[string]int{}); strings.Contains(got, "a@b.com") {
+		t.Errorf("非法 JSON 应整段脱敏: %s", got)
+	}
+}
+
+func TestBodyRedactInvalidRulesSkipped(t *testing.T) {
+	r := newBodyRedactor([]redactRuleConfig{
+		{Builtin: "no_such_rule"},
+		{Name: "bad", Pattern: "("},
+		{Name: "bad_path", Pattern: "x", Paths: []string{"messages[abc]"}},
+		{Builtin: "email", Mask: MaskFull},
+	})
+	if len(r.rules) != 1 {
+		t.Fatalf("非法规则应被跳过，剩余 %d 条", len(r.rules))
+	}
+	if got := r.Redact("a@b.co", map[string]int{}); got != "******" {
+		t.Errorf("full 掩码应只保留长度, got %q", got)
+	}
+}
+
+func TestBuildAndSubmitRedactsAndZeroRetention(t *testing.T) {
+	resetForTest()
+	pkgConfig = loadConfigEnabledForTest()
+	pkgConfig.bodyRedactor = builtinRedactor("email")
+	pkgConfig.zdrGroups = map[string]struct{}{"zdr": {}}
+	recordChan = make(chan *AuditRecord, 10)
+
+	c := newTestCtxAssemble()
+	InitAuditContext(c)
+	BuildAndSubmit(c, FinalizeInput{
+		Start:          time.Now(),
+		OrigBody:       []byte(`{"messages":[{"content":"reach me at x@y.com"}]}`),
+		ClientResponse: `{"reply":"ok x@y.com"}`,
+		StatusCode:     200,
+	})
+	r := <-recordChan
+	if strings.Contains(r.OriginalReqBody, "x@y.com") || strings.Contains(r.ClientResponse, "x@y.com") {
+		t.Errorf("body 中的邮箱应被脱敏: %+v", r)
+	}
+
+	c = newTestCtxAssemble()
+	c.Set("group", "zdr")
+	InitAuditContext(c)
+	BuildAndSubmit(c, FinalizeInput{Start: time.Now(), OrigBody: []byte(`{"a":1}`), ClientResponse: "hi", StatusCode: 200})
+	r = <-recordChan
+	if r.OriginalReqBody != "" || r.ClientResponse != "" || r.DroppedNote != "zero_data_retention" {
+		t.Errorf("零数据保留分组不应采集 body: %+v", r)
+	}
+	if r.UserID != 7 || r.StatusCode != 200 {
+		t.Errorf("零数据保留仍应记录元信息")
+	}
+}
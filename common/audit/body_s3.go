@@ -13,7 +13,7 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 )
 
-// bodyDoc 是存到 S3 的 JSON 结构，只含四个大字段。
+// bodyDoc 是单独存放（S3 或 file 后端）的 JSON 结构，只含四个大字段。
 type bodyDoc struct {
 	OriginalReqBody  string `json:"original_req_body"`
 	ConvertedReqBody string `json:"converted_req_body"`
@@ -30,30 +30,35 @@ func bodyS3Key(cfg *auditConfig, eventTime time.Time, xRequestID string) string
 	return fmt.Sprintf("%s/%s/%s.json", prefix, eventTime.UTC().Format("2006-01-02"), xRequestID)
 }
 
-// uploadBodyAsync 异步上传 body 到 S3，失败只记日志不影响主流程。
-func uploadBodyAsync(cfg *auditConfig, s3c *s3.Client, key string, doc bodyDoc) {
+// uploadBodyAsync 异步写入 body，失败只记日志不影响主流程。
+func uploadBodyAsync(sink AuditSink, key string, doc bodyDoc) {
 	go func() {
-		data, err := json.Marshal(doc)
-		if err != nil {
-			logger.SysError("audit: marshal body for S3: " + err.Error())
-			return
-		}
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
-		_, err = s3c.PutObject(ctx, &s3.PutObjectInput{
-			Bucket:      aws.String(cfg.BodyS3Bucket),
-			Key:         aws.String(key),
-			Body:        bytes.NewReader(data),
-			ContentType: aws.String("application/json"),
-		})
-		if err != nil {
-			logger.SysError("audit: upload body to S3 key=" + key + ": " + err.Error())
+		if err := sink.PutBody(ctx, key, doc); err != nil {
+			logger.SysError("audit: upload body key=" + key + ": " + err.Error())
 		}
 	}()
 }
 
-// fetchBodyFromS3 同步从 S3 拉取 body，供 QueryDetail 使用。
-func (c *awsAuditClient) fetchBodyFromS3(ctx context.Context, key string) (*bodyDoc, error) {
+func (c *awsAuditClient) BodyStoreEnabled() bool { return c.cfg.BodyS3Bucket != "" }
+
+func (c *awsAuditClient) PutBody(ctx context.Context, key string, doc bodyDoc) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("marshal body: %w", err)
+	}
+	_, err = c.s3c.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(c.cfg.BodyS3Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+// FetchBody 同步从 S3 拉取 body，供 QueryDetail 使用。
+func (c *awsAuditClient) FetchBody(ctx context.Context, key string) (*bodyDoc, error) {
 	out, err := c.s3c.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(c.cfg.BodyS3Bucket),
 		Key:    aws.String(key),
@@ -34,51 +34,56 @@ func RunCompaction(ctx context.Context) {
 }
 
 func RunCompactionForDate(ctx context.Context, day time.Time) {
-	if awsClient == nil {
+	if backend == nil {
 		return
 	}
 
 	compactCtx, cancel := context.WithTimeout(ctx, 30*time.Minute)
 	defer cancel()
 
-	// OPTIMIZE/DELETE/ALTER 语句不支持双引号 identifier，必须用裸名
-	tableRef := fmt.Sprintf(`%s.%s`, pkgConfig.AthenaDatabase, pkgConfig.AthenaTable)
-	start := day.Format("2006-01-02")
-	end := day.AddDate(0, 0, 1).Format("2006-01-02")
-
 	if pkgConfig.RetentionDays > 0 {
-		runRetention(compactCtx, tableRef)
+		cutoff := time.Now().UTC().AddDate(0, 0, -pkgConfig.RetentionDays)
+		if err := backend.Retain(compactCtx, cutoff); err != nil {
+			logger.SysError("audit: retention failed: " + err.Error())
+		} else {
+			logger.SysLog(fmt.Sprintf("audit: retention cleanup done (cutoff=%s)", cutoff.Format("2006-01-02 15:04:05")))
+		}
+	}
+
+	if err := backend.Compact(compactCtx, day); err != nil {
+		logger.SysError("audit: compaction failed: " + err.Error())
+		return
 	}
+	logger.SysLog("audit: compaction completed for partition " + day.Format("2006-01-02"))
+}
 
+// athenaTableRef OPTIMIZE/DELETE/ALTER 语句不支持双引号 identifier，必须用裸名
+func (c *awsAuditClient) athenaTableRef() string {
+	return fmt.Sprintf(`%s.%s`, c.cfg.AthenaDatabase, c.cfg.AthenaTable)
+}
+
+func (c *awsAuditClient) Compact(ctx context.Context, day time.Time) error {
+	start := day.Format("2006-01-02")
+	end := day.AddDate(0, 0, 1).Format("2006-01-02")
 	sql := fmt.Sprintf(
 		`OPTIMIZE %s REWRITE DATA USING BIN_PACK`+
 			` WHERE event_time >= TIMESTAMP '%s 00:00:00'`+
 			` AND event_time < TIMESTAMP '%s 00:00:00'`,
-		tableRef, start, end,
+		c.athenaTableRef(), start, end,
 	)
-	_, err := awsClient.executeQuery(compactCtx, sql)
-	if err != nil {
-		logger.SysError("audit: compaction failed: " + err.Error())
-		return
-	}
-	logger.SysLog("audit: compaction completed for partition " + start)
+	_, err := c.executeQuery(ctx, sql)
+	return err
 }
 
-func runRetention(ctx context.Context, tableRef string) {
-	cutoff := time.Now().UTC().AddDate(0, 0, -pkgConfig.RetentionDays).Format("2006-01-02 15:04:05")
-
-	deleteSQL := fmt.Sprintf("DELETE FROM %s WHERE event_time < TIMESTAMP '%s'", tableRef, cutoff)
-	_, err := awsClient.executeQuery(ctx, deleteSQL)
-	if err != nil {
-		logger.SysError("audit: retention delete failed: " + err.Error())
-		return
+func (c *awsAuditClient) Retain(ctx context.Context, cutoff time.Time) error {
+	deleteSQL := fmt.Sprintf("DELETE FROM %s WHERE event_time < TIMESTAMP '%s'", c.athenaTableRef(), cutoff.UTC().Format("2006-01-02 15:04:05"))
+	if _, err := c.executeQuery(ctx, deleteSQL); err != nil {
+		return fmt.Errorf("delete: %w", err)
 	}
 
-	expireSQL := fmt.Sprintf("ALTER TABLE %s EXECUTE expire_snapshots(retention_threshold => '7d')", tableRef)
-	_, err = awsClient.executeQuery(ctx, expireSQL)
-	if err != nil {
-		logger.SysError("audit: expire_snapshots failed: " + err.Error())
-		return
+	expireSQL := fmt.Sprintf("ALTER TABLE %s EXECUTE expire_snapshots(retention_threshold => '7d')", c.athenaTableRef())
+	if _, err := c.executeQuery(ctx, expireSQL); err != nil {
+		return fmt.Errorf("expire_snapshots: %w", err)
 	}
-	logger.SysLog(fmt.Sprintf("audit: retention cleanup done (cutoff=%s)", cutoff))
+	return nil
 }
@@ -13,6 +13,11 @@ var reIdentifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,127}$`)
 
 type auditConfig struct {
 	Enabled          bool
+	Backend          string
+	StorageDir       string
+	StorageBucket    string
+	StorageEndpoint  string
+	StoragePrefix    string
 	AWSRegion        string
 	AWSAccessKey     string
 	AWSSecretKey     string
@@ -35,12 +40,20 @@ type auditConfig struct {
 	BodyS3Prefix       string
 	BodyS3ThresholdKB  int
 	redactSet          map[string]struct{}
+	bodyRedactor       *bodyRedactor
+	zdrTokens          map[int]struct{}    // 零数据保留：这些令牌的请求只记元信息，不采集 body
+	zdrGroups          map[string]struct{} // 零数据保留：这些分组的请求只记元信息，不采集 body
 }
 
 func loadConfig() *auditConfig {
 	// 先从环境变量读取默认值（非 UI 配置项沿用此值）
 	c := &auditConfig{
 		Enabled:          config.AuditEnabled,
+		Backend:          config.AuditBackend,
+		StorageDir:       config.AuditStorageDir,
+		StorageBucket:    config.AuditStorageBucket,
+		StorageEndpoint:  config.AuditStorageEndpoint,
+		StoragePrefix:    config.AuditStoragePrefix,
 		AWSRegion:        config.AuditAWSRegion,
 		AWSAccessKey:     config.AuditAWSAccessKey,
 		AWSSecretKey:     config.AuditAWSSecretKey,
@@ -62,6 +75,15 @@ func loadConfig() *auditConfig {
 		BodyS3ThresholdKB: 32, // 默认 32KB 以上走 S3
 	}
 
+	var redactRules []redactRuleConfig
+	for _, name := range strings.Split(config.AuditRedactBodyRules, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			redactRules = append(redactRules, redactRuleConfig{Builtin: name})
+		}
+	}
+	c.zdrTokens = make(map[int]struct{})
+	c.zdrGroups = make(map[string]struct{})
+
 	// 从 options 表的 auditConfig 字段覆盖（优先级高于环境变量）
 	config.OptionMapRWMutex.RLock()
 	raw, ok := config.OptionMap["auditConfig"]
@@ -70,6 +92,11 @@ func loadConfig() *auditConfig {
 	if ok && raw != "" {
 		var js struct {
 			Enabled              bool   `json:"enabled"`
+			Backend              string `json:"backend"`
+			StorageDir           string `json:"storageDir"`
+			StorageBucket        string `json:"storageBucket"`
+			StorageEndpoint      string `json:"storageEndpoint"`
+			StoragePrefix        string `json:"storagePrefix"`
 			AWSRegion            string `json:"awsRegion"`
 			AWSAccessKeyId       string `json:"awsAccessKeyId"`
 			AWSSecretAccessKey   string `json:"awsSecretAccessKey"`
@@ -91,9 +118,28 @@ func loadConfig() *auditConfig {
 			BodyS3Bucket         string `json:"bodyS3Bucket"`
 			BodyS3Prefix         string `json:"bodyS3Prefix"`
 			BodyS3ThresholdKB    int    `json:"bodyS3ThresholdKB"`
+			// 非 nil 时整体替换 AuditRedactBodyRules，可为规则指定 JSON 路径和掩码方式
+			BodyRedactionRules    []redactRuleConfig `json:"bodyRedactionRules"`
+			ZeroRetentionTokenIds []int              `json:"zeroRetentionTokenIds"`
+			ZeroRetentionGroups   []string           `json:"zeroRetentionGroups"`
 		}
 		if err := json.Unmarshal([]byte(raw), &js); err == nil {
 			c.Enabled = js.Enabled
+			if js.Backend != "" {
+				c.Backend = js.Backend
+			}
+			if js.StorageDir != "" {
+				c.StorageDir = js.StorageDir
+			}
+			if js.StorageBucket != "" {
+				c.StorageBucket = js.StorageBucket
+			}
+			if js.StorageEndpoint != "" {
+				c.StorageEndpoint = js.StorageEndpoint
+			}
+			if js.StoragePrefix != "" {
+				c.StoragePrefix = js.StoragePrefix
+			}
 			if js.AWSRegion != "" {
 				c.AWSRegion = js.AWSRegion
 			}
@@ -157,9 +203,19 @@ func loadConfig() *auditConfig {
 			if js.BodyS3ThresholdKB > 0 {
 				c.BodyS3ThresholdKB = js.BodyS3ThresholdKB
 			}
+			if js.BodyRedactionRules != nil {
+				redactRules = js.BodyRedactionRules
+			}
+			for _, id := range js.ZeroRetentionTokenIds {
+				c.zdrTokens[id] = struct{}{}
+			}
+			for _, g := range js.ZeroRetentionGroups {
+				c.zdrGroups[g] = struct{}{}
+			}
 		}
 	}
 
+	c.bodyRedactor = newBodyRedactor(redactRules)
 	c.redactSet = make(map[string]struct{})
 	for _, h := range strings.Split(config.AuditRedactHeaders, ",") {
 		h = strings.ToLower(strings.TrimSpace(h))
@@ -167,7 +223,8 @@ func loadConfig() *auditConfig {
 			c.redactSet[h] = struct{}{}
 		}
 	}
-	if c.Enabled {
+	// Athena 库表名会拼进 SQL，仅 aws 后端需要校验
+	if c.Enabled && (c.Backend == BackendAWS || c.Backend == "") {
 		if !reIdentifier.MatchString(c.AthenaDatabase) {
 			c.Enabled = false
 		}
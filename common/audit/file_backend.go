@@ -0,0 +1,360 @@
+package audit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/objstore"
+)
+
+// fileBackend 把审计记录按天分区写成 gzip NDJSON：
+//
+//	<prefix>/dt=YYYY-MM-DD/part-<minMs>-<maxMs>-<nano>-<seq>.ndjson.gz
+//
+// 文件名里的最早/最晚事件时间充当索引，查询时先按分区和时间范围裁剪文件再逐行扫描。
+// 大 body 与 aws 后端一样按 bodyS3Key 存放在同一个存储的 <prefix>/ 下。
+type fileBackend struct {
+	cfg    *auditConfig
+	store  objstore.Store
+	prefix string
+	seq    int64
+}
+
+func newFileBackend(cfg *auditConfig) (*fileBackend, error) {
+	prefix := strings.Trim(cfg.StoragePrefix, "/")
+	if prefix == "" {
+		prefix = "audit"
+	}
+	b := &fileBackend{cfg: cfg, prefix: prefix}
+	switch {
+	case cfg.StorageBucket != "":
+		b.store = objstore.NewS3(objstore.S3Config{
+			Region:    cfg.AWSRegion,
+			AccessKey: cfg.AWSAccessKey,
+			SecretKey: cfg.AWSSecretKey,
+			Endpoint:  cfg.StorageEndpoint,
+			Bucket:    cfg.StorageBucket,
+		})
+	case cfg.StorageDir != "":
+		b.store = objstore.NewLocal(cfg.StorageDir)
+	default:
+		return nil, errors.New("file 后端需要配置 AUDIT_STORAGE_DIR 或 AUDIT_STORAGE_BUCKET")
+	}
+	return b, nil
+}
+
+func (b *fileBackend) Name() string {
+	if b.cfg.StorageBucket != "" {
+		return "file → s3://" + b.cfg.StorageBucket + "/" + b.prefix
+	}
+	return "file → " + b.cfg.StorageDir
+}
+
+// Ensure 写入并删除一个探测对象，确认存储可写
+func (b *fileBackend) Ensure(ctx context.Context) error {
+	key := b.prefix + "/_probe"
+	if err := b.store.Put(ctx, key, []byte("ok")); err != nil {
+		return err
+	}
+	return b.store.Delete(ctx, key)
+}
+
+func (b *fileBackend) Close() error { return nil }
+
+func (b *fileBackend) partitionPrefix(day string) string {
+	return fmt.Sprintf("%s/dt=%s/", b.prefix, day)
+}
+
+func (b *fileBackend) partKey(day string, minMs, maxMs int64) string {
+	return fmt.Sprintf("%spart-%d-%d-%d-%d.ndjson.gz", b.partitionPrefix(day), minMs, maxMs,
+		time.Now().UnixNano(), atomic.AddInt64(&b.seq, 1))
+}
+
+// parsePartRange 从分区文件名解析事件时间范围（毫秒）
+func parsePartRange(key string) (minMs, maxMs int64, ok bool) {
+	name := path.Base(key)
+	if !strings.HasPrefix(name, "part-") || !strings.HasSuffix(name, ".ndjson.gz") {
+		return 0, 0, false
+	}
+	fields := strings.Split(strings.TrimSuffix(strings.TrimPrefix(name, "part-"), ".ndjson.gz"), "-")
+	if len(fields) < 2 {
+		return 0, 0, false
+	}
+	minMs, err1 := strconv.ParseInt(fields[0], 10, 64)
+	maxMs, err2 := strconv.ParseInt(fields[1], 10, 64)
+	return minMs, maxMs, err1 == nil && err2 == nil
+}
+
+// PutBatch 按事件时间原地排序后逐天写一个分区文件；失败时 batch[sent:] 即未写入的部分
+func (b *fileBackend) PutBatch(ctx context.Context, batch []*AuditRecord) (sent int, err error) {
+	sort.SliceStable(batch, func(i, j int) bool { return batch[i].EventTime.Before(batch[j].EventTime) })
+	for start := 0; start < len(batch); {
+		day := batch[start].EventTime.UTC().Format("2006-01-02")
+		end := start + 1
+		for end < len(batch) && batch[end].EventTime.UTC().Format("2006-01-02") == day {
+			end++
+		}
+		lines := make([]string, 0, end-start)
+		for _, r := range batch[start:end] {
+			lines = append(lines, toNDJSONLine(r))
+		}
+		key := b.partKey(day, batch[start].EventTime.UnixMilli(), batch[end-1].EventTime.UnixMilli())
+		if err := b.writePart(ctx, key, lines); err != nil {
+			return sent, err
+		}
+		sent = end
+		start = end
+	}
+	return sent, nil
+}
+
+func (b *fileBackend) writePart(ctx context.Context, key string, lines []string) error {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	for _, line := range lines {
+		if _, err := gw.Write([]byte(line)); err != nil {
+			return err
+		}
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	return b.store.Put(ctx, key, buf.Bytes())
+}
+
+// listParts 列出某天分区中与 [startMs, endMs) 有交集的文件，endMs<=0 表示不限
+func (b *fileBackend) listParts(ctx context.Context, day string, startMs, endMs int64) ([]string, error) {
+	keys, err := b.store.List(ctx, b.partitionPrefix(day))
+	if err != nil {
+		return nil, err
+	}
+	var parts []string
+	for _, key := range keys {
+		minMs, maxMs, ok := parsePartRange(key)
+		if !ok {
+			continue
+		}
+		if endMs > 0 && (maxMs < startMs || minMs >= endMs) {
+			continue
+		}
+		parts = append(parts, key)
+	}
+	return parts, nil
+}
+
+// scan 依次读取时间范围内的分区文件，fn 返回 false 时提前结束
+func (b *fileBackend) scan(ctx context.Context, startTS, endTS int64, fn func(row firehoseRow, eventTime time.Time) bool) error {
+	startMs, endMs := startTS*1000, endTS*1000
+	first := time.Unix(startTS, 0).UTC()
+	last := time.Unix(endTS-1, 0).UTC()
+	for day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, time.UTC); !day.After(last); day = day.AddDate(0, 0, 1) {
+		parts, err := b.listParts(ctx, day.Format("2006-01-02"), startMs, endMs)
+		if err != nil {
+			return err
+		}
+		for _, key := range parts {
+			data, err := b.store.Get(ctx, key)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue // 被并发的合并任务删除
+				}
+				return err
+			}
+			rows, err := decodeRows(data)
+			if err != nil {
+				return fmt.Errorf("decode %s: %w", key, err)
+			}
+			for _, row := range rows {
+				t, _ := time.Parse(timeFormatISO, row.EventTime)
+				if ms := t.UnixMilli(); ms < startMs || ms >= endMs {
+					continue
+				}
+				if !fn(row, t) {
+					return nil
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func matchRow(row firehoseRow, params QueryParams) bool {
+	return (params.XRequestID == "" || row.XRequestID == params.XRequestID) &&
+		(params.UserID <= 0 || row.UserID == params.UserID) &&
+		(params.ChannelID <= 0 || row.ChannelID == params.ChannelID) &&
+		(params.ActualModel == "" || row.ActualModel == params.ActualModel) &&
+		(params.StatusCode <= 0 || row.StatusCode == params.StatusCode)
+}
+
+func rowToSummary(row firehoseRow, eventTime time.Time) AuditSummary {
+	return AuditSummary{
+		EventTime:   eventTime,
+		XRequestID:  row.XRequestID,
+		UserID:      int64(row.UserID),
+		Username:    row.Username,
+		ChannelID:   int64(row.ChannelID),
+		TokenName:   row.TokenName,
+		OriginModel: row.OriginModel,
+		ActualModel: row.ActualModel,
+		IsStream:    row.IsStream,
+		StatusCode:  int64(row.StatusCode),
+		DurationMS:  row.DurationMS,
+		DroppedNote: row.DroppedNote,
+	}
+}
+
+func (b *fileBackend) QueryLogs(ctx context.Context, params QueryParams) ([]AuditSummary, int64, error) {
+	summaries := []AuditSummary{}
+	err := b.scan(ctx, params.StartTimestamp, params.EndTimestamp, func(row firehoseRow, t time.Time) bool {
+		if matchRow(row, params) {
+			summaries = append(summaries, rowToSummary(row, t))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("query: %w", err)
+	}
+	// 与 Athena 实现一致：按事件时间倒序分页
+	sort.SliceStable(summaries, func(i, j int) bool { return summaries[i].EventTime.After(summaries[j].EventTime) })
+	total := int64(len(summaries))
+	offset := (params.Page - 1) * params.PageSize
+	if offset >= len(summaries) {
+		return []AuditSummary{}, total, nil
+	}
+	end := offset + params.PageSize
+	if end > len(summaries) {
+		end = len(summaries)
+	}
+	return summaries[offset:end], total, nil
+}
+
+func (b *fileBackend) QueryDetail(ctx context.Context, xRequestID string, startTS, endTS int64) (*AuditDetail, error) {
+	var detail *AuditDetail
+	err := b.scan(ctx, startTS, endTS, func(row firehoseRow, t time.Time) bool {
+		if row.XRequestID != xRequestID {
+			return true
+		}
+		detail = &AuditDetail{
+			AuditSummary:            rowToSummary(row, t),
+			OriginalReqHeaders:      row.OriginalReqHeaders,
+			OriginalReqBody:         row.OriginalReqBody,
+			ConvertedReqHeaders:     row.ConvertedReqHeaders,
+			ConvertedReqBody:        row.ConvertedReqBody,
+			ConvertedSameAsOriginal: row.ConvertedSameAsOriginal,
+			UpstreamResponse:        row.UpstreamResponse,
+			ClientResponse:          row.ClientResponse,
+			TruncatedFields:         row.TruncatedFields,
+		}
+		return false
+	})
+	if err != nil {
+		return nil, fmt.Errorf("detail query: %w", err)
+	}
+	return detail, nil
+}
+
+func (b *fileBackend) BodyStoreEnabled() bool { return true }
+
+func (b *fileBackend) PutBody(ctx context.Context, key string, doc bodyDoc) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("marshal body: %w", err)
+	}
+	return b.store.Put(ctx, b.prefix+"/"+key, data)
+}
+
+func (b *fileBackend) FetchBody(ctx context.Context, key string) (*bodyDoc, error) {
+	data, err := b.store.Get(ctx, b.prefix+"/"+key)
+	if err != nil {
+		return nil, fmt.Errorf("read body key=%s: %w", key, err)
+	}
+	var doc bodyDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("unmarshal body key=%s: %w", key, err)
+	}
+	return &doc, nil
+}
+
+// Compact 把某天分区的小文件合并成一个。先写新文件再删旧文件，期间新写入的文件不受影响
+func (b *fileBackend) Compact(ctx context.Context, day time.Time) error {
+	dayStr := day.UTC().Format("2006-01-02")
+	parts, err := b.listParts(ctx, dayStr, 0, 0)
+	if err != nil || len(parts) <= 1 {
+		return err
+	}
+	type line struct {
+		ms   int64
+		text string
+	}
+	var lines []line
+	for _, key := range parts {
+		data, err := b.store.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		rows, err := decodeRows(data)
+		if err != nil {
+			return fmt.Errorf("decode %s: %w", key, err)
+		}
+		for _, row := range rows {
+			t, _ := time.Parse(timeFormatISO, row.EventTime)
+			text, _ := json.Marshal(row)
+			lines = append(lines, line{ms: t.UnixMilli(), text: string(text) + "\n"})
+		}
+	}
+	if len(lines) > 0 {
+		sort.SliceStable(lines, func(i, j int) bool { return lines[i].ms < lines[j].ms })
+		texts := make([]string, len(lines))
+		for i, l := range lines {
+			texts[i] = l.text
+		}
+		if err := b.writePart(ctx, b.partKey(dayStr, lines[0].ms, lines[len(lines)-1].ms), texts); err != nil {
+			return err
+		}
+	}
+	for _, key := range parts {
+		if err := b.store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Retain 按天删除整个早于 cutoff 的分区及对应日期的 body
+func (b *fileBackend) Retain(ctx context.Context, cutoff time.Time) error {
+	cutoffDay := cutoff.UTC().Format("2006-01-02")
+	bodyPrefix := b.cfg.BodyS3Prefix
+	if bodyPrefix == "" {
+		bodyPrefix = "audit-bodies"
+	}
+	for _, base := range []string{b.prefix + "/dt=", b.prefix + "/" + bodyPrefix + "/"} {
+		keys, err := b.store.List(ctx, base)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			day := strings.TrimPrefix(key, base)
+			if i := strings.Index(day, "/"); i >= 0 {
+				day = day[:i]
+			}
+			if _, err := time.Parse("2006-01-02", day); err != nil || day >= cutoffDay {
+				continue
+			}
+			if err := b.store.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
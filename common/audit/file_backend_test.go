@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestFileBackend(t *testing.T) *fileBackend {
+	resetForTest()
+	cfg := &auditConfig{Enabled: true, Backend: BackendFile, StorageDir: t.TempDir(), StoragePrefix: "audit"}
+	b, err := newFileBackend(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Ensure(context.Background()); err != nil {
+		t.Fatalf("Ensure 失败: %v", err)
+	}
+	pkgConfig, backend = cfg, b
+	t.Cleanup(resetForTest)
+	return b
+}
+
+func TestFileBackendPutAndQuery(t *testing.T) {
+	b := newTestFileBackend(t)
+	ctx := context.Background()
+	day1 := time.Date(2026, 3, 1, 23, 59, 0, 0, time.UTC)
+	day2 := day1.Add(2 * time.Minute)
+	batch := []*AuditRecord{
+		{EventTime: day2, XRequestID: "c", UserID: 1, ActualModel: "gpt-4o", StatusCode: 200},
+		{EventTime: day1, XRequestID: "a", UserID: 1, ActualModel: "gpt-4o", StatusCode: 200, OriginalReqBody: "hello"},
+		{EventTime: day1.Add(time.Second), XRequestID: "b", UserID: 2, ActualModel: "claude", StatusCode: 500},
+	}
+	if sent, err := b.PutBatch(ctx, batch); err != nil || sent != 3 {
+		t.Fatalf("PutBatch 失败: sent=%d err=%v", sent, err)
+	}
+	if parts, _ := b.listParts(ctx, "2026-03-01", 0, 0); len(parts) != 1 {
+		t.Errorf("跨天的批次应按天拆分区, 3-01 分区文件数 %d", len(parts))
+	}
+
+	params := QueryParams{StartTimestamp: day1.Unix() - 60, EndTimestamp: day2.Unix() + 60, Page: 1, PageSize: 2}
+	logs, total, err := QueryLogs(ctx, params)
+	if err != nil || total != 3 || len(logs) != 2 || logs[0].XRequestID != "c" || logs[1].XRequestID != "b" {
+		t.Fatalf("应按时间倒序分页: total=%d logs=%+v err=%v", total, logs, err)
+	}
+	params.Page = 2
+	if logs, _, _ = QueryLogs(ctx, params); len(logs) != 1 || logs[0].XRequestID != "a" {
+		t.Errorf("第二页应只有最早一条: %+v", logs)
+	}
+	params.Page, params.ActualModel = 1, "gpt-4o"
+	if _, total, _ = QueryLogs(ctx, params); total != 2 {
+		t.Errorf("按模型过滤应剩 2 条, got %d", total)
+	}
+	params.ActualModel = "bad model'"
+	if _, _, err = QueryLogs(ctx, params); err == nil {
+		t.Errorf("非法参数应报错")
+	}
+	if logs, total, _ = QueryLogs(ctx, QueryParams{StartTimestamp: day2.Unix() + 60, EndTimestamp: day2.Unix() + 120, Page: 1, PageSize: 10}); total != 0 || len(logs) != 0 {
+		t.Errorf("时间范围外不应有结果: %+v", logs)
+	}
+
+	detail, err := QueryDetail(ctx, "a", day1.Unix()-60, day1.Unix()+60)
+	if err != nil || detail == nil || detail.OriginalReqBody != "hello" {
+		t.Fatalf("详情查询失败: %+v %v", detail, err)
+	}
+	if detail, _ = QueryDetail(ctx, "missing", day1.Unix()-60, day1.Unix()+60); detail != nil {
+		t.Errorf("不存在的请求应返回 nil")
+	}
+}
+
+func TestFileBackendOffloadedBody(t *testing.T) {
+	b := newTestFileBackend(t)
+	ctx := context.Background()
+	eventTime := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	big := strings.Repeat("x", 1024)
+	if err := b.PutBody(ctx, bodyS3Key(pkgConfig, eventTime, "big"), bodyDoc{OriginalReqBody: big, ClientResponse: "ok"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.PutBatch(ctx, []*AuditRecord{{EventTime: eventTime, XRequestID: "big"}}); err != nil {
+		t.Fatal(err)
+	}
+	detail, err := QueryDetail(ctx, "big", eventTime.Unix()-1, eventTime.Unix()+1)
+	if err != nil || detail == nil || detail.OriginalReqBody != big || detail.ClientResponse != "ok" {
+		t.Errorf("body 为空时应从存储补齐: %+v %v", detail, err)
+	}
+}
+
+func TestFileBackendCompactAndRetain(t *testing.T) {
+	b := newTestFileBackend(t)
+	ctx := context.Background()
+	old := time.Date(2026, 2, 1, 8, 0, 0, 0, time.UTC)
+	day := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if _, err := b.PutBatch(ctx, []*AuditRecord{{EventTime: day.Add(time.Duration(i) * time.Minute), XRequestID: string(rune('a' + i))}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.PutBatch(ctx, []*AuditRecord{{EventTime: old, XRequestID: "old"}})
+	b.PutBody(ctx, bodyS3Key(pkgConfig, old, "old"), bodyDoc{OriginalReqBody: "old"})
+
+	if err := b.Compact(ctx, day); err != nil {
+		t.Fatalf("合并失败: %v", err)
+	}
+	parts, _ := b.listParts(ctx, "2026-03-01", 0, 0)
+	if len(parts) != 1 {
+		t.Fatalf("合并后应只剩 1 个文件, got %v", parts)
+	}
+	if minMs, maxMs, _ := parsePartRange(parts[0]); minMs != day.UnixMilli() || maxMs != day.Add(2*time.Minute).UnixMilli() {
+		t.Errorf("合并后文件名应记录时间范围: %s", parts[0])
+	}
+	if _, total, _ := QueryLogs(ctx, QueryParams{StartTimestamp: day.Unix(), EndTimestamp: day.Unix() + 3600, Page: 1, PageSize: 10}); total != 3 {
+		t.Errorf("合并不应丢数据, got %d", total)
+	}
+
+	if err := b.Retain(ctx, day); err != nil {
+		t.Fatalf("保留策略执行失败: %v", err)
+	}
+	if parts, _ := b.listParts(ctx, "2026-02-01", 0, 0); len(parts) != 0 {
+		t.Errorf("过期分区应被删除: %v", parts)
+	}
+	if _, err := b.FetchBody(ctx, bodyS3Key(pkgConfig, old, "old")); err == nil {
+		t.Errorf("过期 body 应被删除")
+	}
+	if parts, _ := b.listParts(ctx, "2026-03-01", 0, 0); len(parts) != 1 {
+		t.Errorf("未过期分区不应被删除")
+	}
+}
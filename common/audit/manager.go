@@ -14,7 +14,7 @@ var (
 	ingestDone chan struct{}
 	dropped    int64
 	spill      *spillStore
-	awsClient  *awsAuditClient
+	backend    auditBackend
 	cancelFunc context.CancelFunc
 
 	startMu    sync.Mutex
@@ -75,30 +75,24 @@ func doStart(ctx context.Context) {
 		pkgConfig = cfg
 		return
 	}
-	if cfg.AWSRegion == "" || cfg.AWSAccessKey == "" || cfg.AWSSecretKey == "" {
-		logger.SysError("audit: 缺少 AWS 凭证配置，自动降级为关闭")
+	b, err := newBackend(cfg)
+	if err != nil {
+		logger.SysError("audit: " + err.Error() + "，自动降级为关闭")
 		cfg.Enabled = false
 		pkgConfig = cfg
 		return
 	}
-	if cfg.FirehoseStream == "" {
-		logger.SysError("audit: 缺少 AUDIT_FIREHOSE_STREAM 配置，自动降级为关闭")
-		cfg.Enabled = false
-		pkgConfig = cfg
-		return
-	}
-
-	client := newAWSClient(cfg)
 
-	if err := client.ensureGlueResources(ctx); err != nil {
-		logger.SysError("audit: Glue 建表失败，降级为关闭: " + err.Error())
+	if err := b.Ensure(ctx); err != nil {
+		logger.SysError("audit: " + b.Name() + " 初始化失败，降级为关闭: " + err.Error())
+		_ = b.Close()
 		cfg.Enabled = false
 		pkgConfig = cfg
 		return
 	}
 
 	pkgConfig = cfg
-	awsClient = client
+	backend = b
 	spill = &spillStore{dir: cfg.DiskBufferDir, maxBytes: int64(cfg.DiskBufferMaxGB) * 1024 * 1024 * 1024}
 	recordChan = make(chan *AuditRecord, cfg.ChannelSize)
 	ingestDone = make(chan struct{})
@@ -112,7 +106,7 @@ func doStart(ctx context.Context) {
 	}()
 	go uploaderLoop(bgCtx)
 	go compactionLoop(bgCtx)
-	logger.SysLog("audit: 审计模块已启动 (Firehose → Iceberg)")
+	logger.SysLog("audit: 审计模块已启动 (" + b.Name() + ")")
 }
 
 func doStop() {
@@ -125,14 +119,14 @@ func doStop() {
 	if cancelFunc != nil {
 		cancelFunc()
 	}
-	if awsClient != nil {
-		_ = awsClient.Close()
+	if backend != nil {
+		_ = backend.Close()
 	}
 	pkgConfig = nil
 	recordChan = nil
 	ingestDone = nil
 	spill = nil
-	awsClient = nil
+	backend = nil
 	cancelFunc = nil
 	atomic.StoreInt64(&dropped, 0)
 }
@@ -149,7 +143,7 @@ func resetForTest() {
 	ingestDone = nil
 	dropped = 0
 	spill = nil
-	awsClient = nil
+	backend = nil
 	cancelFunc = nil
 	hasStarted = false
 	appCtx = nil
@@ -61,11 +61,58 @@ var (
 )
 
 func QueryLogs(ctx context.Context, params QueryParams) ([]AuditSummary, int64, error) {
-	if awsClient == nil {
+	if backend == nil {
 		return nil, 0, ErrAuditNotEnabled
 	}
+	if err := validateQueryParams(params); err != nil {
+		return nil, 0, err
+	}
+	return backend.QueryLogs(ctx, params)
+}
+
+func QueryDetail(ctx context.Context, xRequestID string, startTS, endTS int64) (*AuditDetail, error) {
+	if backend == nil {
+		return nil, ErrAuditNotEnabled
+	}
+
+	if !reXRequestID.MatchString(xRequestID) {
+		return nil, fmt.Errorf("%w: invalid x_request_id format", ErrInvalidParam)
+	}
+
+	detail, err := backend.QueryDetail(ctx, xRequestID, startTS, endTS)
+	if err != nil || detail == nil {
+		return detail, err
+	}
+
+	// 若四个 body 字段均为空且启用了 body 单独存放，按规则推导 key 尝试拉取
+	if detail.OriginalReqBody == "" && detail.UpstreamResponse == "" &&
+		detail.ClientResponse == "" && backend.BodyStoreEnabled() {
+		key := bodyS3Key(pkgConfig, detail.EventTime, xRequestID)
+		doc, err := backend.FetchBody(ctx, key)
+		if err == nil {
+			detail.OriginalReqBody = doc.OriginalReqBody
+			detail.ConvertedReqBody = doc.ConvertedReqBody
+			detail.UpstreamResponse = doc.UpstreamResponse
+			detail.ClientResponse = doc.ClientResponse
+		}
+	}
+
+	return detail, nil
+}
+
+// validateQueryParams 校验会拼进查询条件的字符串参数，各后端共用
+func validateQueryParams(params QueryParams) error {
+	if params.XRequestID != "" && !reXRequestID.MatchString(params.XRequestID) {
+		return fmt.Errorf("%w: invalid x_request_id format", ErrInvalidParam)
+	}
+	if params.ActualModel != "" && !reModel.MatchString(params.ActualModel) {
+		return fmt.Errorf("%w: invalid actual_model format", ErrInvalidParam)
+	}
+	return nil
+}
 
-	tableRef := fmt.Sprintf(`"%s"."%s"`, pkgConfig.AthenaDatabase, pkgConfig.AthenaTable)
+func (c *awsAuditClient) QueryLogs(ctx context.Context, params QueryParams) ([]AuditSummary, int64, error) {
+	tableRef := fmt.Sprintf(`"%s"."%s"`, c.cfg.AthenaDatabase, c.cfg.AthenaTable)
 
 	where, err := buildAthenaWhere(params)
 	if err != nil {
@@ -91,7 +138,7 @@ func QueryLogs(ctx context.Context, params QueryParams) ([]AuditSummary, int64,
 		 WHERE _rn >= %d AND _rn <= %d`,
 		tableRef, where, rowStart, rowEnd)
 
-	result, err := awsClient.executeQuery(ctx, sql)
+	result, err := c.executeQuery(ctx, sql)
 	if err != nil {
 		return nil, 0, fmt.Errorf("query: %w", err)
 	}
@@ -100,16 +147,8 @@ func QueryLogs(ctx context.Context, params QueryParams) ([]AuditSummary, int64,
 	return summaries, total, nil
 }
 
-func QueryDetail(ctx context.Context, xRequestID string, startTS, endTS int64) (*AuditDetail, error) {
-	if awsClient == nil {
-		return nil, ErrAuditNotEnabled
-	}
-
-	if !reXRequestID.MatchString(xRequestID) {
-		return nil, fmt.Errorf("%w: invalid x_request_id format", ErrInvalidParam)
-	}
-
-	tableRef := fmt.Sprintf(`"%s"."%s"`, pkgConfig.AthenaDatabase, pkgConfig.AthenaTable)
+func (c *awsAuditClient) QueryDetail(ctx context.Context, xRequestID string, startTS, endTS int64) (*AuditDetail, error) {
+	tableRef := fmt.Sprintf(`"%s"."%s"`, c.cfg.AthenaDatabase, c.cfg.AthenaTable)
 	startTime := time.Unix(startTS, 0).UTC().Format("2006-01-02 15:04:05")
 	endTime := time.Unix(endTS, 0).UTC().Format("2006-01-02 15:04:05")
 
@@ -120,7 +159,7 @@ func QueryDetail(ctx context.Context, xRequestID string, startTS, endTS int64) (
 		 AND event_time < TIMESTAMP '%s'
 		 LIMIT 1`, tableRef, xRequestID, startTime, endTime)
 
-	result, err := awsClient.executeQuery(ctx, sql)
+	result, err := c.executeQuery(ctx, sql)
 	if err != nil {
 		return nil, fmt.Errorf("detail query: %w", err)
 	}
@@ -129,22 +168,7 @@ func QueryDetail(ctx context.Context, xRequestID string, startTS, endTS int64) (
 		return nil, nil
 	}
 
-	detail := parseAuditDetailRow(result.ResultSet.Rows[1], result.ResultSet.ResultSetMetadata.ColumnInfo)
-
-	// 若四个 body 字段均为空且配置了 S3，按规则推导 key 尝试拉取
-	if detail.OriginalReqBody == "" && detail.UpstreamResponse == "" &&
-		detail.ClientResponse == "" && pkgConfig.BodyS3Bucket != "" {
-		s3Key := bodyS3Key(pkgConfig, detail.EventTime, xRequestID)
-		doc, err := awsClient.fetchBodyFromS3(ctx, s3Key)
-		if err == nil {
-			detail.OriginalReqBody = doc.OriginalReqBody
-			detail.ConvertedReqBody = doc.ConvertedReqBody
-			detail.UpstreamResponse = doc.UpstreamResponse
-			detail.ClientResponse = doc.ClientResponse
-		}
-	}
-
-	return detail, nil
+	return parseAuditDetailRow(result.ResultSet.Rows[1], result.ResultSet.ResultSetMetadata.ColumnInfo), nil
 }
 
 func buildAthenaWhere(params QueryParams) (string, error) {
@@ -51,10 +51,10 @@ func dispatch(batch []*AuditRecord) {
 		testDispatch(batch)
 		return
 	}
-	sent, err := awsClient.putRecordBatch(context.Background(), batch)
+	sent, err := backend.PutBatch(context.Background(), batch)
 	if err != nil {
 		unsent := batch[sent:]
-		logger.SysError(fmt.Sprintf("audit: putRecordBatch 失败 (sent=%d, unsent=%d)，转落盘: %s", sent, len(unsent), err.Error()))
+		logger.SysError(fmt.Sprintf("audit: %s 写入失败 (sent=%d, unsent=%d)，转落盘: %s", backend.Name(), sent, len(unsent), err.Error()))
 		spillBatch(unsent)
 	}
 }
@@ -90,7 +90,7 @@ func uploaderLoop(ctx context.Context) {
 					_ = os.Remove(f)
 					continue
 				}
-				sent, err := awsClient.putRecordBatch(context.Background(), records)
+				sent, err := backend.PutBatch(context.Background(), records)
 				if err != nil {
 					logger.SysError(fmt.Sprintf("audit: spill 重放部分失败 (sent=%d, total=%d)，保留待重试: %s", sent, len(records), err.Error()))
 					if sent > 0 {
@@ -109,6 +109,19 @@ func readSpillFile(path string) ([]*AuditRecord, error) {
 	if err != nil {
 		return nil, err
 	}
+	rows, err := decodeRows(data)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*AuditRecord, 0, len(rows))
+	for _, row := range rows {
+		records = append(records, rowToRecord(row))
+	}
+	return records, nil
+}
+
+// decodeRows 解析 gzip 压缩的 NDJSON（spill 文件与 file 后端分区文件格式相同），跳过损坏的行
+func decodeRows(data []byte) ([]firehoseRow, error) {
 	gr, err := gzip.NewReader(bytes.NewReader(data))
 	if err != nil {
 		return nil, err
@@ -118,7 +131,7 @@ func readSpillFile(path string) ([]*AuditRecord, error) {
 	if err != nil {
 		return nil, err
 	}
-	var records []*AuditRecord
+	var rows []firehoseRow
 	for _, line := range strings.Split(string(raw), "\n") {
 		line = strings.TrimSpace(line)
 		if line == "" {
@@ -128,10 +141,9 @@ func readSpillFile(path string) ([]*AuditRecord, error) {
 		if err := json.Unmarshal([]byte(line), &row); err != nil {
 			continue
 		}
-		r := rowToRecord(row)
-		records = append(records, r)
+		rows = append(rows, row)
 	}
-	return records, nil
+	return rows, nil
 }
 
 func rowToRecord(row firehoseRow) *AuditRecord {
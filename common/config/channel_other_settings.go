@@ -31,4 +31,17 @@ type ChannelOtherSettings struct {
 	UpstreamModelProbeDisabled bool `json:"upstream_model_probe_disabled,omitempty"`
 	// 健康巡检状态，key 为模型名。omitempty + 全新字段 → 现有渠道 settings JSON 零变化。
 	UpstreamModelHealth map[string]ModelHealthState `json:"upstream_model_health,omitempty"`
+	// 上游账单对账：定期拉取上游用量或余额变化，与本地消费日志比对
+	ReconcileEnabled bool `json:"reconcile_enabled,omitempty"`
+	// 对账数据源：openai（组织 costs 接口）、anthropic（cost_report 接口）、custom（自定义接口）、
+	// balance（渠道余额接口，按两次余额之差计用量）；为空时按渠道类型推断
+	ReconcileSource string `json:"reconcile_source,omitempty"`
+	// 组织用量接口需要的管理员密钥，为空时使用渠道 Key
+	ReconcileAdminKey string `json:"reconcile_admin_key,omitempty"`
+	// custom 数据源：用量接口支持 {start}/{end}（Unix 秒）占位符，返回美元；
+	// Field 为返回 JSON 中数值的路径，如 data.total_usage
+	ReconcileUsageURL     string `json:"reconcile_usage_url,omitempty"`
+	ReconcileUsageField   string `json:"reconcile_usage_field,omitempty"`
+	ReconcileBalanceURL   string `json:"reconcile_balance_url,omitempty"`
+	ReconcileBalanceField string `json:"reconcile_balance_field,omitempty"`
 }
@@ -101,6 +101,46 @@ var MemoryCacheEnabled = strings.ToLower(os.Getenv("MEMORY_CACHE_ENABLED")) == "
 
 var LogConsumeEnabled = true
 
+// 渠道成本高于售价时通知管理员，同一渠道模型在 MarginAlertCooldownSeconds 内只提醒一次
+var MarginAlertEnabled = true
+var MarginAlertCooldownSeconds = env.Int("MARGIN_ALERT_COOLDOWN_SECONDS", 6*3600)
+
+// 上游账单对账：任务间隔（分钟）；偏差同时超过 ReconcileDriftPercent 与 ReconcileDriftMinUSD 时标记并通知
+var ReconcileIntervalMinutes = env.Int("RECONCILE_INTERVAL_MINUTES", 60)
+var ReconcileDriftPercent = env.Float64("RECONCILE_DRIFT_PERCENT", 5)
+var ReconcileDriftMinUSD = env.Float64("RECONCILE_DRIFT_MIN_USD", 1)
+
+// 日志归档：把 LogArchiveAfterDays 天前的 logs / videos / images 按天导出为 gzip NDJSON，校验行数后再删除。
+// 配置了 LogArchiveBucket 时写入 S3 兼容存储，否则写入本地目录 LogArchiveDir
+var LogArchiveEnabled = env.Bool("LOG_ARCHIVE_ENABLED", false)
+var LogArchiveAfterDays = env.Int("LOG_ARCHIVE_AFTER_DAYS", 90)
+var LogArchiveIntervalMinutes = env.Int("LOG_ARCHIVE_INTERVAL_MINUTES", 360)
+var LogArchiveDir = env.String("LOG_ARCHIVE_DIR", "./data/log-archive")
+var LogArchivePrefix = env.String("LOG_ARCHIVE_PREFIX", "one-api-archive")
+var LogArchiveBucket = env.String("LOG_ARCHIVE_BUCKET", "")
+var LogArchiveEndpoint = env.String("LOG_ARCHIVE_ENDPOINT", "")
+var LogArchiveRegion = env.String("LOG_ARCHIVE_REGION", "")
+var LogArchiveAccessKey = env.String("LOG_ARCHIVE_ACCESS_KEY", "")
+var LogArchiveSecretKey = env.String("LOG_ARCHIVE_SECRET_KEY", "")
+
+// 日志流式导出：consume / error 日志写库后异步投递到分析系统，Other 展开为 other_<key> 列。
+// LogExportSink 可选 http（NDJSON POST）、clickhouse（HTTP 接口 JSONEachRow 插入）、file（按天 NDJSON 文件）
+var LogExportEnabled = env.Bool("LOG_EXPORT_ENABLED", false)
+var LogExportSink = env.String("LOG_EXPORT_SINK", "http")
+var LogExportURL = env.String("LOG_EXPORT_URL", "")
+var LogExportAuthorization = env.String("LOG_EXPORT_AUTHORIZATION", "") // http sink 的 Authorization 请求头
+var LogExportClickHouseTable = env.String("LOG_EXPORT_CLICKHOUSE_TABLE", "one_api_logs")
+var LogExportClickHouseUser = env.String("LOG_EXPORT_CLICKHOUSE_USER", "")
+var LogExportClickHousePassword = env.String("LOG_EXPORT_CLICKHOUSE_PASSWORD", "")
+var LogExportFileDir = env.String("LOG_EXPORT_FILE_DIR", "./data/log-export")
+var LogExportQueueSize = env.Int("LOG_EXPORT_QUEUE_SIZE", 10000)
+var LogExportBatchSize = env.Int("LOG_EXPORT_BATCH_SIZE", 500)
+var LogExportFlushIntervalMs = env.Int("LOG_EXPORT_FLUSH_INTERVAL_MS", 1000)
+var LogExportMaxRetries = env.Int("LOG_EXPORT_MAX_RETRIES", 3)
+var LogExportTimeoutSeconds = env.Int("LOG_EXPORT_TIMEOUT_SECONDS", 10)
+var LogExportSpillDir = env.String("LOG_EXPORT_SPILL_DIR", "./data/log-export-spill")
+var LogExportSpillMaxMB = env.Int("LOG_EXPORT_SPILL_MAX_MB", 1024)
+
 var SMTPServer = ""
 var SMTPPort = 587
 var SMTPAccount = ""
@@ -130,6 +170,13 @@ var TurnstileSecretKey = ""
 var QuotaForNewUser int64 = 0
 var QuotaForInviter int64 = 0
 var QuotaForInvitee int64 = 0
+
+// 邀请返佣：被邀请人注册后 AffiliateCommissionMonths 个月内的充值按 AffiliateCommissionPercent 返给邀请人，
+// 单个被邀请人累计返佣不超过 AffiliateCommissionCap（额度，0 不限）；返佣先冻结 AffiliateHoldDays 天再转为可提取
+var AffiliateCommissionPercent = 0.0
+var AffiliateCommissionMonths = 12
+var AffiliateCommissionCap int64 = 0
+var AffiliateHoldDays = 7
 var ChannelDisableThreshold = 5.0
 var AutomaticDisableChannelEnabled = false
 var AutomaticEnableChannelEnabled = false
@@ -302,6 +349,46 @@ var ModelMetricsAggregationInterval = env.Int("MODEL_METRICS_AGGREGATION_INTERVA
 var ModelMetricsRetentionDays = env.Int("MODEL_METRICS_RETENTION_DAYS", 30)              // 数据保留天数
 var ModelMetricsBackfillDays = env.Int("MODEL_METRICS_BACKFILL_DAYS", 7)                 // 首次回填天数
 
+// 用量汇总表（usage_rollups）：按小时/天汇总额度、请求数、token，Dashboard 与统计接口从汇总表读取
+var UsageRollupEnabled = env.Bool("USAGE_ROLLUP_ENABLED", true)
+var UsageRollupIntervalSeconds = env.Int("USAGE_ROLLUP_INTERVAL_SECONDS", 300) // 增量汇总间隔（秒）
+var UsageRollupBackfillDays = env.Int("USAGE_ROLLUP_BACKFILL_DAYS", 30)         // 首次回填天数
+var UsageRollupLateHours = env.Int("USAGE_ROLLUP_LATE_HOURS", 3)               // 每轮重算最近几个小时，覆盖迟到写入和异步任务回填的额度
+
+// 用量异常检测：按令牌/用户比较最近 AnomalyWindowMinutes 分钟与自身基线，发现突增、新来源 IP/国家、陌生模型组合。
+// AnomalyAction 为 alert 时只通知；为 freeze 时命中 AnomalyFreezeRules 的令牌级异常会自动冻结令牌
+var AnomalyDetectionEnabled = env.Bool("ANOMALY_DETECTION_ENABLED", false)
+var AnomalyIntervalMinutes = env.Int("ANOMALY_INTERVAL_MINUTES", 5)
+var AnomalyWindowMinutes = env.Int("ANOMALY_WINDOW_MINUTES", 15)
+var AnomalyBaselineDays = env.Int("ANOMALY_BASELINE_DAYS", 7)
+var AnomalyMinBaselineHours = env.Int("ANOMALY_MIN_BASELINE_HOURS", 24) // 历史不足该时长的令牌不做突增和模型组合判断
+var AnomalySpikeFactor = env.Float64("ANOMALY_SPIKE_FACTOR", 10)
+var AnomalyMinRequests = env.Int("ANOMALY_MIN_REQUESTS", 100)     // 窗口内请求数低于该值不判突增
+var AnomalyMinQuota = env.Int("ANOMALY_MIN_QUOTA", 2500000)       // 窗口内额度低于该值不判突增，默认 5 美元
+var AnomalyModelMixShare = env.Float64("ANOMALY_MODEL_MIX_SHARE", 0.5) // 基线中没出现过的模型占窗口额度的比例
+var AnomalyNewIPThreshold = env.Int("ANOMALY_NEW_IP_THRESHOLD", 3)
+var AnomalyAction = env.String("ANOMALY_ACTION", "alert")
+var AnomalyFreezeRules = env.String("ANOMALY_FREEZE_RULES", "request_spike,quota_spike,new_country")
+var AnomalyCooldownMinutes = env.Int("ANOMALY_COOLDOWN_MINUTES", 60) // 同一令牌同一规则的静默期，解冻后同样生效
+var AnomalyCountryHeader = env.String("ANOMALY_COUNTRY_HEADER", "CF-IPCountry")
+
+// 公开状态页：主节点每 StatusPageIntervalMinutes 分钟按渠道与模型状态采样一次，模型全部渠道故障时自动开启事件。
+// 当前小时成功率低于 StatusPageDegradedSuccessRate 的模型显示为 degraded
+var StatusPageEnabled = env.Bool("STATUS_PAGE_ENABLED", true)
+var StatusPageIntervalMinutes = env.Int("STATUS_PAGE_INTERVAL_MINUTES", 1)
+var StatusPageHistoryDays = env.Int("STATUS_PAGE_HISTORY_DAYS", 90)
+var StatusPageDegradedSuccessRate = env.Float64("STATUS_PAGE_DEGRADED_SUCCESS_RATE", 0.8)
+
+// 在 relay 响应中返回本次请求的计费信息：非流式为 X-OneAPI-* 响应头，流式为末尾的 SSE 注释
+var CostHeadersEnabled = env.Bool("COST_HEADERS_ENABLED", true)
+
+// 请求标签：客户端通过 X-OneAPI-Tags 头或请求体的 metadata / user 字段标注请求，写入 log_tags 用于成本归因。
+// 数量与长度上限用于控制基数，令牌还可以单独限定允许的标签键
+var RequestTagsEnabled = env.Bool("REQUEST_TAGS_ENABLED", true)
+var RequestTagMaxCount = env.Int("REQUEST_TAG_MAX_COUNT", 10)
+var RequestTagMaxKeyLength = env.Int("REQUEST_TAG_MAX_KEY_LENGTH", 32)     // 不超过 log_tags.tag_key 的 64
+var RequestTagMaxValueLength = env.Int("REQUEST_TAG_MAX_VALUE_LENGTH", 64) // 不超过 log_tags.tag_value 的 128，end user 同样适用
+
 // Claude Thinking 模型配置
 var ClaudeThinkingEnabled = true                      // 是否启用 Claude 思考适配（-thinking 后缀）
 var ClaudeThinkingBudgetRatio = 0.8                   // 默认思考 token 百分比（80%）
@@ -311,6 +398,11 @@ var ClaudeRequestHeaders map[string]map[string]string // 请求头覆盖（模
 
 // 审计模块配置（环境变量为初始默认值，运行时从 options 表覆盖）
 var AuditEnabled = env.Bool("AUDIT_ENABLED", false)
+var AuditBackend = env.String("AUDIT_BACKEND", "aws") // aws: Firehose + Athena；file: 本地目录或 S3 兼容存储
+var AuditStorageDir = env.String("AUDIT_STORAGE_DIR", "./data/audit")
+var AuditStorageBucket = env.String("AUDIT_STORAGE_BUCKET", "") // 非空时 file 后端写入该 bucket 而非本地目录
+var AuditStorageEndpoint = env.String("AUDIT_STORAGE_ENDPOINT", "")
+var AuditStoragePrefix = env.String("AUDIT_STORAGE_PREFIX", "audit")
 var AuditAWSRegion = env.String("AUDIT_AWS_REGION", "")
 var AuditAWSAccessKey = env.String("AUDIT_AWS_ACCESS_KEY", "")
 var AuditAWSSecretKey = env.String("AUDIT_AWS_SECRET_KEY", "")
@@ -330,6 +422,20 @@ var AuditMaxBodyKB = env.Int("AUDIT_MAX_BODY_KB", 10240)
 var AuditMaxRespKB = env.Int("AUDIT_MAX_RESP_KB", 4096)
 var AuditRetentionDays = env.Int("AUDIT_RETENTION_DAYS", 0)
 var AuditRedactHeaders = env.String("AUDIT_REDACT_HEADERS", "Authorization,Api-Key,X-Api-Key,Cookie,Set-Cookie")
+var AuditRedactBodyRules = env.String("AUDIT_REDACT_BODY_RULES", "card,national_id,api_key,email,phone") // 对 body 整段启用的内置脱敏规则，留空关闭
+
+// 临时密钥（ek-）签名密钥，为空时使用 SessionSecret。多节点部署必须显式配置，否则各节点签发的密钥互不认可
+var EphemeralKeySecret = env.String("EPHEMERAL_KEY_SECRET", "")
+
+// 临时密钥允许的最长有效期（秒）
+var EphemeralKeyMaxTTL = env.Int("EPHEMERAL_KEY_MAX_TTL", 3600)
+
+// 登录防爆破：连续失败达到 LoginTurnstileThreshold 次后要求 Turnstile，
+// 达到 LoginLockoutThreshold 次后锁定账号，锁定时长从 LoginLockoutBaseSeconds 起按次数翻倍，不超过 LoginLockoutMaxSeconds
+var LoginTurnstileThreshold = env.Int("LOGIN_TURNSTILE_THRESHOLD", 3)
+var LoginLockoutThreshold = env.Int("LOGIN_LOCKOUT_THRESHOLD", 5)
+var LoginLockoutBaseSeconds = env.Int("LOGIN_LOCKOUT_BASE_SECONDS", 60)
+var LoginLockoutMaxSeconds = env.Int("LOGIN_LOCKOUT_MAX_SECONDS", 24*3600)
 
 // 日志标识，用于 JSON 日志中的 service/instance 字段
 var ServiceName = env.String("SERVICE_NAME", "one-api")
@@ -347,6 +453,19 @@ var MetricsPort = env.Int("METRICS_PORT", 9090)
 // 为空时 /metrics 只接受 loopback 请求，避免忘配 token 变成匿名公开端点
 var MetricsToken = env.String("METRICS_TOKEN", "")
 
+// OpenTelemetry 链路追踪（详见 common/tracing 包注释）。与指标一样是重启级开关，不接入 options 表。
+var TracingEnabled = env.Bool("TRACING_ENABLED", false)
+
+// OTLP/HTTP 导出地址，默认指向本机 collector；可写 host:port 或完整 URL（如 https://otel.example.com/v1/traces）
+var TracingEndpoint = env.String("TRACING_OTLP_ENDPOINT", "localhost:4318")
+var TracingInsecure = env.Bool("TRACING_OTLP_INSECURE", true)
+
+// 采样率（0~1）。只对根 span 生效，客户端传了 traceparent 时沿用其采样决定
+var TracingSampleRatio = env.Float64("TRACING_SAMPLE_RATIO", 1.0)
+
+// 是否向上游请求注入 traceparent。部分上游会拒绝未知请求头时可关闭
+var TracingPropagateUpstream = env.Bool("TRACING_PROPAGATE_UPSTREAM", true)
+
 // pprof 独立开关：/debug/pprof/heap 可能 dump 出含 API key 的内存内容，默认关闭
 var PprofEnabled = env.Bool("PPROF_ENABLED", false)
 
@@ -23,6 +23,7 @@ const (
 	TokenStatusDisabled  = 2 // also don't use 0
 	TokenStatusExpired   = 3
 	TokenStatusExhausted = 4
+	TokenStatusFrozen    = 5 // 用量异常被自动冻结，见 model/token_anomaly.go
 )
 
 const (
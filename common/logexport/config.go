@@ -0,0 +1,73 @@
+package logexport
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+const (
+	SinkHTTP       = "http"       // POST application/x-ndjson，适配 Vector / Fluent Bit / 自建网关，再转发到 Kafka 等
+	SinkClickHouse = "clickhouse" // ClickHouse HTTP 接口，INSERT ... FORMAT JSONEachRow
+	SinkFile       = "file"       // 本地按天 NDJSON 文件，供 filebeat 等采集
+)
+
+// reIdentifier ClickHouse 表名，允许 db.table
+var reIdentifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)?$`)
+
+type exportConfig struct {
+	Enabled        bool
+	Sink           string
+	URL            string
+	Authorization  string
+	CHTable        string
+	CHUser         string
+	CHPassword     string
+	FileDir        string
+	QueueSize      int
+	BatchSize      int
+	FlushInterval  time.Duration
+	MaxRetries     int
+	Timeout        time.Duration
+	SpillDir       string
+	SpillMaxBytes  int64
+	RetryBaseDelay time.Duration
+}
+
+func loadConfig() *exportConfig {
+	cfg := &exportConfig{
+		Enabled:        config.LogExportEnabled,
+		Sink:           config.LogExportSink,
+		URL:            config.LogExportURL,
+		Authorization:  config.LogExportAuthorization,
+		CHTable:        config.LogExportClickHouseTable,
+		CHUser:         config.LogExportClickHouseUser,
+		CHPassword:     config.LogExportClickHousePassword,
+		FileDir:        config.LogExportFileDir,
+		QueueSize:      config.LogExportQueueSize,
+		BatchSize:      config.LogExportBatchSize,
+		FlushInterval:  time.Duration(config.LogExportFlushIntervalMs) * time.Millisecond,
+		MaxRetries:     config.LogExportMaxRetries,
+		Timeout:        time.Duration(config.LogExportTimeoutSeconds) * time.Second,
+		SpillDir:       config.LogExportSpillDir,
+		SpillMaxBytes:  int64(config.LogExportSpillMaxMB) * 1024 * 1024,
+		RetryBaseDelay: 200 * time.Millisecond,
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 10000
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return cfg
+}
@@ -0,0 +1,389 @@
+package logexport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/metrics"
+)
+
+var (
+	pkgConfig  *exportConfig
+	queue      chan Record
+	ingestDone chan struct{}
+	replayDone chan struct{}
+	sink       Sink
+	spill      *spillStore
+	cancelFunc context.CancelFunc
+	startMu    sync.Mutex
+	// queueMu 保护 pkgConfig / queue / closed：Submit 持读锁发送，Shutdown 持写锁置 closed 后才关闭 channel
+	queueMu sync.RWMutex
+	closed  bool
+
+	// sinkDown 最近一次投递失败后置 1：新批次直接落盘，不再逐批重试阻塞队列，由重放协程探测恢复
+	sinkDown int32
+
+	enqueued, sent, spilled, replayed, dropped, failedBatches int64
+	lastSuccessAt                                             int64
+	lastErrMu                                                 sync.Mutex
+	lastErr                                                   string
+	lastErrAt                                                 int64
+)
+
+// Stats 投递统计，进程内累计，重启清零
+type Stats struct {
+	Enabled       bool   `json:"enabled"`
+	Sink          string `json:"sink"`
+	SinkHealthy   bool   `json:"sink_healthy"`
+	QueueLength   int    `json:"queue_length"`
+	QueueCapacity int    `json:"queue_capacity"`
+	Enqueued      int64  `json:"enqueued"`
+	Sent          int64  `json:"sent"`
+	Spilled       int64  `json:"spilled"`
+	Replayed      int64  `json:"replayed"`
+	Dropped       int64  `json:"dropped"`
+	FailedBatches int64  `json:"failed_batches"`
+	SpillBytes    int64  `json:"spill_bytes"`
+	LastSuccessAt int64  `json:"last_success_at"`
+	LastError     string `json:"last_error"`
+	LastErrorAt   int64  `json:"last_error_at"`
+}
+
+func Enabled() bool {
+	queueMu.RLock()
+	defer queueMu.RUnlock()
+	return pkgConfig != nil && pkgConfig.Enabled
+}
+
+// Submit 把日志放入导出队列。队列满时直接丢弃并计数，任何情况下都不阻塞调用方
+func Submit(r Record) {
+	queueMu.RLock()
+	defer queueMu.RUnlock()
+	if closed || queue == nil || pkgConfig == nil || !pkgConfig.Enabled {
+		return
+	}
+	select {
+	case queue <- r:
+		atomic.AddInt64(&enqueued, 1)
+	default:
+		addDropped(1)
+	}
+}
+
+// Start 按环境变量启动导出模块，未开启时为空操作；目标初始化失败只记日志，降级为关闭
+func Start() {
+	startMu.Lock()
+	defer startMu.Unlock()
+	if pkgConfig != nil {
+		return
+	}
+	cfg := loadConfig()
+	if !cfg.Enabled {
+		setConfig(cfg)
+		return
+	}
+	s, err := newSink(cfg)
+	if err != nil {
+		logger.SysError("logexport: " + err.Error() + "，日志导出已关闭")
+		cfg.Enabled = false
+		setConfig(cfg)
+		return
+	}
+	start(cfg, s)
+	logger.SysLog("logexport: 日志导出已启动 (" + s.Name() + ")")
+}
+
+func setConfig(cfg *exportConfig) {
+	queueMu.Lock()
+	pkgConfig = cfg
+	queueMu.Unlock()
+}
+
+func start(cfg *exportConfig, s Sink) {
+	q := make(chan Record, cfg.QueueSize)
+	queueMu.Lock()
+	pkgConfig = cfg
+	sink = s
+	spill = &spillStore{dir: cfg.SpillDir, maxBytes: cfg.SpillMaxBytes}
+	queue = q
+	closed = false
+	queueMu.Unlock()
+	ingestDone = make(chan struct{})
+	replayDone = make(chan struct{})
+	atomic.StoreInt32(&sinkDown, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelFunc = cancel
+	go func() {
+		superviseLoop("ingest", func() { ingestLoop(q) })
+		close(ingestDone)
+	}()
+	go func() {
+		superviseLoop("replay", func() { replayLoop(ctx) })
+		close(replayDone)
+	}()
+}
+
+// loopRestartDelay 协程 panic 后重启前的等待，避免持续 panic 时空转刷日志
+var loopRestartDelay = time.Second
+
+// superviseLoop 运行 loop 直到其正常返回；panic 时记录堆栈并重启，
+// 否则投递协程一旦退出，队列写满后新日志会被静默丢弃
+func superviseLoop(name string, loop func()) {
+	for !runLoop(name, loop) {
+		time.Sleep(loopRestartDelay)
+	}
+}
+
+func runLoop(name string, loop func()) (finished bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.SysError(fmt.Sprintf("logexport: %s 协程 panic，即将重启: %v, stack: %s", name, r, debug.Stack()))
+		}
+	}()
+	loop()
+	return true
+}
+
+// Shutdown 停止接收新日志，把队列中剩余的日志投递或落盘后返回
+func Shutdown() {
+	startMu.Lock()
+	defer startMu.Unlock()
+	// 拿到写锁后不再有 Submit 在发送，此时关闭 channel 是安全的
+	queueMu.Lock()
+	q := queue
+	closed = true
+	queueMu.Unlock()
+	if q != nil {
+		close(q)
+		<-ingestDone
+	}
+	if cancelFunc != nil {
+		cancelFunc()
+		<-replayDone
+	}
+	if sink != nil {
+		_ = sink.Close()
+	}
+	queueMu.Lock()
+	pkgConfig = nil
+	queue = nil
+	sink = nil
+	spill = nil
+	queueMu.Unlock()
+	ingestDone = nil
+	replayDone = nil
+	cancelFunc = nil
+}
+
+func GetStats() Stats {
+	st := Stats{
+		Enqueued:      atomic.LoadInt64(&enqueued),
+		Sent:          atomic.LoadInt64(&sent),
+		Spilled:       atomic.LoadInt64(&spilled),
+		Replayed:      atomic.LoadInt64(&replayed),
+		Dropped:       atomic.LoadInt64(&dropped),
+		FailedBatches: atomic.LoadInt64(&failedBatches),
+		LastSuccessAt: atomic.LoadInt64(&lastSuccessAt),
+	}
+	lastErrMu.Lock()
+	st.LastError, st.LastErrorAt = lastErr, lastErrAt
+	lastErrMu.Unlock()
+	queueMu.RLock()
+	defer queueMu.RUnlock()
+	if pkgConfig == nil || !pkgConfig.Enabled {
+		return st
+	}
+	st.Enabled = true
+	st.SinkHealthy = atomic.LoadInt32(&sinkDown) == 0
+	st.QueueLength, st.QueueCapacity = len(queue), cap(queue)
+	if sink != nil {
+		st.Sink = sink.Name()
+	}
+	if spill != nil {
+		st.SpillBytes = spill.usage()
+	}
+	return st
+}
+
+func ingestLoop(queue <-chan Record) {
+	batch := make([]Record, 0, pkgConfig.BatchSize)
+	ticker := time.NewTicker(pkgConfig.FlushInterval)
+	defer ticker.Stop()
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		dispatch(batch)
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case r, ok := <-queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, r)
+			if len(batch) >= pkgConfig.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// encodeBatch 展开 other 并编码为 NDJSON，返回编码成功的条数
+func encodeBatch(batch []Record) ([]byte, int) {
+	var buf bytes.Buffer
+	n := 0
+	for _, r := range batch {
+		r.expandOther()
+		line, err := json.Marshal(r)
+		if err != nil {
+			continue
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		n++
+	}
+	return buf.Bytes(), n
+}
+
+func dispatch(batch []Record) {
+	data, n := encodeBatch(batch)
+	if n == 0 {
+		return
+	}
+	if atomic.LoadInt32(&sinkDown) == 1 {
+		spillBatch(data, n)
+		return
+	}
+	var err error
+	for attempt := 0; attempt <= pkgConfig.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(pkgConfig.RetryBaseDelay << (attempt - 1))
+		}
+		if err = send(data); err == nil {
+			markSent(n, false)
+			return
+		}
+	}
+	markFailed(err)
+	logger.SysError(fmt.Sprintf("logexport: %s 投递失败 (%d 条)，转落盘: %s", sink.Name(), n, err.Error()))
+	spillBatch(data, n)
+}
+
+func send(data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), pkgConfig.Timeout)
+	defer cancel()
+	begin := time.Now()
+	err := sink.Send(ctx, data)
+	metrics.ObserveLogExportSend(sink.Name(), time.Since(begin).Seconds(), err == nil)
+	return err
+}
+
+func spillBatch(data []byte, n int) {
+	if err := spill.write(data); err != nil {
+		addDropped(n)
+		logger.SysError(fmt.Sprintf("logexport: 落盘失败，丢弃 %d 条日志: %s", n, err.Error()))
+		return
+	}
+	atomic.AddInt64(&spilled, int64(n))
+	metrics.AddLogExportRecords(sink.Name(), "spilled", n)
+}
+
+// replayLoop 定期把落盘的批次按时间顺序重放，遇到失败即停止本轮，保持顺序并避免空转
+func replayLoop(ctx context.Context) {
+	ticker := time.NewTicker(pkgConfig.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			replaySpill()
+		}
+	}
+}
+
+func replaySpill() {
+	files, _ := spill.scan()
+	if len(files) == 0 {
+		// 落盘已满导致没有文件可供探测时，放行下一批直接投递
+		atomic.StoreInt32(&sinkDown, 0)
+		return
+	}
+	for _, f := range files {
+		data, err := readSpillFile(f)
+		if err != nil {
+			logger.SysError("logexport: 读取落盘文件失败: " + err.Error())
+			continue
+		}
+		n := bytes.Count(data, []byte{'\n'})
+		if n == 0 {
+			_ = os.Remove(f)
+			continue
+		}
+		if err := send(data); err != nil {
+			markFailed(err)
+			return
+		}
+		_ = os.Remove(f)
+		markSent(n, true)
+	}
+}
+
+func markSent(n int, fromSpill bool) {
+	atomic.StoreInt32(&sinkDown, 0)
+	atomic.StoreInt64(&lastSuccessAt, time.Now().Unix())
+	if fromSpill {
+		atomic.AddInt64(&replayed, int64(n))
+		metrics.AddLogExportRecords(sink.Name(), "replayed", n)
+		return
+	}
+	atomic.AddInt64(&sent, int64(n))
+	metrics.AddLogExportRecords(sink.Name(), "sent", n)
+}
+
+func markFailed(err error) {
+	atomic.StoreInt32(&sinkDown, 1)
+	atomic.AddInt64(&failedBatches, 1)
+	lastErrMu.Lock()
+	lastErr, lastErrAt = err.Error(), time.Now().Unix()
+	lastErrMu.Unlock()
+}
+
+func addDropped(n int) {
+	atomic.AddInt64(&dropped, int64(n))
+	name := "unknown"
+	if sink != nil {
+		name = sink.Name()
+	}
+	metrics.AddLogExportRecords(name, "dropped", n)
+}
+
+func resetForTest() {
+	pkgConfig = nil
+	queue = nil
+	closed = false
+	ingestDone = nil
+	replayDone = nil
+	sink = nil
+	spill = nil
+	cancelFunc = nil
+	atomic.StoreInt32(&sinkDown, 0)
+	for _, p := range []*int64{&enqueued, &sent, &spilled, &replayed, &dropped, &failedBatches, &lastSuccessAt} {
+		atomic.StoreInt64(p, 0)
+	}
+	lastErr, lastErrAt = "", 0
+}
@@ -0,0 +1,212 @@
+package logexport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSink struct {
+	mu   sync.Mutex
+	fail bool
+	// panics 剩余的 panic 次数，模拟投递时的意外 panic
+	panics int
+	lines  []string
+}
+
+func (s *fakeSink) Name() string { return "fake" }
+func (s *fakeSink) Close() error { return nil }
+func (s *fakeSink) Send(ctx context.Context, ndjson []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.panics > 0 {
+		s.panics--
+		panic("sink panic")
+	}
+	if s.fail {
+		return errors.New("sink down")
+	}
+	s.lines = append(s.lines, strings.Split(strings.TrimSpace(string(ndjson)), "\n")...)
+	return nil
+}
+
+func (s *fakeSink) setFail(fail bool) {
+	s.mu.Lock()
+	s.fail = fail
+	s.mu.Unlock()
+}
+
+func testConfig(t *testing.T) *exportConfig {
+	return &exportConfig{
+		Enabled: true, QueueSize: 100, BatchSize: 2, FlushInterval: time.Hour, MaxRetries: 1,
+		Timeout: time.Second, SpillDir: t.TempDir(), SpillMaxBytes: 1 << 20, RetryBaseDelay: time.Millisecond,
+	}
+}
+
+func TestSubmitNonBlockingDropsWhenQueueFull(t *testing.T) {
+	resetForTest()
+	t.Cleanup(resetForTest)
+	pkgConfig = &exportConfig{Enabled: true}
+	queue = make(chan Record, 1)
+	Submit(Record{})
+	Submit(Record{}) // 队列已满，不应阻塞
+	if st := GetStats(); st.Enqueued != 1 || st.Dropped != 1 {
+		t.Errorf("队列满时应丢弃并计数: %+v", st)
+	}
+}
+
+func TestSubmitConcurrentWithShutdown(t *testing.T) {
+	resetForTest()
+	t.Cleanup(resetForTest)
+	start(testConfig(t), &fakeSink{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				Submit(Record{"id": j}) // 关闭后不应向已关闭的 channel 发送
+			}
+		}()
+	}
+	Shutdown()
+	wg.Wait()
+	Submit(Record{})
+	if st := GetStats(); st.Enabled {
+		t.Errorf("关闭后应不再接收日志: %+v", st)
+	}
+}
+
+func TestIngestLoopRestartsAfterPanic(t *testing.T) {
+	resetForTest()
+	t.Cleanup(resetForTest)
+	origDelay := loopRestartDelay
+	loopRestartDelay = time.Millisecond
+	t.Cleanup(func() { loopRestartDelay = origDelay })
+	s := &fakeSink{panics: 1}
+	start(testConfig(t), s)
+
+	Submit(Record{"id": 1})
+	Submit(Record{"id": 2}) // 投递时 panic，这一批丢失
+	waitFor(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.panics == 0
+	})
+	Submit(Record{"id": 3})
+	Submit(Record{"id": 4}) // 协程重启后继续消费队列
+	waitFor(t, func() bool { return GetStats().Sent == 2 })
+	Shutdown()
+	if len(s.lines) != 2 {
+		t.Fatalf("重启后应继续投递, got %v", s.lines)
+	}
+}
+
+func TestDispatchSpillsAndReplaysWhenSinkRecovers(t *testing.T) {
+	resetForTest()
+	t.Cleanup(resetForTest)
+	s := &fakeSink{fail: true}
+	start(testConfig(t), s)
+
+	Submit(Record{"id": 1, "other": "ip:1.2.3.4"})
+	Submit(Record{"id": 2}) // 满 2 条投递，重试后仍失败 → 落盘
+	Submit(Record{"id": 3})
+	Submit(Record{"id": 4}) // 目标已标记不可用，直接落盘不再重试
+	waitFor(t, func() bool { return GetStats().Spilled == 4 })
+	if st := GetStats(); st.SinkHealthy || st.FailedBatches != 1 || st.LastError == "" || st.SpillBytes == 0 {
+		t.Fatalf("失败后应标记目标不可用并落盘: %+v", st)
+	}
+
+	replaySpill() // 仍不可用：停止本轮，文件保留
+	if files, _ := spill.scan(); len(files) != 2 {
+		t.Fatalf("重放失败应保留落盘文件, got %d", len(files))
+	}
+	s.setFail(false)
+	replaySpill()
+	if files, _ := spill.scan(); len(files) != 0 {
+		t.Errorf("重放成功后应删除落盘文件, got %d", len(files))
+	}
+	Submit(Record{"id": 5})
+	Shutdown() // 剩余 1 条在关闭时投递
+
+	if len(s.lines) != 5 {
+		t.Fatalf("应投递全部 5 条, got %v", s.lines)
+	}
+	var first map[string]any
+	_ = json.Unmarshal([]byte(s.lines[0]), &first)
+	if first["other_ip"] != "1.2.3.4" {
+		t.Errorf("落盘前应已展开 other: %v", first)
+	}
+	if st := GetStats(); st.Replayed != 4 || st.Sent != 1 {
+		t.Errorf("统计不符: %+v", st)
+	}
+}
+
+func TestClickHouseSinkInsertsJSONEachRow(t *testing.T) {
+	var gotQuery, gotUser, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query().Get("query")
+		gotUser = r.Header.Get("X-ClickHouse-User")
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		if r.URL.Query().Get("input_format_skip_unknown_fields") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t)
+	cfg.Sink, cfg.URL, cfg.CHTable, cfg.CHUser = SinkClickHouse, srv.URL+"/?database=analytics", "analytics.logs", "writer"
+	s, err := newSink(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(context.Background(), []byte("{\"id\":1}\n")); err != nil {
+		t.Fatalf("插入失败: %v", err)
+	}
+	if gotQuery != "INSERT INTO analytics.logs FORMAT JSONEachRow" || gotUser != "writer" || gotBody != "{\"id\":1}\n" {
+		t.Errorf("请求不符: query=%q user=%q body=%q", gotQuery, gotUser, gotBody)
+	}
+
+	cfg.CHTable = "logs; DROP TABLE x"
+	if _, err := newSink(cfg); err == nil {
+		t.Errorf("非法表名应拒绝")
+	}
+}
+
+func TestFileSinkAppendsDailyFile(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Sink, cfg.FileDir = SinkFile, t.TempDir()
+	s, err := newSink(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = s.Send(context.Background(), []byte("{\"id\":1}\n"))
+	_ = s.Send(context.Background(), []byte("{\"id\":2}\n"))
+	_ = s.Close()
+	data, _ := os.ReadFile(filepath.Join(cfg.FileDir, "logs-"+time.Now().UTC().Format("2006-01-02")+".ndjson"))
+	if string(data) != "{\"id\":1}\n{\"id\":2}\n" {
+		t.Errorf("应追加写入当天文件, got %q", data)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待超时: %+v", GetStats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
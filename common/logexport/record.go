@@ -0,0 +1,143 @@
+package logexport
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Record 一条待导出的日志，键为列名。调用方只填原始字段，other 原样放在 "other" 键中，
+// 由导出协程展开，避免在请求路径上做解析
+type Record map[string]any
+
+const otherColumnPrefix = "other_"
+
+// expandOther 把 other 展开为 other_<key> 列，原始 other 保留。
+// other 有两种格式：JSON 对象，或 "k:v;k:v" 分号格式（值可能是带分号的 JSON 数组/对象，如 retryHistory）。
+// 嵌套值统一序列化为 JSON 字符串，列的类型保持稳定
+func (r Record) expandOther() {
+	other, _ := r["other"].(string)
+	if other == "" {
+		return
+	}
+	if other[0] == '{' {
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(other), &obj); err == nil {
+			for k, v := range obj {
+				r.setOther(k, v)
+			}
+			return
+		}
+	}
+	for _, kv := range splitOther(other) {
+		r.setOther(kv[0], kv[1])
+	}
+}
+
+func (r Record) setOther(key string, v any) {
+	key = otherColumnName(key)
+	if key == "" {
+		return
+	}
+	switch v := v.(type) {
+	case string, float64, bool, nil:
+		r[key] = v
+	default:
+		b, _ := json.Marshal(v)
+		r[key] = string(b)
+	}
+}
+
+// otherColumnName 把 other 的键规范为列名：驼峰转下划线，非字母数字替换为下划线
+func otherColumnName(key string) string {
+	var b strings.Builder
+	for i, c := range key {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(c - 'A' + 'a')
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '_':
+			b.WriteRune(c)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	name := strings.Trim(b.String(), "_")
+	if name == "" {
+		return ""
+	}
+	return otherColumnPrefix + name
+}
+
+// splitOther 解析分号格式的 other。值以 [ 或 { 开头时按括号配对读取，
+// 尊重字符串字面量与转义，不会被其中的分号截断
+func splitOther(s string) [][2]string {
+	var out [][2]string
+	for len(s) > 0 {
+		colon := strings.IndexByte(s, ':')
+		semi := strings.IndexByte(s, ';')
+		if colon < 0 || (semi >= 0 && semi < colon) {
+			// 没有值的片段，跳过
+			if semi < 0 {
+				break
+			}
+			s = s[semi+1:]
+			continue
+		}
+		key := strings.TrimSpace(s[:colon])
+		rest := s[colon+1:]
+		end := strings.IndexByte(rest, ';')
+		if len(rest) > 0 && (rest[0] == '[' || rest[0] == '{') {
+			if n := matchBracket(rest); n > 0 {
+				end = strings.IndexByte(rest[n:], ';')
+				if end >= 0 {
+					end += n
+				}
+			}
+		}
+		if end < 0 {
+			end = len(rest)
+		}
+		if key != "" {
+			out = append(out, [2]string{key, rest[:end]})
+		}
+		if end >= len(rest) {
+			break
+		}
+		s = rest[end+1:]
+	}
+	return out
+}
+
+// matchBracket 返回与 s[0] 配对的右括号之后的位置，未配对返回 -1
+func matchBracket(s string) int {
+	depth := 0
+	inStr, escape := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inStr {
+			switch {
+			case escape:
+				escape = false
+			case c == '\\':
+				escape = true
+			case c == '"':
+				inStr = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inStr = true
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,31 @@
+package logexport
+
+import "testing"
+
+func TestExpandOtherSemicolonFormat(t *testing.T) {
+	r := Record{"other": `ip:::1;retryHistory:[{"channel":1,"msg":"a;b"}];cacheRatio:0.5;bad;adminInfo:{"x":"}"}`}
+	r.expandOther()
+	if r["other_ip"] != "::1" {
+		t.Errorf("值中的冒号应保留, got %v", r["other_ip"])
+	}
+	if r["other_retry_history"] != `[{"channel":1,"msg":"a;b"}]` {
+		t.Errorf("带分号的 JSON 值应按括号配对读取, got %v", r["other_retry_history"])
+	}
+	if r["other_cache_ratio"] != "0.5" || r["other_admin_info"] != `{"x":"}"}` {
+		t.Errorf("展开结果不符: %+v", r)
+	}
+	if _, ok := r["other_bad"]; ok {
+		t.Errorf("没有值的片段应跳过")
+	}
+	if r["other"] == nil {
+		t.Errorf("原始 other 应保留")
+	}
+}
+
+func TestExpandOtherJSONFormat(t *testing.T) {
+	r := Record{"other": `{"admin_info":{"use_channel":[1,2]},"frt":12.5,"is-cached":true}`}
+	r.expandOther()
+	if r["other_admin_info"] != `{"use_channel":[1,2]}` || r["other_frt"] != 12.5 || r["other_is_cached"] != true {
+		t.Errorf("JSON 格式应展开为同名列，嵌套值序列化为字符串: %+v", r)
+	}
+}
@@ -0,0 +1,155 @@
+package logexport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Sink 导出目标。Send 收到的是一批完整的 NDJSON，整批成功或整批失败，失败由调用方重试或落盘；
+// 重放可能导致重复投递，下游按 id / x_request_id 去重
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, ndjson []byte) error
+	Close() error
+}
+
+func newSink(cfg *exportConfig) (Sink, error) {
+	switch cfg.Sink {
+	case SinkHTTP, "":
+		if cfg.URL == "" {
+			return nil, errors.New("缺少 LOG_EXPORT_URL 配置")
+		}
+		return &httpSink{url: cfg.URL, authorization: cfg.Authorization, client: &http.Client{Timeout: cfg.Timeout}}, nil
+	case SinkClickHouse:
+		if cfg.URL == "" {
+			return nil, errors.New("缺少 LOG_EXPORT_URL 配置")
+		}
+		if !reIdentifier.MatchString(cfg.CHTable) {
+			return nil, fmt.Errorf("非法的 ClickHouse 表名: %s", cfg.CHTable)
+		}
+		return newClickHouseSink(cfg)
+	case SinkFile:
+		if err := os.MkdirAll(cfg.FileDir, 0o755); err != nil {
+			return nil, err
+		}
+		return &fileSink{dir: cfg.FileDir}, nil
+	}
+	return nil, fmt.Errorf("未知的日志导出目标: %s", cfg.Sink)
+}
+
+type httpSink struct {
+	url           string
+	authorization string
+	client        *http.Client
+	// header 额外的请求头，ClickHouse 用它带认证信息
+	header http.Header
+}
+
+func (s *httpSink) Name() string { return "http" }
+
+func (s *httpSink) Close() error { return nil }
+
+func (s *httpSink) Send(ctx context.Context, ndjson []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(ndjson))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.authorization != "" {
+		req.Header.Set("Authorization", s.authorization)
+	}
+	for k, v := range s.header {
+		req.Header[k] = v
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+type clickHouseSink struct {
+	*httpSink
+}
+
+// newClickHouseSink 通过 HTTP 接口插入，列名与 Record 的键一致；
+// 开启 input_format_skip_unknown_fields，表里没建的 other_* 列直接忽略，新增字段不会导致整批失败
+func newClickHouseSink(cfg *exportConfig) (*clickHouseSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("query", fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", cfg.CHTable))
+	q.Set("input_format_skip_unknown_fields", "1")
+	q.Set("date_time_input_format", "best_effort")
+	u.RawQuery = q.Encode()
+	header := http.Header{}
+	if cfg.CHUser != "" {
+		header.Set("X-ClickHouse-User", cfg.CHUser)
+		header.Set("X-ClickHouse-Key", cfg.CHPassword)
+	}
+	return &clickHouseSink{httpSink: &httpSink{
+		url:           u.String(),
+		authorization: cfg.Authorization,
+		client:        &http.Client{Timeout: cfg.Timeout},
+		header:        header,
+	}}, nil
+}
+
+func (s *clickHouseSink) Name() string { return "clickhouse" }
+
+// fileSink 追加写入 <dir>/logs-YYYY-MM-DD.ndjson（UTC），按天切分
+type fileSink struct {
+	dir string
+	mu  sync.Mutex
+	day string
+	f   *os.File
+}
+
+func (s *fileSink) Name() string { return "file" }
+
+func (s *fileSink) Send(ctx context.Context, ndjson []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	day := time.Now().UTC().Format("2006-01-02")
+	if s.f == nil || s.day != day {
+		if s.f != nil {
+			_ = s.f.Close()
+			s.f = nil
+		}
+		f, err := os.OpenFile(filepath.Join(s.dir, "logs-"+day+".ndjson"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		s.f, s.day = f, day
+	}
+	_, err := s.f.Write(ndjson)
+	return err
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
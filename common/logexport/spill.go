@@ -0,0 +1,105 @@
+package logexport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var errSpillFull = errors.New("logexport: disk spill buffer full")
+
+// spillStore 目标不可用时的磁盘缓冲，每批一个 gzip NDJSON 文件，按文件名（时间序）重放
+type spillStore struct {
+	dir      string
+	maxBytes int64
+	seq      int64
+	mu       sync.Mutex
+}
+
+func (s *spillStore) usage() int64 {
+	var total int64
+	entries, _ := os.ReadDir(s.dir)
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) == ".gz" {
+			if fi, err := e.Info(); err == nil {
+				total += fi.Size()
+			}
+		}
+	}
+	return total
+}
+
+func (s *spillStore) write(ndjson []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.usage()+int64(len(ndjson)) > s.maxBytes {
+		return errSpillFull
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("logs-%d-%d.ndjson.gz", time.Now().UnixNano(), atomic.AddInt64(&s.seq, 1))
+	tmpPath := filepath.Join(s.dir, name+".tmp")
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(ndjson); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	if err := os.WriteFile(tmpPath, buf.Bytes(), 0o644); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, filepath.Join(s.dir, name)); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+func (s *spillStore) scan() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) == ".gz" {
+			files = append(files, filepath.Join(s.dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func readSpillFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+	return io.ReadAll(gr)
+}
@@ -3,6 +3,13 @@ package logger
 const (
 	RequestIdKey = "X-Request-ID"
 	RequestIPKey = "X-Request-IP"
+	OrgIdKey     = "X-Org-ID"
+	// EphemeralKeyCtxKey 存放 *model.EphemeralKeySession，供计费路径累计临时密钥的花费
+	EphemeralKeyCtxKey = "X-Ephemeral-Key"
+	// PricingPlanCtxKey 存放 *model.PricingPlanApplied，消费日志据此记录命中的阶梯并累计月度用量
+	PricingPlanCtxKey = "X-Pricing-Plan"
+	// RequestTagsCtxKey 存放 *model.RequestTags，消费日志据此写入 log_tags
+	RequestTagsCtxKey = "X-Request-Tags"
 )
 
 var LogDir string
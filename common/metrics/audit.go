@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 审计模块指标（Group C）。
+//
+// rule label 的取值来自审计脱敏规则配置（内置规则名 + 管理员自定义规则名），基数有界。
+
+var auditRedactionHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace, Subsystem: "audit", Name: "redaction_hits_total",
+	Help: "Number of values masked in audit bodies, by redaction rule.",
+}, []string{"rule"})
+
+func registerAuditMetrics() {
+	Registry().MustRegister(auditRedactionHits)
+}
+
+// AddAuditRedactionHits 累加某条脱敏规则的命中次数，由 common/audit 在组装记录时调用。
+func AddAuditRedactionHits(rule string, n int) {
+	if !Enabled() || n <= 0 {
+		return
+	}
+	auditRedactionHits.WithLabelValues(rule).Add(float64(n))
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 日志导出指标。sink label 取值为 http / clickhouse / file，result 为 sent / spilled / replayed / dropped，基数有界。
+
+var (
+	logExportRecords = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "log_export", Name: "records_total",
+		Help: "Number of consume/error logs handled by the log exporter, by sink and result.",
+	}, []string{"sink", "result"})
+	logExportSendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "log_export", Name: "send_duration_seconds",
+		Help:    "Latency of a single batch delivery to the log export sink.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"sink", "outcome"})
+)
+
+func registerLogExportMetrics() {
+	Registry().MustRegister(logExportRecords, logExportSendDuration)
+}
+
+// AddLogExportRecords 累加日志导出的条数，由 common/logexport 调用。
+func AddLogExportRecords(sink, result string, n int) {
+	if !Enabled() || n <= 0 {
+		return
+	}
+	logExportRecords.WithLabelValues(sink, result).Add(float64(n))
+}
+
+// ObserveLogExportSend 记录一次批量投递的耗时。
+func ObserveLogExportSend(sink string, seconds float64, ok bool) {
+	if !Enabled() {
+		return
+	}
+	outcome := "success"
+	if !ok {
+		outcome = "error"
+	}
+	logExportSendDuration.WithLabelValues(sink, outcome).Observe(seconds)
+}
@@ -66,7 +66,7 @@ func Registry() *prometheus.Registry {
 	return registry
 }
 
-// RegisterBusinessMetrics 注册 P1 的业务指标（模型维度 + 渠道维度）。
+// RegisterBusinessMetrics 注册 P1 的业务指标（模型维度 + 渠道维度 + 审计脱敏命中 + 日志导出）。
 // 由 main.go 在启动时调用一次。
 //
 // 之所以要显式注册而不是在 var 初始化时自动注册：注册顺序需要在 Enabled() 可判定之后，
@@ -84,4 +84,6 @@ func RegisterBusinessMetrics() {
 	if config.MetricsChannelEnabled {
 		registerChannelMetrics()
 	}
+	registerAuditMetrics()
+	registerLogExportMetrics()
 }
@@ -0,0 +1,180 @@
+// Package objstore 本地磁盘与 S3 兼容存储（AWS S3、MinIO 等）的最小对象存储抽象，
+// 供审计 file 后端和日志归档共用。
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Store 对象存储，key 一律使用 / 分隔
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List 返回以 prefix 开头的全部 key，按字典序排列
+	List(ctx context.Context, prefix string) ([]string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+type localObjectStore struct {
+	root string
+	seq  int64
+}
+
+// NewLocal 以 root 为根目录的本地存储，目录在首次写入时创建
+func NewLocal(root string) Store {
+	return &localObjectStore{root: root}
+}
+
+func (s *localObjectStore) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+// Put 先写临时文件再 rename，扫描时不会读到写了一半的文件
+func (s *localObjectStore) Put(_ context.Context, key string, data []byte) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmpPath := fmt.Sprintf("%s.%d.%d.tmp", path, time.Now().UnixNano(), atomic.AddInt64(&s.seq, 1))
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+func (s *localObjectStore) Get(_ context.Context, key string) ([]byte, error) {
+	return os.ReadFile(s.path(key))
+}
+
+func (s *localObjectStore) List(_ context.Context, prefix string) ([]string, error) {
+	// 只遍历 prefix 所在的目录，避免每次扫描整个存储根目录
+	dir := s.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = s.path(prefix[:i])
+	}
+	var keys []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return keys, err
+}
+
+func (s *localObjectStore) Delete(_ context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// s3ObjectStore 任意 S3 兼容存储；配置了 endpoint 时使用 path-style 访问（MinIO 默认要求）
+type s3ObjectStore struct {
+	client *s3.Client
+	bucket string
+}
+
+// S3Config S3 兼容存储的连接参数，Region 为空时使用 us-east-1
+type S3Config struct {
+	Region    string
+	AccessKey string
+	SecretKey string
+	Endpoint  string
+	Bucket    string
+}
+
+func NewS3(cfg S3Config) Store {
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	opts := aws.Config{
+		Region:      region,
+		Credentials: aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, "")),
+	}
+	client := s3.NewFromConfig(opts, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return &s3ObjectStore{client: client, bucket: cfg.Bucket}
+}
+
+func (s *s3ObjectStore) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+func (s *s3ObjectStore) Get(ctx context.Context, key string) ([]byte, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+func (s *s3ObjectStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *s3ObjectStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	return err
+}
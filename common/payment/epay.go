@@ -0,0 +1,128 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Calcium-Ion/go-epay/epay"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+const ProviderEpay = "epay"
+
+type epayProvider struct{}
+
+func (epayProvider) Name() string { return ProviderEpay }
+
+func (epayProvider) Enabled() (bool, string) {
+	if !config.EpayPaymentEnabled {
+		return false, "管理员未开启易支付"
+	}
+	if config.EpayPayAddress == "" {
+		return false, "当前管理员未配置支付地址"
+	}
+	if config.EpayId == "" {
+		return false, "当前管理员未配置易支付 PID"
+	}
+	if config.EpayKey == "" {
+		return false, "当前管理员未配置易支付密钥"
+	}
+	return true, ""
+}
+
+func (epayProvider) Quote(amount int64) (float64, string) {
+	return float64(amount) * config.EpayPrice, "CNY"
+}
+
+func newEpayClient() (*epay.Client, error) {
+	if config.EpayPayAddress == "" || config.EpayId == "" || config.EpayKey == "" {
+		return nil, errors.New("当前管理员未配置支付信息")
+	}
+	return epay.NewClient(&epay.Config{
+		PartnerID: config.EpayId,
+		Key:       config.EpayKey,
+	}, config.EpayPayAddress)
+}
+
+func (epayProvider) CreateOrder(_ context.Context, order *Order) (*CreateResult, error) {
+	client, err := newEpayClient()
+	if err != nil {
+		return nil, err
+	}
+	returnUrl, err := url.Parse(order.ReturnURL)
+	if err != nil {
+		return nil, err
+	}
+	notifyUrl, err := url.Parse(order.NotifyURL)
+	if err != nil {
+		return nil, err
+	}
+	method := order.Method
+	if method == "" {
+		method = "alipay"
+	}
+	uri, params, err := client.Purchase(&epay.PurchaseArgs{
+		Type:           method,
+		ServiceTradeNo: order.TradeNo,
+		Name:           fmt.Sprintf("充值%d额度", order.Amount),
+		Money:          strconv.FormatFloat(order.Money, 'f', 2, 64),
+		Device:         epay.PC,
+		NotifyUrl:      notifyUrl,
+		ReturnUrl:      returnUrl,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &CreateResult{PayURL: uri, Params: params}, nil
+}
+
+// VerifyCallback 易支付回调参数在 POST 表单或 GET 查询串中，应答 success 表示已处理
+func (epayProvider) VerifyCallback(r *http.Request) (*CallbackResult, error) {
+	values := r.URL.Query()
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		values = r.PostForm
+	}
+	params := make(map[string]string, len(values))
+	for key := range values {
+		params[key] = values.Get(key)
+	}
+	if len(params) == 0 {
+		return nil, errors.New("易支付回调参数为空")
+	}
+	client, err := newEpayClient()
+	if err != nil {
+		return nil, err
+	}
+	verifyInfo, err := client.Verify(params)
+	if err != nil || !verifyInfo.VerifyStatus {
+		return nil, errors.New("易支付回调签名验证失败")
+	}
+	if verifyInfo.TradeStatus != epay.StatusTradeSuccess {
+		return nil, fmt.Errorf("易支付异常回调: %s", verifyInfo.TradeStatus)
+	}
+	return &CallbackResult{
+		TradeNo:     verifyInfo.ServiceTradeNo,
+		Status:      StatusSuccess,
+		ProviderRef: verifyInfo.TradeNo,
+		Ack:         "success",
+	}, nil
+}
+
+func (epayProvider) QueryStatus(context.Context, *Order) (*CallbackResult, error) {
+	return nil, ErrNotSupported
+}
+
+func (epayProvider) Refund(context.Context, *Order) error {
+	return ErrNotSupported
+}
+
+func init() {
+	Register(epayProvider{})
+}
@@ -0,0 +1,111 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/env"
+)
+
+const ProviderFake = "fake"
+
+// FakeEnabled 本地联调用的假网关，只能通过环境变量开启，不会出现在管理后台
+var FakeEnabled = env.Bool("PAYMENT_FAKE_ENABLED", false)
+
+// FakeProvider 进程内的假网关：下单后访问 PayURL 即视为付款成功，并以签名回调走与真实网关相同的入账路径
+type FakeProvider struct {
+	key    []byte
+	lock   sync.Mutex
+	orders map[string]Status
+}
+
+func NewFakeProvider() *FakeProvider {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	return &FakeProvider{key: key, orders: map[string]Status{}}
+}
+
+func (p *FakeProvider) Name() string { return ProviderFake }
+
+func (p *FakeProvider) Enabled() (bool, string) {
+	if !FakeEnabled {
+		return false, "未开启假支付网关"
+	}
+	return true, ""
+}
+
+func (p *FakeProvider) Quote(amount int64) (float64, string) {
+	return float64(amount), "USD"
+}
+
+func (p *FakeProvider) sign(tradeNo string, status Status) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(tradeNo + "|" + string(status)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *FakeProvider) CreateOrder(_ context.Context, order *Order) (*CreateResult, error) {
+	p.lock.Lock()
+	p.orders[order.TradeNo] = StatusPending
+	p.lock.Unlock()
+	return &CreateResult{
+		PayURL:      config.ServerAddress + "/api/payment/fake/checkout?trade_no=" + url.QueryEscape(order.TradeNo),
+		ProviderRef: "fake_" + order.TradeNo,
+	}, nil
+}
+
+// Settle 模拟用户在网关完成付款（或付款失败），返回应投递到 notify 地址的签名回调参数
+func (p *FakeProvider) Settle(tradeNo string, status Status) (url.Values, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.orders[tradeNo] != StatusPending {
+		return nil, errors.New("订单不存在或已支付")
+	}
+	p.orders[tradeNo] = status
+	return url.Values{
+		"trade_no": {tradeNo},
+		"status":   {string(status)},
+		"sign":     {p.sign(tradeNo, status)},
+	}, nil
+}
+
+func (p *FakeProvider) VerifyCallback(r *http.Request) (*CallbackResult, error) {
+	query := r.URL.Query()
+	tradeNo, status := query.Get("trade_no"), Status(query.Get("status"))
+	if !hmac.Equal([]byte(query.Get("sign")), []byte(p.sign(tradeNo, status))) {
+		return nil, errors.New("假网关回调签名错误")
+	}
+	return &CallbackResult{TradeNo: tradeNo, Status: status, ProviderRef: "fake_" + tradeNo, Ack: "success"}, nil
+}
+
+func (p *FakeProvider) QueryStatus(_ context.Context, order *Order) (*CallbackResult, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	status, ok := p.orders[order.TradeNo]
+	if !ok {
+		return nil, errors.New("订单不存在")
+	}
+	return &CallbackResult{TradeNo: order.TradeNo, Status: status, ProviderRef: "fake_" + order.TradeNo}, nil
+}
+
+func (p *FakeProvider) Refund(_ context.Context, order *Order) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.orders[order.TradeNo] != StatusSuccess {
+		return errors.New("订单未支付，不能退款")
+	}
+	p.orders[order.TradeNo] = StatusRefunded
+	return nil
+}
+
+func init() {
+	Register(NewFakeProvider())
+}
@@ -0,0 +1,117 @@
+// Package payment 定义支付渠道适配接口。适配器只负责与网关交互（下单、验签、查单、退款），
+// 订单状态机与入账统一在 model 层的 TopUp 上完成，新增网关只需实现 Provider 并注册。
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// Status 网关侧的订单状态，由 model 层映射到 TopUp 状态机
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusSuccess  Status = "success"
+	StatusFailed   Status = "failed"
+	StatusExpired  Status = "expired"
+	StatusRefunded Status = "refunded"
+)
+
+var (
+	ErrNotSupported = errors.New("payment: operation not supported by this provider")
+	// ErrIgnored 回调合法但与充值订单无关（如 Stripe 的其它事件），调用方应正常应答网关
+	ErrIgnored = errors.New("payment: callback ignored")
+)
+
+// Order 下单、查单、退款时传给适配器的订单信息
+type Order struct {
+	TradeNo     string
+	UserId      int
+	Amount      int64   // 充值数量，与 TopUp.Amount 同单位
+	Money       float64 // 应付金额
+	Currency    string
+	Method      string // 网关内的支付方式，如易支付的 alipay / wxpay
+	Product     string // 网关侧的商品或价格 ID，为空时使用渠道默认配置
+	ProviderRef string // 下单时网关返回的引用，如 Stripe Checkout Session ID
+	ReturnURL   string
+	NotifyURL   string
+}
+
+// CreateResult 下单结果：PayURL 供前端跳转，Params 为需要表单提交的网关参数
+type CreateResult struct {
+	PayURL      string
+	Params      map[string]string
+	ProviderRef string
+}
+
+// CallbackResult 验签后的回调或查单结果
+type CallbackResult struct {
+	TradeNo     string
+	Status      Status
+	Money       float64 // 实付金额，0 表示沿用订单金额
+	Currency    string
+	ProviderRef string
+	// 以下字段仅用于回调时才建单的网关（如加密货币地址收款）
+	UserId int
+	Quota  int64
+	// Raw 网关回调的原始参数，model 层据此写入渠道专属的明细记录（如加密货币账单）
+	Raw url.Values
+	// Ack 需要回写给网关的应答内容，为空时返回 200 即可
+	Ack string
+}
+
+// Provider 支付渠道适配器
+type Provider interface {
+	Name() string
+	// Enabled 返回是否可用，不可用时给出原因
+	Enabled() (bool, string)
+	// Quote 充值 amount 需要支付的金额与币种
+	Quote(amount int64) (float64, string)
+	CreateOrder(ctx context.Context, order *Order) (*CreateResult, error)
+	VerifyCallback(r *http.Request) (*CallbackResult, error)
+	QueryStatus(ctx context.Context, order *Order) (*CallbackResult, error)
+	// Refund 全额退款
+	Refund(ctx context.Context, order *Order) error
+}
+
+var (
+	providersLock sync.RWMutex
+	providers     = map[string]Provider{}
+)
+
+// Register 注册适配器，同名覆盖（测试中用于替换为假网关）
+func Register(p Provider) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	providers[p.Name()] = p
+}
+
+func Unregister(name string) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	delete(providers, name)
+}
+
+func Get(name string) (Provider, bool) {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+	p, ok := providers[name]
+	return p, ok
+}
+
+// All 按名称排序返回全部已注册的适配器
+func All() []Provider {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+	list := make([]Provider, 0, len(providers))
+	for _, p := range providers {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
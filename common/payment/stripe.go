@@ -0,0 +1,300 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/stripe/stripe-go/v78"
+	"github.com/stripe/stripe-go/v78/checkout/session"
+	"github.com/stripe/stripe-go/v78/paymentlink"
+	"github.com/stripe/stripe-go/v78/refund"
+	"github.com/stripe/stripe-go/v78/webhook"
+)
+
+const (
+	ProviderStripe = "stripe"
+	// ProviderStripeLink 旧版按充值档位生成的 Stripe Payment Link，使用独立的密钥与回调地址
+	ProviderStripeLink = "stripe_link"
+)
+
+// https://docs.stripe.com/currencies#minor-units 零小数货币
+var stripeZeroDecimal = map[string]bool{
+	"bif": true, "clp": true, "djf": true, "gnf": true, "jpy": true,
+	"kmf": true, "krw": true, "mga": true, "pyg": true, "rwf": true,
+	"ugx": true, "vnd": true, "vuv": true, "xaf": true, "xof": true, "xpf": true,
+}
+
+// StripeMinorToMajor 将 Stripe 金额（最小货币单位）转为主单位金额
+func StripeMinorToMajor(amount int64, currency string) float64 {
+	if stripeZeroDecimal[strings.ToLower(strings.TrimSpace(currency))] {
+		return float64(amount)
+	}
+	return float64(amount) / 100.0
+}
+
+func readStripeEvent(r *http.Request, secret string) (stripe.Event, error) {
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		return stripe.Event{}, err
+	}
+	return webhook.ConstructEventWithOptions(payload, r.Header.Get("Stripe-Signature"), secret, webhook.ConstructEventOptions{
+		IgnoreAPIVersionMismatch: true,
+	})
+}
+
+// stripeRefund 全额退款；ref 可以是 Checkout Session 或 PaymentIntent
+func stripeRefund(secret string, ref string) error {
+	if ref == "" {
+		return errors.New("订单缺少 Stripe 支付引用，无法退款")
+	}
+	stripe.Key = secret
+	// 从 charge_orders 补建的旧订单记录的是 Charge ID
+	if strings.HasPrefix(ref, "ch_") {
+		_, err := refund.New(&stripe.RefundParams{Charge: stripe.String(ref)})
+		return err
+	}
+	paymentIntent := ref
+	if strings.HasPrefix(ref, "cs_") {
+		s, err := session.Get(ref, nil)
+		if err != nil {
+			return err
+		}
+		if s.PaymentIntent == nil || s.PaymentIntent.ID == "" {
+			return errors.New("该 Checkout 未产生付款")
+		}
+		paymentIntent = s.PaymentIntent.ID
+	}
+	_, err := refund.New(&stripe.RefundParams{PaymentIntent: stripe.String(paymentIntent)})
+	return err
+}
+
+// stripeRefundedCharge 全额退款的 charge.refunded 事件映射为订单退款，部分退款不改变订单状态
+func stripeRefundedCharge(event stripe.Event, tradeNoKey string) (*CallbackResult, error) {
+	var charge stripe.Charge
+	if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+		return nil, err
+	}
+	tradeNo := charge.Metadata[tradeNoKey]
+	if tradeNo == "" || !charge.Refunded {
+		return nil, ErrIgnored
+	}
+	return &CallbackResult{TradeNo: tradeNo, Status: StatusRefunded}, nil
+}
+
+type stripeProvider struct{}
+
+func (stripeProvider) Name() string { return ProviderStripe }
+
+func (stripeProvider) Enabled() (bool, string) {
+	if !config.StripePaymentEnabled {
+		return false, "管理员未开启 Stripe 支付"
+	}
+	if config.StripeApiSecret == "" {
+		return false, "当前管理员未配置 Stripe API Secret"
+	}
+	if config.StripeWebhookSecret == "" {
+		return false, "当前管理员未配置 Stripe Webhook Secret"
+	}
+	if config.StripePriceId == "" {
+		return false, "当前管理员未配置 Stripe Price ID"
+	}
+	return true, ""
+}
+
+func (stripeProvider) Quote(amount int64) (float64, string) {
+	return float64(amount) * config.StripeUnitPrice, "USD"
+}
+
+func (stripeProvider) CreateOrder(_ context.Context, order *Order) (*CreateResult, error) {
+	if !strings.HasPrefix(config.StripeApiSecret, "sk_") && !strings.HasPrefix(config.StripeApiSecret, "rk_") {
+		return nil, fmt.Errorf("无效的 Stripe API 密钥")
+	}
+	stripe.Key = config.StripeApiSecret
+	price := order.Product
+	if price == "" {
+		price = config.StripePriceId
+	}
+	params := &stripe.CheckoutSessionParams{
+		ClientReferenceID: stripe.String(order.TradeNo),
+		SuccessURL:        stripe.String(order.ReturnURL),
+		CancelURL:         stripe.String(order.ReturnURL),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				Price:    stripe.String(price),
+				Quantity: stripe.Int64(order.Amount),
+			},
+		},
+		Mode:                stripe.String(string(stripe.CheckoutSessionModePayment)),
+		AllowPromotionCodes: stripe.Bool(config.StripePromotionCodesEnabled),
+		CustomerCreation:    stripe.String(string(stripe.CheckoutSessionCustomerCreationAlways)),
+		// 退款事件只带 PaymentIntent，把订单号写进 metadata 才能对应回订单
+		PaymentIntentData: &stripe.CheckoutSessionPaymentIntentDataParams{
+			Metadata: map[string]string{"trade_no": order.TradeNo},
+		},
+	}
+	result, err := session.New(params)
+	if err != nil {
+		return nil, err
+	}
+	return &CreateResult{PayURL: result.URL, ProviderRef: result.ID}, nil
+}
+
+// StripeCheckoutResult 把充值相关的 Stripe 事件映射为订单结果，其它事件返回 ErrIgnored。
+// 订阅、绑卡等事件由调用方在同一个 Webhook 中另行处理。
+func StripeCheckoutResult(event stripe.Event) (*CallbackResult, error) {
+	switch event.Type {
+	case stripe.EventTypeCheckoutSessionCompleted, stripe.EventTypeCheckoutSessionExpired:
+		if event.GetObjectValue("mode") != string(stripe.CheckoutSessionModePayment) {
+			return nil, ErrIgnored
+		}
+		tradeNo := event.GetObjectValue("client_reference_id")
+		if tradeNo == "" {
+			return nil, errors.New("Stripe Webhook 未提供 client_reference_id")
+		}
+		result := &CallbackResult{TradeNo: tradeNo, ProviderRef: event.GetObjectValue("id"), Status: StatusExpired}
+		if event.Type == stripe.EventTypeCheckoutSessionExpired {
+			return result, nil
+		}
+		if status := event.GetObjectValue("status"); status != "complete" {
+			return nil, fmt.Errorf("Stripe Checkout 状态异常: %s, 订单: %s", status, tradeNo)
+		}
+		result.Status = StatusSuccess
+		currency := event.GetObjectValue("currency")
+		if amountTotal, err := strconv.ParseInt(event.GetObjectValue("amount_total"), 10, 64); err == nil {
+			result.Money = StripeMinorToMajor(amountTotal, currency)
+			result.Currency = strings.ToUpper(strings.TrimSpace(currency))
+		}
+		return result, nil
+	case stripe.EventTypeChargeRefunded:
+		return stripeRefundedCharge(event, "trade_no")
+	}
+	return nil, ErrIgnored
+}
+
+func (stripeProvider) VerifyCallback(r *http.Request) (*CallbackResult, error) {
+	event, err := readStripeEvent(r, config.StripeWebhookSecret)
+	if err != nil {
+		return nil, err
+	}
+	return StripeCheckoutResult(event)
+}
+
+func (stripeProvider) QueryStatus(_ context.Context, order *Order) (*CallbackResult, error) {
+	if !strings.HasPrefix(order.ProviderRef, "cs_") {
+		return nil, errors.New("订单缺少 Checkout Session，无法查询")
+	}
+	stripe.Key = config.StripeApiSecret
+	s, err := session.Get(order.ProviderRef, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := &CallbackResult{TradeNo: order.TradeNo, ProviderRef: s.ID, Status: StatusPending}
+	switch {
+	case s.Status == stripe.CheckoutSessionStatusComplete && s.PaymentStatus == stripe.CheckoutSessionPaymentStatusPaid:
+		result.Status = StatusSuccess
+		result.Money = StripeMinorToMajor(s.AmountTotal, string(s.Currency))
+		result.Currency = strings.ToUpper(string(s.Currency))
+	case s.Status == stripe.CheckoutSessionStatusExpired:
+		result.Status = StatusExpired
+	}
+	return result, nil
+}
+
+func (stripeProvider) Refund(_ context.Context, order *Order) error {
+	return stripeRefund(config.StripeApiSecret, order.ProviderRef)
+}
+
+type stripeLinkProvider struct{}
+
+func (stripeLinkProvider) Name() string { return ProviderStripeLink }
+
+func (stripeLinkProvider) Enabled() (bool, string) {
+	if config.StripePrivateKey == "" || config.StripeEndpointSecret == "" {
+		return false, "当前管理员未配置 Stripe Payment Link"
+	}
+	return true, ""
+}
+
+// Quote 按档位定价，amount 即美元金额
+func (stripeLinkProvider) Quote(amount int64) (float64, string) {
+	return float64(amount), "USD"
+}
+
+func (stripeLinkProvider) CreateOrder(_ context.Context, order *Order) (*CreateResult, error) {
+	if order.Product == "" {
+		return nil, errors.New("缺少 Stripe Price ID")
+	}
+	stripe.Key = config.StripePrivateKey
+	params := &stripe.PaymentLinkParams{
+		LineItems: []*stripe.PaymentLinkLineItemParams{
+			{
+				Price:    stripe.String(order.Product),
+				Quantity: stripe.Int64(1),
+			},
+		},
+		PaymentIntentData: &stripe.PaymentLinkPaymentIntentDataParams{
+			Metadata: map[string]string{
+				"userId":     strconv.Itoa(order.UserId),
+				"appOrderId": order.TradeNo,
+			},
+		},
+		Restrictions: &stripe.PaymentLinkRestrictionsParams{
+			CompletedSessions: &stripe.PaymentLinkRestrictionsCompletedSessionsParams{
+				Limit: stripe.Int64(1),
+			},
+		},
+	}
+	result, err := paymentlink.New(params)
+	if err != nil {
+		return nil, err
+	}
+	return &CreateResult{PayURL: result.URL}, nil
+}
+
+func (stripeLinkProvider) VerifyCallback(r *http.Request) (*CallbackResult, error) {
+	event, err := readStripeEvent(r, config.StripeEndpointSecret)
+	if err != nil {
+		return nil, err
+	}
+	switch event.Type {
+	case stripe.EventTypePaymentIntentSucceeded:
+		var intent stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &intent); err != nil {
+			return nil, err
+		}
+		tradeNo := intent.Metadata["appOrderId"]
+		if tradeNo == "" {
+			return nil, ErrIgnored
+		}
+		return &CallbackResult{
+			TradeNo:     tradeNo,
+			Status:      StatusSuccess,
+			Money:       StripeMinorToMajor(intent.AmountReceived, string(intent.Currency)),
+			Currency:    strings.ToUpper(string(intent.Currency)),
+			ProviderRef: intent.ID,
+		}, nil
+	case stripe.EventTypeChargeRefunded:
+		return stripeRefundedCharge(event, "appOrderId")
+	}
+	return nil, ErrIgnored
+}
+
+func (stripeLinkProvider) QueryStatus(context.Context, *Order) (*CallbackResult, error) {
+	return nil, ErrNotSupported
+}
+
+func (stripeLinkProvider) Refund(_ context.Context, order *Order) error {
+	return stripeRefund(config.StripePrivateKey, order.ProviderRef)
+}
+
+func init() {
+	Register(stripeProvider{})
+	Register(stripeLinkProvider{})
+}
@@ -0,0 +1,40 @@
+package common
+
+import "sync/atomic"
+
+// PriceBookOptionKeys 价格簿版本快照涵盖的配置项。
+// 这些配置在内存中的 map 始终等于当前生效版本的内容，GetModelRatio 等取值函数因此按生效版本解析。
+var PriceBookOptionKeys = []string{
+	"ModelRatio",
+	"CompletionRatio",
+	"AudioInputRatio",
+	"AudioOutputRatio",
+	"ImageInputRatio",
+	"ImageOutputRatio",
+	"CacheRatio",
+	"PerCallPricing",
+	"VideoPricingRules",
+}
+
+var activePriceVersion atomic.Value
+
+// GetActivePriceVersion 返回当前内存中价格所对应的价格簿版本号，尚未加载时为空
+func GetActivePriceVersion() string {
+	if v, ok := activePriceVersion.Load().(string); ok {
+		return v
+	}
+	return ""
+}
+
+func SetActivePriceVersion(versionId string) {
+	activePriceVersion.Store(versionId)
+}
+
+func IsPriceBookOptionKey(key string) bool {
+	for _, k := range PriceBookOptionKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
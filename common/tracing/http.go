@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StartUpstream 为一次上游 HTTP 调用创建 client span，返回挂好 span、httptrace 钩子和
+// traceparent 请求头的新请求。
+//
+// 新请求的 context 以 req.Context() 为基础而不是客户端请求的 context：relay 刻意不让客户端
+// 断开取消上游请求（见 relay/channel.DoRequestHelper），这里只借用 parent 的 span。
+func StartUpstream(parent context.Context, req *http.Request, attrs ...attribute.KeyValue) (*http.Request, trace.Span) {
+	_, span := Start(parent, "upstream "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Host),
+		),
+	)
+	if !span.IsRecording() {
+		return req, span
+	}
+	ctx := trace.ContextWithSpan(req.Context(), span)
+	ctx = httptrace.WithClientTrace(ctx, clientTrace(span))
+	req = req.WithContext(ctx)
+	Inject(ctx, req.Header)
+	return req, span
+}
+
+// clientTrace 把连接建立、TLS 握手、首字节到达记成 span 事件，区分慢在建连还是慢在上游处理。
+func clientTrace(span trace.Span) *httptrace.ClientTrace {
+	start := time.Now()
+	since := func() attribute.KeyValue {
+		return attribute.Int64("elapsed_ms", time.Since(start).Milliseconds())
+	}
+	return &httptrace.ClientTrace{
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			span.AddEvent("dns_done", trace.WithAttributes(since()))
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			span.AddEvent("tls_done", trace.WithAttributes(since()))
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			span.AddEvent("connected", trace.WithAttributes(since(), attribute.Bool("reused", info.Reused)))
+		},
+		GotFirstResponseByte: func() {
+			span.AddEvent("first_byte", trace.WithAttributes(since()))
+		},
+	}
+}
+
+// EndUpstream 记录上游响应状态。成功拿到响应时 span 在响应体关闭时才结束，
+// 以覆盖流式响应的传输时长；出错时立即结束。
+func EndUpstream(span trace.Span, resp *http.Response, err error) {
+	if !span.IsRecording() {
+		return
+	}
+	if err != nil || resp == nil || resp.Body == nil {
+		End(span, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	resp.Body = &spanBody{ReadCloser: resp.Body, span: span, start: time.Now()}
+}
+
+type spanBody struct {
+	io.ReadCloser
+	span  trace.Span
+	start time.Time
+	bytes int64
+	once  sync.Once
+}
+
+func (b *spanBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += int64(n)
+	return n, err
+}
+
+func (b *spanBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.span.SetAttributes(
+			attribute.Int64("http.response.body.size", b.bytes),
+			attribute.Int64("body_duration_ms", time.Since(b.start).Milliseconds()),
+		)
+		b.span.End()
+	})
+	return err
+}
@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func setupTestTracer(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return recorder
+}
+
+func TestStartUpstreamPropagatesAndEndsOnBodyClose(t *testing.T) {
+	recorder := setupTestTracer(t)
+	var gotTraceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTraceparent = r.Header.Get("traceparent")
+		w.Write([]byte("data: hello\n\n"))
+	}))
+	defer srv.Close()
+
+	ctx, parent := Start(context.Background(), "POST /v1/chat/completions", trace.WithSpanKind(trace.SpanKindServer))
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, nil)
+	req, span := StartUpstream(ctx, req)
+	resp, err := http.DefaultClient.Do(req)
+	EndUpstream(span, resp, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.Ended()) != 0 {
+		t.Fatalf("响应体未关闭前 upstream span 不应结束")
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	parent.End()
+
+	ended := recorder.Ended()
+	if len(ended) != 2 {
+		t.Fatalf("应记录 upstream 与 server 两个 span, got %d", len(ended))
+	}
+	up := ended[0]
+	if up.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("upstream span 应挂在请求 span 下")
+	}
+	if gotTraceparent == "" || gotTraceparent[36:52] != up.SpanContext().SpanID().String() {
+		t.Errorf("上游应收到指向 upstream span 的 traceparent, got %q", gotTraceparent)
+	}
+	events := map[string]bool{}
+	for _, e := range up.Events() {
+		events[e.Name] = true
+	}
+	if !events["connected"] || !events["first_byte"] {
+		t.Errorf("应记录建连与首字节事件: %v", events)
+	}
+	var size int64
+	for _, a := range up.Attributes() {
+		if a.Key == "http.response.body.size" {
+			size = a.Value.AsInt64()
+		}
+	}
+	if size != int64(len("data: hello\n\n")) {
+		t.Errorf("响应体大小记录错误: %d", size)
+	}
+}
+
+func TestInjectRespectsPropagateSwitch(t *testing.T) {
+	setupTestTracer(t)
+	ctx, span := Start(context.Background(), "x")
+	defer span.End()
+
+	old := config.TracingPropagateUpstream
+	defer func() { config.TracingPropagateUpstream = old }()
+
+	config.TracingPropagateUpstream = false
+	h := http.Header{}
+	Inject(ctx, h)
+	if h.Get("traceparent") != "" {
+		t.Errorf("关闭向上游传播时不应注入 traceparent")
+	}
+	config.TracingPropagateUpstream = true
+	Inject(ctx, h)
+	if h.Get("traceparent") == "" {
+		t.Errorf("开启时应注入 traceparent")
+	}
+}
@@ -0,0 +1,130 @@
+// Package tracing 提供 OpenTelemetry 链路追踪：一次 relay 请求内鉴权、选渠、每次上游尝试、
+// 媒体下载、计费写入、审计提交各自的耗时。
+//
+// 与 common/metrics 一样是 leaf package，只允许 import common/config、common/logger，
+// 以便 model / middleware / relay 都能埋点而不形成循环依赖。
+//
+// 关闭时（默认）全局 TracerProvider 是 otel 自带的 noop 实现，Start 返回不记录的 span，
+// 埋点处无需判断开关；传播器同样是 noop，不会向上游注入任何请求头。
+//
+// 约定：
+//   - 服务端 span 由 middleware.Tracing 创建并挂到 c.Request.Context()，其余 span 都从该 context 派生；
+//   - 请求级属性（渠道、模型、令牌数）写在服务端 span 上，便于按属性检索整条链路；
+//   - 只有 user_id / channel_id 等数值 ID 作为属性，不记录 key、请求体等敏感内容。
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const instrumentationName = "github.com/songquanpeng/one-api"
+
+// Enabled 报告链路追踪是否开启。
+func Enabled() bool {
+	return config.TracingEnabled
+}
+
+// Init 创建 OTLP/HTTP 导出器并注册全局 TracerProvider 与 W3C 传播器。
+// 由 main.go 在启动时调用一次，返回的 shutdown 在退出前 flush 未导出的 span。
+func Init(ctx context.Context) (shutdown func(context.Context) error, err error) {
+	shutdown = func(context.Context) error { return nil }
+	if !Enabled() {
+		return shutdown, nil
+	}
+
+	opts := []otlptracehttp.Option{}
+	if strings.Contains(config.TracingEndpoint, "://") {
+		opts = append(opts, otlptracehttp.WithEndpointURL(config.TracingEndpoint))
+	} else {
+		opts = append(opts, otlptracehttp.WithEndpoint(config.TracingEndpoint))
+	}
+	if config.TracingInsecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return shutdown, err
+	}
+
+	ratio := config.TracingSampleRatio
+	if ratio < 0 {
+		ratio = 0
+	} else if ratio > 1 {
+		ratio = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", config.ServiceName),
+			attribute.String("service.instance.id", config.InstanceId),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.SysError("tracing: " + err.Error())
+	}))
+	logger.SysLog("tracing: OTLP exporter enabled, endpoint=" + config.TracingEndpoint)
+	return provider.Shutdown, nil
+}
+
+// Start 从 ctx 派生一个子 span。
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End 结束 span，err 非空时记录错误并把状态置为 Error。
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// SetAttributes 给 ctx 当前的 span 追加属性。
+func SetAttributes(ctx context.Context, attrs ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+}
+
+// AddEvent 在 ctx 当前的 span 上记录一个事件。
+func AddEvent(ctx context.Context, name string, attrs ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).AddEvent(name, trace.WithAttributes(attrs...))
+}
+
+// Extract 从客户端请求头读取 traceparent / baggage。
+func Extract(ctx context.Context, h http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(h))
+}
+
+// Inject 把 ctx 的追踪上下文写入发往上游的请求头。
+func Inject(ctx context.Context, h http.Header) {
+	if !config.TracingPropagateUpstream {
+		return
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(h))
+}
+
+// TraceID 返回 ctx 中 span 的 trace id，未采样或未开启时为空。
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// GetSelfAffiliate 邀请返佣概览：余额与当前返佣规则
+func GetSelfAffiliate(c *gin.Context) {
+	account := model.GetAffiliateAccount(c.GetInt("id"))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"pending_quota":   account.PendingQuota,
+			"available_quota": account.AvailableQuota,
+			"withdrawn_quota": account.WithdrawnQuota,
+			"total_earned":    account.TotalEarned,
+			"percent":         config.AffiliateCommissionPercent,
+			"months":          config.AffiliateCommissionMonths,
+			"cap":             config.AffiliateCommissionCap,
+			"hold_days":       config.AffiliateHoldDays,
+		},
+	})
+}
+
+func GetSelfAffiliateInvitees(c *gin.Context) {
+	page, pageSize := getPageParams(c)
+	invitees, total, err := model.GetAffiliateInvitees(c.GetInt("id"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"list":        invitees,
+			"currentPage": page,
+			"pageSize":    pageSize,
+			"total":       total,
+		},
+	})
+}
+
+func listAffiliateCommissions(c *gin.Context, inviterId int) {
+	page, pageSize := getPageParams(c)
+	commissions, total, err := model.GetAffiliateCommissions(inviterId, c.Query("status"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"list":        commissions,
+			"currentPage": page,
+			"pageSize":    pageSize,
+			"total":       total,
+		},
+	})
+}
+
+func GetSelfAffiliateCommissions(c *gin.Context) {
+	listAffiliateCommissions(c, c.GetInt("id"))
+}
+
+func GetAllAffiliateCommissions(c *gin.Context) {
+	inviterId, _ := strconv.Atoi(c.Query("inviter_id"))
+	listAffiliateCommissions(c, inviterId)
+}
+
+// TransferAffiliateQuota 可提取的返佣转入账户余额
+func TransferAffiliateQuota(c *gin.Context) {
+	var req struct {
+		Quota int64 `json:"quota"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	if err := model.TransferAffiliateQuota(c.GetInt("id"), req.Quota); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
+
+// UpdateAffiliateCommissionStatus 管理员审核返佣：提前放行、拒绝，或在付款退款后收回
+func UpdateAffiliateCommissionStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	var req struct {
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Note) > 255 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	operatorId := c.GetInt("id")
+	var commission *model.AffiliateCommission
+	switch req.Status {
+	case model.AffiliateStatusAvailable:
+		commission, err = model.ApproveAffiliateCommission(id, operatorId)
+	case model.AffiliateStatusRejected:
+		commission, err = model.RejectAffiliateCommission(id, operatorId, req.Note)
+	case model.AffiliateStatusClawedBack:
+		commission, err = model.ClawbackAffiliateCommission(id, operatorId, req.Note)
+	default:
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "status 只能是 available、rejected 或 clawed_back"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": commission})
+}
@@ -136,7 +136,7 @@ func parseAliWanRequest(c *gin.Context) (*aliWanRequest, error) {
 	billing := parseAliWanBillingInfo(body, meta.ActualModelName)
 	quota := common.CalculateVideoQuota(billing.Model, billing.VideoType, "", billing.Duration, billing.Resolution, "")
 
-	userQuota, err := dbmodel.CacheGetUserQuota(c.Request.Context(), meta.UserId)
+	userQuota, err := dbmodel.CacheGetPayerQuota(c.Request.Context(), meta.UserId, meta.OrgId)
 	if err != nil {
 		return nil, fmt.Errorf("get_quota_failed: %w", err)
 	}
@@ -251,6 +251,7 @@ func RelayAliVideoCreate(c *gin.Context) {
 		Status:     "processing",
 		Quota:      req.Quota,
 		UserId:     req.Meta.UserId,
+		OrgId:      req.Meta.OrgId,
 		Username:   dbmodel.GetUsernameById(req.Meta.UserId),
 		ChannelId:  req.Meta.ChannelId,
 		CreatedAt:  time.Now().Unix(),
@@ -390,7 +391,7 @@ func compensateAliWanTask(taskID string, v *dbmodel.Video) {
 	if v.Quota <= 0 {
 		return
 	}
-	if err := dbmodel.IncreaseUserQuota(v.UserId, v.Quota); err != nil {
+	if err := dbmodel.IncreasePayerQuota(v.UserId, v.OrgId, v.Quota); err != nil {
 		logger.Error(ctx, fmt.Sprintf("[ali-wan] compensate quota failed: task_id=%s, user_id=%d, quota=%d, err=%v", taskID, v.UserId, v.Quota, err))
 		return
 	}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/payment"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/stripe/stripe-go/v78"
+	"github.com/stripe/stripe-go/v78/checkout/session"
+	"github.com/stripe/stripe-go/v78/customer"
+	"github.com/stripe/stripe-go/v78/setupintent"
+)
+
+const autoTopUpSetupPurpose = "auto_topup"
+
+func GetSelfAutoTopUp(c *gin.Context) {
+	setting, err := model.GetAutoTopUpSetting(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{"enabled": false, "has_payment_method": false}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"enabled":            setting.Enabled,
+			"threshold_quota":    setting.ThresholdQuota,
+			"amount":             setting.Amount,
+			"daily_max_amount":   setting.DailyMaxAmount,
+			"has_payment_method": setting.PaymentMethod != "",
+			"card_summary":       setting.CardSummary,
+			"failure_count":      setting.FailureCount,
+			"last_error":         setting.LastError,
+			"last_charge_time":   setting.LastChargeTime,
+		},
+	})
+}
+
+func UpdateSelfAutoTopUp(c *gin.Context) {
+	var req struct {
+		Enabled        bool  `json:"enabled"`
+		ThresholdQuota int64 `json:"threshold_quota"`
+		Amount         int64 `json:"amount"`
+		DailyMaxAmount int64 `json:"daily_max_amount"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "参数错误"})
+		return
+	}
+	if req.Enabled && !config.StripePaymentEnabled {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "管理员未开启 Stripe 支付"})
+		return
+	}
+	if err := model.SaveAutoTopUpRule(c.GetInt("id"), req.Enabled, req.ThresholdQuota, req.Amount, req.DailyMaxAmount); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
+
+// RequestAutoTopUpSetup 拉起 setup 模式的 Checkout 绑定支付方式，不产生扣款
+func RequestAutoTopUpSetup(c *gin.Context) {
+	if enabled, reason := getPaymentAvailability(payment.ProviderStripe); !enabled {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": reason})
+		return
+	}
+	userId := c.GetInt("id")
+	stripe.Key = config.StripeApiSecret
+
+	customerId := ""
+	if setting, err := model.GetAutoTopUpSetting(userId); err == nil {
+		customerId = setting.CustomerId
+	}
+	if customerId == "" {
+		customerId = model.GetUserStripeCustomerId(userId)
+	}
+	if customerId == "" {
+		params := &stripe.CustomerParams{}
+		if email, err := model.GetUserEmail(userId); err == nil && email != "" {
+			params.Email = stripe.String(email)
+		}
+		params.AddMetadata("user_id", strconv.Itoa(userId))
+		result, err := customer.New(params)
+		if err != nil {
+			log.Printf("创建 Stripe Customer 失败: %v\n", err)
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": "拉起绑卡失败"})
+			return
+		}
+		customerId = result.ID
+	}
+
+	returnURL := getPaymentReturnURL()
+	params := &stripe.CheckoutSessionParams{
+		Mode:               stripe.String(string(stripe.CheckoutSessionModeSetup)),
+		Customer:           stripe.String(customerId),
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		SuccessURL:         stripe.String(returnURL),
+		CancelURL:          stripe.String(returnURL),
+	}
+	params.AddMetadata("user_id", strconv.Itoa(userId))
+	params.AddMetadata("purpose", autoTopUpSetupPurpose)
+	result, err := session.New(params)
+	if err != nil {
+		log.Printf("创建 Stripe 绑卡 Checkout 失败: %v\n", err)
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "拉起绑卡失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{"pay_link": result.URL}})
+}
+
+// stripeAutoTopUpSetupCompleted 绑卡完成：取 SetupIntent 上的支付方式保存到自动充值设置
+func stripeAutoTopUpSetupCompleted(event stripe.Event) {
+	if event.GetObjectValue("metadata", "purpose") != autoTopUpSetupPurpose {
+		return
+	}
+	userId, _ := strconv.Atoi(event.GetObjectValue("metadata", "user_id"))
+	setupIntentId := event.GetObjectValue("setup_intent")
+	customerId := event.GetObjectValue("customer")
+	if userId == 0 || setupIntentId == "" {
+		log.Printf("Stripe 绑卡回调缺少 user_id 或 setup_intent: %s\n", event.ID)
+		return
+	}
+	stripe.Key = config.StripeApiSecret
+	params := &stripe.SetupIntentParams{}
+	params.AddExpand("payment_method")
+	intent, err := setupintent.Get(setupIntentId, params)
+	if err != nil || intent.PaymentMethod == nil {
+		log.Printf("读取 Stripe SetupIntent 失败: %s, %v\n", setupIntentId, err)
+		return
+	}
+	cardSummary := ""
+	if card := intent.PaymentMethod.Card; card != nil {
+		cardSummary = string(card.Brand) + " ****" + card.Last4
+	}
+	if err := model.SaveAutoTopUpPaymentMethod(userId, customerId, intent.PaymentMethod.ID, cardSummary); err != nil {
+		log.Printf("保存自动充值支付方式失败: userId=%d, %v\n", userId, err)
+	}
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func GetChannelCosts(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Query("channel_id"))
+	costs, err := model.GetChannelCosts(channelId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": costs})
+}
+
+func AddChannelCost(c *gin.Context) {
+	cost := model.ChannelCost{}
+	if err := c.ShouldBindJSON(&cost); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数: " + err.Error()})
+		return
+	}
+	cost.Id = 0
+	if err := model.CreateChannelCost(&cost); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": cost})
+}
+
+func UpdateChannelCost(c *gin.Context) {
+	cost := model.ChannelCost{}
+	if err := c.ShouldBindJSON(&cost); err != nil || cost.Id == 0 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	if _, err := model.GetChannelCostById(cost.Id); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if err := model.UpdateChannelCost(&cost); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": cost})
+}
+
+func DeleteChannelCost(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	if err := model.DeleteChannelCost(id); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
+
+// GetMarginReport 营收、上游成本与毛利报表，group_by 为 channel / model / user / day / tag:<key>
+func GetMarginReport(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	channelId, _ := strconv.Atoi(c.Query("channel"))
+	groupBy := c.DefaultQuery("group_by", model.MarginGroupChannel)
+	items, err := model.GetMarginReport(model.MarginReportFilter{
+		GroupBy:        groupBy,
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		ChannelId:      channelId,
+		ModelName:      c.Query("model_name"),
+		Username:       c.Query("username"),
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": items})
+}
+
+// GetBelowCostModels 时间范围内亏本售卖的渠道模型
+func GetBelowCostModels(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	items, err := model.GetBelowCostModels(startTimestamp, endTimestamp)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": items})
+}
@@ -0,0 +1,394 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// OpenAI 组织 costs 接口：https://platform.openai.com/docs/api-reference/usage/costs
+type openAIOrganizationCostsResponse struct {
+	Data []struct {
+		Results []struct {
+			Amount struct {
+				Value    float64 `json:"value"`
+				Currency string  `json:"currency"`
+			} `json:"amount"`
+		} `json:"results"`
+	} `json:"data"`
+	HasMore  bool   `json:"has_more"`
+	NextPage string `json:"next_page"`
+}
+
+// Anthropic cost_report 接口，amount 为最小货币单位（美分）的十进制字符串
+type anthropicCostReportResponse struct {
+	Data []struct {
+		Results []struct {
+			Amount   string `json:"amount"`
+			Currency string `json:"currency"`
+		} `json:"results"`
+	} `json:"data"`
+	HasMore  bool   `json:"has_more"`
+	NextPage string `json:"next_page"`
+}
+
+// reconcileMaxPages 分页接口的最大翻页数，防止上游异常返回 has_more 时死循环
+const reconcileMaxPages = 50
+
+func getReconcileSource(channel *model.Channel, settings config.ChannelOtherSettings) string {
+	if settings.ReconcileSource != "" {
+		return settings.ReconcileSource
+	}
+	if settings.ReconcileUsageURL != "" {
+		return model.ReconcileSourceCustom
+	}
+	switch channel.Type {
+	case common.ChannelTypeOpenAI:
+		return model.ReconcileSourceOpenAI
+	case common.ChannelTypeAnthropic:
+		return model.ReconcileSourceAnthropic
+	}
+	return model.ReconcileSourceBalance
+}
+
+func getReconcileBaseURL(channel *model.Channel) string {
+	if channel.GetBaseURL() != "" {
+		return strings.TrimRight(channel.GetBaseURL(), "/")
+	}
+	return common.ChannelBaseURLs[channel.Type]
+}
+
+// getReconcileKeys 逐 Key 对账；组织用量接口配置了管理员密钥时整个渠道只查一次
+func getReconcileKeys(channel *model.Channel, settings config.ChannelOtherSettings, source string) map[int]string {
+	if settings.ReconcileAdminKey != "" && (source == model.ReconcileSourceOpenAI || source == model.ReconcileSourceAnthropic) {
+		return map[int]string{0: settings.ReconcileAdminKey}
+	}
+	if !channel.MultiKeyInfo.IsMultiKey {
+		return map[int]string{0: channel.Key}
+	}
+	keys := make(map[int]string)
+	for i, key := range channel.ParseKeys() {
+		if channel.GetKeyStatus(i) == common.ChannelStatusEnabled {
+			keys[i] = key
+		}
+	}
+	return keys
+}
+
+func fetchOpenAIOrganizationCosts(baseURL string, key string, start, end int64) (float64, error) {
+	total := 0.0
+	page := ""
+	for i := 0; i < reconcileMaxPages; i++ {
+		u := fmt.Sprintf("%s/v1/organization/costs?start_time=%d&end_time=%d&bucket_width=1d&limit=31", baseURL, start, end)
+		if page != "" {
+			u += "&page=" + url.QueryEscape(page)
+		}
+		body, err := GetResponseBody("GET", u, nil, GetAuthHeader(key))
+		if err != nil {
+			return 0, err
+		}
+		response := openAIOrganizationCostsResponse{}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return 0, err
+		}
+		for _, bucket := range response.Data {
+			for _, result := range bucket.Results {
+				if result.Amount.Currency != "" && !strings.EqualFold(result.Amount.Currency, "usd") {
+					return 0, fmt.Errorf("unsupported currency: %s", result.Amount.Currency)
+				}
+				total += result.Amount.Value
+			}
+		}
+		if !response.HasMore || response.NextPage == "" {
+			return total, nil
+		}
+		page = response.NextPage
+	}
+	return 0, errors.New("too many pages")
+}
+
+func fetchAnthropicCostReport(baseURL string, key string, start, end int64) (float64, error) {
+	headers := http.Header{}
+	headers.Set("x-api-key", key)
+	headers.Set("anthropic-version", "2023-06-01")
+	totalCents := 0.0
+	page := ""
+	for i := 0; i < reconcileMaxPages; i++ {
+		u := fmt.Sprintf("%s/v1/organizations/cost_report?starting_at=%s&ending_at=%s", baseURL,
+			url.QueryEscape(time.Unix(start, 0).UTC().Format(time.RFC3339)), url.QueryEscape(time.Unix(end, 0).UTC().Format(time.RFC3339)))
+		if page != "" {
+			u += "&page=" + url.QueryEscape(page)
+		}
+		body, err := GetResponseBody("GET", u, nil, headers)
+		if err != nil {
+			return 0, err
+		}
+		response := anthropicCostReportResponse{}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return 0, err
+		}
+		for _, bucket := range response.Data {
+			for _, result := range bucket.Results {
+				if result.Currency != "" && !strings.EqualFold(result.Currency, "usd") {
+					return 0, fmt.Errorf("unsupported currency: %s", result.Currency)
+				}
+				cents, err := strconv.ParseFloat(result.Amount, 64)
+				if err != nil {
+					return 0, fmt.Errorf("invalid amount %q", result.Amount)
+				}
+				totalCents += cents
+			}
+		}
+		if !response.HasMore || response.NextPage == "" {
+			return totalCents / 100, nil
+		}
+		page = response.NextPage
+	}
+	return 0, errors.New("too many pages")
+}
+
+// getJSONNumber 按点分路径取 JSON 中的数值，兼容字符串形式的数字
+func getJSONNumber(body []byte, path string) (float64, error) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return 0, err
+	}
+	for _, part := range strings.Split(path, ".") {
+		if part == "" {
+			continue
+		}
+		switch node := value.(type) {
+		case map[string]interface{}:
+			value = node[part]
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(node) {
+				return 0, fmt.Errorf("field %s not found", path)
+			}
+			value = node[index]
+		default:
+			return 0, fmt.Errorf("field %s not found", path)
+		}
+	}
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("field %s is not a number", path)
+}
+
+func fetchCustomUsage(settings config.ChannelOtherSettings, key string, start, end int64) (float64, error) {
+	u := strings.NewReplacer("{start}", strconv.FormatInt(start, 10), "{end}", strconv.FormatInt(end, 10)).Replace(settings.ReconcileUsageURL)
+	body, err := GetResponseBody("GET", u, nil, GetAuthHeader(key))
+	if err != nil {
+		return 0, err
+	}
+	return getJSONNumber(body, settings.ReconcileUsageField)
+}
+
+// fetchReconcileBalance 优先使用自定义余额接口，否则沿用渠道余额查询支持的上游
+func fetchReconcileBalance(channel *model.Channel, settings config.ChannelOtherSettings, key string) (float64, error) {
+	if settings.ReconcileBalanceURL != "" {
+		body, err := GetResponseBody("GET", settings.ReconcileBalanceURL, nil, GetAuthHeader(key))
+		if err != nil {
+			return 0, err
+		}
+		return getJSONNumber(body, settings.ReconcileBalanceField)
+	}
+	keyChannel := *channel
+	keyChannel.Key = key
+	return updateChannelBalance(&keyChannel)
+}
+
+// reconcileChannel 对单个渠道执行一次对账。用量接口按上一个完整的 UTC 自然日对账，
+// 余额数据源按两次余额之差计算上一次对账以来的用量
+func reconcileChannel(channel *model.Channel, now time.Time) (*model.Reconciliation, error) {
+	settings := channel.GetOtherSettings()
+	source := getReconcileSource(channel, settings)
+	record := &model.Reconciliation{ChannelId: channel.Id, Source: source, WindowEnd: now.Unix()}
+	var last *model.Reconciliation
+	if source == model.ReconcileSourceBalance {
+		last = model.GetLastReconciliation(channel.Id)
+		if last != nil {
+			record.WindowStart = last.WindowEnd
+		} else {
+			record.WindowStart = record.WindowEnd
+		}
+	} else {
+		day := now.UTC().Truncate(24 * time.Hour)
+		record.WindowStart, record.WindowEnd = day.Add(-24*time.Hour).Unix(), day.Unix()
+		if model.IsReconciliationDone(channel.Id, record.WindowStart) {
+			return nil, nil
+		}
+	}
+
+	baseURL := getReconcileBaseURL(channel)
+	var details []model.ReconcileKeyDetail
+	var failed []string
+	balances := make(map[int]float64)
+	for index, key := range getReconcileKeys(channel, settings, source) {
+		detail := model.ReconcileKeyDetail{KeyIndex: index}
+		var err error
+		switch source {
+		case model.ReconcileSourceOpenAI:
+			detail.Usage, err = fetchOpenAIOrganizationCosts(baseURL, key, record.WindowStart, record.WindowEnd)
+		case model.ReconcileSourceAnthropic:
+			detail.Usage, err = fetchAnthropicCostReport(baseURL, key, record.WindowStart, record.WindowEnd)
+		case model.ReconcileSourceCustom:
+			detail.Usage, err = fetchCustomUsage(settings, key, record.WindowStart, record.WindowEnd)
+		case model.ReconcileSourceBalance:
+			var balance float64
+			balance, err = fetchReconcileBalance(channel, settings, key)
+			if err == nil {
+				detail.Balance = &balance
+				balances[index] = balance
+				record.UpstreamBalance += balance
+			}
+		default:
+			err = fmt.Errorf("unknown reconcile source: %s", source)
+		}
+		if err != nil {
+			detail.Error = err.Error()
+			failed = append(failed, fmt.Sprintf("key#%d: %s", index, err.Error()))
+		}
+		record.UpstreamUsage += detail.Usage
+		details = append(details, detail)
+	}
+	if data, err := json.Marshal(details); err == nil {
+		record.KeyDetails = string(data)
+	}
+	if len(failed) > 0 {
+		record.Status = model.ReconcileStatusError
+		record.Message = strings.Join(failed, "; ")
+	} else if source == model.ReconcileSourceBalance {
+		channel.UpdateBalance(record.UpstreamBalance)
+		if err := channel.UpdateKeyBalances(balances); err != nil {
+			logger.SysError(fmt.Sprintf("failed to update key balances of channel %d: %s", channel.Id, err.Error()))
+		}
+		switch {
+		case last == nil:
+			record.Status = model.ReconcileStatusOk
+			record.Message = "首次记录余额基线"
+		case record.UpstreamBalance > last.UpstreamBalance:
+			// 余额增加说明期间有充值，无法区分充值与消耗，本窗口只更新基线
+			record.Status = model.ReconcileStatusOk
+			record.Message = "余额增加，本窗口跳过比对"
+		default:
+			record.UpstreamUsage = last.UpstreamBalance - record.UpstreamBalance
+		}
+	}
+	if _, err := model.SaveReconciliation(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+var reconcileTaskOnce sync.Once
+
+func runReconciliationOnce() {
+	channels, err := model.GetAllChannels(0, 0, "all")
+	if err != nil {
+		logger.SysError("reconciliation: failed to load channels: " + err.Error())
+		return
+	}
+	now := time.Now()
+	for _, channel := range channels {
+		if channel.Status != common.ChannelStatusEnabled || !channel.GetOtherSettings().ReconcileEnabled {
+			continue
+		}
+		record, err := reconcileChannel(channel, now)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("reconciliation: channel %d failed: %s", channel.Id, err.Error()))
+			continue
+		}
+		if record != nil && record.Status != model.ReconcileStatusOk {
+			logger.SysLog(fmt.Sprintf("reconciliation: channel %d status=%s drift=%.4f %s", channel.Id, record.Status, record.Drift, record.Message))
+		}
+	}
+}
+
+// StartReconciliationTask 启动上游账单对账任务（仅 master 节点执行）
+func StartReconciliationTask() {
+	reconcileTaskOnce.Do(func() {
+		if !config.IsMasterNode || config.ReconcileIntervalMinutes <= 0 {
+			return
+		}
+		common.SafeGoroutine(func() {
+			for {
+				runReconciliationOnce()
+				time.Sleep(time.Duration(config.ReconcileIntervalMinutes) * time.Minute)
+			}
+		})
+	})
+}
+
+func GetReconciliations(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	channelId, _ := strconv.Atoi(c.Query("channel_id"))
+	records, total, err := model.GetReconciliations(channelId, c.Query("status"), p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{"list": records, "total": total}})
+}
+
+// RunReconciliation 立即对指定渠道对账，已对账的自然日窗口不会重复执行
+func RunReconciliation(c *gin.Context) {
+	var req struct {
+		ChannelId int `json:"channel_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.ChannelId == 0 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	channel, err := model.GetChannelById(req.ChannelId, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	record, err := reconcileChannel(channel, time.Now())
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if record == nil {
+		c.JSON(http.StatusOK, gin.H{"success": true, "message": "该窗口已对账"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": record})
+}
+
+func ReviewReconciliation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	var req struct {
+		Note string `json:"note"`
+	}
+	_ = c.ShouldBindJSON(&req)
+	if err := model.ReviewReconciliation(id, c.GetInt("id"), req.Note); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
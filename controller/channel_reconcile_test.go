@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFetchOpenAIOrganizationCostsPaginates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk-admin" || r.URL.Query().Get("start_time") != "100" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("page") == "" {
+			fmt.Fprint(w, `{"data":[{"results":[{"amount":{"value":1.25,"currency":"usd"}},{"amount":{"value":0.5,"currency":"usd"}}]}],"has_more":true,"next_page":"p2"}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":[{"results":[{"amount":{"value":2,"currency":"usd"}}]}],"has_more":false,"next_page":null}`)
+	}))
+	defer server.Close()
+
+	total, err := fetchOpenAIOrganizationCosts(server.URL, "sk-admin", 100, 200)
+	if err != nil || total != 3.75 {
+		t.Fatalf("应累加所有分页的费用，实际 %v %v", total, err)
+	}
+}
+
+func TestGetJSONNumber(t *testing.T) {
+	body := []byte(`{"data":{"total_usage":"12.5","items":[{"balance":3}]}}`)
+	if v, err := getJSONNumber(body, "data.total_usage"); err != nil || v != 12.5 {
+		t.Errorf("字符串数字应能解析，实际 %v %v", v, err)
+	}
+	if v, err := getJSONNumber(body, "data.items.0.balance"); err != nil || v != 3 {
+		t.Errorf("应支持数组下标，实际 %v %v", v, err)
+	}
+	if _, err := getJSONNumber(body, "data.missing"); err == nil {
+		t.Error("不存在的字段应报错")
+	}
+}
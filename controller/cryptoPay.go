@@ -5,7 +5,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/config"
-	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/payment"
 	"github.com/songquanpeng/one-api/model"
 )
 
@@ -44,25 +44,7 @@ func GetPayChannel(c *gin.Context) {
 	})
 }
 
+// CryptCallback CryptAPI 回调：签名校验与订单创建由 crypto 适配器和统一订单状态机完成
 func CryptCallback(c *gin.Context) {
-	var response model.CryptCallbackResponse
-	if err := c.ShouldBindQuery(&response); err != nil {
-		logger.Error(c.Request.Context(), "failed to bind crypt callback query: "+err.Error())
-		c.String(http.StatusUnauthorized, err.Error())
-		return
-	}
-	userId := response.UserId
-	username := model.GetUsernameById(userId)
-	err := model.HandleCryptCallback(response, username)
-	if err != nil {
-		logger.Error(c.Request.Context(), "failed to handle crypt callback: "+err.Error())
-		c.String(http.StatusUnauthorized, err.Error())
-		return
-	}
-	err = UserLevelUpgrade(userId)
-	if err != nil {
-		return
-	}
-
-	c.String(http.StatusOK, "ok")
+	handlePaymentNotify(c, payment.ProviderCrypto)
 }
@@ -62,7 +62,7 @@ func RelayDoubaoVideoCreate(c *gin.Context) {
 
 	// 预扣费额度检查
 	quota := doubaomodel.CalcPrePayQuota()
-	userQuota, err := dbmodel.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := dbmodel.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		respondError(c, err, "get_quota_failed", http.StatusInternalServerError)
 		return
@@ -120,7 +120,7 @@ func RelayDoubaoVideoCreate(c *gin.Context) {
 	if err := dbmodel.PostConsumeTokenQuota(meta.TokenId, quota); err != nil {
 		logger.Error(ctx, fmt.Sprintf("[doubao] pre-deduct quota failed: %v", err))
 	}
-	_ = dbmodel.CacheUpdateUserQuota(ctx, meta.UserId)
+	_ = dbmodel.CacheUpdatePayerQuota(ctx, meta.UserId, meta.OrgId)
 
 	// 解析模型和提示词（供 DB 记录）
 	model, prompt := parseDoubaoRequestMeta(body)
@@ -135,6 +135,7 @@ func RelayDoubaoVideoCreate(c *gin.Context) {
 		Status:    "processing",
 		Quota:     quota,
 		UserId:    meta.UserId,
+		OrgId:     meta.OrgId,
 		Username:  dbmodel.GetUsernameById(meta.UserId),
 		ChannelId: meta.ChannelId,
 		CreatedAt: time.Now().Unix(),
@@ -285,7 +286,7 @@ func compensateDoubaoTask(taskID string, v *dbmodel.Video) {
 	if v.Quota <= 0 {
 		return
 	}
-	if err := dbmodel.IncreaseUserQuota(v.UserId, v.Quota); err != nil {
+	if err := dbmodel.IncreasePayerQuota(v.UserId, v.OrgId, v.Quota); err != nil {
 		logger.Error(ctx, fmt.Sprintf("[doubao] compensate quota failed: task_id=%s, user_id=%d, quota=%d, err=%v", taskID, v.UserId, v.Quota, err))
 		return
 	}
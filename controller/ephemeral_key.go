@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+)
+
+type issueEphemeralKeyRequest struct {
+	TTL      int64    `json:"ttl"` // 秒，缺省为 EPHEMERAL_KEY_MAX_TTL 与 600 中的较小值
+	Models   []string `json:"models"`
+	MaxSpend int64    `json:"max_spend"`
+	EndUser  string   `json:"end_user"`
+}
+
+// IssueEphemeralKey 使用常规令牌为前端/终端用户签发短期临时密钥
+func IssueEphemeralKey(c *gin.Context) {
+	if _, ok := c.Get("ephemeral_key"); ok {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "Ephemeral keys cannot issue other ephemeral keys",
+		})
+		return
+	}
+	var req issueEphemeralKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid parameters",
+		})
+		return
+	}
+	if req.TTL == 0 {
+		req.TTL = 600
+		if int64(config.EphemeralKeyMaxTTL) < req.TTL {
+			req.TTL = int64(config.EphemeralKeyMaxTTL)
+		}
+	}
+	parent, err := model.GetTokenByIds(c.GetInt("token_id"), c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	key, claims, err := model.IssueEphemeralKey(parent, req.TTL, req.Models, req.MaxSpend, req.EndUser)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"key":        key,
+			"id":         claims.Id,
+			"expires_at": claims.ExpiresAt,
+			"models":     claims.Models,
+			"max_spend":  claims.MaxSpend,
+			"end_user":   claims.EndUser,
+		},
+	})
+}
+
+// GetEphemeralKeySpend 查询当前临时密钥的已用额度（以临时密钥自身调用）
+func GetEphemeralKeySpend(c *gin.Context) {
+	v, ok := c.Get("ephemeral_key")
+	claims, _ := v.(*model.EphemeralKeyClaims)
+	if !ok || claims == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "This endpoint requires an ephemeral key",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"id":         claims.Id,
+			"spend":      model.GetEphemeralKeySpend(claims.Id),
+			"max_spend":  claims.MaxSpend,
+			"expires_at": claims.ExpiresAt,
+		},
+	})
+}
+
+// RevokeEphemeralKeys 吊销令牌此前签发的全部临时密钥
+func RevokeEphemeralKeys(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	token, err := model.GetTokenByIds(id, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := model.RevokeEphemeralKeys(token.Id); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
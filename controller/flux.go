@@ -67,7 +67,7 @@ func relayFluxHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 
 	// 余额预检：低于 $0.10（50000 quota）直接拒绝，避免请求发出后上游已执行但扣费失败
 	const minBalanceQuota = int64(50000) // $0.10 × 500000 quota/USD
-	balance, balErr := model.CacheGetUserQuota(c.Request.Context(), meta.UserId)
+	balance, balErr := model.CacheGetPayerQuota(c.Request.Context(), meta.UserId, meta.OrgId)
 	if balErr != nil {
 		logger.Errorf(c, "Flux 余额查询失败: %v", balErr)
 		adaptor.MarkFailed(c, "余额查询失败")
@@ -0,0 +1,217 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// GetCreditAccounts 列出所有后付费账号
+func GetCreditAccounts(c *gin.Context) {
+	accounts, err := model.GetAllCreditAccounts()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": accounts})
+}
+
+// SaveCreditAccount 开通后付费或修改透支额度
+func SaveCreditAccount(c *gin.Context) {
+	account := model.CreditAccount{}
+	if err := c.ShouldBindJSON(&account); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数: " + err.Error()})
+		return
+	}
+	account.Id = 0
+	if err := model.SaveCreditAccount(&account); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
+
+func DeleteCreditAccount(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	if err := model.DeleteCreditAccount(userId); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
+
+// GetSelfCredit 当前用户的后付费额度与余额
+func GetSelfCredit(c *gin.Context) {
+	userId := c.GetInt("id")
+	account, err := model.GetCreditAccount(userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{"postpaid": false}})
+		return
+	}
+	quota, err := model.GetUserQuota(userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"postpaid":           true,
+			"credit_limit":       account.CreditLimit,
+			"soft_limit_percent": account.SoftLimitPercent,
+			"quota":              quota,
+			"available":          quota + account.CreditLimit,
+		},
+	})
+}
+
+func listInvoices(c *gin.Context, userId int) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.Query("pagesize"))
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 10
+	}
+	invoices, total, err := model.GetInvoices(userId, c.Query("status"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"list":        invoices,
+			"currentPage": page,
+			"pageSize":    pageSize,
+			"total":       total,
+		},
+	})
+}
+
+func GetAllInvoices(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	listInvoices(c, userId)
+}
+
+func GetSelfInvoices(c *gin.Context) {
+	listInvoices(c, c.GetInt("id"))
+}
+
+func getInvoiceForRequest(c *gin.Context, self bool) (*model.Invoice, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return nil, false
+	}
+	userId := 0
+	if self {
+		userId = c.GetInt("id")
+	}
+	invoice, err := model.GetInvoiceById(id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "账单不存在"})
+		return nil, false
+	}
+	return invoice, true
+}
+
+func GetInvoice(c *gin.Context) {
+	if invoice, ok := getInvoiceForRequest(c, false); ok {
+		c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": invoice})
+	}
+}
+
+func GetSelfInvoice(c *gin.Context) {
+	if invoice, ok := getInvoiceForRequest(c, true); ok {
+		c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": invoice})
+	}
+}
+
+func writeInvoiceStatement(c *gin.Context, invoice *model.Invoice) {
+	username := model.GetUsernameById(invoice.UserId)
+	filename := invoice.InvoiceNo
+	if c.DefaultQuery("format", "csv") == "pdf" {
+		c.Header("Content-Disposition", "attachment; filename="+filename+".pdf")
+		c.Data(http.StatusOK, "application/pdf", renderInvoicePDF(invoice, username))
+		return
+	}
+	data, err := renderInvoiceCSV(invoice, username)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename="+filename+".csv")
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+}
+
+// GetInvoiceStatement 下载对账单，format=csv（默认）或 pdf
+func GetInvoiceStatement(c *gin.Context) {
+	if invoice, ok := getInvoiceForRequest(c, false); ok {
+		writeInvoiceStatement(c, invoice)
+	}
+}
+
+func GetSelfInvoiceStatement(c *gin.Context) {
+	if invoice, ok := getInvoiceForRequest(c, true); ok {
+		writeInvoiceStatement(c, invoice)
+	}
+}
+
+// CloseInvoice 手动为某用户的某个已结束账期出账单
+func CloseInvoice(c *gin.Context) {
+	var req struct {
+		UserId int    `json:"user_id"`
+		Period string `json:"period"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserId == 0 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	invoice, err := model.CloseInvoice(req.UserId, req.Period, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": invoice})
+}
+
+// UpdateInvoiceStatus 标记账单为已支付（恢复余额）或作废
+func UpdateInvoiceStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	var req struct {
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Note) > 255 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	switch req.Status {
+	case model.InvoiceStatusPaid:
+		_, err = model.MarkInvoicePaid(id, req.Note)
+	case model.InvoiceStatusVoid:
+		err = model.VoidInvoice(id, req.Note)
+	default:
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "status 只能是 paid 或 void"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+func formatInvoiceTime(ts int64) string {
+	return time.Unix(ts, 0).Format("2006-01-02 15:04:05")
+}
+
+func renderInvoiceCSV(invoice *model.Invoice, username string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	rows := [][]string{
+		{"invoice_no", invoice.InvoiceNo},
+		{"user", fmt.Sprintf("%s (id=%d)", username, invoice.UserId)},
+		{"period", invoice.Period},
+		{"status", invoice.Status},
+		{"total_quota", strconv.FormatInt(invoice.TotalQuota, 10)},
+		{"amount", fmt.Sprintf("%.6f", invoice.Amount)},
+		{},
+		{"model", "requests", "prompt_tokens", "completion_tokens", "quota"},
+	}
+	for _, item := range invoice.Items {
+		rows = append(rows, []string{
+			item.ModelName,
+			strconv.FormatInt(item.RequestCount, 10),
+			strconv.FormatInt(item.PromptTokens, 10),
+			strconv.FormatInt(item.CompletionTokens, 10),
+			strconv.FormatInt(item.Quota, 10),
+		})
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pdfText 内置的 Courier 字体只支持 ASCII，其余字符以 ? 代替
+func pdfText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+const invoicePDFLinesPerPage = 50
+
+// renderInvoicePDF 生成纯文本排版的 PDF 对账单，不依赖第三方库
+func renderInvoicePDF(invoice *model.Invoice, username string) []byte {
+	lines := []string{
+		"Statement " + invoice.InvoiceNo,
+		"",
+		fmt.Sprintf("Account:  %s (id=%d)", username, invoice.UserId),
+		fmt.Sprintf("Period:   %s  (%s - %s)", invoice.Period, formatInvoiceTime(invoice.PeriodStart), formatInvoiceTime(invoice.PeriodEnd)),
+		fmt.Sprintf("Status:   %s", invoice.Status),
+		fmt.Sprintf("Issued:   %s", formatInvoiceTime(invoice.CreatedTime)),
+		"",
+		fmt.Sprintf("%-40s %10s %14s %14s %14s", "Model", "Requests", "Prompt", "Completion", "Quota"),
+	}
+	for _, item := range invoice.Items {
+		lines = append(lines, fmt.Sprintf("%-40.40s %10d %14d %14d %14d",
+			item.ModelName, item.RequestCount, item.PromptTokens, item.CompletionTokens, item.Quota))
+	}
+	lines = append(lines, "",
+		fmt.Sprintf("Total quota: %d", invoice.TotalQuota),
+		fmt.Sprintf("Amount due:  %.2f", invoice.Amount))
+
+	var pages [][]string
+	for len(lines) > invoicePDFLinesPerPage {
+		pages = append(pages, lines[:invoicePDFLinesPerPage])
+		lines = lines[invoicePDFLinesPerPage:]
+	}
+	pages = append(pages, lines)
+
+	// 对象编号：1 Catalog，2 Pages，3 Font，之后每页占 Page 与 Contents 两个对象
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+i*2)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>",
+	)
+	for i, pageLines := range pages {
+		var content strings.Builder
+		content.WriteString("BT /F1 9 Tf 11 TL 40 800 Td\n")
+		for _, line := range pageLines {
+			content.WriteString("(" + pdfText(line) + ") Tj T*\n")
+		}
+		content.WriteString("ET")
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+i*2),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
@@ -93,7 +93,7 @@ func parseKlingRequest(c *gin.Context, requestType string) (*klingRequest, error
 	quota := common.CalculateVideoQuota(model, requestType, mode, duration, "", "")
 
 	// 检查用户余额
-	userQuota, err := dbmodel.CacheGetUserQuota(c.Request.Context(), meta.UserId)
+	userQuota, err := dbmodel.CacheGetPayerQuota(c.Request.Context(), meta.UserId, meta.OrgId)
 	if err != nil {
 		return nil, fmt.Errorf("get user quota error: %w", err)
 	}
@@ -280,6 +280,7 @@ func processAsyncTask(c *gin.Context, req *klingRequest) {
 	taskManager := kling.NewTaskManager()
 	task, err := taskManager.CreateTask(&kling.CreateTaskRequest{
 		UserID:      req.Meta.UserId,
+		OrgID:       req.Meta.OrgId,
 		Username:    req.User.Username,
 		ChannelID:   req.Meta.ChannelId,
 		Model:       req.Model,
@@ -360,6 +361,7 @@ func processSyncTask(c *gin.Context, req *klingRequest) {
 	taskManager := kling.NewTaskManager()
 	task, err := taskManager.CreateTask(&kling.CreateTaskRequest{
 		UserID:      req.Meta.UserId,
+		OrgID:       req.Meta.OrgId,
 		Username:    req.User.Username,
 		ChannelID:   req.Meta.ChannelId,
 		Model:       req.Model,
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/model"
 )
 
@@ -116,6 +117,11 @@ func stripRetryHistorySegment(s string) string {
 	return s[:idx] + s[stop:]
 }
 
+// parseLogTagFilter 解析日志查询的 tag 参数，可重复或逗号分隔，如 tag=project=search&tag=env=prod，多个标签取交集
+func parseLogTagFilter(c *gin.Context) ([]model.RequestTag, error) {
+	return model.ParseTagPairs(strings.Join(c.QueryArray("tag"), ","))
+}
+
 func GetAllLogs(c *gin.Context) {
 	page, _ := strconv.Atoi(c.Query("page"))
 	if page < 0 {
@@ -132,7 +138,15 @@ func GetAllLogs(c *gin.Context) {
 	xRequestId := c.Query("x_request_id")
 	xResponseId := c.Query("x_response_id")
 	channel, _ := strconv.Atoi(c.Query("channel"))
-	logs, total, err := model.GetCurrentAllLogsAndCount(logType, startTimestamp, endTimestamp, modelName, username, tokenName, xRequestId, xResponseId, page, pagesize, channel)
+	tags, err := parseLogTagFilter(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	logs, total, err := model.GetCurrentAllLogsAndCount(logType, startTimestamp, endTimestamp, modelName, username, tokenName, xRequestId, xResponseId, page, pagesize, channel, c.Query("end_user"), tags)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -176,7 +190,15 @@ func GetUserLogs(c *gin.Context) {
 	modelName := c.Query("model_name")
 	xRequestId := c.Query("x_request_id")
 	xResponseId := c.Query("x_response_id")
-	logs, total, err := model.GetCurrentUserLogsAndCount(userId, logType, startTimestamp, endTimestamp, modelName, tokenName, xRequestId, xResponseId, page, pagesize)
+	tags, err := parseLogTagFilter(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	logs, total, err := model.GetCurrentUserLogsAndCount(userId, logType, startTimestamp, endTimestamp, modelName, tokenName, xRequestId, xResponseId, page, pagesize, c.Query("end_user"), tags)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -287,7 +309,13 @@ func DeleteHistoryLogs(c *gin.Context) {
 		})
 		return
 	}
-	count, err := model.DeleteOldLog(targetTimestamp)
+	var count int64
+	var err error
+	if config.LogArchiveEnabled {
+		count, err = archiveHistoryLogs(targetTimestamp)
+	} else {
+		count, err = model.DeleteOldLog(targetTimestamp)
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -303,6 +331,88 @@ func DeleteHistoryLogs(c *gin.Context) {
 	return
 }
 
+// GetUsageBreakdown 按 user / token / model / channel / group 拆分用量，用于对账单和运营报表。
+// 只读 usage_rollups，返回的 start/end 为实际覆盖的整点区间。
+// group_by 为 end_user 或 tag:<key> 时按请求标签拆分，读 log_tags
+func GetUsageBreakdown(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	channel, _ := strconv.Atoi(c.Query("channel"))
+	if startTimestamp == 0 || endTimestamp == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "start_timestamp and end_timestamp are required",
+		})
+		return
+	}
+	rows, start, end, err := model.GetUsageBreakdown(startTimestamp, endTimestamp+1, c.DefaultQuery("group_by", "model"), model.UsageFilter{
+		UserId:    userId,
+		Username:  c.Query("username"),
+		TokenName: c.Query("token_name"),
+		ModelName: c.Query("model_name"),
+		ChannelId: channel,
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"list":  rows,
+			"start": start,
+			"end":   end,
+		},
+	})
+}
+
+// GetSelfUsageBreakdown 用户按 token / model / end_user / tag:<key> 拆分自己的用量，用于按功能归因成本
+func GetSelfUsageBreakdown(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	if startTimestamp == 0 || endTimestamp == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "start_timestamp and end_timestamp are required",
+		})
+		return
+	}
+	dimension := c.DefaultQuery("group_by", "model")
+	if dimension != "token" && dimension != "model" && dimension != "end_user" && !strings.HasPrefix(dimension, "tag:") {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "不支持的维度: " + dimension,
+		})
+		return
+	}
+	rows, start, end, err := model.GetUsageBreakdown(startTimestamp, endTimestamp+1, dimension, model.UsageFilter{
+		UserId:    c.GetInt("id"),
+		TokenName: c.Query("token_name"),
+		ModelName: c.Query("model_name"),
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"list":  rows,
+			"start": start,
+			"end":   end,
+		},
+	})
+}
+
 // parseTimeBucket 将前端传入的时间粒度字符串转换为秒数
 func parseTimeBucket(bucket string) int64 {
 	switch bucket {
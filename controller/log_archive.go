@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/objstore"
+	"github.com/songquanpeng/one-api/model"
+)
+
+var (
+	logArchiveTaskOnce sync.Once
+	// logArchiveMu 保证定时任务、手动触发与按时间删除日志不会同时归档
+	logArchiveMu sync.Mutex
+)
+
+func getLogArchiveStore() objstore.Store {
+	if config.LogArchiveBucket != "" {
+		return objstore.NewS3(objstore.S3Config{
+			Region:    config.LogArchiveRegion,
+			AccessKey: config.LogArchiveAccessKey,
+			SecretKey: config.LogArchiveSecretKey,
+			Endpoint:  config.LogArchiveEndpoint,
+			Bucket:    config.LogArchiveBucket,
+		})
+	}
+	return objstore.NewLocal(config.LogArchiveDir)
+}
+
+func runLogArchiveOnce() {
+	if !logArchiveMu.TryLock() {
+		return
+	}
+	defer logArchiveMu.Unlock()
+	cutoff := time.Now().AddDate(0, 0, -config.LogArchiveAfterDays)
+	deleted, err := model.ArchiveTablesBefore(context.Background(), getLogArchiveStore(), cutoff)
+	if err != nil {
+		logger.SysError("log archive: " + err.Error())
+	}
+	if deleted > 0 {
+		logger.SysLog(fmt.Sprintf("log archive: archived and deleted %d rows before %s", deleted, cutoff.Format("2006-01-02")))
+	}
+}
+
+// StartLogArchiveTask 启动日志归档任务（仅 master 节点执行）
+func StartLogArchiveTask() {
+	logArchiveTaskOnce.Do(func() {
+		if !config.IsMasterNode || !config.LogArchiveEnabled || config.LogArchiveIntervalMinutes <= 0 || config.LogArchiveAfterDays <= 0 {
+			return
+		}
+		common.SafeGoroutine(func() {
+			for {
+				runLogArchiveOnce()
+				time.Sleep(time.Duration(config.LogArchiveIntervalMinutes) * time.Minute)
+			}
+		})
+	})
+}
+
+// archiveHistoryLogs 开启归档时 DeleteHistoryLogs 改为先归档再删除，只处理目标时间所在日期之前的整天
+func archiveHistoryLogs(targetTimestamp int64) (int64, error) {
+	if !logArchiveMu.TryLock() {
+		return 0, fmt.Errorf("归档任务正在执行，请稍后再试")
+	}
+	defer logArchiveMu.Unlock()
+	return model.ArchiveTableBefore(context.Background(), getLogArchiveStore(), "logs", time.Unix(targetTimestamp, 0))
+}
+
+func GetLogArchives(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	records, total, err := model.GetLogArchives(c.Query("table"), p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{"list": records, "total": total}})
+}
+
+// RunLogArchive 立即在后台执行一次归档
+func RunLogArchive(c *gin.Context) {
+	if !config.LogArchiveEnabled {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "未开启日志归档（LOG_ARCHIVE_ENABLED）"})
+		return
+	}
+	common.SafeGoroutine(runLogArchiveOnce)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "归档任务已开始"})
+}
+
+func RestoreLogArchive(c *gin.Context) {
+	var req struct {
+		Table    string `json:"table"`
+		StartDay string `json:"start_day"`
+		EndDay   string `json:"end_day"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	restored, err := model.RestoreLogArchive(c.Request.Context(), getLogArchiveStore(), req.Table, req.StartDay, req.EndDay)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error(), "data": restored})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": restored})
+}
+
+func QueryLogArchive(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	if userId == 0 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "user_id is required"})
+		return
+	}
+	table := c.DefaultQuery("table", "logs")
+	rows, total, err := model.QueryLogArchive(c.Request.Context(), getLogArchiveStore(), table,
+		c.Query("start_day"), c.Query("end_day"), userId, p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{"list": rows, "total": total}})
+}
@@ -0,0 +1,17 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/logexport"
+)
+
+// GetLogExportStats 日志导出的投递统计（本节点进程内累计）
+func GetLogExportStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    logexport.GetStats(),
+	})
+}
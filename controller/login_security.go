@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func respondLoginHistory(c *gin.Context, userId int) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.Query("pagesize"))
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 10
+	}
+	histories, total, err := model.GetUserLoginHistory(userId, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"list":        histories,
+			"currentPage": page,
+			"pageSize":    pageSize,
+			"total":       total,
+		},
+	})
+}
+
+// GetSelfLoginHistory 当前用户的登录记录
+func GetSelfLoginHistory(c *gin.Context) {
+	respondLoginHistory(c, c.GetInt("id"))
+}
+
+// GetUserLoginHistory 管理员查看某用户的登录记录
+func GetUserLoginHistory(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	respondLoginHistory(c, userId)
+}
+
+// UnlockUserLogin 管理员解除账号的登录锁定
+func UnlockUserLogin(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if err := model.UnlockUserLogin(userId); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
@@ -325,7 +325,7 @@ func handleFailedTask(ctx context.Context, task *model.Midjourney) {
 	} else {
 		quota := task.Quota
 		if quota != 0 {
-			err = model.IncreaseUserQuota(task.UserId, quota)
+			err = model.IncreasePayerQuota(task.UserId, task.OrgId, quota)
 			if err != nil {
 				logger.Error(ctx, fmt.Sprintf("Failed to increase user quota: %v", err))
 			}
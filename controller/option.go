@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/model"
@@ -101,6 +102,9 @@ func UpdateOption(c *gin.Context) {
 		})
 		return
 	}
+	if common.IsPriceBookOptionKey(option.Key) {
+		model.RecordPriceBookChange("update option: "+option.Key, c.GetInt("id"))
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
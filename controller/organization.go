@@ -0,0 +1,382 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// checkOrgRole 校验当前用户在组织内的角色不低于 minRole；系统管理员视为组织所有者。
+// 不满足时直接写响应并返回 false。
+func checkOrgRole(c *gin.Context, orgId int, minRole int) bool {
+	if c.GetInt("role") >= common.RoleAdminUser {
+		return true
+	}
+	if model.GetOrganizationMemberRole(orgId, c.GetInt("id")) >= minRole {
+		return true
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": "无权限操作该组织",
+	})
+	return false
+}
+
+func GetSelfOrganizations(c *gin.Context) {
+	orgs, err := model.GetUserOrganizations(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": orgs})
+}
+
+func CreateOrganization(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "参数错误"})
+		return
+	}
+	if len(req.Name) > 64 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "组织名称过长"})
+		return
+	}
+	org, err := model.CreateOrganization(req.Name, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": org})
+}
+
+func GetOrganization(c *gin.Context) {
+	orgId, _ := strconv.Atoi(c.Param("id"))
+	if !checkOrgRole(c, orgId, model.OrgRoleMember) {
+		return
+	}
+	org, err := model.GetOrganizationById(orgId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"organization": org,
+			"role":         model.GetOrganizationMemberRole(orgId, c.GetInt("id")),
+		},
+	})
+}
+
+func UpdateOrganization(c *gin.Context) {
+	orgId, _ := strconv.Atoi(c.Param("id"))
+	if !checkOrgRole(c, orgId, model.OrgRoleAdmin) {
+		return
+	}
+	var req struct {
+		Name   string `json:"name"`
+		Status int    `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "参数错误"})
+		return
+	}
+	org, err := model.GetOrganizationById(orgId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if req.Name != "" {
+		org.Name = req.Name
+	}
+	// 只有系统管理员可以禁用/启用组织
+	if req.Status != 0 && c.GetInt("role") >= common.RoleAdminUser {
+		org.Status = req.Status
+	}
+	if err := org.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": org})
+}
+
+func DeleteOrganization(c *gin.Context) {
+	orgId, _ := strconv.Atoi(c.Param("id"))
+	if !checkOrgRole(c, orgId, model.OrgRoleOwner) {
+		return
+	}
+	if err := model.DeleteOrganization(orgId); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	orgId, _ := strconv.Atoi(c.Param("id"))
+	if !checkOrgRole(c, orgId, model.OrgRoleMember) {
+		return
+	}
+	members, err := model.GetOrganizationMembers(orgId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": members})
+}
+
+type organizationMemberRequest struct {
+	UserId   int    `json:"user_id"`
+	Username string `json:"username"`
+	Role     int    `json:"role"`
+}
+
+func AddOrganizationMember(c *gin.Context) {
+	orgId, _ := strconv.Atoi(c.Param("id"))
+	if !checkOrgRole(c, orgId, model.OrgRoleAdmin) {
+		return
+	}
+	var req organizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "参数错误"})
+		return
+	}
+	if req.UserId == 0 && req.Username != "" {
+		user, err := model.GetUserByUsername(req.Username, false)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": "用户不存在"})
+			return
+		}
+		req.UserId = user.Id
+	}
+	if req.UserId == 0 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "未指定用户"})
+		return
+	}
+	if req.Role == 0 {
+		req.Role = model.OrgRoleMember
+	}
+	// 管理员只能添加普通成员，提升为管理员需要所有者操作
+	if req.Role >= model.OrgRoleAdmin && !checkOrgRole(c, orgId, model.OrgRoleOwner) {
+		return
+	}
+	if err := model.AddOrganizationMember(orgId, req.UserId, req.Role); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
+
+func UpdateOrganizationMember(c *gin.Context) {
+	orgId, _ := strconv.Atoi(c.Param("id"))
+	if !checkOrgRole(c, orgId, model.OrgRoleOwner) {
+		return
+	}
+	var req organizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "参数错误"})
+		return
+	}
+	if err := model.UpdateOrganizationMemberRole(orgId, req.UserId, req.Role); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
+
+func RemoveOrganizationMember(c *gin.Context) {
+	orgId, _ := strconv.Atoi(c.Param("id"))
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	// 成员可以自行退出；移除普通成员需要管理员，移除管理员需要所有者
+	if userId != c.GetInt("id") {
+		minRole := model.OrgRoleAdmin
+		if model.GetOrganizationMemberRole(orgId, userId) >= model.OrgRoleAdmin {
+			minRole = model.OrgRoleOwner
+		}
+		if !checkOrgRole(c, orgId, minRole) {
+			return
+		}
+	}
+	if err := model.RemoveOrganizationMember(orgId, userId); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
+
+func GetOrganizationTokens(c *gin.Context) {
+	orgId, _ := strconv.Atoi(c.Param("id"))
+	if !checkOrgRole(c, orgId, model.OrgRoleMember) {
+		return
+	}
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.Query("pagesize"))
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+	tokens, total, err := model.GetOrganizationTokens(orgId, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	// 普通成员只能看到自己令牌的 key
+	if !checkOrgRoleSilently(c, orgId, model.OrgRoleAdmin) {
+		for _, token := range tokens {
+			if token.UserId != c.GetInt("id") {
+				token.Key = ""
+			}
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"list":        tokens,
+			"currentPage": page,
+			"pageSize":    pageSize,
+			"total":       total,
+		},
+	})
+}
+
+func checkOrgRoleSilently(c *gin.Context, orgId int, minRole int) bool {
+	if c.GetInt("role") >= common.RoleAdminUser {
+		return true
+	}
+	return model.GetOrganizationMemberRole(orgId, c.GetInt("id")) >= minRole
+}
+
+func AddOrganizationToken(c *gin.Context) {
+	orgId, _ := strconv.Atoi(c.Param("id"))
+	if !checkOrgRole(c, orgId, model.OrgRoleMember) {
+		return
+	}
+	token := model.Token{}
+	if err := c.ShouldBindJSON(&token); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if len(token.Name) > 30 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "令牌名称过长"})
+		return
+	}
+	allowedTagKeys, err := model.NormalizeAllowedTagKeys(token.AllowedTagKeys)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	cleanToken := model.Token{
+		UserId:         c.GetInt("id"),
+		OrgId:          orgId,
+		Name:           token.Name,
+		Key:            helper.GenerateKey(),
+		CreatedTime:    helper.GetTimestamp(),
+		AccessedTime:   helper.GetTimestamp(),
+		ExpiredTime:    token.ExpiredTime,
+		RemainQuota:    token.RemainQuota,
+		UnlimitedQuota: token.UnlimitedQuota,
+		AllowedTagKeys: allowedTagKeys,
+	}
+	if err := cleanToken.Insert(); err != nil {
+		logger.Error(c.Request.Context(), "failed to create organization token: "+err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": cleanToken})
+}
+
+func DeleteOrganizationToken(c *gin.Context) {
+	orgId, _ := strconv.Atoi(c.Param("id"))
+	tokenId, _ := strconv.Atoi(c.Param("token_id"))
+	token, err := model.GetTokenById(tokenId)
+	if err != nil || token.OrgId != orgId {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "令牌不存在"})
+		return
+	}
+	// 成员可以删除自己的组织令牌，删除他人的需要管理员
+	if token.UserId != c.GetInt("id") && !checkOrgRole(c, orgId, model.OrgRoleAdmin) {
+		return
+	}
+	if err := token.Delete(); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
+
+// GetOrganizationUsage 组织看板：按成员（可选再按模型）拆分的消费汇总
+func GetOrganizationUsage(c *gin.Context) {
+	orgId, _ := strconv.Atoi(c.Param("id"))
+	if !checkOrgRole(c, orgId, model.OrgRoleAdmin) {
+		return
+	}
+	rows, err := model.GetOrganizationMemberUsage(orgId, c.Query("start_day"), c.Query("end_day"), c.Query("by_model") == "true")
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": rows})
+}
+
+func GetAllOrganizations(c *gin.Context) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.Query("pagesize"))
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+	orgs, total, err := model.GetAllOrganizationsAndCount(c.Query("keyword"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"list":        orgs,
+			"currentPage": page,
+			"pageSize":    pageSize,
+			"total":       total,
+		},
+	})
+}
+
+// AdjustOrganizationQuota 管理员直接增减组织额度池
+func AdjustOrganizationQuota(c *gin.Context) {
+	var req struct {
+		Id    int   `json:"id"`
+		Quota int64 `json:"quota"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Id == 0 || req.Quota == 0 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "参数错误"})
+		return
+	}
+	var err error
+	if req.Quota > 0 {
+		err = model.IncreaseOrgQuota(req.Id, req.Quota)
+	} else {
+		err = model.DecreaseOrgQuota(req.Id, -req.Quota)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	_ = model.CacheUpdateOrgQuota(c.Request.Context(), req.Id)
+	model.RecordLog(c.GetInt("id"), model.LogTypeManage, fmt.Sprintf("管理员调整组织 #%d 额度 %s", req.Id, common.LogQuota(req.Quota)))
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
@@ -0,0 +1,292 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/payment"
+	"github.com/songquanpeng/one-api/model"
+)
+
+type PaymentRequest struct {
+	Provider      string `json:"provider"`
+	Amount        int64  `json:"amount"`
+	PaymentMethod string `json:"payment_method"`
+	OrgId         int    `json:"org_id"`
+}
+
+func getPaymentAvailability(name string) (bool, string) {
+	p, ok := payment.Get(name)
+	if !ok {
+		return false, "不支持的支付渠道"
+	}
+	return p.Enabled()
+}
+
+// getPaymentReturnURL 支付完成或取消后返回的充值页面
+func getPaymentReturnURL() string {
+	if config.FrontendServerAddress != "" {
+		return strings.TrimRight(config.FrontendServerAddress, "/") + "/dashboard/topup"
+	}
+	return config.ServerAddress + "/topup"
+}
+
+func getPaymentNotifyURL(name string) string {
+	callBackAddress := config.ServerAddress
+	if name == payment.ProviderEpay && config.EpayCallbackAddress != "" {
+		callBackAddress = config.EpayCallbackAddress
+	}
+	return callBackAddress + "/api/payment/" + name + "/notify"
+}
+
+func getPaymentMinTopUp(name string) int64 {
+	switch name {
+	case payment.ProviderEpay:
+		return int64(config.EpayMinTopUp)
+	case payment.ProviderStripe:
+		return int64(config.StripeMinTopUp)
+	}
+	return 1
+}
+
+// genPaymentTradeNo Stripe 订单号沿用 ref_ 前缀，其它渠道沿用易支付的格式
+func genPaymentTradeNo(name string, userId int) string {
+	if name == payment.ProviderStripe {
+		return genStripeTradeNo(userId)
+	}
+	return fmt.Sprintf("USR%dNO%s%d", userId, helper.GetRandomString(6), helper.GetTimestamp())
+}
+
+// quotePayment 校验充值数量并返回应付金额，失败时已写入响应
+func quotePayment(c *gin.Context, name string, amount int64) (float64, string, bool) {
+	p, ok := payment.Get(name)
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "不支持的支付渠道"})
+		return 0, "", false
+	}
+	if enabled, reason := p.Enabled(); !enabled {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": reason})
+		return 0, "", false
+	}
+	if minTopUp := getPaymentMinTopUp(name); amount < minTopUp {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": fmt.Sprintf("充值数量不能小于 %d", minTopUp)})
+		return 0, "", false
+	}
+	if name == payment.ProviderStripe && amount > 10000 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "充值数量不能大于 10000"})
+		return 0, "", false
+	}
+	money, currency := p.Quote(amount)
+	if money < 0.01 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "充值金额过低"})
+		return 0, "", false
+	}
+	return money, currency, true
+}
+
+// createPaymentTopUp 各渠道共用的下单流程，失败时已写入响应
+func createPaymentTopUp(c *gin.Context, req PaymentRequest) (*model.TopUp, *payment.CreateResult, bool) {
+	money, currency, ok := quotePayment(c, req.Provider, req.Amount)
+	if !ok {
+		return nil, nil, false
+	}
+	userId := c.GetInt("id")
+	if req.OrgId > 0 && model.GetOrganizationMemberRole(req.OrgId, userId) < model.OrgRoleAdmin {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "只有组织管理员可以为组织充值"})
+		return nil, nil, false
+	}
+	if req.PaymentMethod == "" {
+		req.PaymentMethod = req.Provider
+		if req.Provider == payment.ProviderEpay {
+			req.PaymentMethod = "alipay"
+		}
+	}
+	topUp := &model.TopUp{
+		UserId:        userId,
+		OrgId:         req.OrgId,
+		Amount:        req.Amount,
+		Money:         money,
+		TradeNo:       genPaymentTradeNo(req.Provider, userId),
+		PaymentMethod: req.PaymentMethod,
+		Currency:      currency,
+	}
+	result, err := model.CreatePaymentTopUp(c.Request.Context(), req.Provider, topUp, &payment.Order{
+		ReturnURL: getPaymentReturnURL(),
+		NotifyURL: getPaymentNotifyURL(req.Provider),
+	})
+	if err != nil {
+		log.Printf("%s 下单失败: %v\n", req.Provider, err)
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "拉起支付失败"})
+		return nil, nil, false
+	}
+	return topUp, result, true
+}
+
+// GetPaymentProviders 当前可用的支付渠道
+func GetPaymentProviders(c *gin.Context) {
+	var list []gin.H
+	for _, p := range payment.All() {
+		if enabled, _ := p.Enabled(); !enabled {
+			continue
+		}
+		list = append(list, gin.H{"name": p.Name(), "min_topup": getPaymentMinTopUp(p.Name())})
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": list})
+}
+
+func RequestPayment(c *gin.Context) {
+	var req PaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "参数错误"})
+		return
+	}
+	topUp, result, ok := createPaymentTopUp(c, req)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"trade_no": topUp.TradeNo,
+			"pay_link": result.PayURL,
+			"params":   result.Params,
+		},
+	})
+}
+
+func RequestPaymentAmount(c *gin.Context) {
+	var req PaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "参数错误"})
+		return
+	}
+	money, _, ok := quotePayment(c, req.Provider, req.Amount)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": strconv.FormatFloat(money, 'f', 2, 64)})
+}
+
+// PaymentNotify 网关异步回调，/api/payment/:provider/notify
+func PaymentNotify(c *gin.Context) {
+	handlePaymentNotify(c, c.Param("provider"))
+}
+
+func handlePaymentNotify(c *gin.Context, name string) {
+	p, ok := payment.Get(name)
+	if !ok {
+		c.String(http.StatusNotFound, "fail")
+		return
+	}
+	result, err := p.VerifyCallback(c.Request)
+	if errors.Is(err, payment.ErrIgnored) {
+		c.Status(http.StatusOK)
+		return
+	}
+	if err != nil {
+		log.Printf("%s 回调验证失败: %v\n", name, err)
+		c.String(http.StatusBadRequest, "fail")
+		return
+	}
+	if !applyPaymentResult(name, result) {
+		c.String(http.StatusInternalServerError, "fail")
+		return
+	}
+	c.String(http.StatusOK, result.Ack)
+}
+
+// applyPaymentResult 应用回调结果；首次入账成功后处理用户等级等后续逻辑
+func applyPaymentResult(name string, result *payment.CallbackResult) bool {
+	changed, err := model.ApplyPaymentResult(name, result)
+	if err != nil {
+		log.Printf("%s 回调处理订单失败: tradeNo=%s, %v\n", name, result.TradeNo, err)
+		return false
+	}
+	if changed {
+		log.Printf("%s 回调处理成功: tradeNo=%s, status=%s\n", name, result.TradeNo, result.Status)
+		if topUp := model.GetTopUpByTradeNo(result.TradeNo); topUp != nil && topUp.OrgId == 0 &&
+			result.Status == payment.StatusSuccess {
+			_ = UserLevelUpgrade(topUp.UserId)
+			// 沿用旧版加密货币与 Payment Link 充值的到账邮件
+			if name == payment.ProviderCrypto || name == payment.ProviderStripeLink {
+				go model.AfterChargeSuccess(topUp.UserId, topUp.Money)
+			}
+		}
+	}
+	return true
+}
+
+// FakePaymentCheckout 假网关的收银台：访问即视为付款，status=failed 模拟付款失败。
+// 签名回调在进程内直接走 notify 的处理逻辑，随后跳回充值页面
+func FakePaymentCheckout(c *gin.Context) {
+	p, ok := payment.Get(payment.ProviderFake)
+	fake, isFake := p.(*payment.FakeProvider)
+	if !ok || !isFake {
+		c.String(http.StatusNotFound, "fail")
+		return
+	}
+	if enabled, reason := fake.Enabled(); !enabled {
+		c.String(http.StatusNotFound, reason)
+		return
+	}
+	status := payment.StatusSuccess
+	if c.Query("status") == string(payment.StatusFailed) {
+		status = payment.StatusFailed
+	}
+	values, err := fake.Settle(c.Query("trade_no"), status)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	notify, _ := http.NewRequest(http.MethodGet, getPaymentNotifyURL(payment.ProviderFake)+"?"+values.Encode(), nil)
+	result, err := fake.VerifyCallback(notify)
+	if err != nil || !applyPaymentResult(payment.ProviderFake, result) {
+		c.String(http.StatusInternalServerError, "fail")
+		return
+	}
+	c.Redirect(http.StatusFound, getPaymentReturnURL())
+}
+
+// SyncTopUp 管理员向网关查询订单状态，用于回调丢失的订单
+func SyncTopUp(c *gin.Context) {
+	var req struct {
+		TradeNo string `json:"trade_no"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.TradeNo == "" {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "缺少订单号"})
+		return
+	}
+	topUp, err := model.SyncTopUpOrder(c.Request.Context(), req.TradeNo)
+	if err != nil {
+		if errors.Is(err, payment.ErrNotSupported) {
+			err = errors.New("该支付渠道不支持查单")
+		}
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": topUp})
+}
+
+// RefundTopUp 管理员对已完成的订单发起全额退款并扣回额度
+func RefundTopUp(c *gin.Context) {
+	var req struct {
+		TradeNo string `json:"trade_no"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.TradeNo == "" {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "缺少订单号"})
+		return
+	}
+	if err := model.RefundTopUp(c.Request.Context(), req.TradeNo, c.GetInt("id")); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "退款成功"})
+}
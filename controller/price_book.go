@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// GetPriceBookVersions 分页列出价格簿版本
+func GetPriceBookVersions(c *gin.Context) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.Query("pagesize"))
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 10
+	}
+	versions, total, err := model.GetPriceBookVersions(page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"list":        versions,
+			"currentPage": page,
+			"pageSize":    pageSize,
+			"total":       total,
+			"active":      common.GetActivePriceVersion(),
+		},
+	})
+}
+
+// GetPriceBookVersion 查看某个版本的完整内容
+func GetPriceBookVersion(c *gin.Context) {
+	version, err := model.GetPriceBookVersion(c.Param("version_id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": version})
+}
+
+// CreatePriceBookVersion 新建版本：以当前价格为基础覆盖 changes 中的配置项，可指定未来的生效时间
+func CreatePriceBookVersion(c *gin.Context) {
+	var req struct {
+		Changes       map[string]string `json:"changes"`
+		EffectiveFrom int64             `json:"effective_from"`
+		Note          string            `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数: " + err.Error()})
+		return
+	}
+	if len(req.Changes) == 0 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "changes 不能为空"})
+		return
+	}
+	version, err := model.CreatePriceBookVersion(req.Changes, req.EffectiveFrom, req.Note, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	version.Snapshot = ""
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": version})
+}
+
+// DeletePriceBookVersion 撤销尚未生效的计划版本
+func DeletePriceBookVersion(c *gin.Context) {
+	if err := model.DeleteScheduledPriceBookVersion(c.Param("version_id")); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
+
+// DiffPriceBookVersions 比较两个版本，to 缺省为当前生效版本
+func DiffPriceBookVersions(c *gin.Context) {
+	toId := c.Query("to")
+	if toId == "" {
+		toId = common.GetActivePriceVersion()
+	}
+	from, err := model.GetPriceBookVersion(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "from 版本不存在"})
+		return
+	}
+	to, err := model.GetPriceBookVersion(toId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "to 版本不存在"})
+		return
+	}
+	diff, err := model.DiffPriceBookVersions(from, to)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"from": from.VersionId,
+			"to":   to.VersionId,
+			"diff": diff,
+		},
+	})
+}
@@ -299,6 +299,8 @@ func UpdateModelRatio(c *gin.Context) {
 		}
 	}
 
+	model.RecordPriceBookChange("update model ratio: "+req.ModelName, c.GetInt("id"))
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "更新成功",
@@ -462,6 +464,8 @@ func BatchUpdateModelRatio(c *gin.Context) {
 		}
 	}
 
+	model.RecordPriceBookChange("batch update model ratios", c.GetInt("id"))
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "批量更新成功",
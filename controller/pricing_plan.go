@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func GetAllPricingPlans(c *gin.Context) {
+	plans, err := model.GetAllPricingPlans()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": plans})
+}
+
+func GetPricingPlan(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	plan, err := model.GetPricingPlanById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": plan})
+}
+
+func AddPricingPlan(c *gin.Context) {
+	plan := model.PricingPlan{}
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数: " + err.Error()})
+		return
+	}
+	plan.Id = 0
+	if err := model.CreatePricingPlan(&plan); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": plan})
+}
+
+func UpdatePricingPlan(c *gin.Context) {
+	plan := model.PricingPlan{}
+	if err := c.ShouldBindJSON(&plan); err != nil || plan.Id == 0 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	if _, err := model.GetPricingPlanById(plan.Id); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if err := model.UpdatePricingPlan(&plan); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": plan})
+}
+
+func DeletePricingPlan(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	if err := model.DeletePricingPlan(id); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
+
+// PreviewPricingPlan 查看某用户当前适用的计划与档位
+func PreviewPricingPlan(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	group, err := model.CacheGetUserGroup(userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	_, applied := model.GetPricingPlanAdjustment(userId, group, c.Query("model"))
+	usages, err := model.GetPricingPlanUsages(userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"group":   group,
+			"applied": applied,
+			"usages":  usages,
+		},
+	})
+}
@@ -148,6 +148,8 @@ func AddRedemption(c *gin.Context) {
 			Key:         key,
 			CreatedTime: helper.GetTimestamp(),
 			Quota:       redemption.Quota,
+			MaxUses:     redemption.MaxUses,
+			ExpiredTime: redemption.ExpiredTime,
 		}
 		err = cleanRedemption.Insert()
 		if err != nil {
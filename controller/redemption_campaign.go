@@ -0,0 +1,193 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func getPageParams(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.Query("pagesize"))
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 10
+	}
+	return page, pageSize
+}
+
+func GetRedemptionCampaigns(c *gin.Context) {
+	page, pageSize := getPageParams(c)
+	campaigns, total, err := model.GetRedemptionCampaigns(page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"list":        campaigns,
+			"currentPage": page,
+			"pageSize":    pageSize,
+			"total":       total,
+		},
+	})
+}
+
+func GetRedemptionCampaign(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	campaign, err := model.GetRedemptionCampaignById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "活动不存在"})
+		return
+	}
+	stats, err := model.GetRedemptionCampaignStats(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{"campaign": campaign, "stats": stats}})
+}
+
+func AddRedemptionCampaign(c *gin.Context) {
+	campaign := model.RedemptionCampaign{}
+	if err := c.ShouldBindJSON(&campaign); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数: " + err.Error()})
+		return
+	}
+	campaign.Id = 0
+	campaign.CreatedBy = c.GetInt("id")
+	if err := model.CreateRedemptionCampaign(&campaign); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": campaign})
+}
+
+func UpdateRedemptionCampaign(c *gin.Context) {
+	campaign := model.RedemptionCampaign{}
+	if err := c.ShouldBindJSON(&campaign); err != nil || campaign.Id == 0 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	if err := model.UpdateRedemptionCampaign(&campaign); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
+
+// GenerateCampaignRedemptions 为活动批量生成兑换码
+func GenerateCampaignRedemptions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	var req struct {
+		Count       int   `json:"count"`
+		Quota       int64 `json:"quota"`
+		MaxUses     int   `json:"max_uses"`
+		ExpiredTime int64 `json:"expired_time"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	campaign, err := model.GetRedemptionCampaignById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "活动不存在"})
+		return
+	}
+	redemptions, err := model.GenerateCampaignRedemptions(campaign, req.Count, req.Quota, req.MaxUses, req.ExpiredTime, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	keys := make([]string, 0, len(redemptions))
+	for _, redemption := range redemptions {
+		keys = append(keys, redemption.Key)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": keys})
+}
+
+// ExportCampaignRedemptions 导出活动下全部兑换码为 CSV
+func ExportCampaignRedemptions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	redemptions, err := model.GetCampaignRedemptions(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	rows := [][]string{{"id", "key", "quota", "max_uses", "used_count", "status", "expired_time"}}
+	for _, r := range redemptions {
+		expired := ""
+		if r.ExpiredTime != 0 {
+			expired = formatInvoiceTime(r.ExpiredTime)
+		}
+		rows = append(rows, []string{
+			strconv.Itoa(r.Id),
+			r.Key,
+			strconv.FormatInt(r.Quota, 10),
+			strconv.Itoa(r.MaxUses),
+			strconv.Itoa(r.UsedCount),
+			strconv.Itoa(r.Status),
+			expired,
+		})
+	}
+	if err := w.WriteAll(rows); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=campaign-%d-codes.csv", id))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// GetRedemptionLogs 兑换尝试记录，可按活动和用户过滤
+func GetRedemptionLogs(c *gin.Context) {
+	page, pageSize := getPageParams(c)
+	campaignId, _ := strconv.Atoi(c.Query("campaign_id"))
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	logs, total, err := model.GetRedemptionLogs(campaignId, userId, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"list":        logs,
+			"currentPage": page,
+			"pageSize":    pageSize,
+			"total":       total,
+		},
+	})
+}
+
+func GetSelfModelCredits(c *gin.Context) {
+	credits, err := model.GetUserModelCredits(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": credits})
+}
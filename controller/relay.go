@@ -710,6 +710,7 @@ func recordXAIContentViolationCharge(ctx context.Context, c *gin.Context, channe
 	if requestID != "" {
 		logContent = fmt.Sprintf("xAI内容违规检查失败 [%s]（已扣费$0.05）", requestID)
 	}
+	ctx = dbmodel.SettleModelCredit(ctx, userId, c.GetInt("org_id"), originalModel, quota)
 
 	// 记录消费日志
 	dbmodel.RecordConsumeLogWithOtherAndRequestID(
@@ -739,7 +740,7 @@ func recordXAIContentViolationCharge(ctx context.Context, c *gin.Context, channe
 		logger.Error(ctx, "error consuming token remain quota: "+err.Error())
 	}
 
-	err = dbmodel.CacheUpdateUserQuota(ctx, userId)
+	err = dbmodel.CacheUpdatePayerQuota(ctx, userId, c.GetInt("org_id"))
 	if err != nil {
 		logger.Error(ctx, "error update user quota cache: "+err.Error())
 	}
@@ -1320,6 +1321,7 @@ func RelayOcr(c *gin.Context) {
 			title := ""
 			httpReferer := ""
 
+			ctx := dbmodel.SettleModelCredit(ctx, userId, c.GetInt("org_id"), modelName, int64(quota))
 			dbmodel.RecordConsumeLog(ctx, userId, channelId, pagesProcessed, docSizeBytes, modelName, tokenName, int64(quota), logContent, duration, title, httpReferer, false, 0.0)
 
 			// Update user and channel quota
@@ -1328,7 +1330,7 @@ func RelayOcr(c *gin.Context) {
 				logger.Error(c.Request.Context(), "error consuming token remain quota: "+err.Error())
 			}
 
-			err = dbmodel.CacheUpdateUserQuota(ctx, userId)
+			err = dbmodel.CacheUpdatePayerQuota(ctx, userId, c.GetInt("org_id"))
 			if err != nil {
 				logger.Error(c.Request.Context(), "error update user quota cache: "+err.Error())
 			}
@@ -1584,6 +1586,7 @@ func relayRecraftHelper(c *gin.Context) *model.ErrorWithStatusCode {
 			modelPrice = defaultPrice
 		}
 		quota := int64(modelPrice * 500000)
+		ctx := dbmodel.SettleModelCredit(ctx, userId, c.GetInt("org_id"), modelName, quota)
 
 		// Record consumption log
 		tokenName := c.GetString("token_name")
@@ -1620,7 +1623,7 @@ func relayRecraftHelper(c *gin.Context) *model.ErrorWithStatusCode {
 			logger.Error(c.Request.Context(), "error consuming token remain quota: "+err.Error())
 		}
 
-		err = dbmodel.CacheUpdateUserQuota(ctx, userId)
+		err = dbmodel.CacheUpdatePayerQuota(ctx, userId, c.GetInt("org_id"))
 		if err != nil {
 			logger.Error(c.Request.Context(), "error update user quota cache: "+err.Error())
 		}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// 状态页概览中保留最近多久内关闭的事件
+const statusPageRecentIncidentSeconds = 7 * 24 * 3600
+
+// GetStatusPage 公开状态页概览：全站状态、各模型实时状态、未关闭及最近 7 天关闭的事件
+func GetStatusPage(c *gin.Context) {
+	if !config.StatusPageEnabled {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "状态页未开启"})
+		return
+	}
+	statuses, err := model.GetModelStatusSnapshot()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	incidents, err := model.GetActiveStatusIncidents(time.Now().Unix() - statusPageRecentIncidentSeconds)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"status":     model.OverallStatus(statuses),
+			"models":     statuses,
+			"incidents":  incidents,
+			"updated_at": time.Now().Unix(),
+		},
+	})
+}
+
+// GetStatusPageHistory 公开的每日可用率历史，可按 model 过滤，days 默认且最多为 STATUS_PAGE_HISTORY_DAYS
+func GetStatusPageHistory(c *gin.Context) {
+	if !config.StatusPageEnabled {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "状态页未开启"})
+		return
+	}
+	days, _ := strconv.Atoi(c.Query("days"))
+	if days <= 0 || days > config.StatusPageHistoryDays {
+		days = config.StatusPageHistoryDays
+	}
+	history, err := model.GetModelUptimeHistory(c.Query("model"), days, time.Now())
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": history})
+}
+
+// GetStatusPageIncidents 公开的事件列表，可按 status / model 过滤
+func GetStatusPageIncidents(c *gin.Context) {
+	if !config.StatusPageEnabled {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "状态页未开启"})
+		return
+	}
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	incidents, total, err := model.GetStatusIncidents(c.Query("status"), c.Query("model"), p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{"list": incidents, "total": total}})
+}
+
+type statusIncidentRequest struct {
+	ModelName string `json:"model_name"`
+	Title     string `json:"title"`
+	Message   string `json:"message"`
+	Resolve   bool   `json:"resolve"`
+}
+
+// CreateStatusIncident 管理员手动发布事件
+func CreateStatusIncident(c *gin.Context) {
+	var req statusIncidentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	incident, err := model.CreateManualStatusIncident(req.ModelName, req.Title, req.Message, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": incident})
+}
+
+// AddStatusIncidentUpdate 管理员为事件发布备注，resolve 为 true 时同时关闭事件
+func AddStatusIncidentUpdate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	var req statusIncidentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	incident, err := model.AddStatusIncidentUpdate(id, req.Message, req.Resolve, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": incident})
+}
@@ -1,13 +1,15 @@
 package controller
 
 import (
-	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
-	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/payment"
 	"github.com/songquanpeng/one-api/model"
 )
 
@@ -61,6 +63,7 @@ func GetChargeConfigs(c *gin.Context) {
 	})
 }
 
+// CreateChargeOrder 按充值档位生成 Stripe Payment Link，订单写入 TopUp 并由 stripe_link 适配器处理回调
 func CreateChargeOrder(c *gin.Context) {
 	var CreateChargeOrderRequest struct {
 		ChrargeId int `json:"charge_id"`
@@ -73,11 +76,27 @@ func CreateChargeOrder(c *gin.Context) {
 		})
 		return
 	}
-	chargeId := CreateChargeOrderRequest.ChrargeId
-	//获取充值配置
-	//创建支付链接
+	chargeConfig, err := model.GetChargeConfigById(CreateChargeOrderRequest.ChrargeId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	userId := c.GetInt("id")
-	chargeUrl, appOrderId, err := model.CreateStripOrder(userId, chargeId)
+	topUp := &model.TopUp{
+		UserId:        userId,
+		Amount:        int64(chargeConfig.Amount),
+		Money:         chargeConfig.Amount,
+		Quota:         int64(chargeConfig.Amount * config.QuotaPerUnit),
+		TradeNo:       helper.GetRandomString(16),
+		PaymentMethod: payment.ProviderStripeLink,
+		Currency:      strings.ToUpper(chargeConfig.Currency),
+	}
+	result, err := model.CreatePaymentTopUp(c.Request.Context(), payment.ProviderStripeLink, topUp, &payment.Order{
+		Product: chargeConfig.Price,
+	})
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -89,26 +108,15 @@ func CreateChargeOrder(c *gin.Context) {
 		"success": true,
 		"message": "",
 		"data": gin.H{
-			"charge_url":   chargeUrl,
-			"app_order_id": appOrderId,
+			"charge_url":   result.PayURL,
+			"app_order_id": topUp.TradeNo,
 		},
 	})
 }
 
+// StripeCallback 旧版 Payment Link 的 Webhook，使用独立的 endpoint secret
 func StripeCallback(c *gin.Context) {
-	err := model.HandleStripeCallback(c.Request)
-	if err != nil {
-		logger.Error(c.Request.Context(), fmt.Sprintf("stripe callback failed: %v", err))
-		c.String(http.StatusBadRequest, "fail")
-		return
-	}
-	userId := c.GetInt("id")
-	err = UserLevelUpgrade(userId)
-	if err != nil {
-		return
-	}
-
-	c.String(http.StatusOK, "ok")
+	handlePaymentNotify(c, payment.ProviderStripeLink)
 }
 
 func GetUserChargeOrders(c *gin.Context) {
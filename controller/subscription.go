@@ -0,0 +1,296 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/message"
+	"github.com/songquanpeng/one-api/common/payment"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/stripe/stripe-go/v78"
+	portalsession "github.com/stripe/stripe-go/v78/billingportal/session"
+	"github.com/stripe/stripe-go/v78/checkout/session"
+	"gorm.io/gorm"
+)
+
+// GetSubscriptionPlans 用户可订阅的套餐
+func GetSubscriptionPlans(c *gin.Context) {
+	plans, err := model.GetSubscriptionPlans(true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": plans})
+}
+
+func GetAllSubscriptionPlans(c *gin.Context) {
+	plans, err := model.GetSubscriptionPlans(false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": plans})
+}
+
+func AddSubscriptionPlan(c *gin.Context) {
+	plan := model.SubscriptionPlan{}
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数: " + err.Error()})
+		return
+	}
+	plan.Id = 0
+	if err := model.CreateSubscriptionPlan(&plan); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": plan})
+}
+
+func UpdateSubscriptionPlan(c *gin.Context) {
+	plan := model.SubscriptionPlan{}
+	if err := c.ShouldBindJSON(&plan); err != nil || plan.Id == 0 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	if err := model.UpdateSubscriptionPlan(&plan); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
+
+func DeleteSubscriptionPlan(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	if err := model.DeleteSubscriptionPlan(id); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
+
+func GetSelfSubscriptions(c *gin.Context) {
+	subscriptions, err := model.GetUserSubscriptions(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": subscriptions})
+}
+
+// RequestStripeSubscription 拉起订阅 Checkout，额度在 invoice.paid 回调中发放
+func RequestStripeSubscription(c *gin.Context) {
+	var req struct {
+		PlanId int `json:"plan_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "参数错误"})
+		return
+	}
+	if enabled, reason := getPaymentAvailability(payment.ProviderStripe); !enabled {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": reason})
+		return
+	}
+	plan, err := model.GetSubscriptionPlanById(req.PlanId)
+	if err != nil || plan.Status != 1 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "套餐不存在或已下架"})
+		return
+	}
+	userId := c.GetInt("id")
+	if _, err := model.GetLiveUserSubscription(userId); err == nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "已有生效中的订阅，请在订阅管理页面变更套餐"})
+		return
+	}
+
+	stripe.Key = config.StripeApiSecret
+	returnURL := getPaymentReturnURL()
+	params := &stripe.CheckoutSessionParams{
+		ClientReferenceID: stripe.String(genStripeTradeNo(userId)),
+		SuccessURL:        stripe.String(returnURL),
+		CancelURL:         stripe.String(returnURL),
+		Mode:              stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				Price:    stripe.String(plan.StripePriceId),
+				Quantity: stripe.Int64(1),
+			},
+		},
+		AllowPromotionCodes: stripe.Bool(config.StripePromotionCodesEnabled),
+		SubscriptionData: &stripe.CheckoutSessionSubscriptionDataParams{
+			Metadata: map[string]string{
+				"user_id": strconv.Itoa(userId),
+				"plan_id": strconv.Itoa(plan.Id),
+			},
+		},
+	}
+	if customerId := model.GetUserStripeCustomerId(userId); customerId != "" {
+		params.Customer = stripe.String(customerId)
+	}
+	result, err := session.New(params)
+	if err != nil {
+		log.Printf("创建 Stripe 订阅 Checkout 失败: %v\n", err)
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "拉起支付失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{"pay_link": result.URL}})
+}
+
+// RequestStripePortal 返回 Stripe 自助管理页面链接，用于更换支付方式、变更或取消订阅
+func RequestStripePortal(c *gin.Context) {
+	if enabled, reason := getPaymentAvailability(payment.ProviderStripe); !enabled {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": reason})
+		return
+	}
+	customerId := model.GetUserStripeCustomerId(c.GetInt("id"))
+	if customerId == "" {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "没有订阅记录"})
+		return
+	}
+	stripe.Key = config.StripeApiSecret
+	result, err := portalsession.New(&stripe.BillingPortalSessionParams{
+		Customer:  stripe.String(customerId),
+		ReturnURL: stripe.String(getPaymentReturnURL()),
+	})
+	if err != nil {
+		log.Printf("创建 Stripe Portal 失败: %v\n", err)
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "打开订阅管理失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{"url": result.URL}})
+}
+
+func stripeMetadataUserId(metadata map[string]string) int {
+	userId, _ := strconv.Atoi(metadata["user_id"])
+	return userId
+}
+
+func stripeSubscriptionStateFromEvent(event stripe.Event) (*model.StripeSubscriptionState, error) {
+	var sub stripe.Subscription
+	if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
+		return nil, err
+	}
+	state := &model.StripeSubscriptionState{
+		SubscriptionId:    sub.ID,
+		UserId:            stripeMetadataUserId(sub.Metadata),
+		Status:            string(sub.Status),
+		PeriodStart:       sub.CurrentPeriodStart,
+		PeriodEnd:         sub.CurrentPeriodEnd,
+		CancelAtPeriodEnd: sub.CancelAtPeriodEnd,
+	}
+	if sub.Customer != nil {
+		state.CustomerId = sub.Customer.ID
+	}
+	if sub.Items != nil && len(sub.Items.Data) > 0 && sub.Items.Data[0].Price != nil {
+		state.PriceId = sub.Items.Data[0].Price.ID
+	}
+	return state, nil
+}
+
+func stripeInvoiceFromEvent(event stripe.Event) (*stripe.Invoice, *model.StripeSubscriptionState, error) {
+	var invoice stripe.Invoice
+	if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
+		return nil, nil, err
+	}
+	if invoice.Subscription == nil || invoice.Subscription.ID == "" {
+		return &invoice, nil, nil
+	}
+	state := &model.StripeSubscriptionState{SubscriptionId: invoice.Subscription.ID}
+	if invoice.Customer != nil {
+		state.CustomerId = invoice.Customer.ID
+	}
+	if invoice.SubscriptionDetails != nil {
+		state.UserId = stripeMetadataUserId(invoice.SubscriptionDetails.Metadata)
+	}
+	if invoice.Lines != nil {
+		for _, line := range invoice.Lines.Data {
+			if line.Proration || line.Price == nil {
+				continue
+			}
+			state.PriceId = line.Price.ID
+			if line.Period != nil {
+				state.PeriodStart = line.Period.Start
+				state.PeriodEnd = line.Period.End
+			}
+		}
+	}
+	return &invoice, state, nil
+}
+
+// stripeSubscriptionEvent 处理订阅相关的 Webhook 事件，同一事件只处理一次
+func stripeSubscriptionEvent(event stripe.Event) error {
+	var subscription *model.UserSubscription
+	var logContent string
+	var notify func()
+
+	processed, err := model.ProcessStripeEventOnce(event.ID, string(event.Type), func(tx *gorm.DB) error {
+		switch event.Type {
+		case stripe.EventTypeCustomerSubscriptionCreated, stripe.EventTypeCustomerSubscriptionUpdated, stripe.EventTypeCustomerSubscriptionDeleted:
+			state, err := stripeSubscriptionStateFromEvent(event)
+			if err != nil {
+				return err
+			}
+			subscription, err = model.ApplyStripeSubscriptionState(tx, state)
+			if err == nil && subscription.Status == model.SubscriptionStatusCanceled {
+				logContent = "订阅已取消"
+			}
+			return err
+		case stripe.EventTypeInvoicePaid:
+			invoice, state, err := stripeInvoiceFromEvent(event)
+			if err != nil || state == nil {
+				return err
+			}
+			var granted int64
+			subscription, granted, err = model.ApplyStripeSubscriptionInvoicePaid(tx, state, invoice.ID)
+			if err == nil && granted > 0 {
+				logContent = fmt.Sprintf("订阅续费成功，发放本期额度 %d", granted)
+			}
+			return err
+		case stripe.EventTypeInvoicePaymentFailed:
+			_, state, err := stripeInvoiceFromEvent(event)
+			if err != nil || state == nil {
+				return err
+			}
+			subscription, err = model.MarkStripeSubscriptionPastDue(tx, state.SubscriptionId)
+			if err == nil {
+				userId := subscription.UserId
+				notify = func() { notifySubscriptionPaymentFailed(userId) }
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !processed {
+		log.Printf("Stripe 事件已处理过，忽略重放: %s\n", event.ID)
+		return nil
+	}
+	if subscription != nil {
+		model.AfterSubscriptionChange(subscription, logContent)
+	}
+	if notify != nil {
+		go notify()
+	}
+	return nil
+}
+
+func notifySubscriptionPaymentFailed(userId int) {
+	email, err := model.GetUserEmail(userId)
+	if err != nil || email == "" {
+		return
+	}
+	subject := "订阅续费失败"
+	content := "你的订阅本期扣款失败，请在订阅管理页面更新支付方式，否则订阅将被取消。"
+	if err := message.SendEmail(subject, email, content); err != nil {
+		log.Printf("发送订阅续费失败邮件出错: userId=%d, %v\n", userId, err)
+	}
+}
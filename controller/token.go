@@ -156,6 +156,14 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	allowedTagKeys, err := model.NormalizeAllowedTagKeys(token.AllowedTagKeys)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	cleanToken := model.Token{
 		UserId:         c.GetInt("id"),
 		Name:           token.Name,
@@ -165,6 +173,7 @@ func AddToken(c *gin.Context) {
 		ExpiredTime:    token.ExpiredTime,
 		RemainQuota:    token.RemainQuota,
 		UnlimitedQuota: token.UnlimitedQuota,
+		AllowedTagKeys: allowedTagKeys,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -248,6 +257,7 @@ func UpdateToken(c *gin.Context) {
 		StatusOnly           *bool  `json:"status_only"`
 		Status               int    `json:"status"`
 		TokenRemindThreshold int64  `json:"token_remind_threshold"`
+		AllowedTagKeys       string `json:"allowed_tag_keys"`
 	}
 
 	var tokenupdate TokenUpdate
@@ -296,6 +306,16 @@ func UpdateToken(c *gin.Context) {
 	autoEnableReason := ""
 
 	if tokenupdate.StatusOnly != nil && *tokenupdate.StatusOnly {
+		// 冻结的令牌通过开关启用等同于解冻，需要同时清理冻结原因并处理异常记录
+		if cleanToken.Status == common.TokenStatusFrozen && tokenupdate.Status == common.TokenStatusEnabled {
+			if err := model.UnfreezeToken(cleanToken, userId); err != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": err.Error(),
+				})
+				return
+			}
+		}
 		cleanToken.Status = tokenupdate.Status
 	} else {
 		// 记录更新前的状态，用于智能启用判断
@@ -307,6 +327,14 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.RemainQuota = tokenupdate.RemainQuota
 		cleanToken.TokenRemindThreshold = tokenupdate.TokenRemindThreshold
 		cleanToken.UnlimitedQuota = tokenupdate.UnlimitedQuota
+		cleanToken.AllowedTagKeys, err = model.NormalizeAllowedTagKeys(tokenupdate.AllowedTagKeys)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 
 		// 智能启用逻辑：自动重新启用符合条件的禁用令牌
 
@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// GetTokenAnomalies 当前用户的用量异常记录，可按 token_id 过滤
+func GetTokenAnomalies(c *gin.Context) {
+	getTokenAnomalies(c, c.GetInt("id"))
+}
+
+// GetAllTokenAnomalies 全部用户的用量异常记录（管理员），可按 user_id / token_id 过滤
+func GetAllTokenAnomalies(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	getTokenAnomalies(c, userId)
+}
+
+func getTokenAnomalies(c *gin.Context, userId int) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	tokenId, _ := strconv.Atoi(c.Query("token_id"))
+	records, total, err := model.GetTokenAnomalies(userId, tokenId, p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{"list": records, "total": total}})
+}
+
+// UnfreezeToken 解冻被异常检测冻结的令牌。令牌所有者可以解冻自己的令牌，管理员可以解冻任意令牌
+func UnfreezeToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	var token *model.Token
+	if c.GetInt("role") >= common.RoleAdminUser {
+		token, err = model.GetTokenById(id)
+	} else {
+		token, err = model.GetTokenByIds(id, c.GetInt("id"))
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if err := model.UnfreezeToken(token, c.GetInt("id")); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": token})
+}
@@ -1,70 +1,29 @@
 package controller
 
 import (
-	"fmt"
-	"log"
 	"net/http"
-	"net/url"
 	"strconv"
-	"strings"
-	"sync"
-	"time"
 
-	"github.com/Calcium-Ion/go-epay/epay"
 	"github.com/gin-gonic/gin"
-	"github.com/samber/lo"
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/payment"
 	"github.com/songquanpeng/one-api/model"
 )
 
 type EpayRequest struct {
 	Amount        int64  `json:"amount"`
 	PaymentMethod string `json:"payment_method"`
-	ReturnURL     string `json:"return_url"`
+	OrgId         int    `json:"org_id"`
 }
 
 type AmountRequest struct {
 	Amount int64 `json:"amount"`
 }
 
-func GetEpayClient() *epay.Client {
-	if config.EpayPayAddress == "" || config.EpayId == "" || config.EpayKey == "" {
-		return nil
-	}
-	withUrl, err := epay.NewClient(&epay.Config{
-		PartnerID: config.EpayId,
-		Key:       config.EpayKey,
-	}, config.EpayPayAddress)
-	if err != nil {
-		return nil
-	}
-	return withUrl
-}
-
-func getEpayAvailability() (bool, string) {
-	if !config.EpayPaymentEnabled {
-		return false, "管理员未开启易支付"
-	}
-	if config.EpayPayAddress == "" {
-		return false, "当前管理员未配置支付地址"
-	}
-	if config.EpayId == "" {
-		return false, "当前管理员未配置易支付 PID"
-	}
-	if config.EpayKey == "" {
-		return false, "当前管理员未配置易支付密钥"
-	}
-	return true, ""
-}
-
-func getPayMoney(amount int64) float64 {
-	return float64(amount) * config.EpayPrice
-}
-
 func GetEpayTopUpInfo(c *gin.Context) {
-	enabled, reason := getEpayAvailability()
+	enabled, reason := getPaymentAvailability(payment.ProviderEpay)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -85,93 +44,16 @@ func RequestEpay(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": "参数错误"})
 		return
 	}
-	enabled, reason := getEpayAvailability()
-	if !enabled {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": reason})
-		return
-	}
-	if req.Amount < int64(config.EpayMinTopUp) {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": fmt.Sprintf("充值数量不能小于 %d", config.EpayMinTopUp)})
-		return
-	}
-
-	id := c.GetInt("id")
-	payMoney := getPayMoney(req.Amount)
-	if payMoney < 0.01 {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": "充值金额过低"})
-		return
-	}
-
-	if req.PaymentMethod == "" {
-		req.PaymentMethod = "alipay"
-	}
-
-	callBackAddress := config.EpayCallbackAddress
-	if callBackAddress == "" {
-		callBackAddress = config.ServerAddress
-	}
-	returnURLValue := config.ServerAddress + "/topup"
-	allowedReturnHosts := map[string]struct{}{}
-
-	if config.ServerAddress != "" {
-		if serverParsed, err := url.Parse(config.ServerAddress); err == nil && serverParsed.Host != "" {
-			allowedReturnHosts[serverParsed.Host] = struct{}{}
-		}
-	}
-	if config.FrontendServerAddress != "" {
-		returnURLValue = strings.TrimRight(config.FrontendServerAddress, "/") + "/dashboard/topup"
-		if frontendParsed, err := url.Parse(config.FrontendServerAddress); err == nil && frontendParsed.Host != "" {
-			allowedReturnHosts[frontendParsed.Host] = struct{}{}
-		}
-	}
-	// if req.ReturnURL != "" {
-	// 	parsed, parseErr := url.Parse(req.ReturnURL)
-	// 	if parseErr == nil && parsed.Host != "" {
-	// 		if _, ok := allowedReturnHosts[parsed.Host]; ok {
-	// 			returnURLValue = req.ReturnURL
-	// 		}
-	// 	}
-	// }
-	returnUrl, _ := url.Parse(returnURLValue)
-	notifyUrl, _ := url.Parse(callBackAddress + "/api/user/epay/notify")
-	tradeNo := fmt.Sprintf("USR%dNO%s%d", id, helper.GetRandomString(6), time.Now().Unix())
-
-	client := GetEpayClient()
-	if client == nil {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": "当前管理员未配置支付信息"})
-		return
-	}
-
-	uri, params, err := client.Purchase(&epay.PurchaseArgs{
-		Type:           req.PaymentMethod,
-		ServiceTradeNo: tradeNo,
-		Name:           fmt.Sprintf("充值%d额度", req.Amount),
-		Money:          strconv.FormatFloat(payMoney, 'f', 2, 64),
-		Device:         epay.PC,
-		NotifyUrl:      notifyUrl,
-		ReturnUrl:      returnUrl,
-	})
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": "拉起支付失败"})
-		return
-	}
-
-	topUp := &model.TopUp{
-		UserId:        id,
+	_, result, ok := createPaymentTopUp(c, PaymentRequest{
+		Provider:      payment.ProviderEpay,
 		Amount:        req.Amount,
-		Money:         payMoney,
-		TradeNo:       tradeNo,
 		PaymentMethod: req.PaymentMethod,
-		Currency:      "CNY",
-		CreateTime:    time.Now().Unix(),
-		Status:        "pending",
-	}
-	err = topUp.Insert()
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": "创建订单失败"})
+		OrgId:         req.OrgId,
+	})
+	if !ok {
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": params, "url": uri})
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": result.Params, "url": result.PayURL})
 }
 
 func RequestAmount(c *gin.Context) {
@@ -181,106 +63,16 @@ func RequestAmount(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": "参数错误"})
 		return
 	}
-	enabled, reason := getEpayAvailability()
-	if !enabled {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": reason})
-		return
-	}
-	if req.Amount < int64(config.EpayMinTopUp) {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": fmt.Sprintf("充值数量不能小于 %d", config.EpayMinTopUp)})
-		return
-	}
-	payMoney := getPayMoney(req.Amount)
-	if payMoney < 0.01 {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": "充值金额过低"})
+	payMoney, _, ok := quotePayment(c, payment.ProviderEpay, req.Amount)
+	if !ok {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": strconv.FormatFloat(payMoney, 'f', 2, 64)})
 }
 
-var orderLocks sync.Map
-var createLock sync.Mutex
-
-func LockOrder(tradeNo string) {
-	lock, ok := orderLocks.Load(tradeNo)
-	if !ok {
-		createLock.Lock()
-		defer createLock.Unlock()
-		lock, ok = orderLocks.Load(tradeNo)
-		if !ok {
-			lock = new(sync.Mutex)
-			orderLocks.Store(tradeNo, lock)
-		}
-	}
-	lock.(*sync.Mutex).Lock()
-}
-
-func UnlockOrder(tradeNo string) {
-	lock, ok := orderLocks.Load(tradeNo)
-	if ok {
-		lock.(*sync.Mutex).Unlock()
-		orderLocks.Delete(tradeNo)
-	}
-}
-
+// EpayNotify 旧版易支付回调地址，新订单使用 /api/payment/epay/notify
 func EpayNotify(c *gin.Context) {
-	var params map[string]string
-
-	if c.Request.Method == "POST" {
-		if err := c.Request.ParseForm(); err != nil {
-			log.Println("易支付回调POST解析失败:", err)
-			_, _ = c.Writer.Write([]byte("fail"))
-			return
-		}
-		params = lo.Reduce(lo.Keys(c.Request.PostForm), func(r map[string]string, t string, i int) map[string]string {
-			r[t] = c.Request.PostForm.Get(t)
-			return r
-		}, map[string]string{})
-	} else {
-		params = lo.Reduce(lo.Keys(c.Request.URL.Query()), func(r map[string]string, t string, i int) map[string]string {
-			r[t] = c.Request.URL.Query().Get(t)
-			return r
-		}, map[string]string{})
-	}
-
-	if len(params) == 0 {
-		log.Println("易支付回调参数为空")
-		_, _ = c.Writer.Write([]byte("fail"))
-		return
-	}
-
-	client := GetEpayClient()
-	if client == nil {
-		log.Println("易支付回调失败 未找到配置信息")
-		_, _ = c.Writer.Write([]byte("fail"))
-		return
-	}
-
-	verifyInfo, err := client.Verify(params)
-	if err != nil || !verifyInfo.VerifyStatus {
-		log.Println("易支付回调签名验证失败")
-		_, _ = c.Writer.Write([]byte("fail"))
-		return
-	}
-
-	if verifyInfo.TradeStatus != epay.StatusTradeSuccess {
-		log.Printf("易支付异常回调: %v", verifyInfo)
-		_, _ = c.Writer.Write([]byte("fail"))
-		return
-	}
-
-	LockOrder(verifyInfo.ServiceTradeNo)
-	defer UnlockOrder(verifyInfo.ServiceTradeNo)
-
-	err = model.CompleteTopUpOrder(verifyInfo.ServiceTradeNo)
-	if err != nil {
-		log.Printf("易支付回调处理订单失败: %v", err)
-		_, _ = c.Writer.Write([]byte("fail"))
-		return
-	}
-
-	log.Printf("易支付回调处理成功: tradeNo=%s", verifyInfo.ServiceTradeNo)
-	_, _ = c.Writer.Write([]byte("success"))
+	handlePaymentNotify(c, payment.ProviderEpay)
 }
 
 func CompleteTopUp(c *gin.Context) {
@@ -298,17 +90,14 @@ func CompleteTopUp(c *gin.Context) {
 		return
 	}
 
-	LockOrder(req.TradeNo)
-	defer UnlockOrder(req.TradeNo)
-
 	opId := c.GetInt("id")
 	meta := model.TopUpManualCompleteMeta{
-		Source:         "manual_complete",
-		OperatorUserId: opId,
+		Source:           "manual_complete",
+		OperatorUserId:   opId,
 		OperatorUsername: c.GetString("username"),
-		CompletedAt:    helper.GetTimestamp(),
+		CompletedAt:      helper.GetTimestamp(),
 	}
-	
+
 	err := model.CompleteTopUpOrderManual(req.TradeNo, meta)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
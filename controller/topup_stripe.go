@@ -2,20 +2,19 @@ package controller
 
 import (
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
-	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/common/payment"
 	"github.com/stripe/stripe-go/v78"
-	"github.com/stripe/stripe-go/v78/checkout/session"
 	"github.com/stripe/stripe-go/v78/webhook"
 )
 
@@ -26,26 +25,7 @@ type StripePayRequest struct {
 	PaymentMethod string `json:"payment_method"`
 	SuccessURL    string `json:"success_url,omitempty"`
 	CancelURL     string `json:"cancel_url,omitempty"`
-}
-
-func getStripeAvailability() (bool, string) {
-	if !config.StripePaymentEnabled {
-		return false, "管理员未开启 Stripe 支付"
-	}
-	if config.StripeApiSecret == "" {
-		return false, "当前管理员未配置 Stripe API Secret"
-	}
-	if config.StripeWebhookSecret == "" {
-		return false, "当前管理员未配置 Stripe Webhook Secret"
-	}
-	if config.StripePriceId == "" {
-		return false, "当前管理员未配置 Stripe Price ID"
-	}
-	return true, ""
-}
-
-func getStripePayMoney(amount int64) float64 {
-	return float64(amount) * config.StripeUnitPrice
+	OrgId         int    `json:"org_id,omitempty"`
 }
 
 func genStripeTradeNo(userId int) string {
@@ -60,23 +40,10 @@ func RequestStripeAmount(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": "参数错误"})
 		return
 	}
-
-	enabled, reason := getStripeAvailability()
-	if !enabled {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": reason})
+	payMoney, _, ok := quotePayment(c, payment.ProviderStripe, req.Amount)
+	if !ok {
 		return
 	}
-	if req.Amount < int64(config.StripeMinTopUp) {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": fmt.Sprintf("充值数量不能小于 %d", config.StripeMinTopUp)})
-		return
-	}
-
-	payMoney := getStripePayMoney(req.Amount)
-	if payMoney < 0.01 {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": "充值金额过低"})
-		return
-	}
-
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -90,99 +57,28 @@ func RequestStripePay(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": "参数错误"})
 		return
 	}
-
-	enabled, reason := getStripeAvailability()
-	if !enabled {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": reason})
-		return
-	}
-
-	if req.PaymentMethod == "" {
-		req.PaymentMethod = PaymentMethodStripe
-	}
-	if req.PaymentMethod != PaymentMethodStripe {
+	if req.PaymentMethod != "" && req.PaymentMethod != PaymentMethodStripe {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": "不支持的支付渠道"})
 		return
 	}
-	if req.Amount < int64(config.StripeMinTopUp) {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": fmt.Sprintf("充值数量不能小于 %d", config.StripeMinTopUp)})
-		return
-	}
-	if req.Amount > 10000 {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": "充值数量不能大于 10000"})
-		return
-	}
-
-	payMoney := getStripePayMoney(req.Amount)
-	if payMoney < 0.01 {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": "充值金额过低"})
-		return
-	}
-
-	userId := c.GetInt("id")
-	tradeNo := genStripeTradeNo(userId)
-
-	payLink, err := genStripeCheckoutLink(tradeNo, req.Amount, req.SuccessURL, req.CancelURL)
-	if err != nil {
-		log.Printf("创建 Stripe Checkout 失败: %v\n", err)
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": "拉起支付失败"})
-		return
-	}
-
-	if err := model.CreateStripeTopUp(userId, req.Amount, payMoney, tradeNo); err != nil {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": "创建订单失败"})
+	_, result, ok := createPaymentTopUp(c, PaymentRequest{
+		Provider:      payment.ProviderStripe,
+		Amount:        req.Amount,
+		PaymentMethod: PaymentMethodStripe,
+		OrgId:         req.OrgId,
+	})
+	if !ok {
 		return
 	}
-
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
 		"data": gin.H{
-			"pay_link": payLink,
+			"pay_link": result.PayURL,
 		},
 	})
 }
 
-func genStripeCheckoutLink(referenceId string, amount int64, successURL string, cancelURL string) (string, error) {
-	if !strings.HasPrefix(config.StripeApiSecret, "sk_") && !strings.HasPrefix(config.StripeApiSecret, "rk_") {
-		return "", fmt.Errorf("无效的 Stripe API 密钥")
-	}
-
-	stripe.Key = config.StripeApiSecret
-
-	
-	if config.FrontendServerAddress != "" {
-		successURL = config.FrontendServerAddress + "/dashboard/topup"
-		cancelURL = config.FrontendServerAddress + "/dashboard/topup"
-	}else if config.ServerAddress != "" {
-		successURL = config.ServerAddress + "/dashboard/topup"
-		cancelURL = config.ServerAddress + "/dashboard/topup"
-	}
-
-	params := &stripe.CheckoutSessionParams{
-		ClientReferenceID: stripe.String(referenceId),
-		SuccessURL:        stripe.String(successURL),
-		CancelURL:         stripe.String(cancelURL),
-		LineItems: []*stripe.CheckoutSessionLineItemParams{
-			{
-				Price:    stripe.String(config.StripePriceId),
-				Quantity: stripe.Int64(amount),
-			},
-		},
-		Mode:                stripe.String(string(stripe.CheckoutSessionModePayment)),
-		AllowPromotionCodes: stripe.Bool(config.StripePromotionCodesEnabled),
-	}
-
-	params.CustomerCreation = stripe.String(string(stripe.CheckoutSessionCustomerCreationAlways))
-
-	result, err := session.New(params)
-	if err != nil {
-		return "", err
-	}
-
-	return result.URL, nil
-}
-
 func StripeWebhook(c *gin.Context) {
 	payload, err := io.ReadAll(c.Request.Body)
 	if err != nil {
@@ -203,9 +99,30 @@ func StripeWebhook(c *gin.Context) {
 
 	switch event.Type {
 	case stripe.EventTypeCheckoutSessionCompleted:
-		stripeSessionCompleted(event)
-	case stripe.EventTypeCheckoutSessionExpired:
-		stripeSessionExpired(event)
+		// 订阅模式的 Checkout 不对应充值订单，订阅与额度由后续的 subscription / invoice 事件处理；
+		// setup 模式是自动充值绑卡
+		if event.GetObjectValue("mode") == string(stripe.CheckoutSessionModeSubscription) {
+			break
+		}
+		if event.GetObjectValue("mode") == string(stripe.CheckoutSessionModeSetup) {
+			stripeAutoTopUpSetupCompleted(event)
+			break
+		}
+		fallthrough
+	case stripe.EventTypeCheckoutSessionExpired, stripe.EventTypeChargeRefunded:
+		// 处理失败时返回 500，Stripe 会重试投递该事件
+		if err := stripeTopUpEvent(event); err != nil {
+			log.Printf("Stripe 充值事件处理失败: %s %s, 错误: %v\n", event.Type, event.ID, err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	case stripe.EventTypeCustomerSubscriptionCreated, stripe.EventTypeCustomerSubscriptionUpdated,
+		stripe.EventTypeCustomerSubscriptionDeleted, stripe.EventTypeInvoicePaid, stripe.EventTypeInvoicePaymentFailed:
+		if err := stripeSubscriptionEvent(event); err != nil {
+			log.Printf("Stripe 订阅事件处理失败: %s %s, 错误: %v\n", event.Type, event.ID, err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
 	default:
 		log.Printf("不支持的 Stripe Webhook 事件类型: %s\n", event.Type)
 	}
@@ -213,56 +130,17 @@ func StripeWebhook(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
-func stripeSessionCompleted(event stripe.Event) {
-	referenceId := event.GetObjectValue("client_reference_id")
-	status := event.GetObjectValue("status")
-	if status != "complete" {
-		log.Printf("Stripe Checkout 状态异常: %s, 订单: %s\n", status, referenceId)
-		return
+// stripeTopUpEvent 充值 Checkout 完成、过期及退款事件交给 Stripe 适配器映射后走统一的订单状态机
+func stripeTopUpEvent(event stripe.Event) error {
+	result, err := payment.StripeCheckoutResult(event)
+	if errors.Is(err, payment.ErrIgnored) {
+		return nil
 	}
-
-	if referenceId == "" {
-		log.Println("Stripe Webhook 未提供 client_reference_id")
-		return
-	}
-
-	LockOrder(referenceId)
-	defer UnlockOrder(referenceId)
-
-	amountStr := event.GetObjectValue("amount_total")
-	currency := event.GetObjectValue("currency")
-	amountTotal, parseErr := strconv.ParseInt(amountStr, 10, 64)
-	if parseErr != nil || amountStr == "" {
-		log.Printf("Stripe Webhook amount_total 解析失败(%v)，使用订单内金额: tradeNo=%s\n", parseErr, referenceId)
-		if err := model.CompleteStripeTopUp(referenceId); err != nil {
-			log.Printf("Stripe 充值完成失败: %s, 错误: %v\n", referenceId, err)
-		}
-		return
-	}
-
-	if err := model.CompleteStripeTopUpFromCheckout(referenceId, amountTotal, currency); err != nil {
-		log.Printf("Stripe 充值完成失败: %s, 错误: %v\n", referenceId, err)
-		return
-	}
-
-	major := model.StripeAmountTotalToMajor(amountTotal, currency)
-	log.Printf("Stripe 收到款项: %s, %.2f %s\n", referenceId, major, strings.ToUpper(currency))
-}
-
-func stripeSessionExpired(event stripe.Event) {
-	referenceId := event.GetObjectValue("client_reference_id")
-	if referenceId == "" {
-		log.Println("Stripe Webhook 过期事件未提供订单号")
-		return
+	if err != nil {
+		return fmt.Errorf("解析失败: %w", err)
 	}
-
-	LockOrder(referenceId)
-	defer UnlockOrder(referenceId)
-
-	if err := model.ExpireStripeTopUp(referenceId); err != nil {
-		log.Printf("Stripe 订单过期处理失败: %s, 错误: %v\n", referenceId, err)
-		return
+	if !applyPaymentResult(payment.ProviderStripe, result) {
+		return fmt.Errorf("订单 %s 处理失败", result.TradeNo)
 	}
-
-	log.Printf("Stripe 订单已过期: %s\n", referenceId)
+	return nil
 }
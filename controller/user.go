@@ -46,18 +46,39 @@ func Login(c *gin.Context) {
 		})
 		return
 	}
+	accountKey, account := model.ResolveLoginAccount(username)
+	accountId := 0
+	if account != nil {
+		accountId = account.Id
+	}
+	if remaining := model.GetLoginLockRemaining(accountKey); remaining > 0 {
+		model.RecordLoginHistory(accountId, username, c.ClientIP(), c.Request.UserAgent(), false, model.LoginFailReasonLocked)
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("Too many failed login attempts, please try again in %d seconds", remaining),
+			"success": false,
+		})
+		return
+	}
 	user := model.User{
 		Username: username,
 		Password: password,
 	}
 	err = user.ValidateAndFill()
 	if err != nil {
+		model.RecordLoginHistory(accountId, username, c.ClientIP(), c.Request.UserAgent(), false, model.LoginFailReasonBadCredentials)
+		lockedUntil, lockErr := model.RecordLoginFailure(accountKey)
+		if lockErr != nil {
+			logger.SysError("failed to record login failure: " + lockErr.Error())
+		} else if lockedUntil > 0 {
+			model.NotifyLoginLockout(account, c.ClientIP(), lockedUntil)
+		}
 		c.JSON(http.StatusOK, gin.H{
 			"message": err.Error(),
 			"success": false,
 		})
 		return
 	}
+	model.ResetLoginLock(accountKey)
 	setupLogin(&user, c)
 }
 
@@ -80,12 +101,21 @@ func setLoginSession(user *model.User, c *gin.Context) {
 
 // setup session & cookies and then return user info
 func setupLogin(user *model.User, c *gin.Context) {
+	sid, err := model.CreateUserSession(user.Id, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Unable to save session information, please try again",
+			"success": false,
+		})
+		return
+	}
 	session := sessions.Default(c)
+	session.Set("sid", sid)
 	session.Set("id", user.Id)
 	session.Set("username", user.Username)
 	session.Set("role", user.Role)
 	session.Set("status", user.Status)
-	err := session.Save()
+	err = session.Save()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Unable to save session information, please try again",
@@ -93,6 +123,7 @@ func setupLogin(user *model.User, c *gin.Context) {
 		})
 		return
 	}
+	model.RecordLoginHistory(user.Id, user.Username, c.ClientIP(), c.Request.UserAgent(), true, "")
 	cleanUser := model.User{
 		Id:          user.Id,
 		Username:    user.Username,
@@ -110,6 +141,11 @@ func setupLogin(user *model.User, c *gin.Context) {
 
 func Logout(c *gin.Context) {
 	session := sessions.Default(c)
+	if sid, ok := session.Get("sid").(string); ok {
+		if err := model.RevokeUserSessionBySid(sid); err != nil {
+			logger.SysError("failed to revoke session on logout: " + err.Error())
+		}
+	}
 	session.Clear()
 	err := session.Save()
 	if err != nil {
@@ -865,7 +901,8 @@ func EmailBind(c *gin.Context) {
 }
 
 type topUpRequest struct {
-	Key string `json:"key"`
+	Key   string `json:"key"`
+	OrgId int    `json:"org_id"`
 }
 
 func TopUp(c *gin.Context) {
@@ -879,7 +916,14 @@ func TopUp(c *gin.Context) {
 		return
 	}
 	id := c.GetInt("id")
-	quota, err := model.Redeem(req.Key, id)
+	if req.OrgId > 0 && model.GetOrganizationMemberRole(req.OrgId, id) < model.OrgRoleAdmin {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "只有组织管理员可以为组织充值",
+		})
+		return
+	}
+	result, err := model.RedeemCode(req.Key, id, req.OrgId, c.ClientIP())
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -890,7 +934,8 @@ func TopUp(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data":    quota,
+		"data":    result.Quota,
+		"reward":  result,
 	})
 	return
 }
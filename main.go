@@ -15,8 +15,10 @@ import (
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/audit"
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logexport"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/metrics"
+	"github.com/songquanpeng/one-api/common/tracing"
 	"github.com/songquanpeng/one-api/controller"
 	"github.com/songquanpeng/one-api/middleware"
 	"github.com/songquanpeng/one-api/model"
@@ -145,13 +147,25 @@ func main() {
 	// 注册业务指标（模型维度 + 渠道维度），两组各有独立开关
 	metrics.RegisterBusinessMetrics()
 
+	// 链路追踪（关闭时为空操作；导出器初始化失败只记日志，不影响启动）
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		logger.SysError("failed to init tracing: " + err.Error())
+	}
+	defer shutdownTracing(context.Background())
+
 	// Initialize options（必须在 audit.Start 之前，审计配置从 options 表读取）
 	model.InitOptionMap()
+	model.InitPriceBook()
 
 	// 启动审计模块（依赖 options 表中的配置，关闭时为空操作，初始化失败自动降级）
 	audit.Start(context.Background())
 	defer audit.Shutdown()
 
+	// 日志流式导出（按环境变量开启，目标不可用时落盘重放，不阻塞写日志）
+	logexport.Start()
+	defer logexport.Shutdown()
+
 	logger.SysLog(fmt.Sprintf("using theme %s", config.Theme))
 	if common.RedisEnabled {
 		// for compatibility with old versions
@@ -177,9 +191,18 @@ func main() {
 		go model.SyncChannelCache(config.SyncFrequency)
 	}
 
+	go model.SyncPriceBook(15)
+	model.StartInvoiceCloseTask()
+	model.StartAffiliateSettleTask()
+	model.StartAutoTopUpReconcileTask()
 	go controller.AutomaticallyTestChannels()
 	controller.StartChannelUpstreamModelUpdateTask()
 	controller.StartDynamicPriorityTask()
+	controller.StartReconciliationTask()
+	controller.StartLogArchiveTask()
+	model.StartUsageRollupWorker()
+	model.StartAnomalyDetectionTask()
+	model.StartStatusPageTask()
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		config.BatchUpdateEnabled = true
 		logger.SysLog("batch update enabled with interval " + strconv.Itoa(config.BatchUpdateInterval) + "s")
@@ -239,6 +262,7 @@ func main() {
 	// This will cause SSE not to work!!!
 	//server.Use(gzip.Gzip(gzip.DefaultCompression))
 	server.Use(middleware.RequestId())
+	server.Use(middleware.Tracing())
 	middleware.SetUpLogger(server)
 	// Initialize session store
 	store := cookie.NewStore([]byte(config.SessionSecret))
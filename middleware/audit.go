@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/audit"
+	"github.com/songquanpeng/one-api/common/tracing"
 )
 
 type auditRespWriter struct {
@@ -45,6 +46,7 @@ func Audit() gin.HandlerFunc {
 
 		defer func() {
 			r := recover()
+			_, submitSpan := tracing.Start(c.Request.Context(), "audit.submit")
 			audit.FinalizeUpstream(c)
 			audit.BuildAndSubmit(c, audit.FinalizeInput{
 				Start:          start,
@@ -54,6 +56,7 @@ func Audit() gin.HandlerFunc {
 				ClientTrunc:    arw.trunc,
 				StatusCode:     arw.Status(),
 			})
+			submitSpan.End()
 			if r != nil {
 				panic(r)
 			}
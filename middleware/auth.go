@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"strings"
 
@@ -8,8 +10,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/blacklist"
+	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/tracing"
 	"github.com/songquanpeng/one-api/model"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func authHelper(c *gin.Context, minRole int) {
@@ -29,8 +34,32 @@ func authHelper(c *gin.Context, minRole int) {
 			c.Abort()
 			return
 		}
-		user := model.ValidateAccessToken(accessToken)
-		if user != nil && user.Username != "" {
+		if model.IsManagementToken(strings.TrimPrefix(accessToken, "Bearer ")) {
+			mt, user, err := model.ValidateManagementToken(accessToken)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"success": false,
+					"message": err.Error(),
+				})
+				c.Abort()
+				return
+			}
+			resource, write, ok := managementTokenRequirement(c)
+			if !ok || !mt.Allows(resource, write) {
+				c.JSON(http.StatusForbidden, gin.H{
+					"success": false,
+					"message": "The management token does not have the required scope for this operation",
+				})
+				c.Abort()
+				return
+			}
+			model.TouchManagementToken(mt, c.ClientIP())
+			c.Set("management_token_id", mt.Id)
+			username = user.Username
+			role = user.Role
+			id = user.Id
+			status = user.Status
+		} else if user := model.ValidateAccessToken(accessToken); user != nil && user.Username != "" {
 			// Token is valid
 			username = user.Username
 			role = user.Role
@@ -44,6 +73,20 @@ func authHelper(c *gin.Context, minRole int) {
 			c.Abort()
 			return
 		}
+	} else {
+		// cookie 只是会话凭据，是否仍然有效以服务端会话记录为准
+		sid, _ := session.Get("sid").(string)
+		if err := model.ValidateUserSession(sid, id.(int), c.ClientIP()); err != nil {
+			session.Clear()
+			_ = session.Save()
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		c.Set("session_id", sid)
 	}
 	if status.(int) == common.UserStatusDisabled || blacklist.IsUserBanned(id.(int)) {
 		c.JSON(http.StatusOK, gin.H{
@@ -70,6 +113,37 @@ func authHelper(c *gin.Context, minRole int) {
 	c.Next()
 }
 
+// 以 GET 注册但会修改数据的接口，管理令牌按写权限校验
+var managementTokenWriteGETs = map[string]bool{
+	"/api/channel/test":               true,
+	"/api/channel/update_balance":     true,
+	"/api/channel/update_balance/:id": true,
+	"/api/channel/clear_quota/:id":    true,
+	"/api/channel/fetch_models/:id":   true,
+	"/api/oauth/wechat/bind":          true,
+	"/api/oauth/email/bind":           true,
+}
+
+// 管理令牌一律不可访问的接口：生成全权限的 AccessToken（管理令牌自身的接口在 managementTokenRequirement 中拦截）
+var managementTokenForbidden = map[string]bool{
+	"/api/user/token": true,
+}
+
+// managementTokenRequirement 按路由推导所需作用域：资源为 /api/ 后的第一段，非 GET 请求需要 write
+func managementTokenRequirement(c *gin.Context) (resource string, write bool, ok bool) {
+	route := c.FullPath()
+	if managementTokenForbidden[route] || !strings.HasPrefix(route, "/api/") {
+		return "", false, false
+	}
+	resource, _, _ = strings.Cut(strings.TrimPrefix(route, "/api/"), "/")
+	if resource == "" || resource == "management_token" {
+		return "", false, false
+	}
+	write = c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead
+	write = write || managementTokenWriteGETs[route]
+	return resource, write, true
+}
+
 func UserAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		authHelper(c, common.RoleCommonUser)
@@ -98,7 +172,13 @@ func TryUserAuth() func(c *gin.Context) {
 		id := session.Get("id")
 
 		if username != nil {
-			logger.Info(c.Request.Context(), "TryUserAuth: resolved from session, username="+username.(string))
+			sid, _ := session.Get("sid").(string)
+			if err := model.ValidateUserSession(sid, id.(int), c.ClientIP()); err != nil {
+				username = nil
+				logger.Info(c.Request.Context(), "TryUserAuth: session revoked or expired")
+			} else {
+				logger.Info(c.Request.Context(), "TryUserAuth: resolved from session, username="+username.(string))
+			}
 		} else {
 			// 尝试从 access token 解析
 			accessToken := c.Request.Header.Get("Authorization")
@@ -127,6 +207,9 @@ func TryUserAuth() func(c *gin.Context) {
 
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		// 只覆盖鉴权本身（令牌与用户状态的缓存查询），在 c.Next() 前结束；提前 abort 时由 defer 结束
+		_, authSpan := tracing.Start(c.Request.Context(), "auth.token")
+		defer authSpan.End()
 		// Claude API 从 x-api-key header 中获取 key
 		// 支持 /v1/messages 路径
 		if strings.HasPrefix(c.Request.URL.Path, "/v1/messages") {
@@ -167,18 +250,48 @@ func TokenAuth() func(c *gin.Context) {
 		if key == "" || key == "midjourney-proxy" {
 			key = c.Request.Header.Get("mj-api-secret")
 			key = strings.TrimPrefix(key, "Bearer ")
-			key = strings.TrimPrefix(key, "sk-")
-			parts = strings.Split(key, "-")
-			key = parts[0]
+		}
+		var token *model.Token
+		var ephemeralSession *model.EphemeralKeySession
+		var err error
+		if model.IsEphemeralKey(key) {
+			// 临时密钥：以父令牌身份鉴权，不支持指定渠道
+			var claims *model.EphemeralKeyClaims
+			claims, token, err = model.ValidateEphemeralKey(key)
+			if err != nil {
+				abortWithMessage(c, http.StatusUnauthorized, err.Error())
+				return
+			}
+			ephemeralSession, err = model.BeginEphemeralKeySession(claims)
+			if err != nil {
+				abortWithMessage(c, http.StatusForbidden, err.Error())
+				return
+			}
+			defer ephemeralSession.Release()
+			c.Set("ephemeral_key", claims)
+			// 限定了模型的临时密钥只能用于能解析出模型名的请求，文件、任务查询等接口一律拒绝
+			if len(claims.Models) > 0 {
+				modelRequest, _ := getModelRequest(c)
+				if modelRequest.Model == "" {
+					abortWithMessage(c, http.StatusForbidden, "The ephemeral key is restricted to specific models and cannot be used for this request")
+					return
+				}
+				if !claims.AllowsModel(modelRequest.Model) {
+					abortWithMessage(c, http.StatusForbidden, fmt.Sprintf("The ephemeral key is not allowed to use model %s", modelRequest.Model))
+					return
+				}
+			}
+			ctx := context.WithValue(c.Request.Context(), logger.EphemeralKeyCtxKey, ephemeralSession)
+			c.Request = c.Request.WithContext(ctx)
 		} else {
 			key = strings.TrimPrefix(key, "sk-")
 			parts = strings.Split(key, "-")
 			key = parts[0]
-		}
-		token, err := model.ValidateUserToken(key)
-		if err != nil {
-			abortWithMessage(c, http.StatusUnauthorized, err.Error())
-			return
+			token, err = model.ValidateUserToken(key)
+			if err != nil {
+				abortWithMessage(c, http.StatusUnauthorized, err.Error())
+				return
+			}
 		}
 		userEnabled, err := model.CacheIsUserEnabled(token.UserId)
 		if err != nil {
@@ -189,9 +302,28 @@ func TokenAuth() func(c *gin.Context) {
 			abortWithMessage(c, http.StatusForbidden, "User has been banned")
 			return
 		}
+		if token.OrgId > 0 {
+			// 组织令牌：组织被禁用或创建者已退出组织时不再可用
+			if !model.CacheIsOrganizationEnabled(token.OrgId) {
+				abortWithMessage(c, http.StatusForbidden, "The organization is not available")
+				return
+			}
+			if model.CacheGetOrganizationMemberRole(token.OrgId, token.UserId) == 0 {
+				abortWithMessage(c, http.StatusForbidden, "The token owner is no longer a member of the organization")
+				return
+			}
+			c.Set("org_id", token.OrgId)
+			ctx := context.WithValue(c.Request.Context(), logger.OrgIdKey, token.OrgId)
+			c.Request = c.Request.WithContext(ctx)
+		}
 		c.Set("id", token.UserId)
 		c.Set("token_id", token.Id)
 		c.Set("token_name", token.Name)
+		model.ObserveTokenSource(token.Id, c.ClientIP(), c.GetHeader(config.AnomalyCountryHeader))
+		if err := applyRequestTags(c, token); err != nil {
+			abortWithMessage(c, http.StatusBadRequest, err.Error())
+			return
+		}
 		c.Set("username", model.GetUsernameById(token.UserId))
 		if len(parts) > 1 {
 			if model.IsAdmin(token.UserId) {
@@ -201,20 +333,8 @@ func TokenAuth() func(c *gin.Context) {
 				return
 			}
 		}
-		c.Next()
-	}
-}
-
-func CryptCallbackAuth() func(c *gin.Context) {
-	return func(c *gin.Context) {
-		signature := c.Request.Header.Get("x-ca-signature")
-		url := "https://" + c.Request.Host + c.Request.URL.String()
-		err := model.VerifyCryptCallbackSignature(url, signature)
-		if err != nil {
-			logger.Error(c.Request.Context(), "crypt callback signature verification failed: "+err.Error())
-			abortWithMessage(c, http.StatusUnauthorized, err.Error())
-			return
-		}
+		authSpan.SetAttributes(attribute.Int("user_id", token.UserId), attribute.Int("token_id", token.Id))
+		authSpan.End()
 		c.Next()
 	}
 }
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay/util"
+)
+
+// CostHeaders 在 relay 响应中附带本次请求的计费信息，计费结果由各 relay 路径通过 util.PublishRequestCost 提交
+func CostHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.CostHeadersEnabled {
+			c.Next()
+			return
+		}
+		w := util.NewCostWriter(c)
+		defer w.Finish()
+		c.Next()
+	}
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -10,10 +11,12 @@ import (
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/metrics"
+	"github.com/songquanpeng/one-api/common/tracing"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/channel/midjourney"
 	relayconstant "github.com/songquanpeng/one-api/relay/constant"
 	"github.com/songquanpeng/one-api/service"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ModelRequest struct {
@@ -54,6 +57,9 @@ func extractModelNameFromGeminiPath(path string) string {
 
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		// 选渠耗时（分组、亲和、缓存查询），在 c.Next() 前结束
+		_, selectSpan := tracing.Start(c.Request.Context(), "distribute")
+		defer selectSpan.End()
 		userId := c.GetInt("id")
 		userGroup, _ := model.CacheGetUserGroup(userId)
 		c.Set("group", userGroup)
@@ -175,7 +181,9 @@ func Distribute() func(c *gin.Context) {
 
 		if channel != nil {
 			SetupContextForSelectedChannel(c, channel, requestModel)
+			selectSpan.SetAttributes(attribute.Int("channel_id", channel.Id), attribute.String("model", requestModel))
 		}
+		selectSpan.End()
 		c.Next()
 		// relay 层标记成功后写回规则亲和缓存（避免 SSE 流式响应下 HTTP 200 但实际失败时写入错误渠道）
 		if service.IsAffinityRelaySuccess(c) {
@@ -308,6 +316,9 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 		metrics.SetChannelInfo(channel.Id, channel.Type, common.GetModelProvider(modelName, channel.Type))
 	}
 
+	// 每次选渠（含重试）在服务端 span 上记一个事件，配合 upstream span 还原重试过程
+	tracing.AddEvent(c.Request.Context(), "channel.attempt", attribute.Int("channel_id", channel.Id), attribute.String("model", modelName))
+
 	c.Set("channel", channel.Type)
 	c.Set("channel_id", channel.Id)
 	c.Set("channel_name", channel.Name)
@@ -330,6 +341,13 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 		}
 	}
 	c.Set("user_channel_ratio", userChannelRatio)
+	// 用户/分组的合同定价计划（阶梯或按模型合同价），与上面两项一样并入组合倍率
+	planRatio, planApplied := model.GetPricingPlanAdjustment(c.GetInt("id"), c.GetString("group"), modelName)
+	c.Set("pricing_plan_ratio", planRatio)
+	if planApplied != nil {
+		ctx := context.WithValue(c.Request.Context(), logger.PricingPlanCtxKey, planApplied)
+		c.Request = c.Request.WithContext(ctx)
+	}
 	// 设置自定义请求头覆盖配置
 	if headersOverride := channel.GetHeaderOverride(); headersOverride != nil {
 		c.Set("headers_override", headersOverride)
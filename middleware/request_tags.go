@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// requestTagFields 只解出请求体中与标签相关的字段
+type requestTagFields struct {
+	Metadata json.RawMessage `json:"metadata"`
+	User     json.RawMessage `json:"user"`
+}
+
+// applyRequestTags 解析 X-OneAPI-Tags 请求头与 JSON 请求体的 metadata / user 字段，
+// 结果放入请求 context 供消费日志写入 log_tags。返回的错误只来自请求头，调用方应以 400 拒绝请求
+func applyRequestTags(c *gin.Context, token *model.Token) error {
+	if !config.RequestTagsEnabled {
+		return nil
+	}
+	header := c.Request.Header.Get(model.RequestTagsHeader)
+	metadata := map[string]string{}
+	var user string
+	if c.Request.Method == http.MethodPost && strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		// 请求体已被缓存，后续 Distribute 和 relay 读取时不会重复读
+		body, err := common.GetRequestBody(c)
+		if err == nil {
+			var fields requestTagFields
+			// 请求体格式错误交给后续 relay 报告，这里只是取不到标签
+			if json.Unmarshal(body, &fields) == nil {
+				// metadata 不是对象或值不是字符串时忽略对应条目
+				var entries map[string]json.RawMessage
+				_ = json.Unmarshal(fields.Metadata, &entries)
+				for key, raw := range entries {
+					var value string
+					if json.Unmarshal(raw, &value) == nil {
+						metadata[key] = value
+					}
+				}
+				_ = json.Unmarshal(fields.User, &user)
+			}
+		}
+	}
+	tags, err := model.BuildRequestTags(header, metadata, user, token.AllowedTagKeys)
+	if err != nil || tags == nil {
+		return err
+	}
+	ctx := context.WithValue(c.Request.Context(), logger.RequestTagsCtxKey, tags)
+	c.Request = c.Request.WithContext(ctx)
+	return nil
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/metrics"
+	"github.com/songquanpeng/one-api/common/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing 为每个请求创建服务端 span，并沿用客户端传入的 W3C traceparent。
+//
+// 挂在根引擎上、紧跟 RequestId 之后：鉴权、选渠、relay 里的各段 span 都从 c.Request.Context()
+// 派生，必须先于它们把 span 放进去。请求结束后再把 Distribute / relay 写入 gin context 的
+// 渠道、模型等信息补到 span 上 —— 这些值在请求开始时还不知道。
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !tracing.Enabled() {
+			c.Next()
+			return
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx := tracing.Extract(c.Request.Context(), c.Request.Header)
+		ctx, span := tracing.Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("request_id", c.GetString(logger.RequestIdKey)),
+			),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []attribute.KeyValue{attribute.Int("http.response.status_code", status)}
+		if v := c.GetInt("id"); v > 0 {
+			attrs = append(attrs, attribute.Int("user_id", v))
+		}
+		if v := c.GetInt("token_id"); v > 0 {
+			attrs = append(attrs, attribute.Int("token_id", v))
+		}
+		if v := c.GetString("group"); v != "" {
+			attrs = append(attrs, attribute.String("group", v))
+		}
+		if v := c.GetInt("channel_id"); v > 0 {
+			attrs = append(attrs, attribute.Int("channel_id", v))
+		}
+		if v := resolveModel(c); v != "" {
+			attrs = append(attrs, attribute.String("model", v))
+		}
+		span.SetAttributes(attrs...)
+		// 与 RelayMetrics 同一口径：流式中途失败时状态码仍是 200，以 relay 层标记为准
+		if _, relayFailed := c.Get(metrics.CtxRelayFailedKey); relayFailed || status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
 	"net/http"
 	"net/url"
 )
@@ -79,3 +81,22 @@ func TurnstileCheck() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// LoginTurnstileCheck 仅对连续登录失败达到阈值的账号要求 Turnstile
+func LoginTurnstileCheck() gin.HandlerFunc {
+	turnstileCheck := TurnstileCheck()
+	return func(c *gin.Context) {
+		var req struct {
+			Username string `json:"username"`
+		}
+		body, err := common.GetRequestBody(c)
+		if err == nil && json.Unmarshal(body, &req) == nil && req.Username != "" {
+			accountKey, _ := model.ResolveLoginAccount(req.Username)
+			if model.LoginRequiresTurnstile(accountKey) {
+				turnstileCheck(c)
+				return
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,353 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	AffiliateSourceTopUp        = "topup"
+	AffiliateSourceSubscription = "subscription"
+)
+
+const (
+	AffiliateStatusPending    = "pending"     // 冻结期内，管理员可审核拒绝
+	AffiliateStatusAvailable  = "available"   // 已转入可提取余额
+	AffiliateStatusRejected   = "rejected"    // 冻结期内被拒绝
+	AffiliateStatusClawedBack = "clawed_back" // 付款退款后收回
+)
+
+// AffiliateCommission 一笔返佣，每个充值订单或订阅账单至多产生一笔
+type AffiliateCommission struct {
+	Id            int     `json:"id"`
+	InviterId     int     `json:"inviter_id" gorm:"index"`
+	InviteeId     int     `json:"invitee_id" gorm:"index"`
+	SourceType    string  `json:"source_type" gorm:"type:varchar(16);uniqueIndex:idx_affiliate_source"`
+	SourceId      string  `json:"source_id" gorm:"type:varchar(255);uniqueIndex:idx_affiliate_source"` // 充值订单号或 Stripe 账单号
+	BaseQuota     int64   `json:"base_quota" gorm:"bigint"`
+	Money         float64 `json:"money"`
+	Currency      string  `json:"currency" gorm:"type:varchar(10)"`
+	Percent       float64 `json:"percent"`
+	Commission    int64   `json:"commission" gorm:"bigint"`
+	Status        string  `json:"status" gorm:"type:varchar(16);index"`
+	AvailableTime int64   `json:"available_time" gorm:"bigint;index"` // 冻结期结束时间
+	ReviewedBy    int     `json:"reviewed_by"`
+	Note          string  `json:"note" gorm:"type:varchar(255)"`
+	CreatedTime   int64   `json:"created_time" gorm:"bigint"`
+	UpdatedTime   int64   `json:"updated_time" gorm:"bigint"`
+}
+
+// AffiliateAccount 邀请人的返佣余额，与用户额度分开记账；AvailableQuota 在收回已结算返佣后可能为负
+type AffiliateAccount struct {
+	Id             int   `json:"id"`
+	UserId         int   `json:"user_id" gorm:"uniqueIndex"`
+	PendingQuota   int64 `json:"pending_quota" gorm:"bigint"`
+	AvailableQuota int64 `json:"available_quota" gorm:"bigint"`
+	WithdrawnQuota int64 `json:"withdrawn_quota" gorm:"bigint"`
+	TotalEarned    int64 `json:"total_earned" gorm:"bigint"`
+	UpdatedTime    int64 `json:"updated_time" gorm:"bigint"`
+}
+
+func updateAffiliateAccount(tx *gorm.DB, userId int, updates map[string]interface{}) error {
+	now := helper.GetTimestamp()
+	account := &AffiliateAccount{UserId: userId, UpdatedTime: now}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(account).Error; err != nil {
+		return err
+	}
+	assignments := map[string]interface{}{"updated_time": now}
+	for column, delta := range updates {
+		assignments[column] = gorm.Expr(column+" + ?", delta)
+	}
+	return tx.Model(&AffiliateAccount{}).Where("user_id = ?", userId).Updates(assignments).Error
+}
+
+// recordAffiliateCommission 被邀请人充值成功后在同一事务内记录返佣，同一来源重复调用不会重复返佣
+func recordAffiliateCommission(tx *gorm.DB, inviteeId int, sourceType string, sourceId string, baseQuota int64, money float64, currency string) error {
+	percent := config.AffiliateCommissionPercent
+	if percent <= 0 || baseQuota <= 0 || inviteeId == 0 {
+		return nil
+	}
+	invitee := &User{}
+	if err := tx.Select("id", "inviter_id", "created_time").Where("id = ?", inviteeId).First(invitee).Error; err != nil {
+		return nil
+	}
+	// 注册时间未知的老用户不参与按比例返佣
+	if invitee.InviterId == 0 || invitee.CreatedTime == 0 {
+		return nil
+	}
+	now := time.Now()
+	if now.After(time.Unix(invitee.CreatedTime, 0).AddDate(0, config.AffiliateCommissionMonths, 0)) {
+		return nil
+	}
+	commission := int64(float64(baseQuota) * percent / 100)
+	if config.AffiliateCommissionCap > 0 {
+		var earned int64
+		err := tx.Model(&AffiliateCommission{}).
+			Where("inviter_id = ? AND invitee_id = ? AND status IN ?", invitee.InviterId, inviteeId,
+				[]string{AffiliateStatusPending, AffiliateStatusAvailable}).
+			Select("COALESCE(SUM(commission), 0)").Scan(&earned).Error
+		if err != nil {
+			return err
+		}
+		if remaining := config.AffiliateCommissionCap - earned; commission > remaining {
+			commission = remaining
+		}
+	}
+	if commission <= 0 {
+		return nil
+	}
+	record := &AffiliateCommission{
+		InviterId:     invitee.InviterId,
+		InviteeId:     inviteeId,
+		SourceType:    sourceType,
+		SourceId:      sourceId,
+		BaseQuota:     baseQuota,
+		Money:         money,
+		Currency:      currency,
+		Percent:       percent,
+		Commission:    commission,
+		Status:        AffiliateStatusPending,
+		AvailableTime: now.AddDate(0, 0, config.AffiliateHoldDays).Unix(),
+		CreatedTime:   now.Unix(),
+		UpdatedTime:   now.Unix(),
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	return updateAffiliateAccount(tx, invitee.InviterId, map[string]interface{}{
+		"pending_quota": commission,
+		"total_earned":  commission,
+	})
+}
+
+// transitionAffiliateCommission 按状态机迁移一笔返佣并同步余额，from 不匹配时返回错误
+func transitionAffiliateCommission(id int, from []string, to string, operatorId int, note string) (*AffiliateCommission, error) {
+	commission := &AffiliateCommission{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(commission, id).Error; err != nil {
+			return errors.New("返佣记录不存在")
+		}
+		allowed := false
+		for _, status := range from {
+			if commission.Status == status {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("当前状态 %s 不能变更为 %s", commission.Status, to)
+		}
+		// 以读到的状态为条件更新，并发迁移同一笔返佣时只有一个能成功，余额只变动一次
+		result := tx.Model(&AffiliateCommission{}).Where("id = ? AND status = ?", id, commission.Status).Updates(map[string]interface{}{
+			"status":       to,
+			"reviewed_by":  operatorId,
+			"note":         note,
+			"updated_time": helper.GetTimestamp(),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("返佣记录已被修改，请刷新后重试")
+		}
+		amount := commission.Commission
+		deltas := map[string]interface{}{}
+		switch commission.Status {
+		case AffiliateStatusPending:
+			deltas["pending_quota"] = -amount
+		case AffiliateStatusAvailable:
+			deltas["available_quota"] = -amount
+		}
+		if to == AffiliateStatusAvailable {
+			deltas["available_quota"] = amount
+		} else {
+			deltas["total_earned"] = -amount
+		}
+		commission.Status = to
+		return updateAffiliateAccount(tx, commission.InviterId, deltas)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return commission, nil
+}
+
+// ApproveAffiliateCommission 管理员审核通过，不等冻结期结束直接转为可提取
+func ApproveAffiliateCommission(id int, operatorId int) (*AffiliateCommission, error) {
+	return transitionAffiliateCommission(id, []string{AffiliateStatusPending}, AffiliateStatusAvailable, operatorId, "")
+}
+
+func RejectAffiliateCommission(id int, operatorId int, note string) (*AffiliateCommission, error) {
+	return transitionAffiliateCommission(id, []string{AffiliateStatusPending}, AffiliateStatusRejected, operatorId, note)
+}
+
+// ClawbackAffiliateCommission 对应付款退款后收回返佣；已结算的从可提取余额中扣除，余额不足时记为负数
+func ClawbackAffiliateCommission(id int, operatorId int, note string) (*AffiliateCommission, error) {
+	commission, err := transitionAffiliateCommission(id, []string{AffiliateStatusPending, AffiliateStatusAvailable},
+		AffiliateStatusClawedBack, operatorId, note)
+	if err != nil {
+		return nil, err
+	}
+	RecordLog(commission.InviterId, LogTypeSystem, fmt.Sprintf("邀请返佣被收回 %s（来源 %s %s）",
+		common.LogQuota(commission.Commission), commission.SourceType, commission.SourceId))
+	return commission, nil
+}
+
+// SettleAffiliateCommissions 把冻结期已结束的返佣转为可提取
+func SettleAffiliateCommissions(now int64) {
+	var ids []int
+	if err := DB.Model(&AffiliateCommission{}).Where("status = ? AND available_time <= ?", AffiliateStatusPending, now).
+		Pluck("id", &ids).Error; err != nil {
+		logger.SysError("failed to load pending affiliate commissions: " + err.Error())
+		return
+	}
+	for _, id := range ids {
+		if _, err := transitionAffiliateCommission(id, []string{AffiliateStatusPending}, AffiliateStatusAvailable, 0, ""); err != nil {
+			logger.SysError(fmt.Sprintf("failed to settle affiliate commission %d: %s", id, err.Error()))
+		}
+	}
+}
+
+func StartAffiliateSettleTask() {
+	if !config.IsMasterNode {
+		return
+	}
+	go func() {
+		for {
+			SettleAffiliateCommissions(helper.GetTimestamp())
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+// TransferAffiliateQuota 把可提取的返佣转入用户额度
+func TransferAffiliateQuota(userId int, quota int64) error {
+	if quota <= 0 {
+		return errors.New("转出额度必须大于 0")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// 余额校验与扣减在同一条 UPDATE 中完成，并发转出不会透支
+		result := tx.Model(&AffiliateAccount{}).Where("user_id = ? AND available_quota >= ?", userId, quota).
+			Updates(map[string]interface{}{
+				"available_quota": gorm.Expr("available_quota - ?", quota),
+				"withdrawn_quota": gorm.Expr("withdrawn_quota + ?", quota),
+				"updated_time":    helper.GetTimestamp(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return errors.New("可提取的返佣不足")
+		}
+		return tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", quota)).Error
+	})
+	if err != nil {
+		return err
+	}
+	if err := CacheUpdateUserQuota2(userId); err != nil {
+		logger.SysError("failed to refresh user quota cache: " + err.Error())
+	}
+	RecordLog(userId, LogTypeTopup, fmt.Sprintf("邀请返佣转入余额 %s", common.LogQuota(quota)))
+	return nil
+}
+
+func GetAffiliateAccount(userId int) *AffiliateAccount {
+	account := &AffiliateAccount{UserId: userId}
+	DB.Where("user_id = ?", userId).Limit(1).Find(account)
+	return account
+}
+
+func GetAffiliateCommissions(inviterId int, status string, page int, pageSize int) (commissions []*AffiliateCommission, total int64, err error) {
+	tx := DB.Model(&AffiliateCommission{})
+	if inviterId != 0 {
+		tx = tx.Where("inviter_id = ?", inviterId)
+	}
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(pageSize).Offset((page - 1) * pageSize).Find(&commissions).Error
+	return commissions, total, err
+}
+
+// AffiliateInvitee 邀请人看板中的一名被邀请人，用户名打码
+type AffiliateInvitee struct {
+	UserId        int    `json:"user_id"`
+	Username      string `json:"username"`
+	CreatedTime   int64  `json:"created_time"`
+	TopUpAmount   int64  `json:"topup_amount"`
+	Commission    int64  `json:"commission"`
+	CommissionEnd int64  `json:"commission_end"` // 返佣截止时间，0 表示不参与按比例返佣
+}
+
+func maskAffiliateUsername(username string) string {
+	runes := []rune(username)
+	if len(runes) == 0 {
+		return ""
+	}
+	if len(runes) <= 2 {
+		return string(runes[:1]) + "***"
+	}
+	return string(runes[:2]) + "***"
+}
+
+func GetAffiliateInvitees(inviterId int, page int, pageSize int) (invitees []*AffiliateInvitee, total int64, err error) {
+	tx := DB.Model(&User{}).Where("inviter_id = ?", inviterId)
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var users []*User
+	err = tx.Select("id", "username", "created_time").Order("id desc").
+		Limit(pageSize).Offset((page - 1) * pageSize).Find(&users).Error
+	if err != nil || len(users) == 0 {
+		return nil, total, err
+	}
+	ids := make([]int, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.Id)
+	}
+	type sumRow struct {
+		UserId int
+		Total  int64
+	}
+	var topUps, commissions []sumRow
+	DB.Model(&TopUp{}).Where("user_id IN ? AND status = ?", ids, "success").
+		Select("user_id, COALESCE(SUM(amount), 0) as total").Group("user_id").Scan(&topUps)
+	DB.Model(&AffiliateCommission{}).
+		Where("inviter_id = ? AND invitee_id IN ? AND status IN ?", inviterId, ids,
+			[]string{AffiliateStatusPending, AffiliateStatusAvailable}).
+		Select("invitee_id as user_id, COALESCE(SUM(commission), 0) as total").Group("invitee_id").Scan(&commissions)
+	topUpMap := make(map[int]int64, len(topUps))
+	for _, row := range topUps {
+		topUpMap[row.UserId] = row.Total
+	}
+	commissionMap := make(map[int]int64, len(commissions))
+	for _, row := range commissions {
+		commissionMap[row.UserId] = row.Total
+	}
+	for _, user := range users {
+		invitee := &AffiliateInvitee{
+			UserId:      user.Id,
+			Username:    maskAffiliateUsername(user.Username),
+			CreatedTime: user.CreatedTime,
+			TopUpAmount: topUpMap[user.Id],
+			Commission:  commissionMap[user.Id],
+		}
+		if user.CreatedTime > 0 {
+			invitee.CommissionEnd = time.Unix(user.CreatedTime, 0).AddDate(0, config.AffiliateCommissionMonths, 0).Unix()
+		}
+		invitees = append(invitees, invitee)
+	}
+	return invitees, total, nil
+}
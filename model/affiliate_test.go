@@ -0,0 +1,94 @@
+package model
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+func TestAffiliateCommissionLifecycle(t *testing.T) {
+	setupTestDB(t, &Log{}, &TopUp{}, &AffiliateCommission{}, &AffiliateAccount{})
+	origLogDB, origRedis := LOG_DB, common.RedisEnabled
+	origPercent, origCap, origHold := config.AffiliateCommissionPercent, config.AffiliateCommissionCap, config.AffiliateHoldDays
+	LOG_DB, common.RedisEnabled = DB, false
+	config.AffiliateCommissionPercent, config.AffiliateCommissionCap, config.AffiliateHoldDays = 10, int64(0.15*config.QuotaPerUnit), 7
+	t.Cleanup(func() {
+		LOG_DB, common.RedisEnabled = origLogDB, origRedis
+		config.AffiliateCommissionPercent, config.AffiliateCommissionCap, config.AffiliateHoldDays = origPercent, origCap, origHold
+	})
+
+	now := helper.GetTimestamp()
+	DB.Create(&User{Id: 1, Username: "inviter", AccessToken: "a", AffCode: "a", CreatedTime: now})
+	DB.Create(&User{Id: 2, Username: "invitee", AccessToken: "b", AffCode: "b", InviterId: 1, CreatedTime: now})
+	for _, tradeNo := range []string{"t1", "t2"} {
+		DB.Create(&TopUp{UserId: 2, Amount: 1, TradeNo: tradeNo, Status: "pending", CreateTime: now})
+		if err := CompleteTopUpOrder(tradeNo); err != nil {
+			t.Fatalf("完成充值失败: %v", err)
+		}
+	}
+	// 重放回调不应重复返佣
+	_ = CompleteTopUpOrder("t1")
+
+	account := GetAffiliateAccount(1)
+	want := int64(0.15 * config.QuotaPerUnit)
+	if account.PendingQuota != want || account.AvailableQuota != 0 {
+		t.Fatalf("两笔 10%% 返佣应被上限截断为 %d，实际 pending=%d", want, account.PendingQuota)
+	}
+	if err := TransferAffiliateQuota(1, 1); err == nil {
+		t.Error("冻结中的返佣不能提取")
+	}
+
+	var commissions []*AffiliateCommission
+	DB.Order("id").Find(&commissions)
+	if len(commissions) != 2 {
+		t.Fatalf("应有 2 笔返佣，实际 %d", len(commissions))
+	}
+	// 并发结算同一批返佣，每笔只能转为可提取一次
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			SettleAffiliateCommissions(now + 8*86400)
+		}()
+	}
+	wg.Wait()
+	account = GetAffiliateAccount(1)
+	if account.PendingQuota != 0 || account.AvailableQuota != want {
+		t.Fatalf("冻结期结束后应转为可提取，实际 %+v", account)
+	}
+
+	// 并发提取全部余额只能成功一次；第一笔已被提取后退款收回，可提取余额记为负数
+	var transferred int32
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if TransferAffiliateQuota(1, want) == nil {
+				atomic.AddInt32(&transferred, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if transferred != 1 {
+		t.Fatalf("并发提取应恰好成功 1 次，实际 %d", transferred)
+	}
+	if _, err := ClawbackAffiliateCommission(commissions[0].Id, 99, "refund"); err != nil {
+		t.Fatalf("收回返佣失败: %v", err)
+	}
+	account = GetAffiliateAccount(1)
+	if account.AvailableQuota != -commissions[0].Commission || account.TotalEarned != commissions[1].Commission {
+		t.Errorf("收回后余额不符: %+v", account)
+	}
+	if _, err := ClawbackAffiliateCommission(commissions[0].Id, 99, "refund"); err == nil {
+		t.Error("同一笔返佣不能重复收回")
+	}
+	quota, _ := GetUserQuota(1)
+	if quota != want {
+		t.Errorf("提取的返佣应进入用户余额，实际 %d", quota)
+	}
+}
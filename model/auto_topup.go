@@ -0,0 +1,386 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
+	"github.com/songquanpeng/one-api/common/payment"
+	"github.com/stripe/stripe-go/v78"
+	"github.com/stripe/stripe-go/v78/paymentintent"
+	"gorm.io/gorm/clause"
+)
+
+const AutoTopUpPaymentMethod = "stripe_auto"
+
+// 连续失败达到该次数后自动关闭，避免对失效的卡反复扣款
+const autoTopUpMaxFailures = 3
+
+const (
+	// 扣款成功后入账失败时的进程内重试次数，仍失败则留给对账任务
+	autoTopUpCompleteRetries = 3
+	// 对账任务只处理创建超过该时长的 pending 订单，避开进行中的扣款和 Stripe 搜索索引的延迟
+	autoTopUpReconcileDelay = 10 * time.Minute
+)
+
+// AutoTopUpSetting 自动充值：余额低于 ThresholdQuota 时用保存的 Stripe 支付方式充值 Amount
+type AutoTopUpSetting struct {
+	Id             int    `json:"id"`
+	UserId         int    `json:"user_id" gorm:"uniqueIndex"`
+	Enabled        bool   `json:"enabled"`
+	ThresholdQuota int64  `json:"threshold_quota" gorm:"bigint"`
+	Amount         int64  `json:"amount"`           // 每次充值数量，与 TopUp.Amount 同单位
+	DailyMaxAmount int64  `json:"daily_max_amount"` // 每天自动充值数量上限
+	CustomerId     string `json:"-" gorm:"type:varchar(128)"`
+	PaymentMethod  string `json:"-" gorm:"type:varchar(128)"`
+	CardSummary    string `json:"card_summary" gorm:"type:varchar(64)"` // 如 visa ****4242，仅用于展示
+	FailureCount   int    `json:"failure_count" gorm:"default:0"`
+	LastError      string `json:"last_error" gorm:"type:varchar(255)"`
+	LastChargeTime int64  `json:"last_charge_time" gorm:"bigint"`
+	CapNoticeDay   string `json:"-" gorm:"type:varchar(10)"` // 当天已发过达到上限的通知
+	UpdatedTime    int64  `json:"updated_time" gorm:"bigint"`
+}
+
+func GetAutoTopUpSetting(userId int) (*AutoTopUpSetting, error) {
+	setting := &AutoTopUpSetting{}
+	err := DB.Where("user_id = ?", userId).First(setting).Error
+	return setting, err
+}
+
+// SaveAutoTopUpRule 保存充值规则；开启前必须已绑定支付方式
+func SaveAutoTopUpRule(userId int, enabled bool, threshold int64, amount int64, dailyMax int64) error {
+	if enabled {
+		if threshold <= 0 {
+			return errors.New("threshold_quota must be > 0")
+		}
+		if amount < int64(config.StripeMinTopUp) || amount > 10000 {
+			return fmt.Errorf("amount must be between %d and 10000", config.StripeMinTopUp)
+		}
+		if dailyMax < amount {
+			return errors.New("daily_max_amount must be >= amount")
+		}
+		setting, err := GetAutoTopUpSetting(userId)
+		if err != nil || setting.PaymentMethod == "" {
+			return errors.New("please save a payment method first")
+		}
+	}
+	setting := &AutoTopUpSetting{
+		UserId:         userId,
+		Enabled:        enabled,
+		ThresholdQuota: threshold,
+		Amount:         amount,
+		DailyMaxAmount: dailyMax,
+		UpdatedTime:    helper.GetTimestamp(),
+	}
+	err := DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"enabled":          enabled,
+			"threshold_quota":  threshold,
+			"amount":           amount,
+			"daily_max_amount": dailyMax,
+			"failure_count":    0,
+			"updated_time":     setting.UpdatedTime,
+		}),
+	}).Create(setting).Error
+	if err != nil {
+		return err
+	}
+	invalidateAutoTopUp(userId)
+	return nil
+}
+
+// SaveAutoTopUpPaymentMethod 保存 Stripe Checkout（setup 模式）绑定的支付方式
+func SaveAutoTopUpPaymentMethod(userId int, customerId string, paymentMethod string, cardSummary string) error {
+	setting := &AutoTopUpSetting{
+		UserId:        userId,
+		CustomerId:    customerId,
+		PaymentMethod: paymentMethod,
+		CardSummary:   cardSummary,
+		UpdatedTime:   helper.GetTimestamp(),
+	}
+	err := DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"customer_id":    customerId,
+			"payment_method": paymentMethod,
+			"card_summary":   cardSummary,
+			"failure_count":  0,
+			"last_error":     "",
+			"updated_time":   setting.UpdatedTime,
+		}),
+	}).Create(setting).Error
+	if err != nil {
+		return err
+	}
+	invalidateAutoTopUp(userId)
+	return nil
+}
+
+// 开启了自动充值的阈值缓存，扣费热路径只读内存
+const autoTopUpCacheSeconds = 60
+
+type autoTopUpEntry struct {
+	threshold int64 // 0 表示未开启
+	loadedAt  int64
+}
+
+var (
+	autoTopUpCache   sync.Map
+	autoTopUpRunning sync.Map
+)
+
+func invalidateAutoTopUp(userId int) {
+	autoTopUpCache.Delete(userId)
+}
+
+func getAutoTopUpThreshold(userId int) int64 {
+	now := helper.GetTimestamp()
+	if v, ok := autoTopUpCache.Load(userId); ok {
+		entry := v.(*autoTopUpEntry)
+		if now-entry.loadedAt < autoTopUpCacheSeconds {
+			return entry.threshold
+		}
+	}
+	var threshold int64
+	DB.Model(&AutoTopUpSetting{}).Where("user_id = ? AND enabled = ?", userId, true).
+		Select("threshold_quota").Limit(1).Find(&threshold)
+	autoTopUpCache.Store(userId, &autoTopUpEntry{threshold: threshold, loadedAt: now})
+	return threshold
+}
+
+// triggerAutoTopUp 扣减用户额度后调用，开启了自动充值的用户异步检查是否需要充值
+func triggerAutoTopUp(userId int) {
+	if getAutoTopUpThreshold(userId) <= 0 {
+		return
+	}
+	if _, running := autoTopUpRunning.LoadOrStore(userId, true); running {
+		return
+	}
+	go func() {
+		defer autoTopUpRunning.Delete(userId)
+		runAutoTopUp(userId)
+	}()
+}
+
+// autoTopUpCharge 用保存的支付方式扣款，测试中替换
+var autoTopUpCharge = chargeAutoTopUpWithStripe
+
+func chargeAutoTopUpWithStripe(setting *AutoTopUpSetting, tradeNo string, money float64) error {
+	if config.StripeApiSecret == "" {
+		return errors.New("stripe is not configured")
+	}
+	stripe.Key = config.StripeApiSecret
+	params := &stripe.PaymentIntentParams{
+		Amount:        stripe.Int64(int64(math.Round(money * 100))),
+		Currency:      stripe.String(string(stripe.CurrencyUSD)),
+		Customer:      stripe.String(setting.CustomerId),
+		PaymentMethod: stripe.String(setting.PaymentMethod),
+		OffSession:    stripe.Bool(true),
+		Confirm:       stripe.Bool(true),
+		Description:   stripe.String("Auto top-up " + tradeNo),
+	}
+	params.SetIdempotencyKey(tradeNo)
+	params.AddMetadata("trade_no", tradeNo)
+	intent, err := paymentintent.New(params)
+	if err != nil {
+		return err
+	}
+	if intent.Status != stripe.PaymentIntentStatusSucceeded {
+		return fmt.Errorf("payment status is %s", intent.Status)
+	}
+	return nil
+}
+
+// autoTopUpLookup 按 trade_no 查询 Stripe 上的扣款状态，found 为 false 表示从未扣款，测试中替换
+var autoTopUpLookup = lookupAutoTopUpWithStripe
+
+func lookupAutoTopUpWithStripe(tradeNo string) (status stripe.PaymentIntentStatus, found bool, err error) {
+	if config.StripeApiSecret == "" {
+		return "", false, errors.New("stripe is not configured")
+	}
+	stripe.Key = config.StripeApiSecret
+	params := &stripe.PaymentIntentSearchParams{}
+	params.Query = fmt.Sprintf("metadata['trade_no']:'%s'", tradeNo)
+	iter := paymentintent.Search(params)
+	for iter.Next() {
+		intent := iter.PaymentIntent()
+		if intent.Status == stripe.PaymentIntentStatusSucceeded {
+			return intent.Status, true, nil
+		}
+		status, found = intent.Status, true
+	}
+	return status, found, iter.Err()
+}
+
+func autoTopUpDayStart(now time.Time) int64 {
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).Unix()
+}
+
+func runAutoTopUp(userId int) {
+	lockKey := fmt.Sprintf("auto_topup_lock:%d", userId)
+	lockToken := common.RedisLockAcquire(lockKey, 2*time.Minute)
+	if lockToken == "" {
+		return
+	}
+	defer common.RedisLockRelease(lockKey, lockToken)
+
+	setting, err := GetAutoTopUpSetting(userId)
+	if err != nil || !setting.Enabled || setting.PaymentMethod == "" {
+		return
+	}
+	quota, err := GetUserQuota(userId)
+	if err != nil || quota >= setting.ThresholdQuota {
+		return
+	}
+
+	now := time.Now()
+	// pending 的订单可能已经扣款，只是还没入账，同样计入当日上限
+	var chargedToday int64
+	DB.Model(&TopUp{}).Where("user_id = ? AND payment_method = ? AND status IN ? AND create_time >= ?",
+		userId, AutoTopUpPaymentMethod, []string{"success", "pending"}, autoTopUpDayStart(now)).
+		Select("COALESCE(SUM(amount), 0)").Scan(&chargedToday)
+	if chargedToday+setting.Amount > setting.DailyMaxAmount {
+		today := now.Format("2006-01-02")
+		if setting.CapNoticeDay != today {
+			DB.Model(setting).Update("cap_notice_day", today)
+			go notifyAutoTopUp(userId, "自动充值已达到今日上限",
+				fmt.Sprintf("今日自动充值已达到上限 %d，余额低于阈值时将不再自动充值，请手动充值或调整上限。", setting.DailyMaxAmount))
+		}
+		return
+	}
+
+	tradeNo := "auto_" + strings.ReplaceAll(helper.GetUUID(), "-", "")[:24]
+	money := float64(setting.Amount) * config.StripeUnitPrice
+	topUp := &TopUp{
+		UserId:        userId,
+		Amount:        setting.Amount,
+		Money:         money,
+		TradeNo:       tradeNo,
+		PaymentMethod: AutoTopUpPaymentMethod,
+		Provider:      payment.ProviderStripe,
+		CreateTime:    helper.GetTimestamp(),
+		Status:        "pending",
+		Currency:      "USD",
+	}
+	if err := topUp.Insert(); err != nil {
+		logger.SysError("failed to create auto top-up order: " + err.Error())
+		return
+	}
+
+	if err := autoTopUpCharge(setting, tradeNo, money); err != nil {
+		recordAutoTopUpFailure(setting, tradeNo, err)
+		return
+	}
+	for attempt := 0; attempt < autoTopUpCompleteRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		if err = CompleteTopUpOrder(tradeNo); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		// 订单保持 pending，由 ReconcileAutoTopUps 按 Stripe 上的扣款结果补入账
+		logger.SysError(fmt.Sprintf("auto top-up %s charged but failed to complete, left for reconciliation: %s", tradeNo, err.Error()))
+		return
+	}
+	DB.Model(setting).Updates(map[string]interface{}{
+		"failure_count":    0,
+		"last_error":       "",
+		"last_charge_time": helper.GetTimestamp(),
+	})
+	if err := CacheUpdateUserQuota2(userId); err != nil {
+		logger.SysError("failed to refresh user quota cache: " + err.Error())
+	}
+}
+
+// StartAutoTopUpReconcileTask 定期对账自动充值的 pending 订单（仅 master 节点执行）
+func StartAutoTopUpReconcileTask() {
+	if !config.IsMasterNode {
+		return
+	}
+	go func() {
+		for {
+			ReconcileAutoTopUps(time.Now())
+			time.Sleep(autoTopUpReconcileDelay)
+		}
+	}()
+}
+
+// ReconcileAutoTopUps 处理创建超过 autoTopUpReconcileDelay 仍为 pending 的自动充值订单：
+// Stripe 上已扣款的补入账，从未扣款或扣款已失败的标记为 failed，处理中的留到下一轮。只查询不重新扣款
+func ReconcileAutoTopUps(now time.Time) {
+	var orders []*TopUp
+	err := DB.Where("payment_method = ? AND status = ? AND create_time <= ?",
+		AutoTopUpPaymentMethod, "pending", now.Add(-autoTopUpReconcileDelay).Unix()).
+		Order("id asc").Limit(100).Find(&orders).Error
+	if err != nil {
+		logger.SysError("failed to load pending auto top-up orders: " + err.Error())
+		return
+	}
+	for _, order := range orders {
+		status, found, err := autoTopUpLookup(order.TradeNo)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("auto top-up %s reconciliation lookup failed: %s", order.TradeNo, err.Error()))
+			continue
+		}
+		switch {
+		case found && status == stripe.PaymentIntentStatusSucceeded:
+			if err := CompleteTopUpOrder(order.TradeNo); err != nil {
+				logger.SysError(fmt.Sprintf("auto top-up %s reconciliation failed to complete: %s", order.TradeNo, err.Error()))
+				continue
+			}
+			if err := CacheUpdateUserQuota2(order.UserId); err != nil {
+				logger.SysError("failed to refresh user quota cache: " + err.Error())
+			}
+			logger.SysLog(fmt.Sprintf("auto top-up %s completed by reconciliation", order.TradeNo))
+		case !found || status == stripe.PaymentIntentStatusCanceled || status == stripe.PaymentIntentStatusRequiresPaymentMethod:
+			DB.Model(&TopUp{}).Where("trade_no = ? AND status = ?", order.TradeNo, "pending").
+				Updates(map[string]interface{}{"status": "failed", "complete_time": helper.GetTimestamp()})
+		}
+	}
+}
+
+func recordAutoTopUpFailure(setting *AutoTopUpSetting, tradeNo string, chargeErr error) {
+	DB.Model(&TopUp{}).Where("trade_no = ? AND status = ?", tradeNo, "pending").
+		Updates(map[string]interface{}{"status": "failed", "complete_time": helper.GetTimestamp()})
+	reason := chargeErr.Error()
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+	updates := map[string]interface{}{
+		"failure_count": setting.FailureCount + 1,
+		"last_error":    reason,
+	}
+	content := fmt.Sprintf("自动充值扣款失败：%s。", reason)
+	if setting.FailureCount+1 >= autoTopUpMaxFailures {
+		updates["enabled"] = false
+		content += "连续失败次数过多，自动充值已关闭，请更新支付方式后重新开启。"
+	}
+	DB.Model(setting).Updates(updates)
+	invalidateAutoTopUp(setting.UserId)
+	logger.SysError(fmt.Sprintf("auto top-up %s for user %d failed: %s", tradeNo, setting.UserId, reason))
+	go notifyAutoTopUp(setting.UserId, "自动充值失败", content)
+}
+
+// notifyAutoTopUp 邮件通知在后台发送，测试中替换
+var notifyAutoTopUp = sendAutoTopUpEmail
+
+func sendAutoTopUpEmail(userId int, subject string, content string) {
+	email, err := GetUserEmail(userId)
+	if err != nil || email == "" {
+		return
+	}
+	if err := message.SendEmail(subject, email, content); err != nil {
+		logger.SysError(fmt.Sprintf("failed to send auto top-up email to user %d: %s", userId, err.Error()))
+	}
+}
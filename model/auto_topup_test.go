@@ -0,0 +1,134 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/stripe/stripe-go/v78"
+)
+
+func TestAutoTopUpChargesWithinDailyCap(t *testing.T) {
+	setupTestDB(t, &Log{}, &TopUp{}, &AutoTopUpSetting{})
+	origLogDB, origRedis, origCharge, origNotify := LOG_DB, common.RedisEnabled, autoTopUpCharge, notifyAutoTopUp
+	LOG_DB, common.RedisEnabled = DB, false
+	notifyAutoTopUp = func(int, string, string) {}
+	t.Cleanup(func() {
+		LOG_DB, common.RedisEnabled, autoTopUpCharge, notifyAutoTopUp = origLogDB, origRedis, origCharge, origNotify
+	})
+
+	user := &User{Id: 5, Username: "dave", Quota: 10, AccessToken: "d", AffCode: "d"}
+	if err := DB.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	if err := SaveAutoTopUpRule(user.Id, true, 1000, 2, 3); err == nil {
+		t.Error("未绑定支付方式时不能开启自动充值")
+	}
+	if err := SaveAutoTopUpPaymentMethod(user.Id, "cus_1", "pm_1", "visa ****4242"); err != nil {
+		t.Fatalf("保存支付方式失败: %v", err)
+	}
+	if err := SaveAutoTopUpRule(user.Id, true, 1000, 2, 3); err != nil {
+		t.Fatalf("开启自动充值失败: %v", err)
+	}
+
+	charges := 0
+	autoTopUpCharge = func(setting *AutoTopUpSetting, tradeNo string, money float64) error {
+		charges++
+		return nil
+	}
+	runAutoTopUp(user.Id)
+	quota, _ := GetUserQuota(user.Id)
+	if charges != 1 || quota != 10+int64(2*config.QuotaPerUnit) {
+		t.Fatalf("余额低于阈值应充值一次，实际 charges=%d quota=%d", charges, quota)
+	}
+
+	DB.Model(&User{}).Where("id = ?", user.Id).Update("quota", 0)
+	runAutoTopUp(user.Id)
+	if charges != 1 {
+		t.Error("超过每日上限后不应再扣款")
+	}
+
+	DB.Model(&TopUp{}).Where("user_id = ?", user.Id).Update("create_time", 1)
+	autoTopUpCharge = func(setting *AutoTopUpSetting, tradeNo string, money float64) error {
+		return errors.New("card_declined")
+	}
+	for i := 0; i < autoTopUpMaxFailures; i++ {
+		runAutoTopUp(user.Id)
+	}
+	setting, _ := GetAutoTopUpSetting(user.Id)
+	if setting.Enabled || setting.FailureCount != autoTopUpMaxFailures {
+		t.Errorf("连续失败后应自动关闭，实际 enabled=%v failures=%d", setting.Enabled, setting.FailureCount)
+	}
+	var failed int64
+	DB.Model(&TopUp{}).Where("user_id = ? AND status = ?", user.Id, "failed").Count(&failed)
+	if failed != autoTopUpMaxFailures {
+		t.Errorf("失败的扣款应记为 failed 订单，实际 %d", failed)
+	}
+}
+
+func TestAutoTopUpReconcilesPendingOrders(t *testing.T) {
+	setupTestDB(t, &Log{}, &TopUp{}, &AutoTopUpSetting{})
+	origLogDB, origRedis, origCharge, origLookup, origNotify := LOG_DB, common.RedisEnabled, autoTopUpCharge, autoTopUpLookup, notifyAutoTopUp
+	LOG_DB, common.RedisEnabled = DB, false
+	notifyAutoTopUp = func(int, string, string) {}
+	t.Cleanup(func() {
+		LOG_DB, common.RedisEnabled, autoTopUpCharge, autoTopUpLookup, notifyAutoTopUp = origLogDB, origRedis, origCharge, origLookup, origNotify
+	})
+
+	user := &User{Id: 6, Username: "erin", Quota: 10, AccessToken: "e", AffCode: "e"}
+	if err := DB.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	if err := SaveAutoTopUpPaymentMethod(user.Id, "cus_1", "pm_1", "visa ****4242"); err != nil {
+		t.Fatalf("保存支付方式失败: %v", err)
+	}
+	if err := SaveAutoTopUpRule(user.Id, true, 1000, 2, 3); err != nil {
+		t.Fatalf("开启自动充值失败: %v", err)
+	}
+
+	// 已扣款但未入账的 pending 订单计入当日上限，不会再次扣款
+	now := time.Now()
+	pending := &TopUp{UserId: user.Id, Amount: 2, Money: 2 * config.StripeUnitPrice, TradeNo: "auto_charged",
+		PaymentMethod: AutoTopUpPaymentMethod, CreateTime: now.Unix(), Status: "pending"}
+	if err := pending.Insert(); err != nil {
+		t.Fatalf("创建订单失败: %v", err)
+	}
+	charges := 0
+	autoTopUpCharge = func(setting *AutoTopUpSetting, tradeNo string, money float64) error {
+		charges++
+		return nil
+	}
+	runAutoTopUp(user.Id)
+	if charges != 0 {
+		t.Fatal("pending 订单应计入每日上限")
+	}
+
+	never := &TopUp{UserId: user.Id, Amount: 2, TradeNo: "auto_never", PaymentMethod: AutoTopUpPaymentMethod,
+		CreateTime: now.Unix(), Status: "pending"}
+	if err := never.Insert(); err != nil {
+		t.Fatalf("创建订单失败: %v", err)
+	}
+	autoTopUpLookup = func(tradeNo string) (stripe.PaymentIntentStatus, bool, error) {
+		if tradeNo == "auto_charged" {
+			return stripe.PaymentIntentStatusSucceeded, true, nil
+		}
+		return "", false, nil
+	}
+	ReconcileAutoTopUps(now)
+	if quota, _ := GetUserQuota(user.Id); quota != 10 {
+		t.Errorf("未超过对账延迟的订单不应处理，实际 quota=%d", quota)
+	}
+	ReconcileAutoTopUps(now.Add(autoTopUpReconcileDelay))
+	if quota, _ := GetUserQuota(user.Id); quota != 10+int64(2*config.QuotaPerUnit) {
+		t.Errorf("Stripe 已扣款的订单应补入账，实际 quota=%d", quota)
+	}
+	if order := GetTopUpByTradeNo("auto_never"); order == nil || order.Status != "failed" {
+		t.Errorf("Stripe 上没有扣款的订单应标记为 failed: %+v", order)
+	}
+	ReconcileAutoTopUps(now.Add(autoTopUpReconcileDelay))
+	if quota, _ := GetUserQuota(user.Id); quota != 10+int64(2*config.QuotaPerUnit) {
+		t.Errorf("重复对账不应重复入账，实际 quota=%d", quota)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // KeyDisableNotification Key禁用通知结构
@@ -1396,6 +1397,35 @@ func (channel *Channel) saveMultiKeyInfo() error {
 	return DB.Model(channel).Update("multi_key_info", channel.MultiKeyInfo).Error
 }
 
+// UpdateKeyBalances 写入多 Key 渠道各 Key 的上游余额。
+// 调用方持有的可能是较早加载的渠道，因此在事务内重新读取 multi_key_info 并只合并余额，避免覆盖期间的 Key 状态变更
+func (channel *Channel) UpdateKeyBalances(balances map[int]float64) error {
+	if !channel.MultiKeyInfo.IsMultiKey || len(balances) == 0 {
+		return nil
+	}
+	fresh := &Channel{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "multi_key_info").First(fresh, channel.Id).Error
+		if err != nil {
+			return err
+		}
+		if fresh.MultiKeyInfo.KeyMetadata == nil {
+			fresh.MultiKeyInfo.KeyMetadata = make(map[int]KeyMetadata)
+		}
+		for index, balance := range balances {
+			metadata := fresh.MultiKeyInfo.KeyMetadata[index]
+			metadata.Balance = balance
+			fresh.MultiKeyInfo.KeyMetadata[index] = metadata
+		}
+		return tx.Model(fresh).Update("multi_key_info", fresh.MultiKeyInfo).Error
+	})
+	if err != nil {
+		return err
+	}
+	channel.MultiKeyInfo = fresh.MultiKeyInfo
+	return nil
+}
+
 // 更新渠道状态到数据库
 func (channel *Channel) updateChannelStatus() error {
 	return DB.Model(channel).Update("status", channel.Status).Error
@@ -0,0 +1,376 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
+	"gorm.io/gorm"
+)
+
+const (
+	ChannelCostModePrice   = "price"   // 按上游每百万 token 单价计成本
+	ChannelCostModePercent = "percent" // 按标价的百分比计成本，适用于转售渠道
+)
+
+// ChannelCost 渠道的上游成本。Model 为空时作为该渠道的默认成本，具体模型的配置优先
+type ChannelCost struct {
+	Id        int    `json:"id"`
+	ChannelId int    `json:"channel_id" gorm:"uniqueIndex:idx_channel_cost"`
+	Model     string `json:"model" gorm:"type:varchar(128);uniqueIndex:idx_channel_cost;default:''"`
+	Mode      string `json:"mode" gorm:"type:varchar(16)"`
+	// 以下单价均为美元 / 百万 token；CachedPrice 为 0 时缓存读取按 InputPrice 计
+	InputPrice   float64 `json:"input_price" gorm:"default:0"`
+	OutputPrice  float64 `json:"output_price" gorm:"default:0"`
+	CachedPrice  float64 `json:"cached_price" gorm:"default:0"`
+	RequestPrice float64 `json:"request_price" gorm:"default:0"` // 每次请求的固定成本（美元），用于按次计费的模型
+	ListPercent  float64 `json:"list_percent" gorm:"default:0"`  // percent 模式：成本占标价的百分比
+	UpdatedTime  int64   `json:"updated_time" gorm:"bigint"`
+}
+
+func (cost *ChannelCost) Validate() error {
+	if cost.ChannelId == 0 {
+		return errors.New("channel_id is required")
+	}
+	switch cost.Mode {
+	case ChannelCostModePrice:
+		if cost.InputPrice < 0 || cost.OutputPrice < 0 || cost.CachedPrice < 0 || cost.RequestPrice < 0 {
+			return errors.New("prices must be >= 0")
+		}
+		cost.ListPercent = 0
+	case ChannelCostModePercent:
+		if cost.ListPercent <= 0 {
+			return errors.New("list_percent must be > 0")
+		}
+		cost.InputPrice, cost.OutputPrice, cost.CachedPrice, cost.RequestPrice = 0, 0, 0, 0
+	default:
+		return errors.New("mode must be price or percent")
+	}
+	return nil
+}
+
+// calculate 计算单次请求的上游成本（额度单位）。listQuota 为按标价计的额度，percent 模式下标价无法从倍率推出时使用
+func (cost *ChannelCost) calculate(modelName string, promptTokens, completionTokens, cachedTokens int, listQuota int64) int64 {
+	if cost.Mode == ChannelCostModePercent {
+		return int64(math.Round(modelListQuota(modelName, promptTokens, completionTokens, cachedTokens, listQuota) * cost.ListPercent / 100))
+	}
+	uncached := promptTokens - cachedTokens
+	if uncached < 0 {
+		uncached = 0
+	}
+	cachedPrice := cost.CachedPrice
+	if cachedPrice == 0 {
+		cachedPrice = cost.InputPrice
+	}
+	usd := (float64(uncached)*cost.InputPrice+float64(cachedTokens)*cachedPrice+float64(completionTokens)*cost.OutputPrice)/1000000 +
+		cost.RequestPrice
+	return int64(math.Round(usd * config.QuotaPerUnit))
+}
+
+// modelListQuota 模型按默认倍率（不含分组折扣与合同价）计算的标价额度
+func modelListQuota(modelName string, promptTokens, completionTokens, cachedTokens int, billedQuota int64) float64 {
+	if price := common.GetModelPrice(modelName, false); price != -1 {
+		return price * config.QuotaPerUnit
+	}
+	modelRatio := common.GetModelRatio(modelName)
+	if modelRatio <= 0 {
+		return float64(billedQuota)
+	}
+	uncached := promptTokens - cachedTokens
+	if uncached < 0 {
+		uncached = 0
+	}
+	return modelRatio * (float64(uncached) + float64(cachedTokens)*common.GetCacheRatio(modelName) +
+		float64(completionTokens)*common.GetCompletionRatio(modelName))
+}
+
+func CreateChannelCost(cost *ChannelCost) error {
+	if err := cost.Validate(); err != nil {
+		return err
+	}
+	cost.UpdatedTime = helper.GetTimestamp()
+	if err := DB.Create(cost).Error; err != nil {
+		return err
+	}
+	InvalidateChannelCostCache()
+	return nil
+}
+
+func UpdateChannelCost(cost *ChannelCost) error {
+	if err := cost.Validate(); err != nil {
+		return err
+	}
+	cost.UpdatedTime = helper.GetTimestamp()
+	err := DB.Model(cost).Select("channel_id", "model", "mode", "input_price", "output_price", "cached_price",
+		"request_price", "list_percent", "updated_time").Updates(cost).Error
+	if err != nil {
+		return err
+	}
+	InvalidateChannelCostCache()
+	return nil
+}
+
+func DeleteChannelCost(id int) error {
+	if err := DB.Delete(&ChannelCost{}, id).Error; err != nil {
+		return err
+	}
+	InvalidateChannelCostCache()
+	return nil
+}
+
+func GetChannelCostById(id int) (*ChannelCost, error) {
+	cost := &ChannelCost{}
+	err := DB.First(cost, id).Error
+	return cost, err
+}
+
+// GetChannelCosts channelId 为 0 时返回全部渠道的成本配置
+func GetChannelCosts(channelId int) ([]*ChannelCost, error) {
+	var costs []*ChannelCost
+	tx := DB.Order("channel_id asc, model asc")
+	if channelId > 0 {
+		tx = tx.Where("channel_id = ?", channelId)
+	}
+	err := tx.Find(&costs).Error
+	return costs, err
+}
+
+// 成本缓存：记录消费日志时只读内存，CRUD 时本机立即失效，其他节点最迟 channelCostCacheSeconds 后刷新
+const channelCostCacheSeconds = 60
+
+var (
+	channelCostCache       map[string]*ChannelCost
+	channelCostCacheLoaded int64
+	channelCostCacheLock   sync.RWMutex
+)
+
+func channelCostKey(channelId int, modelName string) string {
+	return strconv.Itoa(channelId) + ":" + modelName
+}
+
+func InvalidateChannelCostCache() {
+	channelCostCacheLock.Lock()
+	channelCostCacheLoaded = 0
+	channelCostCacheLock.Unlock()
+}
+
+func cachedChannelCosts() map[string]*ChannelCost {
+	now := helper.GetTimestamp()
+	channelCostCacheLock.RLock()
+	if now-channelCostCacheLoaded < channelCostCacheSeconds {
+		costs := channelCostCache
+		channelCostCacheLock.RUnlock()
+		return costs
+	}
+	channelCostCacheLock.RUnlock()
+
+	var rows []*ChannelCost
+	if err := DB.Find(&rows).Error; err != nil {
+		logger.SysError("failed to load channel costs: " + err.Error())
+		return nil
+	}
+	costs := make(map[string]*ChannelCost, len(rows))
+	for _, row := range rows {
+		costs[channelCostKey(row.ChannelId, row.Model)] = row
+	}
+	channelCostCacheLock.Lock()
+	channelCostCache = costs
+	channelCostCacheLoaded = now
+	channelCostCacheLock.Unlock()
+	return costs
+}
+
+// findChannelCost 先找渠道下该模型的成本，再退回渠道默认成本
+func findChannelCost(channelId int, modelName string) *ChannelCost {
+	costs := cachedChannelCosts()
+	if cost, ok := costs[channelCostKey(channelId, modelName)]; ok {
+		return cost
+	}
+	return costs[channelCostKey(channelId, "")]
+}
+
+// GetUpstreamCost 单次请求的上游成本（额度单位），渠道未配置成本时返回 0。
+// modelName 为实际请求上游的模型名，quota 为本次实际扣费
+func GetUpstreamCost(channelId int, modelName string, promptTokens, completionTokens, cachedTokens int, quota int64) int64 {
+	if channelId == 0 {
+		return 0
+	}
+	cost := findChannelCost(channelId, modelName)
+	if cost == nil {
+		return 0
+	}
+	return cost.calculate(modelName, promptTokens, completionTokens, cachedTokens, quota)
+}
+
+// 低于成本售卖的提醒：同一渠道模型在冷却期内只提醒一次（按节点）
+var belowCostAlerted sync.Map
+
+var notifyBelowCost = sendBelowCostAlert
+
+func checkBelowCost(channelId int, modelName string, quota int64, cost int64) {
+	if !config.MarginAlertEnabled || cost <= quota {
+		return
+	}
+	now := helper.GetTimestamp()
+	key := channelCostKey(channelId, modelName)
+	if last, ok := belowCostAlerted.Load(key); ok && now-last.(int64) < int64(config.MarginAlertCooldownSeconds) {
+		return
+	}
+	belowCostAlerted.Store(key, now)
+	go notifyBelowCost(channelId, modelName, quota, cost)
+}
+
+func sendBelowCostAlert(channelId int, modelName string, quota int64, cost int64) {
+	subject := fmt.Sprintf("渠道 #%d 的模型 %s 低于成本售卖", channelId, modelName)
+	content := fmt.Sprintf("渠道 #%d 的模型 %s 最近一次请求售价 %d，上游成本 %d（约 $%.6f / $%.6f），请检查模型倍率、分组折扣或渠道成本配置。",
+		channelId, modelName, quota, cost, float64(quota)/config.QuotaPerUnit, float64(cost)/config.QuotaPerUnit)
+	logger.SysLog(subject + ": " + content)
+	if err := message.Notify(message.ByEmail, subject, "", content); err != nil {
+		logger.SysError("failed to notify admin of below-cost model: " + err.Error())
+	}
+}
+
+const (
+	MarginGroupChannel = "channel"
+	MarginGroupModel   = "model"
+	MarginGroupUser    = "user"
+	MarginGroupDay     = "day"
+	// MarginGroupTagPrefix 后接标签键，如 tag:project，按该标签的取值汇总
+	MarginGroupTagPrefix = "tag:"
+)
+
+// MarginReportItem 毛利报表的一行。未配置成本（cost 为 0）的请求只计入 Requests / Revenue，
+// 毛利只按已计成本的请求计算，避免未配置成本的渠道把毛利率虚高
+type MarginReportItem struct {
+	Key            string  `json:"key" gorm:"column:group_key"`
+	Requests       int64   `json:"requests"`
+	CostedRequests int64   `json:"costed_requests"`
+	Revenue        int64   `json:"revenue"`
+	CostedRevenue  int64   `json:"costed_revenue"`
+	Cost           int64   `json:"cost"`
+	Margin         int64   `json:"margin" gorm:"-"`
+	MarginRate     float64 `json:"margin_rate" gorm:"-"`
+}
+
+type MarginReportFilter struct {
+	GroupBy        string
+	StartTimestamp int64
+	EndTimestamp   int64
+	ChannelId      int
+	ModelName      string
+	Username       string
+}
+
+// marginDayExpr 按服务器本地时区把 created_at 截到当天零点
+func marginDayExpr() string {
+	_, offset := time.Now().Zone()
+	return fmt.Sprintf("created_at - (created_at + %d) %% 86400", offset)
+}
+
+// GetMarginReport 按渠道、模型、用户、天或请求标签汇总消费日志中的营收、上游成本与毛利（额度单位）。
+// 按标签汇总时读 log_tags，只统计带该标签的请求
+func GetMarginReport(filter MarginReportFilter) ([]*MarginReportItem, error) {
+	if tagKey, ok := strings.CutPrefix(filter.GroupBy, MarginGroupTagPrefix); ok {
+		if tagKey != LogTagKeyEndUser {
+			if err := validateTagKey(tagKey); err != nil {
+				return nil, err
+			}
+		}
+		tx := LOG_DB.Model(&LogTag{}).Where("tag_key = ?", tagKey)
+		if filter.StartTimestamp > 0 {
+			tx = tx.Where("created_at >= ?", filter.StartTimestamp)
+		}
+		if filter.EndTimestamp > 0 {
+			tx = tx.Where("created_at <= ?", filter.EndTimestamp)
+		}
+		return scanMarginReport(tx, filter, "tag_value", "revenue desc")
+	}
+	var groupExpr string
+	order := "revenue desc"
+	switch filter.GroupBy {
+	case MarginGroupChannel:
+		groupExpr = "channel_id"
+	case MarginGroupModel:
+		groupExpr = "model_name"
+	case MarginGroupUser:
+		groupExpr = "username"
+	case MarginGroupDay:
+		groupExpr = marginDayExpr()
+		order = "group_key asc"
+	default:
+		return nil, errors.New("group_by must be channel, model, user, day or tag:<key>")
+	}
+	tx := LOG_DB.Model(&Log{}).Where("type = ?", LogTypeConsume)
+	tx = applyLogIdRange(tx, filter.StartTimestamp, filter.EndTimestamp)
+	return scanMarginReport(tx, filter, groupExpr, order)
+}
+
+// scanMarginReport 在 logs 或 log_tags 上套用公共筛选并汇总，两张表的列名一致
+func scanMarginReport(tx *gorm.DB, filter MarginReportFilter, groupExpr string, order string) ([]*MarginReportItem, error) {
+	if filter.ChannelId > 0 {
+		tx = tx.Where("channel_id = ?", filter.ChannelId)
+	}
+	if filter.ModelName != "" {
+		tx = tx.Where("model_name = ?", filter.ModelName)
+	}
+	if filter.Username != "" {
+		tx = tx.Where("username = ?", filter.Username)
+	}
+	var items []*MarginReportItem
+	err := tx.Select(groupExpr + " AS group_key, COUNT(*) AS requests," +
+		" COALESCE(SUM(CASE WHEN cost > 0 THEN 1 ELSE 0 END), 0) AS costed_requests," +
+		" COALESCE(SUM(quota), 0) AS revenue," +
+		" COALESCE(SUM(CASE WHEN cost > 0 THEN quota ELSE 0 END), 0) AS costed_revenue," +
+		" COALESCE(SUM(cost), 0) AS cost").
+		Group(groupExpr).Order(order).Scan(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if filter.GroupBy == MarginGroupDay {
+			if day, err := strconv.ParseInt(item.Key, 10, 64); err == nil {
+				item.Key = time.Unix(day, 0).Format("2006-01-02")
+			}
+		}
+		item.Margin = item.CostedRevenue - item.Cost
+		if item.CostedRevenue > 0 {
+			item.MarginRate = math.Round(float64(item.Margin)/float64(item.CostedRevenue)*10000) / 10000
+		}
+	}
+	return items, nil
+}
+
+// BelowCostItem 时间范围内总成本高于总售价的渠道模型
+type BelowCostItem struct {
+	ChannelId int    `json:"channel_id"`
+	ModelName string `json:"model_name"`
+	Requests  int64  `json:"requests"`
+	Revenue   int64  `json:"revenue"`
+	Cost      int64  `json:"cost"`
+	Loss      int64  `json:"loss" gorm:"-"`
+}
+
+func GetBelowCostModels(startTimestamp, endTimestamp int64) ([]*BelowCostItem, error) {
+	tx := LOG_DB.Model(&Log{}).Where("type = ? AND cost > 0", LogTypeConsume)
+	tx = applyLogIdRange(tx, startTimestamp, endTimestamp)
+	var items []*BelowCostItem
+	err := tx.Select("channel_id, model_name, COUNT(*) AS requests, COALESCE(SUM(quota), 0) AS revenue, COALESCE(SUM(cost), 0) AS cost").
+		Group("channel_id, model_name").Having("SUM(cost) > SUM(quota)").
+		Order("SUM(cost) - SUM(quota) desc").Scan(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		item.Loss = item.Cost - item.Revenue
+	}
+	return items, nil
+}
@@ -0,0 +1,117 @@
+package model
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+func TestChannelCostCalculation(t *testing.T) {
+	setupTestDB(t, &ChannelCost{})
+	InvalidateChannelCostCache()
+	t.Cleanup(InvalidateChannelCostCache)
+	common.ModelRatio["cost-test"], common.CompletionRatio["cost-test"], common.CacheRatio["cost-test"] = 1, 4, 0.5
+	t.Cleanup(func() {
+		delete(common.ModelRatio, "cost-test")
+		delete(common.CompletionRatio, "cost-test")
+		delete(common.CacheRatio, "cost-test")
+	})
+
+	if err := CreateChannelCost(&ChannelCost{ChannelId: 1, Mode: ChannelCostModePercent}); err == nil {
+		t.Error("percent 模式缺少 list_percent 应被拒绝")
+	}
+	// 渠道 1：默认按标价 60% 计成本，cost-priced 单独按单价计
+	if err := CreateChannelCost(&ChannelCost{ChannelId: 1, Mode: ChannelCostModePercent, ListPercent: 60}); err != nil {
+		t.Fatalf("创建渠道默认成本失败: %v", err)
+	}
+	if err := CreateChannelCost(&ChannelCost{ChannelId: 1, Model: "cost-priced", Mode: ChannelCostModePrice,
+		InputPrice: 2, OutputPrice: 8, CachedPrice: 0.5}); err != nil {
+		t.Fatalf("创建模型成本失败: %v", err)
+	}
+
+	// 1M 输入（其中 0.5M 缓存）+ 1M 输出：0.5×2 + 0.5×0.5 + 1×8 = $9.25
+	if cost := GetUpstreamCost(1, "cost-priced", 1000000, 1000000, 500000, 0); cost != int64(9.25*config.QuotaPerUnit) {
+		t.Errorf("按单价计算的成本不对，实际 %d", cost)
+	}
+	// 标价额度 = 1×(1000 + 0.5×200) + 1×4×500 = 3100，60% 为 1860
+	if cost := GetUpstreamCost(1, "cost-test", 1200, 500, 200, 9999); cost != 1860 {
+		t.Errorf("按标价百分比计算的成本不对，实际 %d", cost)
+	}
+	if cost := GetUpstreamCost(2, "cost-test", 1000, 1000, 0, 100); cost != 0 {
+		t.Errorf("未配置成本的渠道应返回 0，实际 %d", cost)
+	}
+}
+
+func TestMarginReportAndBelowCostAlert(t *testing.T) {
+	setupTestDB(t, &Log{}, &LogTag{}, &ChannelCost{})
+	origLogDB, origRedis, origAlert := LOG_DB, common.RedisEnabled, config.MarginAlertEnabled
+	LOG_DB, common.RedisEnabled, config.MarginAlertEnabled = DB, false, true
+	var alerts []string
+	var alertsLock sync.Mutex
+	var wg sync.WaitGroup
+	notifyBelowCost = func(channelId int, modelName string, quota int64, cost int64) {
+		defer wg.Done()
+		alertsLock.Lock()
+		alerts = append(alerts, modelName)
+		alertsLock.Unlock()
+	}
+	InvalidateChannelCostCache()
+	t.Cleanup(func() {
+		LOG_DB, common.RedisEnabled, config.MarginAlertEnabled = origLogDB, origRedis, origAlert
+		notifyBelowCost = sendBelowCostAlert
+		belowCostAlerted = sync.Map{}
+		InvalidateChannelCostCache()
+	})
+	DB.Create(&User{Id: 1, Username: "alice", AccessToken: "a", AffCode: "a"})
+	// 每百万输出 token 成本 $1，即每个输出 token 0.5 额度
+	if err := CreateChannelCost(&ChannelCost{ChannelId: 7, Mode: ChannelCostModePrice, OutputPrice: 1}); err != nil {
+		t.Fatalf("创建渠道成本失败: %v", err)
+	}
+
+	ctx := context.Background()
+	tagged := context.WithValue(ctx, logger.RequestTagsCtxKey, &RequestTags{Tags: []RequestTag{{Key: "project", Value: "search"}}})
+	RecordConsumeLogWithOtherAndRequestID(tagged, 1, 7, 0, 1000, "m-profit", "t", 800, "", 1, "", "", false, 0, "", "", 0, "")
+	wg.Add(1)
+	RecordConsumeLogWithOtherAndRequestID(tagged, 1, 7, 0, 1000, "m-loss", "t", 300, "", 1, "", "", false, 0, "", "", 0, "")
+	// 冷却期内不重复提醒
+	RecordConsumeLogWithOtherAndRequestID(ctx, 1, 7, 0, 1000, "m-loss", "t", 300, "", 1, "", "", false, 0, "", "", 0, "")
+	RecordConsumeLogWithOtherAndRequestID(ctx, 1, 8, 0, 1000, "m-profit", "t", 100, "", 1, "", "", false, 0, "", "", 0, "")
+	wg.Wait()
+	if len(alerts) != 1 || alerts[0] != "m-loss" {
+		t.Fatalf("只有亏本模型应提醒一次，实际 %v", alerts)
+	}
+
+	items, err := GetMarginReport(MarginReportFilter{GroupBy: MarginGroupChannel})
+	if err != nil {
+		t.Fatalf("按渠道汇总失败: %v", err)
+	}
+	if len(items) != 2 || items[0].Key != "7" {
+		t.Fatalf("应有两个渠道且渠道 7 营收最高，实际 %+v", items)
+	}
+	ch7 := items[0]
+	if ch7.Requests != 3 || ch7.Revenue != 1400 || ch7.Cost != 1500 || ch7.Margin != -100 {
+		t.Errorf("渠道 7 汇总不对: %+v", ch7)
+	}
+	if ch8 := items[1]; ch8.CostedRequests != 0 || ch8.Margin != 0 || ch8.Revenue != 100 {
+		t.Errorf("未配置成本的渠道只计营收: %+v", ch8)
+	}
+	if days, err := GetMarginReport(MarginReportFilter{GroupBy: MarginGroupDay}); err != nil || len(days) != 1 || len(days[0].Key) != len("2006-01-02") {
+		t.Errorf("按天汇总不对: %+v %v", days, err)
+	}
+	tags, err := GetMarginReport(MarginReportFilter{GroupBy: MarginGroupTagPrefix + "project"})
+	if err != nil || len(tags) != 1 || tags[0].Key != "search" || tags[0].Revenue != 1100 || tags[0].Cost != 1000 || tags[0].Margin != 100 {
+		t.Errorf("按标签汇总不对: %+v %v", tags, err)
+	}
+	if _, err := GetMarginReport(MarginReportFilter{GroupBy: "token"}); err == nil {
+		t.Error("不支持的分组应报错")
+	}
+
+	below, err := GetBelowCostModels(0, 0)
+	if err != nil || len(below) != 1 || below[0].ModelName != "m-loss" || below[0].Loss != 400 {
+		t.Fatalf("亏本模型列表不对: %+v %v", below, err)
+	}
+}
@@ -1,21 +1,16 @@
 package model
 
 import (
-	"encoding/json"
-	"errors"
-	"fmt"
-	"io"
-	"net/http"
+	"strings"
 
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
-	"github.com/stripe/stripe-go/v78"
-	"github.com/stripe/stripe-go/v78/paymentlink"
-	"github.com/stripe/stripe-go/v78/webhook"
-	"gorm.io/gorm"
+	"github.com/songquanpeng/one-api/common/payment"
+	"gorm.io/gorm/clause"
 )
 
+// ChargeOrder 旧版 Stripe Payment Link 订单，仅保留历史记录查询；新订单统一写入 TopUp
 type ChargeOrder struct {
 	Id         int     `json:"id"`
 	UserId     int     `json:"user_id"`
@@ -77,227 +72,39 @@ func GetUserChargeOrdersAndCount(conditions map[string]interface{}, page int, pa
 	return chargeOrders, total, nil
 }
 
-func CreateStripOrder(userId, chargeId int) (string, string, error) {
-	//查询配置项
-	chargeConfig, err := GetChargeConfigById(chargeId)
-	if err != nil {
-		return "", "", err
-	}
-	appOrderId := helper.GetRandomString(16)
-	chargeOrder := ChargeOrder{
-		UserId:     userId,
-		ChargeId:   chargeConfig.Id,
-		Currency:   chargeConfig.Currency,
-		AppOrderId: appOrderId,
-		Status:     StatusMap["create"],
-		Amount:     chargeConfig.Amount,
-		Ip:         helper.GetIp(),
-		UpdatedAt:  helper.GetFormatTimeString(),
-		CreatedAt:  helper.GetFormatTimeString(),
-	}
-
-	//创建订单
-	err = DB.Model(&ChargeOrder{}).Create(&chargeOrder).Error
-	if err != nil {
-		return "", "", err
-	}
-
-	bill := Bill{
-		Username:  GetUsernameById(userId),
-		UserId:    userId,
-		Type:      "Credits",
-		UpdatedAt: helper.GetTimestamp(),
-		CreatedAt: helper.GetTimestamp(),
-		Amount:    chargeConfig.Amount,
-		Status:    StatusMap["create"],
-		SourceId:  appOrderId,
-	}
-	err = DB.Model(&Bill{}).Create(&bill).Error
-	if err != nil {
-		return "", "", err
-	}
-	//创建价格
-	stripe.Key = config.StripePrivateKey
-	params := &stripe.PaymentLinkParams{
-		LineItems: []*stripe.PaymentLinkLineItemParams{
-			{
-				Price:    stripe.String(chargeConfig.Price),
-				Quantity: stripe.Int64(1),
-			},
-		},
-		PaymentIntentData: &stripe.PaymentLinkPaymentIntentDataParams{
-			Metadata: map[string]string{
-				"userId":     fmt.Sprintf("%d", userId),
-				"appOrderId": appOrderId,
-			},
-		},
-		Restrictions: &stripe.PaymentLinkRestrictionsParams{
-			CompletedSessions: &stripe.PaymentLinkRestrictionsCompletedSessionsParams{
-				Limit: stripe.Int64(1),
-			},
-		},
-	}
-
-	result, err := paymentlink.New(params)
-	if err != nil {
-		return "", "", err
-	}
-	return result.URL, appOrderId, nil
-}
-func stripeChargeFail(charge *stripe.Charge) error {
-	return nil
-}
-func stripeChargeDispute() {
-
-}
-func stripeChargeFraud() {
-
-}
-
-func stripeChargeRefund(charge *stripe.Charge) error {
-	if charge.Status == "succeeded" {
-		//获取meta数据里的订单id
-		orderId := charge.Metadata["appOrderId"]
-		userId := charge.Metadata["userId"]
-
-		// 使用原子性数据库操作防止分布式并发
-		// 只有成功状态的订单才能退款
-		success := UpdateChargeOrderStatusWithCondition(orderId, userId, StatusMap["success"], StatusMap["refund"])
-		if !success {
-			// 订单已被处理或状态不符合预期，直接返回
-			return nil
-		}
-	}
-	return nil
-}
-func stripeChargeSuccess(charge *stripe.Charge) error {
-	//获取meta数据里的订单id
-	if charge.Status == "succeeded" {
-		orderId := charge.Metadata["appOrderId"]
-		userId := charge.Metadata["userId"]
-
-		// 获取更新后的订单信息
-		var chargeOrder ChargeOrder
-		var bill Bill
-		if err := DB.Model(&ChargeOrder{}).Where("app_order_id = ? ", orderId).Where("user_id = ?", userId).First(&chargeOrder).Error; err != nil {
-			return err
-		}
-		if err := DB.Transaction(func(tx *gorm.DB) error {
-			// 使用原子性数据库操作防止分布式并发
-			success := UpdateChargeOrderStatusWithCondition(orderId, userId, StatusMap["create"], StatusMap["success"])
-			if !success {
-				// 订单已被处理或状态不符合预期，直接返回
-				return errors.New("订单已被处理或状态不符合预期")
-			}
-			//更新订单详细信息
-			amount := float64(charge.Amount / 100)
-			orderCost := amount*0.029 + 0.3
-			realAmount := amount - orderCost
-			if err := DB.Model(&chargeOrder).Updates(ChargeOrder{Status: StatusMap["success"], RealAmount: realAmount, OrderCost: orderCost, OrderNo: charge.ID, Amount: amount}).Error; err != nil {
-				return err
-			}
-			//更新余额 待定手续费和用户组别的变更
-			err := IncreaseUserQuota(chargeOrder.UserId, int64(amount*500000))
-			if err != nil {
-				return err
-			}
-
-			if err := DB.Model(&Bill{}).Where("source_id = ?", orderId).First(&bill).Error; err != nil {
-				return err
-			}
-			if err := DB.Model(&bill).Updates(Bill{Status: StatusMap["success"]}).Error; err != nil {
-				return err
-			}
-
-			return nil
-		}); err != nil {
-			return err
-		}
-		//支付成功处理一下其它
-		AfterChargeSuccess(chargeOrder.UserId, float64(charge.Amount/100-charge.ApplicationFeeAmount/100))
-	}
-	return nil
-}
-
-func HandleStripeCallback(req *http.Request) error {
-	payload, err := io.ReadAll(req.Body)
-	// logger.SysLog(fmt.Sprintf("stripePayload:%s\n", payload))
-	// logger.SysLog(fmt.Sprintf("stripePayloaderr:%+v\n", err))
-	// logger.SysLog(fmt.Sprintf("stripePayloadheader:%+v\n", req.Header.Get("Stripe-Signature")))
-	if err != nil {
-		//fmt.Fprintf(os.Stderr, "Error reading request body: %v\n", err)
-		//w.WriteHeader(http.StatusServiceUnavailable)
-		return err
-	}
-
-	event := stripe.Event{}
-
-	if err := json.Unmarshal(payload, &event); err != nil {
-		return err
-	}
-	endpointSecret := config.StripeEndpointSecret
-	signatureHeader := req.Header.Get("Stripe-Signature")
-	event, err = webhook.ConstructEventWithOptions(
-		payload,
-		signatureHeader,
-		endpointSecret,
-		webhook.ConstructEventOptions{
-			IgnoreAPIVersionMismatch: true,
-		},
-	)
-	if err != nil {
-		logger.SysError(fmt.Sprintf("stripe webhook construct event failed: %v", err))
-		return err
-	}
-	switch event.Type {
-	case "payment_intent.succeeded":
-		//var paymentIntent stripe.PaymentIntent
-		var charge stripe.Charge
-		err := json.Unmarshal(event.Data.Raw, &charge)
-		if err != nil {
-			logger.SysError(fmt.Sprintf("error parsing stripe webhook JSON: %v", err))
-			return err
-		}
-		err = stripeChargeSuccess(&charge)
-		if err != nil {
-			return err
-		}
-	case "charge.refunded":
-		var charge stripe.Charge
-		err := json.Unmarshal(event.Data.Raw, &charge)
-		if err != nil {
-			logger.SysError(fmt.Sprintf("error parsing stripe webhook JSON: %v", err))
-			return err
-		}
-		err = stripeChargeRefund(&charge)
-		if err != nil {
-			return err
-		}
-	case "charge.failed":
-		var charge stripe.Charge
-		err := json.Unmarshal(event.Data.Raw, &charge)
-		if err != nil {
-			logger.SysError(fmt.Sprintf("error parsing stripe webhook JSON: %v", err))
-			return err
-		}
-		err = stripeChargeFail(&charge)
-		if err != nil {
-			return err
-		}
-	default:
-		logger.SysLog(fmt.Sprintf("Unhandled event type: %s", event.Type))
-	}
-	return nil
-}
-
-// UpdateChargeOrderStatusWithCondition 原子性更新订单状态，防止分布式并发冲突
-// 只有当当前状态等于expectedStatus时才更新为newStatus
-func UpdateChargeOrderStatusWithCondition(appOrderId, userId string, expectedStatus, newStatus int) bool {
-	// 使用WHERE条件确保原子性更新
-	result := DB.Model(&ChargeOrder{}).
-		Where("app_order_id = ? AND user_id = ? AND status = ?", appOrderId, userId, expectedStatus).
-		Update("status", newStatus)
-
-	// 如果RowsAffected为1，说明更新成功
-	return result.RowsAffected == 1
+// migrateChargeOrder 上线统一订单前生成的 Payment Link 订单只在 charge_orders 里，
+// 回调到达时按原订单补建 TopUp，之后同样走统一状态机入账。找不到旧订单时返回 nil
+func migrateChargeOrder(appOrderId string) *TopUp {
+	var order ChargeOrder
+	if err := DB.Where("app_order_id = ?", appOrderId).First(&order).Error; err != nil {
+		return nil
+	}
+	status := TopUpStatusPending
+	switch order.Status {
+	case StatusMap["success"]:
+		status = TopUpStatusSuccess
+	case StatusMap["refund"]:
+		status = TopUpStatusRefunded
+	case StatusMap["fail"]:
+		status = TopUpStatusFailed
+	}
+	topUp := &TopUp{
+		UserId:        order.UserId,
+		Amount:        int64(order.Amount),
+		Money:         order.Amount,
+		Quota:         int64(order.Amount * config.QuotaPerUnit),
+		TradeNo:       order.AppOrderId,
+		PaymentMethod: payment.ProviderStripeLink,
+		Currency:      strings.ToUpper(order.Currency),
+		CreateTime:    helper.GetTimestamp(),
+		Status:        status,
+		Provider:      payment.ProviderStripeLink,
+		ProviderRef:   order.OrderNo,
+	}
+	// 订单号唯一，并发回调只补建一次
+	if err := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(topUp).Error; err != nil {
+		logger.SysError("failed to migrate charge order " + appOrderId + ": " + err.Error())
+		return nil
+	}
+	return GetTopUpByTradeNo(appOrderId)
 }
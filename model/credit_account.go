@@ -0,0 +1,191 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	creditNoticeNone = iota
+	creditNoticeSoft
+	creditNoticeHard
+)
+
+// CreditAccount 后付费账号：余额允许透支到 -CreditLimit，按月出账单，账单支付后补回余额。
+// 没有记录的用户仍是预付费。
+type CreditAccount struct {
+	Id          int   `json:"id"`
+	UserId      int   `json:"user_id" gorm:"uniqueIndex"`
+	CreditLimit int64 `json:"credit_limit" gorm:"bigint"`
+	// SoftLimitPercent 透支达到额度的该百分比时发送软限额提醒
+	SoftLimitPercent int `json:"soft_limit_percent" gorm:"default:80"`
+	// NoticeLevel 已发送过的提醒级别，余额回升后随之回落，避免重复通知
+	NoticeLevel int    `json:"notice_level" gorm:"default:0"`
+	BillingName string `json:"billing_name" gorm:"type:varchar(128)"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+func (account *CreditAccount) Validate() error {
+	if account.UserId == 0 {
+		return errors.New("user_id is required")
+	}
+	if account.CreditLimit <= 0 {
+		return errors.New("credit_limit must be > 0")
+	}
+	if account.SoftLimitPercent == 0 {
+		account.SoftLimitPercent = 80
+	}
+	if account.SoftLimitPercent < 1 || account.SoftLimitPercent > 100 {
+		return errors.New("soft_limit_percent must be between 1 and 100")
+	}
+	if len(account.BillingName) > 128 {
+		return errors.New("billing_name is too long")
+	}
+	return nil
+}
+
+// SaveCreditAccount 开通或修改后付费额度
+func SaveCreditAccount(account *CreditAccount) error {
+	if err := account.Validate(); err != nil {
+		return err
+	}
+	if _, err := GetUserById(account.UserId, false); err != nil {
+		return err
+	}
+	now := helper.GetTimestamp()
+	account.CreatedTime = now
+	account.UpdatedTime = now
+	err := DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"credit_limit", "soft_limit_percent", "billing_name", "updated_time"}),
+	}).Create(account).Error
+	if err != nil {
+		return err
+	}
+	invalidateCreditLimit(account.UserId)
+	return nil
+}
+
+// DeleteCreditAccount 恢复为预付费。已透支的余额保留，用户需先结清才能继续使用。
+func DeleteCreditAccount(userId int) error {
+	result := DB.Where("user_id = ?", userId).Delete(&CreditAccount{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("credit account not found")
+	}
+	invalidateCreditLimit(userId)
+	return nil
+}
+
+func GetCreditAccount(userId int) (*CreditAccount, error) {
+	account := &CreditAccount{}
+	err := DB.Where("user_id = ?", userId).First(account).Error
+	return account, err
+}
+
+func GetAllCreditAccounts() ([]*CreditAccount, error) {
+	var accounts []*CreditAccount
+	err := DB.Order("id desc").Find(&accounts).Error
+	return accounts, err
+}
+
+// 额度的本机缓存，计费热路径每次请求都要查
+const creditLimitCacheSeconds = 60
+
+type creditLimitEntry struct {
+	limit    int64
+	loadedAt int64
+}
+
+var creditLimitCache sync.Map
+
+func invalidateCreditLimit(userId int) {
+	creditLimitCache.Delete(userId)
+}
+
+// GetCreditLimit 返回用户的透支额度，预付费用户为 0
+func GetCreditLimit(userId int) int64 {
+	now := helper.GetTimestamp()
+	if v, ok := creditLimitCache.Load(userId); ok {
+		entry := v.(*creditLimitEntry)
+		if now-entry.loadedAt < creditLimitCacheSeconds {
+			return entry.limit
+		}
+	}
+	var limit int64
+	DB.Model(&CreditAccount{}).Where("user_id = ?", userId).Select("credit_limit").Limit(1).Find(&limit)
+	creditLimitCache.Store(userId, &creditLimitEntry{limit: limit, loadedAt: now})
+	return limit
+}
+
+// CacheGetUserAvailableQuota 用户可用额度 = 余额 + 透支额度
+func CacheGetUserAvailableQuota(ctx context.Context, userId int) (int64, error) {
+	quota, err := CacheGetUserQuota(ctx, userId)
+	if err != nil {
+		return quota, err
+	}
+	return quota + GetCreditLimit(userId), nil
+}
+
+// checkCreditLimitNotice 消费后检查透支程度，越过软/硬限额时通知用户和管理员
+func checkCreditLimitNotice(userId int) {
+	limit := GetCreditLimit(userId)
+	if limit <= 0 {
+		return
+	}
+	account, err := GetCreditAccount(userId)
+	if err != nil {
+		return
+	}
+	quota, err := GetUserQuota(userId)
+	if err != nil {
+		return
+	}
+	level := creditNoticeNone
+	if -quota >= account.CreditLimit {
+		level = creditNoticeHard
+	} else if -quota*100 >= account.CreditLimit*int64(account.SoftLimitPercent) {
+		level = creditNoticeSoft
+	}
+	if level == account.NoticeLevel {
+		return
+	}
+	// 条件更新保证多节点并发时只有一个节点发送通知
+	result := DB.Model(&CreditAccount{}).Where("user_id = ? AND notice_level = ?", userId, account.NoticeLevel).
+		Update("notice_level", level)
+	if result.Error != nil || result.RowsAffected == 0 || level < account.NoticeLevel {
+		return
+	}
+	go notifyCreditLimit(userId, level, quota, account.CreditLimit)
+}
+
+func notifyCreditLimit(userId int, level int, quota int64, creditLimit int64) {
+	user, err := GetUserById(userId, false)
+	if err != nil {
+		return
+	}
+	subject := "后付费额度即将用尽"
+	content := fmt.Sprintf("账号 %s 当前已透支 %d，透支额度 %d，已达到提醒阈值。", user.Username, -quota, creditLimit)
+	if level == creditNoticeHard {
+		subject = "后付费额度已用尽"
+		content = fmt.Sprintf("账号 %s 当前已透支 %d，已达到透支额度 %d，新的请求将被拒绝，请尽快结清账单。", user.Username, -quota, creditLimit)
+	}
+	if user.Email != "" {
+		if err := message.SendEmail(subject, user.Email, content); err != nil {
+			logger.SysError(fmt.Sprintf("failed to send credit limit email to user %d: %s", userId, err.Error()))
+		}
+	}
+	if err := message.Notify(message.ByEmail, subject, "", content); err != nil {
+		logger.SysError("failed to notify admin of credit limit: " + err.Error())
+	}
+}
@@ -1,16 +1,11 @@
 package model
 
 import (
-	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"crypto/rsa"
-	"crypto/sha256"
-	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
-	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
@@ -23,7 +18,6 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 )
 
-var Pubkey = "-----BEGIN PUBLIC KEY-----\nMIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC3FT0Ym8b3myVxhQW7ESuuu6lo\ndGAsUJs4fq+Ey//jm27jQ7HHHDmP1YJO7XE7Jf/0DTEJgcw4EZhJFVwsk6d3+4fy\nBsn0tKeyGMiaE6cVkX0cy6Y85o8zgc/CwZKc0uw6d5siAo++xl2zl+RGMXCELQVE\nox7pp208zTvown577wIDAQAB\n-----END PUBLIC KEY-----"
 var CryptHost = "https://api.cryptapi.io/"
 var AesKey = "djde2322pv-qomx402jd3-pq2m49sj1l"
 
@@ -134,13 +128,6 @@ type ConvertResponse struct {
 	Status       string `json:"status"`
 }
 
-var CryptResponseResult = map[string]int{
-	"pending":  1,
-	"received": 2,
-	"sent":     3,
-	"done":     4,
-}
-
 func CryptGetRequest(requestURL string) ([]byte, error) {
 	request, err := http.NewRequest("GET", requestURL, nil)
 	if err != nil {
@@ -243,50 +230,6 @@ func GetConvert() {
 }
 func GetLogs() {
 
-}
-func HandleCryptCallback(respons CryptCallbackResponse, username string) error {
-	return CreateOrUpdateOrder(respons, username)
-}
-func VerifyCryptCallbackSignature(message, signature string) error {
-	//
-	decodeSignature, err := base64.StdEncoding.DecodeString(signature)
-	if err != nil {
-		return errors.New("签名解码失败")
-	}
-	// 解析公钥PEM数据
-	block, _ := pem.Decode([]byte(Pubkey))
-	if block == nil {
-		return errors.New("公钥解析失败")
-	}
-	// 解析公钥
-	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
-		return err
-	}
-
-	// 类型断言转换为*rsa.PublicKey
-	rsaPub, ok := pub.(*rsa.PublicKey)
-	if !ok {
-		return errors.New("公钥不是RSA类型")
-	}
-
-	//方法一：
-	//创建一个基于SHA256算法的hash.Hash接口的对象
-	hash := sha256.New()
-	//输入数据
-	hash.Write([]byte(message))
-	//计算哈希值
-	bytes := hash.Sum(nil)
-	//将字符串编码为16进制格式,返回字符串
-	//hashCode := hex.EncodeToString(bytes)
-	// 使用crypto/rsa包的VerifyPKCS1v15方法验证签名
-	err = rsa.VerifyPKCS1v15(rsaPub, crypto.SHA256, bytes, decodeSignature)
-	if err != nil {
-		return err
-	}
-
-	// 如果没有错误，表示签名验证成功
-	return nil
 }
 func Encrypt(text string) (string, error) {
 	key := []byte("djde2322pv-qomx402jd3-pq2m49sj1l") // 应该是32位长
@@ -0,0 +1,301 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// EphemeralKeyPrefix 临时密钥前缀，后接 HS256 签名的 JWT
+const EphemeralKeyPrefix = "ek-"
+
+// EphemeralKeyClaims 临时密钥携带的限制。签名保证不可篡改，父令牌在每次请求时重新校验。
+type EphemeralKeyClaims struct {
+	TokenId  int      `json:"tid"`
+	Models   []string `json:"models,omitempty"`
+	MaxSpend int64    `json:"max_spend,omitempty"` // 0 表示不单独限额，仅受父令牌额度约束
+	EndUser  string   `json:"end_user,omitempty"`
+	jwt.StandardClaims
+}
+
+// EphemeralKeySession 单次请求内的临时密钥状态，挂在 request context 上。
+// 鉴权时先按 PreConsumedQuota 预占花费额度，relay 估算后补足，实际扣费或请求结束时二选一结算预占部分。
+type EphemeralKeySession struct {
+	Claims   *EphemeralKeyClaims
+	reserved int64
+	settled  int32
+}
+
+func ephemeralKeySecret() []byte {
+	if config.EphemeralKeySecret != "" {
+		return []byte(config.EphemeralKeySecret)
+	}
+	return []byte(config.SessionSecret)
+}
+
+func IsEphemeralKey(key string) bool {
+	return strings.HasPrefix(key, EphemeralKeyPrefix)
+}
+
+// IssueEphemeralKey 以 parent 为父令牌签发临时密钥，ttl 单位秒
+func IssueEphemeralKey(parent *Token, ttl int64, models []string, maxSpend int64, endUser string) (string, *EphemeralKeyClaims, error) {
+	if ttl <= 0 || ttl > int64(config.EphemeralKeyMaxTTL) {
+		return "", nil, fmt.Errorf("ttl must be between 1 and %d seconds", config.EphemeralKeyMaxTTL)
+	}
+	if maxSpend < 0 {
+		return "", nil, errors.New("max_spend cannot be negative")
+	}
+	if len(endUser) > 64 {
+		return "", nil, errors.New("end_user is too long")
+	}
+	now := time.Now().Unix()
+	claims := &EphemeralKeyClaims{
+		TokenId:  parent.Id,
+		Models:   models,
+		MaxSpend: maxSpend,
+		EndUser:  endUser,
+		StandardClaims: jwt.StandardClaims{
+			Id:        helper.GetUUID(),
+			IssuedAt:  now,
+			ExpiresAt: now + ttl,
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ephemeralKeySecret())
+	if err != nil {
+		return "", nil, err
+	}
+	return EphemeralKeyPrefix + signed, claims, nil
+}
+
+// ValidateEphemeralKey 校验签名与有效期，并确认父令牌仍然可用、未在签发后被吊销
+func ValidateEphemeralKey(key string) (*EphemeralKeyClaims, *Token, error) {
+	raw := strings.TrimPrefix(key, EphemeralKeyPrefix)
+	claims := &EphemeralKeyClaims{}
+	parsed, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return ephemeralKeySecret(), nil
+	})
+	if err != nil || !parsed.Valid {
+		return nil, nil, errors.New("The ephemeral key is invalid or has expired")
+	}
+	parent, err := GetTokenById(claims.TokenId)
+	if err != nil {
+		return nil, nil, errors.New("The parent token of the ephemeral key no longer exists")
+	}
+	if parent.EphemeralRevokedAt > 0 && claims.IssuedAt <= parent.EphemeralRevokedAt {
+		return nil, nil, errors.New("The ephemeral key has been revoked")
+	}
+	// 复用常规令牌的状态/过期/额度校验
+	if _, err := ValidateUserToken(parent.Key); err != nil {
+		return nil, nil, err
+	}
+	return claims, parent, nil
+}
+
+// RevokeEphemeralKeys 吊销父令牌此前签发的全部临时密钥
+func RevokeEphemeralKeys(tokenId int) error {
+	return DB.Model(&Token{}).Where("id = ?", tokenId).Update("ephemeral_revoked_at", time.Now().Unix()).Error
+}
+
+func (claims *EphemeralKeyClaims) AllowsModel(modelName string) bool {
+	if len(claims.Models) == 0 {
+		return true
+	}
+	for _, m := range claims.Models {
+		if m == modelName {
+			return true
+		}
+	}
+	return false
+}
+
+func ephemeralSpendKey(jti string) string {
+	return "ephemeral_spend:" + jti
+}
+
+type localEphemeralSpendEntry struct {
+	spend     int64
+	expiresAt int64
+}
+
+// 未启用 Redis 时的单机兜底
+var (
+	localEphemeralSpend     = map[string]*localEphemeralSpendEntry{}
+	localEphemeralSpendLock sync.Mutex
+)
+
+// localEphemeralEntry 取出或创建条目，顺带清理已过期的条目。调用方需持有锁。
+func localEphemeralEntry(claims *EphemeralKeyClaims) *localEphemeralSpendEntry {
+	if len(localEphemeralSpend) > 1024 {
+		now := time.Now().Unix()
+		for jti, entry := range localEphemeralSpend {
+			if entry.expiresAt < now {
+				delete(localEphemeralSpend, jti)
+			}
+		}
+	}
+	entry, ok := localEphemeralSpend[claims.Id]
+	if !ok {
+		entry = &localEphemeralSpendEntry{expiresAt: claims.ExpiresAt}
+		localEphemeralSpend[claims.Id] = entry
+	}
+	return entry
+}
+
+// reserveEphemeralSpendScript 原子地检查 已花费 + 预占 <= 上限，通过则累加预占额度
+const reserveEphemeralSpendScript = `
+local spent = tonumber(redis.call("get", KEYS[1]) or "0")
+if spent + tonumber(ARGV[1]) > tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("incrby", KEYS[1], ARGV[1])
+redis.call("expireat", KEYS[1], ARGV[3])
+return 1
+`
+
+// BeginEphemeralKeySession 为本次请求预占花费额度；超出 max_spend 时返回错误。
+// 鉴权时只预占 PreConsumedQuota，relay 估算出本次请求的额度后再经 ReserveEphemeralKeySpend 补足。
+func BeginEphemeralKeySession(claims *EphemeralKeyClaims) (*EphemeralKeySession, error) {
+	session := &EphemeralKeySession{Claims: claims}
+	if claims.MaxSpend <= 0 {
+		return session, nil
+	}
+	reserve := config.PreConsumedQuota
+	if reserve > claims.MaxSpend {
+		reserve = claims.MaxSpend
+	}
+	if err := reserveEphemeralSpend(claims, reserve); err != nil {
+		return nil, err
+	}
+	session.reserved = reserve
+	return session, nil
+}
+
+// reserveEphemeralSpend 原子地检查 已花费 + amount <= max_spend，通过则累加
+func reserveEphemeralSpend(claims *EphemeralKeyClaims, amount int64) error {
+	if common.RedisEnabled {
+		ok, err := common.RDB.Eval(context.Background(), reserveEphemeralSpendScript,
+			[]string{ephemeralSpendKey(claims.Id)}, amount, claims.MaxSpend, claims.ExpiresAt).Int()
+		if err != nil {
+			return err
+		}
+		if ok != 1 {
+			return errors.New("The ephemeral key spend limit has been reached")
+		}
+		return nil
+	}
+	localEphemeralSpendLock.Lock()
+	defer localEphemeralSpendLock.Unlock()
+	entry := localEphemeralEntry(claims)
+	if entry.spend+amount > claims.MaxSpend {
+		return errors.New("The ephemeral key spend limit has been reached")
+	}
+	entry.spend += amount
+	return nil
+}
+
+// Reserve 将本次请求的预占额度补足到 estimated，剩余花费额度不足时返回错误
+func (session *EphemeralKeySession) Reserve(estimated int64) error {
+	if session.Claims.MaxSpend <= 0 || atomic.LoadInt32(&session.settled) == 1 {
+		return nil
+	}
+	extra := estimated - atomic.LoadInt64(&session.reserved)
+	if extra <= 0 {
+		return nil
+	}
+	if err := reserveEphemeralSpend(session.Claims, extra); err != nil {
+		return err
+	}
+	atomic.AddInt64(&session.reserved, extra)
+	return nil
+}
+
+// ReserveEphemeralKeySpend relay 预扣费路径调用：请求使用的是临时密钥时按估算额度补足预占
+func ReserveEphemeralKeySpend(ctx context.Context, estimated int64) error {
+	session, ok := ctx.Value(logger.EphemeralKeyCtxKey).(*EphemeralKeySession)
+	if !ok || session == nil {
+		return nil
+	}
+	return session.Reserve(estimated)
+}
+
+func addEphemeralSpend(claims *EphemeralKeyClaims, delta int64) {
+	if delta == 0 || claims.MaxSpend <= 0 {
+		return
+	}
+	if common.RedisEnabled {
+		ctx := context.Background()
+		key := ephemeralSpendKey(claims.Id)
+		pipe := common.RDB.Pipeline()
+		pipe.IncrBy(ctx, key, delta)
+		pipe.ExpireAt(ctx, key, time.Unix(claims.ExpiresAt, 0))
+		if _, err := pipe.Exec(ctx); err != nil {
+			logger.SysError("failed to update ephemeral key spend: " + err.Error())
+		}
+		return
+	}
+	localEphemeralSpendLock.Lock()
+	localEphemeralEntry(claims).spend += delta
+	localEphemeralSpendLock.Unlock()
+}
+
+// Charge 记入实际花费；首次结算时抵扣预占额度
+func (session *EphemeralKeySession) Charge(quota int64) {
+	if atomic.CompareAndSwapInt32(&session.settled, 0, 1) {
+		addEphemeralSpend(session.Claims, quota-atomic.LoadInt64(&session.reserved))
+		return
+	}
+	addEphemeralSpend(session.Claims, quota)
+}
+
+// Release 请求结束仍未扣费时退回预占额度
+func (session *EphemeralKeySession) Release() {
+	if atomic.CompareAndSwapInt32(&session.settled, 0, 1) {
+		addEphemeralSpend(session.Claims, -atomic.LoadInt64(&session.reserved))
+	}
+}
+
+// GetEphemeralKeySpend 返回临时密钥的累计花费（含未结算的预占）
+func GetEphemeralKeySpend(jti string) int64 {
+	if common.RedisEnabled {
+		v, err := common.RedisGet(ephemeralSpendKey(jti))
+		if err != nil {
+			return 0
+		}
+		spend, _ := strconv.ParseInt(v, 10, 64)
+		return spend
+	}
+	localEphemeralSpendLock.Lock()
+	defer localEphemeralSpendLock.Unlock()
+	if entry, ok := localEphemeralSpend[jti]; ok {
+		return entry.spend
+	}
+	return 0
+}
+
+// chargeEphemeralKeyFromContext 消费日志路径调用：请求使用的是临时密钥时累计花费，返回 end user 标识
+func chargeEphemeralKeyFromContext(ctx context.Context, quota int64) string {
+	v := ctx.Value(logger.EphemeralKeyCtxKey)
+	if v == nil {
+		return ""
+	}
+	session, ok := v.(*EphemeralKeySession)
+	if !ok || session == nil {
+		return ""
+	}
+	session.Charge(quota)
+	return session.Claims.EndUser
+}
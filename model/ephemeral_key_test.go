@@ -0,0 +1,102 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestEphemeralKeyLifecycle(t *testing.T) {
+	setupTestDB(t)
+	config.EphemeralKeySecret = "test-secret"
+	redisEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	t.Cleanup(func() {
+		config.EphemeralKeySecret = ""
+		common.RedisEnabled = redisEnabled
+	})
+
+	user := &User{Id: 1, Username: "alice", Quota: 1000, AccessToken: "a", AffCode: "a", Status: common.UserStatusEnabled}
+	if err := DB.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	parent := &Token{Id: 1, UserId: user.Id, Key: "parentkey", Status: common.TokenStatusEnabled, ExpiredTime: -1, UnlimitedQuota: true}
+	if err := DB.Create(parent).Error; err != nil {
+		t.Fatalf("创建令牌失败: %v", err)
+	}
+
+	key, _, err := IssueEphemeralKey(parent, 60, []string{"gpt-4o-mini"}, 100, "end-user-1")
+	if err != nil {
+		t.Fatalf("签发失败: %v", err)
+	}
+	claims, token, err := ValidateEphemeralKey(key)
+	if err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	if token.Id != parent.Id || claims.EndUser != "end-user-1" {
+		t.Errorf("解析结果不符: token=%d end_user=%s", token.Id, claims.EndUser)
+	}
+	if !claims.AllowsModel("gpt-4o-mini") || claims.AllowsModel("gpt-4o") {
+		t.Error("模型白名单校验错误")
+	}
+	if _, _, err := ValidateEphemeralKey(key + "x"); err == nil {
+		t.Error("篡改后的密钥不应通过校验")
+	}
+
+	session, err := BeginEphemeralKeySession(claims)
+	if err != nil {
+		t.Fatalf("预占失败: %v", err)
+	}
+	session.Charge(80)
+	session.Release()
+	if spend := GetEphemeralKeySpend(claims.Id); spend != 80 {
+		t.Errorf("累计花费应为 80，实际 %d", spend)
+	}
+	session, err = BeginEphemeralKeySession(claims)
+	if err == nil {
+		session.Release()
+		t.Error("超过 max_spend 后不应再允许请求")
+	}
+
+	// 吊销时间戳按秒记录，与签发同一秒也视为已吊销
+	if err := RevokeEphemeralKeys(parent.Id); err != nil {
+		t.Fatalf("吊销失败: %v", err)
+	}
+	if _, _, err := ValidateEphemeralKey(key); err == nil {
+		t.Error("吊销后的临时密钥不应通过校验")
+	}
+}
+
+func TestEphemeralKeyReserveEstimatedSpend(t *testing.T) {
+	redisEnabled, preConsumed := common.RedisEnabled, config.PreConsumedQuota
+	common.RedisEnabled, config.PreConsumedQuota = false, 10
+	t.Cleanup(func() { common.RedisEnabled, config.PreConsumedQuota = redisEnabled, preConsumed })
+
+	claims := &EphemeralKeyClaims{TokenId: 1, MaxSpend: 100}
+	claims.Id, claims.ExpiresAt = "reserve-test", 1<<40
+
+	first, err := BeginEphemeralKeySession(claims)
+	if err != nil {
+		t.Fatalf("预占失败: %v", err)
+	}
+	if err := first.Reserve(60); err != nil {
+		t.Fatalf("估算额度在上限内应允许: %v", err)
+	}
+	// 并发的第二个请求：鉴权时预占 10 仍可通过，但估算额度补足后会超过上限
+	second, err := BeginEphemeralKeySession(claims)
+	if err != nil {
+		t.Fatalf("预占失败: %v", err)
+	}
+	if err := second.Reserve(60); err == nil {
+		t.Error("估算额度超出剩余花费额度时应拒绝")
+	}
+	second.Release()
+	if spend := GetEphemeralKeySpend(claims.Id); spend != 60 {
+		t.Errorf("被拒绝的请求不应占用额度，累计应为 60，实际 %d", spend)
+	}
+	first.Charge(45)
+	if spend := GetEphemeralKeySpend(claims.Id); spend != 45 {
+		t.Errorf("结算后累计应为实际花费 45，实际 %d", spend)
+	}
+}
@@ -38,27 +38,27 @@ func findMaxIdByTimestampGeneric(db *gorm.DB, tableName string, timestamp int64)
 		return maxId, true // 所有记录都 < timestamp
 	}
 
-	// 二分查找
-	var resultId int64
-	for i := 0; minId < maxId && i < 100; i++ {
-		midId := (minId + maxId + 1) / 2
+	// 二分查找，不变式：lo 的记录 < timestamp，hi 的记录 >= timestamp（上面已确认两端）
+	lo, hi := minId, maxId
+	for i := 0; hi-lo > 1 && i < 100; i++ {
+		midId := (lo + hi) / 2
 		var row struct {
 			Id        int64
 			CreatedAt int64
 		}
 		err := db.Table(tableName).Select("id, created_at").Where("id >= ?", midId).Order("id asc").Limit(1).Scan(&row).Error
-		if err != nil || row.Id == 0 {
-			maxId = midId - 1
+		if err != nil || row.Id == 0 || row.Id >= hi {
+			// [midId, hi) 之间没有记录（id 有空洞）
+			hi = midId
 			continue
 		}
 		if row.CreatedAt < timestamp {
-			resultId = row.Id
-			minId = row.Id + 1
+			lo = row.Id
 		} else {
-			maxId = row.Id - 1
+			hi = row.Id
 		}
 	}
-	return resultId, true
+	return lo, true
 }
 
 // applyTimestampIdRange 将时间戳范围转为主键 id 范围并应用到查询。
@@ -0,0 +1,82 @@
+package model
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type idRangeRow struct {
+	Id        int64
+	CreatedAt int64
+}
+
+func TestFindMaxIdByTimestampGeneric(t *testing.T) {
+	db, err := gorm.Open(
+		sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"),
+		&gorm.Config{Logger: logger.Discard},
+	)
+	if err != nil {
+		t.Skipf("SQLite 不可用（可能未启用 CGO），跳过: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+
+	tables := map[string][]idRangeRow{
+		"empty_rows":      nil,
+		"single_rows":     {{1, 100}},
+		"contiguous_rows": {{1, 10}, {2, 20}, {3, 30}, {4, 40}, {5, 50}},
+		// id 有大段空洞，二分中点经常落在空洞里
+		"gapped_rows": {{1, 10}, {2, 20}, {50, 30}, {51, 40}, {400, 50}, {1000, 60}},
+	}
+	for name, rows := range tables {
+		if err := db.Table(name).AutoMigrate(&idRangeRow{}); err != nil {
+			t.Fatalf("建表 %s 失败: %v", name, err)
+		}
+		for _, row := range rows {
+			if err := db.Table(name).Create(&row).Error; err != nil {
+				t.Fatalf("写入 %s 失败: %v", name, err)
+			}
+		}
+	}
+
+	cases := []struct {
+		name      string
+		table     string
+		timestamp int64
+		wantId    int64
+		wantFound bool
+	}{
+		{"空表", "empty_rows", 100, 0, false},
+		{"单行-早于数据", "single_rows", 100, 0, true},
+		{"单行-晚于数据", "single_rows", 101, 1, true},
+		{"连续-早于全部数据", "contiguous_rows", 5, 0, true},
+		{"连续-等于最小时间", "contiguous_rows", 10, 0, true},
+		{"连续-第一行之后", "contiguous_rows", 15, 1, true},
+		{"连续-中间", "contiguous_rows", 35, 3, true},
+		{"连续-等于中间时间", "contiguous_rows", 30, 2, true},
+		{"连续-最后一行之前", "contiguous_rows", 45, 4, true},
+		{"连续-晚于全部数据", "contiguous_rows", 51, 5, true},
+		{"空洞-早于全部数据", "gapped_rows", 1, 0, true},
+		{"空洞-第一行之后", "gapped_rows", 15, 1, true},
+		{"空洞-空洞之前", "gapped_rows", 25, 2, true},
+		{"空洞-空洞之后", "gapped_rows", 35, 50, true},
+		{"空洞-大空洞之前", "gapped_rows", 45, 51, true},
+		{"空洞-最后一行之前", "gapped_rows", 55, 400, true},
+		{"空洞-晚于全部数据", "gapped_rows", 61, 1000, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			id, found := findMaxIdByTimestampGeneric(db, tc.table, tc.timestamp)
+			if id != tc.wantId || found != tc.wantFound {
+				t.Errorf("findMaxIdByTimestampGeneric(%s, %d) = (%d, %v), want (%d, %v)",
+					tc.table, tc.timestamp, id, found, tc.wantId, tc.wantFound)
+			}
+		})
+	}
+}
@@ -13,6 +13,7 @@ type Image struct {
 	ChannelId     int    `gorm:"index:idx_images_channel_id" json:"channel_id"`
 	KeyIndex      int    `gorm:"default:0" json:"key_index"` // 多 key 渠道：创建任务用的 key 索引；单 key 渠道恒为 0
 	UserId        int    `gorm:"index:idx_images_user_id" json:"user_id"`
+	OrgId         int    `gorm:"default:0" json:"org_id"` // 组织令牌创建的任务，结算与退款走组织额度池
 	Model         string `gorm:"index:idx_images_model" json:"model"`
 	Status        string `gorm:"index:idx_images_status" json:"status"`
 	FailReason    string `json:"fail_reason"`
@@ -0,0 +1,266 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	InvoiceStatusOpen = "open"
+	InvoiceStatusPaid = "paid"
+	InvoiceStatusVoid = "void"
+)
+
+// Invoice 后付费账号的月度账单，由月结任务根据消费日志生成
+type Invoice struct {
+	Id          int     `json:"id"`
+	InvoiceNo   string  `json:"invoice_no" gorm:"type:varchar(32);uniqueIndex"`
+	UserId      int     `json:"user_id" gorm:"uniqueIndex:idx_invoice_user_period"`
+	Period      string  `json:"period" gorm:"type:varchar(7);uniqueIndex:idx_invoice_user_period"` // 2006-01
+	PeriodStart int64   `json:"period_start" gorm:"bigint"`
+	PeriodEnd   int64   `json:"period_end" gorm:"bigint"` // 不含
+	TotalQuota  int64   `json:"total_quota" gorm:"bigint"`
+	Amount      float64 `json:"amount"` // TotalQuota / QuotaPerUnit
+	Status      string  `json:"status" gorm:"type:varchar(16);index;default:'open'"`
+	Note        string  `json:"note" gorm:"type:varchar(255)"`
+	CreatedTime int64   `json:"created_time" gorm:"bigint"`
+	PaidTime    int64   `json:"paid_time" gorm:"bigint"`
+	ClosedBy    int     `json:"closed_by"` // 操作人，0 表示月结任务
+	// RestoredQuota 结清时实际补回的额度，只补回透支部分，不超过 TotalQuota
+	RestoredQuota int64 `json:"restored_quota" gorm:"bigint;default:0"`
+
+	Items []*InvoiceItem `json:"items,omitempty" gorm:"-"`
+}
+
+// InvoiceItem 账单明细，按模型汇总
+type InvoiceItem struct {
+	Id               int    `json:"id"`
+	InvoiceId        int    `json:"invoice_id" gorm:"index"`
+	ModelName        string `json:"model_name" gorm:"type:varchar(255)"`
+	RequestCount     int64  `json:"request_count"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	Quota            int64  `json:"quota" gorm:"bigint"`
+}
+
+func invoicePeriodRange(period string) (start time.Time, end time.Time, err error) {
+	start, err = time.ParseInLocation("2006-01", period, time.Local)
+	if err != nil {
+		return start, end, errors.New("period must be in YYYY-MM format")
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// CloseInvoice 汇总用户某月的消费日志生成账单。同一用户同一账期只会生成一张账单。
+// 开通后付费之前的消费已由预付费余额支付，不计入账单。
+func CloseInvoice(userId int, period string, operatorId int) (*Invoice, error) {
+	start, end, err := invoicePeriodRange(period)
+	if err != nil {
+		return nil, err
+	}
+	if !end.Before(time.Now()) {
+		return nil, errors.New("the period has not ended yet")
+	}
+	if existing, err := GetInvoiceByPeriod(userId, period); err == nil {
+		return existing, errors.New("invoice for this period already exists")
+	}
+	if !config.LogConsumeEnabled {
+		logger.SysError("closing invoice while consume logging is disabled, usage after the switch was turned off is missing")
+	}
+
+	periodStart := start.Unix()
+	if account, err := GetCreditAccount(userId); err == nil && account.CreatedTime > periodStart {
+		periodStart = account.CreatedTime
+	}
+
+	var items []*InvoiceItem
+	tx := LOG_DB.Model(&Log{}).
+		Select("model_name, count(*) as request_count, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens, sum(quota) as quota").
+		Where("user_id = ? AND type = ? AND created_at >= ? AND created_at < ?", userId, LogTypeConsume, periodStart, end.Unix())
+	tx = applyLogIdRange(tx, periodStart, end.Unix()-1)
+	if err := tx.Group("model_name").Order("model_name").Scan(&items).Error; err != nil {
+		return nil, err
+	}
+
+	invoice := &Invoice{
+		InvoiceNo:   fmt.Sprintf("INV-%s-%d-%s", start.Format("200601"), userId, helper.GetRandomString(4)),
+		UserId:      userId,
+		Period:      period,
+		PeriodStart: periodStart,
+		PeriodEnd:   end.Unix(),
+		Status:      InvoiceStatusOpen,
+		CreatedTime: helper.GetTimestamp(),
+		ClosedBy:    operatorId,
+		Items:       items,
+	}
+	for _, item := range items {
+		invoice.TotalQuota += item.Quota
+	}
+	invoice.Amount = float64(invoice.TotalQuota) / config.QuotaPerUnit
+	if invoice.TotalQuota == 0 {
+		invoice.Status = InvoiceStatusPaid
+		invoice.PaidTime = invoice.CreatedTime
+		invoice.Note = "no usage"
+	}
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(invoice)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("invoice for this period already exists")
+		}
+		for _, item := range items {
+			item.InvoiceId = invoice.Id
+		}
+		if len(items) > 0 {
+			return tx.Create(&items).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+func GetInvoiceByPeriod(userId int, period string) (*Invoice, error) {
+	invoice := &Invoice{}
+	err := DB.Where("user_id = ? AND period = ?", userId, period).First(invoice).Error
+	return invoice, err
+}
+
+// GetInvoiceById 读取账单及明细；userId 非 0 时只返回该用户的账单
+func GetInvoiceById(id int, userId int) (*Invoice, error) {
+	invoice := &Invoice{}
+	tx := DB.Where("id = ?", id)
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if err := tx.First(invoice).Error; err != nil {
+		return nil, err
+	}
+	if err := DB.Where("invoice_id = ?", invoice.Id).Order("quota desc").Find(&invoice.Items).Error; err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+func GetInvoices(userId int, status string, page int, pageSize int) (invoices []*Invoice, total int64, err error) {
+	tx := DB.Model(&Invoice{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(pageSize).Offset((page - 1) * pageSize).Find(&invoices).Error
+	return invoices, total, err
+}
+
+// MarkInvoicePaid 账单结清：补回透支的额度。
+// 账期内的消费可能部分由充值、预付余额或组织额度池支付，因此只把负余额补回到 0，且不超过账单金额。
+func MarkInvoicePaid(id int, note string) (*Invoice, error) {
+	invoice := &Invoice{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"status": InvoiceStatusPaid, "paid_time": helper.GetTimestamp()}
+		if note != "" {
+			updates["note"] = note
+		}
+		result := tx.Model(&Invoice{}).Where("id = ? AND status = ?", id, InvoiceStatusOpen).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("only open invoices can be marked as paid")
+		}
+		if err := tx.Where("id = ?", id).First(invoice).Error; err != nil {
+			return err
+		}
+		var quota int64
+		err := tx.Model(&User{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", invoice.UserId).Select("quota").Scan(&quota).Error
+		if err != nil {
+			return err
+		}
+		if quota >= 0 {
+			return nil
+		}
+		invoice.RestoredQuota = -quota
+		if invoice.RestoredQuota > invoice.TotalQuota {
+			invoice.RestoredQuota = invoice.TotalQuota
+		}
+		if err := tx.Model(invoice).Update("restored_quota", invoice.RestoredQuota).Error; err != nil {
+			return err
+		}
+		return tx.Model(&User{}).Where("id = ?", invoice.UserId).
+			Update("quota", gorm.Expr("quota + ?", invoice.RestoredQuota)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := CacheUpdateUserQuota2(invoice.UserId); err != nil {
+		logger.SysError("failed to refresh user quota cache: " + err.Error())
+	}
+	checkCreditLimitNotice(invoice.UserId)
+	RecordLog(invoice.UserId, LogTypeTopup, fmt.Sprintf("账单 %s 已结清，恢复额度 %d", invoice.InvoiceNo, invoice.RestoredQuota))
+	return invoice, nil
+}
+
+// VoidInvoice 作废账单，不改动余额
+func VoidInvoice(id int, note string) error {
+	result := DB.Model(&Invoice{}).Where("id = ? AND status = ?", id, InvoiceStatusOpen).
+		Updates(map[string]interface{}{"status": InvoiceStatusVoid, "note": note})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("only open invoices can be voided")
+	}
+	return nil
+}
+
+// CloseMonthlyInvoices 为所有后付费账号生成上个月的账单，已生成的跳过
+func CloseMonthlyInvoices(now time.Time) {
+	period := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local).AddDate(0, -1, 0).Format("2006-01")
+	accounts, err := GetAllCreditAccounts()
+	if err != nil {
+		logger.SysError("failed to load credit accounts: " + err.Error())
+		return
+	}
+	for _, account := range accounts {
+		if _, err := GetInvoiceByPeriod(account.UserId, period); err == nil {
+			continue
+		}
+		invoice, err := CloseInvoice(account.UserId, period, 0)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to close invoice of user %d for %s: %s", account.UserId, period, err.Error()))
+			continue
+		}
+		logger.SysLog(fmt.Sprintf("invoice %s closed: user=%d, quota=%d", invoice.InvoiceNo, invoice.UserId, invoice.TotalQuota))
+	}
+}
+
+// StartInvoiceCloseTask master 节点每小时检查一次，月初自动出上月账单
+func StartInvoiceCloseTask() {
+	if !config.IsMasterNode {
+		return
+	}
+	go func() {
+		for {
+			CloseMonthlyInvoices(time.Now())
+			time.Sleep(time.Hour)
+		}
+	}()
+}
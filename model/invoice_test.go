@@ -0,0 +1,80 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+func TestPostpaidCreditAndInvoice(t *testing.T) {
+	setupTestDB(t, &Log{}, &CreditAccount{}, &Invoice{}, &InvoiceItem{})
+	origLogDB, origRedis := LOG_DB, common.RedisEnabled
+	LOG_DB, common.RedisEnabled = DB, false
+	t.Cleanup(func() { LOG_DB, common.RedisEnabled = origLogDB, origRedis })
+
+	// 账期内本人令牌消费 200、充值 50，余额 -150；组织令牌的消费由组织额度池支付，不影响个人余额
+	user := &User{Id: 7, Username: "bob", Quota: -150, AccessToken: "b", AffCode: "b"}
+	if err := DB.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	if quota, _ := CacheGetPayerQuota(context.Background(), user.Id, 0); quota != -150 {
+		t.Errorf("预付费用户可用额度应为余额本身，实际 %d", quota)
+	}
+	if err := SaveCreditAccount(&CreditAccount{UserId: user.Id, CreditLimit: 1000}); err != nil {
+		t.Fatalf("开通后付费失败: %v", err)
+	}
+	if quota, _ := CacheGetPayerQuota(context.Background(), user.Id, 0); quota != 850 {
+		t.Errorf("后付费用户可用额度应含透支额度，实际 %d", quota)
+	}
+
+	lastMonth := time.Date(time.Now().Year(), time.Now().Month(), 1, 0, 0, 0, 0, time.Local).AddDate(0, -1, 0)
+	period := lastMonth.Format("2006-01")
+	// 上月中途开通后付费
+	DB.Model(&CreditAccount{}).Where("user_id = ?", user.Id).Update("created_time", lastMonth.Unix()+15)
+	logs := []*Log{
+		{UserId: user.Id, Type: LogTypeConsume, ModelName: "gpt-a", Quota: 100, PromptTokens: 10, CreatedAt: lastMonth.Unix() + 10}, // 开通前，预付费已支付
+		{UserId: user.Id, Type: LogTypeConsume, ModelName: "gpt-a", Quota: 50, PromptTokens: 5, CreatedAt: lastMonth.Unix() + 20},
+		{UserId: user.Id, Type: LogTypeConsume, ModelName: "gpt-b", Quota: 150, CompletionTokens: 3, CreatedAt: lastMonth.Unix() + 30},
+		{UserId: user.Id, Type: LogTypeConsume, ModelName: "gpt-b", Quota: 400, TokenName: "org-token", CreatedAt: lastMonth.Unix() + 40},
+		{UserId: user.Id, Type: LogTypeConsume, ModelName: "gpt-b", Quota: 999, CreatedAt: time.Now().Unix()},
+		{UserId: 8, Type: LogTypeConsume, ModelName: "gpt-b", Quota: 999, CreatedAt: lastMonth.Unix() + 40},
+	}
+	if err := DB.Create(&logs).Error; err != nil {
+		t.Fatalf("写入日志失败: %v", err)
+	}
+
+	CloseMonthlyInvoices(time.Now())
+	invoice, err := GetInvoiceByPeriod(user.Id, period)
+	if err != nil {
+		t.Fatalf("月结应生成上月账单: %v", err)
+	}
+	if invoice.TotalQuota != 600 || invoice.Status != InvoiceStatusOpen || invoice.PeriodStart != lastMonth.Unix()+15 {
+		t.Errorf("账单应只汇总本人开通后的上月消费，实际 total=%d status=%s start=%d", invoice.TotalQuota, invoice.Status, invoice.PeriodStart)
+	}
+	full, _ := GetInvoiceById(invoice.Id, user.Id)
+	if len(full.Items) != 2 || full.Items[0].Quota != 550 {
+		t.Errorf("明细应按模型汇总，实际 %+v", full.Items)
+	}
+	if _, err := CloseInvoice(user.Id, period, 1); err == nil {
+		t.Error("同一账期不应重复出账单")
+	}
+	if _, err := GetInvoiceById(invoice.Id, 8); err == nil {
+		t.Error("不应读取到他人的账单")
+	}
+
+	paid, err := MarkInvoicePaid(invoice.Id, "")
+	if err != nil {
+		t.Fatalf("结清账单失败: %v", err)
+	}
+	if quota, _ := GetUserQuota(user.Id); quota != 0 || paid.RestoredQuota != 150 {
+		t.Errorf("结清后只应补回透支的 150，实际补回 %d、余额 %d", paid.RestoredQuota, quota)
+	}
+	if _, err := MarkInvoicePaid(invoice.Id, ""); err == nil {
+		t.Error("已结清的账单不能重复结清")
+	}
+	if err := VoidInvoice(invoice.Id, ""); err == nil {
+		t.Error("已结清的账单不能作废")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
@@ -28,6 +29,7 @@ type Log struct {
 	TokenName        string  `json:"token_name" gorm:"index:idx_token_name;default:''"`
 	ModelName        string  `json:"model_name" gorm:"index:idx_model_name;index:index_username_model_name,priority:1;default:''"`
 	Quota            int     `json:"quota" gorm:"default:0"`
+	Cost             int     `json:"cost" gorm:"default:0"` // 上游成本（额度单位），渠道未配置成本时为 0
 	PromptTokens     int     `json:"prompt_tokens" gorm:"default:0"`
 	CompletionTokens int     `json:"completion_tokens" gorm:"default:0"`
 	CachedTokens     int     `json:"cached_tokens" gorm:"default:0"`
@@ -143,6 +145,51 @@ func RecordConsumeLogWithOtherAndRequestID(ctx context.Context, userId int, chan
 		IsStream:         isStream,
 	})
 
+	// 组织令牌的消费同时归属到组织与实际调用的成员（userId），
+	// 与日志开关无关，否则关日志后组织看板的成员拆分会缺数据。
+	if v := ctx.Value(logger.OrgIdKey); v != nil {
+		if orgId, ok := v.(int); ok && orgId > 0 {
+			RecordOrganizationUsage(orgId, userId, dbModelName, quota)
+		}
+	}
+	// 临时密钥的花费上限同样不能依赖日志开关。临时密钥签发时绑定的 end user 优先于请求体的 user 字段
+	requestTags := requestTagsFromContext(ctx)
+	endUser := chargeEphemeralKeyFromContext(ctx, quota)
+	if endUser == "" && requestTags != nil {
+		endUser = requestTags.EndUser
+	}
+	if endUser != "" {
+		if other != "" {
+			other += ";end_user:" + endUser
+		} else {
+			other = "end_user:" + endUser
+		}
+	}
+	if quota > 0 && GetCreditLimit(userId) > 0 {
+		checkCreditLimitNotice(userId)
+	}
+	// 定价计划的月度用量决定后续请求的档位，同样不能依赖日志开关
+	if segment := recordPricingPlanUsageFromContext(ctx, userId, quota, int64(promptTokens+completionTokens)); segment != "" {
+		if other != "" {
+			other += ";" + segment
+		} else {
+			other = segment
+		}
+	}
+	if segment := modelCreditSegmentFromContext(ctx); segment != "" {
+		if other != "" {
+			other += ";" + segment
+		} else {
+			other = segment
+		}
+	}
+
+	// 成本按实际请求上游的模型名计算；低于成本的提醒同样不能依赖日志开关
+	cost := GetUpstreamCost(channelId, modelName, promptTokens, completionTokens, cachedTokens, quota)
+	if cost > 0 {
+		checkBelowCost(channelId, modelName, quota, cost)
+	}
+
 	if !config.LogConsumeEnabled {
 		return
 	}
@@ -161,6 +208,14 @@ func RecordConsumeLogWithOtherAndRequestID(ctx context.Context, userId int, chan
 			other = "ip:" + requestIP
 		}
 	}
+	if segment := requestTags.otherSegment(); segment != "" {
+		if other != "" {
+			other += ";" + segment
+		} else {
+			other = segment
+		}
+	}
+	other = appendPriceVersion(other)
 
 	log := &Log{
 		UserId:           userId,
@@ -174,6 +229,7 @@ func RecordConsumeLogWithOtherAndRequestID(ctx context.Context, userId int, chan
 		ModelName:        dbModelName,
 		CachedTokens:     cachedTokens,
 		Quota:            int(quota),
+		Cost:             int(cost),
 		ChannelId:        channelId,
 		Duration:         duration,
 		Title:            title,
@@ -188,7 +244,10 @@ func RecordConsumeLogWithOtherAndRequestID(ctx context.Context, userId int, chan
 	err := LOG_DB.Create(log).Error
 	if err != nil {
 		logger.Error(ctx, "failed to record log: "+err.Error())
+	} else {
+		recordLogTags(ctx, log, requestTags, endUser)
 	}
+	exportLog(log)
 
 	// 增量更新直方图（用于 P50/P95/P99 计算，零 DB 查询）
 	// 注意：log.Provider 当前未在此处赋值（logs 表中 provider 字段也为空），
@@ -233,6 +292,7 @@ func RecordErrorLogWithRequestID(ctx context.Context, userId int, channelId int,
 	if err != nil {
 		logger.Error(ctx, "failed to record error log: "+err.Error())
 	}
+	exportLog(log)
 }
 
 // RecordModelProbeLog 记录上游模型探针日志（Type 为 LogTypeSystem）
@@ -272,7 +332,7 @@ func RecordModelProbeLog(channelId int, modelName, title, content, other string,
 	}
 }
 
-func GetCurrentAllLogsAndCount(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, xRequestId string, xResponseId string, page int, pageSize int, channel int) (logs []*Log, total int64, err error) {
+func GetCurrentAllLogsAndCount(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, xRequestId string, xResponseId string, page int, pageSize int, channel int, endUser string, tags []RequestTag) (logs []*Log, total int64, err error) {
 	var tx *gorm.DB
 
 	// 根据日志类型筛选
@@ -304,6 +364,7 @@ func GetCurrentAllLogsAndCount(logType int, startTimestamp int64, endTimestamp i
 	if channel != 0 {
 		tx = tx.Where("channel_id = ?", channel)
 	}
+	tx = applyLogTagFilter(tx, startTimestamp, endTimestamp, endUser, tags)
 
 	// 首先计算满足条件的总数
 	err = tx.Model(&Log{}).Count(&total).Error
@@ -324,7 +385,7 @@ func GetCurrentAllLogsAndCount(logType int, startTimestamp int64, endTimestamp i
 	return logs, total, nil
 }
 
-func GetCurrentUserLogsAndCount(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, xRequestId string, xResponseId string, page int, pageSize int) (logs []*Log, total int64, err error) {
+func GetCurrentUserLogsAndCount(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, xRequestId string, xResponseId string, page int, pageSize int, endUser string, tags []RequestTag) (logs []*Log, total int64, err error) {
 	var tx *gorm.DB
 
 	// 筛选基于用户ID和日志类型
@@ -350,6 +411,7 @@ func GetCurrentUserLogsAndCount(userId int, logType int, startTimestamp int64, e
 	if xResponseId != "" {
 		tx = tx.Where("x_response_id = ?", xResponseId)
 	}
+	tx = applyLogTagFilter(tx, startTimestamp, endTimestamp, endUser, tags)
 
 	// 首先计算满足条件的总数
 	err = tx.Model(&Log{}).Count(&total).Error
@@ -428,6 +490,11 @@ func DeleteOldLog(targetTimestamp int64) (int64, error) {
 		return 0, nil
 	}
 	result := LOG_DB.Where("id <= ?", id).Delete(&Log{})
+	if result.Error == nil {
+		if err := LOG_DB.Where("log_id <= ?", id).Delete(&LogTag{}).Error; err != nil {
+			logger.SysError("failed to delete old log tags: " + err.Error())
+		}
+	}
 	return result.RowsAffected, result.Error
 }
 
@@ -579,68 +646,48 @@ func getDashboardMetrics(userId int) (*DashboardMetrics, error) {
 	currentTime := now.Unix()
 	oneMinuteAgo := currentTime - 60
 	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Unix()
-	endOfDay := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 999999999, now.Location()).Unix()
-
-	// 预计算 today 的 id 范围，复用给查询2和查询3，避免重复二分查找
-	todayStartId, _ := findMaxIdByTimestampGeneric(LOG_DB, "logs", startOfDay)
-	todayEndId, todayEndFound := findMaxIdByTimestampGeneric(LOG_DB, "logs", endOfDay+1)
-
-	applyTodayIdRange := func(tx *gorm.DB) *gorm.DB {
-		if todayStartId > 0 {
-			tx = tx.Where("id > ?", todayStartId)
-		}
-		if todayEndFound && todayEndId == 0 {
-			tx = tx.Where("1 = 0")
-		} else if todayEndId > 0 {
-			tx = tx.Where("id <= ?", todayEndId)
-		}
-		return tx
-	}
-
-	applyUserFilter := func(tx *gorm.DB) *gorm.DB {
-		if userId > 0 {
-			tx = tx.Where("user_id = ?", userId)
-		}
-		return tx
-	}
 
 	result := &DashboardMetrics{}
 
-	// 查询1: 最近一分钟指标
+	// 查询1: 最近一分钟指标。窗口远小于汇总粒度，直接查 logs（id 范围很窄）
 	txMinute := LOG_DB.Model(&Log{}).
 		Select(`
 			COUNT(*) as rpm,
 			COALESCE(SUM(prompt_tokens + completion_tokens), 0) as tpm,
 			COALESCE(SUM(quota), 0) as quota_sum
 		`)
-	txMinute = applyUserFilter(txMinute)
+	if userId > 0 {
+		txMinute = txMinute.Where("user_id = ?", userId)
+	}
 	txMinute = applyBillableLogTypes(txMinute)
 	txMinute = applyLogIdRange(txMinute, oneMinuteAgo, currentTime)
 	if err := txMinute.Row().Scan(&result.RPM, &result.TPM, &result.QuotaPM); err != nil {
 		return nil, err
 	}
 
-	// 查询2: 今日统计（复用预计算的 today id 范围）
-	txDaily := LOG_DB.Model(&Log{}).
-		Select(`
-			COUNT(*) as request_pd,
-			COALESCE(SUM(quota), 0) as used_pd
-		`)
-	txDaily = applyUserFilter(txDaily)
-	txDaily = applyBillableLogTypes(txDaily)
-	txDaily = applyTodayIdRange(txDaily)
-	if err := txDaily.Row().Scan(&result.RequestPD, &result.UsedPD); err != nil {
+	// 查询2: 今日统计与 Top 5 模型，按模型分组一次取回，今日合计由各模型相加
+	byModel, err := aggregateUsage(usageQuery{
+		Start:        startOfDay,
+		End:          currentTime + 1,
+		Filter:       UsageFilter{UserId: userId},
+		GroupByModel: true,
+	})
+	if err != nil {
 		return nil, err
 	}
-
-	// 查询3: Top 5 模型（复用预计算的 today id 范围）
-	txModels := LOG_DB.Model(&Log{}).
-		Select("model_name, COALESCE(SUM(quota), 0) as quota_sum")
-	txModels = applyUserFilter(txModels)
-	txModels = applyBillableLogTypes(txModels)
-	txModels = applyTodayIdRange(txModels)
-	if err := txModels.Group("model_name").Order("quota_sum DESC").Limit(5).Scan(&result.ModelStats).Error; err != nil {
-		return nil, err
+	for modelName, m := range byModel {
+		result.RequestPD += m.Requests
+		result.UsedPD += m.Quota
+		result.ModelStats = append(result.ModelStats, ModelQuotaStats{ModelName: modelName, QuotaSum: m.Quota})
+	}
+	sort.Slice(result.ModelStats, func(i, j int) bool {
+		if result.ModelStats[i].QuotaSum != result.ModelStats[j].QuotaSum {
+			return result.ModelStats[i].QuotaSum > result.ModelStats[j].QuotaSum
+		}
+		return result.ModelStats[i].ModelName < result.ModelStats[j].ModelName
+	})
+	if len(result.ModelStats) > 5 {
+		result.ModelStats = result.ModelStats[:5]
 	}
 
 	return result, nil
@@ -671,6 +718,22 @@ func RecordVideoConsumeLog(ctx context.Context, userId int, channelId int, promp
 	// 混进 llm_request_duration_seconds 会污染 P95。
 	metrics.ObserveVideoConsume(modelName, promptTokens, completionTokens, quota)
 
+	if v := ctx.Value(logger.OrgIdKey); v != nil {
+		if orgId, ok := v.(int); ok && orgId > 0 {
+			RecordOrganizationUsage(orgId, userId, modelName, quota)
+		}
+	}
+	requestTags := requestTagsFromContext(ctx)
+	endUser := chargeEphemeralKeyFromContext(ctx, quota)
+	if endUser == "" && requestTags != nil {
+		endUser = requestTags.EndUser
+	}
+	planSegment := recordPricingPlanUsageFromContext(ctx, userId, quota, int64(promptTokens+completionTokens))
+	if quota > 0 && GetCreditLimit(userId) > 0 {
+		checkCreditLimitNotice(userId)
+	}
+	creditSegment := modelCreditSegmentFromContext(ctx)
+
 	if !config.LogConsumeEnabled {
 		return
 	}
@@ -679,6 +742,28 @@ func RecordVideoConsumeLog(ctx context.Context, userId int, channelId int, promp
 	if requestIP != "" {
 		other = "ip:" + requestIP
 	}
+	other = appendPriceVersion(other)
+	if planSegment != "" {
+		if other != "" {
+			other += ";" + planSegment
+		} else {
+			other = planSegment
+		}
+	}
+	if creditSegment != "" {
+		if other != "" {
+			other += ";" + creditSegment
+		} else {
+			other = creditSegment
+		}
+	}
+	if segment := requestTags.otherSegment(); segment != "" {
+		if other != "" {
+			other += ";" + segment
+		} else {
+			other = segment
+		}
+	}
 
 	log := &Log{
 		UserId:           userId,
@@ -691,6 +776,7 @@ func RecordVideoConsumeLog(ctx context.Context, userId int, channelId int, promp
 		TokenName:        tokenName,
 		ModelName:        modelName,
 		Quota:            int(quota),
+		Cost:             int(GetUpstreamCost(channelId, modelName, promptTokens, completionTokens, 0, quota)),
 		ChannelId:        channelId,
 		Duration:         duration,
 		Title:            title,
@@ -702,7 +788,10 @@ func RecordVideoConsumeLog(ctx context.Context, userId int, channelId int, promp
 	err := LOG_DB.Create(log).Error
 	if err != nil {
 		logger.Error(ctx, "failed to record video log: "+err.Error())
+	} else {
+		recordLogTags(ctx, log, requestTags, endUser)
 	}
+	exportLog(log)
 }
 
 // UpdateLogQuotaAndTokens 更新日志记录的Quota和CompletionTokens字段
@@ -722,6 +811,17 @@ func UpdateLogQuotaAndTokens(videoTaskId string, quota int64, completionTokens i
 		return errors.New("no log found with the given video_task_id")
 	}
 
+	// 标签索引冗余了用量，需同步
+	err := LOG_DB.Model(&LogTag{}).
+		Where("log_id IN (?)", LOG_DB.Model(&Log{}).Select("id").Where("video_task_id = ?", videoTaskId)).
+		Updates(map[string]interface{}{
+			"quota":             quota,
+			"completion_tokens": completionTokens,
+		}).Error
+	if err != nil {
+		logger.SysError("failed to update log tags of video task " + videoTaskId + ": " + err.Error())
+	}
+
 	return nil
 }
 
@@ -806,7 +906,16 @@ func GetUserPerformanceStat(userId int, logType int, startTimestamp, endTimestam
 	return getPerformanceStat(logType, startTimestamp, endTimestamp, modelName, "", tokenName, channel, userId, bucketSeconds)
 }
 
+// usagePerformanceRawMaxSeconds 不超过该跨度的性能统计保留 5m/15m 粒度（只查 logs）；更长的跨度按小时读汇总表
+const usagePerformanceRawMaxSeconds = 6 * 3600
+
 func getPerformanceStat(logType int, startTimestamp, endTimestamp int64, modelName, username, tokenName string, channel int, userId int, bucketSeconds int64) (*PerformanceStatResult, error) {
+	// 汇总表只有 consume / error 两类，按单一类型筛选时仍查 logs
+	if config.UsageRollupEnabled && logType == LogTypeUnknown {
+		return getPerformanceStatFromUsage(startTimestamp, endTimestamp, UsageFilter{
+			UserId: userId, Username: username, TokenName: tokenName, ModelName: modelName, ChannelId: channel,
+		}, bucketSeconds)
+	}
 	result := &PerformanceStatResult{}
 
 	// === 1. Summary: 聚合查询 ===
@@ -927,3 +1036,63 @@ func getPerformanceStat(logType int, startTimestamp, endTimestamp int64, modelNa
 
 	return result, nil
 }
+
+// appendPriceVersion 在 Other 中记下计费时生效的价格簿版本，便于追溯历史价格
+func appendPriceVersion(other string) string {
+	version := common.GetActivePriceVersion()
+	if version == "" {
+		return other
+	}
+	if other != "" {
+		return other + ";price_version:" + version
+	}
+	return "price_version:" + version
+}
+
+// getPerformanceStatFromUsage 从用量汇总计算性能统计，百分位由直方图估算
+func getPerformanceStatFromUsage(startTimestamp, endTimestamp int64, filter UsageFilter, bucketSeconds int64) (*PerformanceStatResult, error) {
+	from, to := usageRange(startTimestamp, endTimestamp)
+	if to-from > usagePerformanceRawMaxSeconds && bucketSeconds < UsagePeriodHour {
+		bucketSeconds = UsagePeriodHour
+	}
+	buckets, err := aggregateUsage(usageQuery{Start: from, End: to, Filter: filter, Bucket: bucketSeconds})
+	if err != nil {
+		return nil, fmt.Errorf("usage query failed: %w", err)
+	}
+
+	total := &UsageMetrics{}
+	result := &PerformanceStatResult{Timeseries: make([]PerformanceStatTimeSeriesPoint, 0, len(buckets))}
+	for key, m := range buckets {
+		total.Add(m)
+		successRate := 0.0
+		if m.Requests > 0 {
+			successRate = math.Round(float64(m.SuccessRequests)/float64(m.Requests)*10000) / 10000
+		}
+		result.Timeseries = append(result.Timeseries, PerformanceStatTimeSeriesPoint{
+			Timestamp:           parseUsageBucketKey(key),
+			TotalRequests:       m.Requests,
+			AvgDuration:         math.Round(safeDiv(m.SumDuration, m.DurationCount)*1000) / 1000,
+			AvgFirstWordLatency: math.Round(safeDiv(m.SumFirstWord, m.FirstWordCount)*1000) / 1000,
+			AvgSpeed:            math.Round(safeDiv(m.SumSpeed, m.SpeedCount)*100) / 100,
+			SuccessRate:         successRate,
+		})
+	}
+	sort.Slice(result.Timeseries, func(i, j int) bool {
+		return result.Timeseries[i].Timestamp < result.Timeseries[j].Timestamp
+	})
+
+	latency, firstWord := total.LatencyHistogram(), total.FirstWordHistogram()
+	result.Summary = PerformanceStatSummary{
+		TotalRequests:       total.Requests,
+		AvgDuration:         math.Round(safeDiv(total.SumDuration, total.DurationCount)*1000) / 1000,
+		P50Duration:         math.Round(EstimatePercentile(latency, 0.50)*1000) / 1000,
+		P95Duration:         math.Round(EstimatePercentile(latency, 0.95)*1000) / 1000,
+		P99Duration:         math.Round(EstimatePercentile(latency, 0.99)*1000) / 1000,
+		AvgFirstWordLatency: math.Round(safeDiv(total.SumFirstWord, total.FirstWordCount)*1000) / 1000,
+		P95FirstWordLatency: math.Round(EstimatePercentile(firstWord, 0.95)*1000) / 1000,
+		AvgSpeed:            math.Round(safeDiv(total.SumSpeed, total.SpeedCount)*100) / 100,
+		SuccessCount:        total.SuccessRequests,
+		ErrorCount:          total.ErrorRequests,
+	}
+	return result, nil
+}
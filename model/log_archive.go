@@ -0,0 +1,469 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/objstore"
+	"gorm.io/gorm"
+)
+
+const (
+	LogArchiveStatusExported = "exported" // 已导出并校验，源数据尚未删除（删除失败时停留在此状态，下次任务重试）
+	LogArchiveStatusArchived = "archived" // 源数据已删除
+	LogArchiveStatusError    = "error"
+
+	logArchiveDayLayout = "2006-01-02"
+	logArchiveBatchSize = 1000
+	logArchivePartRows  = 100000
+	// logArchiveMaxDays 单次任务每张表最多处理的天数，以及恢复/查询一次允许的最大日期跨度，
+	// 首次开启归档时积压再多也不会长时间占用数据库
+	logArchiveMaxDays = 31
+)
+
+// LogArchive 归档清单，一张表的一天一条。
+// 归档文件布局：<LogArchivePrefix>/<table>/dt=YYYY-MM-DD/part-00000.ndjson.gz，同目录下的
+// manifest.json 是本条记录的副本，数据库丢失时仍能从存储本身还原清单。
+type LogArchive struct {
+	Id           int    `json:"id"`
+	SourceTable  string `json:"source_table" gorm:"type:varchar(32);uniqueIndex:idx_log_archive_day"`
+	Day          string `json:"day" gorm:"type:varchar(10);uniqueIndex:idx_log_archive_day"`
+	ObjectPrefix string `json:"object_prefix"`
+	Parts        int    `json:"parts"`
+	RowCount     int64  `json:"row_count"`
+	MinId        int64  `json:"min_id"`
+	MaxId        int64  `json:"max_id"`
+	Bytes        int64  `json:"bytes"`
+	Status       string `json:"status" gorm:"type:varchar(16);index"`
+	Message      string `json:"message" gorm:"type:text"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime  int64  `json:"updated_time" gorm:"bigint"`
+}
+
+type logArchiveTable struct {
+	db      func() *gorm.DB
+	rowType reflect.Type
+}
+
+var logArchiveTables = map[string]logArchiveTable{
+	"logs":   {db: func() *gorm.DB { return LOG_DB }, rowType: reflect.TypeOf(Log{})},
+	"videos": {db: func() *gorm.DB { return DB }, rowType: reflect.TypeOf(Video{})},
+	"images": {db: func() *gorm.DB { return DB }, rowType: reflect.TypeOf(Image{})},
+}
+
+// LogArchiveTables 支持归档的表，按归档顺序排列
+var LogArchiveTables = []string{"logs", "videos", "images"}
+
+func getLogArchiveTable(table string) (logArchiveTable, error) {
+	t, ok := logArchiveTables[table]
+	if !ok {
+		return t, fmt.Errorf("不支持归档的表: %s", table)
+	}
+	return t, nil
+}
+
+func logArchiveObjectPrefix(table, day string) string {
+	prefix := strings.Trim(config.LogArchivePrefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return fmt.Sprintf("%s%s/dt=%s/", prefix, table, day)
+}
+
+func logArchivePartKey(objectPrefix string, part int) string {
+	return fmt.Sprintf("%spart-%05d.ndjson.gz", objectPrefix, part)
+}
+
+// ArchiveTableBefore 把 table 中 cutoff 所在 UTC 自然日之前的数据逐天归档并删除，返回删除的行数。
+// 从表中最早一条记录所在的日期开始，每次最多处理 logArchiveMaxDays 天。
+func ArchiveTableBefore(ctx context.Context, store objstore.Store, table string, cutoff time.Time) (int64, error) {
+	t, err := getLogArchiveTable(table)
+	if err != nil {
+		return 0, err
+	}
+	var oldest struct{ CreatedAt int64 }
+	if err := t.db().Table(table).Select("created_at").Order("id asc").Limit(1).Scan(&oldest).Error; err != nil {
+		return 0, err
+	}
+	if oldest.CreatedAt == 0 {
+		return 0, nil
+	}
+	cutoffDay := cutoff.UTC().Truncate(24 * time.Hour)
+	day := time.Unix(oldest.CreatedAt, 0).UTC().Truncate(24 * time.Hour)
+	var deleted int64
+	for i := 0; i < logArchiveMaxDays && day.Before(cutoffDay); i++ {
+		n, err := archiveTableDay(ctx, store, table, t, day)
+		deleted += n
+		if err != nil {
+			return deleted, fmt.Errorf("%s %s: %w", table, day.Format(logArchiveDayLayout), err)
+		}
+		day = day.Add(24 * time.Hour)
+	}
+	return deleted, nil
+}
+
+// ArchiveTablesBefore 依次归档所有支持的表，单张表失败不影响其余表
+func ArchiveTablesBefore(ctx context.Context, store objstore.Store, cutoff time.Time) (int64, error) {
+	var deleted int64
+	var errs []error
+	for _, table := range LogArchiveTables {
+		n, err := ArchiveTableBefore(ctx, store, table, cutoff)
+		deleted += n
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// archiveTableDay 导出 → 回读校验每个分片的行数 → 核对源表行数 → 在事务中删除并核对删除行数。
+// 任何一步不一致都不会删除源数据。
+func archiveTableDay(ctx context.Context, store objstore.Store, table string, t logArchiveTable, day time.Time) (int64, error) {
+	dayStr := day.Format(logArchiveDayLayout)
+	record := &LogArchive{}
+	if err := DB.Where("source_table = ? AND day = ?", table, dayStr).Limit(1).Find(record).Error; err != nil {
+		return 0, err
+	}
+	if record.Status == LogArchiveStatusArchived {
+		return 0, nil
+	}
+
+	db := t.db()
+	start, end := day.Unix(), day.Add(24*time.Hour).Unix()
+	lowId, found := findMaxIdByTimestampGeneric(db, table, start)
+	if !found {
+		return 0, nil
+	}
+	highId, _ := findMaxIdByTimestampGeneric(db, table, end)
+	if highId <= lowId {
+		return 0, nil
+	}
+	scope := func() *gorm.DB {
+		return db.Table(table).Where("id > ? AND id <= ? AND created_at >= ? AND created_at < ?", lowId, highId, start, end)
+	}
+
+	record.SourceTable, record.Day = table, dayStr
+	record.ObjectPrefix = logArchiveObjectPrefix(table, dayStr)
+	record.Parts, record.RowCount, record.Bytes, record.MinId, record.MaxId = 0, 0, 0, 0, 0
+	record.Message = ""
+
+	var part bytes.Buffer
+	var zw *gzip.Writer
+	partRows := 0
+	flush := func() error {
+		if zw == nil {
+			return nil
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		key := logArchivePartKey(record.ObjectPrefix, record.Parts)
+		if err := store.Put(ctx, key, part.Bytes()); err != nil {
+			return err
+		}
+		data, err := store.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if n, err := countLogArchiveRows(data); err != nil || n != partRows {
+			return fmt.Errorf("分片 %s 回读校验失败: 写入 %d 行，读回 %d 行 %v", key, partRows, n, err)
+		}
+		record.Parts++
+		record.Bytes += int64(len(data))
+		part.Reset()
+		zw, partRows = nil, 0
+		return nil
+	}
+
+	lastId := lowId
+	for {
+		batch := reflect.New(reflect.SliceOf(t.rowType))
+		if err := scope().Where("id > ?", lastId).Order("id asc").Limit(logArchiveBatchSize).Find(batch.Interface()).Error; err != nil {
+			return 0, err
+		}
+		rows := batch.Elem()
+		if rows.Len() == 0 {
+			break
+		}
+		for i := 0; i < rows.Len(); i++ {
+			row := rows.Index(i)
+			line, err := json.Marshal(row.Interface())
+			if err != nil {
+				return 0, err
+			}
+			if zw == nil {
+				zw = gzip.NewWriter(&part)
+			}
+			zw.Write(line)
+			zw.Write([]byte{'\n'})
+			partRows++
+			lastId = row.FieldByName("Id").Int()
+			if record.MinId == 0 {
+				record.MinId = lastId
+			}
+			record.MaxId = lastId
+			record.RowCount++
+			if partRows >= logArchivePartRows {
+				if err := flush(); err != nil {
+					return 0, saveLogArchiveError(record, err)
+				}
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return 0, saveLogArchiveError(record, err)
+	}
+	if record.RowCount == 0 {
+		return 0, nil
+	}
+
+	var count int64
+	if err := scope().Count(&count).Error; err != nil {
+		return 0, err
+	}
+	if count != record.RowCount {
+		return 0, saveLogArchiveError(record, fmt.Errorf("导出期间源表行数变化: 导出 %d 行，当前 %d 行", record.RowCount, count))
+	}
+	record.Status = LogArchiveStatusExported
+	if err := saveLogArchive(ctx, store, record); err != nil {
+		return 0, err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Table(table).Where("id >= ? AND id <= ? AND created_at >= ? AND created_at < ?", record.MinId, record.MaxId, start, end).
+			Delete(reflect.New(t.rowType).Interface())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != record.RowCount {
+			return fmt.Errorf("删除行数 %d 与归档行数 %d 不一致，已回滚", result.RowsAffected, record.RowCount)
+		}
+		return nil
+	})
+	if err != nil {
+		record.Message = err.Error()
+		saveLogArchive(ctx, store, record)
+		return 0, err
+	}
+	record.Status = LogArchiveStatusArchived
+	if err := saveLogArchive(ctx, store, record); err != nil {
+		logger.SysError(fmt.Sprintf("log archive: %s %s 已删除但清单更新失败: %s", table, dayStr, err.Error()))
+	}
+	logger.SysLog(fmt.Sprintf("log archive: %s %s archived %d rows in %d part(s)", table, dayStr, record.RowCount, record.Parts))
+	return record.RowCount, nil
+}
+
+func saveLogArchive(ctx context.Context, store objstore.Store, record *LogArchive) error {
+	now := helper.GetTimestamp()
+	if record.CreatedTime == 0 {
+		record.CreatedTime = now
+	}
+	record.UpdatedTime = now
+	if err := DB.Save(record).Error; err != nil {
+		return err
+	}
+	if record.Status == LogArchiveStatusError {
+		return nil
+	}
+	data, _ := json.Marshal(record)
+	return store.Put(ctx, record.ObjectPrefix+"manifest.json", data)
+}
+
+func saveLogArchiveError(record *LogArchive, err error) error {
+	record.Status = LogArchiveStatusError
+	record.Message = err.Error()
+	saveLogArchive(context.Background(), nil, record)
+	return err
+}
+
+func countLogArchiveRows(data []byte) (int, error) {
+	n := 0
+	err := scanLogArchivePart(data, func([]byte) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+func scanLogArchivePart(data []byte, fn func(line []byte) error) error {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	reader := bufio.NewReader(zr)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func GetLogArchives(table string, startIdx int, num int) ([]*LogArchive, int64, error) {
+	var records []*LogArchive
+	var total int64
+	tx := DB.Model(&LogArchive{})
+	if table != "" {
+		tx = tx.Where("source_table = ?", table)
+	}
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := tx.Order("day desc, id desc").Limit(num).Offset(startIdx).Find(&records).Error
+	return records, total, err
+}
+
+// getArchivedDays 返回 [startDay, endDay] 内已归档的清单，按日期升序
+func getArchivedDays(table, startDay, endDay string) ([]*LogArchive, error) {
+	start, err := time.Parse(logArchiveDayLayout, startDay)
+	if err != nil {
+		return nil, errors.New("日期格式应为 YYYY-MM-DD")
+	}
+	end, err := time.Parse(logArchiveDayLayout, endDay)
+	if err != nil {
+		return nil, errors.New("日期格式应为 YYYY-MM-DD")
+	}
+	if end.Before(start) || end.Sub(start) >= logArchiveMaxDays*24*time.Hour {
+		return nil, fmt.Errorf("日期范围无效，最多 %d 天", logArchiveMaxDays)
+	}
+	var records []*LogArchive
+	err = DB.Where("source_table = ? AND day >= ? AND day <= ? AND status IN ?", table, startDay, endDay,
+		[]string{LogArchiveStatusExported, LogArchiveStatusArchived}).Order("day asc").Find(&records).Error
+	return records, err
+}
+
+// RestoreLogArchive 把 [startDay, endDay] 的归档数据恢复到旁路表 <table>_restored，返回恢复的行数。
+// 旁路表不带索引和约束，只用于对账或排查；重复恢复同一天会先清掉旁路表中该天的旧数据。
+func RestoreLogArchive(ctx context.Context, store objstore.Store, table, startDay, endDay string) (int64, error) {
+	t, err := getLogArchiveTable(table)
+	if err != nil {
+		return 0, err
+	}
+	records, err := getArchivedDays(table, startDay, endDay)
+	if err != nil {
+		return 0, err
+	}
+	db := t.db()
+	side := table + "_restored"
+	if !db.Migrator().HasTable(side) {
+		if err := db.Exec(fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM %s WHERE 1 = 0", side, table)).Error; err != nil {
+			return 0, err
+		}
+	}
+	var restored int64
+	for _, record := range records {
+		day, _ := time.Parse(logArchiveDayLayout, record.Day)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE created_at >= ? AND created_at < ?", side),
+				day.Unix(), day.Add(24*time.Hour).Unix()).Error; err != nil {
+				return err
+			}
+			for i := 0; i < record.Parts; i++ {
+				data, err := store.Get(ctx, logArchivePartKey(record.ObjectPrefix, i))
+				if err != nil {
+					return err
+				}
+				batch := reflect.New(reflect.SliceOf(t.rowType)).Elem()
+				err = scanLogArchivePart(data, func(line []byte) error {
+					row := reflect.New(t.rowType)
+					if err := json.Unmarshal(line, row.Interface()); err != nil {
+						return err
+					}
+					batch = reflect.Append(batch, row.Elem())
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				if batch.Len() == 0 {
+					continue
+				}
+				ptr := reflect.New(batch.Type())
+				ptr.Elem().Set(batch)
+				if err := tx.Table(side).CreateInBatches(ptr.Interface(), logArchiveBatchSize).Error; err != nil {
+					return err
+				}
+				restored += int64(batch.Len())
+			}
+			return nil
+		})
+		if err != nil {
+			return restored, fmt.Errorf("%s: %w", record.Day, err)
+		}
+	}
+	return restored, nil
+}
+
+// QueryLogArchive 直接扫描归档文件，返回某用户在 [startDay, endDay] 内的记录，按 id 倒序分页。
+// 记录保持导出时的 JSON 字段，不经过旁路表。
+func QueryLogArchive(ctx context.Context, store objstore.Store, table, startDay, endDay string, userId int, startIdx, num int) ([]map[string]interface{}, int64, error) {
+	if _, err := getLogArchiveTable(table); err != nil {
+		return nil, 0, err
+	}
+	records, err := getArchivedDays(table, startDay, endDay)
+	if err != nil {
+		return nil, 0, err
+	}
+	uid := strconv.Itoa(userId)
+	var matched []map[string]interface{}
+	for _, record := range records {
+		for i := 0; i < record.Parts; i++ {
+			data, err := store.Get(ctx, logArchivePartKey(record.ObjectPrefix, i))
+			if err != nil {
+				return nil, 0, err
+			}
+			err = scanLogArchivePart(data, func(line []byte) error {
+				dec := json.NewDecoder(bytes.NewReader(line))
+				dec.UseNumber()
+				row := map[string]interface{}{}
+				if err := dec.Decode(&row); err != nil {
+					return err
+				}
+				if fmt.Sprint(row["user_id"]) == uid {
+					matched = append(matched, row)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		a, _ := matched[i]["id"].(json.Number).Int64()
+		b, _ := matched[j]["id"].(json.Number).Int64()
+		return a > b
+	})
+	total := int64(len(matched))
+	if startIdx >= len(matched) {
+		return []map[string]interface{}{}, total, nil
+	}
+	end := startIdx + num
+	if end > len(matched) {
+		end = len(matched)
+	}
+	return matched[startIdx:end], total, nil
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/objstore"
+)
+
+func TestArchiveTableBeforeExportsVerifiesAndDeletes(t *testing.T) {
+	setupTestDB(t, &Log{}, &Video{}, &Image{}, &LogArchive{})
+	origLogDB := LOG_DB
+	LOG_DB = DB
+	t.Cleanup(func() { LOG_DB = origLogDB })
+
+	day1 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	recent := day1.Add(10 * 24 * time.Hour)
+	DB.Create(&Log{UserId: 1, CreatedAt: day1.Unix() + 10, Type: LogTypeConsume, Quota: 100, Content: "a"})
+	DB.Create(&Log{UserId: 2, CreatedAt: day1.Unix() + 20, Type: LogTypeConsume, Quota: 200})
+	DB.Create(&Log{UserId: 1, CreatedAt: day2.Unix() + 30, Type: LogTypeConsume, Quota: 300})
+	DB.Create(&Log{UserId: 1, CreatedAt: recent.Unix(), Type: LogTypeConsume, Quota: 400})
+
+	store := objstore.NewLocal(t.TempDir())
+	ctx := context.Background()
+	deleted, err := ArchiveTableBefore(ctx, store, "logs", recent)
+	if err != nil || deleted != 3 {
+		t.Fatalf("应归档并删除 3 行: deleted=%d err=%v", deleted, err)
+	}
+	var remaining int64
+	DB.Model(&Log{}).Count(&remaining)
+	if remaining != 1 {
+		t.Errorf("cutoff 当天及之后的数据不应删除, 剩余 %d", remaining)
+	}
+	records, total, _ := GetLogArchives("logs", 0, 10)
+	if total != 2 || records[0].Day != "2026-01-02" || records[1].RowCount != 2 || records[1].Status != LogArchiveStatusArchived {
+		t.Fatalf("清单应按天记录: %+v", records)
+	}
+	if _, err := store.Get(ctx, records[1].ObjectPrefix+"manifest.json"); err != nil {
+		t.Errorf("存储中应有清单副本: %v", err)
+	}
+	// 已归档的日期重复执行不应再处理；没有数据的表直接跳过
+	if deleted, err = ArchiveTablesBefore(ctx, store, recent); err != nil || deleted != 0 {
+		t.Errorf("重复执行应无操作: deleted=%d err=%v", deleted, err)
+	}
+
+	rows, total, err := QueryLogArchive(ctx, store, "logs", "2026-01-01", "2026-01-02", 1, 0, 10)
+	if err != nil || total != 2 || len(rows) != 2 {
+		t.Fatalf("按用户查询归档应返回 2 条: total=%d err=%v", total, err)
+	}
+	if rows[0]["quota"].(interface{ String() string }).String() != "300" {
+		t.Errorf("应按 id 倒序返回: %+v", rows[0])
+	}
+	if _, _, err = QueryLogArchive(ctx, store, "logs", "2026-01-01", "2026-03-01", 1, 0, 10); err == nil {
+		t.Errorf("超过最大跨度应报错")
+	}
+
+	for i := 0; i < 2; i++ {
+		restored, err := RestoreLogArchive(ctx, store, "logs", "2026-01-01", "2026-01-01")
+		if err != nil || restored != 2 {
+			t.Fatalf("恢复应写入 2 行: restored=%d err=%v", restored, err)
+		}
+	}
+	var side []Log
+	DB.Table("logs_restored").Order("id asc").Find(&side)
+	if len(side) != 2 || side[0].Content != "a" || side[1].Quota != 200 {
+		t.Errorf("重复恢复同一天应覆盖而不是追加: %+v", side)
+	}
+	if _, err := RestoreLogArchive(ctx, store, "users", "2026-01-01", "2026-01-01"); err == nil || !strings.Contains(err.Error(), "不支持") {
+		t.Errorf("不支持的表应报错: %v", err)
+	}
+}
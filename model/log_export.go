@@ -0,0 +1,40 @@
+package model
+
+import (
+	"github.com/songquanpeng/one-api/common/logexport"
+)
+
+// exportLog 把写库后的 consume / error 日志投递到日志导出队列，列名与 logs 表 JSON 字段一致。
+// 不论写库是否成功都导出（失败时 id 为 0），分析侧按 x_request_id 去重
+func exportLog(log *Log) {
+	if !logexport.Enabled() {
+		return
+	}
+	logexport.Submit(logexport.Record{
+		"id":                 log.Id,
+		"request_id":         log.RequestId,
+		"created_at":         log.CreatedAt,
+		"type":               log.Type,
+		"user_id":            log.UserId,
+		"username":           log.Username,
+		"token_name":         log.TokenName,
+		"model_name":         log.ModelName,
+		"channel":            log.ChannelId,
+		"quota":              log.Quota,
+		"cost":               log.Cost,
+		"prompt_tokens":      log.PromptTokens,
+		"completion_tokens":  log.CompletionTokens,
+		"cached_tokens":      log.CachedTokens,
+		"duration":           log.Duration,
+		"first_word_latency": log.FirstWordLatency,
+		"speed":              log.Speed,
+		"is_stream":          log.IsStream,
+		"content":            log.Content,
+		"title":              log.Title,
+		"http_referer":       log.HttpReferer,
+		"x_request_id":       log.XRequestID,
+		"x_response_id":      log.XResponseID,
+		"video_task_id":      log.VideoTaskId,
+		"other":              log.Other,
+	})
+}
@@ -0,0 +1,212 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginLock 按账号统计连续登录失败。账号存在时以 user:<id> 为键，
+// 不存在时以 name:<输入的用户名> 为键，避免通过是否锁定来探测账号是否存在。
+type LoginLock struct {
+	Id             int    `json:"id"`
+	AccountKey     string `json:"account_key" gorm:"type:varchar(128);uniqueIndex"`
+	FailedCount    int    `json:"failed_count" gorm:"default:0"`
+	LockoutCount   int    `json:"lockout_count" gorm:"default:0"` // 已触发锁定的次数，决定下次锁定时长
+	LockedUntil    int64  `json:"locked_until" gorm:"bigint;default:0"`
+	LastFailedTime int64  `json:"last_failed_time" gorm:"bigint;default:0"`
+}
+
+// LoginHistory 登录记录，成功与失败都会写入
+type LoginHistory struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	Username    string `json:"username" gorm:"type:varchar(128)"`
+	Ip          string `json:"ip" gorm:"type:varchar(64)"`
+	UserAgent   string `json:"user_agent" gorm:"type:varchar(512)"`
+	Success     bool   `json:"success"`
+	Reason      string `json:"reason" gorm:"type:varchar(64)"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint;index"`
+}
+
+const (
+	LoginFailReasonBadCredentials = "bad_credentials"
+	LoginFailReasonLocked         = "locked"
+)
+
+// 超过这个时间没有新的失败，计数从头开始
+const loginFailureDecaySeconds = 24 * 3600
+
+// ResolveLoginAccount 按用户名或邮箱找到账号，返回锁定统计用的键
+func ResolveLoginAccount(identifier string) (string, *User) {
+	user := &User{}
+	err := DB.Select("id", "username", "email", "display_name").Where("username = ?", identifier).First(user).Error
+	if err != nil {
+		err = DB.Select("id", "username", "email", "display_name").Where("email = ?", identifier).First(user).Error
+	}
+	if err != nil {
+		return "name:" + strings.ToLower(identifier), nil
+	}
+	return fmt.Sprintf("user:%d", user.Id), user
+}
+
+func getLoginLock(accountKey string) *LoginLock {
+	lock := &LoginLock{}
+	if err := DB.Where("account_key = ?", accountKey).First(lock).Error; err != nil {
+		return nil
+	}
+	if helper.GetTimestamp()-lock.LastFailedTime > loginFailureDecaySeconds && lock.LockedUntil < helper.GetTimestamp() {
+		return nil
+	}
+	return lock
+}
+
+// GetLoginLockRemaining 返回账号剩余锁定秒数，0 表示未锁定
+func GetLoginLockRemaining(accountKey string) int64 {
+	lock := getLoginLock(accountKey)
+	if lock == nil {
+		return 0
+	}
+	remaining := lock.LockedUntil - helper.GetTimestamp()
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// LoginRequiresTurnstile 失败次数达到阈值或曾被锁定的账号需要先通过 Turnstile
+func LoginRequiresTurnstile(accountKey string) bool {
+	lock := getLoginLock(accountKey)
+	if lock == nil {
+		return false
+	}
+	return lock.LockoutCount > 0 || lock.FailedCount >= config.LoginTurnstileThreshold
+}
+
+func loginLockoutSeconds(lockoutCount int) int64 {
+	seconds := int64(config.LoginLockoutBaseSeconds)
+	for i := 1; i < lockoutCount && seconds < int64(config.LoginLockoutMaxSeconds); i++ {
+		seconds *= 2
+	}
+	if seconds > int64(config.LoginLockoutMaxSeconds) {
+		seconds = int64(config.LoginLockoutMaxSeconds)
+	}
+	return seconds
+}
+
+// RecordLoginFailure 记一次失败，达到阈值时锁定并返回锁定截止时间。
+// 计数用条件 UPDATE 原子累加，并发的失败请求不会互相覆盖；同一轮只有把计数清零的那次调用负责锁定。
+func RecordLoginFailure(accountKey string) (lockedUntil int64, err error) {
+	now := helper.GetTimestamp()
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&LoginLock{AccountKey: accountKey}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&LoginLock{}).
+			Where("account_key = ? AND last_failed_time < ? AND locked_until < ?", accountKey, now-loginFailureDecaySeconds, now).
+			Updates(map[string]interface{}{"failed_count": 0, "lockout_count": 0}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&LoginLock{}).Where("account_key = ?", accountKey).
+			Updates(map[string]interface{}{"failed_count": gorm.Expr("failed_count + 1"), "last_failed_time": now}).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&LoginLock{}).
+			Where("account_key = ? AND failed_count >= ?", accountKey, config.LoginLockoutThreshold).
+			Updates(map[string]interface{}{"failed_count": 0, "lockout_count": gorm.Expr("lockout_count + 1")})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		lock := &LoginLock{}
+		if err := tx.Where("account_key = ?", accountKey).First(lock).Error; err != nil {
+			return err
+		}
+		lockedUntil = now + loginLockoutSeconds(lock.LockoutCount)
+		return tx.Model(lock).Update("locked_until", lockedUntil).Error
+	})
+	return lockedUntil, err
+}
+
+// ResetLoginLock 登录成功后清空失败统计
+func ResetLoginLock(accountKey string) {
+	if err := DB.Where("account_key = ?", accountKey).Delete(&LoginLock{}).Error; err != nil {
+		logger.SysError("failed to reset login lock: " + err.Error())
+	}
+}
+
+// UnlockUserLogin 管理员解除账号锁定
+func UnlockUserLogin(userId int) error {
+	user, err := GetUserById(userId, false)
+	if err != nil {
+		return err
+	}
+	accountKey := fmt.Sprintf("user:%d", userId)
+	if getLoginLock(accountKey) == nil {
+		return errors.New("the account is not locked")
+	}
+	ResetLoginLock(accountKey)
+	go notifyLoginLockChange(user, "账号已解除锁定", "管理员已解除你的账号登录锁定，现在可以重新登录。")
+	return nil
+}
+
+// NotifyLoginLockout 锁定时通知账号本人和管理员
+func NotifyLoginLockout(user *User, ip string, lockedUntil int64) {
+	if user == nil {
+		return
+	}
+	content := fmt.Sprintf("你的账号 %s 因多次登录失败已被锁定至 %s，最近一次尝试来自 %s。如非本人操作，请尽快修改密码。",
+		user.Username, time.Unix(lockedUntil, 0).Format("2006-01-02 15:04:05"), ip)
+	go notifyLoginLockChange(user, "账号登录已锁定", content)
+}
+
+func notifyLoginLockChange(user *User, subject string, content string) {
+	if user.Email != "" {
+		if err := message.SendEmail(subject, user.Email, content); err != nil {
+			logger.SysError(fmt.Sprintf("failed to send login lock email to user %d: %s", user.Id, err.Error()))
+		}
+	}
+	if err := message.Notify(message.ByEmail, subject, "", fmt.Sprintf("用户 %s (id=%d)：%s", user.Username, user.Id, content)); err != nil {
+		logger.SysError("failed to notify admin of login lock change: " + err.Error())
+	}
+}
+
+func RecordLoginHistory(userId int, username string, ip string, userAgent string, success bool, reason string) {
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	if len(username) > 128 {
+		username = username[:128]
+	}
+	history := &LoginHistory{
+		UserId:      userId,
+		Username:    username,
+		Ip:          ip,
+		UserAgent:   userAgent,
+		Success:     success,
+		Reason:      reason,
+		CreatedTime: helper.GetTimestamp(),
+	}
+	if err := DB.Create(history).Error; err != nil {
+		logger.SysError("failed to record login history: " + err.Error())
+	}
+}
+
+func GetUserLoginHistory(userId int, page int, pageSize int) (histories []*LoginHistory, total int64, err error) {
+	if err = DB.Model(&LoginHistory{}).Where("user_id = ?", userId).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = DB.Where("user_id = ?", userId).Order("id desc").Limit(pageSize).Offset((page - 1) * pageSize).Find(&histories).Error
+	return histories, total, err
+}
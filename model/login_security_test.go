@@ -0,0 +1,44 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestLoginLockoutBackoff(t *testing.T) {
+	setupTestDB(t, &LoginLock{}, &LoginHistory{})
+	threshold, turnstile, base := config.LoginLockoutThreshold, config.LoginTurnstileThreshold, config.LoginLockoutBaseSeconds
+	config.LoginLockoutThreshold, config.LoginTurnstileThreshold, config.LoginLockoutBaseSeconds = 3, 2, 60
+	t.Cleanup(func() {
+		config.LoginLockoutThreshold, config.LoginTurnstileThreshold, config.LoginLockoutBaseSeconds = threshold, turnstile, base
+	})
+
+	key, user := ResolveLoginAccount("nobody")
+	if user != nil || key != "name:nobody" {
+		t.Fatalf("不存在的账号应按输入名统计，实际 %s", key)
+	}
+	for i := 0; i < 2; i++ {
+		if until, err := RecordLoginFailure(key); err != nil || until != 0 {
+			t.Fatalf("第 %d 次失败不应锁定: until=%d err=%v", i+1, until, err)
+		}
+	}
+	if !LoginRequiresTurnstile(key) {
+		t.Error("失败 2 次后应要求 Turnstile")
+	}
+	until, err := RecordLoginFailure(key)
+	if err != nil || until == 0 {
+		t.Fatalf("第 3 次失败应锁定: %v", err)
+	}
+	if remaining := GetLoginLockRemaining(key); remaining <= 0 || remaining > 60 {
+		t.Errorf("首次锁定应为 60 秒，剩余 %d", remaining)
+	}
+	if got := loginLockoutSeconds(3); got != 240 {
+		t.Errorf("第三次锁定应为 240 秒，实际 %d", got)
+	}
+
+	ResetLoginLock(key)
+	if GetLoginLockRemaining(key) != 0 || LoginRequiresTurnstile(key) {
+		t.Error("重置后不应再锁定")
+	}
+}
@@ -185,6 +185,33 @@ func InitDB(envName string) (db *gorm.DB, err error) {
 		if err != nil {
 			return nil, err
 		}
+		err = db.AutoMigrate(&UsageRollup{}, &UsageRollupCursor{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&LogTag{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&TokenSource{}, &TokenAnomaly{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&StatusIncident{}, &StatusIncidentUpdate{}, &ModelUptimeDaily{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&Organization{}, &OrganizationMember{}, &OrganizationUsage{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&ManagementToken{}, &UserSession{}, &LoginLock{}, &LoginHistory{}, &PriceBookVersion{}, &PricingPlan{}, &PricingPlanUsage{},
+			&CreditAccount{}, &Invoice{}, &InvoiceItem{}, &SubscriptionPlan{}, &UserSubscription{}, &StripeWebhookEvent{},
+			&AutoTopUpSetting{}, &RedemptionCampaign{}, &RedemptionLog{}, &ModelCredit{},
+			&AffiliateCommission{}, &AffiliateAccount{}, &ChannelCost{}, &Reconciliation{}, &LogArchive{})
+		if err != nil {
+			return nil, err
+		}
 		logger.SysLog("database migrated")
 		if err := InitGroupConfigs(db); err != nil {
 			logger.SysError("failed to init group configs: " + err.Error())
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB 建内存库并临时替换全局 DB。用户、令牌表总是建好，其余表由 models 指定
+func setupTestDB(t *testing.T, models ...interface{}) {
+	t.Helper()
+	db, err := gorm.Open(
+		sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"),
+		&gorm.Config{Logger: logger.Discard},
+	)
+	if err != nil {
+		t.Skipf("SQLite 不可用（可能未启用 CGO），跳过: %v", err)
+	}
+	if err := db.AutoMigrate(append([]interface{}{&User{}, &Token{}}, models...)...); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	orig := DB
+	DB = db
+	t.Cleanup(func() {
+		DB = orig
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// ManagementTokenPrefix 管理令牌前缀，用于与 User.AccessToken 区分
+const ManagementTokenPrefix = "mt-"
+
+const (
+	ManagementTokenStatusEnabled = 1
+	ManagementTokenStatusRevoked = 2
+)
+
+// ManagementTokenScopeAll 拥有所属用户的全部权限
+const ManagementTokenScopeAll = "*"
+
+// 作用域格式为 <资源>:<read|write>，资源即 /api/ 之后的第一段路径，如 log:read、channel:write、user:write。
+// write 隐含 read。
+var managementScopePattern = regexp.MustCompile(`^[a-z][a-z_-]*:(read|write)$`)
+
+// ManagementToken 用户名下可有多个，供 CI 等自动化调用管理接口。库中只保存哈希。
+type ManagementToken struct {
+	Id           int    `json:"id"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	Name         string `json:"name" gorm:"type:varchar(64)"`
+	TokenHash    string `json:"-" gorm:"type:char(64);uniqueIndex"`
+	TokenPrefix  string `json:"token_prefix" gorm:"type:varchar(16)"` // 明文前若干位，便于在列表中辨认
+	Scopes       string `json:"scopes" gorm:"type:varchar(1024)"`     // 逗号分隔
+	Status       int    `json:"status" gorm:"default:1"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	ExpiredTime  int64  `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
+	LastUsedTime int64  `json:"last_used_time" gorm:"bigint;default:0"`
+	LastUsedIp   string `json:"last_used_ip" gorm:"type:varchar(64)"`
+}
+
+func IsManagementToken(token string) bool {
+	return strings.HasPrefix(token, ManagementTokenPrefix)
+}
+
+func hashManagementToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeManagementTokenScopes 校验并去重作用域
+func NormalizeManagementTokenScopes(scopes []string) (string, error) {
+	seen := make(map[string]bool)
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope == "" || seen[scope] {
+			continue
+		}
+		if scope != ManagementTokenScopeAll && !managementScopePattern.MatchString(scope) {
+			return "", errors.New("invalid scope: " + scope)
+		}
+		seen[scope] = true
+		normalized = append(normalized, scope)
+	}
+	if len(normalized) == 0 {
+		return "", errors.New("at least one scope is required")
+	}
+	return strings.Join(normalized, ","), nil
+}
+
+// CreateManagementToken 创建管理令牌并返回明文，明文只在此时可见
+func CreateManagementToken(userId int, name string, scopes []string, expiredTime int64) (*ManagementToken, string, error) {
+	if name == "" || len(name) > 64 {
+		return nil, "", errors.New("name must be 1-64 characters")
+	}
+	normalized, err := NormalizeManagementTokenScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if expiredTime == 0 {
+		expiredTime = -1
+	}
+	if expiredTime != -1 && expiredTime <= helper.GetTimestamp() {
+		return nil, "", errors.New("expired_time must be in the future")
+	}
+	plain := ManagementTokenPrefix + helper.GetUUID()
+	token := &ManagementToken{
+		UserId:      userId,
+		Name:        name,
+		TokenHash:   hashManagementToken(plain),
+		TokenPrefix: plain[:len(ManagementTokenPrefix)+6],
+		Scopes:      normalized,
+		Status:      ManagementTokenStatusEnabled,
+		CreatedTime: helper.GetTimestamp(),
+		ExpiredTime: expiredTime,
+	}
+	if err := DB.Create(token).Error; err != nil {
+		return nil, "", err
+	}
+	return token, plain, nil
+}
+
+func GetUserManagementTokens(userId int) ([]*ManagementToken, error) {
+	var tokens []*ManagementToken
+	err := DB.Where("user_id = ?", userId).Order("id desc").Find(&tokens).Error
+	return tokens, err
+}
+
+// RevokeManagementToken 吊销令牌，保留记录用于审计
+func RevokeManagementToken(id int, userId int) error {
+	result := DB.Model(&ManagementToken{}).Where("id = ? AND user_id = ?", id, userId).
+		Update("status", ManagementTokenStatusRevoked)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("management token not found")
+	}
+	return nil
+}
+
+// ValidateManagementToken 校验明文令牌，返回令牌记录与所属用户
+func ValidateManagementToken(plain string) (*ManagementToken, *User, error) {
+	plain = strings.TrimPrefix(plain, "Bearer ")
+	token := &ManagementToken{}
+	if err := DB.Where("token_hash = ?", hashManagementToken(plain)).First(token).Error; err != nil {
+		return nil, nil, errors.New("management token is invalid")
+	}
+	if token.Status != ManagementTokenStatusEnabled {
+		return nil, nil, errors.New("management token has been revoked")
+	}
+	if token.ExpiredTime != -1 && token.ExpiredTime < helper.GetTimestamp() {
+		return nil, nil, errors.New("management token has expired")
+	}
+	user := &User{}
+	if err := DB.Where("id = ?", token.UserId).First(user).Error; err != nil {
+		return nil, nil, errors.New("management token owner not found")
+	}
+	return token, user, nil
+}
+
+// TouchManagementToken 更新最近使用信息，一分钟内重复调用不落库
+func TouchManagementToken(token *ManagementToken, ip string) {
+	now := helper.GetTimestamp()
+	if now-token.LastUsedTime < int64(time.Minute/time.Second) && token.LastUsedIp == ip {
+		return
+	}
+	err := DB.Model(&ManagementToken{}).Where("id = ?", token.Id).
+		UpdateColumns(map[string]interface{}{"last_used_time": now, "last_used_ip": ip}).Error
+	if err != nil {
+		logger.SysError("failed to update management token last used time: " + err.Error())
+	}
+}
+
+// Allows 判断令牌是否可访问某资源；write 作用域同时允许读
+func (token *ManagementToken) Allows(resource string, write bool) bool {
+	for _, scope := range strings.Split(token.Scopes, ",") {
+		if scope == ManagementTokenScopeAll {
+			return true
+		}
+		res, level, ok := strings.Cut(scope, ":")
+		if !ok || res != resource {
+			continue
+		}
+		if level == "write" || !write {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+func TestManagementTokenScopes(t *testing.T) {
+	setupTestDB(t, &ManagementToken{})
+	user := &User{Id: 1, Username: "ci", AccessToken: "a", AffCode: "a"}
+	if err := DB.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+
+	if _, _, err := CreateManagementToken(user.Id, "bad", []string{"channel:delete"}, -1); err == nil {
+		t.Error("非法作用域应被拒绝")
+	}
+	mt, plain, err := CreateManagementToken(user.Id, "ci", []string{"channel:write", "log:read"}, helper.GetTimestamp()+3600)
+	if err != nil {
+		t.Fatalf("创建失败: %v", err)
+	}
+	validated, owner, err := ValidateManagementToken("Bearer " + plain)
+	if err != nil || owner.Id != user.Id {
+		t.Fatalf("校验失败: %v", err)
+	}
+	cases := []struct {
+		resource string
+		write    bool
+		want     bool
+	}{
+		{"channel", true, true},
+		{"channel", false, true},
+		{"log", false, true},
+		{"log", true, false},
+		{"user", false, false},
+	}
+	for _, tc := range cases {
+		if got := validated.Allows(tc.resource, tc.write); got != tc.want {
+			t.Errorf("Allows(%s, %v) = %v，期望 %v", tc.resource, tc.write, got, tc.want)
+		}
+	}
+
+	if err := RevokeManagementToken(mt.Id, user.Id); err != nil {
+		t.Fatalf("吊销失败: %v", err)
+	}
+	if _, _, err := ValidateManagementToken(plain); err == nil {
+		t.Error("吊销后不应通过校验")
+	}
+}
@@ -62,6 +62,7 @@ func InitOptionMap() {
 	config.OptionMap["RetryKeywords"] = config.RetryKeywords
 	config.OptionMap["ApproximateTokenEnabled"] = strconv.FormatBool(config.ApproximateTokenEnabled)
 	config.OptionMap["LogConsumeEnabled"] = strconv.FormatBool(config.LogConsumeEnabled)
+	config.OptionMap["MarginAlertEnabled"] = strconv.FormatBool(config.MarginAlertEnabled)
 	config.OptionMap["DisplayInCurrencyEnabled"] = strconv.FormatBool(config.DisplayInCurrencyEnabled)
 	config.OptionMap["DisplayTokenStatEnabled"] = strconv.FormatBool(config.DisplayTokenStatEnabled)
 	config.OptionMap["ChannelDisableThreshold"] = strconv.FormatFloat(config.ChannelDisableThreshold, 'f', -1, 64)
@@ -95,6 +96,10 @@ func InitOptionMap() {
 	config.OptionMap["QuotaForNewUser"] = strconv.FormatInt(config.QuotaForNewUser, 10)
 	config.OptionMap["QuotaForInviter"] = strconv.FormatInt(config.QuotaForInviter, 10)
 	config.OptionMap["QuotaForInvitee"] = strconv.FormatInt(config.QuotaForInvitee, 10)
+	config.OptionMap["AffiliateCommissionPercent"] = strconv.FormatFloat(config.AffiliateCommissionPercent, 'f', -1, 64)
+	config.OptionMap["AffiliateCommissionMonths"] = strconv.Itoa(config.AffiliateCommissionMonths)
+	config.OptionMap["AffiliateCommissionCap"] = strconv.FormatInt(config.AffiliateCommissionCap, 10)
+	config.OptionMap["AffiliateHoldDays"] = strconv.Itoa(config.AffiliateHoldDays)
 	config.OptionMap["QuotaRemindThreshold"] = strconv.FormatInt(config.QuotaRemindThreshold, 10)
 	config.OptionMap["PreConsumedQuota"] = strconv.FormatInt(config.PreConsumedQuota, 10)
 	config.OptionMap["ModelRatio"] = common.ModelRatio2JSONString()
@@ -161,6 +166,11 @@ func InitOptionMap() {
 
 	// 审计模块配置
 	config.OptionMap["AuditEnabled"] = strconv.FormatBool(config.AuditEnabled)
+	config.OptionMap["AuditBackend"] = config.AuditBackend
+	config.OptionMap["AuditStorageDir"] = config.AuditStorageDir
+	config.OptionMap["AuditStorageBucket"] = config.AuditStorageBucket
+	config.OptionMap["AuditStorageEndpoint"] = config.AuditStorageEndpoint
+	config.OptionMap["AuditStoragePrefix"] = config.AuditStoragePrefix
 	config.OptionMap["AuditAWSRegion"] = config.AuditAWSRegion
 	config.OptionMap["AuditAWSAccessKey"] = ""
 	config.OptionMap["AuditAWSSecretKey"] = ""
@@ -182,6 +192,7 @@ func InitOptionMap() {
 	config.OptionMap["AuditMaxRespKB"] = strconv.Itoa(config.AuditMaxRespKB)
 	config.OptionMap["AuditRetentionDays"] = strconv.Itoa(config.AuditRetentionDays)
 	config.OptionMap["AuditRedactHeaders"] = config.AuditRedactHeaders
+	config.OptionMap["AuditRedactBodyRules"] = config.AuditRedactBodyRules
 	config.OptionMapRWMutex.Unlock()
 	loadOptionsFromDatabase()
 }
@@ -299,6 +310,8 @@ func updateOptionMap(key string, value string) (err error) {
 			config.ApproximateTokenEnabled = boolValue
 		case "LogConsumeEnabled":
 			config.LogConsumeEnabled = boolValue
+		case "MarginAlertEnabled":
+			config.MarginAlertEnabled = boolValue
 		case "DisplayInCurrencyEnabled":
 			config.DisplayInCurrencyEnabled = boolValue
 		case "DisplayTokenStatEnabled":
@@ -384,6 +397,14 @@ func updateOptionMap(key string, value string) (err error) {
 		config.QuotaForInviter, _ = strconv.ParseInt(value, 10, 64)
 	case "QuotaForInvitee":
 		config.QuotaForInvitee, _ = strconv.ParseInt(value, 10, 64)
+	case "AffiliateCommissionPercent":
+		config.AffiliateCommissionPercent, _ = strconv.ParseFloat(value, 64)
+	case "AffiliateCommissionMonths":
+		config.AffiliateCommissionMonths, _ = strconv.Atoi(value)
+	case "AffiliateCommissionCap":
+		config.AffiliateCommissionCap, _ = strconv.ParseInt(value, 10, 64)
+	case "AffiliateHoldDays":
+		config.AffiliateHoldDays, _ = strconv.Atoi(value)
 	case "QuotaRemindThreshold":
 		config.QuotaRemindThreshold, _ = strconv.ParseInt(value, 10, 64)
 	case "PreConsumedQuota":
@@ -571,6 +592,16 @@ func updateOptionMap(key string, value string) (err error) {
 			common.ChannelAffinityConfig = cfg
 		}
 	// 审计模块配置
+	case "AuditBackend":
+		config.AuditBackend = value
+	case "AuditStorageDir":
+		config.AuditStorageDir = value
+	case "AuditStorageBucket":
+		config.AuditStorageBucket = value
+	case "AuditStorageEndpoint":
+		config.AuditStorageEndpoint = value
+	case "AuditStoragePrefix":
+		config.AuditStoragePrefix = value
 	case "AuditAWSRegion":
 		config.AuditAWSRegion = value
 	case "AuditAWSAccessKey":
@@ -611,6 +642,8 @@ func updateOptionMap(key string, value string) (err error) {
 		config.AuditRetentionDays, _ = strconv.Atoi(value)
 	case "AuditRedactHeaders":
 		config.AuditRedactHeaders = value
+	case "AuditRedactBodyRules":
+		config.AuditRedactBodyRules = value
 	case "auditConfig":
 		go audit.Reload()
 	}
@@ -3,13 +3,16 @@ package model
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"sync"
 
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/message"
+	"github.com/songquanpeng/one-api/common/payment"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Order struct {
@@ -32,92 +35,78 @@ type Order struct {
 
 var lock sync.Mutex
 
-func CreateOrUpdateOrder(response CryptCallbackResponse, username string) error {
-	lock.Lock()
-	defer lock.Unlock()
-	status := CryptResponseResult[response.Result]
-	//userId,err:=Decrypt(response.UserId)
-	//先查询订单
-	var order Order
-	if err := DB.Where("uuid = ?", response.Uuid).First(&order).Error; err != nil {
-		//如果没有订单
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			//支付成功
-			if status == 3 {
-				var addAmount float64
-				if err := DB.Transaction(func(tx *gorm.DB) error {
-					// 创建一笔订单
-					if err = DB.Create(&Order{
-						UserId:             response.UserId,
-						Username:           username,
-						Type:               "Crypto",
-						Uuid:               response.Uuid,
-						Status:             status,
-						Ticker:             response.Coin,
-						AddressOut:         response.AddressOut,
-						AddressIn:          response.AddressIn,
-						FeeCoin:            response.FeeCoin,
-						ValueCoin:          response.ValueCoin,
-						ValueForwardedCoin: response.ValueForwardedCoin,
-						CreatedTime:        helper.GetTimestamp(),
-						UpdatedTime:        helper.GetTimestamp(),
-					}).Error; err != nil {
-						return err
-					}
-
-					if err = DB.Create(&Bill{
-						Username:  username,
-						UserId:    response.UserId,
-						Type:      "Crypto",
-						CreatedAt: helper.GetTimestamp(),
-						Amount:    response.ValueCoin,
-						SourceId:  response.Uuid,
-						Status:    status,
-					}).Error; err != nil {
-						return err
-					}
-
-					//更新余额 待定手续费和用户组别的变更
-					addAmount := response.ValueForwardedCoin
-					err = IncreaseUserQuota(response.UserId, int64(addAmount*500000))
-					if err != nil {
-						return err
-					}
-					// 返回 nil 提交事务
-					return nil
-				}); err != nil {
-					return err
-				}
-
-				//crypt支付成功处理一下其它
-				AfterChargeSuccess(response.UserId, addAmount)
-			}
-
-		} else {
-			return err
-		}
+// cryptOrderStatus CryptAPI 回调的 result 对应的 orders / bills 状态，数值只增不减
+var cryptOrderStatus = map[string]int{
+	"pending":  1,
+	"received": 2,
+	"sent":     3,
+	"done":     4,
+}
 
-	} else {
-		if order.Status < status {
-			err = UpdateOrder(order.Uuid, Order{
-				Status:      status,
-				UpdatedTime: helper.GetTimestamp(),
-			})
-			if err != nil {
-				return err
+// recordCryptoOrder 加密货币回调同步写入 orders / bills，账单接口仍从这两张表读取。
+// 转发完成（sent）时建单，之后的回调只推进状态；入账由 TopUp 状态机负责
+func recordCryptoOrder(result *payment.CallbackResult) error {
+	query := result.Raw
+	uuid := query.Get("uuid")
+	status := cryptOrderStatus[query.Get("result")]
+	if uuid == "" || status == 0 {
+		return nil
+	}
+	now := helper.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var order Order
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("uuid = ?", uuid).First(&order).Error
+		if err == nil {
+			if order.Status >= status {
+				return nil
 			}
-			err = UpdateBill(order.Uuid, Bill{
-				Status:    status,
-				UpdatedAt: helper.GetTimestamp(),
-			})
-			if err != nil {
+			if err := tx.Model(&Order{}).Where("uuid = ? AND status < ?", uuid, status).
+				Updates(Order{Status: status, UpdatedTime: now}).Error; err != nil {
 				return err
 			}
+			return tx.Model(&Bill{}).Where("source_id = ?", uuid).Updates(Bill{Status: status, UpdatedAt: now}).Error
 		}
-	}
-	return nil
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if status < cryptOrderStatus["sent"] {
+			return nil
+		}
+		username := GetUsernameById(result.UserId)
+		feeCoin, _ := strconv.ParseFloat(query.Get("fee_coin"), 64)
+		valueCoin, _ := strconv.ParseFloat(query.Get("value_coin"), 64)
+		valueForwardedCoin, _ := strconv.ParseFloat(query.Get("value_forwarded_coin"), 64)
+		if err := tx.Create(&Order{
+			UserId:             result.UserId,
+			Username:           username,
+			Type:               "Crypto",
+			Uuid:               uuid,
+			Status:             status,
+			Ticker:             query.Get("coin"),
+			AddressOut:         query.Get("address_out"),
+			AddressIn:          query.Get("address_in"),
+			FeeCoin:            feeCoin,
+			ValueCoin:          valueCoin,
+			ValueForwardedCoin: valueForwardedCoin,
+			CreatedTime:        now,
+			UpdatedTime:        now,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&Bill{
+			Username:  username,
+			UserId:    result.UserId,
+			Type:      "Crypto",
+			CreatedAt: now,
+			UpdatedAt: now,
+			Amount:    valueCoin,
+			SourceId:  uuid,
+			Status:    status,
+		}).Error
+	})
 }
 
+// AfterChargeSuccess 到账邮件，加密货币与 Stripe Payment Link 充值成功后发送
 func AfterChargeSuccess(userId int, addAmount float64) {
 
 	//send email and back message
@@ -0,0 +1,503 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	OrgStatusEnabled  = 1
+	OrgStatusDisabled = 2
+)
+
+// 组织成员角色，数值越大权限越高
+const (
+	OrgRoleMember = 1
+	OrgRoleAdmin  = 10
+	OrgRoleOwner  = 100
+)
+
+var OrgId2QuotaCacheSeconds = config.SyncFrequency
+var OrgId2StatusCacheSeconds = config.SyncFrequency
+
+// Organization 组织（团队），拥有独立的额度池，组织令牌消费时从此扣费
+type Organization struct {
+	Id           int    `json:"id"`
+	Name         string `json:"name" gorm:"type:varchar(64);index"`
+	OwnerId      int    `json:"owner_id" gorm:"index"`
+	Status       int    `json:"status" gorm:"type:int;default:1"`
+	Quota        int64  `json:"quota" gorm:"bigint;default:0"`
+	UsedQuota    int64  `json:"used_quota" gorm:"bigint;default:0"`
+	RequestCount int    `json:"request_count" gorm:"type:int;default:0"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+}
+
+// OrganizationMember 组织成员关系，同一用户在同一组织只能有一条记录
+type OrganizationMember struct {
+	Id          int   `json:"id"`
+	OrgId       int   `json:"org_id" gorm:"uniqueIndex:idx_org_member"`
+	UserId      int   `json:"user_id" gorm:"uniqueIndex:idx_org_member;index"`
+	Role        int   `json:"role" gorm:"type:int;default:1"`
+	CreatedTime int64 `json:"created_time" gorm:"bigint"`
+	// 以下字段仅用于接口展示，不落库
+	Username    string `json:"username" gorm:"-:all"`
+	DisplayName string `json:"display_name" gorm:"-:all"`
+}
+
+// OrganizationUsage 组织按 成员 × 模型 × 天 的消费汇总，用于看板的成员维度拆分。
+// logs 表不做自动迁移（见 main.go 的说明），因此组织归属不加列，改由本表承载。
+type OrganizationUsage struct {
+	Id           int    `json:"id"`
+	OrgId        int    `json:"org_id" gorm:"uniqueIndex:idx_org_usage_key,priority:1"`
+	Day          string `json:"day" gorm:"type:varchar(10);uniqueIndex:idx_org_usage_key,priority:2"`
+	UserId       int    `json:"user_id" gorm:"uniqueIndex:idx_org_usage_key,priority:3"`
+	ModelName    string `json:"model_name" gorm:"type:varchar(128);uniqueIndex:idx_org_usage_key,priority:4"`
+	Quota        int64  `json:"quota" gorm:"bigint;default:0"`
+	RequestCount int    `json:"request_count" gorm:"type:int;default:0"`
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	org := Organization{}
+	err := DB.First(&org, "id = ?", id).Error
+	return &org, err
+}
+
+func GetAllOrganizationsAndCount(keyword string, page int, pageSize int) (orgs []*Organization, total int64, err error) {
+	tx := DB.Model(&Organization{})
+	if keyword != "" {
+		tx = tx.Where("name LIKE ?", "%"+keyword+"%")
+	}
+	err = tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * pageSize
+	err = tx.Order("id desc").Limit(pageSize).Offset(offset).Find(&orgs).Error
+	return orgs, total, err
+}
+
+// GetUserOrganizations 返回用户所属的全部组织，附带该用户在组织内的角色
+func GetUserOrganizations(userId int) ([]map[string]interface{}, error) {
+	var members []OrganizationMember
+	if err := DB.Where("user_id = ?", userId).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	result := make([]map[string]interface{}, 0, len(members))
+	for _, m := range members {
+		org, err := GetOrganizationById(m.OrgId)
+		if err != nil {
+			continue
+		}
+		result = append(result, map[string]interface{}{
+			"organization": org,
+			"role":         m.Role,
+		})
+	}
+	return result, nil
+}
+
+// CreateOrganization 创建组织，并把创建者登记为 owner
+func CreateOrganization(name string, ownerId int) (*Organization, error) {
+	if name == "" {
+		return nil, errors.New("组织名称不能为空")
+	}
+	if ownerId == 0 {
+		return nil, errors.New("无效的 user id")
+	}
+	now := helper.GetTimestamp()
+	org := &Organization{
+		Name:        name,
+		OwnerId:     ownerId,
+		Status:      OrgStatusEnabled,
+		CreatedTime: now,
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{
+			OrgId:       org.Id,
+			UserId:      ownerId,
+			Role:        OrgRoleOwner,
+			CreatedTime: now,
+		}).Error
+	})
+	return org, err
+}
+
+func (org *Organization) Update() error {
+	err := DB.Model(org).Select("name", "status").Updates(org).Error
+	if err == nil {
+		invalidateOrganizationEnabledCache(org.Id)
+	}
+	return err
+}
+
+// DeleteOrganization 删除组织及其成员关系；组织令牌一并禁用，避免继续从已删除的额度池扣费
+func DeleteOrganization(id int) error {
+	if id == 0 {
+		return errors.New("id 为空！")
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("org_id = ?", id).Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Token{}).Where("org_id = ?", id).Update("status", common.TokenStatusDisabled).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&Organization{}, id).Error; err != nil {
+			return err
+		}
+		invalidateOrganizationEnabledCache(id)
+		return nil
+	})
+}
+
+func GetOrganizationMember(orgId int, userId int) (*OrganizationMember, error) {
+	member := OrganizationMember{}
+	err := DB.Where("org_id = ? AND user_id = ?", orgId, userId).First(&member).Error
+	return &member, err
+}
+
+// GetOrganizationMemberRole 返回用户在组织内的角色，非成员返回 0
+func GetOrganizationMemberRole(orgId int, userId int) int {
+	if orgId == 0 || userId == 0 {
+		return 0
+	}
+	member, err := GetOrganizationMember(orgId, userId)
+	if err != nil {
+		return 0
+	}
+	return member.Role
+}
+
+func GetOrganizationMembers(orgId int) ([]*OrganizationMember, error) {
+	var members []*OrganizationMember
+	err := DB.Where("org_id = ?", orgId).Order("role desc, id asc").Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		var user User
+		if DB.Select("username", "display_name").Where("id = ?", m.UserId).Find(&user).RowsAffected == 1 {
+			m.Username = user.Username
+			m.DisplayName = user.DisplayName
+		}
+	}
+	return members, nil
+}
+
+func AddOrganizationMember(orgId int, userId int, role int) error {
+	if !isValidOrgRole(role) || role == OrgRoleOwner {
+		return errors.New("无效的成员角色")
+	}
+	if _, err := GetOrganizationMember(orgId, userId); err == nil {
+		return errors.New("该用户已是组织成员")
+	}
+	err := DB.Create(&OrganizationMember{
+		OrgId:       orgId,
+		UserId:      userId,
+		Role:        role,
+		CreatedTime: helper.GetTimestamp(),
+	}).Error
+	if err == nil {
+		invalidateOrganizationMemberRoleCache(orgId, userId)
+	}
+	return err
+}
+
+func UpdateOrganizationMemberRole(orgId int, userId int, role int) error {
+	if !isValidOrgRole(role) || role == OrgRoleOwner {
+		return errors.New("无效的成员角色")
+	}
+	member, err := GetOrganizationMember(orgId, userId)
+	if err != nil {
+		return errors.New("该用户不是组织成员")
+	}
+	if member.Role == OrgRoleOwner {
+		return errors.New("不能修改组织所有者的角色")
+	}
+	err = DB.Model(member).Update("role", role).Error
+	if err == nil {
+		invalidateOrganizationMemberRoleCache(orgId, userId)
+	}
+	return err
+}
+
+// RemoveOrganizationMember 移除成员，同时禁用该成员在组织下创建的令牌
+func RemoveOrganizationMember(orgId int, userId int) error {
+	member, err := GetOrganizationMember(orgId, userId)
+	if err != nil {
+		return errors.New("该用户不是组织成员")
+	}
+	if member.Role == OrgRoleOwner {
+		return errors.New("不能移除组织所有者")
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Token{}).Where("org_id = ? AND user_id = ?", orgId, userId).
+			Update("status", common.TokenStatusDisabled).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(member).Error; err != nil {
+			return err
+		}
+		invalidateOrganizationMemberRoleCache(orgId, userId)
+		return nil
+	})
+}
+
+func isValidOrgRole(role int) bool {
+	return role == OrgRoleMember || role == OrgRoleAdmin || role == OrgRoleOwner
+}
+
+func GetOrgQuota(id int) (quota int64, err error) {
+	err = DB.Model(&Organization{}).Where("id = ?", id).Select("quota").Find(&quota).Error
+	return quota, err
+}
+
+func IsOrganizationEnabled(id int) bool {
+	var status int
+	if err := DB.Model(&Organization{}).Where("id = ?", id).Select("status").Find(&status).Error; err != nil {
+		return false
+	}
+	return status == OrgStatusEnabled
+}
+
+// CacheIsOrganizationEnabled 组织令牌鉴权时调用，开启 Redis 时缓存 OrgId2StatusCacheSeconds 秒，组织状态变更时失效
+func CacheIsOrganizationEnabled(id int) bool {
+	if !common.RedisEnabled {
+		return IsOrganizationEnabled(id)
+	}
+	key := fmt.Sprintf("org_enabled:%d", id)
+	if enabled, err := common.RedisGet(key); err == nil {
+		return enabled == "1"
+	}
+	orgEnabled := IsOrganizationEnabled(id)
+	enabled := "0"
+	if orgEnabled {
+		enabled = "1"
+	}
+	if err := common.RedisSet(key, enabled, time.Duration(OrgId2StatusCacheSeconds)*time.Second); err != nil {
+		logger.SysError("Redis set org enabled error: " + err.Error())
+	}
+	return orgEnabled
+}
+
+// CacheGetOrganizationMemberRole 同 GetOrganizationMemberRole，开启 Redis 时缓存，成员变更时失效
+func CacheGetOrganizationMemberRole(orgId int, userId int) int {
+	if !common.RedisEnabled || orgId == 0 || userId == 0 {
+		return GetOrganizationMemberRole(orgId, userId)
+	}
+	key := fmt.Sprintf("org_member_role:%d:%d", orgId, userId)
+	if roleString, err := common.RedisGet(key); err == nil {
+		if role, err := strconv.Atoi(roleString); err == nil {
+			return role
+		}
+	}
+	role := GetOrganizationMemberRole(orgId, userId)
+	if err := common.RedisSet(key, strconv.Itoa(role), time.Duration(OrgId2StatusCacheSeconds)*time.Second); err != nil {
+		logger.SysError("Redis set org member role error: " + err.Error())
+	}
+	return role
+}
+
+func invalidateOrganizationEnabledCache(id int) {
+	if !common.RedisEnabled || common.RDB == nil {
+		return
+	}
+	if err := common.RedisDel(fmt.Sprintf("org_enabled:%d", id)); err != nil {
+		logger.SysError("Redis del org enabled error: " + err.Error())
+	}
+}
+
+func invalidateOrganizationMemberRoleCache(orgId int, userId int) {
+	if !common.RedisEnabled || common.RDB == nil {
+		return
+	}
+	if err := common.RedisDel(fmt.Sprintf("org_member_role:%d:%d", orgId, userId)); err != nil {
+		logger.SysError("Redis del org member role error: " + err.Error())
+	}
+}
+
+func IncreaseOrgQuota(id int, quota int64) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return DB.Model(&Organization{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
+}
+
+func DecreaseOrgQuota(id int, quota int64) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return DB.Model(&Organization{}).Where("id = ?", id).Update("quota", gorm.Expr("quota - ?", quota)).Error
+}
+
+func fetchAndUpdateOrgQuota(ctx context.Context, id int) (quota int64, err error) {
+	quota, err = GetOrgQuota(id)
+	if err != nil {
+		return 0, err
+	}
+	err = common.RedisSet(fmt.Sprintf("org_quota:%d", id), fmt.Sprintf("%d", quota), time.Duration(OrgId2QuotaCacheSeconds)*time.Second)
+	if err != nil {
+		logger.Error(ctx, "Redis set org quota error: "+err.Error())
+	}
+	return quota, nil
+}
+
+func CacheGetOrgQuota(ctx context.Context, id int) (quota int64, err error) {
+	if !common.RedisEnabled {
+		return GetOrgQuota(id)
+	}
+	quotaString, err := common.RedisGet(fmt.Sprintf("org_quota:%d", id))
+	if err != nil {
+		return fetchAndUpdateOrgQuota(ctx, id)
+	}
+	quota, err = strconv.ParseInt(quotaString, 10, 64)
+	if err != nil || quota <= config.PreConsumedQuota {
+		return fetchAndUpdateOrgQuota(ctx, id)
+	}
+	return quota, nil
+}
+
+func CacheUpdateOrgQuota(ctx context.Context, id int) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	_, err := fetchAndUpdateOrgQuota(ctx, id)
+	return err
+}
+
+// CacheGetPayerQuota 返回本次请求实际付费方的可用额度：组织令牌取组织额度池，
+// 否则取用户额度（后付费用户含透支额度）
+func CacheGetPayerQuota(ctx context.Context, userId int, orgId int) (int64, error) {
+	if orgId > 0 {
+		return CacheGetOrgQuota(ctx, orgId)
+	}
+	return CacheGetUserAvailableQuota(ctx, userId)
+}
+
+// CacheDecreasePayerQuota 与 CacheDecreaseUserQuota 对应，组织令牌扣减组织额度缓存
+func CacheDecreasePayerQuota(userId int, orgId int, quota int64) error {
+	if orgId > 0 {
+		if !common.RedisEnabled {
+			return nil
+		}
+		return common.RedisDecrease(fmt.Sprintf("org_quota:%d", orgId), quota)
+	}
+	return CacheDecreaseUserQuota(userId, quota)
+}
+
+// CacheUpdatePayerQuota 与 CacheUpdateUserQuota 对应
+func CacheUpdatePayerQuota(ctx context.Context, userId int, orgId int) error {
+	if orgId > 0 {
+		return CacheUpdateOrgQuota(ctx, orgId)
+	}
+	return CacheUpdateUserQuota(ctx, userId)
+}
+
+// DecreasePayerQuota 异步任务结算时扣付费方额度：组织任务扣组织额度池，否则扣用户余额
+func DecreasePayerQuota(userId int, orgId int, quota int64) error {
+	if orgId > 0 {
+		return DecreaseOrgQuota(orgId, quota)
+	}
+	return DecreaseUserQuota(userId, quota)
+}
+
+// IncreasePayerQuota 异步任务退款时退回付费方，与 DecreasePayerQuota 对应
+func IncreasePayerQuota(userId int, orgId int, quota int64) error {
+	if orgId > 0 {
+		return IncreaseOrgQuota(orgId, quota)
+	}
+	return IncreaseUserQuota(userId, quota)
+}
+
+// RecordOrganizationUsage 累加组织成员的日消费，由消费日志路径调用
+func RecordOrganizationUsage(orgId int, userId int, modelName string, quota int64) {
+	if orgId == 0 {
+		return
+	}
+	usage := OrganizationUsage{
+		OrgId:        orgId,
+		Day:          time.Now().Format("2006-01-02"),
+		UserId:       userId,
+		ModelName:    modelName,
+		Quota:        quota,
+		RequestCount: 1,
+	}
+	err := DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "org_id"}, {Name: "day"}, {Name: "user_id"}, {Name: "model_name"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"quota":         gorm.Expr("quota + ?", quota),
+			"request_count": gorm.Expr("request_count + ?", 1),
+		}),
+	}).Create(&usage).Error
+	if err != nil {
+		logger.SysError("failed to record organization usage: " + err.Error())
+	}
+	err = DB.Model(&Organization{}).Where("id = ?", orgId).Updates(map[string]interface{}{
+		"used_quota":    gorm.Expr("used_quota + ?", quota),
+		"request_count": gorm.Expr("request_count + ?", 1),
+	}).Error
+	if err != nil {
+		logger.SysError("failed to update organization used quota: " + err.Error())
+	}
+}
+
+// OrganizationMemberUsage 看板上按成员拆分的汇总行
+type OrganizationMemberUsage struct {
+	UserId       int    `json:"user_id"`
+	Username     string `json:"username"`
+	ModelName    string `json:"model_name,omitempty"`
+	Quota        int64  `json:"quota"`
+	RequestCount int    `json:"request_count"`
+}
+
+// GetOrganizationMemberUsage 汇总 [startDay, endDay] 内各成员的消费；byModel 为 true 时再按模型拆分
+func GetOrganizationMemberUsage(orgId int, startDay string, endDay string, byModel bool) ([]*OrganizationMemberUsage, error) {
+	var rows []*OrganizationMemberUsage
+	selects := "user_id, sum(quota) as quota, sum(request_count) as request_count"
+	groupBy := "user_id"
+	if byModel {
+		selects = "user_id, model_name, sum(quota) as quota, sum(request_count) as request_count"
+		groupBy = "user_id, model_name"
+	}
+	tx := DB.Model(&OrganizationUsage{}).Select(selects).Where("org_id = ?", orgId)
+	if startDay != "" {
+		tx = tx.Where("day >= ?", startDay)
+	}
+	if endDay != "" {
+		tx = tx.Where("day <= ?", endDay)
+	}
+	err := tx.Group(groupBy).Order("quota desc").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		row.Username = GetUsernameById(row.UserId)
+	}
+	return rows, nil
+}
+
+func GetOrganizationTokens(orgId int, page int, pageSize int) (tokens []*Token, total int64, err error) {
+	err = DB.Model(&Token{}).Where("org_id = ?", orgId).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * pageSize
+	err = DB.Where("org_id = ?", orgId).Order("id desc").Limit(pageSize).Offset(offset).Find(&tokens).Error
+	return tokens, total, err
+}
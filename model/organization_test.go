@@ -0,0 +1,111 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+func TestOrgTokenConsumesOrgPool(t *testing.T) {
+	setupTestDB(t, &Organization{}, &OrganizationMember{}, &OrganizationUsage{})
+
+	user := &User{Id: 1, Username: "alice", Quota: 1000, AccessToken: "a", AffCode: "a"}
+	if err := DB.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	org, err := CreateOrganization("team", user.Id)
+	if err != nil {
+		t.Fatalf("创建组织失败: %v", err)
+	}
+	if err := IncreaseOrgQuota(org.Id, 5000); err != nil {
+		t.Fatalf("充值组织失败: %v", err)
+	}
+	token := &Token{Id: 1, UserId: user.Id, OrgId: org.Id, Key: "k1", Status: common.TokenStatusEnabled, UnlimitedQuota: true}
+	if err := DB.Create(token).Error; err != nil {
+		t.Fatalf("创建令牌失败: %v", err)
+	}
+
+	if err := PreConsumeTokenQuota(token.Id, 300); err != nil {
+		t.Fatalf("预扣费失败: %v", err)
+	}
+	if err := PostConsumeTokenQuota(token.Id, -100); err != nil {
+		t.Fatalf("退还失败: %v", err)
+	}
+
+	orgQuota, _ := GetOrgQuota(org.Id)
+	if orgQuota != 4800 {
+		t.Errorf("组织额度应为 4800，实际 %d", orgQuota)
+	}
+	userQuota, _ := GetUserQuota(user.Id)
+	if userQuota != 1000 {
+		t.Errorf("成员个人额度不应变动，实际 %d", userQuota)
+	}
+}
+
+func TestOrgMemberRoles(t *testing.T) {
+	setupTestDB(t, &Organization{}, &OrganizationMember{}, &OrganizationUsage{})
+
+	org, err := CreateOrganization("team", 1)
+	if err != nil {
+		t.Fatalf("创建组织失败: %v", err)
+	}
+	if role := GetOrganizationMemberRole(org.Id, 1); role != OrgRoleOwner {
+		t.Fatalf("创建者应为 owner，实际 %d", role)
+	}
+	if err := AddOrganizationMember(org.Id, 2, OrgRoleOwner); err == nil {
+		t.Error("不应允许直接添加 owner")
+	}
+	if err := AddOrganizationMember(org.Id, 2, OrgRoleMember); err != nil {
+		t.Fatalf("添加成员失败: %v", err)
+	}
+	if err := UpdateOrganizationMemberRole(org.Id, 1, OrgRoleMember); err == nil {
+		t.Error("不应允许修改 owner 的角色")
+	}
+	if err := RemoveOrganizationMember(org.Id, 1); err == nil {
+		t.Error("不应允许移除 owner")
+	}
+	if err := RemoveOrganizationMember(org.Id, 2); err != nil {
+		t.Fatalf("移除成员失败: %v", err)
+	}
+	if role := GetOrganizationMemberRole(org.Id, 2); role != 0 {
+		t.Errorf("移除后角色应为 0，实际 %d", role)
+	}
+}
+
+func TestPayerQuotaSettlesAsyncTasksOnOrgPool(t *testing.T) {
+	setupTestDB(t, &Organization{}, &OrganizationMember{}, &OrganizationUsage{})
+
+	user := &User{Id: 1, Username: "alice", Quota: 1000, AccessToken: "a", AffCode: "a"}
+	if err := DB.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	org, err := CreateOrganization("team", user.Id)
+	if err != nil {
+		t.Fatalf("创建组织失败: %v", err)
+	}
+	if err := IncreaseOrgQuota(org.Id, 5000); err != nil {
+		t.Fatalf("充值组织失败: %v", err)
+	}
+
+	// 组织任务结算 700、失败补偿 200，都只动组织额度池
+	if err := DecreasePayerQuota(user.Id, org.Id, 700); err != nil {
+		t.Fatalf("组织任务扣费失败: %v", err)
+	}
+	if err := IncreasePayerQuota(user.Id, org.Id, 200); err != nil {
+		t.Fatalf("组织任务退款失败: %v", err)
+	}
+	if orgQuota, _ := GetOrgQuota(org.Id); orgQuota != 4500 {
+		t.Errorf("组织额度应为 4500，实际 %d", orgQuota)
+	}
+	if userQuota, _ := GetUserQuota(user.Id); userQuota != 1000 {
+		t.Errorf("组织任务不应动成员余额，实际 %d", userQuota)
+	}
+
+	// 个人任务仍扣用户余额
+	if err := DecreasePayerQuota(user.Id, 0, 300); err != nil {
+		t.Fatalf("个人任务扣费失败: %v", err)
+	}
+	if userQuota, _ := GetUserQuota(user.Id); userQuota != 700 {
+		t.Errorf("个人任务应扣用户余额，实际 %d", userQuota)
+	}
+}
@@ -0,0 +1,269 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/payment"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StripeTopUpPaymentMethod 旧版 Stripe Checkout 订单的支付方式，新订单以 Provider 区分渠道
+const StripeTopUpPaymentMethod = "stripe"
+
+// ProviderName 订单所属的支付适配器；老订单没有 Provider 字段，按支付方式推断
+func (topUp *TopUp) ProviderName() string {
+	if topUp.Provider != "" {
+		return topUp.Provider
+	}
+	switch topUp.PaymentMethod {
+	case StripeTopUpPaymentMethod, AutoTopUpPaymentMethod:
+		return payment.ProviderStripe
+	}
+	return payment.ProviderEpay
+}
+
+func (topUp *TopUp) paymentOrder() *payment.Order {
+	return &payment.Order{
+		TradeNo:     topUp.TradeNo,
+		UserId:      topUp.UserId,
+		Amount:      topUp.Amount,
+		Money:       topUp.Money,
+		Currency:    topUp.Currency,
+		Method:      topUp.PaymentMethod,
+		ProviderRef: topUp.ProviderRef,
+	}
+}
+
+func getEnabledProvider(name string) (payment.Provider, error) {
+	p, ok := payment.Get(name)
+	if !ok {
+		return nil, errors.New("不支持的支付渠道")
+	}
+	if enabled, reason := p.Enabled(); !enabled {
+		return nil, errors.New(reason)
+	}
+	return p, nil
+}
+
+// CreatePaymentTopUp 通过适配器在网关下单，成功后创建 pending 订单。
+// topUp 需填好用户、数量、金额等字段；order 只需提供 Product / ReturnURL / NotifyURL
+func CreatePaymentTopUp(ctx context.Context, providerName string, topUp *TopUp, order *payment.Order) (*payment.CreateResult, error) {
+	p, err := getEnabledProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	if topUp.TradeNo == "" {
+		return nil, errors.New("未提供订单号")
+	}
+	base := topUp.paymentOrder()
+	base.Product, base.ReturnURL, base.NotifyURL = order.Product, order.ReturnURL, order.NotifyURL
+	result, err := p.CreateOrder(ctx, base)
+	if err != nil {
+		return nil, err
+	}
+	topUp.Provider = providerName
+	topUp.ProviderRef = result.ProviderRef
+	topUp.Status = TopUpStatusPending
+	topUp.CreateTime = helper.GetTimestamp()
+	if err := topUp.Insert(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ApplyPaymentResult 把验签后的回调或查单结果应用到订单状态机：
+//
+//	pending ──success──▶ success ──refunded──▶ refunded
+//	   │                    ▲
+//	   └─failed/expired──▶ failed / expired（之后网关确认收款仍可入账）
+//
+// 重复回调不会重复入账或扣回，changed 表示本次是否改变了订单状态
+func ApplyPaymentResult(providerName string, result *payment.CallbackResult) (changed bool, err error) {
+	if result == nil || result.TradeNo == "" {
+		return false, errors.New("未提供订单号")
+	}
+	if result.UserId > 0 {
+		if err := ensurePaymentTopUp(providerName, result); err != nil {
+			return false, err
+		}
+	}
+	topUp := GetTopUpByTradeNo(result.TradeNo)
+	if topUp == nil && providerName == payment.ProviderStripeLink {
+		topUp = migrateChargeOrder(result.TradeNo)
+	}
+	if topUp == nil {
+		return false, errors.New("充值订单不存在")
+	}
+	if topUp.ProviderName() != providerName {
+		return false, fmt.Errorf("订单 %s 不属于支付渠道 %s", result.TradeNo, providerName)
+	}
+	changed, err = applyTopUpStatus(result)
+	if err != nil {
+		return changed, err
+	}
+	if providerName == payment.ProviderCrypto && result.Raw != nil {
+		if err := recordCryptoOrder(result); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// applyTopUpStatus 按回调状态推进 TopUp 状态机
+func applyTopUpStatus(result *payment.CallbackResult) (bool, error) {
+	switch result.Status {
+	case payment.StatusSuccess:
+		completion := topUpCompletion{providerRef: result.ProviderRef, quota: result.Quota}
+		if result.Money > 0 {
+			completion.money = &result.Money
+		}
+		if result.Currency != "" {
+			completion.currency = &result.Currency
+		}
+		return completeTopUpOrder(result.TradeNo, completion)
+	case payment.StatusFailed, payment.StatusExpired:
+		return closeTopUpOrder(result.TradeNo, string(result.Status))
+	case payment.StatusRefunded:
+		return refundTopUpOrder(result.TradeNo, 0)
+	case payment.StatusPending:
+		return false, nil
+	}
+	return false, fmt.Errorf("未知的支付状态: %s", result.Status)
+}
+
+// ensurePaymentTopUp 回调时才建单的网关（加密货币）在首次回调时创建 pending 订单，订单号唯一保证并发回调只建一次
+func ensurePaymentTopUp(providerName string, result *payment.CallbackResult) error {
+	topUp := &TopUp{
+		UserId:        result.UserId,
+		Amount:        int64(result.Money),
+		Money:         result.Money,
+		TradeNo:       result.TradeNo,
+		PaymentMethod: providerName,
+		Currency:      result.Currency,
+		CreateTime:    helper.GetTimestamp(),
+		Status:        TopUpStatusPending,
+		Provider:      providerName,
+		ProviderRef:   result.ProviderRef,
+	}
+	return DB.Clauses(clause.OnConflict{DoNothing: true}).Create(topUp).Error
+}
+
+// ExpireTopUpOrder 关闭超时未支付的订单
+func ExpireTopUpOrder(tradeNo string) error {
+	_, err := closeTopUpOrder(tradeNo, TopUpStatusExpired)
+	return err
+}
+
+// closeTopUpOrder pending 订单转为 failed / expired，其它状态不变
+func closeTopUpOrder(tradeNo string, status string) (bool, error) {
+	if tradeNo == "" {
+		return false, errors.New("未提供订单号")
+	}
+	result := DB.Model(&TopUp{}).Where("trade_no = ? AND status = ?", tradeNo, TopUpStatusPending).
+		Updates(map[string]interface{}{"status": status, "complete_time": helper.GetTimestamp()})
+	return result.RowsAffected > 0, result.Error
+}
+
+// refundTopUpOrder success 订单转为 refunded，扣回入账额度并收回该笔充值产生的返佣。
+// 用户余额不足时允许扣成负数，避免先消费再退款套利
+func refundTopUpOrder(tradeNo string, operatorId int) (bool, error) {
+	var topUp TopUp
+	changed := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("trade_no = ?", tradeNo).First(&topUp).Error; err != nil {
+			return errors.New("充值订单不存在")
+		}
+		if topUp.Status != TopUpStatusSuccess {
+			return nil
+		}
+		if topUp.Quota == 0 {
+			topUp.Quota = topUpQuota(&topUp)
+		}
+		topUp.Status = TopUpStatusRefunded
+		topUp.RefundedTime = helper.GetTimestamp()
+		// 以 success 为条件更新，并发退款只有一次能扣回额度
+		result := tx.Model(&topUp).Where("status = ?", TopUpStatusSuccess).
+			Select("quota", "status", "refunded_time").Updates(&topUp)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return nil
+		}
+		if topUp.OrgId > 0 {
+			if err := tx.Model(&Organization{}).Where("id = ?", topUp.OrgId).
+				Update("quota", gorm.Expr("quota - ?", topUp.Quota)).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).
+			Update("quota", gorm.Expr("quota - ?", topUp.Quota)).Error; err != nil {
+			return err
+		}
+		changed = true
+		return nil
+	})
+	if err != nil || !changed {
+		return false, err
+	}
+
+	var commission AffiliateCommission
+	if DB.Where("source_type = ? AND source_id = ? AND status IN ?", AffiliateSourceTopUp, tradeNo,
+		[]string{AffiliateStatusPending, AffiliateStatusAvailable}).First(&commission).Error == nil {
+		if _, err := ClawbackAffiliateCommission(commission.Id, operatorId, "充值订单已退款"); err != nil {
+			logger.SysError(fmt.Sprintf("收回充值返佣失败: tradeNo=%s, err=%s", tradeNo, err.Error()))
+		}
+	}
+	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("充值订单 %s 已退款，扣回额度: %d", tradeNo, topUp.Quota))
+	logger.SysLog(fmt.Sprintf("充值订单退款: userId=%d, tradeNo=%s, quota=%d, money=%.2f %s", topUp.UserId, tradeNo, topUp.Quota, topUp.Money, topUp.Currency))
+	return true, nil
+}
+
+// SyncTopUpOrder 主动向网关查询订单状态并应用，用于回调丢失时补偿
+func SyncTopUpOrder(ctx context.Context, tradeNo string) (*TopUp, error) {
+	topUp := GetTopUpByTradeNo(tradeNo)
+	if topUp == nil {
+		return nil, errors.New("充值订单不存在")
+	}
+	p, ok := payment.Get(topUp.ProviderName())
+	if !ok {
+		return nil, errors.New("不支持的支付渠道")
+	}
+	result, err := p.QueryStatus(ctx, topUp.paymentOrder())
+	if err != nil {
+		return nil, err
+	}
+	result.TradeNo = tradeNo
+	if _, err := ApplyPaymentResult(p.Name(), result); err != nil {
+		return nil, err
+	}
+	return GetTopUpByTradeNo(tradeNo), nil
+}
+
+// RefundTopUp 管理员发起全额退款：网关退款成功后订单转为 refunded 并扣回额度。
+// 网关随后推送的退款回调会因订单已是 refunded 而被忽略
+func RefundTopUp(ctx context.Context, tradeNo string, operatorId int) error {
+	topUp := GetTopUpByTradeNo(tradeNo)
+	if topUp == nil {
+		return errors.New("充值订单不存在")
+	}
+	if topUp.Status != TopUpStatusSuccess {
+		return errors.New("只有已完成的订单可以退款")
+	}
+	p, ok := payment.Get(topUp.ProviderName())
+	if !ok {
+		return errors.New("不支持的支付渠道")
+	}
+	if err := p.Refund(ctx, topUp.paymentOrder()); err != nil {
+		if errors.Is(err, payment.ErrNotSupported) {
+			return errors.New("该支付渠道不支持在线退款")
+		}
+		return err
+	}
+	_, err := refundTopUpOrder(tradeNo, operatorId)
+	return err
+}
@@ -0,0 +1,221 @@
+package model
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/payment"
+)
+
+func TestFakeProviderTopUpLifecycle(t *testing.T) {
+	setupTestDB(t, &Log{}, &TopUp{}, &AffiliateCommission{}, &AffiliateAccount{})
+	origLogDB, origRedis, origFake := LOG_DB, common.RedisEnabled, payment.FakeEnabled
+	LOG_DB, common.RedisEnabled, payment.FakeEnabled = DB, false, true
+	fake := payment.NewFakeProvider()
+	payment.Register(fake)
+	t.Cleanup(func() {
+		LOG_DB, common.RedisEnabled, payment.FakeEnabled = origLogDB, origRedis, origFake
+		payment.Register(payment.NewFakeProvider())
+	})
+
+	DB.Create(&User{Id: 1, Username: "alice", AccessToken: "a", AffCode: "a"})
+	ctx := context.Background()
+	topUp := &TopUp{UserId: 1, Amount: 2, Money: 2, TradeNo: "fake1", PaymentMethod: "fake", Currency: "USD"}
+	result, err := CreatePaymentTopUp(ctx, payment.ProviderFake, topUp, &payment.Order{})
+	if err != nil {
+		t.Fatalf("下单失败: %v", err)
+	}
+	if result.PayURL == "" || GetTopUpByTradeNo("fake1").Status != TopUpStatusPending {
+		t.Fatalf("下单后应返回支付链接并创建 pending 订单")
+	}
+
+	values, err := fake.Settle("fake1", payment.StatusSuccess)
+	if err != nil {
+		t.Fatalf("模拟付款失败: %v", err)
+	}
+	forged := httptest.NewRequest("GET", "/api/payment/fake/notify?trade_no=fake1&status=success&sign=bad", nil)
+	if _, err := fake.VerifyCallback(forged); err == nil {
+		t.Error("伪造签名的回调应被拒绝")
+	}
+	callback, err := fake.VerifyCallback(httptest.NewRequest("GET", "/api/payment/fake/notify?"+values.Encode(), nil))
+	if err != nil {
+		t.Fatalf("回调验签失败: %v", err)
+	}
+	if _, err := ApplyPaymentResult(payment.ProviderEpay, callback); err == nil {
+		t.Error("其它渠道的回调不能完成该订单")
+	}
+	for i, wantChanged := range []bool{true, false} {
+		changed, err := ApplyPaymentResult(payment.ProviderFake, callback)
+		if err != nil || changed != wantChanged {
+			t.Fatalf("第 %d 次回调 changed=%v err=%v", i+1, changed, err)
+		}
+	}
+	want := int64(2 * config.QuotaPerUnit)
+	if quota, _ := GetUserQuota(1); quota != want {
+		t.Fatalf("重复回调只应入账一次，期望 %d 实际 %d", want, quota)
+	}
+	if synced, err := SyncTopUpOrder(ctx, "fake1"); err != nil || synced.Status != TopUpStatusSuccess {
+		t.Fatalf("查单应返回已完成订单: %+v %v", synced, err)
+	}
+
+	if err := RefundTopUp(ctx, "fake1", 0); err != nil {
+		t.Fatalf("退款失败: %v", err)
+	}
+	if quota, _ := GetUserQuota(1); quota != 0 {
+		t.Fatalf("退款后应扣回额度，实际 %d", quota)
+	}
+	if changed, _ := ApplyPaymentResult(payment.ProviderFake, &payment.CallbackResult{TradeNo: "fake1", Status: payment.StatusRefunded}); changed {
+		t.Error("网关随后推送的退款回调不应再次扣回")
+	}
+	if GetTopUpByTradeNo("fake1").Status != TopUpStatusRefunded {
+		t.Error("订单应为 refunded")
+	}
+}
+
+func TestPaymentResultClosesAndCreatesOrders(t *testing.T) {
+	setupTestDB(t, &Log{}, &TopUp{}, &AffiliateCommission{}, &AffiliateAccount{}, &Order{}, &Bill{})
+	origLogDB, origRedis := LOG_DB, common.RedisEnabled
+	LOG_DB, common.RedisEnabled = DB, false
+	t.Cleanup(func() { LOG_DB, common.RedisEnabled = origLogDB, origRedis })
+	DB.Create(&User{Id: 1, Username: "alice", AccessToken: "a", AffCode: "a"})
+
+	// 过期后网关仍确认收款时照常入账
+	DB.Create(&TopUp{UserId: 1, Amount: 1, TradeNo: "ref_1", PaymentMethod: StripeTopUpPaymentMethod, Status: TopUpStatusPending})
+	if changed, err := ApplyPaymentResult(payment.ProviderStripe, &payment.CallbackResult{TradeNo: "ref_1", Status: payment.StatusExpired}); err != nil || !changed {
+		t.Fatalf("老 Stripe 订单应按支付方式归属 stripe 渠道并过期: %v", err)
+	}
+	if changed, err := ApplyPaymentResult(payment.ProviderStripe, &payment.CallbackResult{TradeNo: "ref_1", Status: payment.StatusSuccess, Money: 1.5, Currency: "EUR"}); err != nil || !changed {
+		t.Fatalf("过期订单收到付款应入账: %v", err)
+	}
+	if order := GetTopUpByTradeNo("ref_1"); order.Money != 1.5 || order.Currency != "EUR" {
+		t.Errorf("应以网关实付金额为准，实际 %+v", order)
+	}
+
+	// 加密货币首次回调时建单，转发完成后按回调额度入账
+	raw := url.Values{"uuid": {"u1"}, "result": {"pending"}, "coin": {"polygon_usdt"}, "value_coin": {"3.1"}, "value_forwarded_coin": {"3"}}
+	pending := &payment.CallbackResult{TradeNo: "crypto_u1", Status: payment.StatusPending, UserId: 1, Currency: "USDT", Raw: raw}
+	if changed, err := ApplyPaymentResult(payment.ProviderCrypto, pending); err != nil || changed {
+		t.Fatalf("pending 回调只建单: changed=%v err=%v", changed, err)
+	}
+	sentRaw := url.Values{"uuid": {"u1"}, "result": {"sent"}, "coin": {"polygon_usdt"}, "value_coin": {"3.1"}, "value_forwarded_coin": {"3"}}
+	sent := &payment.CallbackResult{TradeNo: "crypto_u1", Status: payment.StatusSuccess, UserId: 1, Money: 3, Quota: 300, Currency: "USDT", Raw: sentRaw}
+	for i := 0; i < 2; i++ {
+		if _, err := ApplyPaymentResult(payment.ProviderCrypto, sent); err != nil {
+			t.Fatalf("加密货币回调失败: %v", err)
+		}
+	}
+	var count int64
+	DB.Model(&TopUp{}).Where("trade_no = ?", "crypto_u1").Count(&count)
+	quota, _ := GetUserQuota(1)
+	if count != 1 || quota != int64(config.QuotaPerUnit)+300 {
+		t.Fatalf("加密货币订单应只创建一次并入账一次: count=%d quota=%d", count, quota)
+	}
+
+	// 账单接口读取的 orders / bills 同样只写一次，后续回调只推进状态
+	orders, total, err := GetUserBillsAndCount(1, 10, 1, 0, 0)
+	if err != nil || total != 1 || orders[0].Uuid != "u1" || orders[0].Status != 3 || orders[0].ValueCoin != 3.1 {
+		t.Fatalf("加密货币到账应写入账单: total=%d err=%v", total, err)
+	}
+	done := &payment.CallbackResult{TradeNo: "crypto_u1", Status: payment.StatusPending, UserId: 1, Currency: "USDT",
+		Raw: url.Values{"uuid": {"u1"}, "result": {"done"}}}
+	if _, err := ApplyPaymentResult(payment.ProviderCrypto, done); err != nil {
+		t.Fatalf("加密货币回调失败: %v", err)
+	}
+	var bill Bill
+	DB.Where("source_id = ?", "u1").First(&bill)
+	DB.Model(&Bill{}).Where("source_id = ?", "u1").Count(&count)
+	if count != 1 || bill.Status != 4 || bill.Amount != 3.1 {
+		t.Errorf("bills 应只有一行并推进到 done: count=%d bill=%+v", count, bill)
+	}
+}
+
+func TestStripeLinkCallbackMigratesChargeOrder(t *testing.T) {
+	setupTestDB(t, &Log{}, &TopUp{}, &AffiliateCommission{}, &AffiliateAccount{}, &ChargeOrder{})
+	origLogDB, origRedis := LOG_DB, common.RedisEnabled
+	LOG_DB, common.RedisEnabled = DB, false
+	t.Cleanup(func() { LOG_DB, common.RedisEnabled = origLogDB, origRedis })
+	DB.Create(&User{Id: 1, Username: "alice", AccessToken: "a", AffCode: "a"})
+	DB.Create(&ChargeOrder{UserId: 1, AppOrderId: "link_new", Status: StatusMap["create"], Currency: "usd", Amount: 5})
+	DB.Create(&ChargeOrder{UserId: 1, AppOrderId: "link_paid", Status: StatusMap["success"], Currency: "usd", Amount: 7, OrderNo: "ch_1"})
+
+	// 上线前生成的 Payment Link 回调时补建 TopUp 并入账，重复回调不重复入账
+	success := &payment.CallbackResult{TradeNo: "link_new", Status: payment.StatusSuccess, Money: 5, Currency: "USD", ProviderRef: "pi_1"}
+	for i := 0; i < 2; i++ {
+		if _, err := ApplyPaymentResult(payment.ProviderStripeLink, success); err != nil {
+			t.Fatalf("旧版 Payment Link 回调失败: %v", err)
+		}
+	}
+	if quota, _ := GetUserQuota(1); quota != int64(5*config.QuotaPerUnit) {
+		t.Fatalf("旧订单应入账一次，实际余额 %d", quota)
+	}
+	if topUp := GetTopUpByTradeNo("link_new"); topUp == nil || topUp.Status != TopUpStatusSuccess || topUp.ProviderName() != payment.ProviderStripeLink {
+		t.Fatalf("应补建 stripe_link 的 TopUp: %+v", topUp)
+	}
+
+	// 旧流程已入账的订单补建为 success，重放的成功回调不会再次入账
+	paid := &payment.CallbackResult{TradeNo: "link_paid", Status: payment.StatusSuccess, Money: 7, Currency: "USD"}
+	if changed, err := ApplyPaymentResult(payment.ProviderStripeLink, paid); err != nil || changed {
+		t.Fatalf("已入账的旧订单不应再次入账: changed=%v err=%v", changed, err)
+	}
+	if quota, _ := GetUserQuota(1); quota != int64(5*config.QuotaPerUnit) {
+		t.Errorf("已入账的旧订单不应改变余额，实际 %d", quota)
+	}
+	if _, err := ApplyPaymentResult(payment.ProviderStripeLink, &payment.CallbackResult{TradeNo: "missing", Status: payment.StatusSuccess}); err == nil {
+		t.Error("两张表都没有的订单应返回错误")
+	}
+}
+
+func TestConcurrentPaymentCallbacksCreditOnce(t *testing.T) {
+	setupTestDB(t, &Log{}, &TopUp{}, &AffiliateCommission{}, &AffiliateAccount{})
+	origLogDB, origRedis, origPercent := LOG_DB, common.RedisEnabled, config.AffiliateCommissionPercent
+	LOG_DB, common.RedisEnabled, config.AffiliateCommissionPercent = DB, false, 10
+	t.Cleanup(func() {
+		LOG_DB, common.RedisEnabled, config.AffiliateCommissionPercent = origLogDB, origRedis, origPercent
+	})
+	now := helper.GetTimestamp()
+	DB.Create(&User{Id: 1, Username: "inviter", AccessToken: "a", AffCode: "a", CreatedTime: now})
+	DB.Create(&User{Id: 2, Username: "invitee", AccessToken: "b", AffCode: "b", InviterId: 1, CreatedTime: now})
+	DB.Create(&TopUp{UserId: 2, Amount: 2, Money: 2, TradeNo: "dup_1", PaymentMethod: StripeTopUpPaymentMethod, Status: TopUpStatusPending})
+
+	apply := func(status payment.Status, n int) int32 {
+		var changed int32
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, _ := ApplyPaymentResult(payment.ProviderStripe, &payment.CallbackResult{TradeNo: "dup_1", Status: status})
+				if ok {
+					atomic.AddInt32(&changed, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		return changed
+	}
+
+	if changed := apply(payment.StatusSuccess, 5); changed != 1 {
+		t.Errorf("并发回调应只有 1 次改变订单状态，实际 %d", changed)
+	}
+	want := int64(2 * config.QuotaPerUnit)
+	if quota, _ := GetUserQuota(2); quota != want {
+		t.Fatalf("并发回调只应入账一次，期望 %d 实际 %d", want, quota)
+	}
+	if account := GetAffiliateAccount(1); account.PendingQuota != want/10 {
+		t.Errorf("返佣只应记录一次，期望 %d 实际 %d", want/10, account.PendingQuota)
+	}
+
+	if changed := apply(payment.StatusRefunded, 3); changed != 1 {
+		t.Errorf("并发退款回调应只有 1 次改变订单状态，实际 %d", changed)
+	}
+	if quota, _ := GetUserQuota(2); quota != 0 {
+		t.Errorf("并发退款只应扣回一次，实际余额 %d", quota)
+	}
+}
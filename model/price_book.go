@@ -0,0 +1,385 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// PriceBookVersion 价格簿版本。创建后变更内容不可修改，只允许删除尚未生效的计划版本。
+// 生效版本 = effective_from <= 当前时间中 effective_from 最大（同时刻取 id 最大）的版本。
+// 生效时把 Changes 合并到当时的价格上，期间经其他途径做的修改不会被回滚；Snapshot 随之改写为实际生效的价格。
+type PriceBookVersion struct {
+	Id            int    `json:"id"`
+	VersionId     string `json:"version_id" gorm:"type:varchar(32);uniqueIndex"`
+	EffectiveFrom int64  `json:"effective_from" gorm:"bigint;index"`
+	Snapshot      string `json:"snapshot,omitempty" gorm:"type:text"` // JSON：配置项 -> 配置值（JSON 字符串）
+	Changes       string `json:"changes,omitempty" gorm:"type:text"`  // JSON：配置项 -> priceBookOptionChange
+	ContentHash   string `json:"content_hash" gorm:"type:char(64)"`
+	Note          string `json:"note" gorm:"type:varchar(255)"`
+	CreatedBy     int    `json:"created_by"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+}
+
+func (v *PriceBookVersion) Values() (map[string]string, error) {
+	values := make(map[string]string)
+	if err := json.Unmarshal([]byte(v.Snapshot), &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// priceBookOptionChange 单个配置项的变更。倍率类配置按模型记录增改与删除，
+// VideoPricingRules 是规则列表，整体替换。
+type priceBookOptionChange struct {
+	Set    map[string]float64 `json:"set,omitempty"`
+	Remove []string           `json:"remove,omitempty"`
+	Value  *string            `json:"value,omitempty"`
+}
+
+// diffPriceBookOption 计算配置项从 current 改为 value 所需的变更，没有变化时返回 nil
+func diffPriceBookOption(key string, current string, value string) *priceBookOptionChange {
+	if current == value {
+		return nil
+	}
+	if key == "VideoPricingRules" {
+		return &priceBookOptionChange{Value: &value}
+	}
+	var oldRatios, newRatios map[string]float64
+	_ = json.Unmarshal([]byte(current), &oldRatios)
+	_ = json.Unmarshal([]byte(value), &newRatios)
+	change := &priceBookOptionChange{Set: map[string]float64{}}
+	for name, ratio := range newRatios {
+		if oldRatio, ok := oldRatios[name]; !ok || oldRatio != ratio {
+			change.Set[name] = ratio
+		}
+	}
+	for name := range oldRatios {
+		if _, ok := newRatios[name]; !ok {
+			change.Remove = append(change.Remove, name)
+		}
+	}
+	if len(change.Set)+len(change.Remove) == 0 {
+		return nil
+	}
+	sort.Strings(change.Remove)
+	return change
+}
+
+// mergePriceBookOption 把变更合并到配置项的当前值上
+func mergePriceBookOption(current string, change *priceBookOptionChange) (string, error) {
+	if change.Value != nil {
+		return *change.Value, nil
+	}
+	ratios := make(map[string]float64)
+	if current != "" {
+		if err := json.Unmarshal([]byte(current), &ratios); err != nil {
+			return "", err
+		}
+	}
+	for name, ratio := range change.Set {
+		ratios[name] = ratio
+	}
+	for _, name := range change.Remove {
+		delete(ratios, name)
+	}
+	merged, err := json.Marshal(ratios)
+	if err != nil {
+		return "", err
+	}
+	return string(merged), nil
+}
+
+func priceBookContentHash(values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(values[k]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CurrentPriceBookValues 当前内存中的价格配置
+func CurrentPriceBookValues() map[string]string {
+	values := make(map[string]string, len(common.PriceBookOptionKeys))
+	config.OptionMapRWMutex.RLock()
+	defer config.OptionMapRWMutex.RUnlock()
+	for _, key := range common.PriceBookOptionKeys {
+		values[key] = config.OptionMap[key]
+	}
+	return values
+}
+
+func validatePriceBookValues(values map[string]string) error {
+	for key, value := range values {
+		if !common.IsPriceBookOptionKey(key) {
+			return fmt.Errorf("%s is not a price book option", key)
+		}
+		if key == "VideoPricingRules" {
+			var rules []common.VideoPricingRule
+			if err := json.Unmarshal([]byte(value), &rules); err != nil {
+				return fmt.Errorf("invalid %s: %s", key, err.Error())
+			}
+			continue
+		}
+		var ratios map[string]float64
+		if err := json.Unmarshal([]byte(value), &ratios); err != nil {
+			return fmt.Errorf("invalid %s: %s", key, err.Error())
+		}
+	}
+	return nil
+}
+
+// CreatePriceBookVersion 以当前价格为基础、用 changes 覆盖部分配置项，创建一个新版本。
+// effectiveFrom 为 0 表示立即生效。
+func CreatePriceBookVersion(changes map[string]string, effectiveFrom int64, note string, userId int) (*PriceBookVersion, error) {
+	now := helper.GetTimestamp()
+	if effectiveFrom == 0 {
+		effectiveFrom = now
+	}
+	if effectiveFrom < now-60 {
+		return nil, errors.New("effective_from cannot be in the past")
+	}
+	if len(note) > 255 {
+		return nil, errors.New("note is too long")
+	}
+	if err := validatePriceBookValues(changes); err != nil {
+		return nil, err
+	}
+	values := CurrentPriceBookValues()
+	optionChanges := make(map[string]*priceBookOptionChange)
+	for k, v := range changes {
+		if change := diffPriceBookOption(k, values[k], v); change != nil {
+			optionChanges[k] = change
+		}
+		values[k] = v
+	}
+	snapshot, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	changesJSON, err := json.Marshal(optionChanges)
+	if err != nil {
+		return nil, err
+	}
+	version := &PriceBookVersion{
+		VersionId:     fmt.Sprintf("pv-%s-%s", time.Unix(now, 0).Format("20060102150405"), helper.GetUUID()[:6]),
+		EffectiveFrom: effectiveFrom,
+		Snapshot:      string(snapshot),
+		Changes:       string(changesJSON),
+		ContentHash:   priceBookContentHash(values),
+		Note:          note,
+		CreatedBy:     userId,
+		CreatedTime:   now,
+	}
+	if err := DB.Create(version).Error; err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// RecordPriceBookChange 价格经由旧的配置接口直接修改后调用，把修改后的价格记为立即生效的新版本
+func RecordPriceBookChange(note string, userId int) {
+	version, err := CreatePriceBookVersion(nil, 0, note, userId)
+	if err != nil {
+		logger.SysError("failed to record price book version: " + err.Error())
+		return
+	}
+	common.SetActivePriceVersion(version.VersionId)
+}
+
+func GetPriceBookVersion(versionId string) (*PriceBookVersion, error) {
+	version := &PriceBookVersion{}
+	err := DB.Where("version_id = ?", versionId).First(version).Error
+	return version, err
+}
+
+// GetPriceBookVersions 分页列出版本（不含快照与变更内容）
+func GetPriceBookVersions(page int, pageSize int) (versions []*PriceBookVersion, total int64, err error) {
+	if err = DB.Model(&PriceBookVersion{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = DB.Omit("snapshot", "changes").Order("effective_from desc, id desc").
+		Limit(pageSize).Offset((page - 1) * pageSize).Find(&versions).Error
+	return versions, total, err
+}
+
+// DeleteScheduledPriceBookVersion 撤销尚未生效的计划版本，已生效的版本不可删除
+func DeleteScheduledPriceBookVersion(versionId string) error {
+	result := DB.Where("version_id = ? AND effective_from > ?", versionId, helper.GetTimestamp()).Delete(&PriceBookVersion{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("version not found or already effective")
+	}
+	return nil
+}
+
+func getDuePriceBookVersion() (*PriceBookVersion, error) {
+	version := &PriceBookVersion{}
+	err := DB.Where("effective_from <= ?", helper.GetTimestamp()).
+		Order("effective_from desc, id desc").First(version).Error
+	if err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// priceBookValuesAfter 计算版本生效后的价格：把变更合并到当前价格上。
+// 没有记录变更的旧版本退回按快照整体覆盖。
+func priceBookValuesAfter(version *PriceBookVersion, current map[string]string) (map[string]string, error) {
+	if version.Changes == "" {
+		return version.Values()
+	}
+	var changes map[string]*priceBookOptionChange
+	if err := json.Unmarshal([]byte(version.Changes), &changes); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(current))
+	for k, v := range current {
+		values[k] = v
+	}
+	for key, change := range changes {
+		merged, err := mergePriceBookOption(current[key], change)
+		if err != nil {
+			return nil, fmt.Errorf("failed to merge %s: %s", key, err.Error())
+		}
+		values[key] = merged
+	}
+	return values, nil
+}
+
+func applyPriceBookVersion(version *PriceBookVersion) error {
+	current := CurrentPriceBookValues()
+	values, err := priceBookValuesAfter(version, current)
+	if err != nil {
+		return err
+	}
+	for _, key := range common.PriceBookOptionKeys {
+		value, ok := values[key]
+		if !ok || current[key] == value {
+			continue
+		}
+		if err := UpdateOption(key, value); err != nil {
+			return fmt.Errorf("failed to apply %s: %s", key, err.Error())
+		}
+	}
+	// 快照改写为实际生效的价格，供 diff 与启动时的一致性校验使用
+	if hash := priceBookContentHash(values); hash != version.ContentHash {
+		snapshot, err := json.Marshal(values)
+		if err != nil {
+			return err
+		}
+		version.Snapshot, version.ContentHash = string(snapshot), hash
+		if err := DB.Model(version).Select("snapshot", "content_hash").Updates(version).Error; err != nil {
+			return err
+		}
+	}
+	common.SetActivePriceVersion(version.VersionId)
+	logger.SysLog("price book version applied: " + version.VersionId)
+	return nil
+}
+
+// InitPriceBook 启动时确定当前生效版本。没有任何版本，或配置表已被绕过价格簿修改过时，
+// 以当前价格补记一个版本，避免启动时回滚他人的修改。
+func InitPriceBook() {
+	version, err := getDuePriceBookVersion()
+	if err == nil && version.ContentHash == priceBookContentHash(CurrentPriceBookValues()) {
+		common.SetActivePriceVersion(version.VersionId)
+		return
+	}
+	note := "initial"
+	if err == nil {
+		note = "recorded from out-of-band option change"
+	}
+	RecordPriceBookChange(note, 0)
+}
+
+// SyncPriceBook 定期检查是否有新版本到达生效时间
+func SyncPriceBook(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		version, err := getDuePriceBookVersion()
+		if err != nil || version.VersionId == common.GetActivePriceVersion() {
+			continue
+		}
+		if err := applyPriceBookVersion(version); err != nil {
+			logger.SysError("failed to apply price book version " + version.VersionId + ": " + err.Error())
+		}
+	}
+}
+
+// PriceBookRatioDiff 某个倍率配置项在两个版本之间的差异
+type PriceBookRatioDiff struct {
+	Added   map[string]float64    `json:"added,omitempty"`
+	Removed map[string]float64    `json:"removed,omitempty"`
+	Changed map[string][2]float64 `json:"changed,omitempty"` // [旧值, 新值]
+}
+
+// DiffPriceBookVersions 比较两个版本，返回有变化的配置项。
+// 倍率类配置按模型给出增删改；VideoPricingRules 是规则列表，只给出新旧两份规则。
+func DiffPriceBookVersions(from *PriceBookVersion, to *PriceBookVersion) (map[string]interface{}, error) {
+	fromValues, err := from.Values()
+	if err != nil {
+		return nil, err
+	}
+	toValues, err := to.Values()
+	if err != nil {
+		return nil, err
+	}
+	diff := make(map[string]interface{})
+	for _, key := range common.PriceBookOptionKeys {
+		if fromValues[key] == toValues[key] {
+			continue
+		}
+		if key == "VideoPricingRules" {
+			var oldRules, newRules []common.VideoPricingRule
+			_ = json.Unmarshal([]byte(fromValues[key]), &oldRules)
+			_ = json.Unmarshal([]byte(toValues[key]), &newRules)
+			diff[key] = map[string]interface{}{"from": oldRules, "to": newRules}
+			continue
+		}
+		var oldRatios, newRatios map[string]float64
+		_ = json.Unmarshal([]byte(fromValues[key]), &oldRatios)
+		_ = json.Unmarshal([]byte(toValues[key]), &newRatios)
+		ratioDiff := PriceBookRatioDiff{
+			Added:   map[string]float64{},
+			Removed: map[string]float64{},
+			Changed: map[string][2]float64{},
+		}
+		for name, newValue := range newRatios {
+			oldValue, ok := oldRatios[name]
+			if !ok {
+				ratioDiff.Added[name] = newValue
+			} else if oldValue != newValue {
+				ratioDiff.Changed[name] = [2]float64{oldValue, newValue}
+			}
+		}
+		for name, oldValue := range oldRatios {
+			if _, ok := newRatios[name]; !ok {
+				ratioDiff.Removed[name] = oldValue
+			}
+		}
+		if len(ratioDiff.Added)+len(ratioDiff.Removed)+len(ratioDiff.Changed) > 0 {
+			diff[key] = ratioDiff
+		}
+	}
+	return diff, nil
+}
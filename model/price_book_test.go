@@ -0,0 +1,105 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestPriceBookScheduleAndDiff(t *testing.T) {
+	setupTestDB(t, &Option{}, &PriceBookVersion{})
+	origOptionMap, origModelRatio, origActive := config.OptionMap, common.ModelRatio, common.GetActivePriceVersion()
+	config.OptionMap = map[string]string{"ModelRatio": `{"gpt-test":1}`, "CompletionRatio": `{"gpt-test":2}`}
+	t.Cleanup(func() {
+		config.OptionMap, common.ModelRatio = origOptionMap, origModelRatio
+		common.SetActivePriceVersion(origActive)
+	})
+
+	InitPriceBook()
+	initial := common.GetActivePriceVersion()
+	if initial == "" {
+		t.Fatal("启动时应补记初始版本")
+	}
+
+	if _, err := CreatePriceBookVersion(map[string]string{"ModelRatio": "not json"}, 0, "", 1); err == nil {
+		t.Error("非法的倍率 JSON 应被拒绝")
+	}
+	scheduled, err := CreatePriceBookVersion(map[string]string{"ModelRatio": `{"gpt-test":1.5,"gpt-new":3}`}, time.Now().Unix()+3600, "涨价", 1)
+	if err != nil {
+		t.Fatalf("创建计划版本失败: %v", err)
+	}
+	if due, _ := getDuePriceBookVersion(); due.VersionId != initial {
+		t.Errorf("计划版本未到生效时间，生效版本应仍为 %s，实际 %s", initial, due.VersionId)
+	}
+
+	from, _ := GetPriceBookVersion(initial)
+	diff, err := DiffPriceBookVersions(from, scheduled)
+	if err != nil {
+		t.Fatalf("diff 失败: %v", err)
+	}
+	ratioDiff, ok := diff["ModelRatio"].(PriceBookRatioDiff)
+	if !ok || ratioDiff.Changed["gpt-test"] != [2]float64{1, 1.5} || ratioDiff.Added["gpt-new"] != 3 {
+		t.Errorf("ModelRatio diff 不符: %+v", diff["ModelRatio"])
+	}
+	if _, ok := diff["CompletionRatio"]; ok {
+		t.Error("未修改的配置项不应出现在 diff 中")
+	}
+
+	// 模拟到达生效时间
+	DB.Model(&PriceBookVersion{}).Where("id = ?", scheduled.Id).Update("effective_from", time.Now().Unix())
+	due, _ := getDuePriceBookVersion()
+	if err := applyPriceBookVersion(due); err != nil {
+		t.Fatalf("应用版本失败: %v", err)
+	}
+	if common.GetActivePriceVersion() != scheduled.VersionId || common.GetModelRatio("gpt-test") != 1.5 {
+		t.Errorf("应用后倍率应为 1.5，实际 %v（版本 %s）", common.GetModelRatio("gpt-test"), common.GetActivePriceVersion())
+	}
+	if err := DeleteScheduledPriceBookVersion(scheduled.VersionId); err == nil {
+		t.Error("已生效的版本不应允许删除")
+	}
+}
+
+func TestPriceBookScheduledVersionKeepsInterimEdits(t *testing.T) {
+	setupTestDB(t, &Option{}, &PriceBookVersion{})
+	origOptionMap, origModelRatio, origCompletionRatio, origActive := config.OptionMap, common.ModelRatio, common.CompletionRatio, common.GetActivePriceVersion()
+	config.OptionMap = map[string]string{"ModelRatio": `{"gpt-test":1,"gpt-old":4}`, "CompletionRatio": `{"gpt-test":2}`}
+	t.Cleanup(func() {
+		config.OptionMap, common.ModelRatio, common.CompletionRatio = origOptionMap, origModelRatio, origCompletionRatio
+		common.SetActivePriceVersion(origActive)
+	})
+	InitPriceBook()
+
+	scheduled, err := CreatePriceBookVersion(map[string]string{"ModelRatio": `{"gpt-test":1.5}`}, time.Now().Unix()+3600, "涨价并下架 gpt-old", 1)
+	if err != nil {
+		t.Fatalf("创建计划版本失败: %v", err)
+	}
+
+	// 计划版本生效前，经旧的配置接口修改了价格
+	if err := UpdateOption("ModelRatio", `{"gpt-test":1,"gpt-old":4,"gpt-new":3}`); err != nil {
+		t.Fatalf("修改倍率失败: %v", err)
+	}
+	if err := UpdateOption("CompletionRatio", `{"gpt-test":4}`); err != nil {
+		t.Fatalf("修改倍率失败: %v", err)
+	}
+	RecordPriceBookChange("update option: ModelRatio", 1)
+
+	version, _ := GetPriceBookVersion(scheduled.VersionId)
+	if err := applyPriceBookVersion(version); err != nil {
+		t.Fatalf("应用版本失败: %v", err)
+	}
+	if common.GetModelRatio("gpt-test") != 1.5 {
+		t.Errorf("计划版本的修改应生效，gpt-test 实际 %v", common.GetModelRatio("gpt-test"))
+	}
+	values := CurrentPriceBookValues()
+	if values["ModelRatio"] != `{"gpt-new":3,"gpt-test":1.5}` {
+		t.Errorf("期间新增的模型应保留、计划删除的模型应移除，实际 %s", values["ModelRatio"])
+	}
+	if values["CompletionRatio"] != `{"gpt-test":4}` {
+		t.Errorf("计划版本未涉及的配置项不应被回滚，实际 %s", values["CompletionRatio"])
+	}
+	if version, _ = GetPriceBookVersion(scheduled.VersionId); version.ContentHash != priceBookContentHash(values) {
+		t.Error("生效后快照应改写为实际生效的价格")
+	}
+}
@@ -0,0 +1,366 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PricingPlanScopeUser  = "user"
+	PricingPlanScopeGroup = "group"
+
+	PricingPlanMetricQuota  = "quota"  // 按当月消费额度分档
+	PricingPlanMetricTokens = "tokens" // 按当月 token 用量分档
+
+	PricingPlanStatusEnabled  = 1
+	PricingPlanStatusDisabled = 2
+)
+
+// PricingPlanTier 阶梯：当月用量达到 From 后，按 Ratio 计费（相对于标价，1 表示原价）
+type PricingPlanTier struct {
+	From  int64   `json:"from"`
+	Ratio float64 `json:"ratio"`
+}
+
+// PricingPlan 用户或分组的合同定价。用户计划优先于分组计划；
+// 分组计划对组内每个用户按其各自的当月用量分档。
+type PricingPlan struct {
+	Id           int    `json:"id"`
+	Name         string `json:"name" gorm:"type:varchar(64)"`
+	Scope        string `json:"scope" gorm:"type:varchar(16);index:idx_pricing_plan_target"`
+	TargetUserId int    `json:"target_user_id" gorm:"index:idx_pricing_plan_target"`
+	TargetGroup  string `json:"target_group" gorm:"type:varchar(64);index:idx_pricing_plan_target"`
+	Metric       string `json:"metric" gorm:"type:varchar(16)"`
+	Tiers        string `json:"tiers" gorm:"type:text"` // JSON []PricingPlanTier
+	// ModelOverrides 合同价：模型名 -> 相对标价的倍率，命中时替代阶梯倍率
+	ModelOverrides string `json:"model_overrides" gorm:"type:text"`
+	StartTime      int64  `json:"start_time" gorm:"bigint"`
+	EndTime        int64  `json:"end_time" gorm:"bigint"` // 0 表示长期有效
+	Status         int    `json:"status" gorm:"default:1"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+
+	tiers     []PricingPlanTier
+	overrides map[string]float64
+}
+
+// PricingPlanUsage 计划用户的月度用量，用于分档
+type PricingPlanUsage struct {
+	Id     int    `json:"id"`
+	UserId int    `json:"user_id" gorm:"uniqueIndex:idx_pricing_plan_usage"`
+	Month  string `json:"month" gorm:"type:varchar(7);uniqueIndex:idx_pricing_plan_usage"` // 2006-01
+	Quota  int64  `json:"quota" gorm:"default:0"`
+	Tokens int64  `json:"tokens" gorm:"default:0"`
+}
+
+// PricingPlanApplied 单次请求命中的计划，写入消费日志 Other 的 pricingPlan 段
+type PricingPlanApplied struct {
+	PlanId        int     `json:"plan_id"`
+	PlanName      string  `json:"plan_name"`
+	Metric        string  `json:"metric"`
+	MonthUsage    int64   `json:"month_usage"`
+	Tier          int     `json:"tier"` // 阶梯下标，命中合同价时为 -1
+	TierFrom      int64   `json:"tier_from,omitempty"`
+	ModelOverride bool    `json:"model_override,omitempty"`
+	Ratio         float64 `json:"ratio"`
+}
+
+func (plan *PricingPlan) parse() error {
+	plan.tiers = nil
+	plan.overrides = nil
+	if plan.Tiers != "" {
+		if err := json.Unmarshal([]byte(plan.Tiers), &plan.tiers); err != nil {
+			return errors.New("invalid tiers: " + err.Error())
+		}
+	}
+	sort.Slice(plan.tiers, func(i, j int) bool { return plan.tiers[i].From < plan.tiers[j].From })
+	for _, tier := range plan.tiers {
+		if tier.From < 0 || tier.Ratio <= 0 {
+			return errors.New("tier from must be >= 0 and ratio must be > 0")
+		}
+	}
+	if plan.ModelOverrides != "" {
+		if err := json.Unmarshal([]byte(plan.ModelOverrides), &plan.overrides); err != nil {
+			return errors.New("invalid model_overrides: " + err.Error())
+		}
+	}
+	for _, ratio := range plan.overrides {
+		if ratio <= 0 {
+			return errors.New("model override ratio must be > 0")
+		}
+	}
+	return nil
+}
+
+func (plan *PricingPlan) Validate() error {
+	switch plan.Scope {
+	case PricingPlanScopeUser:
+		if plan.TargetUserId == 0 {
+			return errors.New("target_user_id is required for user plans")
+		}
+		plan.TargetGroup = ""
+	case PricingPlanScopeGroup:
+		if plan.TargetGroup == "" {
+			return errors.New("target_group is required for group plans")
+		}
+		plan.TargetUserId = 0
+	default:
+		return errors.New("scope must be user or group")
+	}
+	if plan.Metric != PricingPlanMetricQuota && plan.Metric != PricingPlanMetricTokens {
+		return errors.New("metric must be quota or tokens")
+	}
+	if plan.EndTime != 0 && plan.EndTime <= plan.StartTime {
+		return errors.New("end_time must be after start_time")
+	}
+	if err := plan.parse(); err != nil {
+		return err
+	}
+	if len(plan.tiers) == 0 && len(plan.overrides) == 0 {
+		return errors.New("a plan needs at least one tier or model override")
+	}
+	return nil
+}
+
+func (plan *PricingPlan) activeAt(now int64) bool {
+	return plan.Status == PricingPlanStatusEnabled && plan.StartTime <= now && (plan.EndTime == 0 || now < plan.EndTime)
+}
+
+// resolve 计算某模型在给定当月用量下的计费倍率
+func (plan *PricingPlan) resolve(modelName string, monthUsage int64) *PricingPlanApplied {
+	applied := &PricingPlanApplied{
+		PlanId:     plan.Id,
+		PlanName:   plan.Name,
+		Metric:     plan.Metric,
+		MonthUsage: monthUsage,
+		Tier:       -1,
+		Ratio:      1,
+	}
+	if ratio, ok := plan.overrides[modelName]; ok && modelName != "" {
+		applied.ModelOverride = true
+		applied.Ratio = ratio
+		return applied
+	}
+	for i, tier := range plan.tiers {
+		if monthUsage >= tier.From {
+			applied.Tier = i
+			applied.TierFrom = tier.From
+			applied.Ratio = tier.Ratio
+		}
+	}
+	return applied
+}
+
+func CreatePricingPlan(plan *PricingPlan) error {
+	if err := plan.Validate(); err != nil {
+		return err
+	}
+	plan.CreatedTime = helper.GetTimestamp()
+	if plan.Status == 0 {
+		plan.Status = PricingPlanStatusEnabled
+	}
+	if err := DB.Create(plan).Error; err != nil {
+		return err
+	}
+	InvalidatePricingPlanCache()
+	return nil
+}
+
+func UpdatePricingPlan(plan *PricingPlan) error {
+	if err := plan.Validate(); err != nil {
+		return err
+	}
+	err := DB.Model(plan).Select("name", "scope", "target_user_id", "target_group", "metric", "tiers",
+		"model_overrides", "start_time", "end_time", "status").Updates(plan).Error
+	if err != nil {
+		return err
+	}
+	InvalidatePricingPlanCache()
+	return nil
+}
+
+func DeletePricingPlan(id int) error {
+	if err := DB.Delete(&PricingPlan{}, id).Error; err != nil {
+		return err
+	}
+	InvalidatePricingPlanCache()
+	return nil
+}
+
+func GetPricingPlanById(id int) (*PricingPlan, error) {
+	plan := &PricingPlan{}
+	err := DB.First(plan, id).Error
+	return plan, err
+}
+
+func GetAllPricingPlans() ([]*PricingPlan, error) {
+	var plans []*PricingPlan
+	err := DB.Order("id desc").Find(&plans).Error
+	return plans, err
+}
+
+// 计划缓存：计费热路径只读内存，CRUD 时本机立即失效，其他节点最迟 pricingPlanCacheSeconds 后刷新
+const pricingPlanCacheSeconds = 60
+
+var (
+	pricingPlanCache       []*PricingPlan
+	pricingPlanCacheLoaded int64
+	pricingPlanCacheLock   sync.RWMutex
+)
+
+func InvalidatePricingPlanCache() {
+	pricingPlanCacheLock.Lock()
+	pricingPlanCacheLoaded = 0
+	pricingPlanCacheLock.Unlock()
+}
+
+func cachedPricingPlans() []*PricingPlan {
+	now := helper.GetTimestamp()
+	pricingPlanCacheLock.RLock()
+	if now-pricingPlanCacheLoaded < pricingPlanCacheSeconds {
+		plans := pricingPlanCache
+		pricingPlanCacheLock.RUnlock()
+		return plans
+	}
+	pricingPlanCacheLock.RUnlock()
+
+	var plans []*PricingPlan
+	if err := DB.Where("status = ?", PricingPlanStatusEnabled).Find(&plans).Error; err != nil {
+		logger.SysError("failed to load pricing plans: " + err.Error())
+		return nil
+	}
+	valid := plans[:0]
+	for _, plan := range plans {
+		if err := plan.parse(); err != nil {
+			logger.SysError("skip invalid pricing plan: " + err.Error())
+			continue
+		}
+		valid = append(valid, plan)
+	}
+	pricingPlanCacheLock.Lock()
+	pricingPlanCache = valid
+	pricingPlanCacheLoaded = now
+	pricingPlanCacheLock.Unlock()
+	return valid
+}
+
+func findPricingPlan(userId int, group string, now int64) *PricingPlan {
+	var groupPlan *PricingPlan
+	for _, plan := range cachedPricingPlans() {
+		if !plan.activeAt(now) {
+			continue
+		}
+		if plan.Scope == PricingPlanScopeUser && plan.TargetUserId == userId {
+			return plan
+		}
+		if plan.Scope == PricingPlanScopeGroup && plan.TargetGroup == group && groupPlan == nil {
+			groupPlan = plan
+		}
+	}
+	return groupPlan
+}
+
+func pricingPlanMonth(t time.Time) string {
+	return t.Format("2006-01")
+}
+
+type pricingPlanUsageEntry struct {
+	month    string
+	quota    int64
+	tokens   int64
+	loadedAt int64
+}
+
+// 月度用量的本机缓存，分档允许几十秒的滞后
+var pricingPlanUsageCache sync.Map
+
+const pricingPlanUsageCacheSeconds = 30
+
+func getPricingPlanMonthUsage(userId int, month string) (quota int64, tokens int64) {
+	now := helper.GetTimestamp()
+	if v, ok := pricingPlanUsageCache.Load(userId); ok {
+		entry := v.(*pricingPlanUsageEntry)
+		if entry.month == month && now-entry.loadedAt < pricingPlanUsageCacheSeconds {
+			return entry.quota, entry.tokens
+		}
+	}
+	usage := &PricingPlanUsage{}
+	DB.Where("user_id = ? AND month = ?", userId, month).Limit(1).Find(usage)
+	pricingPlanUsageCache.Store(userId, &pricingPlanUsageEntry{month: month, quota: usage.Quota, tokens: usage.Tokens, loadedAt: now})
+	return usage.Quota, usage.Tokens
+}
+
+// GetPricingPlanAdjustment 返回用户本次请求适用的计划倍率，没有计划时返回 (1, nil)
+func GetPricingPlanAdjustment(userId int, group string, modelName string) (float64, *PricingPlanApplied) {
+	now := time.Now()
+	plan := findPricingPlan(userId, group, now.Unix())
+	if plan == nil {
+		return 1, nil
+	}
+	quota, tokens := getPricingPlanMonthUsage(userId, pricingPlanMonth(now))
+	usage := quota
+	if plan.Metric == PricingPlanMetricTokens {
+		usage = tokens
+	}
+	applied := plan.resolve(modelName, usage)
+	return applied.Ratio, applied
+}
+
+// RecordPricingPlanUsage 累计计划用户的月度用量
+func RecordPricingPlanUsage(userId int, quota int64, tokens int64) {
+	if quota == 0 && tokens == 0 {
+		return
+	}
+	usage := &PricingPlanUsage{UserId: userId, Month: pricingPlanMonth(time.Now()), Quota: quota, Tokens: tokens}
+	err := DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "month"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"quota":  gorm.Expr("quota + ?", quota),
+			"tokens": gorm.Expr("tokens + ?", tokens),
+		}),
+	}).Create(usage).Error
+	if err != nil {
+		logger.SysError("failed to record pricing plan usage: " + err.Error())
+		return
+	}
+	// 本机缓存同步累加，避免高频调用方在缓存有效期内一直停留在旧档位
+	if v, ok := pricingPlanUsageCache.Load(userId); ok {
+		entry := v.(*pricingPlanUsageEntry)
+		if entry.month == usage.Month {
+			pricingPlanUsageCache.Store(userId, &pricingPlanUsageEntry{
+				month:    entry.month,
+				quota:    entry.quota + quota,
+				tokens:   entry.tokens + tokens,
+				loadedAt: entry.loadedAt,
+			})
+		}
+	}
+}
+
+func GetPricingPlanUsages(userId int) ([]*PricingPlanUsage, error) {
+	var usages []*PricingPlanUsage
+	err := DB.Where("user_id = ?", userId).Order("month desc").Limit(12).Find(&usages).Error
+	return usages, err
+}
+
+// recordPricingPlanUsageFromContext 请求命中计划时累计月度用量，返回写入日志 Other 的 pricingPlan 段
+func recordPricingPlanUsageFromContext(ctx context.Context, userId int, quota int64, tokens int64) string {
+	applied, ok := ctx.Value(logger.PricingPlanCtxKey).(*PricingPlanApplied)
+	if !ok || applied == nil {
+		return ""
+	}
+	RecordPricingPlanUsage(userId, quota, tokens)
+	data, err := json.Marshal(applied)
+	if err != nil {
+		return ""
+	}
+	return "pricingPlan:" + string(data)
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+func TestPricingPlanTiersAndPrecedence(t *testing.T) {
+	setupTestDB(t, &PricingPlan{}, &PricingPlanUsage{})
+	InvalidatePricingPlanCache()
+	t.Cleanup(InvalidatePricingPlanCache)
+
+	now := time.Now().Unix()
+	groupPlan := &PricingPlan{
+		Name:        "vip 阶梯",
+		Scope:       PricingPlanScopeGroup,
+		TargetGroup: "vip",
+		Metric:      PricingPlanMetricTokens,
+		Tiers:       `[{"from":1000,"ratio":0.8},{"from":0,"ratio":1}]`,
+		StartTime:   now - 60,
+	}
+	if err := CreatePricingPlan(groupPlan); err != nil {
+		t.Fatalf("创建分组计划失败: %v", err)
+	}
+	if err := CreatePricingPlan(&PricingPlan{Scope: PricingPlanScopeUser, Metric: PricingPlanMetricQuota, Tiers: `[{"from":0,"ratio":0}]`}); err == nil {
+		t.Error("缺少 target_user_id 或倍率为 0 的计划应被拒绝")
+	}
+
+	ratio, applied := GetPricingPlanAdjustment(10, "vip", "gpt-test")
+	if ratio != 1 || applied == nil || applied.Tier != 0 {
+		t.Fatalf("用量为 0 时应命中第一档原价，实际 ratio=%v applied=%+v", ratio, applied)
+	}
+	if ratio, applied := GetPricingPlanAdjustment(10, "default", "gpt-test"); ratio != 1 || applied != nil {
+		t.Errorf("其他分组不应命中计划，实际 ratio=%v applied=%+v", ratio, applied)
+	}
+
+	ctx := context.WithValue(context.Background(), logger.PricingPlanCtxKey, applied)
+	segment := recordPricingPlanUsageFromContext(ctx, 10, 500, 1200)
+	if !strings.HasPrefix(segment, "pricingPlan:") {
+		t.Errorf("日志段格式不对: %s", segment)
+	}
+	if ratio, applied := GetPricingPlanAdjustment(10, "vip", "gpt-test"); ratio != 0.8 || applied.TierFrom != 1000 {
+		t.Errorf("累计 1200 tokens 后应进入 8 折档，实际 ratio=%v applied=%+v", ratio, applied)
+	}
+
+	userPlan := &PricingPlan{
+		Name:           "合同价",
+		Scope:          PricingPlanScopeUser,
+		TargetUserId:   10,
+		Metric:         PricingPlanMetricQuota,
+		ModelOverrides: `{"gpt-contract":0.5}`,
+		StartTime:      now - 60,
+		EndTime:        now + 3600,
+	}
+	if err := CreatePricingPlan(userPlan); err != nil {
+		t.Fatalf("创建用户计划失败: %v", err)
+	}
+	if ratio, applied := GetPricingPlanAdjustment(10, "vip", "gpt-contract"); ratio != 0.5 || !applied.ModelOverride || applied.PlanId != userPlan.Id {
+		t.Errorf("用户计划应优先于分组计划并命中合同价，实际 ratio=%v applied=%+v", ratio, applied)
+	}
+	if ratio, _ := GetPricingPlanAdjustment(10, "vip", "gpt-test"); ratio != 1 {
+		t.Errorf("用户计划没有阶梯时其他模型按原价，实际 %v", ratio)
+	}
+
+	userPlan.EndTime = now - 1
+	userPlan.StartTime = now - 120
+	if err := UpdatePricingPlan(userPlan); err != nil {
+		t.Fatalf("更新计划失败: %v", err)
+	}
+	if ratio, applied := GetPricingPlanAdjustment(10, "vip", "gpt-contract"); ratio != 0.8 || applied.PlanId != groupPlan.Id {
+		t.Errorf("用户计划过期后应回落到分组计划，实际 ratio=%v applied=%+v", ratio, applied)
+	}
+}
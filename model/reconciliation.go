@@ -0,0 +1,196 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ReconcileSourceOpenAI    = "openai"
+	ReconcileSourceAnthropic = "anthropic"
+	ReconcileSourceCustom    = "custom"
+	ReconcileSourceBalance   = "balance"
+
+	ReconcileStatusOk       = "ok"
+	ReconcileStatusDrift    = "drift"
+	ReconcileStatusError    = "error"
+	ReconcileStatusReviewed = "reviewed"
+
+	ReconcileBasisCost  = "cost"  // 渠道配置了上游成本，按日志中的 cost 比对
+	ReconcileBasisQuota = "quota" // 未配置成本，按售价额度比对
+)
+
+// Reconciliation 单个渠道在一个时间窗口内的对账结果，金额均为美元
+type Reconciliation struct {
+	Id          int    `json:"id"`
+	ChannelId   int    `json:"channel_id" gorm:"uniqueIndex:idx_reconcile_window"`
+	Source      string `json:"source" gorm:"type:varchar(16)"`
+	WindowStart int64  `json:"window_start" gorm:"bigint;uniqueIndex:idx_reconcile_window"`
+	WindowEnd   int64  `json:"window_end" gorm:"bigint"`
+	// UpstreamBalance 仅 balance 数据源记录，作为下一窗口求差的基线
+	UpstreamUsage   float64 `json:"upstream_usage"`
+	UpstreamBalance float64 `json:"upstream_balance"`
+	LocalQuota      int64   `json:"local_quota"`
+	LocalCost       int64   `json:"local_cost"`
+	Basis           string  `json:"basis" gorm:"type:varchar(16)"`
+	LocalUsage      float64 `json:"local_usage"`
+	Drift           float64 `json:"drift"` // 上游 - 本地
+	DriftPercent    float64 `json:"drift_percent"`
+	Status          string  `json:"status" gorm:"type:varchar(16);index"`
+	Message         string  `json:"message" gorm:"type:text"`
+	KeyDetails      string  `json:"key_details" gorm:"type:text"` // JSON []ReconcileKeyDetail，多 Key 渠道逐 Key 的上游数据
+	ReviewerId      int     `json:"reviewer_id"`
+	ReviewNote      string  `json:"review_note" gorm:"type:text"`
+	ReviewedTime    int64   `json:"reviewed_time" gorm:"bigint"`
+	CreatedTime     int64   `json:"created_time" gorm:"bigint"`
+}
+
+type ReconcileKeyDetail struct {
+	KeyIndex int      `json:"key_index"`
+	Usage    float64  `json:"usage"`
+	Balance  *float64 `json:"balance,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// GetChannelLocalUsage 渠道在 [start, end) 内消费日志的售价额度与上游成本合计
+func GetChannelLocalUsage(channelId int, start, end int64) (quota int64, cost int64, err error) {
+	var result struct {
+		Quota int64
+		Cost  int64
+	}
+	err = LOG_DB.Model(&Log{}).Select("COALESCE(SUM(quota), 0) AS quota, COALESCE(SUM(cost), 0) AS cost").
+		Where("type = ? AND channel_id = ? AND created_at >= ? AND created_at < ?", LogTypeConsume, channelId, start, end).
+		Scan(&result).Error
+	return result.Quota, result.Cost, err
+}
+
+// GetLastReconciliation 渠道最近一次成功取到上游数据的对账记录，没有时返回 nil
+func GetLastReconciliation(channelId int) *Reconciliation {
+	record := &Reconciliation{}
+	err := DB.Where("channel_id = ? AND status <> ?", channelId, ReconcileStatusError).
+		Order("window_end desc").Limit(1).Find(record).Error
+	if err != nil || record.Id == 0 {
+		return nil
+	}
+	return record
+}
+
+// IsReconciliationDone 窗口是否已成功对账。取数失败（error）的窗口会在下一轮重试
+func IsReconciliationDone(channelId int, windowStart int64) bool {
+	var count int64
+	DB.Model(&Reconciliation{}).Where("channel_id = ? AND window_start = ? AND status <> ?", channelId, windowStart, ReconcileStatusError).Count(&count)
+	return count > 0
+}
+
+// evaluate 汇总本地日志并计算偏差。偏差同时超过百分比与绝对金额阈值才标记为 drift，避免小额噪声
+func (record *Reconciliation) evaluate(hasCostModel bool) error {
+	quota, cost, err := GetChannelLocalUsage(record.ChannelId, record.WindowStart, record.WindowEnd)
+	if err != nil {
+		return err
+	}
+	record.LocalQuota, record.LocalCost = quota, cost
+	record.Basis = ReconcileBasisQuota
+	local := quota
+	if hasCostModel {
+		record.Basis = ReconcileBasisCost
+		local = cost
+	}
+	record.LocalUsage = math.Round(float64(local)/config.QuotaPerUnit*1000000) / 1000000
+	record.Drift = math.Round((record.UpstreamUsage-record.LocalUsage)*1000000) / 1000000
+	if base := math.Max(record.UpstreamUsage, record.LocalUsage); base > 0 {
+		record.DriftPercent = math.Round(math.Abs(record.Drift)/base*10000) / 100
+	}
+	record.Status = ReconcileStatusOk
+	if math.Abs(record.Drift) >= config.ReconcileDriftMinUSD && record.DriftPercent >= config.ReconcileDriftPercent {
+		record.Status = ReconcileStatusDrift
+	}
+	return nil
+}
+
+var notifyReconcileDrift = sendReconcileDriftAlert
+
+// SaveReconciliation 保存对账结果。status 为空时按本地日志计算偏差；同一渠道同一窗口只保存一次，
+// 返回 false 表示该窗口已由其他节点或上一次运行处理。该窗口此前取数失败的记录会被本次结果替换
+func SaveReconciliation(record *Reconciliation) (bool, error) {
+	if record.Status == "" {
+		costs, err := GetChannelCosts(record.ChannelId)
+		if err != nil {
+			return false, err
+		}
+		if err := record.evaluate(len(costs) > 0); err != nil {
+			return false, err
+		}
+	}
+	record.CreatedTime = helper.GetTimestamp()
+	err := DB.Where("channel_id = ? AND window_start = ? AND status = ?", record.ChannelId, record.WindowStart, ReconcileStatusError).
+		Delete(&Reconciliation{}).Error
+	if err != nil {
+		return false, err
+	}
+	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	if record.Status == ReconcileStatusDrift {
+		go notifyReconcileDrift(record)
+	}
+	return true, nil
+}
+
+func sendReconcileDriftAlert(record *Reconciliation) {
+	subject := fmt.Sprintf("渠道 #%d 上游账单与本地日志不一致", record.ChannelId)
+	basis := "售价"
+	if record.Basis == ReconcileBasisCost {
+		basis = "成本"
+	}
+	content := fmt.Sprintf("渠道 #%d 在 %s ~ %s 的上游用量为 $%.4f（%s），本地日志按%s计为 $%.4f，偏差 $%.4f（%.2f%%），请在对账记录中核对。",
+		record.ChannelId, time.Unix(record.WindowStart, 0).Format("2006-01-02 15:04"), time.Unix(record.WindowEnd, 0).Format("2006-01-02 15:04"),
+		record.UpstreamUsage, record.Source, basis,
+		record.LocalUsage, record.Drift, record.DriftPercent)
+	logger.SysLog(subject + ": " + content)
+	if err := message.Notify(message.ByEmail, subject, "", content); err != nil {
+		logger.SysError("failed to notify admin of reconciliation drift: " + err.Error())
+	}
+}
+
+func GetReconciliations(channelId int, status string, startIdx int, num int) ([]*Reconciliation, int64, error) {
+	var records []*Reconciliation
+	var total int64
+	tx := DB.Model(&Reconciliation{})
+	if channelId > 0 {
+		tx = tx.Where("channel_id = ?", channelId)
+	}
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := tx.Order("id desc").Limit(num).Offset(startIdx).Find(&records).Error
+	return records, total, err
+}
+
+// ReviewReconciliation 管理员核对偏差后标记为已处理
+func ReviewReconciliation(id int, reviewerId int, note string) error {
+	result := DB.Model(&Reconciliation{}).Where("id = ? AND status = ?", id, ReconcileStatusDrift).Updates(map[string]interface{}{
+		"status":        ReconcileStatusReviewed,
+		"reviewer_id":   reviewerId,
+		"review_note":   note,
+		"reviewed_time": helper.GetTimestamp(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("对账记录不存在或无需处理")
+	}
+	return nil
+}
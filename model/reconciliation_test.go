@@ -0,0 +1,129 @@
+package model
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestReconciliationDriftAndReview(t *testing.T) {
+	setupTestDB(t, &Log{}, &ChannelCost{}, &Reconciliation{})
+	origLogDB, origRedis := LOG_DB, common.RedisEnabled
+	LOG_DB, common.RedisEnabled = DB, false
+	var wg sync.WaitGroup
+	var notified []int
+	notifyReconcileDrift = func(record *Reconciliation) {
+		defer wg.Done()
+		notified = append(notified, record.ChannelId)
+	}
+	t.Cleanup(func() {
+		LOG_DB, common.RedisEnabled = origLogDB, origRedis
+		notifyReconcileDrift = sendReconcileDriftAlert
+	})
+
+	// 渠道 1 当天售出 $10，其中一条日志落在窗口外
+	perUSD := int(config.QuotaPerUnit)
+	DB.Create(&Log{Type: LogTypeConsume, ChannelId: 1, CreatedAt: 1000, Quota: 6 * perUSD})
+	DB.Create(&Log{Type: LogTypeConsume, ChannelId: 1, CreatedAt: 2000, Quota: 4 * perUSD})
+	DB.Create(&Log{Type: LogTypeConsume, ChannelId: 1, CreatedAt: 5000, Quota: 100 * perUSD})
+	DB.Create(&Log{Type: LogTypeError, ChannelId: 1, CreatedAt: 1500, Quota: 100 * perUSD})
+
+	within := &Reconciliation{ChannelId: 1, Source: ReconcileSourceOpenAI, WindowStart: 0, WindowEnd: 3000, UpstreamUsage: 10.3}
+	if saved, err := SaveReconciliation(within); err != nil || !saved {
+		t.Fatalf("保存对账结果失败: %v", err)
+	}
+	if within.Basis != ReconcileBasisQuota || within.LocalUsage != 10 || within.Status != ReconcileStatusOk {
+		t.Errorf("偏差 $0.3 未超过绝对阈值应为 ok: %+v", within)
+	}
+	if saved, _ := SaveReconciliation(&Reconciliation{ChannelId: 1, WindowStart: 0, WindowEnd: 3000, UpstreamUsage: 99}); saved {
+		t.Error("同一窗口不应重复保存")
+	}
+
+	// 配置成本后按 cost 比对：本地成本 $4，上游 $5，偏差 $1（20%）超过阈值
+	DB.Create(&ChannelCost{ChannelId: 2, Mode: ChannelCostModePercent, ListPercent: 50})
+	DB.Create(&Log{Type: LogTypeConsume, ChannelId: 2, CreatedAt: 1000, Quota: 8 * perUSD, Cost: 4 * perUSD})
+	wg.Add(1)
+	drift := &Reconciliation{ChannelId: 2, Source: ReconcileSourceCustom, WindowStart: 0, WindowEnd: 3000, UpstreamUsage: 5}
+	if _, err := SaveReconciliation(drift); err != nil {
+		t.Fatalf("保存对账结果失败: %v", err)
+	}
+	wg.Wait()
+	if drift.Basis != ReconcileBasisCost || drift.Drift != 1 || drift.DriftPercent != 20 || drift.Status != ReconcileStatusDrift {
+		t.Fatalf("应按成本比对并标记偏差: %+v", drift)
+	}
+	if len(notified) != 1 || notified[0] != 2 {
+		t.Errorf("偏差应通知一次，实际 %v", notified)
+	}
+
+	if err := ReviewReconciliation(within.Id, 1, ""); err == nil {
+		t.Error("没有偏差的记录无需核对")
+	}
+	if err := ReviewReconciliation(drift.Id, 1, "上游多计了一笔测试请求"); err != nil {
+		t.Fatalf("核对失败: %v", err)
+	}
+	records, total, err := GetReconciliations(0, ReconcileStatusReviewed, 0, 10)
+	if err != nil || total != 1 || records[0].ReviewNote == "" {
+		t.Fatalf("应能按状态查到已核对记录: %+v %v", records, err)
+	}
+	if last := GetLastReconciliation(1); last == nil || last.Id != within.Id {
+		t.Errorf("最近一次对账记录不对: %+v", last)
+	}
+}
+
+func TestReconciliationRetriesFailedWindow(t *testing.T) {
+	setupTestDB(t, &Log{}, &ChannelCost{}, &Reconciliation{})
+	origLogDB := LOG_DB
+	LOG_DB = DB
+	t.Cleanup(func() { LOG_DB = origLogDB })
+
+	failed := &Reconciliation{ChannelId: 3, Source: ReconcileSourceOpenAI, WindowStart: 0, WindowEnd: 3000,
+		Status: ReconcileStatusError, Message: "key#0: timeout"}
+	if saved, err := SaveReconciliation(failed); err != nil || !saved {
+		t.Fatalf("保存失败记录失败: %v", err)
+	}
+	if IsReconciliationDone(3, 0) {
+		t.Fatal("取数失败的窗口应允许重试")
+	}
+	retry := &Reconciliation{ChannelId: 3, Source: ReconcileSourceOpenAI, WindowStart: 0, WindowEnd: 3000}
+	if saved, err := SaveReconciliation(retry); err != nil || !saved || retry.Status != ReconcileStatusOk {
+		t.Fatalf("重试结果应替换失败记录: saved=%v err=%v %+v", saved, err, retry)
+	}
+	var count int64
+	DB.Model(&Reconciliation{}).Where("channel_id = ?", 3).Count(&count)
+	if !IsReconciliationDone(3, 0) || count != 1 {
+		t.Errorf("重试成功后窗口应只保留一条已完成记录，实际 %d 条", count)
+	}
+}
+
+func TestUpdateKeyBalancesMergesIntoLatest(t *testing.T) {
+	setupTestDB(t, &Channel{})
+	channel := &Channel{Id: 1, Name: "multi", Key: "k0\nk1", MultiKeyInfo: MultiKeyInfo{IsMultiKey: true, KeyCount: 2}}
+	if err := DB.Create(channel).Error; err != nil {
+		t.Fatalf("创建渠道失败: %v", err)
+	}
+	stale := *channel
+
+	// 对账取余额期间，Key 1 因错误被禁用
+	reason := "quota exceeded"
+	latest := &Channel{}
+	DB.First(latest, 1)
+	latest.MultiKeyInfo.KeyMetadata = map[int]KeyMetadata{1: {DisabledReason: &reason, Usage: 9}}
+	if err := latest.saveMultiKeyInfo(); err != nil {
+		t.Fatalf("保存 Key 状态失败: %v", err)
+	}
+
+	if err := stale.UpdateKeyBalances(map[int]float64{0: 12.5, 1: 0.5}); err != nil {
+		t.Fatalf("写入余额失败: %v", err)
+	}
+	saved := &Channel{}
+	DB.First(saved, 1)
+	key1 := saved.MultiKeyInfo.KeyMetadata[1]
+	if saved.MultiKeyInfo.KeyMetadata[0].Balance != 12.5 || key1.Balance != 0.5 {
+		t.Errorf("余额应写入: %+v", saved.MultiKeyInfo.KeyMetadata)
+	}
+	if key1.DisabledReason == nil || *key1.DisabledReason != reason || key1.Usage != 9 {
+		t.Errorf("期间的 Key 状态变更不应被旧快照覆盖: %+v", key1)
+	}
+}
@@ -2,11 +2,6 @@ package model
 
 import (
 	"errors"
-	"fmt"
-
-	"github.com/songquanpeng/one-api/common"
-	"github.com/songquanpeng/one-api/common/helper"
-	"gorm.io/gorm"
 )
 
 type Redemption struct {
@@ -19,6 +14,11 @@ type Redemption struct {
 	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
 	RedeemedTime int64  `json:"redeemed_time" gorm:"bigint"`
 	Count        int    `json:"count" gorm:"-:all"` // only for api request
+	// CampaignId 所属活动，0 表示不属于任何活动的普通兑换码
+	CampaignId  int   `json:"campaign_id" gorm:"index;default:0"`
+	MaxUses     int   `json:"max_uses" gorm:"default:1"` // 可被兑换的总次数，每个用户最多兑换一次
+	UsedCount   int   `json:"used_count" gorm:"default:0"`
+	ExpiredTime int64 `json:"expired_time" gorm:"bigint;default:0"` // 0 表示不过期
 }
 
 func GetAllRedemptions(startIdx int, num int) ([]*Redemption, error) {
@@ -96,41 +96,16 @@ func GetRedemptionById(id int) (*Redemption, error) {
 }
 
 func Redeem(key string, userId int) (quota int64, err error) {
-	if key == "" {
-		return 0, errors.New("未提供兑换码")
-	}
-	if userId == 0 {
-		return 0, errors.New("无效的 user id")
-	}
-	redemption := &Redemption{}
-
-	keyCol := "`key`"
-	if common.UsingPostgreSQL {
-		keyCol = `"key"`
-	}
+	return RedeemToOrganization(key, userId, 0)
+}
 
-	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(keyCol+" = ?", key).First(redemption).Error
-		if err != nil {
-			return errors.New("无效的兑换码")
-		}
-		if redemption.Status != common.RedemptionCodeStatusEnabled {
-			return errors.New("该兑换码已被使用")
-		}
-		err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
-		if err != nil {
-			return err
-		}
-		redemption.RedeemedTime = helper.GetTimestamp()
-		redemption.Status = common.RedemptionCodeStatusUsed
-		err = tx.Save(redemption).Error
-		return err
-	})
+// RedeemToOrganization 使用兑换码充值；orgId 非 0 时额度记入组织额度池
+func RedeemToOrganization(key string, userId int, orgId int) (quota int64, err error) {
+	result, err := RedeemCode(key, userId, orgId, "")
 	if err != nil {
-		return 0, errors.New("兑换失败，" + err.Error())
+		return 0, err
 	}
-	RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s", common.LogQuota(redemption.Quota)))
-	return redemption.Quota, nil
+	return result.Quota, nil
 }
 
 func (redemption *Redemption) Insert() error {
@@ -0,0 +1,580 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	RedemptionRewardQuota       = "quota"        // 充值额度，数量取兑换码的 Quota
+	RedemptionRewardGroup       = "group"        // 升级到指定分组
+	RedemptionRewardModelCredit = "model_credit" // 发放仅限指定模型使用的额度
+)
+
+// 兑换失败原因，写入 RedemptionLog.Reason
+const (
+	RedeemFailInvalidCode   = "invalid_code"
+	RedeemFailDisabled      = "disabled"
+	RedeemFailUsed          = "used_up"
+	RedeemFailExpired       = "expired"
+	RedeemFailNotStarted    = "not_started"
+	RedeemFailUserLimit     = "user_limit"
+	RedeemFailNotNewUser    = "not_new_user"
+	RedeemFailGroup         = "group_not_allowed"
+	RedeemFailOrgNotAllowed = "org_not_allowed"
+	RedeemFailInternal      = "internal_error"
+)
+
+// RedemptionCampaign 兑换码活动：统一约束一批兑换码的有效期、领取条件和奖励类型
+type RedemptionCampaign struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64)"`
+	Description string `json:"description" gorm:"type:varchar(255)"`
+	RewardType  string `json:"reward_type" gorm:"type:varchar(16);default:'quota'"`
+	RewardGroup string `json:"reward_group" gorm:"type:varchar(32)"`
+	// ModelCredits JSON：模型名 -> 额度，RewardType 为 model_credit 时使用
+	ModelCredits string `json:"model_credits" gorm:"type:text"`
+	StartTime    int64  `json:"start_time" gorm:"bigint;default:0"`
+	EndTime      int64  `json:"end_time" gorm:"bigint;default:0"` // 0 表示不限
+	// PerUserLimit 每个用户在本活动中最多兑换几次，0 表示不限
+	PerUserLimit int `json:"per_user_limit" gorm:"default:1"`
+	// NewUserDays 大于 0 时只允许注册不超过该天数的用户兑换
+	NewUserDays int `json:"new_user_days" gorm:"default:0"`
+	// AllowedGroups 逗号分隔，非空时只允许这些分组的用户兑换
+	AllowedGroups string `json:"allowed_groups" gorm:"type:varchar(255)"`
+	Status        int    `json:"status" gorm:"default:1"`
+	CreatedBy     int    `json:"created_by"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+
+	modelCredits map[string]int64
+}
+
+// RedemptionLog 每次兑换尝试的记录，失败时记录原因
+type RedemptionLog struct {
+	Id           int    `json:"id"`
+	RedemptionId int    `json:"redemption_id" gorm:"index"`
+	CampaignId   int    `json:"campaign_id" gorm:"index"`
+	KeyPrefix    string `json:"key_prefix" gorm:"type:varchar(8)"` // 只保留前 8 位，避免日志泄露完整兑换码
+	UserId       int    `json:"user_id" gorm:"index"`
+	OrgId        int    `json:"org_id"`
+	Success      bool   `json:"success"`
+	Reason       string `json:"reason" gorm:"type:varchar(32)"`
+	Reward       string `json:"reward" gorm:"type:varchar(255)"`
+	Ip           string `json:"ip" gorm:"type:varchar(64)"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint;index"`
+}
+
+// ModelCredit 仅限某个模型使用的额度，结算时优先抵扣
+type ModelCredit struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex:idx_model_credit"`
+	ModelName   string `json:"model_name" gorm:"type:varchar(128);uniqueIndex:idx_model_credit"`
+	Quota       int64  `json:"quota" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// RedeemResult 兑换结果
+type RedeemResult struct {
+	RewardType   string           `json:"reward_type"`
+	Quota        int64            `json:"quota,omitempty"`
+	Group        string           `json:"group,omitempty"`
+	ModelCredits map[string]int64 `json:"model_credits,omitempty"`
+}
+
+func (r *RedeemResult) String() string {
+	switch r.RewardType {
+	case RedemptionRewardGroup:
+		return "group:" + r.Group
+	case RedemptionRewardModelCredit:
+		data, _ := json.Marshal(r.ModelCredits)
+		return "model_credit:" + string(data)
+	default:
+		return fmt.Sprintf("quota:%d", r.Quota)
+	}
+}
+
+type redeemError struct {
+	reason  string
+	message string
+}
+
+func (e *redeemError) Error() string {
+	return e.message
+}
+
+func (campaign *RedemptionCampaign) Validate() error {
+	if campaign.Name == "" || len(campaign.Name) > 64 {
+		return errors.New("name length must be between 1 and 64")
+	}
+	if campaign.EndTime != 0 && campaign.EndTime <= campaign.StartTime {
+		return errors.New("end_time must be after start_time")
+	}
+	if campaign.PerUserLimit < 0 || campaign.NewUserDays < 0 {
+		return errors.New("per_user_limit and new_user_days must be >= 0")
+	}
+	campaign.modelCredits = nil
+	switch campaign.RewardType {
+	case "", RedemptionRewardQuota:
+		campaign.RewardType = RedemptionRewardQuota
+	case RedemptionRewardGroup:
+		if _, ok := common.GroupRatio[campaign.RewardGroup]; !ok {
+			return errors.New("unknown reward_group: " + campaign.RewardGroup)
+		}
+	case RedemptionRewardModelCredit:
+		if err := json.Unmarshal([]byte(campaign.ModelCredits), &campaign.modelCredits); err != nil || len(campaign.modelCredits) == 0 {
+			return errors.New("model_credits must be a non-empty JSON object of model -> quota")
+		}
+		for _, quota := range campaign.modelCredits {
+			if quota <= 0 {
+				return errors.New("model credit must be > 0")
+			}
+		}
+	default:
+		return errors.New("reward_type must be quota, group or model_credit")
+	}
+	return nil
+}
+
+func CreateRedemptionCampaign(campaign *RedemptionCampaign) error {
+	if err := campaign.Validate(); err != nil {
+		return err
+	}
+	campaign.CreatedTime = helper.GetTimestamp()
+	return DB.Create(campaign).Error
+}
+
+func UpdateRedemptionCampaign(campaign *RedemptionCampaign) error {
+	if err := campaign.Validate(); err != nil {
+		return err
+	}
+	return DB.Model(campaign).Select("name", "description", "reward_type", "reward_group", "model_credits",
+		"start_time", "end_time", "per_user_limit", "new_user_days", "allowed_groups", "status").Updates(campaign).Error
+}
+
+func GetRedemptionCampaignById(id int) (*RedemptionCampaign, error) {
+	campaign := &RedemptionCampaign{}
+	err := DB.First(campaign, id).Error
+	return campaign, err
+}
+
+func GetRedemptionCampaigns(page int, pageSize int) (campaigns []*RedemptionCampaign, total int64, err error) {
+	if err = DB.Model(&RedemptionCampaign{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("id desc").Limit(pageSize).Offset((page - 1) * pageSize).Find(&campaigns).Error
+	return campaigns, total, err
+}
+
+// GenerateCampaignRedemptions 为活动批量生成兑换码
+func GenerateCampaignRedemptions(campaign *RedemptionCampaign, count int, quota int64, maxUses int, expiredTime int64, userId int) ([]*Redemption, error) {
+	if count <= 0 || count > 1000 {
+		return nil, errors.New("count must be between 1 and 1000")
+	}
+	if maxUses <= 0 {
+		maxUses = 1
+	}
+	if campaign.RewardType == RedemptionRewardQuota && quota <= 0 {
+		return nil, errors.New("quota must be > 0 for quota campaigns")
+	}
+	now := helper.GetTimestamp()
+	redemptions := make([]*Redemption, 0, count)
+	for i := 0; i < count; i++ {
+		redemptions = append(redemptions, &Redemption{
+			UserId:      userId,
+			Name:        campaign.Name,
+			Key:         helper.GetUUID(),
+			Status:      common.RedemptionCodeStatusEnabled,
+			Quota:       quota,
+			CreatedTime: now,
+			CampaignId:  campaign.Id,
+			MaxUses:     maxUses,
+			ExpiredTime: expiredTime,
+		})
+	}
+	if err := DB.CreateInBatches(redemptions, 100).Error; err != nil {
+		return nil, err
+	}
+	return redemptions, nil
+}
+
+func GetCampaignRedemptions(campaignId int) ([]*Redemption, error) {
+	var redemptions []*Redemption
+	err := DB.Where("campaign_id = ?", campaignId).Order("id asc").Find(&redemptions).Error
+	return redemptions, err
+}
+
+// RedemptionCampaignStats 活动统计
+type RedemptionCampaignStats struct {
+	Codes          int64            `json:"codes"`
+	Redemptions    int64            `json:"redemptions"`
+	UniqueUsers    int64            `json:"unique_users"`
+	QuotaGranted   int64            `json:"quota_granted"`
+	FailureReasons map[string]int64 `json:"failure_reasons"`
+}
+
+func GetRedemptionCampaignStats(campaignId int) (*RedemptionCampaignStats, error) {
+	stats := &RedemptionCampaignStats{FailureReasons: map[string]int64{}}
+	if err := DB.Model(&Redemption{}).Where("campaign_id = ?", campaignId).Count(&stats.Codes).Error; err != nil {
+		return nil, err
+	}
+	success := DB.Model(&RedemptionLog{}).Where("campaign_id = ? AND success = ?", campaignId, true)
+	if err := success.Count(&stats.Redemptions).Error; err != nil {
+		return nil, err
+	}
+	DB.Model(&RedemptionLog{}).Where("campaign_id = ? AND success = ?", campaignId, true).
+		Distinct("user_id").Count(&stats.UniqueUsers)
+	DB.Table("redemption_logs").Joins("JOIN redemptions ON redemptions.id = redemption_logs.redemption_id").
+		Where("redemption_logs.campaign_id = ? AND redemption_logs.success = ?", campaignId, true).
+		Select("COALESCE(SUM(redemptions.quota), 0)").Scan(&stats.QuotaGranted)
+	var reasons []struct {
+		Reason string
+		Count  int64
+	}
+	DB.Model(&RedemptionLog{}).Where("campaign_id = ? AND success = ?", campaignId, false).
+		Select("reason, count(*) as count").Group("reason").Scan(&reasons)
+	for _, r := range reasons {
+		stats.FailureReasons[r.Reason] = r.Count
+	}
+	return stats, nil
+}
+
+func GetRedemptionLogs(campaignId int, userId int, page int, pageSize int) (logs []*RedemptionLog, total int64, err error) {
+	tx := DB.Model(&RedemptionLog{})
+	if campaignId != 0 {
+		tx = tx.Where("campaign_id = ?", campaignId)
+	}
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(pageSize).Offset((page - 1) * pageSize).Find(&logs).Error
+	return logs, total, err
+}
+
+func checkCampaignEligibility(tx *gorm.DB, campaign *RedemptionCampaign, userId int, orgId int, now int64) error {
+	if campaign.Status != common.RedemptionCodeStatusEnabled {
+		return &redeemError{RedeemFailDisabled, "该兑换活动已停用"}
+	}
+	if campaign.StartTime > now {
+		return &redeemError{RedeemFailNotStarted, "该兑换活动尚未开始"}
+	}
+	if campaign.EndTime != 0 && campaign.EndTime <= now {
+		return &redeemError{RedeemFailExpired, "该兑换活动已结束"}
+	}
+	if orgId > 0 && campaign.RewardType != RedemptionRewardQuota {
+		return &redeemError{RedeemFailOrgNotAllowed, "该兑换码不能用于组织"}
+	}
+	if campaign.NewUserDays > 0 || campaign.AllowedGroups != "" {
+		user := &User{}
+		if err := tx.Select("id", "group", "created_time").Where("id = ?", userId).First(user).Error; err != nil {
+			return err
+		}
+		if campaign.NewUserDays > 0 && (user.CreatedTime == 0 || now-user.CreatedTime > int64(campaign.NewUserDays)*86400) {
+			return &redeemError{RedeemFailNotNewUser, "该兑换码仅限新用户使用"}
+		}
+		if campaign.AllowedGroups != "" {
+			allowed := false
+			for _, group := range strings.Split(campaign.AllowedGroups, ",") {
+				if strings.TrimSpace(group) == user.Group {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return &redeemError{RedeemFailGroup, "当前分组不能使用该兑换码"}
+			}
+		}
+	}
+	if campaign.PerUserLimit > 0 {
+		var used int64
+		tx.Model(&RedemptionLog{}).Where("campaign_id = ? AND user_id = ? AND success = ?", campaign.Id, userId, true).Count(&used)
+		if used >= int64(campaign.PerUserLimit) {
+			return &redeemError{RedeemFailUserLimit, "已达到该活动的兑换次数上限"}
+		}
+	}
+	return nil
+}
+
+// RedeemCode 兑换并记录本次尝试。活动兑换码按活动的条件与奖励类型处理，普通兑换码直接充值额度。
+func RedeemCode(key string, userId int, orgId int, ip string) (*RedeemResult, error) {
+	if key == "" {
+		return nil, errors.New("未提供兑换码")
+	}
+	if userId == 0 {
+		return nil, errors.New("无效的 user id")
+	}
+	redemption := &Redemption{}
+	campaign := &RedemptionCampaign{}
+	result := &RedeemResult{RewardType: RedemptionRewardQuota}
+
+	keyCol := "`key`"
+	if common.UsingPostgreSQL {
+		keyCol = `"key"`
+	}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(keyCol+" = ?", key).First(redemption).Error
+		if err != nil {
+			return &redeemError{RedeemFailInvalidCode, "无效的兑换码"}
+		}
+		now := helper.GetTimestamp()
+		switch redemption.Status {
+		case common.RedemptionCodeStatusEnabled:
+		case common.RedemptionCodeStatusUsed:
+			return &redeemError{RedeemFailUsed, "该兑换码已被使用"}
+		default:
+			return &redeemError{RedeemFailDisabled, "该兑换码已停用"}
+		}
+		if redemption.ExpiredTime != 0 && redemption.ExpiredTime <= now {
+			return &redeemError{RedeemFailExpired, "该兑换码已过期"}
+		}
+		maxUses := redemption.MaxUses
+		if maxUses <= 0 {
+			maxUses = 1
+		}
+		if redemption.UsedCount >= maxUses {
+			return &redeemError{RedeemFailUsed, "该兑换码已被使用"}
+		}
+		if redemption.CampaignId != 0 {
+			// 锁住活动行，使同一用户并发兑换同一活动的不同兑换码时按顺序校验次数上限。
+			// 加锁须在下面的次数统计之前，统计才能读到先持锁者已提交的兑换记录
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(campaign, redemption.CampaignId).Error; err != nil {
+				return &redeemError{RedeemFailDisabled, "该兑换活动不存在"}
+			}
+		}
+		if maxUses > 1 {
+			var used int64
+			tx.Model(&RedemptionLog{}).Where("redemption_id = ? AND user_id = ? AND success = ?", redemption.Id, userId, true).Count(&used)
+			if used > 0 {
+				return &redeemError{RedeemFailUserLimit, "你已兑换过该兑换码"}
+			}
+		}
+
+		if redemption.CampaignId != 0 {
+			if err := checkCampaignEligibility(tx, campaign, userId, orgId, now); err != nil {
+				return err
+			}
+			if err := campaign.Validate(); err != nil {
+				return err
+			}
+			result.RewardType = campaign.RewardType
+		}
+
+		switch result.RewardType {
+		case RedemptionRewardGroup:
+			result.Group = campaign.RewardGroup
+			err = tx.Model(&User{}).Where("id = ?", userId).Update("group", campaign.RewardGroup).Error
+		case RedemptionRewardModelCredit:
+			result.ModelCredits = campaign.modelCredits
+			for modelName, quota := range campaign.modelCredits {
+				if err = addModelCredit(tx, userId, modelName, quota); err != nil {
+					break
+				}
+			}
+		default:
+			result.Quota = redemption.Quota
+			if orgId > 0 {
+				err = tx.Model(&Organization{}).Where("id = ?", orgId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
+			} else {
+				err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		// 次数在库内原子累加，并发兑换时只有未超出上限的那些能成功
+		updated := tx.Model(&Redemption{}).
+			Where("id = ? AND status = ? AND used_count < ?", redemption.Id, common.RedemptionCodeStatusEnabled, maxUses).
+			Updates(map[string]interface{}{"used_count": gorm.Expr("used_count + 1"), "redeemed_time": now})
+		if updated.Error != nil {
+			return updated.Error
+		}
+		if updated.RowsAffected == 0 {
+			return &redeemError{RedeemFailUsed, "该兑换码已被使用"}
+		}
+		err = tx.Model(&Redemption{}).Where("id = ? AND used_count >= ?", redemption.Id, maxUses).
+			Update("status", common.RedemptionCodeStatusUsed).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(newRedemptionLog(redemption, key, userId, orgId, ip, true, "", result.String())).Error
+	})
+	if err != nil {
+		reason := RedeemFailInternal
+		var rerr *redeemError
+		if errors.As(err, &rerr) {
+			reason = rerr.reason
+		}
+		if logErr := DB.Create(newRedemptionLog(redemption, key, userId, orgId, ip, false, reason, "")).Error; logErr != nil {
+			logger.SysError("failed to record redemption attempt: " + logErr.Error())
+		}
+		return nil, errors.New("兑换失败，" + err.Error())
+	}
+
+	switch {
+	case result.RewardType == RedemptionRewardGroup:
+		if common.RedisEnabled {
+			_ = common.RedisDel(fmt.Sprintf("user_group:%d", userId))
+		}
+		RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码升级到分组 %s", result.Group))
+	case result.RewardType == RedemptionRewardModelCredit:
+		invalidateModelCredit(userId)
+		RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码获得模型专用额度 %s", result.String()))
+	case orgId > 0:
+		RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码为组织 #%d 充值 %s", orgId, common.LogQuota(result.Quota)))
+	default:
+		RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s", common.LogQuota(result.Quota)))
+	}
+	return result, nil
+}
+
+func newRedemptionLog(redemption *Redemption, key string, userId int, orgId int, ip string, success bool, reason string, reward string) *RedemptionLog {
+	prefix := key
+	if len(prefix) > 8 {
+		prefix = prefix[:8]
+	}
+	return &RedemptionLog{
+		RedemptionId: redemption.Id,
+		CampaignId:   redemption.CampaignId,
+		KeyPrefix:    prefix,
+		UserId:       userId,
+		OrgId:        orgId,
+		Success:      success,
+		Reason:       reason,
+		Reward:       reward,
+		Ip:           ip,
+		CreatedTime:  helper.GetTimestamp(),
+	}
+}
+
+func addModelCredit(tx *gorm.DB, userId int, modelName string, quota int64) error {
+	credit := &ModelCredit{UserId: userId, ModelName: modelName, Quota: quota, UpdatedTime: helper.GetTimestamp()}
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "model_name"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"quota":        gorm.Expr("quota + ?", quota),
+			"updated_time": credit.UpdatedTime,
+		}),
+	}).Create(credit).Error
+}
+
+func GetUserModelCredits(userId int) ([]*ModelCredit, error) {
+	var credits []*ModelCredit
+	err := DB.Where("user_id = ? AND quota > 0", userId).Order("model_name").Find(&credits).Error
+	return credits, err
+}
+
+// 是否持有模型专用额度的缓存秒数。缓存放在 Redis，兑换与抵扣时删除，所有节点看到同一份
+const modelCreditCacheSeconds = 60
+
+type modelCreditCtxKey struct{}
+
+func invalidateModelCredit(userId int) {
+	if !common.RedisEnabled {
+		return
+	}
+	if err := common.RedisDel(fmt.Sprintf("model_credit:%d", userId)); err != nil {
+		logger.SysError("Redis delete model credit error: " + err.Error())
+	}
+}
+
+func hasModelCredits(userId int) bool {
+	var count int64
+	DB.Model(&ModelCredit{}).Where("user_id = ? AND quota > 0", userId).Count(&count)
+	return count > 0
+}
+
+// cacheHasModelCredits 未开 Redis 时直接查表，不做进程内缓存，避免其他节点兑换的额度迟迟不生效
+func cacheHasModelCredits(userId int) bool {
+	if !common.RedisEnabled {
+		return hasModelCredits(userId)
+	}
+	key := fmt.Sprintf("model_credit:%d", userId)
+	if v, err := common.RedisGet(key); err == nil {
+		return v == "1"
+	}
+	has := hasModelCredits(userId)
+	value := "0"
+	if has {
+		value = "1"
+	}
+	if err := common.RedisSet(key, value, time.Duration(modelCreditCacheSeconds)*time.Second); err != nil {
+		logger.SysError("Redis set model credit error: " + err.Error())
+	}
+	return has
+}
+
+// applyModelCredit 用模型专用额度抵扣本次消费：扣减专用额度并把相同数量退回用户余额，
+// 返回抵扣的数量。预扣费阶段仍按用户余额校验，所以余额不足时专用额度无法单独支撑请求。
+func applyModelCredit(userId int, modelName string, quota int64) int64 {
+	if quota <= 0 || !cacheHasModelCredits(userId) {
+		return 0
+	}
+	var used int64
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		credit := &ModelCredit{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND model_name = ? AND quota > 0", userId, modelName).First(credit).Error
+		if err != nil {
+			return nil
+		}
+		used = quota
+		if credit.Quota < used {
+			used = credit.Quota
+		}
+		// 余额不足以抵扣时说明已被并发请求用掉，本次不抵扣
+		result := tx.Model(credit).Where("quota >= ?", used).Updates(map[string]interface{}{
+			"quota":        gorm.Expr("quota - ?", used),
+			"updated_time": helper.GetTimestamp(),
+		})
+		if result.Error != nil || result.RowsAffected == 0 {
+			used = 0
+			return result.Error
+		}
+		return tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", used)).Error
+	})
+	if err != nil {
+		logger.SysError("failed to apply model credit: " + err.Error())
+		return 0
+	}
+	if used > 0 {
+		invalidateModelCredit(userId)
+		if err := CacheUpdateUserQuota2(userId); err != nil {
+			logger.SysError("failed to refresh user quota cache: " + err.Error())
+		}
+	}
+	return used
+}
+
+// SettleModelCredit 在结算扣费之后调用，用模型专用额度抵扣本次消费。组织令牌的消费记在组织额度池，
+// 不抵扣个人的模型专用额度。返回的 ctx 带上抵扣数量，随后的消费日志据此在 other 中记下 model_credit
+func SettleModelCredit(ctx context.Context, userId int, orgId int, modelName string, quota int64) context.Context {
+	if orgId > 0 {
+		return ctx
+	}
+	if used := applyModelCredit(userId, modelName, quota); used > 0 {
+		return context.WithValue(ctx, modelCreditCtxKey{}, used)
+	}
+	return ctx
+}
+
+// modelCreditSegmentFromContext 只读取结算阶段已抵扣的数量，写日志本身不改动任何额度
+func modelCreditSegmentFromContext(ctx context.Context) string {
+	if used, ok := ctx.Value(modelCreditCtxKey{}).(int64); ok && used > 0 {
+		return fmt.Sprintf("model_credit:%d", used)
+	}
+	return ""
+}
@@ -0,0 +1,187 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+func setupRedemptionTestDB(t *testing.T) {
+	setupTestDB(t, &Log{}, &Redemption{}, &RedemptionCampaign{}, &RedemptionLog{}, &ModelCredit{})
+	origLogDB, origRedis := LOG_DB, common.RedisEnabled
+	LOG_DB, common.RedisEnabled = DB, false
+	t.Cleanup(func() { LOG_DB, common.RedisEnabled = origLogDB, origRedis })
+}
+
+func failureReason(t *testing.T, userId int) string {
+	t.Helper()
+	log := &RedemptionLog{}
+	if err := DB.Where("user_id = ?", userId).Order("id desc").First(log).Error; err != nil {
+		t.Fatalf("缺少兑换记录: %v", err)
+	}
+	if log.Success {
+		t.Fatalf("最近一次兑换应失败")
+	}
+	return log.Reason
+}
+
+func TestRedeemCodeMultiUseAndPerUserLimit(t *testing.T) {
+	setupRedemptionTestDB(t)
+	now := helper.GetTimestamp()
+	for i := 1; i <= 3; i++ {
+		name := fmt.Sprintf("u%d", i)
+		DB.Create(&User{Id: i, Username: name, Group: "default", AccessToken: name, AffCode: name, CreatedTime: now})
+	}
+	campaign := &RedemptionCampaign{Name: "launch", PerUserLimit: 1, Status: 1}
+	if err := CreateRedemptionCampaign(campaign); err != nil {
+		t.Fatalf("创建活动失败: %v", err)
+	}
+	codes, err := GenerateCampaignRedemptions(campaign, 2, 100, 2, 0, 1)
+	if err != nil {
+		t.Fatalf("生成兑换码失败: %v", err)
+	}
+
+	if _, err := RedeemCode(codes[0].Key, 1, 0, "1.1.1.1"); err != nil {
+		t.Fatalf("首次兑换失败: %v", err)
+	}
+	if _, err := RedeemCode(codes[1].Key, 1, 0, ""); err == nil || failureReason(t, 1) != RedeemFailUserLimit {
+		t.Error("同一活动超过每用户次数上限应失败")
+	}
+	if _, err := RedeemCode(codes[0].Key, 2, 0, ""); err != nil {
+		t.Fatalf("多次码第二个用户兑换失败: %v", err)
+	}
+	if _, err := RedeemCode(codes[0].Key, 3, 0, ""); err == nil || failureReason(t, 3) != RedeemFailUsed {
+		t.Error("总次数用完后应失败")
+	}
+	quota, _ := GetUserQuota(2)
+	if quota != 100 {
+		t.Errorf("用户 2 额度应为 100，实际 %d", quota)
+	}
+
+	stats, err := GetRedemptionCampaignStats(campaign.Id)
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+	if stats.Codes != 2 || stats.Redemptions != 2 || stats.UniqueUsers != 2 || stats.QuotaGranted != 200 {
+		t.Errorf("活动统计不符: %+v", stats)
+	}
+	if stats.FailureReasons[RedeemFailUserLimit] != 1 || stats.FailureReasons[RedeemFailUsed] != 1 {
+		t.Errorf("失败原因统计不符: %+v", stats.FailureReasons)
+	}
+}
+
+func TestRedeemCodeConcurrent(t *testing.T) {
+	setupRedemptionTestDB(t)
+	now := helper.GetTimestamp()
+	for i := 1; i <= 6; i++ {
+		name := fmt.Sprintf("u%d", i)
+		DB.Create(&User{Id: i, Username: name, Group: "default", AccessToken: name, AffCode: name, CreatedTime: now})
+	}
+	campaign := &RedemptionCampaign{Name: "flash", PerUserLimit: 1, Status: 1}
+	if err := CreateRedemptionCampaign(campaign); err != nil {
+		t.Fatalf("创建活动失败: %v", err)
+	}
+	codes, err := GenerateCampaignRedemptions(campaign, 3, 100, 2, 0, 1)
+	if err != nil {
+		t.Fatalf("生成兑换码失败: %v", err)
+	}
+
+	// 6 个用户并发兑换同一个可用 2 次的码，用户 1 同时再兑换同一活动的另外两个码
+	var wg sync.WaitGroup
+	redeem := func(key string, userId int) {
+		defer wg.Done()
+		_, _ = RedeemCode(key, userId, 0, "")
+	}
+	for i := 1; i <= 6; i++ {
+		wg.Add(1)
+		go redeem(codes[0].Key, i)
+	}
+	wg.Add(2)
+	go redeem(codes[1].Key, 1)
+	go redeem(codes[2].Key, 1)
+	wg.Wait()
+
+	var successes int64
+	DB.Model(&RedemptionLog{}).Where("redemption_id = ? AND success = ?", codes[0].Id, true).Count(&successes)
+	code := &Redemption{}
+	DB.First(code, codes[0].Id)
+	if successes > 2 || int64(code.UsedCount) != successes {
+		t.Errorf("可用 2 次的码成功 %d 次，记录的次数 %d", successes, code.UsedCount)
+	}
+	var granted int64
+	DB.Model(&User{}).Select("coalesce(sum(quota), 0)").Scan(&granted)
+	var total int64
+	DB.Model(&RedemptionLog{}).Where("campaign_id = ? AND success = ?", campaign.Id, true).Count(&total)
+	if granted != total*100 {
+		t.Errorf("发放的额度 %d 与成功次数 %d 不符", granted, total)
+	}
+	var user1 int64
+	DB.Model(&RedemptionLog{}).Where("campaign_id = ? AND user_id = ? AND success = ?", campaign.Id, 1, true).Count(&user1)
+	if user1 > 1 {
+		t.Errorf("用户 1 在每人限 1 次的活动中成功兑换了 %d 次", user1)
+	}
+}
+
+func TestRedeemCodeRestrictionsAndRewards(t *testing.T) {
+	setupRedemptionTestDB(t)
+	now := helper.GetTimestamp()
+	DB.Create(&User{Id: 1, Username: "old", Group: "default", AccessToken: "a", AffCode: "a"})
+	DB.Create(&User{Id: 2, Username: "new", Group: "default", AccessToken: "b", AffCode: "b", CreatedTime: now})
+
+	expired := &Redemption{Key: "expired-code", Status: common.RedemptionCodeStatusEnabled, Quota: 10, ExpiredTime: now - 1}
+	DB.Create(expired)
+	if _, err := RedeemCode(expired.Key, 2, 0, ""); err == nil || failureReason(t, 2) != RedeemFailExpired {
+		t.Error("过期的兑换码应失败")
+	}
+	if _, err := RedeemCode("missing", 2, 0, ""); err == nil || failureReason(t, 2) != RedeemFailInvalidCode {
+		t.Error("不存在的兑换码应记录 invalid_code")
+	}
+
+	newcomer := &RedemptionCampaign{Name: "newcomer", NewUserDays: 7, RewardType: RedemptionRewardModelCredit,
+		ModelCredits: `{"gpt-4o":500}`, Status: 1}
+	if err := CreateRedemptionCampaign(newcomer); err != nil {
+		t.Fatalf("创建活动失败: %v", err)
+	}
+	codes, _ := GenerateCampaignRedemptions(newcomer, 1, 0, 10, 0, 1)
+	if _, err := RedeemCode(codes[0].Key, 1, 0, ""); err == nil || failureReason(t, 1) != RedeemFailNotNewUser {
+		t.Error("老用户不能兑换新用户专属码")
+	}
+	result, err := RedeemCode(codes[0].Key, 2, 0, "")
+	if err != nil || result.ModelCredits["gpt-4o"] != 500 {
+		t.Fatalf("新用户兑换模型额度失败: %v", err)
+	}
+
+	DB.Model(&User{}).Where("id = ?", 2).Update("quota", 0)
+	// 写消费日志本身不抵扣，组织令牌的消费也不抵扣个人专用额度
+	RecordConsumeLog(context.Background(), 2, 1, 0, 0, "gpt-4o", "t", 300, "", 0, "", "", false, 0)
+	if ctx := SettleModelCredit(context.Background(), 2, 9, "gpt-4o", 300); modelCreditSegmentFromContext(ctx) != "" {
+		t.Error("组织令牌的消费不应抵扣模型专用额度")
+	}
+	ctx := SettleModelCredit(context.Background(), 2, 0, "gpt-4o", 300)
+	if segment := modelCreditSegmentFromContext(ctx); segment != "model_credit:300" {
+		t.Errorf("应抵扣 300，实际 %q", segment)
+	}
+	if used := applyModelCredit(2, "gpt-4o", 300); used != 200 {
+		t.Errorf("剩余额度只能抵扣 200，实际 %d", used)
+	}
+	if used := applyModelCredit(2, "claude", 300); used != 0 {
+		t.Error("其他模型不应抵扣")
+	}
+	quota, _ := GetUserQuota(2)
+	if quota != 500 {
+		t.Errorf("抵扣的额度应退回余额，实际 %d", quota)
+	}
+
+	vip := &RedemptionCampaign{Name: "vip", AllowedGroups: "svip", RewardType: RedemptionRewardQuota, Status: 1}
+	if err := CreateRedemptionCampaign(vip); err != nil {
+		t.Fatalf("创建活动失败: %v", err)
+	}
+	vipCodes, _ := GenerateCampaignRedemptions(vip, 1, 10, 1, 0, 1)
+	if _, err := RedeemCode(vipCodes[0].Key, 1, 0, ""); err == nil || failureReason(t, 1) != RedeemFailGroup {
+		t.Error("分组不符时应失败")
+	}
+}
@@ -0,0 +1,325 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+)
+
+const (
+	RequestTagsHeader = "X-OneAPI-Tags"
+	// LogTagKeyEndUser 在 log_tags 中记录 end user 的保留键。合法的标签键不含 "$"，不会与之冲突
+	LogTagKeyEndUser = "$user"
+
+	logTagKeyColumnSize   = 64
+	logTagValueColumnSize = 128
+	allowedTagKeysMaxSize = 512
+)
+
+// RequestTag 一个标签键值对
+type RequestTag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// RequestTags 一次请求携带的标签（按键排序）与 end user，由 TokenAuth 解析后放入请求 context
+type RequestTags struct {
+	Tags    []RequestTag
+	EndUser string
+}
+
+// LogTag 消费日志的标签索引（LOG_DB）。每条日志的每个标签一行，end user 以 LogTagKeyEndUser 为键。
+//
+// logs 表不走自动迁移，标签因此单独成表；同时冗余日志的用户、令牌、模型和用量字段，
+// 按标签汇总时只扫本表。索引：idx_log_tag_kv 服务按标签过滤日志和按标签值汇总用量。
+type LogTag struct {
+	Id               int64  `json:"-" gorm:"primaryKey;autoIncrement"`
+	LogId            int    `json:"log_id" gorm:"index"`
+	TagKey           string `json:"key" gorm:"type:varchar(64);index:idx_log_tag_kv,priority:1"`
+	TagValue         string `json:"value" gorm:"type:varchar(128);index:idx_log_tag_kv,priority:2"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint;index:idx_log_tag_kv,priority:3"`
+	UserId           int    `json:"user_id"`
+	Username         string `json:"username" gorm:"type:varchar(100);default:''"`
+	TokenName        string `json:"token_name" gorm:"type:varchar(100);default:''"`
+	ModelName        string `json:"model_name" gorm:"type:varchar(200);default:''"`
+	ChannelId        int    `json:"channel_id"`
+	Quota            int64  `json:"quota" gorm:"default:0"`
+	Cost             int64  `json:"cost" gorm:"default:0"` // 上游成本，供按标签的毛利报表使用
+	PromptTokens     int64  `json:"prompt_tokens" gorm:"default:0"`
+	CompletionTokens int64  `json:"completion_tokens" gorm:"default:0"`
+	CachedTokens     int64  `json:"cached_tokens" gorm:"default:0"`
+}
+
+func requestTagKeyMaxLength() int {
+	return min(config.RequestTagMaxKeyLength, logTagKeyColumnSize)
+}
+
+func requestTagValueMaxLength() int {
+	return min(config.RequestTagMaxValueLength, logTagValueColumnSize)
+}
+
+// validateTagKey 标签键只允许字母、数字和 _ . -
+func validateTagKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("标签键不能为空")
+	}
+	if len(key) > requestTagKeyMaxLength() {
+		return fmt.Errorf("标签键 %s 超过 %d 个字符", key, requestTagKeyMaxLength())
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-') {
+			return fmt.Errorf("标签键 %s 只能包含字母、数字和 _ . -", key)
+		}
+	}
+	return nil
+}
+
+// validateTagValue 标签值不能含控制字符以及 , ;（日志 other 字段的分隔符）
+func validateTagValue(key, value string) error {
+	if value == "" {
+		return fmt.Errorf("标签 %s 的值不能为空", key)
+	}
+	if utf8.RuneCountInString(value) > requestTagValueMaxLength() {
+		return fmt.Errorf("标签 %s 的值超过 %d 个字符", key, requestTagValueMaxLength())
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) || r == ',' || r == ';' {
+			return fmt.Errorf("标签 %s 的值包含非法字符", key)
+		}
+	}
+	return nil
+}
+
+// ParseTagPairs 解析 "k1=v1, k2=v2" 形式的标签列表，用于请求头和日志查询参数
+func ParseTagPairs(s string) ([]RequestTag, error) {
+	var tags []RequestTag
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("标签 %s 格式错误，应为 key=value", part)
+		}
+		tags = append(tags, RequestTag{Key: strings.TrimSpace(key), Value: strings.TrimSpace(value)})
+	}
+	return tags, nil
+}
+
+// NormalizeAllowedTagKeys 校验并规范化令牌的允许标签键（逗号分隔，去重排序），空串表示不限制
+func NormalizeAllowedTagKeys(s string) (string, error) {
+	seen := map[string]bool{}
+	var keys []string
+	for _, key := range strings.Split(s, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" || seen[key] {
+			continue
+		}
+		if err := validateTagKey(key); err != nil {
+			return "", err
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	normalized := strings.Join(keys, ",")
+	if len(normalized) > allowedTagKeysMaxSize {
+		return "", fmt.Errorf("允许的标签键过多")
+	}
+	return normalized, nil
+}
+
+func parseAllowedTagKeys(s string) map[string]bool {
+	if s == "" {
+		return nil
+	}
+	allowed := map[string]bool{}
+	for _, key := range strings.Split(s, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			allowed[key] = true
+		}
+	}
+	return allowed
+}
+
+// BuildRequestTags 合并请求头标签、请求体 metadata 与 user 字段。
+//
+// 请求头是 one-api 自己的约定，任何不合规（格式、数量、长度、不在令牌允许列表内）都返回错误，由调用方拒绝请求。
+// metadata 和 user 是 OpenAI 的标准字段，客户端可能本来就在用，为兼容起见不合规的条目直接忽略，不影响请求；
+// 与请求头重复的键以请求头为准。都没有时返回 nil
+func BuildRequestTags(header string, metadata map[string]string, user string, allowedTagKeys string) (*RequestTags, error) {
+	allowed := parseAllowedTagKeys(allowedTagKeys)
+	headerTags, err := ParseTagPairs(header)
+	if err != nil {
+		return nil, err
+	}
+	if len(headerTags) > config.RequestTagMaxCount {
+		return nil, fmt.Errorf("标签数量超过上限 %d", config.RequestTagMaxCount)
+	}
+	seen := map[string]bool{}
+	var tags []RequestTag
+	for _, tag := range headerTags {
+		if err := validateTagKey(tag.Key); err != nil {
+			return nil, err
+		}
+		if err := validateTagValue(tag.Key, tag.Value); err != nil {
+			return nil, err
+		}
+		if allowed != nil && !allowed[tag.Key] {
+			return nil, fmt.Errorf("令牌不允许使用标签 %s", tag.Key)
+		}
+		if seen[tag.Key] {
+			return nil, fmt.Errorf("标签 %s 重复", tag.Key)
+		}
+		seen[tag.Key] = true
+		tags = append(tags, tag)
+	}
+
+	metadataKeys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		metadataKeys = append(metadataKeys, key)
+	}
+	sort.Strings(metadataKeys)
+	for _, key := range metadataKeys {
+		if len(tags) >= config.RequestTagMaxCount {
+			break
+		}
+		value := metadata[key]
+		if seen[key] || validateTagKey(key) != nil || validateTagValue(key, value) != nil || (allowed != nil && !allowed[key]) {
+			continue
+		}
+		seen[key] = true
+		tags = append(tags, RequestTag{Key: key, Value: value})
+	}
+
+	if validateTagValue("user", user) != nil {
+		user = ""
+	}
+	if len(tags) == 0 && user == "" {
+		return nil, nil
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Key < tags[j].Key })
+	return &RequestTags{Tags: tags, EndUser: user}, nil
+}
+
+// otherSegment 写入日志 other 字段的展示段，如 "tags:env=prod,project=search"
+func (t *RequestTags) otherSegment() string {
+	if t == nil || len(t.Tags) == 0 {
+		return ""
+	}
+	parts := make([]string, len(t.Tags))
+	for i, tag := range t.Tags {
+		parts[i] = tag.Key + "=" + tag.Value
+	}
+	return "tags:" + strings.Join(parts, ",")
+}
+
+func requestTagsFromContext(ctx context.Context) *RequestTags {
+	v := ctx.Value(logger.RequestTagsCtxKey)
+	if v == nil {
+		return nil
+	}
+	tags, _ := v.(*RequestTags)
+	return tags
+}
+
+// recordLogTags 为刚写入的日志建立标签索引
+func recordLogTags(ctx context.Context, log *Log, tags *RequestTags, endUser string) {
+	if log.Id == 0 {
+		return
+	}
+	var pairs []RequestTag
+	if tags != nil {
+		pairs = append(pairs, tags.Tags...)
+	}
+	if endUser != "" {
+		// 临时密钥签发时的 end user 不受标签长度限制，超出列宽的部分截断
+		if runes := []rune(endUser); len(runes) > logTagValueColumnSize {
+			endUser = string(runes[:logTagValueColumnSize])
+		}
+		pairs = append(pairs, RequestTag{Key: LogTagKeyEndUser, Value: endUser})
+	}
+	if len(pairs) == 0 {
+		return
+	}
+	rows := make([]LogTag, len(pairs))
+	for i, tag := range pairs {
+		rows[i] = LogTag{
+			LogId:            log.Id,
+			TagKey:           tag.Key,
+			TagValue:         tag.Value,
+			CreatedAt:        log.CreatedAt,
+			UserId:           log.UserId,
+			Username:         log.Username,
+			TokenName:        log.TokenName,
+			ModelName:        log.ModelName,
+			ChannelId:        log.ChannelId,
+			Quota:            int64(log.Quota),
+			Cost:             int64(log.Cost),
+			PromptTokens:     int64(log.PromptTokens),
+			CompletionTokens: int64(log.CompletionTokens),
+			CachedTokens:     int64(log.CachedTokens),
+		}
+	}
+	if err := LOG_DB.Create(&rows).Error; err != nil {
+		logger.Error(ctx, "failed to record log tags: "+err.Error())
+	}
+}
+
+// applyLogTagFilter 只保留带有全部指定标签（及 end user）的日志。
+// 子查询带上与日志查询相同的时间范围（0 表示不限制），以走 idx_log_tag_kv 的 created_at 列
+func applyLogTagFilter(tx *gorm.DB, startTimestamp, endTimestamp int64, endUser string, tags []RequestTag) *gorm.DB {
+	if endUser != "" {
+		tags = append([]RequestTag{{Key: LogTagKeyEndUser, Value: endUser}}, tags...)
+	}
+	for _, tag := range tags {
+		sub := LOG_DB.Model(&LogTag{}).Select("log_id").
+			Where("tag_key = ? AND tag_value = ?", tag.Key, tag.Value)
+		if startTimestamp > 0 {
+			sub = sub.Where("created_at >= ?", startTimestamp)
+		}
+		if endTimestamp > 0 {
+			sub = sub.Where("created_at <= ?", endTimestamp)
+		}
+		tx = tx.Where("id IN (?)", sub)
+	}
+	return tx
+}
+
+// GetTagUsageBreakdown 按某个标签键（end user 用 LogTagKeyEndUser）的取值拆分 [start, end) 内的用量，按额度倒序。
+// 只统计带该标签的消费日志，直接读 log_tags
+func GetTagUsageBreakdown(start, end int64, tagKey string, filter UsageFilter) ([]UsageBreakdownRow, error) {
+	if tagKey != LogTagKeyEndUser {
+		if err := validateTagKey(tagKey); err != nil {
+			return nil, err
+		}
+	}
+	var parts []usageAggRow
+	tx := LOG_DB.Model(&LogTag{}).
+		Select("tag_value AS group_key, COUNT(*) AS requests, COUNT(*) AS success_requests, "+
+			"COALESCE(SUM(quota), 0) AS quota, COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, "+
+			"COALESCE(SUM(completion_tokens), 0) AS completion_tokens, COALESCE(SUM(cached_tokens), 0) AS cached_tokens").
+		Where("tag_key = ? AND created_at >= ? AND created_at < ?", tagKey, start, end)
+	if err := filter.apply(tx).Group("tag_value").Scan(&parts).Error; err != nil {
+		return nil, err
+	}
+	rows := make([]UsageBreakdownRow, len(parts))
+	for i := range parts {
+		rows[i] = UsageBreakdownRow{Key: parts[i].GroupKey, UsageMetrics: parts[i].UsageMetrics}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Quota != rows[j].Quota {
+			return rows[i].Quota > rows[j].Quota
+		}
+		return rows[i].Key < rows[j].Key
+	})
+	return rows, nil
+}
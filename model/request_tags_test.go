@@ -0,0 +1,124 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+func TestBuildRequestTags(t *testing.T) {
+	tags, err := BuildRequestTags("project=search, env=prod", map[string]string{
+		"env":      "staging", // 与请求头重复，以请求头为准
+		"feature":  "autocomplete",
+		"bad key":  "x",   // 非法键，忽略
+		"trace_id": "a;b", // 非法值，忽略
+		"long":     strings.Repeat("v", config.RequestTagMaxValueLength+1),
+	}, "user-42", "")
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	got := tags.otherSegment()
+	if got != "tags:env=prod,feature=autocomplete,project=search" || tags.EndUser != "user-42" {
+		t.Fatalf("标签不符: %s end_user=%s", got, tags.EndUser)
+	}
+
+	if tags, err = BuildRequestTags("", nil, "", ""); err != nil || tags != nil {
+		t.Fatalf("没有标签时应返回 nil: %+v %v", tags, err)
+	}
+	for _, header := range []string{"project", "project=", "a b=c", "project=a,project=b"} {
+		if _, err := BuildRequestTags(header, nil, "", ""); err == nil {
+			t.Errorf("请求头 %q 应被拒绝", header)
+		}
+	}
+
+	// 令牌限定了允许的键：请求头中的其他键拒绝，metadata 中的其他键忽略
+	if _, err := BuildRequestTags("env=prod", nil, "", "project"); err == nil {
+		t.Error("不在允许列表中的请求头标签应被拒绝")
+	}
+	tags, err = BuildRequestTags("project=search", map[string]string{"env": "prod"}, "", "project")
+	if err != nil || tags.otherSegment() != "tags:project=search" {
+		t.Fatalf("metadata 中不允许的键应被忽略: %+v %v", tags, err)
+	}
+
+	origMax := config.RequestTagMaxCount
+	config.RequestTagMaxCount = 2
+	t.Cleanup(func() { config.RequestTagMaxCount = origMax })
+	if _, err := BuildRequestTags("a=1,b=2,c=3", nil, "", ""); err == nil {
+		t.Error("请求头标签超过上限应被拒绝")
+	}
+	tags, _ = BuildRequestTags("a=1", map[string]string{"b": "2", "c": "3"}, "", "")
+	if len(tags.Tags) != 2 {
+		t.Errorf("metadata 超出上限的部分应被丢弃: %+v", tags.Tags)
+	}
+
+	if keys, err := NormalizeAllowedTagKeys(" project, env,project "); err != nil || keys != "env,project" {
+		t.Errorf("允许的标签键应去重排序: %q %v", keys, err)
+	}
+	if _, err := NormalizeAllowedTagKeys("env,$user"); err == nil {
+		t.Error("非法的标签键应被拒绝")
+	}
+}
+
+func TestRequestTagsOnConsumeLogs(t *testing.T) {
+	setupTestDB(t, &Log{}, &LogTag{})
+	origLogDB, origRedis := LOG_DB, common.RedisEnabled
+	LOG_DB, common.RedisEnabled = DB, false
+	t.Cleanup(func() { LOG_DB, common.RedisEnabled = origLogDB, origRedis })
+	DB.Create(&User{Id: 1, Username: "alice", AccessToken: "a", AffCode: "a"})
+
+	record := func(tags *RequestTags, quota int64) {
+		ctx := context.Background()
+		if tags != nil {
+			ctx = context.WithValue(ctx, logger.RequestTagsCtxKey, tags)
+		}
+		RecordConsumeLogWithOtherAndRequestID(ctx, 1, 3, 10, 20, "gpt-4o", "shared", quota, "", 1, "", "", false, 0, "", "", 0, "")
+	}
+	record(&RequestTags{Tags: []RequestTag{{"env", "prod"}, {"project", "search"}}, EndUser: "u1"}, 100)
+	record(&RequestTags{Tags: []RequestTag{{"env", "prod"}, {"project", "chat"}}}, 300)
+	record(&RequestTags{Tags: []RequestTag{{"env", "dev"}, {"project", "search"}}, EndUser: "u1"}, 50)
+	record(nil, 1000)
+
+	logs, total, err := GetCurrentAllLogsAndCount(LogTypeUnknown, 0, 0, "", "", "", "", "", 1, 10, 0, "", []RequestTag{{"project", "search"}, {"env", "prod"}})
+	if err != nil || total != 1 || logs[0].Quota != 100 {
+		t.Fatalf("按标签过滤应只命中 1 条: total=%d err=%v", total, err)
+	}
+	if !strings.Contains(logs[0].Other, "end_user:u1") || !strings.Contains(logs[0].Other, "tags:env=prod,project=search") {
+		t.Errorf("other 中应包含 end user 与标签: %s", logs[0].Other)
+	}
+	if _, total, _ = GetCurrentUserLogsAndCount(1, LogTypeUnknown, 0, 0, "", "", "", "", 1, 10, "u1", nil); total != 2 {
+		t.Errorf("按 end user 过滤应命中 2 条, got %d", total)
+	}
+	now := helper.GetTimestamp()
+	if _, total, _ = GetCurrentUserLogsAndCount(1, LogTypeUnknown, now-60, now+60, "", "", "", "", 1, 10, "u1", nil); total != 2 {
+		t.Errorf("时间范围内按 end user 过滤应命中 2 条, got %d", total)
+	}
+	if _, total, _ = GetCurrentAllLogsAndCount(LogTypeUnknown, 0, now-3600, "", "", "", "", "", 1, 10, 0, "u1", nil); total != 0 {
+		t.Errorf("时间范围外不应命中, got %d", total)
+	}
+
+	rows, _, _, err := GetUsageBreakdown(0, 1<<40, "tag:project", UsageFilter{UserId: 1})
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("按 project 汇总失败: %+v %v", rows, err)
+	}
+	if rows[0].Key != "chat" || rows[0].Quota != 300 || rows[1].Key != "search" || rows[1].Quota != 150 || rows[1].Requests != 2 {
+		t.Errorf("按 project 汇总结果不符: %+v", rows)
+	}
+	rows, _, _, _ = GetUsageBreakdown(0, 1<<40, "end_user", UsageFilter{})
+	if len(rows) != 1 || rows[0].Key != "u1" || rows[0].Quota != 150 || rows[0].CompletionTokens != 40 {
+		t.Errorf("按 end user 汇总结果不符: %+v", rows)
+	}
+
+	if _, err := DeleteOldLog(1 << 40); err != nil {
+		t.Fatalf("清理日志失败: %v", err)
+	}
+	var remaining int64
+	DB.Model(&LogTag{}).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("清理日志时应同时清理标签, 剩余 %d", remaining)
+	}
+}
@@ -0,0 +1,505 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 模型对外状态
+const (
+	ModelStatusOperational = "operational" // 至少一个渠道可用，且近期成功率正常
+	ModelStatusDegraded    = "degraded"    // 部分渠道故障，或当前小时成功率低于 StatusPageDegradedSuccessRate
+	ModelStatusOutage      = "outage"      // 所有渠道都被自动禁用
+)
+
+const (
+	StatusIncidentOpen     = "open"
+	StatusIncidentResolved = "resolved"
+)
+
+// StatusIncident 状态页事件。Auto 为 true 的事件由巡检任务在模型全部渠道故障时创建、恢复后自动关闭；
+// 管理员手动创建的事件只能手动关闭。ModelName 为空表示全站事件
+type StatusIncident struct {
+	Id         int                     `json:"id"`
+	ModelName  string                  `json:"model_name" gorm:"type:varchar(200);index;default:''"`
+	Title      string                  `json:"title" gorm:"type:varchar(255)"`
+	Status     string                  `json:"status" gorm:"type:varchar(16);index"`
+	Auto       bool                    `json:"auto" gorm:"default:false"`
+	StartedAt  int64                   `json:"started_at" gorm:"bigint;index"`
+	ResolvedAt int64                   `json:"resolved_at" gorm:"bigint;default:0"`
+	CreatedBy  int                     `json:"-" gorm:"default:0"` // 0 为巡检任务
+	Updates    []*StatusIncidentUpdate `json:"updates" gorm:"-"`
+}
+
+// StatusIncidentUpdate 事件的时间线条目：自动开启/恢复的说明和管理员发布的备注
+type StatusIncidentUpdate struct {
+	Id         int    `json:"id"`
+	IncidentId int    `json:"incident_id" gorm:"index"`
+	Status     string `json:"status" gorm:"type:varchar(16)"` // 发布该条目后事件的状态
+	Message    string `json:"message" gorm:"type:text"`
+	CreatedBy  int    `json:"-" gorm:"default:0"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint"`
+}
+
+// ModelUptimeDaily 每个模型每天（UTC）的巡检采样计数，状态页的可用率历史由此计算
+type ModelUptimeDaily struct {
+	Id              int    `json:"-"`
+	ModelName       string `json:"model_name" gorm:"type:varchar(200);uniqueIndex:idx_uptime_model_day"`
+	Day             int64  `json:"day" gorm:"bigint;uniqueIndex:idx_uptime_model_day;index"`
+	Samples         int    `json:"samples" gorm:"default:0"`
+	DegradedSamples int    `json:"degraded_samples" gorm:"default:0"`
+	OutageSamples   int    `json:"outage_samples" gorm:"default:0"`
+}
+
+// ModelStatus 单个模型的实时状态，由 abilities 与 channels 的当前状态汇总
+type ModelStatus struct {
+	ModelName         string  `json:"model_name"`
+	Status            string  `json:"status"`
+	AvailableChannels int     `json:"-"`
+	FailingChannels   int     `json:"-"`
+	SuccessRate       float64 `json:"success_rate"` // 当前小时成功率，无请求时为 0
+}
+
+// ModelUptime 单个模型某天的可用率
+type ModelUptime struct {
+	Day      int64   `json:"day"`
+	Uptime   float64 `json:"uptime"` // 非 outage 采样占比
+	Status   string  `json:"status"` // 当天最差状态，无采样时为空
+	Samples  int     `json:"samples"`
+	Outages  int     `json:"outage_samples"`
+	Degraded int     `json:"degraded_samples"`
+}
+
+const statusSnapshotTTL = 30 * time.Second
+
+var (
+	statusTaskOnce sync.Once
+
+	statusSnapshotMu   sync.Mutex
+	statusSnapshot     []*ModelStatus
+	statusSnapshotTime time.Time
+
+	// notifyStatusIncident 测试中替换以捕获通知
+	notifyStatusIncident = sendStatusIncidentAlert
+)
+
+// StartStatusPageTask 主节点定期巡检模型状态：记录可用率采样，按需开启/关闭自动事件
+func StartStatusPageTask() {
+	statusTaskOnce.Do(func() {
+		if !config.IsMasterNode || !config.StatusPageEnabled || config.StatusPageIntervalMinutes <= 0 {
+			return
+		}
+		common.SafeGoroutine(func() {
+			for {
+				func() {
+					defer func() {
+						if r := recover(); r != nil {
+							logger.SysError(fmt.Sprintf("status page: panic recovered: %v", r))
+						}
+					}()
+					if err := RunStatusPageCheck(time.Now()); err != nil {
+						logger.SysError("status page: " + err.Error())
+					}
+				}()
+				time.Sleep(time.Duration(config.StatusPageIntervalMinutes) * time.Minute)
+			}
+		})
+		logger.SysLog("status page task started")
+	})
+}
+
+// RunStatusPageCheck 执行一轮巡检
+func RunStatusPageCheck(now time.Time) error {
+	statuses, err := ComputeModelStatuses()
+	if err != nil {
+		return err
+	}
+	storeStatusSnapshot(statuses, now)
+	if err := recordModelUptime(statuses, now); err != nil {
+		return err
+	}
+	if err := syncAutoIncidents(statuses, now.Unix()); err != nil {
+		return err
+	}
+	if config.StatusPageHistoryDays > 0 {
+		cutoff := now.Unix()/UsagePeriodDay*UsagePeriodDay - int64(config.StatusPageHistoryDays)*UsagePeriodDay
+		if err := DB.Where("day < ?", cutoff).Delete(&ModelUptimeDaily{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type statusAbilityRow struct {
+	Model         string `gorm:"column:model"`
+	ChannelId     int    `gorm:"column:channel_id"`
+	Enabled       bool   `gorm:"column:enabled"`
+	AutoDisabled  bool   `gorm:"column:auto_disabled"`
+	ChannelStatus int    `gorm:"column:channel_status"`
+}
+
+// ComputeModelStatuses 按模型汇总渠道状态。手动禁用的渠道和被手动移出的模型不计入，
+// 只有渠道级自动禁用或模型级自动禁用才算「故障」
+func ComputeModelStatuses() ([]*ModelStatus, error) {
+	var rows []statusAbilityRow
+	err := DB.Table("abilities a").
+		Select("a.model, a.channel_id, a.enabled, a.auto_disabled, c.status as channel_status").
+		Joins("JOIN channels c ON c.id = a.channel_id").
+		Where("c.status != ?", common.ChannelStatusManuallyDisabled).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	// 同一渠道可能在多个分组下提供同一模型，按 (model, channel) 去重：任一行可用即视为可用
+	type channelState struct{ available, failing bool }
+	perModel := make(map[string]map[int]*channelState)
+	for _, row := range rows {
+		channels, ok := perModel[row.Model]
+		if !ok {
+			channels = make(map[int]*channelState)
+			perModel[row.Model] = channels
+		}
+		st, ok := channels[row.ChannelId]
+		if !ok {
+			st = &channelState{}
+			channels[row.ChannelId] = st
+		}
+		switch {
+		case row.ChannelStatus == common.ChannelStatusEnabled && row.Enabled:
+			st.available = true
+		case row.ChannelStatus == common.ChannelStatusAutoDisabled || row.AutoDisabled:
+			st.failing = true
+		}
+	}
+
+	statuses := make([]*ModelStatus, 0, len(perModel))
+	for modelName, channels := range perModel {
+		ms := &ModelStatus{ModelName: modelName}
+		for _, st := range channels {
+			if st.available {
+				ms.AvailableChannels++
+			} else if st.failing {
+				ms.FailingChannels++
+			}
+		}
+		if ms.AvailableChannels == 0 && ms.FailingChannels == 0 {
+			continue
+		}
+		rpm := 0.0
+		if summary := GetCachedModelSummary(modelName); summary != nil {
+			ms.SuccessRate = summary.Current.SuccessRate
+			rpm = summary.Current.RPM
+		}
+		switch {
+		case ms.AvailableChannels == 0:
+			ms.Status = ModelStatusOutage
+		case ms.FailingChannels > 0:
+			ms.Status = ModelStatusDegraded
+		case rpm > 0 && ms.SuccessRate < config.StatusPageDegradedSuccessRate:
+			ms.Status = ModelStatusDegraded
+		default:
+			ms.Status = ModelStatusOperational
+		}
+		statuses = append(statuses, ms)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ModelName < statuses[j].ModelName })
+	return statuses, nil
+}
+
+func storeStatusSnapshot(statuses []*ModelStatus, now time.Time) {
+	statusSnapshotMu.Lock()
+	statusSnapshot, statusSnapshotTime = statuses, now
+	statusSnapshotMu.Unlock()
+}
+
+// GetModelStatusSnapshot 公开接口使用的模型状态，进程内缓存 statusSnapshotTTL，
+// 非主节点不跑巡检任务，缓存过期后自行重算
+func GetModelStatusSnapshot() ([]*ModelStatus, error) {
+	statusSnapshotMu.Lock()
+	defer statusSnapshotMu.Unlock()
+	if statusSnapshot != nil && time.Since(statusSnapshotTime) < statusSnapshotTTL {
+		return statusSnapshot, nil
+	}
+	statuses, err := ComputeModelStatuses()
+	if err != nil {
+		return nil, err
+	}
+	statusSnapshot, statusSnapshotTime = statuses, time.Now()
+	return statuses, nil
+}
+
+// OverallStatus 全站状态取所有模型中最差的一个
+func OverallStatus(statuses []*ModelStatus) string {
+	overall := ModelStatusOperational
+	for _, ms := range statuses {
+		if statusSeverity(ms.Status) > statusSeverity(overall) {
+			overall = ms.Status
+		}
+	}
+	return overall
+}
+
+func statusSeverity(status string) int {
+	switch status {
+	case ModelStatusOutage:
+		return 2
+	case ModelStatusDegraded:
+		return 1
+	}
+	return 0
+}
+
+func recordModelUptime(statuses []*ModelStatus, now time.Time) error {
+	day := now.Unix() / UsagePeriodDay * UsagePeriodDay
+	for _, ms := range statuses {
+		row := &ModelUptimeDaily{ModelName: ms.ModelName, Day: day, Samples: 1}
+		switch ms.Status {
+		case ModelStatusOutage:
+			row.OutageSamples = 1
+		case ModelStatusDegraded:
+			row.DegradedSamples = 1
+		}
+		err := DB.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "model_name"}, {Name: "day"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"samples":          gorm.Expr("samples + ?", row.Samples),
+				"degraded_samples": gorm.Expr("degraded_samples + ?", row.DegradedSamples),
+				"outage_samples":   gorm.Expr("outage_samples + ?", row.OutageSamples),
+			}),
+		}).Create(row).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncAutoIncidents 模型进入 outage 时开启自动事件，恢复（或模型已下线）时关闭
+func syncAutoIncidents(statuses []*ModelStatus, now int64) error {
+	var open []*StatusIncident
+	if err := DB.Where("auto = ? AND status = ?", true, StatusIncidentOpen).Find(&open).Error; err != nil {
+		return err
+	}
+	openByModel := make(map[string]*StatusIncident, len(open))
+	for _, inc := range open {
+		openByModel[inc.ModelName] = inc
+	}
+	current := make(map[string]*ModelStatus, len(statuses))
+	for _, ms := range statuses {
+		current[ms.ModelName] = ms
+		if ms.Status != ModelStatusOutage || openByModel[ms.ModelName] != nil {
+			continue
+		}
+		inc := &StatusIncident{
+			ModelName: ms.ModelName,
+			Title:     fmt.Sprintf("%s 不可用", ms.ModelName),
+			Status:    StatusIncidentOpen,
+			Auto:      true,
+			StartedAt: now,
+		}
+		note := fmt.Sprintf("%s 的全部 %d 个渠道均已被自动禁用，正在等待恢复。", ms.ModelName, ms.FailingChannels)
+		if err := createStatusIncident(inc, note); err != nil {
+			return err
+		}
+		notifyStatusIncident(inc, note)
+	}
+	for modelName, inc := range openByModel {
+		if ms := current[modelName]; ms != nil && ms.Status == ModelStatusOutage {
+			continue
+		}
+		note := fmt.Sprintf("%s 已恢复，持续约 %d 分钟。", modelName, (now-inc.StartedAt+59)/60)
+		if err := resolveStatusIncident(inc, note, 0, now); err != nil {
+			return err
+		}
+		notifyStatusIncident(inc, note)
+	}
+	return nil
+}
+
+func createStatusIncident(inc *StatusIncident, note string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(inc).Error; err != nil {
+			return err
+		}
+		update := &StatusIncidentUpdate{IncidentId: inc.Id, Status: inc.Status, Message: note, CreatedBy: inc.CreatedBy, CreatedAt: inc.StartedAt}
+		if err := tx.Create(update).Error; err != nil {
+			return err
+		}
+		inc.Updates = []*StatusIncidentUpdate{update}
+		return nil
+	})
+}
+
+func resolveStatusIncident(inc *StatusIncident, note string, operatorId int, now int64) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&StatusIncident{}).Where("id = ? AND status = ?", inc.Id, StatusIncidentOpen).
+			Updates(map[string]interface{}{"status": StatusIncidentResolved, "resolved_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("事件已关闭")
+		}
+		inc.Status, inc.ResolvedAt = StatusIncidentResolved, now
+		return tx.Create(&StatusIncidentUpdate{IncidentId: inc.Id, Status: inc.Status, Message: note, CreatedBy: operatorId, CreatedAt: now}).Error
+	})
+}
+
+// CreateManualStatusIncident 管理员手动发布事件
+func CreateManualStatusIncident(modelName, title, note string, operatorId int) (*StatusIncident, error) {
+	if title == "" {
+		return nil, errors.New("标题不能为空")
+	}
+	inc := &StatusIncident{
+		ModelName: modelName,
+		Title:     title,
+		Status:    StatusIncidentOpen,
+		StartedAt: helper.GetTimestamp(),
+		CreatedBy: operatorId,
+	}
+	if note == "" {
+		note = title
+	}
+	return inc, createStatusIncident(inc, note)
+}
+
+// AddStatusIncidentUpdate 管理员为事件追加备注，resolve 为 true 时同时关闭事件。
+// 自动事件也允许手动关闭：模型仍处于 outage 时下一轮巡检会重新开启新事件
+func AddStatusIncidentUpdate(id int, note string, resolve bool, operatorId int) (*StatusIncident, error) {
+	if note == "" {
+		return nil, errors.New("内容不能为空")
+	}
+	inc := &StatusIncident{}
+	if err := DB.First(inc, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	now := helper.GetTimestamp()
+	if resolve {
+		if err := resolveStatusIncident(inc, note, operatorId, now); err != nil {
+			return nil, err
+		}
+	} else if err := DB.Create(&StatusIncidentUpdate{IncidentId: inc.Id, Status: inc.Status, Message: note, CreatedBy: operatorId, CreatedAt: now}).Error; err != nil {
+		return nil, err
+	}
+	return inc, loadStatusIncidentUpdates([]*StatusIncident{inc})
+}
+
+// GetStatusIncidents 按开始时间倒序分页，status 为空时返回全部
+func GetStatusIncidents(status string, modelName string, startIdx int, num int) ([]*StatusIncident, int64, error) {
+	tx := DB.Model(&StatusIncident{})
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if modelName != "" {
+		tx = tx.Where("model_name = ?", modelName)
+	}
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var incidents []*StatusIncident
+	if err := tx.Order("started_at desc, id desc").Limit(num).Offset(startIdx).Find(&incidents).Error; err != nil {
+		return nil, 0, err
+	}
+	return incidents, total, loadStatusIncidentUpdates(incidents)
+}
+
+// GetActiveStatusIncidents 未关闭的事件，加上 since 之后关闭的事件
+func GetActiveStatusIncidents(since int64) ([]*StatusIncident, error) {
+	var incidents []*StatusIncident
+	err := DB.Where("status = ? OR resolved_at >= ?", StatusIncidentOpen, since).
+		Order("started_at desc, id desc").Find(&incidents).Error
+	if err != nil {
+		return nil, err
+	}
+	return incidents, loadStatusIncidentUpdates(incidents)
+}
+
+func loadStatusIncidentUpdates(incidents []*StatusIncident) error {
+	if len(incidents) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(incidents))
+	byId := make(map[int]*StatusIncident, len(incidents))
+	for _, inc := range incidents {
+		ids = append(ids, inc.Id)
+		byId[inc.Id] = inc
+		inc.Updates = []*StatusIncidentUpdate{}
+	}
+	var updates []*StatusIncidentUpdate
+	if err := DB.Where("incident_id IN ?", ids).Order("id desc").Find(&updates).Error; err != nil {
+		return err
+	}
+	for _, u := range updates {
+		byId[u.IncidentId].Updates = append(byId[u.IncidentId].Updates, u)
+	}
+	return nil
+}
+
+// GetModelUptimeHistory 最近 days 天（含今天）每天的可用率，按模型分组；modelName 为空时返回全部模型。
+// 没有采样的日期也会返回，Status 为空，便于前端画出完整的条带
+func GetModelUptimeHistory(modelName string, days int, now time.Time) (map[string][]ModelUptime, error) {
+	if days <= 0 {
+		days = 90
+	}
+	today := now.Unix() / UsagePeriodDay * UsagePeriodDay
+	start := today - int64(days-1)*UsagePeriodDay
+	tx := DB.Where("day >= ?", start)
+	if modelName != "" {
+		tx = tx.Where("model_name = ?", modelName)
+	}
+	var rows []*ModelUptimeDaily
+	if err := tx.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	byModel := make(map[string]map[int64]*ModelUptimeDaily)
+	for _, row := range rows {
+		if byModel[row.ModelName] == nil {
+			byModel[row.ModelName] = make(map[int64]*ModelUptimeDaily)
+		}
+		byModel[row.ModelName][row.Day] = row
+	}
+	history := make(map[string][]ModelUptime, len(byModel))
+	for name, daysMap := range byModel {
+		series := make([]ModelUptime, 0, days)
+		for day := start; day <= today; day += UsagePeriodDay {
+			point := ModelUptime{Day: day}
+			if row := daysMap[day]; row != nil && row.Samples > 0 {
+				point.Samples, point.Outages, point.Degraded = row.Samples, row.OutageSamples, row.DegradedSamples
+				point.Uptime = 1 - float64(row.OutageSamples)/float64(row.Samples)
+				switch {
+				case row.OutageSamples > 0:
+					point.Status = ModelStatusOutage
+				case row.DegradedSamples > 0:
+					point.Status = ModelStatusDegraded
+				default:
+					point.Status = ModelStatusOperational
+				}
+			}
+			series = append(series, point)
+		}
+		history[name] = series
+	}
+	return history, nil
+}
+
+func sendStatusIncidentAlert(inc *StatusIncident, note string) {
+	subject := fmt.Sprintf("状态页事件：%s", inc.Title)
+	if inc.Status == StatusIncidentResolved {
+		subject = fmt.Sprintf("状态页事件已恢复：%s", inc.Title)
+	}
+	if err := message.Notify(message.ByEmail, subject, "", note); err != nil {
+		logger.SysError("failed to send status incident notification: " + err.Error())
+	}
+}
@@ -0,0 +1,129 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+func setupStatusPageTestDB(t *testing.T) *[]*StatusIncident {
+	setupTestDB(t, &Channel{}, &Ability{}, &StatusIncident{}, &StatusIncidentUpdate{}, &ModelUptimeDaily{})
+	origNotify := notifyStatusIncident
+	var notified []*StatusIncident
+	notifyStatusIncident = func(inc *StatusIncident, note string) { notified = append(notified, inc) }
+	t.Cleanup(func() { notifyStatusIncident = origNotify })
+	return &notified
+}
+
+func TestStatusPageAutoIncidentLifecycle(t *testing.T) {
+	notified := setupStatusPageTestDB(t)
+	DB.Create(&Channel{Id: 1, Name: "c1", Status: common.ChannelStatusEnabled})
+	DB.Create(&Channel{Id: 2, Name: "c2", Status: common.ChannelStatusEnabled})
+	DB.Create(&Channel{Id: 3, Name: "c3", Status: common.ChannelStatusManuallyDisabled})
+	// gpt-4o 在 c1、c2 上；claude 只在 c2 上；c3 手动禁用不计入
+	DB.Create(&Ability{Group: "default", Model: "gpt-4o", ChannelId: 1, Enabled: true})
+	DB.Create(&Ability{Group: "vip", Model: "gpt-4o", ChannelId: 1, Enabled: true})
+	DB.Create(&Ability{Group: "default", Model: "gpt-4o", ChannelId: 2, Enabled: true})
+	DB.Create(&Ability{Group: "default", Model: "claude", ChannelId: 2, Enabled: true})
+	DB.Create(&Ability{Group: "default", Model: "legacy", ChannelId: 3, Enabled: true})
+
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	if err := RunStatusPageCheck(now); err != nil {
+		t.Fatalf("巡检失败: %v", err)
+	}
+	statuses, _ := ComputeModelStatuses()
+	if len(statuses) != 2 || OverallStatus(statuses) != ModelStatusOperational {
+		t.Fatalf("初始状态不符: %+v", statuses)
+	}
+
+	// c2 被整体自动禁用：claude 全部渠道故障，gpt-4o 部分故障
+	DB.Model(&Channel{}).Where("id = ?", 2).Update("status", common.ChannelStatusAutoDisabled)
+	if err := RunStatusPageCheck(now.Add(time.Minute)); err != nil {
+		t.Fatalf("巡检失败: %v", err)
+	}
+	statuses, _ = ComputeModelStatuses()
+	got := map[string]string{}
+	for _, ms := range statuses {
+		got[ms.ModelName] = ms.Status
+	}
+	if got["claude"] != ModelStatusOutage || got["gpt-4o"] != ModelStatusDegraded {
+		t.Fatalf("故障状态不符: %v", got)
+	}
+	open, _, _ := GetStatusIncidents(StatusIncidentOpen, "", 0, 10)
+	if len(open) != 1 || open[0].ModelName != "claude" || !open[0].Auto || len(open[0].Updates) != 1 {
+		t.Fatalf("应为 claude 开启一个自动事件: %+v", open)
+	}
+	// 持续故障不重复开启
+	if err := RunStatusPageCheck(now.Add(2 * time.Minute)); err != nil {
+		t.Fatalf("巡检失败: %v", err)
+	}
+	if _, total, _ := GetStatusIncidents("", "", 0, 10); total != 1 {
+		t.Fatalf("持续故障不应重复开启事件，实际 %d 个", total)
+	}
+
+	// 管理员追加备注
+	if _, err := AddStatusIncidentUpdate(open[0].Id, "上游正在排查", false, 1); err != nil {
+		t.Fatalf("追加备注失败: %v", err)
+	}
+
+	// 模型级恢复后自动关闭
+	if err := EnableModelOnChannel(2, "claude"); err != nil {
+		t.Fatalf("恢复失败: %v", err)
+	}
+	if err := RunStatusPageCheck(now.Add(3 * time.Minute)); err != nil {
+		t.Fatalf("巡检失败: %v", err)
+	}
+	incidents, _, _ := GetStatusIncidents("", "claude", 0, 10)
+	if len(incidents) != 1 || incidents[0].Status != StatusIncidentResolved || incidents[0].ResolvedAt != now.Add(3*time.Minute).Unix() {
+		t.Fatalf("事件应被自动关闭: %+v", incidents)
+	}
+	if len(incidents[0].Updates) != 3 || incidents[0].Updates[0].Status != StatusIncidentResolved {
+		t.Fatalf("时间线不符: %+v", incidents[0].Updates)
+	}
+	if len(*notified) != 2 {
+		t.Fatalf("应通知开启和恢复两次，实际 %d 次", len(*notified))
+	}
+	if _, err := AddStatusIncidentUpdate(incidents[0].Id, "再次关闭", true, 1); err == nil {
+		t.Fatal("已关闭的事件不应再次关闭")
+	}
+
+	history, err := GetModelUptimeHistory("claude", 90, now.Add(3*time.Minute))
+	if err != nil {
+		t.Fatalf("查询历史失败: %v", err)
+	}
+	series := history["claude"]
+	if len(series) != 90 {
+		t.Fatalf("应返回 90 天，实际 %d", len(series))
+	}
+	today := series[len(series)-1]
+	if today.Samples != 4 || today.Outages != 2 || today.Uptime != 0.5 || today.Status != ModelStatusOutage {
+		t.Fatalf("当天可用率不符: %+v", today)
+	}
+	if series[0].Samples != 0 || series[0].Status != "" {
+		t.Fatalf("无采样的日期应为空: %+v", series[0])
+	}
+}
+
+func TestStatusPageManualIncident(t *testing.T) {
+	setupStatusPageTestDB(t)
+	if _, err := CreateManualStatusIncident("", "", "", 1); err == nil {
+		t.Fatal("标题为空应报错")
+	}
+	inc, err := CreateManualStatusIncident("", "计划维护", "今晚 22:00 进行数据库维护", 1)
+	if err != nil {
+		t.Fatalf("创建事件失败: %v", err)
+	}
+	// 手动事件不受巡检影响
+	if err := RunStatusPageCheck(time.Now()); err != nil {
+		t.Fatalf("巡检失败: %v", err)
+	}
+	active, _ := GetActiveStatusIncidents(time.Now().Unix() - 3600)
+	if len(active) != 1 || active[0].Id != inc.Id || active[0].Status != StatusIncidentOpen {
+		t.Fatalf("手动事件应保持开启: %+v", active)
+	}
+	resolved, err := AddStatusIncidentUpdate(inc.Id, "维护完成", true, 1)
+	if err != nil || resolved.Status != StatusIncidentResolved || len(resolved.Updates) != 2 {
+		t.Fatalf("关闭事件失败: %v %+v", err, resolved)
+	}
+}
@@ -0,0 +1,389 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	SubscriptionStatusIncomplete = "incomplete"
+	SubscriptionStatusActive     = "active"
+	SubscriptionStatusPastDue    = "past_due"
+	SubscriptionStatusCanceled   = "canceled"
+)
+
+// SubscriptionPlan 按月订阅的套餐，对应 Stripe 上的一个循环价格
+type SubscriptionPlan struct {
+	Id            int    `json:"id"`
+	Name          string `json:"name" gorm:"type:varchar(64)"`
+	Description   string `json:"description" gorm:"type:varchar(255)"`
+	StripePriceId string `json:"stripe_price_id" gorm:"type:varchar(128);uniqueIndex"`
+	MonthlyQuota  int64  `json:"monthly_quota" gorm:"bigint"`
+	// Rollover 为 false 时每期开始先收回上期未用完的赠送额度再发放新额度
+	Rollover bool `json:"rollover"`
+	// Group 订阅有效期间把用户切到该分组（GroupConfig.GroupKey），取消后恢复原分组；为空不调整
+	Group       string `json:"group" gorm:"type:varchar(32)"`
+	Status      int    `json:"status" gorm:"default:1"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+// UserSubscription 用户的 Stripe 订阅
+type UserSubscription struct {
+	Id                   int    `json:"id"`
+	UserId               int    `json:"user_id" gorm:"index"`
+	PlanId               int    `json:"plan_id"`
+	StripeCustomerId     string `json:"stripe_customer_id" gorm:"type:varchar(128);index"`
+	StripeSubscriptionId string `json:"stripe_subscription_id" gorm:"type:varchar(128);uniqueIndex"`
+	Status               string `json:"status" gorm:"type:varchar(16)"`
+	CurrentPeriodStart   int64  `json:"current_period_start" gorm:"bigint"`
+	CurrentPeriodEnd     int64  `json:"current_period_end" gorm:"bigint"`
+	CancelAtPeriodEnd    bool   `json:"cancel_at_period_end"`
+	// GrantedQuota 本期已发放的额度，不滚存的套餐在下期发放前据此收回未用部分
+	GrantedQuota int64 `json:"granted_quota" gorm:"bigint"`
+	// GrantedUsedQuota 发放本期额度时用户的累计已用额度（users.used_quota），续期时据此计算本期消耗
+	GrantedUsedQuota int64  `json:"granted_used_quota" gorm:"bigint"`
+	LastInvoiceId    string `json:"last_invoice_id" gorm:"type:varchar(128)"`
+	// PreviousGroup 切换分组前用户所在分组，为空表示未切换
+	PreviousGroup string `json:"previous_group" gorm:"type:varchar(32)"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime   int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// StripeWebhookEvent 已处理的 Stripe 事件，用于拦截重放
+type StripeWebhookEvent struct {
+	Id          int    `json:"id"`
+	EventId     string `json:"event_id" gorm:"type:varchar(128);uniqueIndex"`
+	Type        string `json:"type" gorm:"type:varchar(64)"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+func (plan *SubscriptionPlan) Validate() error {
+	if plan.Name == "" || plan.StripePriceId == "" {
+		return errors.New("name and stripe_price_id are required")
+	}
+	if plan.MonthlyQuota < 0 {
+		return errors.New("monthly_quota must be >= 0")
+	}
+	if plan.Group != "" {
+		if _, ok := common.GroupRatio[plan.Group]; !ok {
+			return errors.New("unknown group: " + plan.Group)
+		}
+	}
+	return nil
+}
+
+func CreateSubscriptionPlan(plan *SubscriptionPlan) error {
+	if err := plan.Validate(); err != nil {
+		return err
+	}
+	plan.CreatedTime = helper.GetTimestamp()
+	return DB.Create(plan).Error
+}
+
+func UpdateSubscriptionPlan(plan *SubscriptionPlan) error {
+	if err := plan.Validate(); err != nil {
+		return err
+	}
+	return DB.Model(plan).Select("name", "description", "stripe_price_id", "monthly_quota", "rollover", "group", "status").Updates(plan).Error
+}
+
+func DeleteSubscriptionPlan(id int) error {
+	var count int64
+	DB.Model(&UserSubscription{}).Where("plan_id = ? AND status <> ?", id, SubscriptionStatusCanceled).Count(&count)
+	if count > 0 {
+		return errors.New("the plan still has subscribers, disable it instead")
+	}
+	return DB.Delete(&SubscriptionPlan{}, id).Error
+}
+
+func GetSubscriptionPlanById(id int) (*SubscriptionPlan, error) {
+	plan := &SubscriptionPlan{}
+	err := DB.First(plan, id).Error
+	return plan, err
+}
+
+func getSubscriptionPlan(tx *gorm.DB, id int) (*SubscriptionPlan, error) {
+	plan := &SubscriptionPlan{}
+	err := tx.First(plan, id).Error
+	return plan, err
+}
+
+func getSubscriptionPlanByPriceId(tx *gorm.DB, priceId string) (*SubscriptionPlan, error) {
+	plan := &SubscriptionPlan{}
+	err := tx.Where("stripe_price_id = ?", priceId).First(plan).Error
+	return plan, err
+}
+
+// GetSubscriptionPlans enabledOnly 为 true 时只返回上架的套餐
+func GetSubscriptionPlans(enabledOnly bool) ([]*SubscriptionPlan, error) {
+	var plans []*SubscriptionPlan
+	tx := DB.Order("monthly_quota asc, id asc")
+	if enabledOnly {
+		tx = tx.Where("status = ?", 1)
+	}
+	err := tx.Find(&plans).Error
+	return plans, err
+}
+
+func GetUserSubscriptions(userId int) ([]*UserSubscription, error) {
+	var subscriptions []*UserSubscription
+	err := DB.Where("user_id = ?", userId).Order("id desc").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// GetLiveUserSubscription 返回用户尚未取消的订阅
+func GetLiveUserSubscription(userId int) (*UserSubscription, error) {
+	subscription := &UserSubscription{}
+	err := DB.Where("user_id = ? AND status <> ?", userId, SubscriptionStatusCanceled).Order("id desc").First(subscription).Error
+	return subscription, err
+}
+
+// GetUserStripeCustomerId 用户最近一次订阅关联的 Stripe Customer，用于打开自助管理页面
+func GetUserStripeCustomerId(userId int) string {
+	var customerId string
+	DB.Model(&UserSubscription{}).Where("user_id = ? AND stripe_customer_id <> ''", userId).
+		Order("id desc").Limit(1).Select("stripe_customer_id").Find(&customerId)
+	return customerId
+}
+
+// ProcessStripeEventOnce 在同一事务里登记事件并执行处理，事件已处理过时直接跳过。
+// 处理失败时登记一同回滚，Stripe 重试时会重新处理。
+func ProcessStripeEventOnce(eventId string, eventType string, handle func(tx *gorm.DB) error) (processed bool, err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&StripeWebhookEvent{
+			EventId:     eventId,
+			Type:        eventType,
+			CreatedTime: helper.GetTimestamp(),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		processed = true
+		return handle(tx)
+	})
+	if err != nil {
+		processed = false
+	}
+	return processed, err
+}
+
+// StripeSubscriptionState Webhook 中解析出的订阅状态
+type StripeSubscriptionState struct {
+	SubscriptionId    string
+	CustomerId        string
+	UserId            int // 来自订阅 metadata，首次建档时使用
+	PriceId           string
+	Status            string // Stripe 原始状态
+	PeriodStart       int64
+	PeriodEnd         int64
+	CancelAtPeriodEnd bool
+}
+
+func normalizeStripeSubscriptionStatus(status string) string {
+	switch status {
+	case "active", "trialing":
+		return SubscriptionStatusActive
+	case "past_due", "unpaid":
+		return SubscriptionStatusPastDue
+	case "canceled", "incomplete_expired":
+		return SubscriptionStatusCanceled
+	default:
+		return SubscriptionStatusIncomplete
+	}
+}
+
+// loadOrCreateUserSubscription 按 Stripe 订阅 ID 加锁读取本地订阅，不存在时按 metadata 建档
+func loadOrCreateUserSubscription(tx *gorm.DB, state *StripeSubscriptionState) (*UserSubscription, error) {
+	subscription := &UserSubscription{}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("stripe_subscription_id = ?", state.SubscriptionId).First(subscription).Error
+	if err == nil {
+		return subscription, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if state.UserId == 0 {
+		return nil, fmt.Errorf("subscription %s has no user_id metadata", state.SubscriptionId)
+	}
+	plan, err := getSubscriptionPlanByPriceId(tx, state.PriceId)
+	if err != nil {
+		return nil, fmt.Errorf("no plan for price %s", state.PriceId)
+	}
+	now := helper.GetTimestamp()
+	subscription = &UserSubscription{
+		UserId:               state.UserId,
+		PlanId:               plan.Id,
+		StripeCustomerId:     state.CustomerId,
+		StripeSubscriptionId: state.SubscriptionId,
+		Status:               SubscriptionStatusIncomplete,
+		CreatedTime:          now,
+		UpdatedTime:          now,
+	}
+	if err := tx.Create(subscription).Error; err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+func setSubscriptionGroup(tx *gorm.DB, subscription *UserSubscription, plan *SubscriptionPlan) error {
+	if plan.Group == "" {
+		return nil
+	}
+	user := &User{}
+	if err := tx.Select("id", "group").Where("id = ?", subscription.UserId).First(user).Error; err != nil {
+		return err
+	}
+	if user.Group == plan.Group {
+		return nil
+	}
+	if subscription.PreviousGroup == "" {
+		subscription.PreviousGroup = user.Group
+	}
+	return tx.Model(&User{}).Where("id = ?", subscription.UserId).Update("group", plan.Group).Error
+}
+
+func revertSubscriptionGroup(tx *gorm.DB, subscription *UserSubscription) error {
+	if subscription.PreviousGroup == "" {
+		return nil
+	}
+	err := tx.Model(&User{}).Where("id = ?", subscription.UserId).Update("group", subscription.PreviousGroup).Error
+	subscription.PreviousGroup = ""
+	return err
+}
+
+func saveUserSubscription(tx *gorm.DB, subscription *UserSubscription) error {
+	subscription.UpdatedTime = helper.GetTimestamp()
+	return tx.Save(subscription).Error
+}
+
+// ApplyStripeSubscriptionState 处理订阅创建/更新/删除：同步状态、套餐变更与分组
+func ApplyStripeSubscriptionState(tx *gorm.DB, state *StripeSubscriptionState) (*UserSubscription, error) {
+	subscription, err := loadOrCreateUserSubscription(tx, state)
+	if err != nil {
+		return nil, err
+	}
+	if state.CustomerId != "" {
+		subscription.StripeCustomerId = state.CustomerId
+	}
+	if state.PriceId != "" {
+		if plan, err := getSubscriptionPlanByPriceId(tx, state.PriceId); err == nil {
+			subscription.PlanId = plan.Id
+		}
+	}
+	if state.PeriodEnd > 0 {
+		subscription.CurrentPeriodStart = state.PeriodStart
+		subscription.CurrentPeriodEnd = state.PeriodEnd
+	}
+	subscription.CancelAtPeriodEnd = state.CancelAtPeriodEnd
+	subscription.Status = normalizeStripeSubscriptionStatus(state.Status)
+
+	switch subscription.Status {
+	case SubscriptionStatusActive:
+		plan, err := getSubscriptionPlan(tx, subscription.PlanId)
+		if err != nil {
+			return nil, err
+		}
+		if err := setSubscriptionGroup(tx, subscription, plan); err != nil {
+			return nil, err
+		}
+	case SubscriptionStatusCanceled:
+		if err := revertSubscriptionGroup(tx, subscription); err != nil {
+			return nil, err
+		}
+	}
+	return subscription, saveUserSubscription(tx, subscription)
+}
+
+// ApplyStripeSubscriptionInvoicePaid 账单支付成功：发放本期额度。同一张账单只发放一次。
+func ApplyStripeSubscriptionInvoicePaid(tx *gorm.DB, state *StripeSubscriptionState, invoiceId string) (*UserSubscription, int64, error) {
+	subscription, err := loadOrCreateUserSubscription(tx, state)
+	if err != nil {
+		return nil, 0, err
+	}
+	if subscription.LastInvoiceId == invoiceId {
+		return subscription, 0, nil
+	}
+	plan, err := getSubscriptionPlan(tx, subscription.PlanId)
+	if err != nil {
+		return nil, 0, err
+	}
+	if state.PriceId != "" && state.PriceId != plan.StripePriceId {
+		if newPlan, err := getSubscriptionPlanByPriceId(tx, state.PriceId); err == nil {
+			plan = newPlan
+			subscription.PlanId = plan.Id
+		}
+	}
+
+	user := &User{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "quota", "used_quota").
+		Where("id = ?", subscription.UserId).First(user).Error; err != nil {
+		return nil, 0, err
+	}
+	delta := plan.MonthlyQuota
+	if !plan.Rollover && subscription.GrantedQuota > 0 {
+		// 本期消耗优先记在套餐额度上，只收回套餐额度的剩余部分，期间充值的余额不受影响
+		unused := subscription.GrantedQuota - (user.UsedQuota - subscription.GrantedUsedQuota)
+		if user.Quota < unused {
+			unused = user.Quota
+		}
+		if unused > 0 {
+			delta -= unused
+		}
+	}
+	if delta != 0 {
+		if err := tx.Model(&User{}).Where("id = ?", subscription.UserId).
+			Update("quota", gorm.Expr("quota + ?", delta)).Error; err != nil {
+			return nil, 0, err
+		}
+	}
+	subscription.GrantedQuota = plan.MonthlyQuota
+	subscription.GrantedUsedQuota = user.UsedQuota
+	subscription.LastInvoiceId = invoiceId
+	subscription.Status = SubscriptionStatusActive
+	if state.PeriodEnd > 0 {
+		subscription.CurrentPeriodStart = state.PeriodStart
+		subscription.CurrentPeriodEnd = state.PeriodEnd
+	}
+	if err := setSubscriptionGroup(tx, subscription, plan); err != nil {
+		return nil, 0, err
+	}
+	if err := recordAffiliateCommission(tx, subscription.UserId, AffiliateSourceSubscription, invoiceId, plan.MonthlyQuota, 0, ""); err != nil {
+		return nil, 0, err
+	}
+	return subscription, plan.MonthlyQuota, saveUserSubscription(tx, subscription)
+}
+
+// MarkStripeSubscriptionPastDue 续费扣款失败，订阅进入欠费状态，分组与额度保持不变直到 Stripe 最终取消
+func MarkStripeSubscriptionPastDue(tx *gorm.DB, subscriptionId string) (*UserSubscription, error) {
+	subscription := &UserSubscription{}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("stripe_subscription_id = ?", subscriptionId).First(subscription).Error
+	if err != nil {
+		return nil, err
+	}
+	subscription.Status = SubscriptionStatusPastDue
+	return subscription, saveUserSubscription(tx, subscription)
+}
+
+// AfterSubscriptionChange 事务提交后刷新缓存并记录日志
+func AfterSubscriptionChange(subscription *UserSubscription, logContent string) {
+	if common.RedisEnabled {
+		if err := common.RedisDel(fmt.Sprintf("user_group:%d", subscription.UserId)); err != nil {
+			logger.SysError("failed to invalidate user group cache: " + err.Error())
+		}
+	}
+	if err := CacheUpdateUserQuota2(subscription.UserId); err != nil {
+		logger.SysError("failed to refresh user quota cache: " + err.Error())
+	}
+	if logContent != "" {
+		RecordLog(subscription.UserId, LogTypeTopup, logContent)
+	}
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+	"gorm.io/gorm"
+)
+
+func TestStripeSubscriptionLifecycle(t *testing.T) {
+	setupTestDB(t, &SubscriptionPlan{}, &UserSubscription{}, &StripeWebhookEvent{})
+	origGroupRatio := common.GroupRatio
+	common.GroupRatio = map[string]float64{"default": 1, "pro": 0.8}
+	t.Cleanup(func() { common.GroupRatio = origGroupRatio })
+
+	user := &User{Id: 3, Username: "carol", Quota: 100, Group: "default", AccessToken: "c", AffCode: "c"}
+	if err := DB.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	plan := &SubscriptionPlan{Name: "Pro", StripePriceId: "price_pro", MonthlyQuota: 1000, Group: "pro"}
+	if err := CreateSubscriptionPlan(plan); err != nil {
+		t.Fatalf("创建套餐失败: %v", err)
+	}
+	if err := CreateSubscriptionPlan(&SubscriptionPlan{Name: "x", StripePriceId: "price_x", Group: "nope"}); err == nil {
+		t.Error("不存在的分组应被拒绝")
+	}
+
+	paid := func(eventId string, invoiceId string) {
+		t.Helper()
+		state := &StripeSubscriptionState{SubscriptionId: "sub_1", CustomerId: "cus_1", UserId: user.Id, PriceId: "price_pro", PeriodEnd: 1}
+		_, err := ProcessStripeEventOnce(eventId, "invoice.paid", func(tx *gorm.DB) error {
+			_, _, err := ApplyStripeSubscriptionInvoicePaid(tx, state, invoiceId)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("处理 invoice.paid 失败: %v", err)
+		}
+	}
+	quotaAndGroup := func() (int64, string) {
+		u := &User{}
+		DB.Select("quota", "group").Where("id = ?", user.Id).First(u)
+		return u.Quota, u.Group
+	}
+
+	paid("evt_1", "in_1")
+	paid("evt_1", "in_1")
+	if quota, group := quotaAndGroup(); quota != 1100 || group != "pro" {
+		t.Fatalf("首期应发放一次额度并切换分组，实际 quota=%d group=%s", quota, group)
+	}
+
+	// 本期用掉 600，套餐额度剩 400，下期不滚存
+	consume := func(quota int64) {
+		DB.Model(&User{}).Where("id = ?", user.Id).Updates(map[string]interface{}{
+			"quota":      gorm.Expr("quota - ?", quota),
+			"used_quota": gorm.Expr("used_quota + ?", quota),
+		})
+	}
+	consume(600)
+	paid("evt_2", "in_2")
+	if quota, _ := quotaAndGroup(); quota != 1100 {
+		t.Errorf("不滚存的套餐应只收回上期剩余的套餐额度，实际 quota=%d", quota)
+	}
+
+	// 套餐额度用完后又充值 800，续期时充值余额不应被当作套餐额度收回
+	consume(1000)
+	DB.Model(&User{}).Where("id = ?", user.Id).Update("quota", gorm.Expr("quota + ?", 800))
+	paid("evt_2b", "in_2b")
+	if quota, _ := quotaAndGroup(); quota != 1900 {
+		t.Errorf("充值余额应保留，实际 quota=%d", quota)
+	}
+	if GetUserStripeCustomerId(user.Id) != "cus_1" {
+		t.Error("应记录 Stripe Customer 供自助管理页面使用")
+	}
+
+	_, err := ProcessStripeEventOnce("evt_3", "customer.subscription.deleted", func(tx *gorm.DB) error {
+		_, err := ApplyStripeSubscriptionState(tx, &StripeSubscriptionState{SubscriptionId: "sub_1", Status: "canceled", PriceId: "price_pro"})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("处理取消事件失败: %v", err)
+	}
+	if _, group := quotaAndGroup(); group != "default" {
+		t.Errorf("取消后应恢复原分组，实际 %s", group)
+	}
+	if _, err := GetLiveUserSubscription(user.Id); err == nil {
+		t.Error("取消后不应再有生效中的订阅")
+	}
+}
@@ -27,12 +27,20 @@ type Token struct {
 	UsedQuota            int64  `json:"used_quota" gorm:"default:0"` // used quota
 	TokenRemindThreshold int64  `json:"token_remind_threshold"`
 	TokenLastNoticeTime  int64  `json:"token_last_notice_time" gorm:"default:0"`
+	OrgId                int    `json:"org_id" gorm:"index;default:0"` // 非 0 表示组织令牌，消费从组织额度池扣除
+	// EphemeralRevokedAt 之前签发的临时密钥（ek-）全部失效，0 表示从未吊销
+	EphemeralRevokedAt int64 `json:"ephemeral_revoked_at" gorm:"bigint;default:0"`
+	// FrozenReason 被用量异常检测冻结的原因，解冻后清空
+	FrozenReason string `json:"frozen_reason" gorm:"type:varchar(512);default:''"`
+	FrozenTime   int64  `json:"frozen_time" gorm:"bigint;default:0"`
+	// AllowedTagKeys 允许请求携带的标签键，逗号分隔；为空表示不限制，见 BuildRequestTags
+	AllowedTagKeys string `json:"allowed_tag_keys" gorm:"type:varchar(512);default:''"`
 }
 
 func GetAllUserTokens(userId int, startIdx int, num int, order string) ([]*Token, error) {
 	var tokens []*Token
 	var err error
-	query := DB.Where("user_id = ?", userId)
+	query := DB.Where("user_id = ? AND org_id = 0", userId)
 
 	switch order {
 	case "remain_quota":
@@ -49,7 +57,8 @@ func GetAllUserTokens(userId int, startIdx int, num int, order string) ([]*Token
 
 func GetUserTokensAndCount(userId int, page int, pageSize int) (tokens []*Token, total int64, err error) {
 	// 首先计算特定用户的令牌总数
-	err = DB.Model(&Token{}).Where("user_id = ?", userId).Count(&total).Error
+	// 组织令牌在组织管理页单独展示，这里只列个人令牌
+	err = DB.Model(&Token{}).Where("user_id = ? AND org_id = 0", userId).Count(&total).Error
 	if err != nil {
 		return nil, 0, err
 	}
@@ -58,7 +67,7 @@ func GetUserTokensAndCount(userId int, page int, pageSize int) (tokens []*Token,
 	offset := (page - 1) * pageSize
 
 	// 获取当前页面的用户令牌列表
-	err = DB.Where("user_id = ?", userId).Order("id desc").Limit(pageSize).Offset(offset).Find(&tokens).Error
+	err = DB.Where("user_id = ? AND org_id = 0", userId).Order("id desc").Limit(pageSize).Offset(offset).Find(&tokens).Error
 	if err != nil {
 		return nil, total, err
 	}
@@ -73,7 +82,7 @@ func SearchUserTokensAndCount(userId int, keyword string, page int, pageSize int
 
 	// 先计算满足条件的总数据量
 	// 加入对状态的查询条件
-	db := DB.Model(&Token{}).Where("user_id = ?", userId).Where("name LIKE ?", likeKeyword)
+	db := DB.Model(&Token{}).Where("user_id = ? AND org_id = 0", userId).Where("name LIKE ?", likeKeyword)
 	if status != nil {
 		db = db.Where("status = ?", *status)
 	}
@@ -87,7 +96,7 @@ func SearchUserTokensAndCount(userId int, keyword string, page int, pageSize int
 
 	// 获取满足条件的数据的子集
 	// 同样加入对状态的查询条件
-	db = DB.Where("user_id = ?", userId).Where("name LIKE ?", likeKeyword).Order("id DESC").Offset(offset).Limit(pageSize)
+	db = DB.Where("user_id = ? AND org_id = 0", userId).Where("name LIKE ?", likeKeyword).Order("id DESC").Offset(offset).Limit(pageSize)
 	if status != nil {
 		db = db.Where("status = ?", *status)
 	}
@@ -116,6 +125,8 @@ func ValidateUserToken(key string) (token *Token, err error) {
 		return nil, errors.New("The token quota has been exhausted")
 	} else if token.Status == common.TokenStatusExpired {
 		return nil, errors.New("The token has expired")
+	} else if token.Status == common.TokenStatusFrozen {
+		return nil, errors.New("The token has been frozen due to unusual usage, please review it in the token list: " + token.FrozenReason)
 	}
 	if token.Status != common.TokenStatusEnabled {
 		return nil, errors.New("The token status is not available")
@@ -173,7 +184,7 @@ func (token *Token) Insert() error {
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (token *Token) Update() error {
 	var err error
-	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "token_remind_threshold", "unlimited_quota").Updates(token).Error
+	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "token_remind_threshold", "unlimited_quota", "allowed_tag_keys").Updates(token).Error
 	return err
 }
 
@@ -300,6 +311,10 @@ func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
 		return errors.New("Insufficient token amount")
 	}
 
+	if token.OrgId > 0 {
+		return preConsumeOrgQuota(token, quota)
+	}
+
 	user, err := GetUserById(token.UserId, true)
 	if err != nil {
 		return err
@@ -309,12 +324,14 @@ func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
 	if err != nil {
 		return err
 	}
-	if userQuota < quota {
+	// 后付费用户可透支到 -CreditLimit，额度提醒改由 checkCreditLimitNotice 发送
+	creditLimit := GetCreditLimit(token.UserId)
+	if userQuota+creditLimit < quota {
 		return errors.New("Insufficient user quota")
 	}
 
-	quotaTooLow := userQuota >= user.UserRemindThreshold && userQuota-quota < user.UserRemindThreshold
-	noMoreQuota := userQuota-quota <= 0
+	quotaTooLow := creditLimit == 0 && userQuota >= user.UserRemindThreshold && userQuota-quota < user.UserRemindThreshold
+	noMoreQuota := creditLimit == 0 && userQuota-quota <= 0
 
 	// 检查用户是否可以发送邮件
 	if quotaTooLow || noMoreQuota {
@@ -365,8 +382,28 @@ func UpdateUserLastNoticeTime(userId int, lastNoticeTime int64) error {
 	return DB.Model(&User{}).Where("id = ?", userId).Update("user_last_notice_time", lastNoticeTime).Error
 }
 
+// preConsumeOrgQuota 组织令牌的预扣费：校验并扣减组织额度池，不动成员个人余额。
+// 组织状态与成员关系已由 TokenAuth 校验，这里不再重复查询
+func preConsumeOrgQuota(token *Token, quota int64) error {
+	orgQuota, err := GetOrgQuota(token.OrgId)
+	if err != nil {
+		return err
+	}
+	if orgQuota < quota {
+		return errors.New("Insufficient organization quota")
+	}
+	err = DecreaseTokenQuota(token.Id, quota)
+	if err != nil {
+		return err
+	}
+	return DecreaseOrgQuota(token.OrgId, quota)
+}
+
 func PostConsumeTokenQuota(tokenId int, quota int64) (err error) {
 	token, err := GetTokenById(tokenId)
+	if err == nil && token.OrgId > 0 {
+		return postConsumeOrgTokenQuota(token, quota)
+	}
 	if quota > 0 {
 		err = DecreaseUserQuota(token.UserId, quota)
 	} else {
@@ -385,3 +422,18 @@ func PostConsumeTokenQuota(tokenId int, quota int64) (err error) {
 	}
 	return nil
 }
+
+func postConsumeOrgTokenQuota(token *Token, quota int64) (err error) {
+	if quota > 0 {
+		err = DecreaseOrgQuota(token.OrgId, quota)
+	} else {
+		err = IncreaseOrgQuota(token.OrgId, -quota)
+	}
+	if err != nil {
+		return err
+	}
+	if quota > 0 {
+		return DecreaseTokenQuota(token.Id, quota)
+	}
+	return IncreaseTokenQuota(token.Id, -quota)
+}
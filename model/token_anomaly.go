@@ -0,0 +1,512 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
+)
+
+const (
+	AnomalyRuleRequestSpike = "request_spike" // 令牌请求数突增
+	AnomalyRuleQuotaSpike   = "quota_spike"   // 令牌额度消耗突增
+	AnomalyRuleModelMix     = "model_mix"     // 大部分消耗落在基线中从未用过的模型上
+	AnomalyRuleNewIP        = "new_ip"        // 窗口内出现多个从未见过的来源 IP
+	AnomalyRuleNewCountry   = "new_country"   // 出现从未见过的来源国家
+	AnomalyRuleUserSpike    = "user_spike"    // 用户所有令牌合计突增，只通知不冻结
+
+	AnomalyActionAlert  = "alert"
+	AnomalyActionFreeze = "freeze"
+)
+
+// TokenAnomaly 一次异常检测命中记录。令牌级异常按令牌 id 记录（同名令牌各记一条），用户级异常 TokenId 为 0。
+// 解冻令牌时该令牌未处理的记录一并标记为已处理
+type TokenAnomaly struct {
+	Id               int     `json:"id"`
+	UserId           int     `json:"user_id" gorm:"index"`
+	TokenId          int     `json:"token_id" gorm:"index"`
+	TokenName        string  `json:"token_name" gorm:"type:varchar(100);default:''"`
+	Rule             string  `json:"rule" gorm:"type:varchar(32)"`
+	Action           string  `json:"action" gorm:"type:varchar(16)"`
+	Detail           string  `json:"detail" gorm:"type:text"`
+	WindowStart      int64   `json:"window_start" gorm:"bigint"`
+	WindowEnd        int64   `json:"window_end" gorm:"bigint"`
+	Requests         int64   `json:"requests"`
+	Quota            int64   `json:"quota"`
+	ExpectedRequests float64 `json:"expected_requests"`
+	ExpectedQuota    float64 `json:"expected_quota"`
+	CreatedTime      int64   `json:"created_time" gorm:"bigint;index"`
+	ResolvedTime     int64   `json:"resolved_time" gorm:"bigint;default:0"`
+	ResolvedBy       int     `json:"resolved_by" gorm:"default:0"`
+}
+
+type anomalyKey struct {
+	UserId    int
+	TokenName string
+}
+
+// anomalyUsage 一个令牌（user_id + token_name）在某段时间内的用量，Models 为各模型的额度与请求数
+type anomalyUsage struct {
+	Requests    int64
+	Quota       int64
+	FirstSeen   int64
+	Models      map[string]int64
+	ModelCounts map[string]int64
+}
+
+func (u *anomalyUsage) add(model string, requests, quota, firstSeen int64) {
+	if u.Models == nil {
+		u.Models = make(map[string]int64)
+		u.ModelCounts = make(map[string]int64)
+	}
+	u.Requests += requests
+	u.Quota += quota
+	u.Models[model] += quota
+	u.ModelCounts[model] += requests
+	if u.FirstSeen == 0 || (firstSeen > 0 && firstSeen < u.FirstSeen) {
+		u.FirstSeen = firstSeen
+	}
+}
+
+var (
+	anomalyTaskOnce sync.Once
+	// notifyTokenAnomaly 测试中替换以捕获通知
+	notifyTokenAnomaly = sendTokenAnomalyAlert
+)
+
+func StartAnomalyDetectionTask() {
+	anomalyTaskOnce.Do(func() {
+		if !config.IsMasterNode || !config.AnomalyDetectionEnabled || config.AnomalyIntervalMinutes <= 0 {
+			return
+		}
+		common.SafeGoroutine(func() {
+			for {
+				func() {
+					defer func() {
+						if r := recover(); r != nil {
+							logger.SysError(fmt.Sprintf("anomaly detection: panic recovered: %v", r))
+						}
+					}()
+					if err := RunAnomalyDetection(time.Now()); err != nil {
+						logger.SysError("anomaly detection: " + err.Error())
+					}
+				}()
+				time.Sleep(time.Duration(config.AnomalyIntervalMinutes) * time.Minute)
+			}
+		})
+		logger.SysLog("anomaly detection task started")
+	})
+}
+
+// RunAnomalyDetection 比较 [now-窗口, now) 的用量与各令牌自身基线。
+// 基线取窗口之前 AnomalyBaselineDays 天的整点小时，开启用量汇总时读汇总表，否则直接查 logs
+func RunAnomalyDetection(now time.Time) error {
+	windowEnd := now.Unix()
+	window := int64(config.AnomalyWindowMinutes) * 60
+	if window <= 0 {
+		return errors.New("ANOMALY_WINDOW_MINUTES must be positive")
+	}
+	windowStart := windowEnd - window
+
+	current, err := getAnomalyWindowUsage(windowStart, windowEnd)
+	if err != nil {
+		return err
+	}
+	baselineEnd := windowStart / UsagePeriodHour * UsagePeriodHour
+	baselineStart := baselineEnd - int64(config.AnomalyBaselineDays)*UsagePeriodDay
+	baseline, err := getAnomalyBaselineUsage(baselineStart, baselineEnd, current)
+	if err != nil {
+		return err
+	}
+
+	userCurrent := make(map[int]*anomalyUsage)
+	userBaseline := make(map[int]*anomalyUsage)
+	for key, cur := range current {
+		if userCurrent[key.UserId] == nil {
+			userCurrent[key.UserId] = &anomalyUsage{}
+		}
+		userCurrent[key.UserId].add("", cur.Requests, cur.Quota, 0)
+		if hits := evaluateTokenUsage(cur, baseline[key], baselineStart, baselineEnd, window); len(hits) > 0 {
+			raiseTokenAnomaliesByName(key, hits, windowStart, windowEnd)
+		}
+	}
+	// 用户级基线包含窗口内没有流量的令牌
+	for key, base := range baseline {
+		if userBaseline[key.UserId] == nil {
+			userBaseline[key.UserId] = &anomalyUsage{}
+		}
+		userBaseline[key.UserId].add("", base.Requests, base.Quota, base.FirstSeen)
+	}
+	for userId, cur := range userCurrent {
+		for _, a := range evaluateTokenUsage(cur, userBaseline[userId], baselineStart, baselineEnd, window) {
+			if a.Rule != AnomalyRuleRequestSpike && a.Rule != AnomalyRuleQuotaSpike {
+				continue
+			}
+			a.UserId, a.Rule = userId, AnomalyRuleUserSpike
+			a.Detail = "用户全部令牌合计：" + a.Detail
+			a.WindowStart, a.WindowEnd = windowStart, windowEnd
+			raiseTokenAnomaly(nil, a)
+			break
+		}
+	}
+	return detectNewTokenSources(windowStart, windowEnd)
+}
+
+// evaluateTokenUsage 返回命中的突增与模型组合规则。历史不足 AnomalyMinBaselineHours 的令牌没有可信基线，不做判断
+func evaluateTokenUsage(cur, base *anomalyUsage, baselineStart, baselineEnd, window int64) []*TokenAnomaly {
+	if base == nil || base.Requests == 0 {
+		return nil
+	}
+	from := baselineStart
+	if base.FirstSeen > from {
+		from = base.FirstSeen
+	}
+	history := baselineEnd - from
+	if history < int64(config.AnomalyMinBaselineHours)*3600 || history <= 0 {
+		return nil
+	}
+	expRequests := float64(base.Requests) / float64(history) * float64(window)
+	expQuota := float64(base.Quota) / float64(history) * float64(window)
+	factor := config.AnomalySpikeFactor
+	newAnomaly := func(rule, detail string) *TokenAnomaly {
+		return &TokenAnomaly{Rule: rule, Detail: detail, Requests: cur.Requests, Quota: cur.Quota, ExpectedRequests: expRequests, ExpectedQuota: expQuota}
+	}
+	minutes := window / 60
+	var hits []*TokenAnomaly
+	if cur.Requests >= int64(config.AnomalyMinRequests) && float64(cur.Requests) > factor*expRequests {
+		hits = append(hits, newAnomaly(AnomalyRuleRequestSpike,
+			fmt.Sprintf("最近 %d 分钟 %d 次请求，基线约 %.1f 次", minutes, cur.Requests, expRequests)))
+	}
+	if cur.Quota >= int64(config.AnomalyMinQuota) && float64(cur.Quota) > factor*expQuota {
+		hits = append(hits, newAnomaly(AnomalyRuleQuotaSpike,
+			fmt.Sprintf("最近 %d 分钟消耗 $%.2f，基线约 $%.2f", minutes, float64(cur.Quota)/config.QuotaPerUnit, expQuota/config.QuotaPerUnit)))
+	}
+	if cur.Requests >= int64(config.AnomalyMinRequests) || cur.Quota >= int64(config.AnomalyMinQuota) {
+		var unseen []string
+		var unseenQuota, unseenRequests int64
+		for model, quota := range cur.Models {
+			if _, ok := base.Models[model]; !ok {
+				unseen = append(unseen, model)
+				unseenQuota += quota
+				unseenRequests += cur.ModelCounts[model]
+			}
+		}
+		share := 0.0
+		if cur.Quota > 0 {
+			share = float64(unseenQuota) / float64(cur.Quota)
+		} else if cur.Requests > 0 {
+			share = float64(unseenRequests) / float64(cur.Requests)
+		}
+		if len(unseen) > 0 && share >= config.AnomalyModelMixShare {
+			sort.Strings(unseen)
+			hits = append(hits, newAnomaly(AnomalyRuleModelMix,
+				fmt.Sprintf("最近 %d 分钟 %.0f%% 的用量来自从未使用过的模型：%s", minutes, share*100, strings.Join(unseen, ", "))))
+		}
+	}
+	return hits
+}
+
+func getAnomalyWindowUsage(start, end int64) (map[anomalyKey]*anomalyUsage, error) {
+	var rows []struct {
+		UserId    int
+		TokenName string
+		ModelName string
+		Requests  int64
+		Quota     int64
+	}
+	tx := applyLogIdRange(LOG_DB.Table("logs"), start, end-1)
+	err := applyBillableLogTypes(tx).
+		Select("user_id, token_name, model_name, COUNT(*) AS requests, COALESCE(SUM(quota), 0) AS quota").
+		Where("created_at >= ? AND created_at < ? AND user_id > 0", start, end).
+		Group("user_id, token_name, model_name").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	usage := make(map[anomalyKey]*anomalyUsage)
+	for _, r := range rows {
+		key := anomalyKey{r.UserId, r.TokenName}
+		if usage[key] == nil {
+			usage[key] = &anomalyUsage{}
+		}
+		usage[key].add(r.ModelName, r.Requests, r.Quota, 0)
+	}
+	return usage, nil
+}
+
+// getAnomalyBaselineUsage 只查当前窗口内有流量的用户。FirstSeen 为令牌在基线区间内第一次出现的时间
+func getAnomalyBaselineUsage(start, end int64, current map[anomalyKey]*anomalyUsage) (map[anomalyKey]*anomalyUsage, error) {
+	usage := make(map[anomalyKey]*anomalyUsage)
+	if len(current) == 0 || end <= start {
+		return usage, nil
+	}
+	userIdSet := make(map[int]bool)
+	for key := range current {
+		userIdSet[key.UserId] = true
+	}
+	userIds := make([]int, 0, len(userIdSet))
+	for id := range userIdSet {
+		userIds = append(userIds, id)
+	}
+	var rows []struct {
+		UserId    int
+		TokenName string
+		ModelName string
+		Requests  int64
+		Quota     int64
+		FirstSeen int64
+	}
+	for i := 0; i < len(userIds); i += 500 {
+		batch := userIds[i:min(i+500, len(userIds))]
+		var part []struct {
+			UserId    int
+			TokenName string
+			ModelName string
+			Requests  int64
+			Quota     int64
+			FirstSeen int64
+		}
+		var err error
+		if config.UsageRollupEnabled {
+			err = LOG_DB.Model(&UsageRollup{}).
+				Select("user_id, token_name, model_name, SUM(requests) AS requests, SUM(quota) AS quota, MIN(bucket_start) AS first_seen").
+				Where("period = ? AND bucket_start >= ? AND bucket_start < ? AND user_id IN ?", UsagePeriodHour, start, end, batch).
+				Group("user_id, token_name, model_name").
+				Scan(&part).Error
+		} else {
+			tx := applyLogIdRange(LOG_DB.Table("logs"), start, end-1)
+			err = applyBillableLogTypes(tx).
+				Select("user_id, token_name, model_name, COUNT(*) AS requests, COALESCE(SUM(quota), 0) AS quota, MIN(created_at) AS first_seen").
+				Where("created_at >= ? AND created_at < ? AND user_id IN ?", start, end, batch).
+				Group("user_id, token_name, model_name").
+				Scan(&part).Error
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, part...)
+	}
+	for _, r := range rows {
+		key := anomalyKey{r.UserId, r.TokenName}
+		if usage[key] == nil {
+			usage[key] = &anomalyUsage{}
+		}
+		usage[key].add(r.ModelName, r.Requests, r.Quota, r.FirstSeen)
+	}
+	return usage, nil
+}
+
+// detectNewTokenSources 窗口内首次出现的来源与令牌此前的来源比较。令牌此前没有任何来源记录时（新令牌或刚开启检测）不判断
+func detectNewTokenSources(windowStart, windowEnd int64) error {
+	var fresh []TokenSource
+	if err := DB.Where("first_seen >= ? AND first_seen < ?", windowStart, windowEnd).Find(&fresh).Error; err != nil {
+		return err
+	}
+	byToken := make(map[int][]TokenSource)
+	for _, src := range fresh {
+		byToken[src.TokenId] = append(byToken[src.TokenId], src)
+	}
+	tokenIds := make([]int, 0, len(byToken))
+	for id := range byToken {
+		tokenIds = append(tokenIds, id)
+	}
+	sort.Ints(tokenIds)
+	for _, tokenId := range tokenIds {
+		var known []TokenSource
+		if err := DB.Select("ip", "country").Where("token_id = ? AND first_seen < ?", tokenId, windowStart).Find(&known).Error; err != nil {
+			return err
+		}
+		if len(known) == 0 {
+			continue
+		}
+		token, err := GetTokenById(tokenId)
+		if err != nil || token.Status != common.TokenStatusEnabled {
+			continue
+		}
+		knownCountries := make(map[string]bool)
+		for _, src := range known {
+			if src.Country != "" {
+				knownCountries[src.Country] = true
+			}
+		}
+		var newIps []string
+		newCountries := make(map[string]bool)
+		for _, src := range byToken[tokenId] {
+			newIps = append(newIps, src.Ip)
+			if src.Country != "" && len(knownCountries) > 0 && !knownCountries[src.Country] {
+				newCountries[src.Country] = true
+			}
+		}
+		base := TokenAnomaly{UserId: token.UserId, TokenName: token.Name, WindowStart: windowStart, WindowEnd: windowEnd}
+		if len(newCountries) > 0 {
+			countries := make([]string, 0, len(newCountries))
+			for c := range newCountries {
+				countries = append(countries, c)
+			}
+			sort.Strings(countries)
+			a := base
+			a.Rule = AnomalyRuleNewCountry
+			a.Detail = fmt.Sprintf("出现新的来源国家 %s，此前只出现过 %d 个国家", strings.Join(countries, ", "), len(knownCountries))
+			raiseTokenAnomaly(token, &a)
+		}
+		if len(newIps) >= config.AnomalyNewIPThreshold && config.AnomalyNewIPThreshold > 0 {
+			sort.Strings(newIps)
+			shown := newIps
+			if len(shown) > 5 {
+				shown = shown[:5]
+			}
+			a := base
+			a.Rule = AnomalyRuleNewIP
+			a.Detail = fmt.Sprintf("最近 %d 分钟出现 %d 个新的来源 IP：%s", (windowEnd-windowStart)/60, len(newIps), strings.Join(shown, ", "))
+			raiseTokenAnomaly(token, &a)
+		}
+	}
+	return nil
+}
+
+// raiseTokenAnomaliesByName 日志只记录令牌名，按名字找到用户当前启用的令牌；同名令牌都会处理
+func raiseTokenAnomaliesByName(key anomalyKey, hits []*TokenAnomaly, windowStart, windowEnd int64) {
+	var tokens []*Token
+	if err := DB.Where("user_id = ? AND name = ? AND status = ?", key.UserId, key.TokenName, common.TokenStatusEnabled).Find(&tokens).Error; err != nil {
+		logger.SysError("anomaly detection: failed to load tokens: " + err.Error())
+		return
+	}
+	for _, token := range tokens {
+		for _, hit := range hits {
+			a := *hit
+			a.WindowStart, a.WindowEnd = windowStart, windowEnd
+			raiseTokenAnomaly(token, &a)
+		}
+	}
+}
+
+// raiseTokenAnomaly 记录异常并按配置通知或冻结。token 为 nil 表示用户级异常。同一对象同一规则在静默期内只处理一次
+func raiseTokenAnomaly(token *Token, a *TokenAnomaly) {
+	now := helper.GetTimestamp()
+	if token != nil {
+		a.TokenId, a.UserId, a.TokenName = token.Id, token.UserId, token.Name
+	}
+	var recent int64
+	err := DB.Model(&TokenAnomaly{}).
+		Where("user_id = ? AND token_id = ? AND rule = ? AND created_time >= ?", a.UserId, a.TokenId, a.Rule, now-int64(config.AnomalyCooldownMinutes)*60).
+		Count(&recent).Error
+	if err != nil || recent > 0 {
+		return
+	}
+	a.Action = AnomalyActionAlert
+	if token != nil && token.Status == common.TokenStatusEnabled && shouldFreezeOnRule(a.Rule) {
+		a.Action = AnomalyActionFreeze
+	}
+	a.CreatedTime = now
+	if err := DB.Create(a).Error; err != nil {
+		logger.SysError("anomaly detection: failed to record anomaly: " + err.Error())
+		return
+	}
+	if a.Action == AnomalyActionFreeze {
+		if err := freezeToken(token, fmt.Sprintf("[%s] %s", a.Rule, a.Detail)); err != nil {
+			logger.SysError(fmt.Sprintf("anomaly detection: failed to freeze token %d: %s", token.Id, err.Error()))
+		}
+	}
+	notifyTokenAnomaly(a)
+}
+
+func shouldFreezeOnRule(rule string) bool {
+	if config.AnomalyAction != AnomalyActionFreeze {
+		return false
+	}
+	for _, r := range strings.Split(config.AnomalyFreezeRules, ",") {
+		if strings.TrimSpace(r) == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func freezeToken(token *Token, reason string) error {
+	if len(reason) > 500 {
+		reason = reason[:500]
+	}
+	now := helper.GetTimestamp()
+	err := DB.Model(&Token{}).Where("id = ? AND status = ?", token.Id, common.TokenStatusEnabled).
+		Updates(map[string]interface{}{"status": common.TokenStatusFrozen, "frozen_reason": reason, "frozen_time": now}).Error
+	if err != nil {
+		return err
+	}
+	token.Status, token.FrozenReason, token.FrozenTime = common.TokenStatusFrozen, reason, now
+	invalidateTokenCache(token)
+	return nil
+}
+
+// UnfreezeToken 用户或管理员确认后解冻令牌，该令牌未处理的异常记录标记为已处理。
+// 解冻后静默期内同一规则不会再次冻结
+func UnfreezeToken(token *Token, operatorId int) error {
+	if token.Status != common.TokenStatusFrozen {
+		return errors.New("The token is not frozen")
+	}
+	err := DB.Model(&Token{}).Where("id = ?", token.Id).
+		Updates(map[string]interface{}{"status": common.TokenStatusEnabled, "frozen_reason": "", "frozen_time": 0}).Error
+	if err != nil {
+		return err
+	}
+	token.Status, token.FrozenReason, token.FrozenTime = common.TokenStatusEnabled, "", 0
+	invalidateTokenCache(token)
+	return DB.Model(&TokenAnomaly{}).Where("token_id = ? AND resolved_time = 0", token.Id).
+		Updates(map[string]interface{}{"resolved_time": helper.GetTimestamp(), "resolved_by": operatorId}).Error
+}
+
+func invalidateTokenCache(token *Token) {
+	if !common.RedisEnabled || common.RDB == nil || token.Key == "" {
+		return
+	}
+	if err := common.RedisDel(fmt.Sprintf("token:%s", token.Key)); err != nil {
+		logger.SysError("failed to invalidate token cache: " + err.Error())
+	}
+}
+
+// GetTokenAnomalies userId 为 0 时返回全部用户的记录
+func GetTokenAnomalies(userId int, tokenId int, startIdx int, num int) ([]*TokenAnomaly, int64, error) {
+	tx := DB.Model(&TokenAnomaly{})
+	if userId > 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if tokenId > 0 {
+		tx = tx.Where("token_id = ?", tokenId)
+	}
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var records []*TokenAnomaly
+	err := tx.Order("id desc").Limit(num).Offset(startIdx).Find(&records).Error
+	return records, total, err
+}
+
+func sendTokenAnomalyAlert(a *TokenAnomaly) {
+	target := fmt.Sprintf("令牌 %s", a.TokenName)
+	if a.TokenId == 0 {
+		target = "账号"
+	}
+	subject := fmt.Sprintf("%s 用量异常", target)
+	content := fmt.Sprintf("%s 在 %s ~ %s 检测到异常（%s）：%s。",
+		target, time.Unix(a.WindowStart, 0).Format("2006-01-02 15:04"), time.Unix(a.WindowEnd, 0).Format("2006-01-02 15:04"), a.Rule, a.Detail)
+	if a.Action == AnomalyActionFreeze {
+		subject = fmt.Sprintf("%s 因用量异常已被冻结", target)
+		content += "该令牌已被自动冻结，如确认是本人操作，请在令牌列表中查看并解冻；否则请删除该令牌并检查密钥是否泄露。"
+	}
+	if user, err := GetUserById(a.UserId, false); err == nil && user.Email != "" {
+		if err := message.SendEmail(subject, user.Email, content); err != nil {
+			logger.SysError(fmt.Sprintf("failed to send anomaly email to user %d: %s", a.UserId, err.Error()))
+		}
+	}
+	if err := message.Notify(message.ByEmail, subject, "", fmt.Sprintf("用户 id=%d：%s", a.UserId, content)); err != nil {
+		logger.SysError("failed to notify admin of token anomaly: " + err.Error())
+	}
+}
@@ -0,0 +1,128 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func setupTokenAnomalyTestDB(t *testing.T) *[]*TokenAnomaly {
+	setupUsageRollupTestDB(t, &TokenSource{}, &TokenAnomaly{})
+	origAction, origMinReq, origMinQuota, origIPs := config.AnomalyAction, config.AnomalyMinRequests, config.AnomalyMinQuota, config.AnomalyNewIPThreshold
+	origNotify, origRedis := notifyTokenAnomaly, common.RedisEnabled
+	common.RedisEnabled = false
+	config.AnomalyAction, config.AnomalyMinRequests, config.AnomalyMinQuota, config.AnomalyNewIPThreshold = AnomalyActionFreeze, 5, 1000, 2
+	var notified []*TokenAnomaly
+	notifyTokenAnomaly = func(a *TokenAnomaly) { notified = append(notified, a) }
+	t.Cleanup(func() {
+		config.AnomalyAction, config.AnomalyMinRequests, config.AnomalyMinQuota, config.AnomalyNewIPThreshold = origAction, origMinReq, origMinQuota, origIPs
+		notifyTokenAnomaly, common.RedisEnabled = origNotify, origRedis
+	})
+	return &notified
+}
+
+func TestAnomalyDetectionFreezesAndUnfreezes(t *testing.T) {
+	notified := setupTokenAnomalyTestDB(t)
+	DB.Create(&User{Id: 1, Username: "alice", AccessToken: "a", AffCode: "a"})
+	t1 := &Token{Id: 1, UserId: 1, Name: "t1", Key: "k1", Status: common.TokenStatusEnabled, ExpiredTime: -1, UnlimitedQuota: true}
+	t2 := &Token{Id: 2, UserId: 1, Name: "t2", Key: "k2", Status: common.TokenStatusEnabled, ExpiredTime: -1, UnlimitedQuota: true}
+	t3 := &Token{Id: 3, UserId: 1, Name: "t3", Key: "k3", Status: common.TokenStatusEnabled, ExpiredTime: -1, UnlimitedQuota: true}
+	DB.Create(t1)
+	DB.Create(t2)
+	DB.Create(t3)
+
+	now := time.Date(2026, 3, 10, 12, 30, 0, 0, time.UTC)
+	windowStart := now.Unix() - int64(config.AnomalyWindowMinutes)*60
+	baselineEnd := windowStart / 3600 * 3600
+	// 两天基线：t1 每小时 2 次 / 100 额度，t2 每小时 10 次 / 1000 额度且只用 gpt-4o-mini
+	for h := int64(1); h <= 48; h++ {
+		bucket := baselineEnd - h*3600
+		DB.Create(&UsageRollup{Period: UsagePeriodHour, BucketStart: bucket, UserId: 1, TokenName: "t1", ModelName: "gpt-4o", ChannelId: 1, UsageMetrics: UsageMetrics{Requests: 2, Quota: 100}})
+		DB.Create(&UsageRollup{Period: UsagePeriodHour, BucketStart: bucket, UserId: 1, TokenName: "t2", ModelName: "gpt-4o-mini", ChannelId: 1, UsageMetrics: UsageMetrics{Requests: 10, Quota: 1000}})
+	}
+	for i := 0; i < 20; i++ {
+		DB.Create(&Log{UserId: 1, TokenName: "t1", ModelName: "gpt-4o", CreatedAt: now.Unix() - 60, Type: LogTypeConsume, Quota: 500})
+	}
+	for i := 0; i < 6; i++ {
+		DB.Create(&Log{UserId: 1, TokenName: "t2", ModelName: "claude-opus", CreatedAt: now.Unix() - 60, Type: LogTypeConsume, Quota: 300})
+	}
+	// t3 没有基线，单独不判断，但会计入用户合计
+	for i := 0; i < 50; i++ {
+		DB.Create(&Log{UserId: 1, TokenName: "t3", ModelName: "gpt-4o", CreatedAt: now.Unix() - 60, Type: LogTypeConsume, Quota: 10})
+	}
+	DB.Create(&TokenSource{TokenId: 2, Ip: "1.1.1.1", Country: "US", FirstSeen: baselineEnd - 86400, LastSeen: baselineEnd})
+	DB.Create(&TokenSource{TokenId: 2, Ip: "2.2.2.2", Country: "DE", FirstSeen: now.Unix() - 120, LastSeen: now.Unix()})
+	DB.Create(&TokenSource{TokenId: 3, Ip: "3.3.3.3", FirstSeen: now.Unix() - 120, LastSeen: now.Unix()})
+
+	if err := RunAnomalyDetection(now); err != nil {
+		t.Fatalf("检测失败: %v", err)
+	}
+	rules := map[string]string{}
+	var events []*TokenAnomaly
+	DB.Order("id asc").Find(&events)
+	for _, e := range events {
+		rules[e.Rule+"@"+e.TokenName] = e.Action
+	}
+	want := map[string]string{
+		"request_spike@t1": AnomalyActionFreeze,
+		"quota_spike@t1":   AnomalyActionAlert, // 已被前一条规则冻结
+		"model_mix@t2":     AnomalyActionAlert,
+		"new_country@t2":   AnomalyActionFreeze,
+		"user_spike@":      AnomalyActionAlert,
+	}
+	if len(events) != len(want) || len(*notified) != len(want) {
+		t.Fatalf("命中规则不符: %v", rules)
+	}
+	for k, v := range want {
+		if rules[k] != v {
+			t.Errorf("%s 应为 %s, got %q (all %v)", k, v, rules[k], rules)
+		}
+	}
+
+	_, err := ValidateUserToken("k1")
+	if err == nil || !strings.Contains(err.Error(), "request_spike") {
+		t.Errorf("冻结的令牌应拒绝并给出原因: %v", err)
+	}
+	DB.First(t1, 1)
+	if t1.Status != common.TokenStatusFrozen || t1.FrozenReason == "" {
+		t.Fatalf("t1 应被冻结: %+v", t1)
+	}
+
+	if err := UnfreezeToken(t1, 1); err != nil {
+		t.Fatalf("解冻失败: %v", err)
+	}
+	if err := UnfreezeToken(t1, 1); err == nil {
+		t.Errorf("未冻结的令牌不能再次解冻")
+	}
+	var unresolved int64
+	DB.Model(&TokenAnomaly{}).Where("token_id = ? AND resolved_time = 0", 1).Count(&unresolved)
+	if unresolved != 0 {
+		t.Errorf("解冻后该令牌的异常记录应标记为已处理")
+	}
+	// 静默期内重复检测不会再次冻结或通知
+	if err := RunAnomalyDetection(now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	DB.First(t1, 1)
+	if t1.Status != common.TokenStatusEnabled || len(*notified) != len(want) {
+		t.Errorf("静默期内不应重复处理: status=%d notified=%d", t1.Status, len(*notified))
+	}
+	list, total, _ := GetTokenAnomalies(1, 2, 0, 10)
+	if total != 2 || list[0].Rule != AnomalyRuleNewCountry {
+		t.Errorf("按令牌查询异常记录不符: %d %+v", total, list)
+	}
+}
+
+func TestUpsertTokenSourceKeepsFirstSeen(t *testing.T) {
+	setupTokenAnomalyTestDB(t)
+	_ = upsertTokenSource(TokenSource{TokenId: 1, Ip: "1.1.1.1", FirstSeen: 100, LastSeen: 100})
+	_ = upsertTokenSource(TokenSource{TokenId: 1, Ip: "1.1.1.1", Country: "JP", FirstSeen: 200, LastSeen: 200})
+	var sources []TokenSource
+	DB.Find(&sources)
+	if len(sources) != 1 || sources[0].FirstSeen != 100 || sources[0].LastSeen != 200 || sources[0].Country != "JP" {
+		t.Errorf("重复来源应只更新 last_seen / country: %+v", sources)
+	}
+}
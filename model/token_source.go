@@ -0,0 +1,85 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm/clause"
+)
+
+// TokenSource 令牌出现过的来源 IP，异常检测据此发现新 IP / 新国家。
+// 国家取自 AnomalyCountryHeader 指定的请求头（如 Cloudflare 的 CF-IPCountry），未配置时为空
+type TokenSource struct {
+	Id        int    `json:"id"`
+	TokenId   int    `json:"token_id" gorm:"uniqueIndex:idx_token_source"`
+	Ip        string `json:"ip" gorm:"type:varchar(64);uniqueIndex:idx_token_source"`
+	Country   string `json:"country" gorm:"type:varchar(8);default:''"`
+	FirstSeen int64  `json:"first_seen" gorm:"bigint;index"`
+	LastSeen  int64  `json:"last_seen" gorm:"bigint"`
+}
+
+const (
+	// 同一令牌同一 IP 在该时间内只写一次库
+	tokenSourceRefreshSeconds = 600
+	tokenSourceSeenMaxEntries = 100000
+)
+
+var (
+	tokenSourceMu    sync.Mutex
+	tokenSourceSeen  = make(map[string]int64)
+	tokenSourceQueue = make(chan TokenSource, 10000)
+	tokenSourceOnce  sync.Once
+)
+
+// ObserveTokenSource 记录一次令牌请求的来源，由鉴权中间件调用。
+// 进程内去重后异步写库，队列满时丢弃，不阻塞请求
+func ObserveTokenSource(tokenId int, ip string, country string) {
+	if !config.AnomalyDetectionEnabled || tokenId == 0 || ip == "" {
+		return
+	}
+	now := helper.GetTimestamp()
+	key := fmt.Sprintf("%d|%s", tokenId, ip)
+	tokenSourceMu.Lock()
+	if now-tokenSourceSeen[key] < tokenSourceRefreshSeconds {
+		tokenSourceMu.Unlock()
+		return
+	}
+	if len(tokenSourceSeen) >= tokenSourceSeenMaxEntries {
+		tokenSourceSeen = make(map[string]int64)
+	}
+	tokenSourceSeen[key] = now
+	tokenSourceMu.Unlock()
+
+	tokenSourceOnce.Do(func() { common.SafeGoroutine(tokenSourceWriter) })
+	if len(country) > 8 {
+		country = country[:8]
+	}
+	select {
+	case tokenSourceQueue <- TokenSource{TokenId: tokenId, Ip: ip, Country: strings.ToUpper(country), FirstSeen: now, LastSeen: now}:
+	default:
+	}
+}
+
+func tokenSourceWriter() {
+	for src := range tokenSourceQueue {
+		if err := upsertTokenSource(src); err != nil {
+			logger.SysError("failed to record token source: " + err.Error())
+		}
+	}
+}
+
+func upsertTokenSource(src TokenSource) error {
+	updates := []string{"last_seen"}
+	if src.Country != "" {
+		updates = append(updates, "country")
+	}
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "token_id"}, {Name: "ip"}},
+		DoUpdates: clause.AssignmentColumns(updates),
+	}).Create(&src).Error
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
@@ -25,8 +24,24 @@ type TopUp struct {
 	Status        string  `json:"status" gorm:"type:varchar(20);default:'pending'"`
 	// Other 扩展 JSON：管理员补单时写入 TopUpManualCompleteMeta 等，支付回调留空
 	Other string `json:"other" gorm:"type:longtext"`
+	// OrgId 非 0 时充值入账到组织额度池，UserId 仍记录下单的成员
+	OrgId int `json:"org_id" gorm:"index;default:0"`
+	// Provider 支付渠道适配器名称，见 common/payment；老订单为空，按 PaymentMethod 推断
+	Provider    string `json:"provider" gorm:"type:varchar(32);index"`
+	ProviderRef string `json:"provider_ref" gorm:"type:varchar(255)"` // 网关侧订单引用，查单和退款时使用
+	// Quota 入账额度，0 表示按 Amount × QuotaPerUnit 计算
+	Quota        int64 `json:"quota" gorm:"bigint;default:0"`
+	RefundedTime int64 `json:"refunded_time" gorm:"bigint;default:0"`
 }
 
+const (
+	TopUpStatusPending  = "pending"
+	TopUpStatusSuccess  = "success"
+	TopUpStatusFailed   = "failed"
+	TopUpStatusExpired  = "expired"
+	TopUpStatusRefunded = "refunded"
+)
+
 // TopUpManualCompleteMeta 补单入账详情（写入 other，可继续加字段）
 type TopUpManualCompleteMeta struct {
 	Source              string `json:"source"` // 固定 manual_complete
@@ -80,7 +95,8 @@ func SearchTopUps(userId int, tradeNo string, page int, pageSize int) (topups []
 
 // CompleteTopUpOrder 易支付等回调完成订单（保留创建时的 money / currency）
 func CompleteTopUpOrder(tradeNo string) error {
-	return completeTopUpOrder(tradeNo, nil, nil, "")
+	_, err := completeTopUpOrder(tradeNo, topUpCompletion{})
+	return err
 }
 
 // CompleteTopUpOrderManual 管理员补单：将详情序列化写入 other
@@ -95,58 +111,95 @@ func CompleteTopUpOrderManual(tradeNo string, meta TopUpManualCompleteMeta) erro
 	if err != nil {
 		return err
 	}
-	return completeTopUpOrder(tradeNo, nil, nil, string(b))
+	_, err = completeTopUpOrder(tradeNo, topUpCompletion{manualOther: string(b)})
+	return err
+}
+
+// topUpCompletion 完成订单时写回的网关信息；money / currency 非空时以网关实付为准（如 Stripe Checkout 回调），
+// manualOther 非空时表示管理员补单，写入 other
+type topUpCompletion struct {
+	money       *float64
+	currency    *string
+	manualOther string
+	providerRef string
+	quota       int64
 }
 
-// completeTopUpOrder 完成充值；moneyOverride / currencyOverride 非空时写回（Stripe 以 Checkout 回调为准）
-// manualOtherJSON 非空时表示管理员补单，写入 other
-func completeTopUpOrder(tradeNo string, moneyOverride *float64, currencyOverride *string, manualOtherJSON string) error {
+// completeTopUpOrder 订单进入 success 并入账，是所有支付渠道共用的入账路径。
+// 以原状态为条件更新订单，只有真正把订单改为 success 的那次调用入账，重复或并发回调返回 changed=false。
+// 失败或过期的订单仍允许完成：网关确认收款时钱已经到账，不能因本地状态拒绝入账。
+func completeTopUpOrder(tradeNo string, completion topUpCompletion) (changed bool, err error) {
 	if tradeNo == "" {
-		return errors.New("未提供订单号")
+		return false, errors.New("未提供订单号")
 	}
 
 	var userId int
+	var orgId int
 	var quotaToAdd int64
 	var money float64
 	var currency string
 
-	err := DB.Transaction(func(tx *gorm.DB) error {
+	err = DB.Transaction(func(tx *gorm.DB) error {
 		var topUp TopUp
-		if err := tx.Set("gorm:query_option", "FOR UPDATE").
-			Where("trade_no = ?", tradeNo).First(&topUp).Error; err != nil {
+		if err := tx.Where("trade_no = ?", tradeNo).First(&topUp).Error; err != nil {
 			return errors.New("充值订单不存在")
 		}
 
-		if topUp.Status != "pending" {
+		completable := []string{TopUpStatusPending, TopUpStatusFailed, TopUpStatusExpired}
+		switch topUp.Status {
+		case TopUpStatusPending, TopUpStatusFailed, TopUpStatusExpired:
+		default:
 			return nil
 		}
 
-		quotaToAdd = int64(float64(topUp.Amount) * config.QuotaPerUnit)
+		if completion.quota > 0 {
+			topUp.Quota = completion.quota
+		}
+		quotaToAdd = topUpQuota(&topUp)
 		if quotaToAdd <= 0 {
 			return errors.New("无效的充值额度")
 		}
+		topUp.Quota = quotaToAdd
 
-		if moneyOverride != nil {
-			topUp.Money = *moneyOverride
+		if completion.money != nil {
+			topUp.Money = *completion.money
+		}
+		if completion.currency != nil && *completion.currency != "" {
+			topUp.Currency = *completion.currency
 		}
-		if currencyOverride != nil && *currencyOverride != "" {
-			topUp.Currency = *currencyOverride
+		if completion.providerRef != "" {
+			topUp.ProviderRef = completion.providerRef
 		}
 
-		if manualOtherJSON != "" {
-			topUp.Other = manualOtherJSON
+		if completion.manualOther != "" {
+			topUp.Other = completion.manualOther
 		}
 
-		topUp.Status = "success"
+		topUp.Status = TopUpStatusSuccess
 		topUp.CompleteTime = helper.GetTimestamp()
-		if err := tx.Save(&topUp).Error; err != nil {
-			return err
+		result := tx.Model(&topUp).Where("status IN ?", completable).
+			Select("quota", "money", "currency", "provider_ref", "other", "status", "complete_time").Updates(&topUp)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			// 并发回调已先一步完成入账
+			return nil
 		}
 
-		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).
+		if topUp.OrgId > 0 {
+			if err := tx.Model(&Organization{}).Where("id = ?", topUp.OrgId).
+				Update("quota", gorm.Expr("quota + ?", quotaToAdd)).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).
 			Update("quota", gorm.Expr("quota + ?", quotaToAdd)).Error; err != nil {
 			return err
 		}
+		if err := recordAffiliateCommission(tx, topUp.UserId, AffiliateSourceTopUp, topUp.TradeNo, quotaToAdd, topUp.Money, topUp.Currency); err != nil {
+			return err
+		}
+		orgId = topUp.OrgId
 
 		userId = topUp.UserId
 		money = topUp.Money
@@ -155,7 +208,7 @@ func completeTopUpOrder(tradeNo string, moneyOverride *float64, currencyOverride
 	})
 
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	if userId > 0 && quotaToAdd > 0 {
@@ -163,27 +216,23 @@ func completeTopUpOrder(tradeNo string, moneyOverride *float64, currencyOverride
 		if currency != "" {
 			curNote = " " + currency
 		}
+		if orgId > 0 {
+			curNote += fmt.Sprintf("，入账组织 #%d", orgId)
+		}
 		RecordLog(userId, LogTypeTopup, fmt.Sprintf("在线充值成功，充值金额: %d，支付金额: %.2f%s", quotaToAdd, money, curNote))
-		if manualOtherJSON != "" {
-			logger.SysLog(fmt.Sprintf("管理员补单入账: other=%s, buyerUserId=%d, tradeNo=%s, quota=%d, money=%.2f %s", manualOtherJSON, userId, tradeNo, quotaToAdd, money, currency))
+		if completion.manualOther != "" {
+			logger.SysLog(fmt.Sprintf("管理员补单入账: other=%s, buyerUserId=%d, tradeNo=%s, quota=%d, money=%.2f %s", completion.manualOther, userId, tradeNo, quotaToAdd, money, currency))
 		} else {
 			logger.SysLog(fmt.Sprintf("在线充值成功: userId=%d, tradeNo=%s, quota=%d, money=%.2f %s", userId, tradeNo, quotaToAdd, money, currency))
 		}
 	}
-	return nil
+	return userId > 0, nil
 }
 
-// StripeAmountTotalToMajor 将 Checkout Session 的 amount_total（最小货币单位）转为展示用主单位金额
-func StripeAmountTotalToMajor(amountTotal int64, currency string) float64 {
-	c := strings.ToLower(strings.TrimSpace(currency))
-	// https://docs.stripe.com/currencies#minor-units 零小数货币
-	zeroDecimal := map[string]bool{
-		"bif": true, "clp": true, "djf": true, "gnf": true, "jpy": true,
-		"kmf": true, "krw": true, "mga": true, "pyg": true, "rwf": true,
-		"ugx": true, "vnd": true, "vuv": true, "xaf": true, "xof": true, "xpf": true,
-	}
-	if zeroDecimal[c] {
-		return float64(amountTotal)
+// topUpQuota 订单入账额度，Quota 为 0 的老订单按 Amount × QuotaPerUnit 计算
+func topUpQuota(topUp *TopUp) int64 {
+	if topUp.Quota > 0 {
+		return topUp.Quota
 	}
-	return float64(amountTotal) / 100.0
+	return int64(float64(topUp.Amount) * config.QuotaPerUnit)
 }
@@ -0,0 +1,582 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+)
+
+const (
+	UsagePeriodHour int64 = 3600
+	UsagePeriodDay  int64 = 86400
+
+	usageRollupCursorName = "usage"
+	usageCoverageCacheTTL = 30 * time.Second
+)
+
+// UsageMetrics 用量汇总的可累加指标，只统计 LogTypeConsume / LogTypeError（口径同 applyBillableLogTypes）。
+// LatB* / FwlB* 为总耗时与首字延迟的直方图计数，桶边界为 LatencyBoundaries，只统计 > 0 的值。
+type UsageMetrics struct {
+	Requests         int64   `json:"requests" gorm:"default:0"`
+	SuccessRequests  int64   `json:"success_requests" gorm:"default:0"`
+	ErrorRequests    int64   `json:"error_requests" gorm:"default:0"`
+	Quota            int64   `json:"quota" gorm:"default:0"`
+	PromptTokens     int64   `json:"prompt_tokens" gorm:"default:0"`
+	CompletionTokens int64   `json:"completion_tokens" gorm:"default:0"`
+	CachedTokens     int64   `json:"cached_tokens" gorm:"default:0"`
+	SumDuration      float64 `json:"-" gorm:"default:0"`
+	DurationCount    int64   `json:"-" gorm:"default:0"`
+	SumFirstWord     float64 `json:"-" gorm:"default:0"`
+	FirstWordCount   int64   `json:"-" gorm:"default:0"`
+	SumSpeed         float64 `json:"-" gorm:"default:0"`
+	SpeedCount       int64   `json:"-" gorm:"default:0"`
+	LatB0            int64   `json:"-" gorm:"default:0"`
+	LatB1            int64   `json:"-" gorm:"default:0"`
+	LatB2            int64   `json:"-" gorm:"default:0"`
+	LatB3            int64   `json:"-" gorm:"default:0"`
+	LatB4            int64   `json:"-" gorm:"default:0"`
+	LatB5            int64   `json:"-" gorm:"default:0"`
+	LatB6            int64   `json:"-" gorm:"default:0"`
+	LatB7            int64   `json:"-" gorm:"default:0"`
+	FwlB0            int64   `json:"-" gorm:"default:0"`
+	FwlB1            int64   `json:"-" gorm:"default:0"`
+	FwlB2            int64   `json:"-" gorm:"default:0"`
+	FwlB3            int64   `json:"-" gorm:"default:0"`
+	FwlB4            int64   `json:"-" gorm:"default:0"`
+	FwlB5            int64   `json:"-" gorm:"default:0"`
+	FwlB6            int64   `json:"-" gorm:"default:0"`
+	FwlB7            int64   `json:"-" gorm:"default:0"`
+}
+
+// UsageRollup 用量汇总表（LOG_DB），Period 为 3600 的小时行与 86400 的日行共用一张表。
+//
+// 小时行由 Worker 从 logs 增量汇总；日行由当天的小时行再汇总得到。UserGroup 取汇总时用户所在分组，
+// Username 同理，都不参与唯一键。
+// 索引：idx_usage_key (唯一) 用于重算时去重；idx_usage_user 服务按用户的 Dashboard 和曲线图。
+type UsageRollup struct {
+	Id          int64  `json:"-" gorm:"primaryKey;autoIncrement"`
+	Period      int64  `json:"period" gorm:"uniqueIndex:idx_usage_key,priority:1;index:idx_usage_user,priority:2"`
+	BucketStart int64  `json:"bucket_start" gorm:"bigint;uniqueIndex:idx_usage_key,priority:2;index:idx_usage_user,priority:3"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex:idx_usage_key,priority:3;index:idx_usage_user,priority:1"`
+	TokenName   string `json:"token_name" gorm:"type:varchar(100);uniqueIndex:idx_usage_key,priority:4;default:''"`
+	ModelName   string `json:"model_name" gorm:"type:varchar(200);uniqueIndex:idx_usage_key,priority:5;default:''"`
+	ChannelId   int    `json:"channel_id" gorm:"uniqueIndex:idx_usage_key,priority:6"`
+	Username    string `json:"username" gorm:"type:varchar(100);default:''"`
+	UserGroup   string `json:"group" gorm:"type:varchar(64);default:''"`
+	UsageMetrics
+}
+
+// UsageRollupCursor 汇总进度：[Since, Watermark) 内的整点小时已写入汇总表，读路径只在该区间内使用汇总表
+type UsageRollupCursor struct {
+	Name      string `gorm:"primaryKey;type:varchar(32)"`
+	Since     int64  `gorm:"bigint"`
+	Watermark int64  `gorm:"bigint"`
+	UpdatedAt int64  `gorm:"autoUpdateTime"`
+}
+
+// usageMetricExprs 与 UsageMetrics 字段一一对应的、从 logs 汇总的 SQL 表达式
+var usageMetricColumns, usageMetricExprs = buildUsageMetricExprs()
+
+func buildUsageMetricExprs() ([]string, []string) {
+	columns := []string{"requests", "success_requests", "error_requests", "quota", "prompt_tokens", "completion_tokens", "cached_tokens",
+		"sum_duration", "duration_count", "sum_first_word", "first_word_count", "sum_speed", "speed_count"}
+	exprs := []string{
+		"COUNT(*)",
+		fmt.Sprintf("SUM(CASE WHEN type = %d THEN 1 ELSE 0 END)", LogTypeConsume),
+		fmt.Sprintf("SUM(CASE WHEN type = %d THEN 1 ELSE 0 END)", LogTypeError),
+		"SUM(quota)", "SUM(prompt_tokens)", "SUM(completion_tokens)", "SUM(cached_tokens)",
+		"SUM(CASE WHEN duration > 0 THEN duration ELSE 0 END)", "SUM(CASE WHEN duration > 0 THEN 1 ELSE 0 END)",
+		"SUM(CASE WHEN first_word_latency > 0 THEN first_word_latency ELSE 0 END)", "SUM(CASE WHEN first_word_latency > 0 THEN 1 ELSE 0 END)",
+		"SUM(CASE WHEN speed > 0 THEN speed ELSE 0 END)", "SUM(CASE WHEN speed > 0 THEN 1 ELSE 0 END)",
+	}
+	for _, h := range []struct{ prefix, field string }{{"lat_b", "duration"}, {"fwl_b", "first_word_latency"}} {
+		for i := 0; i <= len(LatencyBoundaries); i++ {
+			cond := fmt.Sprintf("%s > 0", h.field)
+			if i > 0 {
+				cond = fmt.Sprintf("%s >= %g", h.field, LatencyBoundaries[i-1])
+			}
+			if i < len(LatencyBoundaries) {
+				cond += fmt.Sprintf(" AND %s < %g", h.field, LatencyBoundaries[i])
+			}
+			columns = append(columns, fmt.Sprintf("%s%d", h.prefix, i))
+			exprs = append(exprs, fmt.Sprintf("SUM(CASE WHEN %s THEN 1 ELSE 0 END)", cond))
+		}
+	}
+	return columns, exprs
+}
+
+func usageRawSelect() string {
+	parts := make([]string, len(usageMetricColumns))
+	for i, col := range usageMetricColumns {
+		parts[i] = fmt.Sprintf("COALESCE(%s, 0) AS %s", usageMetricExprs[i], col)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func usageSumSelect() string {
+	parts := make([]string, len(usageMetricColumns))
+	for i, col := range usageMetricColumns {
+		parts[i] = fmt.Sprintf("COALESCE(SUM(%s), 0) AS %s", col, col)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Add 逐字段累加
+func (m *UsageMetrics) Add(o *UsageMetrics) {
+	a, b := reflect.ValueOf(m).Elem(), reflect.ValueOf(o).Elem()
+	for i := 0; i < a.NumField(); i++ {
+		switch f := a.Field(i); f.Kind() {
+		case reflect.Int64:
+			f.SetInt(f.Int() + b.Field(i).Int())
+		case reflect.Float64:
+			f.SetFloat(f.Float() + b.Field(i).Float())
+		}
+	}
+}
+
+// LatencyHistogram 总耗时直方图，可直接交给 EstimatePercentile
+func (m *UsageMetrics) LatencyHistogram() *HistogramBuckets {
+	return &HistogramBuckets{Boundaries: LatencyBoundaries, Counts: []int64{m.LatB0, m.LatB1, m.LatB2, m.LatB3, m.LatB4, m.LatB5, m.LatB6, m.LatB7}}
+}
+
+// FirstWordHistogram 首字延迟直方图
+func (m *UsageMetrics) FirstWordHistogram() *HistogramBuckets {
+	return &HistogramBuckets{Boundaries: LatencyBoundaries, Counts: []int64{m.FwlB0, m.FwlB1, m.FwlB2, m.FwlB3, m.FwlB4, m.FwlB5, m.FwlB6, m.FwlB7}}
+}
+
+// ===== 写路径 =====
+
+var usageRollupTaskOnce sync.Once
+
+// StartUsageRollupWorker 启动用量汇总 Worker（仅 master 节点执行）
+func StartUsageRollupWorker() {
+	usageRollupTaskOnce.Do(func() {
+		if !config.IsMasterNode || !config.UsageRollupEnabled || config.UsageRollupIntervalSeconds <= 0 {
+			return
+		}
+		common.SafeGoroutine(func() {
+			for {
+				func() {
+					defer func() {
+						if r := recover(); r != nil {
+							logger.SysError(fmt.Sprintf("usage rollup: panic recovered: %v", r))
+						}
+					}()
+					if err := RunUsageRollup(time.Now()); err != nil {
+						logger.SysError("usage rollup: " + err.Error())
+					}
+				}()
+				time.Sleep(time.Duration(config.UsageRollupIntervalSeconds) * time.Second)
+			}
+		})
+		logger.SysLog("usage rollup worker started")
+	})
+}
+
+// RunUsageRollup 汇总截至 now 所在小时之前的全部整点小时。
+// 首次运行从 UsageRollupBackfillDays 天前（或最早一条日志）开始回填；之后每轮重算最近 UsageRollupLateHours 小时。
+func RunUsageRollup(now time.Time) error {
+	cursor := &UsageRollupCursor{Name: usageRollupCursorName}
+	if err := LOG_DB.Where("name = ?", usageRollupCursorName).Limit(1).Find(cursor).Error; err != nil {
+		return err
+	}
+	currentHour := FloorHour(now.Unix())
+	if cursor.Watermark == 0 {
+		since := floorDay(now.Unix() - int64(config.UsageRollupBackfillDays)*UsagePeriodDay)
+		var oldest struct{ CreatedAt int64 }
+		if err := LOG_DB.Model(&Log{}).Select("created_at").Order("id asc").Limit(1).Scan(&oldest).Error; err != nil {
+			return err
+		}
+		if oldest.CreatedAt == 0 {
+			oldest.CreatedAt = now.Unix()
+		}
+		if FloorHour(oldest.CreatedAt) > since {
+			since = FloorHour(oldest.CreatedAt)
+		}
+		cursor.Since, cursor.Watermark = since, since
+		logger.SysLog(fmt.Sprintf("usage rollup: first run, backfilling %d hours from %s",
+			(currentHour-since)/UsagePeriodHour, time.Unix(since, 0).UTC().Format("2006-01-02 15:04")))
+	}
+
+	from := cursor.Watermark - int64(config.UsageRollupLateHours)*UsagePeriodHour
+	if from < cursor.Since {
+		from = cursor.Since
+	}
+	touchedDays := map[int64]bool{}
+	for h := from; h < currentHour; h += UsagePeriodHour {
+		if err := rollupUsageHour(h); err != nil {
+			return fmt.Errorf("hour %d: %w", h, err)
+		}
+		touchedDays[floorDay(h)] = true
+		if h+UsagePeriodHour > cursor.Watermark {
+			cursor.Watermark = h + UsagePeriodHour
+		}
+		// 回填时每满一天落一次进度，读路径和重启都能从这里接上
+		if (h+UsagePeriodHour)%UsagePeriodDay == 0 {
+			if err := rollupUsageDay(floorDay(h)); err != nil {
+				return err
+			}
+			delete(touchedDays, floorDay(h))
+			if err := LOG_DB.Save(cursor).Error; err != nil {
+				return err
+			}
+		}
+	}
+	for day := range touchedDays {
+		if err := rollupUsageDay(day); err != nil {
+			return err
+		}
+	}
+	return LOG_DB.Save(cursor).Error
+}
+
+// rollupUsageHour 重算 [hourStart, hourStart+1h) 的小时行：先删后插，日志被修改或删除时结果随之更新
+func rollupUsageHour(hourStart int64) error {
+	var rows []UsageRollup
+	tx := LOG_DB.Model(&Log{}).Select("user_id, MAX(username) AS username, token_name, model_name, channel_id, " + usageRawSelect())
+	tx = applyBillableLogTypes(tx)
+	tx = applyLogIdRange(tx, hourStart, hourStart+UsagePeriodHour-1)
+	err := tx.Where("created_at >= ? AND created_at < ?", hourStart, hourStart+UsagePeriodHour).
+		Group("user_id, token_name, model_name, channel_id").Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	groups := getUsageUserGroups(rows)
+	for i := range rows {
+		rows[i].Period, rows[i].BucketStart = UsagePeriodHour, hourStart
+		rows[i].UserGroup = groups[rows[i].UserId]
+	}
+	return replaceUsageRollups(UsagePeriodHour, hourStart, rows)
+}
+
+// rollupUsageDay 由当天的小时行重算日行
+func rollupUsageDay(dayStart int64) error {
+	var rows []UsageRollup
+	err := LOG_DB.Model(&UsageRollup{}).
+		Select("user_id, MAX(username) AS username, MAX(user_group) AS user_group, token_name, model_name, channel_id, "+usageSumSelect()).
+		Where("period = ? AND bucket_start >= ? AND bucket_start < ?", UsagePeriodHour, dayStart, dayStart+UsagePeriodDay).
+		Group("user_id, token_name, model_name, channel_id").Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	for i := range rows {
+		rows[i].Period, rows[i].BucketStart = UsagePeriodDay, dayStart
+	}
+	return replaceUsageRollups(UsagePeriodDay, dayStart, rows)
+}
+
+func replaceUsageRollups(period, bucketStart int64, rows []UsageRollup) error {
+	return LOG_DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("period = ? AND bucket_start = ?", period, bucketStart).Delete(&UsageRollup{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(rows, 200).Error
+	})
+}
+
+func getUsageUserGroups(rows []UsageRollup) map[int]string {
+	groups := map[int]string{}
+	var ids []int
+	for _, r := range rows {
+		if _, ok := groups[r.UserId]; !ok && r.UserId > 0 {
+			groups[r.UserId] = ""
+			ids = append(ids, r.UserId)
+		}
+	}
+	if len(ids) == 0 {
+		return groups
+	}
+	var users []User
+	if err := DB.Model(&User{}).Select([]string{"id", "group"}).Where("id IN ?", ids).Find(&users).Error; err != nil {
+		logger.SysError("usage rollup: failed to load user groups: " + err.Error())
+		return groups
+	}
+	for _, u := range users {
+		groups[u.Id] = u.Group
+	}
+	return groups
+}
+
+func floorDay(ts int64) int64 {
+	return ts - ts%UsagePeriodDay
+}
+
+// ===== 读路径 =====
+
+// UsageFilter 用量查询的过滤条件，零值表示不过滤
+type UsageFilter struct {
+	UserId    int
+	Username  string
+	TokenName string
+	ModelName string
+	ChannelId int
+}
+
+func (f UsageFilter) apply(tx *gorm.DB) *gorm.DB {
+	if f.UserId > 0 {
+		tx = tx.Where("user_id = ?", f.UserId)
+	}
+	if f.Username != "" {
+		tx = tx.Where("username = ?", f.Username)
+	}
+	if f.TokenName != "" {
+		tx = tx.Where("token_name = ?", f.TokenName)
+	}
+	if f.ModelName != "" {
+		tx = tx.Where("model_name = ?", f.ModelName)
+	}
+	if f.ChannelId != 0 {
+		tx = tx.Where("channel_id = ?", f.ChannelId)
+	}
+	return tx
+}
+
+// usageQuery 一次用量查询：[Start, End) 内按 GroupByModel 或 Bucket（秒）分组汇总
+type usageQuery struct {
+	Start, End   int64
+	Filter       UsageFilter
+	GroupByModel bool
+	Bucket       int64
+}
+
+type usageSegment struct {
+	period   int64 // 0 表示直接查 logs
+	from, to int64
+}
+
+var usageCoverageCache struct {
+	sync.Mutex
+	since, watermark int64
+	expires          time.Time
+}
+
+// usageRollupCoverage 汇总表已覆盖的区间 [since, watermark)，未开启或尚未回填时返回 0, 0
+func usageRollupCoverage() (int64, int64) {
+	if !config.UsageRollupEnabled {
+		return 0, 0
+	}
+	c := &usageCoverageCache
+	c.Lock()
+	defer c.Unlock()
+	if time.Now().Before(c.expires) {
+		return c.since, c.watermark
+	}
+	cursor := &UsageRollupCursor{}
+	if err := LOG_DB.Where("name = ?", usageRollupCursorName).Limit(1).Find(cursor).Error; err != nil {
+		cursor = &UsageRollupCursor{}
+	}
+	c.since, c.watermark, c.expires = cursor.Since, cursor.Watermark, time.Now().Add(usageCoverageCacheTTL)
+	return c.since, c.watermark
+}
+
+func resetUsageCoverageCache() {
+	usageCoverageCache.Lock()
+	usageCoverageCache.expires = time.Time{}
+	usageCoverageCache.Unlock()
+}
+
+// planUsageSegments 把 [start, end) 拆成：头部不足一小时的零头查 logs、整点小时查小时行、整天查日行、
+// 尾部（含汇总表尚未覆盖的最近一段）查 logs。零头和尾部都在一小时量级，借助 id 范围查询很快。
+func planUsageSegments(q usageQuery) []usageSegment {
+	raw := []usageSegment{{0, q.Start, q.End}}
+	if q.Bucket > 0 && q.Bucket%UsagePeriodHour != 0 {
+		return raw
+	}
+	since, watermark := usageRollupCoverage()
+	lo, hi := q.Start, q.End
+	if lo < since {
+		lo = since
+	}
+	if hi > watermark {
+		hi = watermark
+	}
+	hs, he := FloorHour(lo+UsagePeriodHour-1), FloorHour(hi)
+	if hs >= he {
+		return raw
+	}
+	var segs []usageSegment
+	if q.Start < hs {
+		segs = append(segs, usageSegment{0, q.Start, hs})
+	}
+	ds, de := floorDay(hs+UsagePeriodDay-1), floorDay(he)
+	if q.Bucket%UsagePeriodDay == 0 && ds < de {
+		if hs < ds {
+			segs = append(segs, usageSegment{UsagePeriodHour, hs, ds})
+		}
+		segs = append(segs, usageSegment{UsagePeriodDay, ds, de})
+		if de < he {
+			segs = append(segs, usageSegment{UsagePeriodHour, de, he})
+		}
+	} else {
+		segs = append(segs, usageSegment{UsagePeriodHour, hs, he})
+	}
+	if he < q.End {
+		segs = append(segs, usageSegment{0, he, q.End})
+	}
+	return segs
+}
+
+type usageAggRow struct {
+	GroupKey string `gorm:"column:group_key"`
+	UsageMetrics
+}
+
+// aggregateUsage 执行用量查询，返回分组键到指标的映射；不分组时键为空串
+func aggregateUsage(q usageQuery) (map[string]*UsageMetrics, error) {
+	result := map[string]*UsageMetrics{}
+	for _, seg := range planUsageSegments(q) {
+		var tx *gorm.DB
+		var timeCol string
+		if seg.period == 0 {
+			tx = LOG_DB.Model(&Log{}).Select(usageGroupKeyExpr(q, "created_at") + ", " + usageRawSelect())
+			tx = applyBillableLogTypes(tx)
+			tx = applyLogIdRange(tx, seg.from, seg.to-1)
+			timeCol = "created_at"
+		} else {
+			tx = LOG_DB.Model(&UsageRollup{}).Select(usageGroupKeyExpr(q, "bucket_start")+", "+usageSumSelect()).
+				Where("period = ?", seg.period)
+			timeCol = "bucket_start"
+		}
+		tx = q.Filter.apply(tx.Where(timeCol+" >= ? AND "+timeCol+" < ?", seg.from, seg.to))
+		if q.GroupByModel || q.Bucket > 0 {
+			tx = tx.Group("group_key")
+		}
+		var rows []usageAggRow
+		if err := tx.Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for i := range rows {
+			m, ok := result[rows[i].GroupKey]
+			if !ok {
+				m = &UsageMetrics{}
+				result[rows[i].GroupKey] = m
+			}
+			m.Add(&rows[i].UsageMetrics)
+		}
+	}
+	return result, nil
+}
+
+func usageGroupKeyExpr(q usageQuery, timeCol string) string {
+	switch {
+	case q.GroupByModel:
+		return "model_name AS group_key"
+	case q.Bucket > 0:
+		return fmt.Sprintf("(%s - %s %% %d) AS group_key", timeCol, timeCol, q.Bucket)
+	}
+	return "'' AS group_key"
+}
+
+// usageRange 把接口常用的闭区间 [start, end]（0 表示不限）转成 [from, to)
+func usageRange(startTimestamp, endTimestamp int64) (int64, int64) {
+	if endTimestamp == 0 {
+		endTimestamp = helper.GetTimestamp()
+	}
+	return startTimestamp, endTimestamp + 1
+}
+
+// SumUsage 汇总 [startTimestamp, endTimestamp] 内的用量
+func SumUsage(startTimestamp, endTimestamp int64, filter UsageFilter) (*UsageMetrics, error) {
+	from, to := usageRange(startTimestamp, endTimestamp)
+	result, err := aggregateUsage(usageQuery{Start: from, End: to, Filter: filter})
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := result[""]; ok {
+		return m, nil
+	}
+	return &UsageMetrics{}, nil
+}
+
+// UsageBreakdownRow 按维度拆分的用量
+type UsageBreakdownRow struct {
+	Key string `json:"key"`
+	UsageMetrics
+}
+
+var usageBreakdownColumns = map[string]string{
+	"user":    "user_id",
+	"token":   "token_name",
+	"model":   "model_name",
+	"channel": "channel_id",
+	"group":   "user_group",
+}
+
+// GetUsageBreakdown 只读汇总表，按 user / token / model / channel / group 拆分 [start, end) 内的用量，按额度倒序。
+// 分组维度只存在于汇总表，因此不拼接 logs 零头，返回实际覆盖的区间供调用方展示。
+// 维度 end_user 与 tag:<key> 读 log_tags，见 GetTagUsageBreakdown，区间原样返回
+func GetUsageBreakdown(start, end int64, dimension string, filter UsageFilter) ([]UsageBreakdownRow, int64, int64, error) {
+	if dimension == "end_user" || strings.HasPrefix(dimension, "tag:") {
+		tagKey := strings.TrimPrefix(dimension, "tag:")
+		if dimension == "end_user" {
+			tagKey = LogTagKeyEndUser
+		}
+		rows, err := GetTagUsageBreakdown(start, end, tagKey, filter)
+		return rows, start, end, err
+	}
+	col, ok := usageBreakdownColumns[dimension]
+	if !ok {
+		return nil, 0, 0, fmt.Errorf("不支持的维度: %s", dimension)
+	}
+	since, watermark := usageRollupCoverage()
+	if start < since {
+		start = since
+	}
+	if end > watermark {
+		end = watermark
+	}
+	rows := []UsageBreakdownRow{}
+	if start >= end {
+		return rows, start, end, nil
+	}
+	start, end = FloorHour(start+UsagePeriodHour-1), FloorHour(end)
+	q := usageQuery{Start: start, End: end, Filter: filter}
+	merged := map[string]*UsageMetrics{}
+	for _, seg := range planUsageSegments(q) {
+		if seg.period == 0 {
+			continue
+		}
+		var part []usageAggRow
+		tx := LOG_DB.Model(&UsageRollup{}).Select(col+" AS group_key, "+usageSumSelect()).
+			Where("period = ? AND bucket_start >= ? AND bucket_start < ?", seg.period, seg.from, seg.to)
+		if err := filter.apply(tx).Group(col).Scan(&part).Error; err != nil {
+			return nil, 0, 0, err
+		}
+		for i := range part {
+			m, ok := merged[part[i].GroupKey]
+			if !ok {
+				m = &UsageMetrics{}
+				merged[part[i].GroupKey] = m
+			}
+			m.Add(&part[i].UsageMetrics)
+		}
+	}
+	for key, m := range merged {
+		rows = append(rows, UsageBreakdownRow{Key: key, UsageMetrics: *m})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Quota != rows[j].Quota {
+			return rows[i].Quota > rows[j].Quota
+		}
+		return rows[i].Key < rows[j].Key
+	})
+	return rows, start, end, nil
+}
+
+func parseUsageBucketKey(key string) int64 {
+	v, _ := strconv.ParseInt(key, 10, 64)
+	return v
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// setupUsageRollupTestDB 建用量汇总相关表并开启汇总，其余表由 models 指定
+func setupUsageRollupTestDB(t *testing.T, models ...interface{}) {
+	setupTestDB(t, append([]interface{}{&Log{}, &UsageRollup{}, &UsageRollupCursor{}}, models...)...)
+	origLogDB, origEnabled, origBackfill, origLate := LOG_DB, config.UsageRollupEnabled, config.UsageRollupBackfillDays, config.UsageRollupLateHours
+	LOG_DB, config.UsageRollupEnabled, config.UsageRollupBackfillDays, config.UsageRollupLateHours = DB, true, 30, 3
+	resetUsageCoverageCache()
+	t.Cleanup(func() {
+		LOG_DB, config.UsageRollupEnabled, config.UsageRollupBackfillDays, config.UsageRollupLateHours = origLogDB, origEnabled, origBackfill, origLate
+		resetUsageCoverageCache()
+	})
+}
+
+func TestUsageRollupMatchesRawLogs(t *testing.T) {
+	setupUsageRollupTestDB(t)
+	DB.Create(&User{Id: 1, Username: "alice", Group: "vip", AccessToken: "a", AffCode: "a"})
+	DB.Create(&User{Id: 2, Username: "bob", Group: "default", AccessToken: "b", AffCode: "b"})
+
+	day1 := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC).Unix()
+	day2, today := day1+UsagePeriodDay, day1+2*UsagePeriodDay
+	now := time.Unix(today+10*3600+30*60, 0)
+	logs := []Log{
+		{UserId: 1, Username: "alice", TokenName: "t1", ModelName: "gpt-4o", ChannelId: 1, CreatedAt: day1 + 5*3600 + 600, Type: LogTypeConsume, Quota: 100, PromptTokens: 10, CompletionTokens: 5, Duration: 2.5, FirstWordLatency: 0.8},
+		{UserId: 2, Username: "bob", TokenName: "t2", ModelName: "claude", ChannelId: 2, CreatedAt: day2 + 12*3600, Type: LogTypeError, Duration: 1},
+		{UserId: 1, Username: "alice", TokenName: "t1", ModelName: "claude", ChannelId: 2, CreatedAt: day2 + 12*3600 + 60, Type: LogTypeConsume, Quota: 300, CachedTokens: 7},
+		{UserId: 1, Username: "alice", TokenName: "t1", ModelName: "gpt-4o", ChannelId: 1, CreatedAt: day2 + 13*3600, Type: LogTypeTopup, Quota: 99999},
+		{UserId: 1, Username: "alice", TokenName: "t1", ModelName: "gpt-4o", ChannelId: 1, CreatedAt: today + 3*3600 + 900, Type: LogTypeConsume, Quota: 200},
+		{UserId: 1, Username: "alice", TokenName: "t1", ModelName: "gpt-4o", ChannelId: 1, CreatedAt: today + 10*3600 + 300, Type: LogTypeConsume, Quota: 400},
+	}
+	for i := range logs {
+		DB.Create(&logs[i])
+	}
+
+	config.UsageRollupEnabled = false
+	raw, _ := SumUsage(day1, now.Unix(), UsageFilter{})
+	config.UsageRollupEnabled = true
+
+	if err := RunUsageRollup(now); err != nil {
+		t.Fatalf("汇总失败: %v", err)
+	}
+	var cursor UsageRollupCursor
+	DB.First(&cursor, "name = ?", usageRollupCursorName)
+	if cursor.Since != day1+5*3600 || cursor.Watermark != today+10*3600 {
+		t.Fatalf("覆盖区间应从最早日志所在小时到当前小时: %+v", cursor)
+	}
+	var daily int64
+	DB.Model(&UsageRollup{}).Where("period = ?", UsagePeriodDay).Count(&daily)
+	if daily != 4 {
+		t.Errorf("应生成 day1 1 行、day2 2 行、今天 1 行日汇总, got %d", daily)
+	}
+
+	got, _ := SumUsage(day1, now.Unix(), UsageFilter{})
+	if got.Quota != raw.Quota || got.Requests != raw.Requests || got.Quota != 1000 || got.Requests != 5 || got.ErrorRequests != 1 || got.CachedTokens != 7 {
+		t.Fatalf("汇总结果应与直接查 logs 一致: rollup=%+v raw=%+v", got, raw)
+	}
+
+	// 改动已汇总小时内的日志，读路径不应再看到 logs 的变化，证明整点部分读的是汇总表
+	DB.Model(&Log{}).Where("quota = ?", 300).Update("quota", 1)
+	if got, _ = SumUsage(day1, now.Unix(), UsageFilter{}); got.Quota != 1000 {
+		t.Errorf("整点小时应读汇总表, got quota %d", got.Quota)
+	}
+	// 起点落在小时中间：零头从 logs 精确截取
+	if got, _ = SumUsage(day1+5*3600+900, now.Unix(), UsageFilter{UserId: 1}); got.Quota != 900 {
+		t.Errorf("零头应精确截取, got %d", got.Quota)
+	}
+	segs := planUsageSegments(usageQuery{Start: day1, End: now.Unix()})
+	if len(segs) != 5 || segs[0].period != 0 || segs[1].period != UsagePeriodHour || segs[2].period != UsagePeriodDay ||
+		segs[3].period != UsagePeriodHour || segs[4].period != 0 {
+		t.Errorf("应拆为 覆盖区间之前的 logs + 小时 + 整天 + 小时 + logs 尾部: %+v", segs)
+	}
+
+	rows, start, end, err := GetUsageBreakdown(day1, now.Unix(), "group", UsageFilter{})
+	if err != nil || len(rows) != 2 || rows[0].Key != "vip" || rows[0].Quota != 600 || start != day1+5*3600 || end != today+10*3600 {
+		t.Errorf("按分组拆分应只含已汇总区间: %+v [%d,%d) %v", rows, start, end, err)
+	}
+
+	perf, err := GetPerformanceStat(LogTypeUnknown, day1, now.Unix(), "", "", "", 0, 300)
+	if err != nil || perf.Summary.TotalRequests != 5 || perf.Summary.ErrorCount != 1 || perf.Summary.AvgDuration != 1.75 || len(perf.Timeseries) != 4 {
+		t.Errorf("长跨度性能统计应按小时读汇总: %+v %v", perf, err)
+	}
+}
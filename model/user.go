@@ -39,6 +39,8 @@ type User struct {
 	UserRemindThreshold     int64  `json:"user_remind_threshold"`
 	UserLastNoticeTime int64 `json:"user_last_notice_time" gorm:"default:0"`
 	ChannelRatios           string `json:"channel_ratios" gorm:"type:text"`
+	// CreatedTime 注册时间，早于该字段上线的老用户为 0
+	CreatedTime int64 `json:"created_time" gorm:"bigint;default:0"`
 }
 
 // GetChannelRatiosMap 解析 ChannelRatios JSON 为 map[channelType]ratio。
@@ -263,6 +265,7 @@ func (user *User) Insert(inviterId int) error {
 	user.Quota = config.QuotaForNewUser
 	user.AccessToken = helper.GetUUID()
 	user.AffCode = helper.GetRandomString(4)
+	user.CreatedTime = helper.GetTimestamp()
 	result := DB.Create(user)
 	if result.Error != nil {
 		return result.Error
@@ -297,6 +300,9 @@ func (user *User) Update(updatePassword bool) error {
 		blacklist.UnbanUser(user.Id)
 	}
 	err = DB.Model(user).Updates(user).Error
+	if err == nil && (updatePassword || user.Status == common.UserStatusDisabled) {
+		revokeUserSessionsOrLog(user.Id, "password change or disable")
+	}
 	return err
 }
 
@@ -308,6 +314,9 @@ func (user *User) Delete() error {
 	user.Username = fmt.Sprintf("deleted_%s", helper.GetUUID())
 	user.Status = common.UserStatusDeleted
 	err := DB.Model(user).Updates(user).Error
+	if err == nil {
+		revokeUserSessionsOrLog(user.Id, "delete")
+	}
 	return err
 }
 
@@ -412,7 +421,15 @@ func ResetUserPasswordByEmail(email string, password string) error {
 		return err
 	}
 	err = DB.Model(&User{}).Where("email = ?", email).Update("password", hashedPassword).Error
-	return err
+	if err != nil {
+		return err
+	}
+	var userIds []int
+	DB.Model(&User{}).Where("email = ?", email).Pluck("id", &userIds)
+	for _, userId := range userIds {
+		revokeUserSessionsOrLog(userId, "password reset")
+	}
+	return nil
 }
 
 func IsAdmin(userId int) bool {
@@ -497,6 +514,7 @@ func DecreaseUserQuota(id int, quota int64) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
+	defer triggerAutoTopUp(id)
 	if config.BatchUpdateEnabled {
 		addNewRecord(BatchUpdateTypeUserQuota, id, -quota)
 		return nil
@@ -0,0 +1,212 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// UserSession 服务端会话记录。cookie 中只保存 sid，每次鉴权都要求对应记录未被吊销。
+type UserSession struct {
+	Id           int    `json:"id"`
+	SessionId    string `json:"-" gorm:"type:char(32);uniqueIndex"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	Ip           string `json:"ip" gorm:"type:varchar(64)"`
+	UserAgent    string `json:"user_agent" gorm:"type:varchar(512)"`
+	Device       string `json:"device" gorm:"type:varchar(64)"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	LastSeenTime int64  `json:"last_seen_time" gorm:"bigint"`
+	RevokedTime  int64  `json:"revoked_time" gorm:"bigint;default:0;index"` // 0 表示有效
+	Current      bool   `json:"current" gorm:"-:all"`
+}
+
+// 会话最近访问时间的落库间隔，避免每个请求都写库
+const userSessionTouchInterval = 60
+
+// 会话最长存活时间，与 cookie 的默认 MaxAge（30 天）一致
+const userSessionMaxAge = 30 * 24 * 3600
+
+// cachedUserSession SessionId 不参与 UserSession 的 JSON 序列化，缓存时单独带上
+type cachedUserSession struct {
+	UserSession
+	Sid string `json:"sid"`
+}
+
+func userSessionCacheKey(sid string) string {
+	return "user_session:" + sid
+}
+
+// parseDevice 从 User-Agent 粗略识别设备，仅用于展示
+func parseDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	os := "Unknown"
+	switch {
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+		os = "iOS"
+	case strings.Contains(ua, "android"):
+		os = "Android"
+	case strings.Contains(ua, "windows"):
+		os = "Windows"
+	case strings.Contains(ua, "mac os"):
+		os = "macOS"
+	case strings.Contains(ua, "linux"):
+		os = "Linux"
+	}
+	browser := "Other"
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "chrome/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	}
+	return browser + " on " + os
+}
+
+// CreateUserSession 登录成功时创建会话记录并返回 sid
+func CreateUserSession(userId int, ip string, userAgent string) (string, error) {
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	now := helper.GetTimestamp()
+	session := &UserSession{
+		SessionId:    helper.GetUUID(),
+		UserId:       userId,
+		Ip:           ip,
+		UserAgent:    userAgent,
+		Device:       parseDevice(userAgent),
+		CreatedTime:  now,
+		LastSeenTime: now,
+	}
+	if err := DB.Create(session).Error; err != nil {
+		return "", err
+	}
+	return session.SessionId, nil
+}
+
+func getUserSession(sid string) (*UserSession, error) {
+	session := &UserSession{}
+	if common.RedisEnabled {
+		if cached, err := common.RedisGet(userSessionCacheKey(sid)); err == nil {
+			var c cachedUserSession
+			if json.Unmarshal([]byte(cached), &c) == nil && c.Sid == sid {
+				c.UserSession.SessionId = sid
+				return &c.UserSession, nil
+			}
+		}
+	}
+	if err := DB.Where("session_id = ?", sid).First(session).Error; err != nil {
+		return nil, err
+	}
+	cacheUserSession(session)
+	return session, nil
+}
+
+func cacheUserSession(session *UserSession) {
+	if !common.RedisEnabled {
+		return
+	}
+	data, err := json.Marshal(cachedUserSession{UserSession: *session, Sid: session.SessionId})
+	if err != nil {
+		return
+	}
+	if err := common.RedisSet(userSessionCacheKey(session.SessionId), string(data), time.Duration(config.SyncFrequency)*time.Second); err != nil {
+		logger.SysError("failed to cache user session: " + err.Error())
+	}
+}
+
+// ValidateUserSession 校验会话是否仍有效并刷新最近访问信息
+func ValidateUserSession(sid string, userId int, ip string) error {
+	if sid == "" {
+		return errors.New("session has expired, please log in again")
+	}
+	session, err := getUserSession(sid)
+	if err != nil || session.UserId != userId || session.RevokedTime != 0 {
+		return errors.New("session has been revoked, please log in again")
+	}
+	now := helper.GetTimestamp()
+	if now-session.CreatedTime > userSessionMaxAge {
+		return errors.New("session has expired, please log in again")
+	}
+	if now-session.LastSeenTime >= userSessionTouchInterval || session.Ip != ip {
+		session.LastSeenTime = now
+		session.Ip = ip
+		err = DB.Model(&UserSession{}).Where("id = ?", session.Id).
+			UpdateColumns(map[string]interface{}{"last_seen_time": now, "ip": ip}).Error
+		if err != nil {
+			logger.SysError("failed to touch user session: " + err.Error())
+		}
+		cacheUserSession(session)
+	}
+	return nil
+}
+
+// GetActiveUserSessions 列出用户未吊销、未过期的会话
+func GetActiveUserSessions(userId int) ([]*UserSession, error) {
+	var sessions []*UserSession
+	err := DB.Where("user_id = ? AND revoked_time = 0 AND created_time > ?", userId, helper.GetTimestamp()-userSessionMaxAge).
+		Order("last_seen_time desc").Find(&sessions).Error
+	return sessions, err
+}
+
+func revokeUserSessions(query string, args ...interface{}) error {
+	var sids []string
+	if err := DB.Model(&UserSession{}).Where(query, args...).Where("revoked_time = 0").Pluck("session_id", &sids).Error; err != nil {
+		return err
+	}
+	if len(sids) == 0 {
+		return nil
+	}
+	err := DB.Model(&UserSession{}).Where("session_id IN ?", sids).Update("revoked_time", helper.GetTimestamp()).Error
+	if err != nil {
+		return err
+	}
+	if common.RedisEnabled {
+		for _, sid := range sids {
+			_ = common.RedisDel(userSessionCacheKey(sid))
+		}
+	}
+	return nil
+}
+
+// RevokeUserSession 吊销用户自己的某个会话
+func RevokeUserSession(id int, userId int) error {
+	var count int64
+	DB.Model(&UserSession{}).Where("id = ? AND user_id = ? AND revoked_time = 0", id, userId).Count(&count)
+	if count == 0 {
+		return errors.New("session not found")
+	}
+	return revokeUserSessions("id = ? AND user_id = ?", id, userId)
+}
+
+// RevokeUserSessions 吊销用户全部会话，exceptSid 非空时保留该会话
+func RevokeUserSessions(userId int, exceptSid string) error {
+	if exceptSid != "" {
+		return revokeUserSessions("user_id = ? AND session_id <> ?", userId, exceptSid)
+	}
+	return revokeUserSessions("user_id = ?", userId)
+}
+
+// RevokeUserSessionBySid 登出时吊销当前会话
+func RevokeUserSessionBySid(sid string) error {
+	if sid == "" {
+		return nil
+	}
+	return revokeUserSessions("session_id = ?", sid)
+}
+
+func revokeUserSessionsOrLog(userId int, reason string) {
+	if err := RevokeUserSessions(userId, ""); err != nil {
+		logger.SysError(fmt.Sprintf("failed to revoke sessions of user %d on %s: %s", userId, reason, err.Error()))
+	}
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+func TestUserSessionRevokedOnPasswordChange(t *testing.T) {
+	setupTestDB(t, &UserSession{})
+	redisEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	t.Cleanup(func() { common.RedisEnabled = redisEnabled })
+
+	user := &User{Id: 1, Username: "alice", Password: "12345678", AccessToken: "a", AffCode: "a", Status: common.UserStatusEnabled}
+	if err := DB.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	sid1, _ := CreateUserSession(user.Id, "1.1.1.1", "Mozilla/5.0 (Windows NT 10.0) Chrome/120.0")
+	sid2, _ := CreateUserSession(user.Id, "2.2.2.2", "Mozilla/5.0 (iPhone) Safari/604.1")
+	if err := ValidateUserSession(sid1, user.Id, "1.1.1.1"); err != nil {
+		t.Fatalf("会话应有效: %v", err)
+	}
+	if err := ValidateUserSession(sid1, 2, "1.1.1.1"); err == nil {
+		t.Error("会话不应对其他用户有效")
+	}
+
+	if err := RevokeUserSessions(user.Id, sid1); err != nil {
+		t.Fatalf("吊销失败: %v", err)
+	}
+	if err := ValidateUserSession(sid2, user.Id, "2.2.2.2"); err == nil {
+		t.Error("其他会话应已被吊销")
+	}
+	if err := ValidateUserSession(sid1, user.Id, "1.1.1.1"); err != nil {
+		t.Error("当前会话应保留")
+	}
+
+	user.Password = "new-password"
+	if err := user.Update(true); err != nil {
+		t.Fatalf("修改密码失败: %v", err)
+	}
+	if err := ValidateUserSession(sid1, user.Id, "1.1.1.1"); err == nil {
+		t.Error("修改密码后会话应全部失效")
+	}
+}
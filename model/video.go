@@ -24,6 +24,7 @@ type Video struct {
 	ChannelId      int     `json:"channel_id" gorm:"index:idx_videos_channel_id"`
 	UserId         int     `json:"user_id" gorm:"index:idx_videos_user_id"` // 添加用户索引
 	TokenId        int     `json:"token_id" gorm:"index:idx_videos_token_id"` // 创建任务时使用的 Token，完成后扣费记入 Token 维度
+	OrgId          int     `json:"org_id" gorm:"default:0"`                   // 组织令牌创建的任务，结算与退款走组织额度池
 	Model          string  `json:"model" gorm:"index:idx_videos_model"`
 	Status         string  `json:"status" gorm:"index:idx_videos_status;index:idx_videos_provider_status,priority:2"` // 添加状态索引
 	FailReason     string  `json:"fail_reason"`
@@ -15,7 +15,9 @@ import (
 	"github.com/songquanpeng/one-api/common/audit"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/tracing"
 	"github.com/songquanpeng/one-api/relay/util"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const defaultPingInterval = 10 * time.Second
@@ -106,16 +108,31 @@ func DoRequest(c *gin.Context, req *http.Request, meta *util.RelayMeta) (*http.R
 		}()
 	}
 
+	req, span := tracing.StartUpstream(c.Request.Context(), req, upstreamSpanAttributes(c, meta)...)
 	resp, err := util.HTTPClient.Do(req)
+	if err == nil && resp == nil {
+		err = errors.New("resp is nil")
+	}
+	tracing.EndUpstream(span, resp, err)
 	if err != nil {
 		return nil, err
 	}
-	if resp == nil {
-		return nil, errors.New("resp is nil")
-	}
 	return resp, nil
 }
 
+// upstreamSpanAttributes 每次上游尝试的 span 属性；重试时 channel_id / key_index 随之变化
+func upstreamSpanAttributes(c *gin.Context, meta *util.RelayMeta) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.Int("channel_id", c.GetInt("channel_id"))}
+	if meta == nil {
+		return attrs
+	}
+	attrs = append(attrs, attribute.String("model", meta.BillingModelName()), attribute.Bool("stream", meta.IsStream))
+	if meta.KeyIndex != nil {
+		attrs = append(attrs, attribute.Int("key_index", *meta.KeyIndex))
+	}
+	return attrs
+}
+
 // startPingKeepAlive 启动一个 goroutine 定期发送 SSE ping 注释保活。
 // 返回的 stop 函数会取消 goroutine 并同步等待其退出，确保调用方拿到控制权时不再有并发写入。
 func startPingKeepAlive(c *gin.Context, pingInterval time.Duration) (stop func()) {
@@ -210,6 +210,7 @@ func (a *Adaptor) CreatePendingRecord(c *gin.Context, meta *util.RelayMeta) erro
 		ChannelId: meta.ChannelId,
 		KeyIndex:  c.GetInt("key_index"),
 		UserId:    meta.UserId,
+		OrgId:     meta.OrgId,
 		Model:     meta.OriginModelName,
 		Status:    TaskStatusPending,
 		Provider:  "flux",
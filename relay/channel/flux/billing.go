@@ -8,19 +8,20 @@ import (
 	"github.com/songquanpeng/one-api/model"
 )
 
-// ChargeOnSuccess 在任务成功时扣费，仅操作用户维度额度，不依赖 TokenId。
+// ChargeOnSuccess 在任务成功时扣费，只扣付费方额度（组织任务扣组织额度池），不依赖 TokenId。
 // 应在 UpdateIfNotTerminal CAS 成功（applied=true）后调用。
 func ChargeOnSuccess(ctx context.Context, image *model.Image, quota int64) error {
 	if quota <= 0 {
 		return fmt.Errorf("invalid quota: %d", quota)
 	}
 
-	if err := model.DecreaseUserQuota(image.UserId, quota); err != nil {
+	if err := model.DecreasePayerQuota(image.UserId, image.OrgId, quota); err != nil {
 		return fmt.Errorf("扣费失败: %w", err)
 	}
 
 	model.UpdateUserUsedQuotaAndRequestCount(image.UserId, quota)
 	model.UpdateChannelUsedQuota(image.ChannelId, quota)
+	ctx = model.SettleModelCredit(ctx, image.UserId, image.OrgId, image.Model, quota)
 
 	logContent := fmt.Sprintf("Flux 任务成功，扣费 quota=%d", quota)
 	model.RecordConsumeLogWithRequestID(
@@ -46,7 +46,7 @@ func ApplyGeminiOmniSuccess(ctx context.Context, videoTask *dbmodel.Video, resul
 
 // chargeGeminiOmniOnSuccess 异步执行扣费与记 log。
 // token_id 来自 video 表（创建时落库），用 PostConsumeTokenQuota 记入 Token 维度
-// （同时扣用户余额和 token 额度）；无 TokenId 时降级为只扣用户余额。
+// （同时扣付费方余额和 token 额度）；无 TokenId 时降级为只扣付费方余额（组织任务扣组织额度池）。
 func chargeGeminiOmniOnSuccess(task *dbmodel.Video, quota int64, result *model.GeneralFinalVideoResponse) {
 	ctx := context.Background()
 	if quota <= 0 {
@@ -62,14 +62,15 @@ func chargeGeminiOmniOnSuccess(task *dbmodel.Video, quota int64, result *model.G
 			return
 		}
 	} else {
-		if err := dbmodel.DecreaseUserQuota(task.UserId, quota); err != nil {
+		if err := dbmodel.DecreasePayerQuota(task.UserId, task.OrgId, quota); err != nil {
 			logger.Errorf(ctx, "[gemini-omni-billing] 扣费失败(user): task_id=%s, err=%v", task.TaskId, err)
 			return
 		}
 	}
-	_ = dbmodel.CacheUpdateUserQuota(ctx, task.UserId)
+	_ = dbmodel.CacheUpdatePayerQuota(ctx, task.UserId, task.OrgId)
 	dbmodel.UpdateUserUsedQuotaAndRequestCount(task.UserId, quota)
 	dbmodel.UpdateChannelUsedQuota(task.ChannelId, quota)
+	ctx = dbmodel.SettleModelCredit(ctx, task.UserId, task.OrgId, task.Model, quota)
 
 	// 记消费 log：真实 token 用量与费用
 	totalOutput := result.OutputTextTokens + result.OutputVideoTokens
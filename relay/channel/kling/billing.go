@@ -77,12 +77,13 @@ func ChargeVideoOnSuccess(ctx context.Context, video *model.Video, quota int64)
 		return fmt.Errorf("invalid quota: %d", quota)
 	}
 
-	if err := model.DecreaseUserQuota(video.UserId, quota); err != nil {
+	if err := model.DecreasePayerQuota(video.UserId, video.OrgId, quota); err != nil {
 		return fmt.Errorf("扣费失败: %w", err)
 	}
 
 	model.UpdateUserUsedQuotaAndRequestCount(video.UserId, quota)
 	model.UpdateChannelUsedQuota(video.ChannelId, quota)
+	ctx = model.SettleModelCredit(ctx, video.UserId, video.OrgId, video.Model, quota)
 
 	logContent := fmt.Sprintf("Kling 任务成功，扣费 quota=%d, task_id=%s, type=%s", quota, video.TaskId, video.Type)
 	model.RecordConsumeLog(
@@ -111,12 +112,13 @@ func ChargeImageOnSuccess(ctx context.Context, image *model.Image, quota int64)
 		return fmt.Errorf("invalid quota: %d", quota)
 	}
 
-	if err := model.DecreaseUserQuota(image.UserId, quota); err != nil {
+	if err := model.DecreasePayerQuota(image.UserId, image.OrgId, quota); err != nil {
 		return fmt.Errorf("扣费失败: %w", err)
 	}
 
 	model.UpdateUserUsedQuotaAndRequestCount(image.UserId, quota)
 	model.UpdateChannelUsedQuota(image.ChannelId, quota)
+	ctx = model.SettleModelCredit(ctx, image.UserId, image.OrgId, image.Model, quota)
 
 	logContent := fmt.Sprintf("Kling 图片任务成功，扣费 quota=%d, task_id=%s", quota, image.TaskId)
 	model.RecordConsumeLog(
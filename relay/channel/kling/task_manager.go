@@ -21,6 +21,7 @@ func NewTaskManager() *TaskManager {
 // CreateTaskRequest 创建任务请求
 type CreateTaskRequest struct {
 	UserID      int
+	OrgID       int // 组织令牌创建的任务，结算走组织额度池
 	Username    string
 	ChannelID   int
 	Model       string
@@ -69,6 +70,7 @@ func (tm *TaskManager) createVideoTask(req *CreateTaskRequest) (*dbmodel.Video,
 	video := &dbmodel.Video{
 		TaskId:         "",
 		UserId:         req.UserID,
+		OrgId:          req.OrgID,
 		Username:       req.Username,
 		ChannelId:      req.ChannelID,
 		Model:          req.Model,
@@ -101,6 +103,7 @@ func (tm *TaskManager) createImageTask(req *CreateTaskRequest) (*dbmodel.Image,
 	image := &dbmodel.Image{
 		TaskId:    "",
 		UserId:    req.UserID,
+		OrgId:     req.OrgID,
 		Username:  req.Username,
 		ChannelId: req.ChannelID,
 		Model:     req.Model,
@@ -198,7 +198,7 @@ func (a *VideoAdaptor) handleRemixRequest(c *gin.Context, meta *util.RelayMeta)
 	quota := calcSoraQuota(modelName, secondsStr, size)
 
 	// Check user balance.
-	userQuota, err := dbmodel.CacheGetUserQuota(c.Request.Context(), meta.UserId)
+	userQuota, err := dbmodel.CacheGetPayerQuota(c.Request.Context(), meta.UserId, meta.OrgId)
 	if err != nil {
 		return nil, ErrorWrapper(err, "get_user_quota_error", http.StatusInternalServerError)
 	}
@@ -248,7 +248,7 @@ func (a *VideoAdaptor) sendFormDataRequest(c *gin.Context, meta *util.RelayMeta,
 
 	quota := calcSoraQuota(modelName, secondsStr, size)
 
-	userQuota, err := dbmodel.CacheGetUserQuota(c.Request.Context(), meta.UserId)
+	userQuota, err := dbmodel.CacheGetPayerQuota(c.Request.Context(), meta.UserId, meta.OrgId)
 	if err != nil {
 		return nil, ErrorWrapper(err, "get_user_quota_error", http.StatusInternalServerError)
 	}
@@ -338,7 +338,7 @@ func (a *VideoAdaptor) sendJSONRequest(c *gin.Context, meta *util.RelayMeta, sor
 
 	quota := calcSoraQuota(soraReq.Model, soraReq.Seconds, soraReq.Size)
 
-	userQuota, err := dbmodel.CacheGetUserQuota(c.Request.Context(), meta.UserId)
+	userQuota, err := dbmodel.CacheGetPayerQuota(c.Request.Context(), meta.UserId, meta.OrgId)
 	if err != nil {
 		return nil, ErrorWrapper(err, "get_user_quota_error", http.StatusInternalServerError)
 	}
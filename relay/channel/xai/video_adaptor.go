@@ -22,7 +22,7 @@ import (
 
 // checkBalance verifies that the user has enough quota before sending the request
 func checkBalance(c *gin.Context, meta *util.RelayMeta, quota int64) *model.ErrorWithStatusCode {
-	userQuota, err := dbmodel.CacheGetUserQuota(c.Request.Context(), meta.UserId)
+	userQuota, err := dbmodel.CacheGetPayerQuota(c.Request.Context(), meta.UserId, meta.OrgId)
 	if err != nil {
 		return openaiAdaptor.ErrorWrapper(err, "get_user_quota_error", http.StatusInternalServerError)
 	}
@@ -303,7 +303,7 @@ func adjustNativeVideoQuota(requestId string, task *dbmodel.Video, result *GrokV
 	if diff > 0 {
 		logger.SysLog(fmt.Sprintf("[xAI Video] 多退 - taskId=%s, pre=%d, actual=%d, refund=%d",
 			requestId, task.Quota, actualQuota, diff))
-		if err := dbmodel.IncreaseUserQuota(task.UserId, diff); err != nil {
+		if err := dbmodel.IncreasePayerQuota(task.UserId, task.OrgId, diff); err != nil {
 			logger.SysLog(fmt.Sprintf("[xAI Video] 多退用户配额失败 - taskId=%s, err=%v", requestId, err))
 			return
 		}
@@ -312,7 +312,7 @@ func adjustNativeVideoQuota(requestId string, task *dbmodel.Video, result *GrokV
 		charge := -diff
 		logger.SysLog(fmt.Sprintf("[xAI Video] 少补 - taskId=%s, pre=%d, actual=%d, charge=%d",
 			requestId, task.Quota, actualQuota, charge))
-		if err := dbmodel.DecreaseUserQuota(task.UserId, charge); err != nil {
+		if err := dbmodel.DecreasePayerQuota(task.UserId, task.OrgId, charge); err != nil {
 			logger.SysLog(fmt.Sprintf("[xAI Video] 少补用户配额失败 - taskId=%s, err=%v", requestId, err))
 			return
 		}
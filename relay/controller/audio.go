@@ -143,7 +143,8 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	}
 
 	// 检查用户配额
-	userQuota, err := model.CacheGetUserQuota(ctx, userId)
+	orgId := c.GetInt("org_id")
+	userQuota, err := model.CacheGetPayerQuota(ctx, userId, orgId)
 	if err != nil {
 		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -151,8 +152,12 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
 
+	if err := model.ReserveEphemeralKeySpend(ctx, preConsumedQuota); err != nil {
+		return openai.ErrorWrapper(err, "ephemeral_key_spend_limit_exceeded", http.StatusForbidden)
+	}
+
 	// 预扣除配额
-	err = model.CacheDecreaseUserQuota(userId, preConsumedQuota)
+	err = model.CacheDecreasePayerQuota(userId, orgId, preConsumedQuota)
 	if err != nil {
 		return openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -181,10 +186,13 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 					logger.Info(rollbackCtx, fmt.Sprintf("Successfully rolled back pre-consumed quota %d for token %d", preConsumedQuota, tokenId))
 				}
 
-				// 同时回滚用户配额 - 使用现有的函数通过传入负值来增加配额
-				err = model.IncreaseUserQuota(userId, preConsumedQuota)
-				if err != nil {
-					logger.Error(rollbackCtx, fmt.Sprintf("Failed to rollback user quota %d for user %d: %v", preConsumedQuota, userId, err))
+				// 同时回滚用户配额 - 使用现有的函数通过传入负值来增加配额。
+				// 组织令牌的额度池已由 PostConsumeTokenQuota 退回，不能再退给成员
+				if orgId == 0 {
+					err = model.IncreaseUserQuota(userId, preConsumedQuota)
+					if err != nil {
+						logger.Error(rollbackCtx, fmt.Sprintf("Failed to rollback user quota %d for user %d: %v", preConsumedQuota, userId, err))
+					}
 				}
 			}()
 		}
@@ -465,6 +473,8 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		}
 	}(ctx)
 
+	util.PublishRequestCost(c, audioModel, quota, quotaDelta)
+
 	// 写入响应
 	for k, v := range resp.Header {
 		c.Writer.Header().Set(k, v[0])
@@ -758,6 +768,7 @@ func handleAudioStreamResponse(c *gin.Context, resp *http.Response, audioModel s
 		xRequestID := c.GetString("X-Request-ID")
 		// gin.Context 不允许 handler 返回后被 goroutine 并发读取（c.Keys 是无锁 map + sync.Pool 回收），
 		// 这里必须先 c.Copy() 再传入 goroutine
+		util.PublishRequestCost(c, audioModel, quota, quota)
 		cCopy := c.Copy()
 		go func() {
 			duration := math.Round(time.Since(startTime).Seconds()*1000) / 1000
@@ -765,6 +776,7 @@ func handleAudioStreamResponse(c *gin.Context, resp *http.Response, audioModel s
 			title := cCopy.Request.Header.Get("X-Title")
 
 			otherInfo = util.AppendRetryHistoryOther(cCopy, otherInfo, duration)
+			ctx := model.SettleModelCredit(ctx, userId, cCopy.GetInt("org_id"), audioModel, quota)
 			model.RecordConsumeLogWithOtherAndRequestID(ctx, userId, channelId, int(textInputTokens+audioInputTokens), int(textOutputTokens),
 				audioModel, tokenName, quota, fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f", modelRatio, groupRatio),
 				duration, title, referer, true, 0.0, otherInfo, xRequestID, 0, "")
@@ -993,6 +1005,7 @@ func handleTTSStreamResponse(c *gin.Context, resp *http.Response, audioModel str
 
 		// 异步记录配额消费
 		xRequestID := c.GetString("X-Request-ID")
+		util.PublishRequestCost(c, audioModel, quota, quota)
 		cCopy := c.Copy()
 		go func() {
 			duration := math.Round(time.Since(startTime).Seconds()*1000) / 1000
@@ -1000,6 +1013,7 @@ func handleTTSStreamResponse(c *gin.Context, resp *http.Response, audioModel str
 			title := cCopy.Request.Header.Get("X-Title")
 
 			otherInfo = util.AppendRetryHistoryOther(cCopy, otherInfo, duration)
+			ctx := model.SettleModelCredit(ctx, userId, cCopy.GetInt("org_id"), audioModel, quota)
 			model.RecordConsumeLogWithOtherAndRequestID(ctx, userId, channelId, int(textInputTokens), int(audioOutputTokens),
 				audioModel, tokenName, quota, fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f", modelRatio, groupRatio),
 				duration, title, referer, true, 0.0, otherInfo, xRequestID, 0, "")
@@ -1026,6 +1040,7 @@ func handleTTSStreamResponse(c *gin.Context, resp *http.Response, audioModel str
 
 					// 异步记录配额消费
 					xRequestID := c.GetString("X-Request-ID")
+					util.PublishRequestCost(c, audioModel, quota, quota)
 					cCopy := c.Copy()
 					go func() {
 						duration := math.Round(time.Since(startTime).Seconds()*1000) / 1000
@@ -1033,6 +1048,7 @@ func handleTTSStreamResponse(c *gin.Context, resp *http.Response, audioModel str
 						title := cCopy.Request.Header.Get("X-Title")
 
 						otherInfo = util.AppendRetryHistoryOther(cCopy, otherInfo, duration)
+						ctx := model.SettleModelCredit(ctx, userId, cCopy.GetInt("org_id"), audioModel, quota)
 						model.RecordConsumeLogWithOtherAndRequestID(ctx, userId, channelId, int(textInputTokens), int(audioOutputTokens),
 							audioModel, tokenName, quota, fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f", modelRatio, groupRatio),
 							duration, title, referer, true, 0.0, otherInfo, xRequestID, 0, "")
@@ -1124,6 +1140,7 @@ func handleAzureTTSStream(c *gin.Context, resp *http.Response, audioModel string
 
 				// 异步记录配额消费
 				xRequestID := c.GetString("X-Request-ID")
+				util.PublishRequestCost(c, audioModel, quota, quota)
 				cCopy := c.Copy()
 				go func() {
 					duration := math.Round(time.Since(startTime).Seconds()*1000) / 1000
@@ -1131,6 +1148,7 @@ func handleAzureTTSStream(c *gin.Context, resp *http.Response, audioModel string
 					title := cCopy.Request.Header.Get("X-Title")
 
 					otherInfo = util.AppendRetryHistoryOther(cCopy, otherInfo, duration)
+					ctx := model.SettleModelCredit(ctx, userId, cCopy.GetInt("org_id"), audioModel, quota)
 					model.RecordConsumeLogWithOtherAndRequestID(ctx, userId, channelId, int(textInputTokens), int(audioOutputTokens),
 						audioModel, tokenName, quota, fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f", modelRatio, groupRatio),
 						duration, title, referer, true, 0.0, otherInfo, xRequestID, 0, "")
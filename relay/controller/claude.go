@@ -87,7 +87,7 @@ func RelayClaudeNative(c *gin.Context) *model.ErrorWithStatusCode {
 		return openai.ErrorWrapper(err, "failed_to_calculate_pre_consumed_quota", http.StatusInternalServerError)
 	}
 
-	userQuota, err := dbmodel.CacheGetUserQuota(ctx, userId)
+	userQuota, err := dbmodel.CacheGetPayerQuota(ctx, userId, c.GetInt("org_id"))
 	if err != nil {
 		return openai.ErrorWrapper(err, "failed_to_get_user_quota", http.StatusInternalServerError)
 	}
@@ -179,6 +179,11 @@ func RelayClaudeNative(c *gin.Context) *model.ErrorWithStatusCode {
 		firstWordLatency = meta.GetFirstWordLatency()
 	}
 
+	servedModel := meta.BillingModelName()
+	if servedModel == "" {
+		servedModel = modelName
+	}
+	util.PublishRequestCost(c, servedModel, actualQuota, actualQuota)
 	go recordClaudeConsumption(ctx, userId, channelId, tokenId, modelName, tokenName, promptTokens, completionTokens, totalTokens, 0, actualQuota, c.Request.RequestURI, duration, meta.IsStream, c.Copy(), usageMetadata, firstWordLatency, groupRatio, modelRatio)
 
 	return nil
@@ -190,8 +195,9 @@ func recordClaudeConsumption(ctx context.Context, userId, channelId, tokenId int
 	if err != nil {
 		logger.Error(ctx, "error consuming token remain quota: "+err.Error())
 	}
+	ctx = dbmodel.SettleModelCredit(ctx, userId, c.GetInt("org_id"), modelName, quota)
 
-	err = dbmodel.CacheUpdateUserQuota(ctx, userId)
+	err = dbmodel.CacheUpdatePayerQuota(ctx, userId, c.GetInt("org_id"))
 	if err != nil {
 		logger.Error(ctx, "error update user quota cache: "+err.Error())
 	}
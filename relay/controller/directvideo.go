@@ -734,17 +734,18 @@ func handleRunwayImageBilling(c *gin.Context, meta *util.RelayMeta, modelName st
 	}
 
 	// 更新用户配额缓存
-	err = dbmodel.CacheUpdateUserQuota(context.Background(), meta.UserId)
+	err = dbmodel.CacheUpdatePayerQuota(context.Background(), meta.UserId, meta.OrgId)
 	if err != nil {
 		fmt.Printf("更新用户配额缓存失败: %v\n", err)
 	}
 
 	if quota != 0 {
+		ctx := dbmodel.SettleModelCredit(context.Background(), meta.UserId, meta.OrgId, creditModelName(meta, modelName), quota)
 		tokenName := c.GetString("token_name")
 		xRequestID := c.GetString("X-Request-ID")
 		// 记录详细的扣费日志
 		logContent := fmt.Sprintf("Runway Image Generation  model: %s, mode: %s, image count: %d, total cost: $%.6f", modelName, mode, n, float64(quota)/5000000)
-		dbmodel.RecordConsumeLogWithRequestID(context.Background(), meta.UserId, meta.ChannelId, 0, 0, modelName, tokenName, quota, logContent, 0, title, referer, false, 0.0, xRequestID)
+		dbmodel.RecordConsumeLogWithRequestID(ctx, meta.UserId, meta.ChannelId, 0, 0, modelName, tokenName, quota, logContent, 0, title, referer, false, 0.0, xRequestID)
 		dbmodel.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
 		channelId := c.GetInt("channel_id")
 		dbmodel.UpdateChannelUsedQuota(channelId, quota)
@@ -767,17 +768,18 @@ func handleRunwayVideoBilling(c *gin.Context, meta *util.RelayMeta, modelName st
 	}
 
 	// 更新用户配额缓存
-	err = dbmodel.CacheUpdateUserQuota(context.Background(), meta.UserId)
+	err = dbmodel.CacheUpdatePayerQuota(context.Background(), meta.UserId, meta.OrgId)
 	if err != nil {
 		fmt.Printf("更新用户配额缓存失败: %v\n", err)
 	}
 
 	if quota != 0 {
+		ctx := dbmodel.SettleModelCredit(context.Background(), meta.UserId, meta.OrgId, creditModelName(meta, modelName), quota)
 		tokenName := c.GetString("token_name")
 		logContent := fmt.Sprintf("Runway Video Generation   model: %s, mode: %s, duration: %s, total cost: $%.6f", modelName, mode, duration, float64(quota)/500000)
 
 		// 使用视频消费日志记录（包含taskId）
-		dbmodel.RecordVideoConsumeLog(context.Background(), meta.UserId, meta.ChannelId, 0, 0, modelName, tokenName, quota, logContent, 0, title, referer, taskId)
+		dbmodel.RecordVideoConsumeLog(ctx, meta.UserId, meta.ChannelId, 0, 0, modelName, tokenName, quota, logContent, 0, title, referer, taskId)
 		dbmodel.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
 		channelId := c.GetInt("channel_id")
 		dbmodel.UpdateChannelUsedQuota(channelId, quota)
@@ -1451,16 +1453,17 @@ func handleSoraVideoBilling(c *gin.Context, meta *util.RelayMeta, modelName stri
 	}
 
 	// 更新用户配额缓存
-	err = dbmodel.CacheUpdateUserQuota(context.Background(), meta.UserId)
+	err = dbmodel.CacheUpdatePayerQuota(context.Background(), meta.UserId, meta.OrgId)
 	if err != nil {
 		fmt.Printf("更新用户配额缓存失败: %v\n", err)
 	}
 
 	if quota != 0 {
+		ctx := dbmodel.SettleModelCredit(context.Background(), meta.UserId, meta.OrgId, creditModelName(meta, modelName), quota)
 		tokenName := c.GetString("token_name")
 		logContent := fmt.Sprintf("Sora Video Generation model: %s, seconds: %s, total cost: $%.6f", modelName, seconds, float64(quota)/500000)
 
-		dbmodel.RecordVideoConsumeLog(context.Background(), meta.UserId, meta.ChannelId, 0, 0, modelName, tokenName, quota, logContent, 0, title, referer, videoId)
+		dbmodel.RecordVideoConsumeLog(ctx, meta.UserId, meta.ChannelId, 0, 0, modelName, tokenName, quota, logContent, 0, title, referer, videoId)
 		dbmodel.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
 		channelId := c.GetInt("channel_id")
 		dbmodel.UpdateChannelUsedQuota(channelId, quota)
@@ -2088,16 +2091,17 @@ func handleSoraRemixBilling(c *gin.Context, meta *util.RelayMeta, modelName stri
 	}
 
 	// 更新用户配额缓存
-	err = dbmodel.CacheUpdateUserQuota(context.Background(), meta.UserId)
+	err = dbmodel.CacheUpdatePayerQuota(context.Background(), meta.UserId, meta.OrgId)
 	if err != nil {
 		fmt.Printf("更新用户配额缓存失败: %v\n", err)
 	}
 
 	if quota != 0 {
+		ctx := dbmodel.SettleModelCredit(context.Background(), meta.UserId, meta.OrgId, creditModelName(meta, modelName), quota)
 		tokenName := c.GetString("token_name")
 		logContent := fmt.Sprintf("Sora Video Remix model: %s, seconds: %s, total cost: $%.6f", modelName, seconds, float64(quota)/500000)
 
-		dbmodel.RecordVideoConsumeLog(context.Background(), meta.UserId, meta.ChannelId, 0, 0, modelName, tokenName, quota, logContent, 0, title, referer, videoId)
+		dbmodel.RecordVideoConsumeLog(ctx, meta.UserId, meta.ChannelId, 0, 0, modelName, tokenName, quota, logContent, 0, title, referer, videoId)
 		dbmodel.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
 		dbmodel.UpdateChannelUsedQuota(meta.ChannelId, quota)
 	}
@@ -42,7 +42,7 @@ func directRelayXaiVideo(c *gin.Context, meta *util.RelayMeta, endpoint string)
 	params := xai.ParseNativeVideoParams(requestBody)
 	quota := xai.CalculateNativeVideoQuota(endpoint, params)
 
-	userQuota, err := dbmodel.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := dbmodel.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户配额失败: " + err.Error()})
 		return
@@ -145,13 +145,14 @@ func handleXaiVideoBilling(c *gin.Context, meta *util.RelayMeta, quota int64, ta
 		logger.Errorf(c.Request.Context(), "[xAI Video] 扣除token配额失败: %v", err)
 		return
 	}
-	_ = dbmodel.CacheUpdateUserQuota(context.Background(), meta.UserId)
+	_ = dbmodel.CacheUpdatePayerQuota(context.Background(), meta.UserId, meta.OrgId)
 
 	if quota != 0 {
+		ctx := dbmodel.SettleModelCredit(context.Background(), meta.UserId, meta.OrgId, meta.OriginModelName, quota)
 		tokenName := c.GetString("token_name")
 		logContent := fmt.Sprintf("xAI Video Generation model: %s, total cost: $%.6f",
 			meta.BillingModelName(), float64(quota)/config.QuotaPerUnit)
-		dbmodel.RecordVideoConsumeLog(context.Background(), meta.UserId, meta.ChannelId,
+		dbmodel.RecordVideoConsumeLog(ctx, meta.UserId, meta.ChannelId,
 			0, 0, meta.OriginModelName, tokenName, quota, logContent, 0, title, referer, taskId)
 		dbmodel.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
 		dbmodel.UpdateChannelUsedQuota(meta.ChannelId, quota)
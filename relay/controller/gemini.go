@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -19,6 +20,7 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/image"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/tracing"
 	dbmodel "github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/channel/gemini"
 	"github.com/songquanpeng/one-api/relay/channel/openai"
@@ -26,6 +28,8 @@ import (
 	"github.com/songquanpeng/one-api/relay/helper"
 	"github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/util"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // urlDownloadTask 表示一个URL下载任务
@@ -165,6 +169,7 @@ func processGeminiInlineDataURLs(ctx context.Context, requestBody []byte) ([]byt
 	// 第二步：并发下载所有URL，整体限制 3 分钟，单次由 GetGeminiMediaInfoWithContext 内限制 30 秒
 	downloadCtx, downloadCancel := context.WithTimeout(ctx, 3*time.Minute)
 	defer downloadCancel()
+	downloadCtx, downloadSpan := tracing.Start(downloadCtx, "media.download", trace.WithAttributes(attribute.Int("url_count", len(downloadTasks))))
 
 	results := make([]urlDownloadResult, len(downloadTasks))
 	var wg sync.WaitGroup
@@ -176,8 +181,11 @@ func processGeminiInlineDataURLs(ctx context.Context, requestBody []byte) ([]byt
 
 			logger.Infof(ctx, "Downloading URL [%d/%d]: %s", index+1, len(downloadTasks), t.url)
 
-			// 使用现有的图片处理函数下载并转换
-			mimeType, base64Data, mediaType, err := image.GetGeminiMediaInfoWithContext(downloadCtx, t.url)
+			// 使用现有的图片处理函数下载并转换；span 只记录域名，URL 可能带签名参数
+			urlCtx, urlSpan := tracing.Start(downloadCtx, "media.download_url", trace.WithAttributes(attribute.String("server.address", urlHost(t.url))))
+			mimeType, base64Data, mediaType, err := image.GetGeminiMediaInfoWithContext(urlCtx, t.url)
+			urlSpan.SetAttributes(attribute.String("media_type", mediaType), attribute.Int("size", len(base64Data)))
+			tracing.End(urlSpan, err)
 			if err != nil {
 				logger.Warnf(ctx, "Failed to download URL [%d/%d]: %v, URL: %s", index+1, len(downloadTasks), err, t.url)
 				results[index] = urlDownloadResult{
@@ -216,6 +224,7 @@ func processGeminiInlineDataURLs(ctx context.Context, requestBody []byte) ([]byt
 
 	// 等待所有下载完成
 	wg.Wait()
+	downloadSpan.End()
 	logger.Infof(ctx, "All %d URL downloads completed", len(downloadTasks))
 
 	// 第三步：应用下载结果到原始数据
@@ -263,6 +272,13 @@ func processGeminiInlineDataURLs(ctx context.Context, requestBody []byte) ([]byt
 // ensureGeminiContentsRole 确保 Gemini 请求体中的 contents 数组中每个元素都有 role 字段
 // Vertex AI API 要求必须指定 role 字段（值为 "user" 或 "model"），而 Gemini 原生 API 可以省略
 // 此函数用于在发送请求到 Vertex AI 之前自动补全缺失的 role 字段
+func urlHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Host
+	}
+	return ""
+}
+
 func ensureGeminiContentsRole(requestBody []byte) ([]byte, error) {
 	var request map[string]interface{}
 	if err := json.Unmarshal(requestBody, &request); err != nil {
@@ -358,7 +374,7 @@ func RelayGeminiNative(c *gin.Context) *model.ErrorWithStatusCode {
 		return openai.ErrorWrapper(err, "failed_to_calculate_pre_consumed_quota", http.StatusInternalServerError)
 	}
 
-	userQuota, err := dbmodel.CacheGetUserQuota(ctx, userId)
+	userQuota, err := dbmodel.CacheGetPayerQuota(ctx, userId, c.GetInt("org_id"))
 	if err != nil {
 		return openai.ErrorWrapper(err, "failed_to_get_user_quota", http.StatusInternalServerError)
 	}
@@ -413,6 +429,11 @@ func RelayGeminiNative(c *gin.Context) *model.ErrorWithStatusCode {
 		firstWordLatency = meta.GetFirstWordLatency()
 	}
 
+	servedModel := meta.BillingModelName()
+	if servedModel == "" {
+		servedModel = modelName
+	}
+	util.PublishRequestCost(c, servedModel, actualQuota, actualQuota)
 	go recordGeminiConsumption(ctx, userId, channelId, tokenId, modelName, tokenName, promptTokens, completionTokens, totalTokens, cachedTokens, actualQuota, c.Request.RequestURI, duration, meta.IsStream, c.Copy(), usageMetadata, firstWordLatency, groupRatio, modelRatio)
 	return nil
 }
@@ -424,8 +445,9 @@ func recordGeminiConsumption(ctx context.Context, userId, channelId, tokenId int
 		logger.Error(ctx,
 			"error consuming token remain quota: "+err.Error())
 	}
+	ctx = dbmodel.SettleModelCredit(ctx, userId, c.GetInt("org_id"), modelName, quota)
 
-	err = dbmodel.CacheUpdateUserQuota(ctx, userId)
+	err = dbmodel.CacheUpdatePayerQuota(ctx, userId, c.GetInt("org_id"))
 	if err != nil {
 		logger.Error(ctx,
 			"error update user quota cache: "+err.Error())
@@ -13,11 +13,14 @@ import (
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/tracing"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/channel/openai"
 	"github.com/songquanpeng/one-api/relay/constant"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/util"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func getAndValidateTextRequest(c *gin.Context, relayMode int) (*relaymodel.GeneralOpenAIRequest, error) {
@@ -181,14 +184,17 @@ func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIR
 		preConsumedQuota = getPreConsumedQuota(textRequest, promptTokens, ratio)
 	}
 
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		return preConsumedQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
 	if userQuota-preConsumedQuota < 0 {
 		return preConsumedQuota, openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
-	err = model.CacheDecreaseUserQuota(meta.UserId, preConsumedQuota)
+	if err := model.ReserveEphemeralKeySpend(ctx, preConsumedQuota); err != nil {
+		return preConsumedQuota, openai.ErrorWrapper(err, "ephemeral_key_spend_limit_exceeded", http.StatusForbidden)
+	}
+	err = model.CacheDecreasePayerQuota(meta.UserId, meta.OrgId, preConsumedQuota)
 	if err != nil {
 		return preConsumedQuota, openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -212,14 +218,17 @@ func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIR
 func preConsumeImageQuota(ctx context.Context, estimatedQuota int64, meta *util.RelayMeta) (int64, *relaymodel.ErrorWithStatusCode) {
 	preConsumedQuota := estimatedQuota
 
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		return 0, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
 	if userQuota-preConsumedQuota < 0 {
 		return 0, openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
-	err = model.CacheDecreaseUserQuota(meta.UserId, preConsumedQuota)
+	if err := model.ReserveEphemeralKeySpend(ctx, preConsumedQuota); err != nil {
+		return 0, openai.ErrorWrapper(err, "ephemeral_key_spend_limit_exceeded", http.StatusForbidden)
+	}
+	err = model.CacheDecreasePayerQuota(meta.UserId, meta.OrgId, preConsumedQuota)
 	if err != nil {
 		return 0, openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -248,71 +257,32 @@ func postConsumeQuota(ctx context.Context, c *gin.Context, usage *relaymodel.Usa
 		return
 	}
 
-	var quota int64
-	var logContent string
+	tq := calculateTextQuota(usage, meta, textRequest, ratio, modelRatio, groupRatio)
+	quota, logContent, billingModelName := tq.Quota, tq.LogContent, tq.BillingModelName
+	modelPrice, completionRatio, tierRatio := tq.ModelPrice, tq.CompletionRatio, tq.TierRatio
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
 	cachedTokens := usage.PromptTokensDetails.CachedTokens
 	cacheWriteTokens := usage.PromptTokensDetails.CacheWriteTokens
 
-	billingModelName := meta.BillingModelName()
-	if billingModelName == "" {
-		billingModelName = textRequest.Model
-	}
-	// long-context 分层定价：输入（含缓存读取/写入）×2，输出×1.5（gpt-5.6 系列）
-	// 对未注册 long-context 的模型，两个倍率均为 1.0。
-	longMults := common.GetLongContextMultipliers(billingModelName, promptTokens)
-	// 预先获取计费参数，避免后续重复调用
-	modelPrice := common.GetModelPrice(billingModelName, false)
-	completionRatio := common.GetCompletionRatio(billingModelName)
-	// groupRatio 此处已是"融合后的组合折扣" = 等级折扣 × 渠道折扣 × 用户渠道折扣
-	// 直接从 meta 取三个分量，用于日志/账单分项展示（比用除法反推更稳定）。
-	tierRatio := common.GetGroupRatio(meta.Group)
-	if modelPrice != -1 {
-		// 使用固定价格计费（按次计费）
-		quota = int64(modelPrice * 500000 * groupRatio)
-		logContent = fmt.Sprintf("模型固定价格 %.2f$，等级折扣 %.2f，渠道折扣 %.2f，用户渠道折扣 %.2f", modelPrice, tierRatio, meta.ChannelDiscount, meta.UserChannelRatio)
-	} else {
-		// 使用基于token的倍率计费
-		if cachedTokens > 0 || cacheWriteTokens > 0 {
-			// 有缓存读取或写入：从输入 token 中扣除缓存读取与写入部分，各按对应倍率计费
-			cacheRatio := common.GetCacheRatio(billingModelName)
-			cacheWriteRatio := common.GetCacheWriteRatio(billingModelName)
-			nonCachedPromptTokens := promptTokens - cachedTokens - cacheWriteTokens
-			if nonCachedPromptTokens < 0 {
-				nonCachedPromptTokens = 0
-			}
-			// 输入（含缓存）× longInputMultiplier
-			inputQuota := float64(nonCachedPromptTokens) * modelRatio * longMults.InputMultiplier * groupRatio
-			cacheQuota := float64(cachedTokens) * modelRatio * cacheRatio * longMults.InputMultiplier * groupRatio
-			cacheWriteQuota := float64(cacheWriteTokens) * modelRatio * cacheWriteRatio * longMults.InputMultiplier * groupRatio
-			// 输出× longOutputMultiplier
-			outputQuota := float64(completionTokens) * modelRatio * completionRatio * longMults.OutputMultiplier * groupRatio
-			quota = int64(math.Ceil(inputQuota + cacheQuota + cacheWriteQuota + outputQuota))
-		} else {
-			// 无缓存分支：输入× longInputMultiplier，输出× longOutputMultiplier
-			inputQuota := float64(promptTokens) * modelRatio * longMults.InputMultiplier
-			outputQuota := float64(completionTokens) * modelRatio * completionRatio * longMults.OutputMultiplier
-			quota = int64(math.Ceil((inputQuota + outputQuota) * groupRatio))
-		}
-		if ratio != 0 && quota <= 0 {
-			quota = 1
-		}
-		totalTokens := promptTokens + completionTokens
-		if totalTokens == 0 {
-			// in this case, must be some error happened
-			// we cannot just return, because we may have to return the pre-consumed quota
-			quota = 0
-		}
-		logContent = fmt.Sprintf("模型倍率 %.2f，等级折扣 %.2f，渠道折扣 %.2f，用户渠道折扣 %.2f，补全倍率 %.2f，long输入倍率 %.1f，long输出倍率 %.1f", modelRatio, tierRatio, meta.ChannelDiscount, meta.UserChannelRatio, completionRatio, longMults.InputMultiplier, longMults.OutputMultiplier)
-	}
+	// 计费写库在异步 goroutine 里进行，span 挂在请求 span 下，结束时间可能晚于请求本身
+	ctx, billingSpan := tracing.Start(ctx, "billing.post_consume", trace.WithAttributes(
+		attribute.Int("channel_id", meta.ChannelId),
+		attribute.String("model", billingModelName),
+		attribute.Int("prompt_tokens", promptTokens),
+		attribute.Int("completion_tokens", completionTokens),
+		attribute.Int("cached_tokens", cachedTokens),
+		attribute.Int64("quota", quota),
+	))
+	defer billingSpan.End()
 
 	quotaDelta := quota - preConsumedQuota
 	err := model.PostConsumeTokenQuota(meta.TokenId, quotaDelta)
 	if err != nil {
 		logger.Error(ctx, "error consuming token remain quota: "+err.Error())
 	}
-	err = model.CacheUpdateUserQuota(ctx, meta.UserId)
+	ctx = model.SettleModelCredit(ctx, meta.UserId, meta.OrgId, creditModelName(meta, billingModelName), quota)
+	err = model.CacheUpdatePayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		logger.Error(ctx, "error update user quota cache: "+err.Error())
 	}
@@ -328,6 +298,9 @@ func postConsumeQuota(ctx context.Context, c *gin.Context, usage *relaymodel.Usa
 			"channel_discount":   meta.ChannelDiscount,
 			"user_channel_ratio": meta.UserChannelRatio,
 		}
+		if meta.PricingPlanRatio > 0 && meta.PricingPlanRatio != 1 {
+			billingDetails["pricing_plan_ratio"] = meta.PricingPlanRatio
+		}
 		// 多 Key 渠道：记录本次实际使用的 Key 索引
 		if meta.IsMultiKey && meta.KeyIndex != nil {
 			billingDetails["is_multi_key"] = true
@@ -382,6 +355,87 @@ func postConsumeQuota(ctx context.Context, c *gin.Context, usage *relaymodel.Usa
 	}
 }
 
+// textQuota 文本类请求的计费结果
+type textQuota struct {
+	Quota            int64
+	LogContent       string
+	BillingModelName string
+	ModelPrice       float64
+	CompletionRatio  float64
+	TierRatio        float64
+}
+
+// calculateTextQuota 按用量计算文本类请求的额度，不写库。
+// postConsumeQuota 在异步计费时使用；relay 主流程同步调用一次以便在响应中返回计费信息
+func calculateTextQuota(usage *relaymodel.Usage, meta *util.RelayMeta, textRequest *relaymodel.GeneralOpenAIRequest, ratio float64, modelRatio float64, groupRatio float64) textQuota {
+	var quota int64
+	var logContent string
+	promptTokens := usage.PromptTokens
+	completionTokens := usage.CompletionTokens
+	cachedTokens := usage.PromptTokensDetails.CachedTokens
+	cacheWriteTokens := usage.PromptTokensDetails.CacheWriteTokens
+
+	billingModelName := meta.BillingModelName()
+	if billingModelName == "" {
+		billingModelName = textRequest.Model
+	}
+	// long-context 分层定价：输入（含缓存读取/写入）×2，输出×1.5（gpt-5.6 系列）
+	// 对未注册 long-context 的模型，两个倍率均为 1.0。
+	longMults := common.GetLongContextMultipliers(billingModelName, promptTokens)
+	// 预先获取计费参数，避免后续重复调用
+	modelPrice := common.GetModelPrice(billingModelName, false)
+	completionRatio := common.GetCompletionRatio(billingModelName)
+	// groupRatio 此处已是"融合后的组合折扣" = 等级折扣 × 渠道折扣 × 用户渠道折扣
+	// 直接从 meta 取三个分量，用于日志/账单分项展示（比用除法反推更稳定）。
+	tierRatio := common.GetGroupRatio(meta.Group)
+	if modelPrice != -1 {
+		// 使用固定价格计费（按次计费）
+		quota = int64(modelPrice * 500000 * groupRatio)
+		logContent = fmt.Sprintf("模型固定价格 %.2f$，等级折扣 %.2f，渠道折扣 %.2f，用户渠道折扣 %.2f", modelPrice, tierRatio, meta.ChannelDiscount, meta.UserChannelRatio)
+	} else {
+		// 使用基于token的倍率计费
+		if cachedTokens > 0 || cacheWriteTokens > 0 {
+			// 有缓存读取或写入：从输入 token 中扣除缓存读取与写入部分，各按对应倍率计费
+			cacheRatio := common.GetCacheRatio(billingModelName)
+			cacheWriteRatio := common.GetCacheWriteRatio(billingModelName)
+			nonCachedPromptTokens := promptTokens - cachedTokens - cacheWriteTokens
+			if nonCachedPromptTokens < 0 {
+				nonCachedPromptTokens = 0
+			}
+			// 输入（含缓存）× longInputMultiplier
+			inputQuota := float64(nonCachedPromptTokens) * modelRatio * longMults.InputMultiplier * groupRatio
+			cacheQuota := float64(cachedTokens) * modelRatio * cacheRatio * longMults.InputMultiplier * groupRatio
+			cacheWriteQuota := float64(cacheWriteTokens) * modelRatio * cacheWriteRatio * longMults.InputMultiplier * groupRatio
+			// 输出× longOutputMultiplier
+			outputQuota := float64(completionTokens) * modelRatio * completionRatio * longMults.OutputMultiplier * groupRatio
+			quota = int64(math.Ceil(inputQuota + cacheQuota + cacheWriteQuota + outputQuota))
+		} else {
+			// 无缓存分支：输入× longInputMultiplier，输出× longOutputMultiplier
+			inputQuota := float64(promptTokens) * modelRatio * longMults.InputMultiplier
+			outputQuota := float64(completionTokens) * modelRatio * completionRatio * longMults.OutputMultiplier
+			quota = int64(math.Ceil((inputQuota + outputQuota) * groupRatio))
+		}
+		if ratio != 0 && quota <= 0 {
+			quota = 1
+		}
+		totalTokens := promptTokens + completionTokens
+		if totalTokens == 0 {
+			// in this case, must be some error happened
+			// we cannot just return, because we may have to return the pre-consumed quota
+			quota = 0
+		}
+		logContent = fmt.Sprintf("模型倍率 %.2f，等级折扣 %.2f，渠道折扣 %.2f，用户渠道折扣 %.2f，补全倍率 %.2f，long输入倍率 %.1f，long输出倍率 %.1f", modelRatio, tierRatio, meta.ChannelDiscount, meta.UserChannelRatio, completionRatio, longMults.InputMultiplier, longMults.OutputMultiplier)
+	}
+	return textQuota{
+		Quota:            quota,
+		LogContent:       logContent,
+		BillingModelName: billingModelName,
+		ModelPrice:       modelPrice,
+		CompletionRatio:  completionRatio,
+		TierRatio:        tierRatio,
+	}
+}
+
 // updateMultiKeyUsage 更新多Key使用统计
 func updateMultiKeyUsage(ctx context.Context, meta *util.RelayMeta, success bool) {
 	// 只有多Key模式才需要更新统计
@@ -454,11 +508,15 @@ func enrichBillingDetailsFromContext(c *gin.Context, details map[string]interfac
 	if v := c.GetFloat64("user_channel_ratio"); v > 0 {
 		userChannelRatio = v
 	}
+	pricingPlanRatio := util.GetPricingPlanRatio(c)
 	details["channel_discount"] = channelDiscount
 	details["user_channel_ratio"] = userChannelRatio
+	if pricingPlanRatio != 1 {
+		details["pricing_plan_ratio"] = pricingPlanRatio
+	}
 	// 若调用方已填入 group_ratio（组合后的），反推一下 tier_ratio 方便前端显示。
 	if gr, ok := details["group_ratio"].(float64); ok && channelDiscount > 0 && userChannelRatio > 0 {
-		details["tier_ratio"] = gr / (channelDiscount * userChannelRatio)
+		details["tier_ratio"] = gr / (channelDiscount * userChannelRatio * pricingPlanRatio)
 	}
 	if c.GetBool("is_multi_key") {
 		details["is_multi_key"] = true
@@ -472,6 +530,14 @@ func enrichBillingDetailsFromContext(c *gin.Context, details map[string]interfac
 }
 
 // appendModelMappingInfo 向 other 字段追加模型重定向标记
+// creditModelName 模型专用额度按用户请求的模型名抵扣，没有原始模型名时退回计费模型名
+func creditModelName(meta *util.RelayMeta, fallback string) string {
+	if meta.OriginModelName != "" {
+		return meta.OriginModelName
+	}
+	return fallback
+}
+
 func appendModelMappingInfo(other string, originModel string, actualModel string) string {
 	if originModel == "" || actualModel == "" || originModel == actualModel {
 		return other
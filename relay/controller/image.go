@@ -419,14 +419,26 @@ func consumeImageQuota(params *imageConsumeParams) {
 		logger.Error(params.ctx, "error consuming token remain quota: "+err.Error())
 	}
 
-	err = model.CacheUpdateUserQuota(params.ctx, params.meta.UserId)
+	err = model.CacheUpdatePayerQuota(params.ctx, params.meta.UserId, params.meta.OrgId)
 	if err != nil {
 		logger.Error(params.ctx, "error update user quota cache: "+err.Error())
 	}
 
+	// 模型名
+	logModelName := params.modelName
+	if logModelName == "" {
+		logModelName = params.meta.BillingModelName()
+		if logModelName == "" {
+			logModelName = params.meta.ActualModelName
+		}
+	}
+	// 额度已同步扣除，没有待扣部分
+	util.PublishRequestCost(params.c, logModelName, params.actualQuota, 0)
+
 	if params.actualQuota == 0 {
 		return
 	}
+	params.ctx = model.SettleModelCredit(params.ctx, params.meta.UserId, params.meta.OrgId, creditModelName(params.meta, logModelName), params.actualQuota)
 
 	// 计算耗时
 	rowDuration := time.Since(params.startTime).Seconds()
@@ -438,15 +450,6 @@ func consumeImageQuota(params *imageConsumeParams) {
 	tokenName := params.c.GetString("token_name")
 	xRequestID := params.c.GetString("X-Request-ID")
 
-	// 模型名
-	logModelName := params.modelName
-	if logModelName == "" {
-		logModelName = params.meta.BillingModelName()
-		if logModelName == "" {
-			logModelName = params.meta.ActualModelName
-		}
-	}
-
 	// 构建 otherInfo
 	adminInfo := extractAdminInfoFromContext(params.c)
 	otherInfo := buildOtherInfoWithUsageDetails(adminInfo, params.usageDetails)
@@ -1283,10 +1286,11 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 					logger.SysError("error consuming token remain quota for doubao image: " + err.Error())
 				}
 
-				err = model.CacheUpdateUserQuota(ctx, meta.UserId)
+				err = model.CacheUpdatePayerQuota(ctx, meta.UserId, meta.OrgId)
 				if err != nil {
 					logger.SysError("error update user quota cache for doubao image: " + err.Error())
 				}
+				ctx = model.SettleModelCredit(ctx, meta.UserId, meta.OrgId, creditModelName(meta, meta.ActualModelName), quota)
 
 				referer := c.Request.Header.Get("HTTP-Referer")
 				title := c.Request.Header.Get("X-Title")
@@ -1301,6 +1305,8 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 					modelName = meta.ActualModelName
 				}
 
+				util.PublishRequestCost(c, modelName, quota, 0)
+
 				// 计算详细的成本信息
 				totalCost := float64(quota) / 500000
 				logContent := fmt.Sprintf("Doubao Image Request - Model: %s, Generated images: %d, Price per image: $%.2f, Total cost: $%.6f, Duration: %.3fs",
@@ -1347,10 +1353,11 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 			logger.SysError("error consuming token remain quota: " + err.Error())
 		}
 
-		err = model.CacheUpdateUserQuota(ctx, meta.UserId)
+		err = model.CacheUpdatePayerQuota(ctx, meta.UserId, meta.OrgId)
 		if err != nil {
 			logger.SysError("error update user quota cache: " + err.Error())
 		}
+		ctx = model.SettleModelCredit(ctx, meta.UserId, meta.OrgId, creditModelName(meta, meta.ActualModelName), quota)
 
 		referer := c.Request.Header.Get("HTTP-Referer")
 		title := c.Request.Header.Get("X-Title")
@@ -1374,6 +1381,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		if logModelName == "" {
 			logModelName = meta.ActualModelName
 		}
+		util.PublishRequestCost(c, logModelName, quota, 0)
 		otherInfoImg := appendModelMappingInfo("", meta.OriginModelName, meta.ActualModelName)
 		if isGPTImageModel(meta.ActualModelName) && gptImageUsageCaptured {
 			otherInfoImg = appendGPTImageUsageDetailsToOther(otherInfoImg, gptImageUsageDetails)
@@ -2996,6 +3004,7 @@ func CreateImageLog(provider string, taskId string, meta *util.RelayMeta, status
 		Username:   model.GetUsernameById(meta.UserId),
 		ChannelId:  meta.ChannelId,
 		UserId:     meta.UserId,
+		OrgId:      meta.OrgId,
 		Model:      meta.OriginModelName,
 		Status:     status,
 		FailReason: failReason,
@@ -3092,7 +3101,7 @@ func handleSuccessfulResponseImage(c *gin.Context, ctx context.Context, meta *ut
 		return err
 	}
 
-	err = model.CacheUpdateUserQuota(ctx, meta.UserId)
+	err = model.CacheUpdatePayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		logger.Error(ctx,
 			"error update user quota cache: "+err.Error())
@@ -3100,6 +3109,7 @@ func handleSuccessfulResponseImage(c *gin.Context, ctx context.Context, meta *ut
 	}
 
 	if quota != 0 {
+		ctx = model.SettleModelCredit(ctx, meta.UserId, meta.OrgId, creditModelName(meta, modelName), quota)
 		tokenName := c.GetString("token_name")
 		xRequestID := c.GetString("X-Request-ID")
 		// Include pricing details in log content
@@ -131,6 +131,7 @@ func DoIdentifyFace(c *gin.Context) {
 	video := &dbmodel.Video{
 		TaskId:    klingResp.Data.SessionID, // session_id 作为 task_id
 		UserId:    meta.UserId,
+		OrgId:     meta.OrgId,
 		Username:  user.Username,
 		ChannelId: meta.ChannelId,
 		Model:     model,
@@ -204,7 +205,7 @@ func DoAdvancedLipSync(c *gin.Context) {
 	quota := common.CalculateVideoQuota(model, requestType, "", "", "", "")
 
 	// 检查用户余额（后扣费模式：仅验证余额）
-	userQuota, err := dbmodel.CacheGetUserQuota(c.Request.Context(), meta.UserId)
+	userQuota, err := dbmodel.CacheGetPayerQuota(c.Request.Context(), meta.UserId, meta.OrgId)
 	if err != nil {
 		logger.Error(c.Request.Context(), fmt.Sprintf("Kling advanced-lip-sync get user quota error: user_id=%d, error=%v", meta.UserId, err))
 		errResp := openai.ErrorWrapper(err, "get_user_quota_error", http.StatusInternalServerError)
@@ -247,6 +248,7 @@ func DoAdvancedLipSync(c *gin.Context) {
 	video := &dbmodel.Video{
 		TaskId:    "",
 		UserId:    meta.UserId,
+		OrgId:     meta.OrgId,
 		Username:  user.Username,
 		ChannelId: meta.ChannelId,
 		Model:     model,
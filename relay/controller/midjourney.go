@@ -146,7 +146,7 @@ func RelaySwapFace(c *gin.Context) *midjourney.MidjourneyResponseWithStatusCode
 	}
 	groupRatio := util.GetBillingGroupRatio(c, group)
 	ratio := modelPrice * groupRatio
-	userQuota, err := model.CacheGetUserQuota(ctx, userId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, userId, c.GetInt("org_id"))
 	if err != nil {
 		return &midjourney.MidjourneyResponseWithStatusCode{
 			StatusCode: http.StatusBadRequest,
@@ -195,11 +195,12 @@ func RelaySwapFace(c *gin.Context) *midjourney.MidjourneyResponseWithStatusCode
 			if err != nil {
 				logger.Error(ctx, "error consuming token remain quota: "+err.Error())
 			}
-			err = model.CacheUpdateUserQuota(ctx, userId)
+			err = model.CacheUpdatePayerQuota(ctx, userId, c.GetInt("org_id"))
 			if err != nil {
 				logger.Error(ctx, "error update user quota cache: "+err.Error())
 			}
 			if quota != 0 {
+				ctx = model.SettleModelCredit(ctx, userId, c.GetInt("org_id"), modelName, quota)
 				tokenName := c.GetString("token_name")
 				xRequestID := c.GetString("X-Request-ID")
 				logContent := fmt.Sprintf("模型固定价格 %.2f，分组倍率 %.2f，操作 %s", modelPrice, groupRatio, common.MjActionSwapFace)
@@ -213,6 +214,7 @@ func RelaySwapFace(c *gin.Context) *midjourney.MidjourneyResponseWithStatusCode
 	midjResponse := &mjResp.Response
 	midjourneyTask := &model.Midjourney{
 		UserId:      userId,
+		OrgId:       c.GetInt("org_id"),
 		Code:        midjResponse.Code,
 		Action:      common.MjActionSwapFace,
 		MjId:        midjResponse.Result,
@@ -560,7 +562,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *midjourney.Midjourney
 	ctx := c.Request.Context()
 	groupRatio := util.GetBillingGroupRatio(c, group)
 	ratio := modelPrice * groupRatio
-	userQuota, err := model.CacheGetUserQuota(ctx, userId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, userId, c.GetInt("org_id"))
 	logger.Info(c.Request.Context(), fmt.Sprintf("erruserQuota1:%+v\n", err))
 	if err != nil {
 		return &midjourney.MidjourneyResponseWithStatusCode{
@@ -602,11 +604,12 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *midjourney.Midjourney
 			if err != nil {
 				logger.Error(ctx, "error consuming token remain quota: "+err.Error())
 			}
-			err = model.CacheUpdateUserQuota(ctx, userId)
+			err = model.CacheUpdatePayerQuota(ctx, userId, c.GetInt("org_id"))
 			if err != nil {
 				logger.Error(ctx, "error update user quota cache: "+err.Error())
 			}
 			if quota != 0 {
+				ctx = model.SettleModelCredit(ctx, userId, c.GetInt("org_id"), modelName, quota)
 				tokenName := c.GetString("token_name")
 				xRequestID := c.GetString("X-Request-ID")
 				logContent := fmt.Sprintf("模型固定价格 %.2f，分组倍率 %.2f，操作 %s", modelPrice, groupRatio, midjRequest.Action)
@@ -627,6 +630,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *midjourney.Midjourney
 	// other: 提交错误，description为错误描述
 	midjourneyTask := &model.Midjourney{
 		UserId:      userId,
+		OrgId:       c.GetInt("org_id"),
 		Code:        midjResponse.Code,
 		Action:      midjRequest.Action,
 		MjId:        midjResponse.Result,
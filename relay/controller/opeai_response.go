@@ -89,7 +89,7 @@ func RelayOpenaiResponseNative(c *gin.Context) *model.ErrorWithStatusCode {
 		return openai.ErrorWrapper(err, "failed_to_calculate_pre_consumed_quota", http.StatusInternalServerError)
 	}
 
-	userQuota, err := dbmodel.CacheGetUserQuota(ctx, userId)
+	userQuota, err := dbmodel.CacheGetPayerQuota(ctx, userId, c.GetInt("org_id"))
 	if err != nil {
 		return openai.ErrorWrapper(err, "failed_to_get_user_quota", http.StatusInternalServerError)
 	}
@@ -152,6 +152,11 @@ func RelayOpenaiResponseNative(c *gin.Context) *model.ErrorWithStatusCode {
 		cacheWriteTokens = usageMetadata.InputTokensDetails.CacheWriteTokens
 	}
 
+	servedModel := meta.BillingModelName()
+	if servedModel == "" {
+		servedModel = modelName
+	}
+	util.PublishRequestCost(c, servedModel, actualQuota, actualQuota)
 	go recordOpenaiResponseConsumption(ctx, userId, channelId, tokenId, modelName, tokenName, promptTokens, completionTokens, totalTokens, cachedTokens, cacheWriteTokens, actualQuota, c.Request.RequestURI, duration, meta.IsStream, c.Copy(), usageMetadata, firstWordLatency, groupRatio, modelRatio)
 
 	return nil
@@ -164,8 +169,9 @@ func recordOpenaiResponseConsumption(ctx context.Context, userId, channelId, tok
 		logger.Error(ctx,
 			"error consuming token remain quota: "+err.Error())
 	}
+	ctx = dbmodel.SettleModelCredit(ctx, userId, c.GetInt("org_id"), modelName, quota)
 
-	err = dbmodel.CacheUpdateUserQuota(ctx, userId)
+	err = dbmodel.CacheUpdatePayerQuota(ctx, userId, c.GetInt("org_id"))
 	if err != nil {
 		logger.Error(ctx,
 			"error update user quota cache: "+err.Error())
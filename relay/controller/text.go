@@ -178,6 +178,10 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 	// 获取X-Title header
 	title := c.Request.Header.Get("X-Title")
 	handResultStartTime := time.Now()
+	if usage != nil {
+		tq := calculateTextQuota(usage, meta, textRequest, ratio, modelRatio, groupRatio)
+		util.PublishRequestCost(c, tq.BillingModelName, tq.Quota, tq.Quota-preConsumedQuota)
+	}
 	// post-consume quota
 	go postConsumeQuota(ctx, c.Copy(), usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, duration, title, referer, firstWordLatency)
 
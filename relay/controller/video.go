@@ -192,7 +192,7 @@ func handleRunwayVideoRequest(c *gin.Context, ctx context.Context, videoRequest
 func sendRequestMinimaxAndHandleResponse(c *gin.Context, ctx context.Context, fullRequestUrl string, jsonData []byte, meta *util.RelayMeta, modelName string) *model.ErrorWithStatusCode {
 	// 预扣费检查 - 预扣0.2，后续处理完多退少补
 	quota := int64(0.2 * config.QuotaPerUnit)
-	userQuota, err := dbmodel.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := dbmodel.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		return openai.ErrorWrapper(err, "get_user_quota_error", http.StatusInternalServerError)
 	}
@@ -239,7 +239,7 @@ func sendRequestMinimaxAndHandleResponse(c *gin.Context, ctx context.Context, fu
 func sendRequestZhipuAndHandleResponse(c *gin.Context, ctx context.Context, fullRequestUrl string, jsonData []byte, meta *util.RelayMeta, modelName string) *model.ErrorWithStatusCode {
 	// 预扣费检查 - 预扣0.2，后续处理完多退少补
 	quota := int64(0.2 * config.QuotaPerUnit)
-	userQuota, err := dbmodel.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := dbmodel.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		return openai.ErrorWrapper(err, "get_user_quota_error", http.StatusInternalServerError)
 	}
@@ -284,7 +284,7 @@ func sendRequestZhipuAndHandleResponse(c *gin.Context, ctx context.Context, full
 func sendRequestRunwayAndHandleResponse(c *gin.Context, ctx context.Context, fullRequestUrl string, jsonData []byte, meta *util.RelayMeta, modelName string) *model.ErrorWithStatusCode {
 	// 预扣费检查 - 预扣0.2，后续处理完多退少补
 	quota := int64(0.2 * config.QuotaPerUnit)
-	userQuota, err := dbmodel.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := dbmodel.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		return openai.ErrorWrapper(err, "get_user_quota_error", http.StatusInternalServerError)
 	}
@@ -703,13 +703,14 @@ func handleSuccessfulResponseWithQuota(c *gin.Context, ctx context.Context, meta
 			"error consuming token remain quota: "+err.Error())
 	}
 
-	err = dbmodel.CacheUpdateUserQuota(ctx, meta.UserId)
+	err = dbmodel.CacheUpdatePayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		logger.Error(ctx,
 			"error update user quota cache: "+err.Error())
 	}
 
 	if quota != 0 {
+		ctx = dbmodel.SettleModelCredit(ctx, meta.UserId, meta.OrgId, creditModelName(meta, modelName), quota)
 		var modelPrice float64
 		defaultPrice, ok := common.DefaultModelPrice[modelName]
 		if !ok {
@@ -741,7 +742,7 @@ func handleSuccessfulResponseWithQuota(c *gin.Context, ctx context.Context, meta
 func invokeVideoAdaptorRequest(c *gin.Context, ctx context.Context, adaptor relaychannel.VideoAdaptor, videoRequest *model.VideoRequest, meta *util.RelayMeta) *model.ErrorWithStatusCode {
 	// 预扣费余额检查
 	prePayment := adaptor.GetPrePaymentQuota()
-	userQuota, err := dbmodel.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := dbmodel.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		return openai.ErrorWrapper(err, "get_user_quota_error", http.StatusInternalServerError)
 	}
@@ -879,6 +880,7 @@ func CreateVideoLog(provider string, taskId string, meta *util.RelayMeta, mode s
 		ChannelId:     meta.ChannelId,
 		UserId:        meta.UserId,
 		TokenId:       meta.TokenId,
+		OrgId:         meta.OrgId,
 		Mode:          mode, //keling
 		Type:          finalVideoType,
 		Model:         meta.OriginModelName,
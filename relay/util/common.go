@@ -285,6 +285,8 @@ func PostConsumeQuota(ctx context.Context, tokenId int, quotaDelta int64, totalQ
 	}
 	// totalQuota is total quota consumed
 	if totalQuota != 0 {
+		orgId, _ := ctx.Value(logger.OrgIdKey).(int)
+		ctx = model.SettleModelCredit(ctx, userId, orgId, modelName, totalQuota)
 		logContent := fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f", modelRatio, groupRatio)
 		model.RecordConsumeLog(ctx, userId, channelId, int(totalQuota), 0, modelName, tokenName, totalQuota, logContent, duration, title, httpReferer, false, 0.0)
 		model.UpdateUserUsedQuotaAndRequestCount(userId, totalQuota)
@@ -308,6 +310,8 @@ func PostConsumeQuotaWithTokens(ctx context.Context, tokenId int, quotaDelta int
 	}
 	// totalQuota is total quota consumed
 	if totalQuota != 0 {
+		orgId, _ := ctx.Value(logger.OrgIdKey).(int)
+		ctx = model.SettleModelCredit(ctx, userId, orgId, modelName, totalQuota)
 		logContent := fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f", modelRatio, groupRatio)
 		// 正确记录inputTokens和outputTokens
 		model.RecordConsumeLog(ctx, userId, channelId, int(inputTokens), int(outputTokens), modelName, tokenName, totalQuota, logContent, duration, title, httpReferer, false, 0.0)
@@ -332,6 +336,8 @@ func PostConsumeQuotaWithDetailedTokens(ctx context.Context, tokenId int, quotaD
 	}
 	// totalQuota is total quota consumed
 	if totalQuota != 0 {
+		orgId, _ := ctx.Value(logger.OrgIdKey).(int)
+		ctx = model.SettleModelCredit(ctx, userId, orgId, modelName, totalQuota)
 		logContent := fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f", modelRatio, groupRatio)
 
 		// 创建详细的token信息JSON
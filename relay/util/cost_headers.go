@@ -0,0 +1,250 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// 计费响应头。非流式响应在写出前附加；流式响应的头在用量确定前已发出，改为在流末尾追加一条 SSE 注释：
+//
+//	: oneapi-cost {"request_id":"...","model":"...","quota":123,...}
+const (
+	CostHeaderRequestId      = "X-OneAPI-Request-Id"
+	CostHeaderModel          = "X-OneAPI-Model"
+	CostHeaderQuota          = "X-OneAPI-Quota"
+	CostHeaderCostUSD        = "X-OneAPI-Cost-USD"
+	CostHeaderTokenRemaining = "X-OneAPI-Token-Remaining-Quota"
+	CostHeaderUserRemaining  = "X-OneAPI-User-Remaining-Quota"
+
+	costSSECommentPrefix = ": oneapi-cost "
+	costWriterKey        = "cost_writer"
+)
+
+// RequestCost 单次请求的计费结果。TokenRemainingQuota 为 nil 表示令牌不限额度
+type RequestCost struct {
+	RequestId           string  `json:"request_id"`
+	Model               string  `json:"model"`
+	Quota               int64   `json:"quota"`
+	CostUSD             float64 `json:"cost_usd"`
+	TokenRemainingQuota *int64  `json:"token_remaining_quota"`
+	UserRemainingQuota  int64   `json:"user_remaining_quota"`
+}
+
+func (rc *RequestCost) applyHeaders(h http.Header) {
+	h.Set(CostHeaderRequestId, rc.RequestId)
+	h.Set(CostHeaderModel, rc.Model)
+	h.Set(CostHeaderQuota, strconv.FormatInt(rc.Quota, 10))
+	h.Set(CostHeaderCostUSD, strconv.FormatFloat(rc.CostUSD, 'f', 6, 64))
+	if rc.TokenRemainingQuota == nil {
+		h.Set(CostHeaderTokenRemaining, "unlimited")
+	} else {
+		h.Set(CostHeaderTokenRemaining, strconv.FormatInt(*rc.TokenRemainingQuota, 10))
+	}
+	h.Set(CostHeaderUserRemaining, strconv.FormatInt(rc.UserRemainingQuota, 10))
+}
+
+// CostWriter 包装响应写入器，让计费结果能在响应发出前写进响应头。
+//
+// 非流式响应先整体缓冲，Finish 时带上计费头一次写出；一旦调用了 Flush（SSE、分块音频等），
+// 转为直通，已缓冲的内容立即写出。SSE 流中的 "data: [DONE]" 会被扣住，
+// 以便计费注释排在它之前，兼容读到 [DONE] 就停止的客户端
+type CostWriter struct {
+	gin.ResponseWriter
+	status      int
+	buf         bytes.Buffer
+	written     bool
+	passthrough bool
+	eventStream bool
+	held        []byte
+	cost        *RequestCost
+	finished    bool
+}
+
+// NewCostWriter 替换 c.Writer，调用方必须在请求结束时调用 Finish
+func NewCostWriter(c *gin.Context) *CostWriter {
+	w := &CostWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	c.Set(costWriterKey, w)
+	return w
+}
+
+func (w *CostWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *CostWriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	w.written = true
+}
+
+func (w *CostWriter) Write(data []byte) (int, error) {
+	if !w.passthrough {
+		w.written = true
+		return w.buf.Write(data)
+	}
+	if !w.eventStream {
+		return w.ResponseWriter.Write(data)
+	}
+	if len(w.held) > 0 {
+		if len(bytes.TrimSpace(data)) == 0 {
+			w.held = append(w.held, data...)
+			return len(data), nil
+		}
+		if err := w.releaseHeld(); err != nil {
+			return 0, err
+		}
+	}
+	if string(bytes.TrimSpace(data)) == "data: [DONE]" {
+		w.held = append(w.held, data...)
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *CostWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *CostWriter) Flush() {
+	if !w.passthrough {
+		w.startPassthrough()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *CostWriter) Status() int {
+	if !w.passthrough && w.status != 0 {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *CostWriter) Size() int {
+	if !w.passthrough {
+		if !w.written {
+			return -1
+		}
+		return w.buf.Len()
+	}
+	return w.ResponseWriter.Size()
+}
+
+func (w *CostWriter) Written() bool {
+	if !w.passthrough {
+		return w.written
+	}
+	return w.ResponseWriter.Written()
+}
+
+// SetCost 记录本次请求的计费结果，在 Finish 时写出
+func (w *CostWriter) SetCost(cost *RequestCost) {
+	w.cost = cost
+}
+
+// startPassthrough 把缓冲的状态码和内容写出，之后的写入直接透传
+func (w *CostWriter) startPassthrough() {
+	w.passthrough = true
+	w.eventStream = strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if w.written {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+	if w.buf.Len() > 0 {
+		_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+func (w *CostWriter) releaseHeld() error {
+	held := w.held
+	w.held = nil
+	_, err := w.ResponseWriter.Write(held)
+	return err
+}
+
+// Finish 写出缓冲的响应（附带计费头）或流末尾的计费注释，可重复调用
+func (w *CostWriter) Finish() {
+	if w.finished {
+		return
+	}
+	w.finished = true
+	if !w.passthrough {
+		// 只给成功响应附加计费头
+		if w.cost != nil && w.Status() < http.StatusBadRequest {
+			w.cost.applyHeaders(w.Header())
+		}
+		w.startPassthrough()
+		return
+	}
+	if w.eventStream && w.cost != nil {
+		_, _ = w.ResponseWriter.Write([]byte(costComment(w.cost)))
+	}
+	if len(w.held) > 0 {
+		_ = w.releaseHeld()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// PublishRequestCost 在计费完成后调用，把计费结果交给 CostWriter。
+// pendingQuota 是尚未从令牌和付费方扣除的额度（计费写库是异步的），剩余额度据此估算。
+// 没有挂 CostHeaders 中间件的路由直接返回，不产生额外查询
+func PublishRequestCost(c *gin.Context, servedModel string, quota int64, pendingQuota int64) {
+	if !config.CostHeadersEnabled {
+		return
+	}
+	v, ok := c.Get(costWriterKey)
+	if !ok {
+		return
+	}
+	w, ok := v.(*CostWriter)
+	if !ok || w.finished {
+		return
+	}
+	cost := &RequestCost{
+		RequestId: c.GetString(logger.RequestIdKey),
+		Model:     servedModel,
+		Quota:     quota,
+		CostUSD:   float64(quota) / config.QuotaPerUnit,
+	}
+	ctx := c.Request.Context()
+	if tokenId := c.GetInt("token_id"); tokenId > 0 {
+		token, err := model.GetTokenById(tokenId)
+		if err != nil {
+			logger.Warnf(ctx, "cost headers: failed to get token %d: %s", tokenId, err.Error())
+		} else if !token.UnlimitedQuota {
+			remain := token.RemainQuota - pendingQuota
+			cost.TokenRemainingQuota = &remain
+		}
+	}
+	if payerQuota, err := model.CacheGetPayerQuota(ctx, c.GetInt("id"), c.GetInt("org_id")); err == nil {
+		cost.UserRemainingQuota = payerQuota - pendingQuota
+	} else {
+		logger.Warnf(ctx, "cost headers: failed to get payer quota: %s", err.Error())
+	}
+	w.SetCost(cost)
+}
+
+func costComment(cost *RequestCost) string {
+	data, _ := json.Marshal(cost)
+	return fmt.Sprintf("%s%s\n\n", costSSECommentPrefix, data)
+}
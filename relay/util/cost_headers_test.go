@@ -0,0 +1,101 @@
+package util
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/render"
+)
+
+func runCostWriter(t *testing.T, handler func(c *gin.Context, w *CostWriter)) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/", func(c *gin.Context) {
+		w := NewCostWriter(c)
+		defer w.Finish()
+		handler(c, w)
+	})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}")))
+	return rec
+}
+
+func testCost() *RequestCost {
+	remain := int64(1000)
+	return &RequestCost{RequestId: "req-1", Model: "gpt-4o-2024-08-06", Quota: 250000, CostUSD: 0.5, TokenRemainingQuota: &remain, UserRemainingQuota: 5000}
+}
+
+func TestCostWriterNonStreamHeaders(t *testing.T) {
+	rec := runCostWriter(t, func(c *gin.Context, w *CostWriter) {
+		c.JSON(http.StatusOK, gin.H{"id": "chatcmpl-1"})
+		if !c.Writer.Written() || c.Writer.Status() != http.StatusOK {
+			t.Fatalf("缓冲期间应表现为已写出: written=%v status=%d", c.Writer.Written(), c.Writer.Status())
+		}
+		w.SetCost(testCost())
+	})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "chatcmpl-1") {
+		t.Fatalf("响应内容不符: %d %s", rec.Code, rec.Body.String())
+	}
+	want := map[string]string{
+		CostHeaderRequestId:      "req-1",
+		CostHeaderModel:          "gpt-4o-2024-08-06",
+		CostHeaderQuota:          "250000",
+		CostHeaderCostUSD:        "0.500000",
+		CostHeaderTokenRemaining: "1000",
+		CostHeaderUserRemaining:  "5000",
+	}
+	for k, v := range want {
+		if got := rec.Header().Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+}
+
+func TestCostWriterSkipsErrorResponses(t *testing.T) {
+	rec := runCostWriter(t, func(c *gin.Context, w *CostWriter) {
+		w.SetCost(testCost())
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "rate limited"})
+	})
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get(CostHeaderQuota) != "" {
+		t.Fatalf("错误响应不应带计费头: %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestCostWriterStreamCommentBeforeDone(t *testing.T) {
+	rec := runCostWriter(t, func(c *gin.Context, w *CostWriter) {
+		common.SetEventStreamHeaders(c)
+		render.StringData(c, `{"choices":[]}`)
+		render.Done(c)
+		w.SetCost(testCost())
+	})
+	body, _ := io.ReadAll(rec.Body)
+	text := string(body)
+	comment := strings.Index(text, costSSECommentPrefix)
+	done := strings.Index(text, "data: [DONE]")
+	if comment < 0 || done < 0 || comment > done {
+		t.Fatalf("计费注释应位于 [DONE] 之前:\n%s", text)
+	}
+	if !strings.HasPrefix(text, `data: {"choices":[]}`) || !strings.HasSuffix(text, "data: [DONE]\n\n") {
+		t.Fatalf("流内容被破坏:\n%s", text)
+	}
+	if rec.Header().Get(CostHeaderQuota) != "" {
+		t.Fatal("流式响应的头已发出，不应再带计费头")
+	}
+}
+
+func TestCostWriterStreamWithoutCost(t *testing.T) {
+	rec := runCostWriter(t, func(c *gin.Context, w *CostWriter) {
+		common.SetEventStreamHeaders(c)
+		render.StringData(c, `{"choices":[]}`)
+		render.Done(c)
+	})
+	if rec.Body.String() != "data: {\"choices\":[]}\n\ndata: [DONE]\n\n" {
+		t.Fatalf("未计费时流内容应原样输出:\n%q", rec.Body.String())
+	}
+}
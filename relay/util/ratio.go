@@ -6,18 +6,28 @@ import (
 	"github.com/songquanpeng/one-api/model"
 )
 
-// GetBillingGroupRatio 返回计费所需的"组合倍率"，= 等级折扣 × 渠道折扣 × 用户渠道折扣。
+// GetBillingGroupRatio 返回计费所需的"组合倍率"，= 等级折扣 × 渠道折扣 × 用户渠道折扣 × 定价计划倍率。
 //
 // 历史上各 controller 里的 `groupRatio` 只包含等级折扣。为了一次性引入
 // 渠道折扣与用户针对渠道类型的折扣，让所有老 call site 直接把原来的
 // common.GetGroupRatio(group) 替换为本函数即可，语义变成"组合后的总折扣"。
 // 日志里仍然显示为"分组倍率"，但数值已是融合后的结果。
 //
-// channel_discount 和 user_channel_ratio 由 middleware/distributor 在选中渠道时
-// 写入 c，缺省 1.0。拆开三个维度分别打印/调试时调 GetBillingFactors。
+// channel_discount、user_channel_ratio 和 pricing_plan_ratio 由 middleware/distributor
+// 在选中渠道时写入 c，缺省 1.0。拆开各维度分别打印/调试时调 GetBillingFactors / GetPricingPlanRatio。
 func GetBillingGroupRatio(c *gin.Context, group string) float64 {
 	groupRatio, channelDiscount, userChannelRatio := GetBillingFactors(c, group)
-	return groupRatio * channelDiscount * userChannelRatio
+	return groupRatio * channelDiscount * userChannelRatio * GetPricingPlanRatio(c)
+}
+
+// GetPricingPlanRatio 返回用户/分组定价计划的倍率，没有计划时为 1.0
+func GetPricingPlanRatio(c *gin.Context) float64 {
+	if c != nil {
+		if v := c.GetFloat64("pricing_plan_ratio"); v > 0 {
+			return v
+		}
+	}
+	return 1.0
 }
 
 // GetBillingFactors 返回三段折扣分量：等级折扣、渠道折扣、用户渠道折扣。
@@ -64,5 +74,10 @@ func GetAsyncBillingGroupRatio(group string, userId int, channelId int, channelT
 			}
 		}
 	}
-	return groupRatio * channelDiscount * userChannelRatio
+	// 异步回调拿不到请求时的模型，这里只按阶梯计算，不匹配按模型的合同价
+	pricingPlanRatio := 1.0
+	if userId > 0 {
+		pricingPlanRatio, _ = model.GetPricingPlanAdjustment(userId, group, "")
+	}
+	return groupRatio * channelDiscount * userChannelRatio * pricingPlanRatio
 }
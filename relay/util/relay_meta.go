@@ -11,12 +11,14 @@ import (
 )
 
 type RelayMeta struct {
-	Mode         int
-	ChannelType  int
-	ChannelId    int
-	TokenId      int
-	TokenName    string
-	UserId       int
+	Mode        int
+	ChannelType int
+	ChannelId   int
+	TokenId     int
+	TokenName   string
+	UserId      int
+	// OrgId 非 0 表示组织令牌，余额校验与扣费走组织额度池
+	OrgId        int
 	Group        string
 	ModelMapping map[string]string
 	// BaseURL is the proxy url set in the channel config
@@ -52,6 +54,8 @@ type RelayMeta struct {
 	ChannelDiscount float64
 	// 当前用户对当前渠道类型的额外折扣倍率，默认 1.0
 	UserChannelRatio float64
+	// 用户/分组合同定价计划的倍率，默认 1.0
+	PricingPlanRatio float64
 	// StreamStatus 记录流式响应的结束原因和过程错误，非流式请求为 nil
 	StreamStatus *StreamStatus
 }
@@ -68,7 +72,7 @@ func (m *RelayMeta) SetFirstResponseTime() {
 	}
 }
 
-// CombinedGroupRatio 返回计费用的组合折扣 = 等级折扣 × 渠道折扣 × 用户渠道折扣。
+// CombinedGroupRatio 返回计费用的组合折扣 = 等级折扣 × 渠道折扣 × 用户渠道折扣 × 定价计划倍率。
 // 所有通过 meta 计费的 controller 都直接用它，避免 14 处重复表达式。
 func (m *RelayMeta) CombinedGroupRatio() float64 {
 	channelDiscount := m.ChannelDiscount
@@ -79,7 +83,11 @@ func (m *RelayMeta) CombinedGroupRatio() float64 {
 	if userChannelRatio <= 0 {
 		userChannelRatio = 1.0
 	}
-	return common.GetGroupRatio(m.Group) * channelDiscount * userChannelRatio
+	pricingPlanRatio := m.PricingPlanRatio
+	if pricingPlanRatio <= 0 {
+		pricingPlanRatio = 1.0
+	}
+	return common.GetGroupRatio(m.Group) * channelDiscount * userChannelRatio * pricingPlanRatio
 }
 
 // GetFirstWordLatency 获取首字延迟（秒）
@@ -106,6 +114,7 @@ func GetRelayMeta(c *gin.Context) *RelayMeta {
 		TokenId:      c.GetInt("token_id"),
 		TokenName:    c.GetString("token_name"),
 		UserId:       c.GetInt("id"),
+		OrgId:        c.GetInt("org_id"),
 		Group:        c.GetString("group"),
 		ModelMapping: c.GetStringMapString("model_mapping"),
 		BaseURL:      c.GetString("base_url"),
@@ -180,6 +189,10 @@ func GetRelayMeta(c *gin.Context) *RelayMeta {
 	if v := c.GetFloat64("user_channel_ratio"); v > 0 {
 		meta.UserChannelRatio = v
 	}
+	meta.PricingPlanRatio = 1.0
+	if v := c.GetFloat64("pricing_plan_ratio"); v > 0 {
+		meta.PricingPlanRatio = v
+	}
 	return &meta
 }
 
@@ -24,6 +24,9 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/model-plaza/metrics/detail", middleware.TryUserAuth(), controller.GetModelMetricsDetail)
 		apiRouter.GET("/model-plaza/metrics/timeseries", controller.GetModelMetricsTimeSeries)
 		apiRouter.POST("/stripe/webhook", middleware.GlobalWebRateLimit(), controller.StripeWebhook)
+		apiRouter.GET("/payment/fake/checkout", middleware.CriticalRateLimit(), controller.FakePaymentCheckout)
+		apiRouter.GET("/payment/:provider/notify", controller.PaymentNotify)
+		apiRouter.POST("/payment/:provider/notify", controller.PaymentNotify)
 		apiRouter.GET("/verification", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.SendEmailVerification)
 		apiRouter.GET("/reset_password", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.SendPasswordResetEmail)
 		apiRouter.POST("/user/reset", middleware.CriticalRateLimit(), controller.ResetPassword)
@@ -41,7 +44,7 @@ func SetApiRouter(router *gin.Engine) {
 		userRoute := apiRouter.Group("/user")
 		{
 			userRoute.POST("/register", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Register)
-			userRoute.POST("/login", middleware.CriticalRateLimit(), controller.Login)
+			userRoute.POST("/login", middleware.CriticalRateLimit(), middleware.LoginTurnstileCheck(), controller.Login)
 			userRoute.GET("/logout", controller.Logout)
 			userRoute.POST("/epay/notify", controller.EpayNotify)
 			userRoute.GET("/epay/notify", controller.EpayNotify)
@@ -53,7 +56,19 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.PUT("/self", controller.UpdateSelf)
 				selfRoute.DELETE("/self", controller.DeleteSelf)
 				selfRoute.GET("/token", controller.GenerateAccessToken)
+				selfRoute.GET("/login_history", controller.GetSelfLoginHistory)
+				selfRoute.GET("/sessions", controller.GetSelfSessions)
+				selfRoute.DELETE("/sessions/:id", controller.RevokeSelfSession)
+				selfRoute.POST("/sessions/revoke_others", controller.RevokeOtherSelfSessions)
+				selfRoute.GET("/credit", controller.GetSelfCredit)
+				selfRoute.GET("/invoices", controller.GetSelfInvoices)
+				selfRoute.GET("/invoices/:id", controller.GetSelfInvoice)
+				selfRoute.GET("/invoices/:id/statement", controller.GetSelfInvoiceStatement)
 				selfRoute.GET("/aff", controller.GetAffCode)
+				selfRoute.GET("/affiliate", controller.GetSelfAffiliate)
+				selfRoute.GET("/affiliate/invitees", controller.GetSelfAffiliateInvitees)
+				selfRoute.GET("/affiliate/commissions", controller.GetSelfAffiliateCommissions)
+				selfRoute.POST("/affiliate/transfer", middleware.CriticalRateLimit(), controller.TransferAffiliateQuota)
 				selfRoute.POST("/topup", controller.TopUp)
 				selfRoute.GET("/topup/info", controller.GetEpayTopUpInfo)
 				selfRoute.GET("/topup/self", controller.GetUserTopUps)
@@ -61,6 +76,17 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.POST("/amount", controller.RequestAmount)
 				selfRoute.POST("/stripe/pay", middleware.CriticalRateLimit(), controller.RequestStripePay)
 				selfRoute.POST("/stripe/amount", controller.RequestStripeAmount)
+				selfRoute.GET("/payment/providers", controller.GetPaymentProviders)
+				selfRoute.POST("/payment", middleware.CriticalRateLimit(), controller.RequestPayment)
+				selfRoute.POST("/payment/amount", controller.RequestPaymentAmount)
+				selfRoute.GET("/auto_topup", controller.GetSelfAutoTopUp)
+				selfRoute.GET("/model_credits", controller.GetSelfModelCredits)
+				selfRoute.PUT("/auto_topup", controller.UpdateSelfAutoTopUp)
+				selfRoute.POST("/auto_topup/setup", middleware.CriticalRateLimit(), controller.RequestAutoTopUpSetup)
+				selfRoute.GET("/subscription/plans", controller.GetSubscriptionPlans)
+				selfRoute.GET("/subscription", controller.GetSelfSubscriptions)
+				selfRoute.POST("/subscription", middleware.CriticalRateLimit(), controller.RequestStripeSubscription)
+				selfRoute.POST("/subscription/portal", controller.RequestStripePortal)
 			}
 
 			adminRoute := userRoute.Group("/")
@@ -69,6 +95,10 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.GET("/", controller.GetAllUsers)
 				adminRoute.GET("/search", controller.SearchUsers)
 				adminRoute.GET("/:id", controller.GetUser)
+				adminRoute.GET("/:id/sessions", controller.GetUserSessions)
+				adminRoute.POST("/:id/force_logout", controller.ForceLogoutUser)
+				adminRoute.GET("/:id/login_history", controller.GetUserLoginHistory)
+				adminRoute.POST("/:id/unlock_login", controller.UnlockUserLogin)
 				adminRoute.POST("/", controller.CreateUser)
 				adminRoute.POST("/manage", controller.ManageUser)
 				adminRoute.PUT("/", controller.UpdateUser)
@@ -76,6 +106,8 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.DELETE("/:id", controller.DeleteUser)
 				adminRoute.GET("/topup", controller.GetUserTopUps)
 				adminRoute.POST("/topup/complete", controller.CompleteTopUp)
+				adminRoute.POST("/topup/sync", controller.SyncTopUp)
+				adminRoute.POST("/topup/refund", controller.RefundTopUp)
 			}
 		}
 		optionRoute := apiRouter.Group("/option")
@@ -99,6 +131,11 @@ func SetApiRouter(router *gin.Engine) {
 			pricingRoute.GET("/unset", controller.GetUnsetRatioModels)          // 获取未设置倍率的模型
 			pricingRoute.PUT("/model", controller.UpdateModelRatio)             // 更新单个模型倍率
 			pricingRoute.PUT("/models/batch", controller.BatchUpdateModelRatio) // 批量更新模型倍率
+			pricingRoute.GET("/versions", controller.GetPriceBookVersions)
+			pricingRoute.GET("/versions/diff", controller.DiffPriceBookVersions)
+			pricingRoute.GET("/versions/:version_id", controller.GetPriceBookVersion)
+			pricingRoute.POST("/versions", controller.CreatePriceBookVersion)
+			pricingRoute.DELETE("/versions/:version_id", controller.DeletePriceBookVersion)
 		}
 
 		// 测试通知相关路由（需要管理员权限）
@@ -185,6 +222,92 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.PUT("/", controller.UpdateToken)
 			tokenRoute.POST("/batchdelete", controller.BatchDeleteToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
+			tokenRoute.POST("/:id/revoke_ephemeral", controller.RevokeEphemeralKeys)
+			tokenRoute.POST("/:id/unfreeze", controller.UnfreezeToken)
+			tokenRoute.GET("/anomaly", controller.GetTokenAnomalies)
+			tokenRoute.GET("/anomaly/all", middleware.AdminAuth(), controller.GetAllTokenAnomalies)
+		}
+		managementTokenRoute := apiRouter.Group("/management_token")
+		managementTokenRoute.Use(middleware.UserAuth())
+		{
+			managementTokenRoute.GET("/", controller.GetManagementTokens)
+			managementTokenRoute.POST("/", controller.AddManagementToken)
+			managementTokenRoute.DELETE("/:id", controller.RevokeManagementToken)
+		}
+		organizationRoute := apiRouter.Group("/organization")
+		{
+			organizationRoute.GET("/", middleware.AdminAuth(), controller.GetAllOrganizations)
+			organizationRoute.POST("/quota", middleware.AdminAuth(), controller.AdjustOrganizationQuota)
+			organizationRoute.GET("/self", middleware.UserAuth(), controller.GetSelfOrganizations)
+			organizationRoute.POST("/", middleware.UserAuth(), controller.CreateOrganization)
+			organizationRoute.GET("/:id", middleware.UserAuth(), controller.GetOrganization)
+			organizationRoute.PUT("/:id", middleware.UserAuth(), controller.UpdateOrganization)
+			organizationRoute.DELETE("/:id", middleware.UserAuth(), controller.DeleteOrganization)
+			organizationRoute.GET("/:id/members", middleware.UserAuth(), controller.GetOrganizationMembers)
+			organizationRoute.POST("/:id/members", middleware.UserAuth(), controller.AddOrganizationMember)
+			organizationRoute.PUT("/:id/members", middleware.UserAuth(), controller.UpdateOrganizationMember)
+			organizationRoute.DELETE("/:id/members/:user_id", middleware.UserAuth(), controller.RemoveOrganizationMember)
+			organizationRoute.GET("/:id/tokens", middleware.UserAuth(), controller.GetOrganizationTokens)
+			organizationRoute.POST("/:id/tokens", middleware.UserAuth(), controller.AddOrganizationToken)
+			organizationRoute.DELETE("/:id/tokens/:token_id", middleware.UserAuth(), controller.DeleteOrganizationToken)
+			organizationRoute.GET("/:id/usage", middleware.UserAuth(), controller.GetOrganizationUsage)
+		}
+		pricingPlanRoute := apiRouter.Group("/pricing_plan")
+		pricingPlanRoute.Use(middleware.AdminAuth())
+		{
+			pricingPlanRoute.GET("/", controller.GetAllPricingPlans)
+			pricingPlanRoute.GET("/preview", controller.PreviewPricingPlan)
+			pricingPlanRoute.GET("/:id", controller.GetPricingPlan)
+			pricingPlanRoute.POST("/", controller.AddPricingPlan)
+			pricingPlanRoute.PUT("/", controller.UpdatePricingPlan)
+			pricingPlanRoute.DELETE("/:id", controller.DeletePricingPlan)
+		}
+		channelCostRoute := apiRouter.Group("/channel_cost")
+		channelCostRoute.Use(middleware.AdminAuth())
+		{
+			channelCostRoute.GET("/", controller.GetChannelCosts)
+			channelCostRoute.GET("/margin", controller.GetMarginReport)
+			channelCostRoute.GET("/below_cost", controller.GetBelowCostModels)
+			channelCostRoute.POST("/", controller.AddChannelCost)
+			channelCostRoute.PUT("/", controller.UpdateChannelCost)
+			channelCostRoute.DELETE("/:id", controller.DeleteChannelCost)
+		}
+		reconciliationRoute := apiRouter.Group("/reconciliation")
+		reconciliationRoute.Use(middleware.AdminAuth())
+		{
+			reconciliationRoute.GET("/", controller.GetReconciliations)
+			reconciliationRoute.POST("/run", controller.RunReconciliation)
+			reconciliationRoute.PUT("/:id/review", controller.ReviewReconciliation)
+		}
+		subscriptionPlanRoute := apiRouter.Group("/subscription_plan")
+		subscriptionPlanRoute.Use(middleware.AdminAuth())
+		{
+			subscriptionPlanRoute.GET("/", controller.GetAllSubscriptionPlans)
+			subscriptionPlanRoute.POST("/", controller.AddSubscriptionPlan)
+			subscriptionPlanRoute.PUT("/", controller.UpdateSubscriptionPlan)
+			subscriptionPlanRoute.DELETE("/:id", controller.DeleteSubscriptionPlan)
+		}
+		creditAccountRoute := apiRouter.Group("/credit_account")
+		creditAccountRoute.Use(middleware.AdminAuth())
+		{
+			creditAccountRoute.GET("/", controller.GetCreditAccounts)
+			creditAccountRoute.POST("/", controller.SaveCreditAccount)
+			creditAccountRoute.DELETE("/:user_id", controller.DeleteCreditAccount)
+		}
+		affiliateRoute := apiRouter.Group("/affiliate")
+		affiliateRoute.Use(middleware.AdminAuth())
+		{
+			affiliateRoute.GET("/commission", controller.GetAllAffiliateCommissions)
+			affiliateRoute.PUT("/commission/:id/status", controller.UpdateAffiliateCommissionStatus)
+		}
+		invoiceRoute := apiRouter.Group("/invoice")
+		invoiceRoute.Use(middleware.AdminAuth())
+		{
+			invoiceRoute.GET("/", controller.GetAllInvoices)
+			invoiceRoute.POST("/close", controller.CloseInvoice)
+			invoiceRoute.GET("/:id", controller.GetInvoice)
+			invoiceRoute.GET("/:id/statement", controller.GetInvoiceStatement)
+			invoiceRoute.PUT("/:id/status", controller.UpdateInvoiceStatus)
 		}
 		redemptionRoute := apiRouter.Group("/redemption")
 		redemptionRoute.Use(middleware.AdminAuth())
@@ -196,14 +319,28 @@ func SetApiRouter(router *gin.Engine) {
 			redemptionRoute.PUT("/", controller.UpdateRedemption)
 			redemptionRoute.POST("/batchdelete", controller.BatchDeleteRedemption)
 			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
+			redemptionRoute.GET("/logs", controller.GetRedemptionLogs)
+			redemptionRoute.GET("/campaign", controller.GetRedemptionCampaigns)
+			redemptionRoute.GET("/campaign/:id", controller.GetRedemptionCampaign)
+			redemptionRoute.POST("/campaign", controller.AddRedemptionCampaign)
+			redemptionRoute.PUT("/campaign", controller.UpdateRedemptionCampaign)
+			redemptionRoute.POST("/campaign/:id/generate", controller.GenerateCampaignRedemptions)
+			redemptionRoute.GET("/campaign/:id/export", controller.ExportCampaignRedemptions)
 		}
 		logRoute := apiRouter.Group("/log")
 		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
 		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
+		logRoute.GET("/archive", middleware.AdminAuth(), controller.GetLogArchives)
+		logRoute.POST("/archive/run", middleware.AdminAuth(), controller.RunLogArchive)
+		logRoute.POST("/archive/restore", middleware.AdminAuth(), controller.RestoreLogArchive)
+		logRoute.GET("/archive/query", middleware.AdminAuth(), controller.QueryLogArchive)
 		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
 		logRoute.GET("/stat/performance", middleware.AdminAuth(), controller.GetLogsPerformanceStat)
+		logRoute.GET("/usage", middleware.AdminAuth(), controller.GetUsageBreakdown)
+		logRoute.GET("/export/stats", middleware.AdminAuth(), controller.GetLogExportStats)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
 		logRoute.GET("/self/stat/performance", middleware.UserAuth(), controller.GetLogsSelfPerformanceStat)
+		logRoute.GET("/self/usage", middleware.UserAuth(), controller.GetSelfUsageBreakdown)
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
@@ -223,7 +360,7 @@ func SetApiRouter(router *gin.Engine) {
 	// cryptoaiRoute.GET("/pay/crypt/get_qrcode", middleware.UserAuth(), middleware.GlobalAPIRateLimit(), controller.GetQrcode)
 	cryptoaiRoute.GET("/pay/get_qrcode", middleware.UserAuth(), middleware.GlobalAPIRateLimit(), controller.GetQrcode)
 	cryptoaiRoute.GET("/pay/get_channel", middleware.UserAuth(), middleware.GlobalAPIRateLimit(), controller.GetPayChannel)
-	cryptoaiRoute.GET("/crypt/callback", middleware.CryptCallbackAuth(), controller.CryptCallback)
+	cryptoaiRoute.GET("/crypt/callback", controller.CryptCallback)
 
 	orderRoute := apiRouter.Group("/order")
 	orderRoute.GET("/", middleware.AdminAuth(), controller.GetAllOrders)
@@ -243,6 +380,13 @@ func SetApiRouter(router *gin.Engine) {
 	videoRoute.GET("/self", middleware.UserAuth(), controller.GetUserVideos)
 	videoRoute.GET("/", middleware.AdminAuth(), controller.GetAllVideos)
 
+	statusPageRoute := apiRouter.Group("/status_page")
+	statusPageRoute.GET("/", controller.GetStatusPage)
+	statusPageRoute.GET("/history", controller.GetStatusPageHistory)
+	statusPageRoute.GET("/incidents", controller.GetStatusPageIncidents)
+	statusPageRoute.POST("/incident", middleware.AdminAuth(), controller.CreateStatusIncident)
+	statusPageRoute.POST("/incident/:id/update", middleware.AdminAuth(), controller.AddStatusIncidentUpdate)
+
 	imageRoute := apiRouter.Group("/image")
 	imageRoute.GET("/self", middleware.UserAuth(), controller.GetUserImages)
 	imageRoute.GET("/", middleware.AdminAuth(), controller.GetALLImages)
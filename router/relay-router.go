@@ -24,6 +24,8 @@ func SetRelayRouter(router *gin.Engine) {
 	{
 		relayV1Router.POST("/files", controller.UploadFile)
 		relayV1Router.GET("/video/generations/result", controller.RelayVideoResult)
+		relayV1Router.POST("/ephemeral_keys", controller.IssueEphemeralKey)
+		relayV1Router.GET("/ephemeral_keys/self", controller.GetEphemeralKeySpend)
 	}
 
 	// Sora 视频生成路由 - 需要 Distribute 中间件进行渠道选择
@@ -67,16 +69,16 @@ func SetRelayRouter(router *gin.Engine) {
 
 	relayV1Router.Use(middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.Distribute())
 	{
-		relayV1Router.POST("/completions", middleware.Audit(), controller.Relay)
-		relayV1Router.POST("/chat/completions", middleware.Audit(), controller.Relay)
+		relayV1Router.POST("/completions", middleware.CostHeaders(), middleware.Audit(), controller.Relay)
+		relayV1Router.POST("/chat/completions", middleware.CostHeaders(), middleware.Audit(), controller.Relay)
 		relayV1Router.POST("/edits", controller.Relay)
-		relayV1Router.POST("/images/edits", middleware.Audit(), controller.Relay)
+		relayV1Router.POST("/images/edits", middleware.CostHeaders(), middleware.Audit(), controller.Relay)
 		relayV1Router.POST("/images/variations", middleware.Audit(), controller.RelayNotImplemented)
-		relayV1Router.POST("/embeddings", controller.Relay)
-		relayV1Router.POST("/engines/:model/embeddings", controller.Relay)
-		relayV1Router.POST("/audio/transcriptions", controller.Relay)
-		relayV1Router.POST("/audio/translations", controller.Relay)
-		relayV1Router.POST("/audio/speech", controller.Relay)
+		relayV1Router.POST("/embeddings", middleware.CostHeaders(), controller.Relay)
+		relayV1Router.POST("/engines/:model/embeddings", middleware.CostHeaders(), controller.Relay)
+		relayV1Router.POST("/audio/transcriptions", middleware.CostHeaders(), controller.Relay)
+		relayV1Router.POST("/audio/translations", middleware.CostHeaders(), controller.Relay)
+		relayV1Router.POST("/audio/speech", middleware.CostHeaders(), controller.Relay)
 		relayV1Router.GET("/files", controller.RelayNotImplemented)
 		relayV1Router.DELETE("/files/:id", controller.RelayNotImplemented)
 		relayV1Router.GET("/files/:id", controller.RelayNotImplemented)
@@ -124,11 +126,11 @@ func SetRelayRouter(router *gin.Engine) {
 		relayV1Router.POST("/images/crispUpscale", controller.RelayRecraft)
 		relayV1Router.POST("/images/creativeUpscale", controller.RelayRecraft)
 		relayV1Router.POST("/styles", controller.RelayRecraft)
-		relayV1Router.POST("/images/generations", middleware.Audit(), controller.Relay)
-		relayV1Router.POST("/messages", middleware.Audit(), controller.RelayClaude)
+		relayV1Router.POST("/images/generations", middleware.CostHeaders(), middleware.Audit(), controller.Relay)
+		relayV1Router.POST("/messages", middleware.CostHeaders(), middleware.Audit(), controller.RelayClaude)
 		relayV1Router.POST("/messages/count_tokens", controller.RelayClaudeCountTokens) // Claude count_tokens 接口
-		relayV1Router.POST("/responses/compact", middleware.Audit(), controller.RelayResponse)
-		relayV1Router.POST("/responses", middleware.Audit(), controller.RelayResponse)
+		relayV1Router.POST("/responses/compact", middleware.CostHeaders(), middleware.Audit(), controller.RelayResponse)
+		relayV1Router.POST("/responses", middleware.CostHeaders(), middleware.Audit(), controller.RelayResponse)
 	}
 	mjModeMiddleware := func() gin.HandlerFunc {
 		return func(c *gin.Context) {
@@ -349,7 +351,7 @@ func SetRelayRouter(router *gin.Engine) {
 	// 路径格式: /v1beta/models/{model_name}:{action}
 	// 支持 generateContent, streamGenerateContent, embedContent, batchEmbedContents 等操作
 	geminiRouter := router.Group("/v1beta")
-	geminiRouter.Use(middleware.TokenAuth(), middleware.Distribute(), middleware.Audit())
+	geminiRouter.Use(middleware.TokenAuth(), middleware.Distribute(), middleware.CostHeaders(), middleware.Audit())
 	{
 		// 使用通配符捕获 models/ 后的所有内容: gemini-2.0-flash:generateContent
 		geminiRouter.POST("/models/*path", controller.RelayGemini)
@@ -357,14 +359,14 @@ func SetRelayRouter(router *gin.Engine) {
 
 	// Gemini API v1 版本路由（某些模型使用 v1）
 	geminiV1Router := router.Group("/v1")
-	geminiV1Router.Use(middleware.TokenAuth(), middleware.Distribute(), middleware.Audit())
+	geminiV1Router.Use(middleware.TokenAuth(), middleware.Distribute(), middleware.CostHeaders(), middleware.Audit())
 	{
 		geminiV1Router.POST("/models/*path", controller.RelayGemini)
 	}
 
 	// Gemini API v1alpha 版本路由（某些项目使用 v1alpha）
 	geminiV1AlphaRouter := router.Group("/v1alpha")
-	geminiV1AlphaRouter.Use(middleware.TokenAuth(), middleware.Distribute(), middleware.Audit())
+	geminiV1AlphaRouter.Use(middleware.TokenAuth(), middleware.Distribute(), middleware.CostHeaders(), middleware.Audit())
 	{
 		geminiV1AlphaRouter.POST("/models/*path", controller.RelayGemini)
 	}